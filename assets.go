@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gothoom/climg"
+	"gothoom/clsnd"
+)
+
+// pictDefFlagNames names the PictDef flags shown in the asset browser.
+var pictDefFlagNames = []struct {
+	bit  uint32
+	name string
+}{
+	{0x8000, "transparent"},
+	{0x2000, "custom colors"},
+	{0x0400, "no checksum"},
+	{climg.PictDefFlagEmitsLight, "emits light"},
+	{climg.PictDefFlagOnlyAttackPosesLit, "lit when attacking"},
+	{climg.PictDefFlagLightFlicker, "flickers"},
+	{climg.PictDefFlagLightDarkcaster, "darkcaster"},
+}
+
+// pictFlagNames describes flags in words, blend mode first.
+func pictFlagNames(flags uint32) []string {
+	var out []string
+	if blend := flags & 0x3; blend != 0 {
+		out = append(out, fmt.Sprintf("blend %d%%", []int{0, 25, 50, 75}[blend]))
+	}
+	for _, f := range pictDefFlagNames {
+		if flags&f.bit != 0 {
+			out = append(out, f.name)
+		}
+	}
+	return out
+}
+
+// filterAssetIDs returns ids matching every word of query, in ascending
+// order. A number matches IDs that start with it, "a-b" an inclusive range,
+// and anything else a case-insensitive part of one of names(id).
+func filterAssetIDs(ids []uint32, query string, names func(uint32) []string) []uint32 {
+	out := append([]uint32(nil), ids...)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return out
+	}
+	kept := out[:0]
+	for _, id := range out {
+		if assetMatches(id, terms, names) {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
+func assetMatches(id uint32, terms []string, names func(uint32) []string) bool {
+	var lower []string
+	for _, t := range terms {
+		if lo, hi, ok := strings.Cut(t, "-"); ok && lo != "" && hi != "" {
+			a, errA := strconv.ParseUint(lo, 10, 32)
+			b, errB := strconv.ParseUint(hi, 10, 32)
+			if errA == nil && errB == nil {
+				if uint64(id) < a || uint64(id) > b {
+					return false
+				}
+				continue
+			}
+		}
+		if _, err := strconv.ParseUint(t, 10, 32); err == nil {
+			if !strings.HasPrefix(strconv.FormatUint(uint64(id), 10), t) {
+				return false
+			}
+			continue
+		}
+		if lower == nil && names != nil {
+			for _, n := range names(id) {
+				lower = append(lower, strings.ToLower(n))
+			}
+		}
+		found := false
+		for _, n := range lower {
+			if strings.Contains(n, t) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCustomColors reads palette indices separated by spaces or commas,
+// the form the server sends for a picture's custom color slots.
+func parseCustomColors(s string) ([]byte, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	out := make([]byte, 0, len(fields))
+	for _, f := range fields {
+		v, err := strconv.ParseUint(f, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("color %q is not a palette index from 0 to 255", f)
+		}
+		out = append(out, byte(v))
+	}
+	return out, nil
+}
+
+// soundSummary describes a decoded sound's format and length.
+func soundSummary(s *clsnd.Sound) string {
+	channels := "mono"
+	if s.Channels == 2 {
+		channels = "stereo"
+	} else if s.Channels > 2 {
+		channels = fmt.Sprintf("%d channels", s.Channels)
+	}
+	txt := fmt.Sprintf("%d Hz, %d-bit %s", s.SampleRate, s.Bits, channels)
+	frameBytes := int(s.Channels) * int(s.Bits) / 8
+	if frameBytes > 0 && s.SampleRate > 0 {
+		d := time.Duration(len(s.Data)/frameBytes) * time.Second / time.Duration(s.SampleRate)
+		txt += fmt.Sprintf(", %.2fs", d.Seconds())
+	}
+	return txt
+}
+
+// pictItemNames maps picture IDs to the names of the client items drawn
+// with them, worn or in hand.
+func pictItemNames(imgs *climg.CLImages) map[uint32][]string {
+	out := make(map[uint32][]string)
+	if imgs == nil {
+		return out
+	}
+	ids := imgs.ItemIDs()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		it, _ := imgs.Item(id)
+		if it.Name == "" {
+			continue
+		}
+		seen := map[uint32]bool{0: true}
+		for _, p := range []uint32{it.WornPictID, it.RightHandPictID, it.LeftHandPictID} {
+			if !seen[p] {
+				seen[p] = true
+				out[p] = append(out[p], it.Name)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gothoom/clsnd"
+)
+
+func TestFilterAssetIDs(t *testing.T) {
+	ids := []uint32{1200, 12, 5, 120, 300, 44}
+	names := func(id uint32) []string {
+		switch id {
+		case 120:
+			return []string{"Iron Sword"}
+		case 300:
+			return []string{"Sword Scabbard", "Cloak"}
+		}
+		return nil
+	}
+	tests := []struct {
+		query string
+		want  []uint32
+	}{
+		{"", []uint32{5, 12, 44, 120, 300, 1200}},
+		{"12", []uint32{12, 120, 1200}},
+		{"40-300", []uint32{44, 120, 300}},
+		{"sword", []uint32{120, 300}},
+		{"SWORD cloak", []uint32{300}},
+		{"sword 1", []uint32{120}},
+		{"axe", nil},
+	}
+	for _, tt := range tests {
+		got := filterAssetIDs(ids, tt.query, names)
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("filterAssetIDs(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+	if ids[0] != 1200 {
+		t.Errorf("input reordered: %v", ids)
+	}
+}
+
+func TestParseCustomColors(t *testing.T) {
+	got, err := parseCustomColors(" 3, 250 17\t0 ")
+	if err != nil || !reflect.DeepEqual(got, []byte{3, 250, 17, 0}) {
+		t.Errorf("got %v, %v", got, err)
+	}
+	if got, err := parseCustomColors(""); got != nil || err != nil {
+		t.Errorf("empty: got %v, %v", got, err)
+	}
+	for _, bad := range []string{"256", "-1", "red"} {
+		if _, err := parseCustomColors(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestPictFlagNames(t *testing.T) {
+	got := strings.Join(pictFlagNames(0x8000|0x2000|0x0200|2), ", ")
+	if want := "blend 50%, transparent, custom colors, emits light"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := pictFlagNames(0); got != nil {
+		t.Errorf("no flags: got %v", got)
+	}
+}
+
+func TestSoundSummary(t *testing.T) {
+	s := &clsnd.Sound{Data: make([]byte, 22050), SampleRate: 22050, Channels: 1, Bits: 8}
+	if got, want := soundSummary(s), "22050 Hz, 8-bit mono, 1.00s"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	s = &clsnd.Sound{Data: make([]byte, 44100), SampleRate: 11025, Channels: 2, Bits: 16}
+	if got, want := soundSummary(s), "11025 Hz, 16-bit stereo, 1.00s"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
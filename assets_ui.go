@@ -0,0 +1,393 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+	"time"
+
+	"gothoom/eui"
+
+	ebiten "github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	assetCols      = 6
+	assetRows      = 4
+	assetCellSize  = 72
+	assetPreview   = 200
+	assetSoundRows = 14
+	assetAnimRate  = 200 * time.Millisecond
+)
+
+type assetCell struct {
+	item  *eui.ItemData
+	img   *ebiten.Image
+	label *eui.ItemData
+	id    uint32
+}
+
+var (
+	assetsWin       *eui.WindowData
+	assetsBody      *eui.ItemData
+	assetsInfo      *eui.ItemData
+	assetsPageLabel *eui.ItemData
+	assetsPrevItem  *eui.ItemData
+	assetsPrevImg   *ebiten.Image
+	assetsCells     []assetCell
+
+	assetsSounds   bool
+	assetsQuery    string
+	assetsColorsIn string
+	assetsColors   []byte
+	assetsPage     int
+	assetsIDs      []uint32
+	assetsListed   bool
+	assetsSelected uint32
+	assetsHasSel   bool
+	assetsItems    map[uint32][]string
+	assetsFrame    int
+	assetsLastAnim time.Time
+)
+
+// makeAssetsWindow builds the browser for the pictures in CL_Images and
+// the sounds in CL_Sounds.
+func makeAssetsWindow() {
+	if assetsWin != nil {
+		return
+	}
+	assetsWin = eui.NewWindow()
+	assetsWin.Title = "Assets"
+	assetsWin.Size = eui.Point{X: assetCols*(assetCellSize+4) + assetPreview + 60, Y: 560}
+	assetsWin.Closable = true
+	assetsWin.Movable = true
+	assetsWin.Resizable = false
+	assetsWin.NoScroll = true
+	assetsWin.SetZone(eui.HZoneCenter, eui.VZoneMiddleTop)
+
+	flow := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL, Fixed: true}
+	assetsWin.AddItem(flow)
+
+	top := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL, Fixed: true}
+	mode := func(label string, sounds bool) {
+		btn, events := eui.NewButton()
+		btn.Text = label
+		btn.Size = eui.Point{X: 80, Y: 24}
+		events.Handle = func(ev eui.UIEvent) {
+			if ev.Type == eui.EventClick && assetsSounds != sounds {
+				assetsSounds = sounds
+				assetsPage = 0
+				assetsHasSel = false
+				refreshAssets()
+			}
+		}
+		top.AddItem(btn)
+	}
+	mode("Pictures", false)
+	mode("Sounds", true)
+	search, _ := eui.NewInput()
+	search.Label = "Search"
+	search.TextPtr = &assetsQuery
+	search.Size = eui.Point{X: 260, Y: 24}
+	search.Action = func() {
+		assetsPage = 0
+		refreshAssets()
+	}
+	top.AddItem(search)
+	page := func(label string, delta int) {
+		btn, events := eui.NewButton()
+		btn.Text = label
+		btn.Size = eui.Point{X: 28, Y: 24}
+		events.Handle = func(ev eui.UIEvent) {
+			if ev.Type == eui.EventClick {
+				assetsPage += delta
+				rebuildAssetsBody()
+			}
+		}
+		top.AddItem(btn)
+	}
+	page("<", -1)
+	assetsPageLabel, _ = eui.NewText()
+	assetsPageLabel.FontSize = 11
+	assetsPageLabel.Size = eui.Point{X: 150, Y: 24}
+	top.AddItem(assetsPageLabel)
+	page(">", 1)
+	flow.AddItem(top)
+
+	row := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL, Fixed: true}
+	assetsBody = &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL, Fixed: true}
+	assetsBody.Size = eui.Point{X: assetCols * (assetCellSize + 4), Y: assetsWin.Size.Y - 60}
+	row.AddItem(assetsBody)
+
+	side := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL, Fixed: true}
+	assetsPrevItem, assetsPrevImg = eui.NewImageFastItem(assetPreview, assetPreview)
+	side.AddItem(assetsPrevItem)
+	colors, _ := eui.NewInput()
+	colors.Label = "Colors"
+	colors.TextPtr = &assetsColorsIn
+	colors.Size = eui.Point{X: assetPreview, Y: 24}
+	colors.Action = func() {
+		c, err := parseCustomColors(assetsColorsIn)
+		if err != nil {
+			makeErrorWindow("Error: Colors: " + err.Error())
+			return
+		}
+		assetsColors = c
+		assetsLastAnim = time.Time{}
+	}
+	side.AddItem(colors)
+	assetsInfo = &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL, Fixed: true}
+	side.AddItem(assetsInfo)
+	row.AddItem(side)
+	flow.AddItem(row)
+
+	assetsWin.AddWindow(false)
+}
+
+// refreshAssets reapplies the search and shows the current page.
+func refreshAssets() {
+	if assetsWin == nil {
+		return
+	}
+	var ids []uint32
+	var names func(uint32) []string
+	if assetsSounds {
+		if clSounds != nil {
+			ids = clSounds.IDs()
+		}
+	} else if clImages != nil {
+		ids = clImages.IDs()
+		if assetsItems == nil {
+			assetsItems = pictItemNames(clImages)
+		}
+		names = func(id uint32) []string { return assetsItems[id] }
+	}
+	assetsIDs = filterAssetIDs(ids, assetsQuery, names)
+	assetsListed = true
+	rebuildAssetsBody()
+}
+
+func assetsPerPage() int {
+	if assetsSounds {
+		return assetSoundRows
+	}
+	return assetCols * assetRows
+}
+
+// rebuildAssetsBody lays out the grid of pictures or the list of sounds
+// for the current page.
+func rebuildAssetsBody() {
+	per := assetsPerPage()
+	pages := (len(assetsIDs) + per - 1) / per
+	assetsPage = max(0, min(assetsPage, pages-1))
+	kind := "pictures"
+	if assetsSounds {
+		kind = "sounds"
+	}
+	assetsPageLabel.Text = fmt.Sprintf("%d %s, page %d/%d", len(assetsIDs), kind, assetsPage+1, max(pages, 1))
+	assetsPageLabel.Dirty = true
+
+	start := assetsPage * per
+	end := min(start+per, len(assetsIDs))
+	page := assetsIDs[start:end]
+
+	assetsBody.Contents = assetsBody.Contents[:0]
+	assetsCells = assetsCells[:0]
+	if len(page) == 0 {
+		hint, _ := eui.NewText()
+		hint.Text = "Nothing matches. Search by ID (\"12\" finds 12, 120, 1234...), ID range (\"100-200\") or item name."
+		if (assetsSounds && clSounds == nil) || (!assetsSounds && clImages == nil) {
+			hint.Text = "The data files are not loaded."
+		}
+		hint.FontSize = 11
+		hint.Size = eui.Point{X: assetsBody.Size.X, Y: 48}
+		assetsBody.AddItem(hint)
+	} else if assetsSounds {
+		buildSoundRows(page)
+	} else {
+		buildPictureGrid(page)
+	}
+	updateAssetsInfo()
+	assetsLastAnim = time.Time{}
+	assetsWin.Refresh()
+}
+
+func buildPictureGrid(page []uint32) {
+	var row *eui.ItemData
+	for i, id := range page {
+		if i%assetCols == 0 {
+			row = &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL, Fixed: true}
+			assetsBody.AddItem(row)
+		}
+		cell := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL}
+		item, img := eui.NewImageFastItem(assetCellSize, assetCellSize)
+		item.Margin = 2
+		label, _ := eui.NewText()
+		label.Text = fmt.Sprint(id)
+		label.FontSize = 10
+		label.Size = eui.Point{X: assetCellSize, Y: 14}
+		pick := id
+		item.Action = func() { selectAsset(pick) }
+		label.Action = item.Action
+		cell.AddItem(item)
+		cell.AddItem(label)
+		row.AddItem(cell)
+		assetsCells = append(assetsCells, assetCell{item: item, img: img, label: label, id: id})
+	}
+}
+
+func buildSoundRows(page []uint32) {
+	for _, id := range page {
+		row := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL, Fixed: true}
+		play, events := eui.NewButton()
+		play.Text = "Play"
+		play.Size = eui.Point{X: 50, Y: 24}
+		sid := id
+		events.Handle = func(ev eui.UIEvent) {
+			if ev.Type == eui.EventClick {
+				selectAsset(sid)
+				playSound([]uint16{uint16(sid)})
+			}
+		}
+		row.AddItem(play)
+		label, _ := eui.NewText()
+		label.Text = fmt.Sprintf("%d  %s", id, soundInfo(id))
+		label.FontSize = 11
+		label.Size = eui.Point{X: assetsBody.Size.X - 56, Y: 24}
+		label.Action = func() { selectAsset(sid) }
+		row.AddItem(label)
+		assetsBody.AddItem(row)
+	}
+}
+
+// soundInfo decodes sound id for its format, or explains why it can't.
+func soundInfo(id uint32) string {
+	if clSounds == nil {
+		return ""
+	}
+	s, err := clSounds.Get(id)
+	if err != nil {
+		return "cannot decode: " + err.Error()
+	}
+	if s == nil {
+		return "missing"
+	}
+	return soundSummary(s)
+}
+
+func selectAsset(id uint32) {
+	assetsSelected, assetsHasSel = id, true
+	updateAssetsInfo()
+	assetsLastAnim = time.Time{}
+	assetsWin.Refresh()
+}
+
+// updateAssetsInfo lists what is known about the selected asset.
+func updateAssetsInfo() {
+	assetsInfo.Contents = assetsInfo.Contents[:0]
+	line := func(s string) {
+		t, _ := eui.NewText()
+		t.Text = s
+		t.FontSize = 11
+		t.Size = eui.Point{X: assetPreview + 40, Y: 16}
+		assetsInfo.AddItem(t)
+	}
+	if !assetsHasSel {
+		line("Click an asset for details.")
+		return
+	}
+	id := assetsSelected
+	if assetsSounds {
+		line(fmt.Sprintf("Sound %d", id))
+		line(soundInfo(id))
+		if gs.Mute || !gs.GameSound {
+			line("Game sound is off in the Mixer.")
+		}
+		return
+	}
+	if clImages == nil {
+		return
+	}
+	w, h := clImages.Size(id)
+	frames := clImages.NumFrames(id)
+	line(fmt.Sprintf("Picture %d", id))
+	line(fmt.Sprintf("%dx%d, %d frame(s) of %dx%d", w, h, frames, w, h/max(frames, 1)))
+	flags := clImages.Flags(id)
+	line(fmt.Sprintf("Plane %d, flags %#04x", clImages.Plane(id), flags))
+	if names := pictFlagNames(flags); len(names) > 0 {
+		line("  " + strings.Join(names, ", "))
+	}
+	if li, ok := clImages.Lighting(id); ok {
+		line(fmt.Sprintf("Light radius %d, plane %d", li.Radius, li.Plane))
+		line(fmt.Sprintf("  color %d,%d,%d alpha %d", li.Color[0], li.Color[1], li.Color[2], li.Color[3]))
+	}
+	for _, n := range assetsItems[id] {
+		line("Item: " + n)
+	}
+}
+
+// assetFrameImage returns one frame of a picture as stored in CL_Images,
+// without HD replacements, recolored with colors when given.
+func assetFrameImage(id uint32, frame int, colors []byte) *ebiten.Image {
+	sheet := loadSheet(uint16(id), colors, false)
+	if sheet == nil {
+		return nil
+	}
+	frames := max(clImages.NumFrames(id), 1)
+	w := sheet.Bounds().Dx() - 2
+	h := (sheet.Bounds().Dy() - 2) / frames
+	if w <= 0 || h <= 0 {
+		return nil
+	}
+	y := 1 + (frame%frames)*h
+	return sheet.SubImage(image.Rect(1, y, 1+w, y+h)).(*ebiten.Image)
+}
+
+// drawAssetFit draws src centered in dst, shrunk to fit or enlarged by up
+// to maxScale.
+func drawAssetFit(dst, src *ebiten.Image, maxScale float64) {
+	dst.Clear()
+	if src == nil {
+		return
+	}
+	dw, dh := float64(dst.Bounds().Dx()), float64(dst.Bounds().Dy())
+	sw, sh := float64(src.Bounds().Dx()), float64(src.Bounds().Dy())
+	scale := math.Min(math.Min(dw/sw, dh/sh), maxScale)
+	op := &ebiten.DrawImageOptions{}
+	if scale < 1 {
+		op.Filter = ebiten.FilterLinear
+	}
+	op.GeoM.Scale(scale, scale)
+	op.GeoM.Translate((dw-sw*scale)/2, (dh-sh*scale)/2)
+	dst.DrawImage(src, op)
+}
+
+// updateAssetsWindow steps the animated previews while the window is open.
+func updateAssetsWindow() {
+	if assetsWin == nil || !assetsWin.IsOpen() || clImages == nil {
+		return
+	}
+	if !assetsListed {
+		// Reopened from the saved layout.
+		refreshAssets()
+	}
+	if time.Since(assetsLastAnim) < assetAnimRate {
+		return
+	}
+	assetsLastAnim = time.Now()
+	assetsFrame++
+	for _, c := range assetsCells {
+		f := clImages.FrameIndex(c.id, assetsFrame)
+		drawAssetFit(c.img, assetFrameImage(c.id, f, nil), 1)
+		c.item.Dirty = true
+	}
+	if assetsHasSel && !assetsSounds {
+		f := clImages.FrameIndex(assetsSelected, assetsFrame)
+		drawAssetFit(assetsPrevImg, assetFrameImage(assetsSelected, f, assetsColors), 4)
+	} else {
+		assetsPrevImg.Clear()
+	}
+	assetsPrevItem.Dirty = true
+	assetsWin.Dirty = true
+}
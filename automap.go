@@ -0,0 +1,491 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The auto-mapper places every ground picture the server draws at a world
+// position: the camera moves by the shift pictureShift finds between frames,
+// and each picture sits at the camera plus its field offset. Frames whose
+// shift cannot be resolved (teleports, area changes) are matched against the
+// known segments by voting on picture positions; when nothing matches, a new
+// segment starts. Young segments that turn out to overlap a known one are
+// merged into it.
+
+const autoMapFile = "automap.json.gz"
+
+const (
+	// mapChunkSize is the side of a rendered map chunk in world pixels.
+	mapChunkSize = 512
+	// mapLocateMinPics is how many ground pictures a frame needs before it
+	// can start a segment or be located in one.
+	mapLocateMinPics = 8
+	// mapLocateMaxRefs skips pictures that appear too often in a segment
+	// (grass, floor tiles) when voting; they say little about position.
+	mapLocateMaxRefs = 256
+	// mapFreshFrames is how long a new segment keeps trying to find itself
+	// in the known ones.
+	mapFreshFrames = 120
+	// mapMinSegmentPics drops segments too small to be worth keeping.
+	mapMinSegmentPics = 40
+)
+
+type mapPoint struct{ X, Y int32 }
+
+type mapPict struct {
+	ID   uint16
+	X, Y int32
+}
+
+type mapWaypoint struct {
+	Name string `json:"name"`
+	X    int32  `json:"x"`
+	Y    int32  `json:"y"`
+}
+
+type mapChunk struct {
+	pics  []mapPict // pictures whose bounds touch the chunk
+	dirty bool
+	drawn mapChunkImage
+}
+
+type mapSegment struct {
+	ID        int
+	Name      string
+	Waypoints []mapWaypoint
+
+	pics   map[mapPict]struct{}
+	byID   map[uint16][]mapPoint
+	chunks map[mapPoint]*mapChunk
+	min    mapPoint
+	max    mapPoint
+}
+
+func newMapSegment(id int) *mapSegment {
+	return &mapSegment{
+		ID:     id,
+		Name:   fmt.Sprintf("Area %d", id),
+		pics:   make(map[mapPict]struct{}),
+		byID:   make(map[uint16][]mapPoint),
+		chunks: make(map[mapPoint]*mapChunk),
+	}
+}
+
+// add records p and reports whether it was new.
+func (s *mapSegment) add(p mapPict, size func(uint16) (int, int)) bool {
+	if _, ok := s.pics[p]; ok {
+		return false
+	}
+	if len(s.pics) == 0 {
+		s.min, s.max = mapPoint{p.X, p.Y}, mapPoint{p.X, p.Y}
+	}
+	s.pics[p] = struct{}{}
+	s.byID[p.ID] = append(s.byID[p.ID], mapPoint{p.X, p.Y})
+	w, h := size(p.ID)
+	left, top := p.X-int32(w/2), p.Y-int32(h/2)
+	right, bottom := left+int32(w), top+int32(h)
+	s.min.X, s.min.Y = min32(s.min.X, left), min32(s.min.Y, top)
+	s.max.X, s.max.Y = max32(s.max.X, right), max32(s.max.Y, bottom)
+	for cy := chunkIndex(top); cy <= chunkIndex(bottom); cy++ {
+		for cx := chunkIndex(left); cx <= chunkIndex(right); cx++ {
+			k := mapPoint{cx, cy}
+			c := s.chunks[k]
+			if c == nil {
+				c = &mapChunk{}
+				s.chunks[k] = c
+			}
+			c.pics = append(c.pics, p)
+			c.dirty = true
+		}
+	}
+	return true
+}
+
+func chunkIndex(v int32) int32 {
+	if v < 0 {
+		return (v+1)/mapChunkSize - 1
+	}
+	return v / mapChunkSize
+}
+
+func min32(a, b int32) int32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max32(a, b int32) int32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// autoMapper accumulates the segments and tracks where the player is.
+type autoMapper struct {
+	mu       sync.Mutex
+	segments []*mapSegment
+	cur      *mapSegment
+	cam      mapPoint // world position of the field centre in cur
+	lost     bool
+	fresh    int // frames left for cur to find itself in another segment
+	nextID   int
+	dirty    bool
+	changed  bool // new pictures since the map windows last redrew
+	size     func(uint16) (int, int)
+	isGround func(framePicture) bool
+}
+
+var autoMap = newAutoMapper()
+
+func newAutoMapper() *autoMapper {
+	return &autoMapper{
+		nextID:   1,
+		lost:     true,
+		size:     mapPictureSize,
+		isGround: isMapGround,
+	}
+}
+
+// mapPictureSize returns the size of one frame of a picture.
+func mapPictureSize(id uint16) (int, int) {
+	if clImages == nil {
+		return 0, 0
+	}
+	w, h := clImages.Size(uint32(id))
+	if frames := clImages.NumFrames(uint32(id)); frames > 1 {
+		h /= frames
+	}
+	return w, h
+}
+
+// isMapGround reports whether p belongs on the map: static pictures on or
+// below the ground plane.
+func isMapGround(p framePicture) bool {
+	if p.Plane > 0 || p.Moving {
+		return false
+	}
+	_, skip := skipPictShift[p.PictID]
+	return !skip
+}
+
+// observe takes one frame's pictures and the shift pictureShift found
+// between it and the previous frame.
+func (m *autoMapper) observe(pics []framePicture, dx, dy int, ok bool) {
+	ground := make([]framePicture, 0, len(pics))
+	for _, p := range pics {
+		if m.isGround(p) {
+			ground = append(ground, p)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if ok && !m.lost {
+		m.cam.X -= int32(dx)
+		m.cam.Y -= int32(dy)
+		if m.fresh > 0 {
+			m.fresh--
+			// Checking every frame would be wasteful; the area will still
+			// be in view a few frames on.
+			if m.fresh%10 == 0 {
+				if seg, cam, found := m.locate(ground, m.cur); found {
+					m.merge(seg, cam)
+				}
+			}
+		}
+	} else {
+		if len(ground) < mapLocateMinPics {
+			m.lost = true
+			return
+		}
+		if seg, cam, found := m.locate(ground, nil); found {
+			m.cur, m.cam = seg, cam
+		} else {
+			m.cur = newMapSegment(m.nextID)
+			m.nextID++
+			m.segments = append(m.segments, m.cur)
+			m.cam = mapPoint{}
+			m.fresh = mapFreshFrames
+		}
+		m.lost = false
+	}
+	for _, p := range ground {
+		if m.cur.add(mapPict{ID: p.PictID, X: m.cam.X + int32(p.H), Y: m.cam.Y + int32(p.V)}, m.size) {
+			m.dirty = true
+			m.changed = true
+		}
+	}
+}
+
+// locate finds the segment and camera position where most of pics are
+// already known. skip is left out of the search.
+func (m *autoMapper) locate(pics []framePicture, skip *mapSegment) (*mapSegment, mapPoint, bool) {
+	var (
+		bestSeg   *mapSegment
+		bestCam   mapPoint
+		bestVotes int
+	)
+	for _, seg := range m.segments {
+		if seg == skip {
+			continue
+		}
+		votes := make(map[mapPoint]int)
+		considered := 0
+		for _, p := range pics {
+			refs := seg.byID[p.PictID]
+			if len(refs) > mapLocateMaxRefs {
+				continue
+			}
+			considered++
+			for _, r := range refs {
+				votes[mapPoint{r.X - int32(p.H), r.Y - int32(p.V)}]++
+			}
+		}
+		for cam, n := range votes {
+			// Most of the telling pictures have to agree.
+			if n > bestVotes && n >= mapLocateMinPics && n*2 >= considered {
+				bestSeg, bestCam, bestVotes = seg, cam, n
+			}
+		}
+	}
+	return bestSeg, bestCam, bestSeg != nil
+}
+
+// merge moves the current segment into seg, where the camera is at cam.
+func (m *autoMapper) merge(seg *mapSegment, cam mapPoint) {
+	from := m.cur
+	off := mapPoint{cam.X - m.cam.X, cam.Y - m.cam.Y}
+	for p := range from.pics {
+		seg.add(mapPict{ID: p.ID, X: p.X + off.X, Y: p.Y + off.Y}, m.size)
+	}
+	for _, w := range from.Waypoints {
+		seg.Waypoints = append(seg.Waypoints, mapWaypoint{Name: w.Name, X: w.X + off.X, Y: w.Y + off.Y})
+	}
+	for i, s := range m.segments {
+		if s == from {
+			m.segments = append(m.segments[:i], m.segments[i+1:]...)
+			break
+		}
+	}
+	m.cur, m.cam, m.fresh = seg, cam, 0
+	m.dirty, m.changed = true, true
+}
+
+// relayout rebuilds every segment's bounds and chunks with the current
+// picture sizes, for a map loaded before CL_Images was available.
+func (m *autoMapper) relayout() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, seg := range m.segments {
+		pics := seg.pics
+		seg.pics = make(map[mapPict]struct{}, len(pics))
+		seg.byID = make(map[uint16][]mapPoint)
+		seg.chunks = make(map[mapPoint]*mapChunk)
+		for p := range pics {
+			seg.add(p, m.size)
+		}
+	}
+	m.changed = true
+}
+
+// position returns the player's segment and world position, or nil while
+// the mapper is lost.
+func (m *autoMapper) position() (*mapSegment, mapPoint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lost {
+		return nil, mapPoint{}
+	}
+	return m.cur, m.cam
+}
+
+// addWaypoint marks the player's position.
+func (m *autoMapper) addWaypoint(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lost || m.cur == nil {
+		return fmt.Errorf("your position is not mapped yet")
+	}
+	m.cur.Waypoints = append(m.cur.Waypoints, mapWaypoint{Name: name, X: m.cam.X, Y: m.cam.Y})
+	m.dirty, m.changed = true, true
+	return nil
+}
+
+func (m *autoMapper) removeWaypoint(seg *mapSegment, i int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i >= 0 && i < len(seg.Waypoints) {
+		seg.Waypoints = append(seg.Waypoints[:i], seg.Waypoints[i+1:]...)
+		m.dirty, m.changed = true, true
+	}
+}
+
+func (m *autoMapper) rename(seg *mapSegment, name string) {
+	m.mu.Lock()
+	seg.Name = name
+	m.dirty, m.changed = true, true
+	m.mu.Unlock()
+}
+
+// list returns the segments in creation order.
+func (m *autoMapper) list() []*mapSegment {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*mapSegment(nil), m.segments...)
+}
+
+// waypoints returns a copy of seg's waypoints.
+func (m *autoMapper) waypoints(seg *mapSegment) []mapWaypoint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mapWaypoint(nil), seg.Waypoints...)
+}
+
+func (m *autoMapper) name(seg *mapSegment) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return seg.Name
+}
+
+// bounds returns the area seg covers in world pixels.
+func (m *autoMapper) bounds(seg *mapSegment) (mapPoint, mapPoint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return seg.min, seg.max
+}
+
+// takeChanged reports whether the map changed since the last call.
+func (m *autoMapper) takeChanged() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.changed
+	m.changed = false
+	return c
+}
+
+// autoMapData is the saved form of the map.
+type autoMapData struct {
+	Version  int              `json:"version"`
+	NextID   int              `json:"next_id"`
+	Segments []autoMapSegment `json:"segments"`
+}
+
+type autoMapSegment struct {
+	ID        int           `json:"id"`
+	Name      string        `json:"name"`
+	Pictures  [][3]int32    `json:"pictures"` // picture ID, x, y
+	Waypoints []mapWaypoint `json:"waypoints,omitempty"`
+}
+
+// save writes the map to path unless nothing changed. Segments with only
+// a few pictures and no waypoints are left out.
+func (m *autoMapper) save(path string) error {
+	m.mu.Lock()
+	if !m.dirty {
+		m.mu.Unlock()
+		return nil
+	}
+	data := autoMapData{Version: 1, NextID: m.nextID}
+	for _, seg := range m.segments {
+		if len(seg.pics) < mapMinSegmentPics && len(seg.Waypoints) == 0 {
+			continue
+		}
+		out := autoMapSegment{ID: seg.ID, Name: seg.Name, Waypoints: seg.Waypoints}
+		out.Pictures = make([][3]int32, 0, len(seg.pics))
+		for p := range seg.pics {
+			out.Pictures = append(out.Pictures, [3]int32{int32(p.ID), p.X, p.Y})
+		}
+		data.Segments = append(data.Segments, out)
+	}
+	m.dirty = false
+	m.mu.Unlock()
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(f)
+	err = json.NewEncoder(gz).Encode(data)
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// load replaces the map with the one saved at path.
+func (m *autoMapper) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	var data autoMapData
+	if err := json.NewDecoder(gz).Decode(&data); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.segments, m.cur, m.lost = nil, nil, true
+	m.nextID = data.NextID
+	for _, in := range data.Segments {
+		seg := newMapSegment(in.ID)
+		seg.Name = in.Name
+		seg.Waypoints = in.Waypoints
+		for _, p := range in.Pictures {
+			seg.add(mapPict{ID: uint16(p[0]), X: p[1], Y: p[2]}, m.size)
+		}
+		m.segments = append(m.segments, seg)
+		if in.ID >= m.nextID {
+			m.nextID = in.ID + 1
+		}
+	}
+	m.changed = true
+	return nil
+}
+
+// loadAutoMap reads the saved map. Picture sizes come from CL_Images, so
+// call it after clImages is loaded.
+func loadAutoMap() {
+	err := autoMap.load(filepath.Join(dataDirPath, autoMapFile))
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("load auto-map: %v", err)
+	}
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		for range ticker.C {
+			saveAutoMap()
+		}
+	}()
+}
+
+func saveAutoMap() {
+	// Movies and captures may come from other servers or times; map them
+	// for the session only.
+	if clmov != "" || pcapPath != "" || fake {
+		return
+	}
+	if err := autoMap.save(filepath.Join(dataDirPath, autoMapFile)); err != nil {
+		log.Printf("save auto-map: %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"image/color"
+	"sort"
+
+	ebiten "github.com/hajimehoshi/ebiten/v2"
+	text "github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	// mapChunkScale is the resolution chunks are cached at, in image pixels
+	// per world pixel.
+	mapChunkScale = 0.25
+	// mapMaxChunkImages bounds the cached chunk images (64 KiB each).
+	mapMaxChunkImages = 1024
+	// mapChunkRendersPerDraw spreads re-rendering dirty chunks over frames.
+	mapChunkRendersPerDraw = 8
+)
+
+// mapChunkImage is the cached rendering of a chunk.
+type mapChunkImage struct {
+	img  *ebiten.Image
+	used int
+}
+
+var (
+	mapDrawGen     int
+	mapImageChunks []*mapChunk
+)
+
+var (
+	mapPlayerColor   = color.RGBA{0xff, 0x30, 0x30, 0xff}
+	mapWaypointColor = color.RGBA{0xff, 0xd7, 0x00, 0xff}
+)
+
+// renderMapChunk draws the chunk at key into its cached image.
+func renderMapChunk(c *mapChunk, key mapPoint) {
+	side := int(mapChunkSize * mapChunkScale)
+	if c.drawn.img == nil {
+		c.drawn.img = ebiten.NewImage(side, side)
+		mapImageChunks = append(mapImageChunks, c)
+	} else {
+		c.drawn.img.Clear()
+	}
+	pics := append([]mapPict(nil), c.pics...)
+	plane := func(id uint16) int {
+		if clImages == nil {
+			return 0
+		}
+		return clImages.Plane(uint32(id))
+	}
+	// Same order as the game draws them.
+	sort.SliceStable(pics, func(i, j int) bool {
+		pi, pj := plane(pics[i].ID), plane(pics[j].ID)
+		if pi != pj {
+			return pi < pj
+		}
+		if pics[i].Y != pics[j].Y {
+			return pics[i].Y < pics[j].Y
+		}
+		return pics[i].X < pics[j].X
+	})
+	ox, oy := float64(key.X*mapChunkSize), float64(key.Y*mapChunkSize)
+	for _, p := range pics {
+		img, _ := loadPictureFrame(p.ID, 0)
+		if img == nil {
+			continue
+		}
+		iw, ih := img.Bounds().Dx(), img.Bounds().Dy()
+		w, h := mapPictureSize(p.ID)
+		if w == 0 || h == 0 {
+			w, h = iw, ih
+		}
+		op := &ebiten.DrawImageOptions{Filter: ebiten.FilterLinear}
+		op.GeoM.Scale(float64(w)/float64(iw), float64(h)/float64(ih))
+		op.GeoM.Translate(float64(p.X)-float64(w)/2-ox, float64(p.Y)-float64(h)/2-oy)
+		op.GeoM.Scale(mapChunkScale, mapChunkScale)
+		c.drawn.img.DrawImage(img, op)
+	}
+	c.dirty = false
+}
+
+// evictMapChunks drops the least recently drawn chunk images once there
+// are too many.
+func evictMapChunks() {
+	if len(mapImageChunks) <= mapMaxChunkImages {
+		return
+	}
+	sort.Slice(mapImageChunks, func(i, j int) bool {
+		return mapImageChunks[i].drawn.used > mapImageChunks[j].drawn.used
+	})
+	keep := mapMaxChunkImages * 3 / 4
+	for _, c := range mapImageChunks[keep:] {
+		c.drawn.img.Deallocate()
+		c.drawn.img = nil
+		c.dirty = true
+	}
+	mapImageChunks = mapImageChunks[:keep]
+}
+
+// drawAutoMap draws seg into dst with the world point center in the middle
+// at scale screen pixels per world pixel. The player is marked when they
+// are in seg.
+func drawAutoMap(dst *ebiten.Image, seg *mapSegment, centerX, centerY, scale float64) {
+	dst.Fill(color.Black)
+	if seg == nil {
+		return
+	}
+	player, at := autoMap.position()
+
+	autoMap.mu.Lock()
+	defer autoMap.mu.Unlock()
+	mapDrawGen++
+	w, h := float64(dst.Bounds().Dx()), float64(dst.Bounds().Dy())
+	left, top := centerX-w/2/scale, centerY-h/2/scale
+	right, bottom := centerX+w/2/scale, centerY+h/2/scale
+	renders := 0
+	stale := false
+	for key, c := range seg.chunks {
+		cx, cy := float64(key.X*mapChunkSize), float64(key.Y*mapChunkSize)
+		if cx > right || cy > bottom || cx+mapChunkSize < left || cy+mapChunkSize < top {
+			continue
+		}
+		if c.drawn.img == nil || c.dirty {
+			if renders < mapChunkRendersPerDraw {
+				renderMapChunk(c, key)
+				renders++
+			} else {
+				stale = true
+				if c.drawn.img == nil {
+					continue
+				}
+			}
+		}
+		c.drawn.used = mapDrawGen
+		op := &ebiten.DrawImageOptions{Filter: ebiten.FilterLinear}
+		op.GeoM.Scale(scale/mapChunkScale, scale/mapChunkScale)
+		op.GeoM.Translate((cx-left)*scale, (cy-top)*scale)
+		dst.DrawImage(c.drawn.img, op)
+	}
+	if stale {
+		// Redraw on the next pass to catch up.
+		autoMap.changed = true
+	}
+	evictMapChunks()
+
+	for _, wp := range seg.Waypoints {
+		x, y := float32((float64(wp.X)-left)*scale), float32((float64(wp.Y)-top)*scale)
+		vector.DrawFilledCircle(dst, x, y, 4, mapWaypointColor, true)
+		vector.StrokeCircle(dst, x, y, 4, 1, color.Black, true)
+		op := &text.DrawOptions{}
+		op.GeoM.Translate(float64(x)+6, float64(y)-8)
+		op.ColorScale.ScaleWithColor(mapWaypointColor)
+		text.Draw(dst, wp.Name, mainFont, op)
+	}
+	if player == seg {
+		x, y := float32((float64(at.X)-left)*scale), float32((float64(at.Y)-top)*scale)
+		vector.DrawFilledCircle(dst, x, y, 5, mapPlayerColor, true)
+		vector.StrokeCircle(dst, x, y, 5, 1.5, color.White, true)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// testMapper returns a mapper that treats every still picture as ground and
+// every picture as 32x32.
+func testMapper() *autoMapper {
+	m := newAutoMapper()
+	m.size = func(uint16) (int, int) { return 32, 32 }
+	m.isGround = func(p framePicture) bool { return !p.Moving }
+	return m
+}
+
+// testWorld lays out a 10x10 grid of distinct pictures 40 pixels apart,
+// numbered from base.
+func testWorld(base uint16) []mapPict {
+	var world []mapPict
+	for j := int32(0); j < 10; j++ {
+		for i := int32(0); i < 10; i++ {
+			world = append(world, mapPict{ID: base + uint16(j*10+i), X: i * 40, Y: j * 40})
+		}
+	}
+	return world
+}
+
+// testView returns the pictures of world within 200 pixels of cam, as the
+// server would send them.
+func testView(world []mapPict, cam mapPoint) []framePicture {
+	var pics []framePicture
+	for _, p := range world {
+		h, v := p.X-cam.X, p.Y-cam.Y
+		if h > -200 && h < 200 && v > -200 && v < 200 {
+			pics = append(pics, framePicture{PictID: p.ID, H: int16(h), V: int16(v)})
+		}
+	}
+	return pics
+}
+
+func TestAutoMapFollowsShift(t *testing.T) {
+	m := testMapper()
+	world := testWorld(100)
+	m.observe(testView(world, mapPoint{100, 100}), 0, 0, false)
+	seg, at := m.position()
+	if seg == nil || len(m.segments) != 1 {
+		t.Fatalf("first frame did not start a segment")
+	}
+	if at != (mapPoint{}) {
+		t.Fatalf("start position %v, want origin", at)
+	}
+	// Walking right by 40 moves the pictures left by 40.
+	m.observe(testView(world, mapPoint{140, 100}), -40, 0, true)
+	if _, at = m.position(); at != (mapPoint{40, 0}) {
+		t.Fatalf("position after shift %v, want {40 0}", at)
+	}
+	if _, ok := seg.pics[mapPict{ID: 100 + 8, X: 320 - 100, Y: 0 - 100}]; !ok {
+		t.Errorf("picture revealed by the shift not placed in world coordinates")
+	}
+	// A moving picture is never mapped.
+	m.observe([]framePicture{{PictID: 7, Moving: true}}, 0, 0, true)
+	if _, ok := seg.byID[7]; ok {
+		t.Errorf("moving picture was mapped")
+	}
+}
+
+func TestAutoMapRelocates(t *testing.T) {
+	m := testMapper()
+	world := testWorld(100)
+	m.observe(testView(world, mapPoint{100, 100}), 0, 0, false)
+	m.observe(testView(world, mapPoint{200, 200}), -100, -100, true)
+
+	// Too few pictures to locate: the mapper admits it is lost.
+	m.observe(testView(world, mapPoint{100, 100})[:3], 0, 0, false)
+	if seg, _ := m.position(); seg != nil {
+		t.Fatalf("position known after an unlocatable frame")
+	}
+	// Coming back to a known place after a failed shift finds it again.
+	m.observe(testView(world, mapPoint{180, 140}), 0, 0, false)
+	seg, at := m.position()
+	if seg != m.segments[0] || len(m.segments) != 1 {
+		t.Fatalf("relocation started a new segment")
+	}
+	if at != (mapPoint{80, 40}) {
+		t.Fatalf("relocated to %v, want {80 40}", at)
+	}
+}
+
+func TestAutoMapMergesFreshSegment(t *testing.T) {
+	m := testMapper()
+	a, b := testWorld(100), testWorld(1000)
+	m.observe(testView(a, mapPoint{100, 100}), 0, 0, false)
+	if err := m.addWaypoint("start"); err != nil {
+		t.Fatal(err)
+	}
+	// An unknown place starts a second segment.
+	m.observe(testView(b, mapPoint{100, 100}), 0, 0, false)
+	if len(m.segments) != 2 {
+		t.Fatalf("got %d segments, want 2", len(m.segments))
+	}
+	if err := m.addWaypoint("gate"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 9; i++ {
+		m.observe(testView(b, mapPoint{100, 100}), 0, 0, true)
+	}
+	// It turns out to be next to the first one.
+	m.observe(testView(a, mapPoint{300, 300}), 0, 0, true)
+	if len(m.segments) != 1 {
+		t.Fatalf("got %d segments after overlap, want 1", len(m.segments))
+	}
+	seg, at := m.position()
+	if seg.ID != 1 || at != (mapPoint{200, 200}) {
+		t.Fatalf("after merge at %v in area %d, want {200 200} in 1", at, seg.ID)
+	}
+	if _, ok := seg.pics[mapPict{ID: 1000, X: 100, Y: 100}]; !ok {
+		t.Errorf("pictures of the merged segment not moved")
+	}
+	wps := m.waypoints(seg)
+	if len(wps) != 2 || wps[1] != (mapWaypoint{Name: "gate", X: 200, Y: 200}) {
+		t.Errorf("waypoints after merge %+v", wps)
+	}
+}
+
+func TestAutoMapSaveLoad(t *testing.T) {
+	m := testMapper()
+	world := testWorld(100)
+	m.observe(testView(world, mapPoint{100, 100}), 0, 0, false)
+	m.observe(testView(world, mapPoint{200, 200}), -100, -100, true)
+	m.addWaypoint("well")
+	m.rename(m.segments[0], "Town")
+	// Too small to keep.
+	m.observe(testView(testWorld(1000), mapPoint{0, 0})[:9], 0, 0, false)
+
+	path := filepath.Join(t.TempDir(), autoMapFile)
+	if err := m.save(path); err != nil {
+		t.Fatal(err)
+	}
+	n := testMapper()
+	if err := n.load(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(n.segments) != 1 {
+		t.Fatalf("loaded %d segments, want 1", len(n.segments))
+	}
+	got, want := n.segments[0], m.segments[0]
+	if got.Name != "Town" || len(got.pics) != len(want.pics) || got.min != want.min || got.max != want.max {
+		t.Errorf("loaded %q with %d pictures %v-%v, want %q with %d %v-%v",
+			got.Name, len(got.pics), got.min, got.max, want.Name, len(want.pics), want.min, want.max)
+	}
+	if len(got.Waypoints) != 1 || got.Waypoints[0].Name != "well" {
+		t.Errorf("waypoints %+v", got.Waypoints)
+	}
+	if n.nextID != 3 {
+		t.Errorf("next ID %d, want 3", n.nextID)
+	}
+	if seg, _ := n.position(); seg != nil {
+		t.Errorf("position known right after loading")
+	}
+	n.observe(testView(world, mapPoint{100, 100}), 0, 0, false)
+	if seg, at := n.position(); seg != got || at != (mapPoint{}) {
+		t.Errorf("not located in the loaded map: %v", at)
+	}
+}
+
+func TestAutoMapRelayout(t *testing.T) {
+	m := testMapper()
+	world := testWorld(100)
+	m.observe(testView(world, mapPoint{100, 100}), 0, 0, false)
+	path := filepath.Join(t.TempDir(), autoMapFile)
+	if err := m.save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Loaded before CL_Images: every picture is a point.
+	n := testMapper()
+	n.size = func(uint16) (int, int) { return 0, 0 }
+	if err := n.load(path); err != nil {
+		t.Fatal(err)
+	}
+	n.size = m.size
+	n.relayout()
+
+	got, want := n.segments[0], m.segments[0]
+	if got.min != want.min || got.max != want.max {
+		t.Errorf("bounds %v-%v, want %v-%v", got.min, got.max, want.min, want.max)
+	}
+	if len(got.chunks) != len(want.chunks) {
+		t.Fatalf("%d chunks, want %d", len(got.chunks), len(want.chunks))
+	}
+	for k, c := range want.chunks {
+		if g := got.chunks[k]; g == nil || len(g.pics) != len(c.pics) || !g.dirty {
+			t.Errorf("chunk %v: got %+v, want %d pictures", k, g, len(c.pics))
+		}
+	}
+	if !n.takeChanged() {
+		t.Errorf("relayout did not mark the map changed")
+	}
+}
+
+func TestMapBearing(t *testing.T) {
+	tests := []struct {
+		dx, dy int32
+		want   string
+	}{
+		{0, 0, ""},
+		{0, -10, "N"},
+		{10, -10, "NE"},
+		{10, 0, "E"},
+		{10, 3, "E"},
+		{10, 10, "SE"},
+		{0, 10, "S"},
+		{-10, 10, "SW"},
+		{-10, 0, "W"},
+		{-10, -10, "NW"},
+	}
+	for _, tt := range tests {
+		if got := mapBearing(tt.dx, tt.dy); got != tt.want {
+			t.Errorf("mapBearing(%d, %d) = %q, want %q", tt.dx, tt.dy, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"gothoom/eui"
+
+	ebiten "github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	minimapSize        = 200
+	mapRedrawInterval  = 200 * time.Millisecond
+	worldMapSidebarW   = 230
+	mapMinZoom         = 1.0 / 16
+	mapMaxZoom         = 1.0 / 2
+	minimapDefaultZoom = 1.0 / 8
+)
+
+var (
+	minimapWin   *eui.WindowData
+	minimapItem  *eui.ItemData
+	minimapImg   *ebiten.Image
+	minimapLabel *eui.ItemData
+	minimapZoom  = minimapDefaultZoom
+
+	worldMapWin      *eui.WindowData
+	worldMapItem     *eui.ItemData
+	worldMapImg      *ebiten.Image
+	worldMapSidebar  *eui.ItemData
+	worldMapSeg      *mapSegment
+	worldMapCenter   [2]float64
+	worldMapZoom     = 1.0 / 8
+	worldMapFollow   = true
+	worldMapDirty    bool
+	worldMapAreaName string
+	worldMapWPName   string
+	worldMapListSig  string
+
+	lastMapRedraw time.Time
+)
+
+func init() {
+	pluginRegisterCommand("client", "waypoint", handleWaypointCommand)
+}
+
+// handleWaypointCommand marks the player's position on the map.
+func handleWaypointCommand(args string) {
+	name := strings.TrimSpace(args)
+	if name == "" {
+		name = time.Now().Format("Waypoint 15:04")
+	}
+	if err := autoMap.addWaypoint(name); err != nil {
+		consoleMessage("/waypoint: " + err.Error())
+		return
+	}
+	consoleMessage("Waypoint added: " + name)
+	worldMapDirty = true
+}
+
+// mapBearing gives the compass direction of a point dx, dy world pixels
+// away; y grows southward.
+func mapBearing(dx, dy int32) string {
+	if dx == 0 && dy == 0 {
+		return ""
+	}
+	dirs := [...]string{"E", "SE", "S", "SW", "W", "NW", "N", "NE"}
+	a := math.Atan2(float64(dy), float64(dx))
+	i := int(math.Round(a/(math.Pi/4))+8) % 8
+	return dirs[i]
+}
+
+// waypointLabel describes wp as seen from the player, if they are in the
+// same area.
+func waypointLabel(wp mapWaypoint, from mapPoint, here bool) string {
+	if !here {
+		return wp.Name
+	}
+	dx, dy := wp.X-from.X, wp.Y-from.Y
+	dist := int(math.Round(math.Hypot(float64(dx), float64(dy))))
+	if dist < 8 {
+		return wp.Name + " (here)"
+	}
+	return fmt.Sprintf("%s (%d %s)", wp.Name, dist, mapBearing(dx, dy))
+}
+
+func makeMinimapWindow() {
+	if minimapWin != nil {
+		return
+	}
+	minimapWin = eui.NewWindow()
+	minimapWin.Title = "Minimap"
+	minimapWin.Closable = true
+	minimapWin.Movable = true
+	minimapWin.Resizable = false
+	minimapWin.AutoSize = true
+	minimapWin.NoScroll = true
+	minimapWin.SetZone(eui.HZoneRight, eui.VZoneTop)
+
+	flow := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL}
+	minimapItem, minimapImg = eui.NewImageFastItem(minimapSize, minimapSize)
+	flow.AddItem(minimapItem)
+
+	row := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
+	minimapLabel, _ = eui.NewText()
+	minimapLabel.FontSize = 11
+	minimapLabel.Size = eui.Point{X: minimapSize - 56, Y: 24}
+	row.AddItem(minimapLabel)
+	zoomBtn := func(label string, factor float64) {
+		btn, events := eui.NewButton()
+		btn.Text = label
+		btn.Size = eui.Point{X: 24, Y: 24}
+		events.Handle = func(ev eui.UIEvent) {
+			if ev.Type == eui.EventClick {
+				minimapZoom = clampMapZoom(minimapZoom * factor)
+				lastMapRedraw = time.Time{}
+			}
+		}
+		row.AddItem(btn)
+	}
+	zoomBtn("-", 0.5)
+	zoomBtn("+", 2)
+	flow.AddItem(row)
+
+	minimapWin.AddItem(flow)
+	minimapWin.AddWindow(false)
+}
+
+func makeWorldMapWindow() {
+	if worldMapWin != nil {
+		return
+	}
+	worldMapWin = eui.NewWindow()
+	worldMapWin.Title = "World Map"
+	worldMapWin.Closable = true
+	worldMapWin.Movable = true
+	worldMapWin.Resizable = true
+	worldMapWin.NoScroll = true
+	worldMapWin.Size = eui.Point{X: 900, Y: 640}
+	worldMapWin.SetZone(eui.HZoneCenter, eui.VZoneMiddleTop)
+
+	row := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL, Fixed: true}
+	worldMapSidebar = &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL, Scrollable: true, Fixed: true}
+	worldMapSidebar.Size = eui.Point{X: worldMapSidebarW, Y: worldMapWin.Size.Y}
+	row.AddItem(worldMapSidebar)
+	worldMapItem, worldMapImg = eui.NewImageFastItem(1, 1)
+	row.AddItem(worldMapItem)
+	worldMapWin.AddItem(row)
+
+	worldMapWin.OnResize = func() {
+		resizeWorldMap()
+		worldMapWin.Refresh()
+	}
+	worldMapWin.AddWindow(false)
+	resizeWorldMap()
+	rebuildWorldMapSidebar()
+}
+
+// openFullMap opens the world map over most of the screen.
+func openFullMap() {
+	if worldMapWin == nil {
+		return
+	}
+	if w, h := eui.ScreenSize(); w > 0 && h > 0 {
+		worldMapWin.SetSize(eui.Point{X: float32(w) * 0.9, Y: float32(h) * 0.9})
+	}
+	worldMapFollow = true
+	worldMapWin.MarkOpen()
+	resizeWorldMap()
+	worldMapDirty = true
+}
+
+// resizeWorldMap fits the map image to the window beside the sidebar.
+func resizeWorldMap() {
+	if worldMapWin == nil {
+		return
+	}
+	s := eui.UIScale()
+	size := worldMapWin.GetSize()
+	pad := float32(2*worldMapWin.Padding) * s
+	w := int(size.X - pad - worldMapSidebarW*s - 8)
+	h := int(size.Y - pad - worldMapWin.GetTitleSize() - 8)
+	if w < 16 || h < 16 {
+		return
+	}
+	worldMapSidebar.Size.Y = float32(h) / s
+	if b := worldMapImg.Bounds(); b.Dx() != w || b.Dy() != h {
+		worldMapImg = ebiten.NewImage(w, h)
+		worldMapItem.Image = worldMapImg
+		worldMapItem.Size = eui.Point{X: float32(w) / s, Y: float32(h) / s}
+	}
+	worldMapDirty = true
+}
+
+func clampMapZoom(z float64) float64 {
+	return math.Max(mapMinZoom, math.Min(mapMaxZoom, z))
+}
+
+// rebuildWorldMapSidebar lists the areas, view controls and waypoints.
+func rebuildWorldMapSidebar() {
+	if worldMapSidebar == nil {
+		return
+	}
+	segs := autoMap.list()
+	player, at := autoMap.position()
+	if worldMapSeg == nil || worldMapFollow {
+		worldMapSeg = player
+	}
+	found := false
+	for _, s := range segs {
+		found = found || s == worldMapSeg
+	}
+	if !found {
+		worldMapSeg = player
+		if worldMapSeg == nil && len(segs) > 0 {
+			worldMapSeg = segs[0]
+		}
+	}
+
+	sb := worldMapSidebar
+	sb.Contents = sb.Contents[:0]
+	width := float32(worldMapSidebarW - 12)
+	button := func(label string, w float32, fn func()) *eui.ItemData {
+		btn, events := eui.NewButton()
+		btn.Text = label
+		btn.Size = eui.Point{X: w, Y: 24}
+		events.Handle = func(ev eui.UIEvent) {
+			if ev.Type == eui.EventClick {
+				fn()
+				worldMapDirty = true
+			}
+		}
+		return btn
+	}
+
+	if len(segs) == 0 {
+		txt, _ := eui.NewText()
+		txt.Text = "Nothing mapped yet. Walk around while logged in and the areas you see are added."
+		txt.FontSize = 11
+		txt.Size = eui.Point{X: width, Y: 64}
+		sb.AddItem(txt)
+		worldMapWin.Refresh()
+		return
+	}
+
+	dd, ddEvents := eui.NewDropdown()
+	dd.Label = "Area"
+	dd.Size = eui.Point{X: width, Y: 24}
+	for i, s := range segs {
+		name := autoMap.name(s)
+		if s == player {
+			name += " (you)"
+		}
+		dd.Options = append(dd.Options, name)
+		if s == worldMapSeg {
+			dd.Selected = i
+		}
+	}
+	ddEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventDropdownSelected && ev.Index < len(segs) {
+			showMapSegment(segs[ev.Index])
+		}
+	}
+	sb.AddItem(dd)
+
+	worldMapAreaName = autoMap.name(worldMapSeg)
+	nameIn, _ := eui.NewInput()
+	nameIn.Label = "Name"
+	nameIn.TextPtr = &worldMapAreaName
+	nameIn.Size = eui.Point{X: width, Y: 24}
+	nameIn.Action = func() {
+		if n := strings.TrimSpace(worldMapAreaName); n != "" && worldMapSeg != nil {
+			autoMap.rename(worldMapSeg, n)
+			rebuildWorldMapSidebar()
+		}
+	}
+	sb.AddItem(nameIn)
+
+	view := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
+	pan := func(fx, fy float64) func() {
+		return func() {
+			if worldMapImg == nil {
+				return
+			}
+			b := worldMapImg.Bounds()
+			worldMapFollow = false
+			worldMapCenter[0] += fx * float64(b.Dx()) / worldMapZoom
+			worldMapCenter[1] += fy * float64(b.Dy()) / worldMapZoom
+		}
+	}
+	view.AddItem(button("<", 26, pan(-0.25, 0)))
+	view.AddItem(button("^", 26, pan(0, -0.25)))
+	view.AddItem(button("v", 26, pan(0, 0.25)))
+	view.AddItem(button(">", 26, pan(0.25, 0)))
+	view.AddItem(button("-", 26, func() { worldMapZoom = clampMapZoom(worldMapZoom / 2) }))
+	view.AddItem(button("+", 26, func() { worldMapZoom = clampMapZoom(worldMapZoom * 2) }))
+	sb.AddItem(view)
+	view2 := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
+	view2.AddItem(button("Follow Me", width/2, func() {
+		worldMapFollow = true
+		rebuildWorldMapSidebar()
+	}))
+	view2.AddItem(button("Whole Area", width/2, func() { fitMapSegment(worldMapSeg) }))
+	sb.AddItem(view2)
+
+	wpIn, _ := eui.NewInput()
+	wpIn.Label = "Waypoint"
+	wpIn.TextPtr = &worldMapWPName
+	wpIn.Size = eui.Point{X: width, Y: 24}
+	sb.AddItem(wpIn)
+	sb.AddItem(button("Mark My Position", width, func() {
+		handleWaypointCommand(worldMapWPName)
+		worldMapWPName = ""
+		rebuildWorldMapSidebar()
+	}))
+
+	if worldMapSeg != nil {
+		for i, wp := range autoMap.waypoints(worldMapSeg) {
+			wpRow := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
+			label, _ := eui.NewText()
+			label.Text = waypointLabel(wp, at, player == worldMapSeg)
+			label.FontSize = 11
+			label.Size = eui.Point{X: width - 56, Y: 24}
+			wpRow.AddItem(label)
+			seg, idx, x, y := worldMapSeg, i, float64(wp.X), float64(wp.Y)
+			wpRow.AddItem(button("@", 24, func() {
+				worldMapFollow = false
+				worldMapCenter = [2]float64{x, y}
+			}))
+			wpRow.AddItem(button("x", 24, func() {
+				autoMap.removeWaypoint(seg, idx)
+				rebuildWorldMapSidebar()
+			}))
+			sb.AddItem(wpRow)
+		}
+	}
+	worldMapListSig = worldMapSignature()
+	worldMapWin.Refresh()
+}
+
+// worldMapSignature summarises what the sidebar shows so it is only
+// rebuilt when that changes.
+func worldMapSignature() string {
+	var b strings.Builder
+	player, at := autoMap.position()
+	for _, s := range autoMap.list() {
+		fmt.Fprintf(&b, "%d:%s:%d;", s.ID, autoMap.name(s), len(autoMap.waypoints(s)))
+	}
+	if player != nil {
+		// Waypoint distances follow the player, coarsely.
+		fmt.Fprintf(&b, "@%d:%d,%d", player.ID, at.X/32, at.Y/32)
+	}
+	return b.String()
+}
+
+// showMapSegment shows seg in the world map without following the player.
+func showMapSegment(seg *mapSegment) {
+	player, _ := autoMap.position()
+	worldMapSeg = seg
+	worldMapFollow = seg == player
+	if !worldMapFollow {
+		fitMapSegment(seg)
+	}
+	rebuildWorldMapSidebar()
+}
+
+// fitMapSegment zooms the world map to show all of seg.
+func fitMapSegment(seg *mapSegment) {
+	if seg == nil || worldMapImg == nil {
+		return
+	}
+	lo, hi := autoMap.bounds(seg)
+	worldMapFollow = false
+	worldMapCenter = [2]float64{float64(lo.X+hi.X) / 2, float64(lo.Y+hi.Y) / 2}
+	b := worldMapImg.Bounds()
+	zx := float64(b.Dx()) / math.Max(1, float64(hi.X-lo.X))
+	zy := float64(b.Dy()) / math.Max(1, float64(hi.Y-lo.Y))
+	zoom := mapMaxZoom
+	for zoom > mapMinZoom && zoom > math.Min(zx, zy) {
+		zoom /= 2
+	}
+	worldMapZoom = zoom
+}
+
+// updateAutoMapWindows redraws the open map windows a few times a second.
+func updateAutoMapWindows() {
+	minimapOpen := minimapWin != nil && minimapWin.IsOpen()
+	worldOpen := worldMapWin != nil && worldMapWin.IsOpen()
+	if !minimapOpen && !worldOpen {
+		return
+	}
+	if !worldMapDirty && time.Since(lastMapRedraw) < mapRedrawInterval {
+		return
+	}
+	lastMapRedraw = time.Now()
+	autoMap.takeChanged()
+	seg, at := autoMap.position()
+
+	if minimapOpen {
+		drawAutoMap(minimapImg, seg, float64(at.X), float64(at.Y), minimapZoom)
+		txt := "Position unknown"
+		if seg != nil {
+			txt = autoMap.name(seg)
+		}
+		if minimapLabel.Text != txt {
+			minimapLabel.Text = txt
+			minimapLabel.Dirty = true
+		}
+		minimapItem.Dirty = true
+		minimapWin.Dirty = true
+	}
+	if worldOpen {
+		if worldMapSignature() != worldMapListSig {
+			rebuildWorldMapSidebar()
+		}
+		if worldMapFollow && seg != nil {
+			worldMapSeg = seg
+			worldMapCenter = [2]float64{float64(at.X), float64(at.Y)}
+		}
+		drawAutoMap(worldMapImg, worldMapSeg, worldMapCenter[0], worldMapCenter[1], worldMapZoom)
+		worldMapItem.Dirty = true
+		worldMapWin.Dirty = true
+	}
+	worldMapDirty = false
+}
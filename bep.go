@@ -8,7 +8,7 @@ import (
 )
 
 // parseBackend handles back-end BEP commands following the "be" prefix.
-func parseBackend(data []byte) {
+func (s *session) parseBackend(data []byte) {
 	// Expect a BEPP tag for the backend subcommand (e.g., -wh, -in, -sh)
 	// immediately following the initial -be.
 	if len(data) < 3 || data[0] != 0xC2 {
@@ -18,16 +18,16 @@ func parseBackend(data []byte) {
 	payload := data[3:]
 	switch cmd {
 	case "in":
-		parseBackendInfo(payload)
+		s.parseBackendInfo(payload)
 	case "sh":
-		parseBackendShare(payload)
+		s.parseBackendShare(payload)
 	case "wh":
-		parseBackendWho(payload)
+		s.parseBackendWho(payload)
 	}
 }
 
 // parseBackendInfo parses "be-in" messages containing player info.
-func parseBackendInfo(data []byte) {
+func (s *session) parseBackendInfo(data []byte) {
 	if len(data) < 3 || data[0] != 0xC2 || data[1] != 'p' || data[2] != 'n' {
 		return
 	}
@@ -57,11 +57,11 @@ func parseBackendInfo(data []byte) {
 	if len(fields) > 3 {
 		clan = strings.TrimSpace(decodeMacRoman(fields[3]))
 	}
-	playersMu.Lock()
-	p, ok := players[name]
+	s.playersMu.Lock()
+	p, ok := s.players[name]
 	if !ok {
 		p = &Player{Name: name}
-		players[name] = p
+		s.players[name] = p
 	}
 	p.Race = race
 	p.Gender = gender
@@ -72,17 +72,17 @@ func parseBackendInfo(data []byte) {
 	bwChanged := !p.BeWho
 	p.BeWho = true
 	changedNames := make([]string, 0, 1)
-	if playerName != "" {
-		if name == playerName {
+	if s.playerName != "" {
+		if name == s.playerName {
 			myClan := clan
-			for _, pl := range players {
+			for _, pl := range s.players {
 				sc := myClan != "" && pl.Clan != "" && strings.EqualFold(pl.Clan, myClan)
 				if pl.SameClan != sc {
 					pl.SameClan = sc
 					changedNames = append(changedNames, pl.Name)
 				}
 			}
-		} else if me, ok := players[playerName]; ok {
+		} else if me, ok := s.players[s.playerName]; ok {
 			sc := me.Clan != "" && p.Clan != "" && strings.EqualFold(p.Clan, me.Clan)
 			if p.SameClan != sc {
 				p.SameClan = sc
@@ -91,18 +91,18 @@ func parseBackendInfo(data []byte) {
 		}
 	}
 	playerCopy := *p
-	playersMu.Unlock()
+	s.playersMu.Unlock()
 	playersDirty = true
 	playersPersistDirty = true
-	notifyPlayerHandlers(playerCopy)
+	s.notifyPlayerHandlers(playerCopy)
 	for _, nm := range changedNames {
-		killNameTagCacheFor(nm)
+		s.killNameTagCacheFor(nm)
 	}
 	if bwChanged {
 		playersPersistDirty = true
 	}
 
-	if playerName != "" && strings.EqualFold(name, playerName) {
+	if s.playerName != "" && strings.EqualFold(name, s.playerName) {
 		for i := range characters {
 			if strings.EqualFold(characters[i].Name, name) {
 				if characters[i].Profession != class {
@@ -116,20 +116,21 @@ func parseBackendInfo(data []byte) {
 }
 
 // parseBackendShare parses "be-sh" messages describing sharing relationships.
-func parseBackendShare(data []byte) {
-	playersMu.Lock()
-	cleared := make([]Player, 0, len(players))
-	for _, p := range players {
+func (s *session) parseBackendShare(data []byte) {
+	defer s.emitShareChanges(s.shareSnapshot())
+	s.playersMu.Lock()
+	cleared := make([]Player, 0, len(s.players))
+	for _, p := range s.players {
 		if p.Sharee || p.Sharing {
 			p.Sharee = false
 			p.Sharing = false
 			cleared = append(cleared, *p)
 		}
 	}
-	playersMu.Unlock()
+	s.playersMu.Unlock()
 	for _, pl := range cleared {
-		killNameTagCacheFor(pl.Name)
-		notifyPlayerHandlers(pl)
+		s.killNameTagCacheFor(pl.Name)
+		s.notifyPlayerHandlers(pl)
 	}
 	parts := bytes.SplitN(data, []byte{'\t'}, 2)
 	shareePart := parts[0]
@@ -138,15 +139,15 @@ func parseBackendShare(data []byte) {
 		sharerPart = parts[1]
 	}
 	for _, name := range parseNames(shareePart) {
-		playersMu.Lock()
-		p, ok := players[name]
+		s.playersMu.Lock()
+		p, ok := s.players[name]
 		if !ok {
 			p = &Player{Name: name}
-			players[name] = p
+			s.players[name] = p
 		}
 		changed := !p.Sharee
 		bwChanged := !p.BeWho
-		if me, ok := players[playerName]; ok {
+		if me, ok := s.players[s.playerName]; ok {
 			sc := me.Clan != "" && p.Clan != "" && strings.EqualFold(p.Clan, me.Clan)
 			if p.SameClan != sc {
 				p.SameClan = sc
@@ -157,25 +158,25 @@ func parseBackendShare(data []byte) {
 		p.Sharee = true
 		p.LastSeen = time.Now()
 		playerCopy := *p
-		playersMu.Unlock()
+		s.playersMu.Unlock()
 		if changed {
-			killNameTagCacheFor(name)
+			s.killNameTagCacheFor(name)
 		}
 		if bwChanged {
 			playersPersistDirty = true
 		}
-		notifyPlayerHandlers(playerCopy)
+		s.notifyPlayerHandlers(playerCopy)
 	}
 	for _, name := range parseNames(sharerPart) {
-		playersMu.Lock()
-		p, ok := players[name]
+		s.playersMu.Lock()
+		p, ok := s.players[name]
 		if !ok {
 			p = &Player{Name: name}
-			players[name] = p
+			s.players[name] = p
 		}
 		changed := !p.Sharing
 		bwChanged := !p.BeWho
-		if me, ok := players[playerName]; ok {
+		if me, ok := s.players[s.playerName]; ok {
 			sc := me.Clan != "" && p.Clan != "" && strings.EqualFold(p.Clan, me.Clan)
 			if p.SameClan != sc {
 				p.SameClan = sc
@@ -186,22 +187,23 @@ func parseBackendShare(data []byte) {
 		p.Sharing = true
 		p.LastSeen = time.Now()
 		playerCopy := *p
-		playersMu.Unlock()
+		s.playersMu.Unlock()
 		if changed {
-			killNameTagCacheFor(name)
+			s.killNameTagCacheFor(name)
 		}
 		if bwChanged {
 			playersPersistDirty = true
 		}
-		notifyPlayerHandlers(playerCopy)
+		s.notifyPlayerHandlers(playerCopy)
 	}
 	playersDirty = true
 }
 
 // parseBackendWho parses "be-wh" messages listing players.
-func parseBackendWho(data []byte) {
+func (s *session) parseBackendWho(data []byte) {
 	batchCount := 0
 	newCount := 0
+	var names []string
 	for len(data) > 0 {
 		if len(data) < 3 || data[0] != 0xC2 || data[1] != 'p' || data[2] != 'n' {
 			break
@@ -232,11 +234,11 @@ func parseBackendWho(data []byte) {
 		data = seg[tab+1:]
 
 		// Update player record and enqueue info request if needed.
-		playersMu.Lock()
-		p, ok := players[name]
+		s.playersMu.Lock()
+		p, ok := s.players[name]
 		if !ok {
 			p = &Player{Name: name}
-			players[name] = p
+			s.players[name] = p
 			newCount++
 		}
 		if gm >= 0 {
@@ -246,7 +248,7 @@ func parseBackendWho(data []byte) {
 		p.Offline = false
 		bwChanged := !p.BeWho
 		scChanged := false
-		if me, ok := players[playerName]; ok {
+		if me, ok := s.players[s.playerName]; ok {
 			sc := me.Clan != "" && p.Clan != "" && strings.EqualFold(p.Clan, me.Clan)
 			if p.SameClan != sc {
 				p.SameClan = sc
@@ -255,25 +257,27 @@ func parseBackendWho(data []byte) {
 		}
 		p.BeWho = true
 		playerCopy := *p
-		playersMu.Unlock()
-		notifyPlayerHandlers(playerCopy)
+		s.playersMu.Unlock()
+		s.notifyPlayerHandlers(playerCopy)
 		if scChanged {
-			killNameTagCacheFor(name)
+			s.killNameTagCacheFor(name)
 		}
 		if bwChanged {
 			playersPersistDirty = true
 		}
-		queueInfoRequest(name)
+		s.queueInfoRequest(name)
+		names = append(names, name)
 		batchCount++
 	}
 	if batchCount > 0 {
 		playersDirty = true
+		s.emitWhoEvent(names)
 	}
 	if newCount > 0 {
 		playersPersistDirty = true
 	}
 	// Consider requesting another who batch if this looks like a partial page
-	considerNextWhoBatch(batchCount, newCount)
+	s.considerNextWhoBatch(batchCount, newCount)
 }
 
 // parseNames extracts a slice of names from a sequence of "-pn name -pn" entries.
@@ -13,24 +13,15 @@ func handleBlockCommand(args string) {
 	if name == "" {
 		return
 	}
-	p := getPlayer(name)
-	playersMu.Lock()
-	wasBlocked := p.GlobalLabel == 6
+	wasBlocked := globalLabel(name) == 6
 	if wasBlocked {
-		p.GlobalLabel = 0
+		setGlobalLabel(name, 0, false)
 	} else {
-		p.GlobalLabel = 6
+		setGlobalLabel(name, 6, false)
 	}
-	applyPlayerLabel(p)
-	playerCopy := *p
-	playersMu.Unlock()
-	playersDirty = true
-	playersPersistDirty = true
-	killNameTagCacheFor(p.Name)
-	notifyPlayerHandlers(playerCopy)
-	msg := "Blocking " + p.Name + "."
+	msg := "Blocking " + name + "."
 	if wasBlocked {
-		msg = "No longer blocking " + p.Name + "."
+		msg = "No longer blocking " + name + "."
 	}
 	consoleMessage(msg)
 }
@@ -40,24 +31,15 @@ func handleIgnoreCommand(args string) {
 	if name == "" {
 		return
 	}
-	p := getPlayer(name)
-	playersMu.Lock()
-	wasIgnored := p.GlobalLabel == 7
+	wasIgnored := globalLabel(name) == 7
 	if wasIgnored {
-		p.GlobalLabel = 0
+		setGlobalLabel(name, 0, false)
 	} else {
-		p.GlobalLabel = 7
+		setGlobalLabel(name, 7, false)
 	}
-	applyPlayerLabel(p)
-	playerCopy := *p
-	playersMu.Unlock()
-	playersDirty = true
-	playersPersistDirty = true
-	killNameTagCacheFor(p.Name)
-	notifyPlayerHandlers(playerCopy)
-	msg := "Ignoring " + p.Name + "."
+	msg := "Ignoring " + name + "."
 	if wasIgnored {
-		msg = "No longer ignoring " + p.Name + "."
+		msg = "No longer ignoring " + name + "."
 	}
 	consoleMessage(msg)
 }
@@ -67,28 +49,19 @@ func handleForgetCommand(args string) {
 	if name == "" {
 		return
 	}
-	p := getPlayer(name)
-	playersMu.Lock()
-	wasBlocked := p.GlobalLabel == 6
-	wasIgnored := p.GlobalLabel == 7
-	wasFriend := p.GlobalLabel > 0 && p.GlobalLabel < 6
-	p.GlobalLabel = 0
-	p.LocalLabel = 0
-	applyPlayerLabel(p)
-	playerCopy := *p
-	playersMu.Unlock()
-	playersDirty = true
-	playersPersistDirty = true
-	killNameTagCacheFor(p.Name)
-	notifyPlayerHandlers(playerCopy)
-	msg := "Forgot " + p.Name + "."
+	label := globalLabel(name)
+	wasBlocked := label == 6
+	wasIgnored := label == 7
+	wasFriend := label > 0 && label < 6
+	setGlobalLabel(name, 0, true)
+	msg := "Forgot " + name + "."
 	switch {
 	case wasIgnored:
-		msg = "No longer ignoring " + p.Name + "."
+		msg = "No longer ignoring " + name + "."
 	case wasBlocked:
-		msg = "No longer blocking " + p.Name + "."
+		msg = "No longer blocking " + name + "."
 	case wasFriend:
-		msg = "Removing label from " + p.Name + "."
+		msg = "Removing label from " + name + "."
 	}
 	consoleMessage(msg)
 }
@@ -3,10 +3,10 @@ package main
 import "testing"
 
 func TestHandleBlockCommandToggle(t *testing.T) {
-	players = make(map[string]*Player)
-	consoleLog = messageLog{max: maxMessages}
+	mainSession.players = make(map[string]*Player)
+	mainSession.console = messageLog{max: maxMessages}
 	handleBlockCommand("Bob")
-	p := getPlayer("Bob")
+	p := mainSession.getPlayer("Bob")
 	if !p.Blocked || p.Ignored || p.Friend || p.FriendLabel != 6 {
 		t.Fatalf("expected Bob to be blocked only with label 6")
 	}
@@ -25,10 +25,10 @@ func TestHandleBlockCommandToggle(t *testing.T) {
 }
 
 func TestHandleIgnoreCommandToggle(t *testing.T) {
-	players = make(map[string]*Player)
-	consoleLog = messageLog{max: maxMessages}
+	mainSession.players = make(map[string]*Player)
+	mainSession.console = messageLog{max: maxMessages}
 	handleIgnoreCommand("Bob")
-	p := getPlayer("Bob")
+	p := mainSession.getPlayer("Bob")
 	if !p.Ignored || p.Blocked || p.Friend || p.FriendLabel != 7 {
 		t.Fatalf("expected Bob to be ignored only with label 7")
 	}
@@ -47,9 +47,9 @@ func TestHandleIgnoreCommandToggle(t *testing.T) {
 }
 
 func TestHandleForgetCommand(t *testing.T) {
-	players = make(map[string]*Player)
-	consoleLog = messageLog{max: maxMessages}
-	p := getPlayer("Bob")
+	mainSession.players = make(map[string]*Player)
+	mainSession.console = messageLog{max: maxMessages}
+	p := mainSession.getPlayer("Bob")
 	p.GlobalLabel = 1
 	applyPlayerLabel(p)
 	handleForgetCommand("Bob")
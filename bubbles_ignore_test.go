@@ -33,21 +33,21 @@ func buildDrawData(name string, bubbleType int, text string) []byte {
 }
 
 func resetTestState() {
-	resetDrawState()
-	players = make(map[string]*Player)
+	mainSession.resetDrawState()
+	mainSession.players = make(map[string]*Player)
 	thinkMessages = nil
 }
 
 func TestBubbleDroppedForBlockedPlayer(t *testing.T) {
 	resetTestState()
-	players["Bob"] = &Player{Name: "Bob", Blocked: true}
+	mainSession.players["Bob"] = &Player{Name: "Bob", Blocked: true}
 	data := buildDrawData("Bob", kBubbleNormal, "hello")
-	if err := parseDrawState(data, false); err != nil {
+	if err := mainSession.parseDrawState(data, false); err != nil {
 		t.Fatalf("parseDrawState: %v", err)
 	}
-	stateMu.Lock()
-	got := len(state.bubbles)
-	stateMu.Unlock()
+	mainSession.stateMu.Lock()
+	got := len(mainSession.state.bubbles)
+	mainSession.stateMu.Unlock()
 	if got != 0 {
 		t.Fatalf("expected no bubbles, got %d", got)
 	}
@@ -55,9 +55,9 @@ func TestBubbleDroppedForBlockedPlayer(t *testing.T) {
 
 func TestThinkMessageDroppedForIgnoredPlayer(t *testing.T) {
 	resetTestState()
-	players["Bob"] = &Player{Name: "Bob", Ignored: true}
+	mainSession.players["Bob"] = &Player{Name: "Bob", Ignored: true}
 	data := buildDrawData("Bob", kBubbleThought, "hmm")
-	if err := parseDrawState(data, false); err != nil {
+	if err := mainSession.parseDrawState(data, false); err != nil {
 		t.Fatalf("parseDrawState: %v", err)
 	}
 	if len(thinkMessages) != 0 {
@@ -15,6 +15,8 @@ func clearCaches() {
 	mobileCache = make(map[mobileKey]*ebiten.Image)
 	mobileBlendCache = make(map[mobileBlendKey]*ebiten.Image)
 	pictBlendCache = make(map[pictBlendKey]*ebiten.Image)
+	hdFrameCache = make(map[imageKey]*hdFrame)
+	hdIconCache = make(map[uint16]*ebiten.Image)
 	imageMu.Unlock()
 
 	pixelCountMu.Lock()
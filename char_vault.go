@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"gothoom/credvault"
+	"gothoom/eui"
+)
+
+// Saved passwords can be sealed in a vault under a master passphrase
+// instead of the scrambled Key. The vault header lives in characters.json;
+// it is unlocked at most once per session from the login window.
+var (
+	charVaultHeader *credvault.Header // nil when the vault is off
+	charVault       *credvault.Vault  // nil until unlocked
+	vaultRow        *eui.ItemData
+	vaultPass       string
+	vaultPassInput  *eui.ItemData
+	// vaultBusy is set while a passphrase is being checked or a vault
+	// created off the UI.
+	vaultBusy bool
+)
+
+// sealCharacter replaces c's stored key with its password hash sealed in
+// the vault. While the vault is locked the hash is sealed to its public
+// key. Entries whose password is not known this session, such as those
+// that failed to open, keep what was loaded.
+func sealCharacter(c *Character) error {
+	if c.passHash == "" {
+		return nil
+	}
+	var sealed string
+	var err error
+	if charVault != nil {
+		sealed, err = charVault.Encrypt([]byte(c.passHash), c.Name)
+	} else {
+		sealed, err = charVaultHeader.Seal([]byte(c.passHash), c.Name)
+	}
+	if err != nil {
+		return err
+	}
+	c.Key = ""
+	c.Sealed = sealed
+	return nil
+}
+
+// charactersLocked reports whether the vault is on but not yet unlocked this
+// session. This holds even when no entry is sealed yet.
+func charactersLocked() bool {
+	return charVaultHeader != nil && charVault == nil
+}
+
+// unlockCharacters opens the vault with passphrase and restores the sealed
+// passwords. Older scrambled keys, and passwords remembered while the vault
+// was locked, are sealed on the way.
+func unlockCharacters(passphrase string) error {
+	if charVaultHeader == nil {
+		return errors.New("saved passwords are not encrypted")
+	}
+	v, err := credvault.Unlock(*charVaultHeader, passphrase)
+	if err != nil {
+		return err
+	}
+	openCharacters(v)
+	return nil
+}
+
+// openCharacters makes v the session's vault. Unlock derives the key,
+// which takes a moment, so the login window calls credvault.Unlock off the
+// UI and hands the vault over here.
+func openCharacters(v *credvault.Vault) {
+	h := v.Header()
+	charVaultHeader, charVault = &h, v
+	for i := range characters {
+		c := &characters[i]
+		if c.Sealed == "" || c.passHash != "" {
+			continue
+		}
+		hash, err := v.Decrypt(c.Sealed, c.Name)
+		if err != nil {
+			log.Printf("unlock %s: %v", c.Name, err)
+			continue
+		}
+		c.passHash = string(hash)
+	}
+	saveCharacters()
+}
+
+// protectCharacters turns the vault on with a new master passphrase and
+// seals every saved password.
+func protectCharacters(passphrase string) error {
+	v, err := credvault.New(passphrase)
+	if err != nil {
+		return err
+	}
+	openCharacters(v)
+	return nil
+}
+
+// deriveVaultAsync runs derive, which spends a moment in Argon2id, off the
+// UI and passes the result to done on the next Update. Further requests
+// are refused until then.
+func deriveVaultAsync(derive func() (*credvault.Vault, error), done func(*credvault.Vault, error)) {
+	if vaultBusy {
+		return
+	}
+	vaultBusy = true
+	updateVaultRow()
+	go func() {
+		v, err := derive()
+		queueUpdate(func() {
+			vaultBusy = false
+			done(v, err)
+			updateCharacterButtons()
+		})
+	}()
+}
+
+// resetCharacterVault turns the vault off, forgetting the passwords sealed
+// in it. The characters themselves are kept.
+func resetCharacterVault() {
+	for i := range characters {
+		if characters[i].Sealed != "" && charVault == nil {
+			characters[i].passHash = ""
+		}
+		characters[i].Sealed = ""
+	}
+	charVaultHeader, charVault = nil, nil
+	saveCharacters()
+}
+
+// updateVaultRow shows the unlock prompt in the login window while the
+// vault is locked, or an offer to turn it on while passwords are only
+// scrambled.
+func updateVaultRow() {
+	if vaultRow == nil {
+		return
+	}
+	vaultRow.Contents = vaultRow.Contents[:0]
+	switch {
+	case charactersLocked():
+		txt, _ := eui.NewText()
+		txt.Text = "Saved passwords are locked"
+		txt.FontSize = 12
+		txt.Size = eui.Point{X: charWinWidth, Y: 24}
+		vaultRow.AddItem(txt)
+
+		in, _ := eui.NewInput()
+		in.Label = "Passphrase"
+		in.TextPtr = &vaultPass
+		in.HideText = true
+		in.Size = eui.Point{X: charWinWidth, Y: 24}
+		vaultPassInput = in
+		vaultRow.AddItem(in)
+
+		btns := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
+
+		unlockBtn, unlockEvents := eui.NewButton()
+		unlockBtn.Text = "Unlock"
+		if vaultBusy {
+			unlockBtn.Text = "Unlocking..."
+			unlockBtn.Disabled = true
+		}
+		unlockBtn.Size = eui.Point{X: charWinWidth - 80, Y: 24}
+		unlockEvents.Handle = func(ev eui.UIEvent) {
+			if ev.Type == eui.EventClick {
+				h, passphrase := *charVaultHeader, vaultPass
+				vaultPass = ""
+				vaultPassInput.Text = ""
+				vaultPassInput.Dirty = true
+				deriveVaultAsync(func() (*credvault.Vault, error) {
+					return credvault.Unlock(h, passphrase)
+				}, func(v *credvault.Vault, err error) {
+					if err != nil {
+						makeErrorWindow("Error: Unlock: " + err.Error())
+						return
+					}
+					if charactersLocked() {
+						openCharacters(v)
+					}
+				})
+			}
+		}
+		btns.AddItem(unlockBtn)
+		resetBtn, resetEvents := eui.NewButton()
+		resetBtn.Text = "Reset"
+		resetBtn.Size = eui.Point{X: 80, Y: 24}
+		resetBtn.Color = eui.ColorDarkRed
+		resetBtn.HoverColor = eui.ColorRed
+		resetEvents.Handle = func(ev eui.UIEvent) {
+			if ev.Type == eui.EventClick {
+				confirmResetVault()
+			}
+		}
+		btns.AddItem(resetBtn)
+		vaultRow.AddItem(btns)
+	case charVaultHeader == nil && rememberedPasswords():
+		protectBtn, protectEvents := eui.NewButton()
+		protectBtn.Text = "Protect saved passwords"
+		protectBtn.Size = eui.Point{X: charWinWidth, Y: 24}
+		protectEvents.Handle = func(ev eui.UIEvent) {
+			if ev.Type == eui.EventClick {
+				showProtectPasswords()
+			}
+		}
+		vaultRow.AddItem(protectBtn)
+	}
+}
+
+func rememberedPasswords() bool {
+	for _, c := range characters {
+		if c.passHash != "" && !c.DontRemember {
+			return true
+		}
+	}
+	return false
+}
+
+// showProtectPasswords asks for a new master passphrase.
+func showProtectPasswords() {
+	var first, second string
+	in1, _ := eui.NewInput()
+	in1.Label = "Passphrase"
+	in1.TextPtr = &first
+	in1.HideText = true
+	in1.Size = eui.Point{X: 240, Y: 24}
+	in2, _ := eui.NewInput()
+	in2.Label = "Repeat"
+	in2.TextPtr = &second
+	in2.HideText = true
+	in2.Size = eui.Point{X: 240, Y: 24}
+	showPopup(
+		"Protect Saved Passwords",
+		"Encrypt saved character passwords with a master passphrase. You enter it once per session to unlock them. If you forget it, the passwords have to be entered again.",
+		[]popupButton{
+			{Text: "Cancel"},
+			{Text: "Protect", Color: &eui.ColorDarkGreen, HoverColor: &eui.ColorGreen, Action: func() {
+				if first != second {
+					makeErrorWindow("Error: Protect: passphrases do not match")
+					return
+				}
+				deriveVaultAsync(func() (*credvault.Vault, error) {
+					return credvault.New(first)
+				}, func(v *credvault.Vault, err error) {
+					if err != nil {
+						makeErrorWindow("Error: Protect: " + err.Error())
+						return
+					}
+					if charVaultHeader == nil {
+						openCharacters(v)
+					}
+				})
+			}},
+		},
+		in1, in2,
+	)
+}
+
+func confirmResetVault() {
+	showPopup(
+		"Reset Saved Passwords",
+		"Forget the master passphrase and every password saved under it? Your characters stay in the list; you type their passwords again next time.",
+		[]popupButton{
+			{Text: "Cancel"},
+			{Text: "Reset", Color: &eui.ColorDarkRed, HoverColor: &eui.ColorRed, Action: func() {
+				resetCharacterVault()
+				updateCharacterButtons()
+			}},
+		},
+	)
+}
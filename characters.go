@@ -7,14 +7,18 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"gothoom/credvault"
 )
 
 // Character holds a saved character name and password hash. The hash is stored
-// on disk using a reversible scrambling to avoid exposing the raw hash.
+// on disk using a reversible scrambling to avoid exposing the raw hash, or
+// sealed in the credential vault once the player sets a master passphrase.
 type Character struct {
 	Name         string         `json:"name"`
 	passHash     string         `json:"-"`
 	Key          string         `json:"key"`
+	Sealed       string         `json:"sealed,omitempty"`
 	DontRemember bool           `json:"-"`
 	PictID       uint16         `json:"pict,omitempty"`
 	ColorsHex    string         `json:"colors,omitempty"`
@@ -32,8 +36,9 @@ const (
 )
 
 type charactersFile struct {
-	Version    int         `json:"version"`
-	Characters []Character `json:"characters"`
+	Version    int               `json:"version"`
+	Vault      *credvault.Header `json:"vault,omitempty"`
+	Characters []Character       `json:"characters"`
 }
 
 func loadCharacters() {
@@ -46,13 +51,16 @@ func loadCharacters() {
 	if err := json.Unmarshal(data, &charList); err != nil {
 		return
 	}
+	charVaultHeader, charVault = charList.Vault, nil
 	if charList.Version >= 1 {
 		var filtered []Character
 		for _, c := range charList.Characters {
 			if strings.HasPrefix(c.Name, agratisPrefix) {
 				continue
 			}
-			c.passHash = unscrambleHash(c.Name, c.Key)
+			if c.Sealed == "" {
+				c.passHash = unscrambleHash(c.Name, c.Key)
+			}
 			if charList.Version >= 2 && c.ColorsHex != "" {
 				if b, ok := decodeHex(c.ColorsHex); ok && len(b) > 0 {
 					cnt := int(b[0])
@@ -75,7 +83,14 @@ func saveCharacters() {
 		if characters[i].DontRemember || strings.HasPrefix(characters[i].Name, agratisPrefix) {
 			continue
 		}
-		characters[i].Key = scrambleHash(characters[i].Name, characters[i].passHash)
+		switch {
+		case charVaultHeader != nil:
+			if err := sealCharacter(&characters[i]); err != nil {
+				log.Printf("seal %s: %v", characters[i].Name, err)
+			}
+		default:
+			characters[i].Key = scrambleHash(characters[i].Name, characters[i].passHash)
+		}
 		if len(characters[i].Colors) > 0 {
 			buf := make([]byte, 1+len(characters[i].Colors))
 			if len(characters[i].Colors) > 255 {
@@ -94,6 +109,7 @@ func saveCharacters() {
 
 	var charList charactersFile
 	charList.Version = 2
+	charList.Vault = charVaultHeader
 	charList.Characters = persisted
 	data, err := json.MarshalIndent(charList, "", "  ")
 
@@ -109,11 +125,11 @@ func saveCharacters() {
 // backfillCharactersFromPlayers populates missing appearance and profession
 // information for saved characters using data loaded from GT_Players.json.
 // If any character is updated, the characters file is saved.
-func backfillCharactersFromPlayers() {
-	playersMu.RLock()
+func (s *session) backfillCharactersFromPlayers() {
+	s.playersMu.RLock()
 	changed := false
 	for i := range characters {
-		p, ok := players[characters[i].Name]
+		p, ok := s.players[characters[i].Name]
 		if !ok || p == nil {
 			continue
 		}
@@ -130,7 +146,7 @@ func backfillCharactersFromPlayers() {
 			changed = true
 		}
 	}
-	playersMu.RUnlock()
+	s.playersMu.RUnlock()
 	if changed {
 		saveCharacters()
 	}
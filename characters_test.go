@@ -1,6 +1,14 @@
 package main
 
-import "testing"
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gothoom/credvault"
+)
 
 func TestScrambleHashBlank(t *testing.T) {
 	if s := scrambleHash("name", ""); s != "" {
@@ -65,21 +73,21 @@ func TestBackfillCharactersFromPlayers(t *testing.T) {
 	dataDirPath = dir
 	defer func() { dataDirPath = origDir }()
 
-	playersMu.Lock()
-	origPlayers := players
-	players = map[string]*Player{
+	mainSession.playersMu.Lock()
+	origPlayers := mainSession.players
+	mainSession.players = map[string]*Player{
 		"Hero": {Name: "Hero", PictID: 77, Colors: []byte{4, 5}, Class: "mystic"},
 	}
-	playersMu.Unlock()
+	mainSession.playersMu.Unlock()
 	defer func() {
-		playersMu.Lock()
-		players = origPlayers
-		playersMu.Unlock()
+		mainSession.playersMu.Lock()
+		mainSession.players = origPlayers
+		mainSession.playersMu.Unlock()
 	}()
 
 	origChars := characters
 	characters = []Character{{Name: "Hero"}}
-	backfillCharactersFromPlayers()
+	mainSession.backfillCharactersFromPlayers()
 	if len(characters) != 1 {
 		t.Fatalf("expected 1 character, got %d", len(characters))
 	}
@@ -96,3 +104,119 @@ func TestBackfillCharactersFromPlayers(t *testing.T) {
 
 	characters = origChars
 }
+
+// useCharacterVault gives the test an empty data directory and no saved
+// characters or vault, and returns the directory.
+func useCharacterVault(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	origDir := dataDirPath
+	origChars := characters
+	dataDirPath = dir
+	characters = nil
+	charVaultHeader, charVault = nil, nil
+	t.Cleanup(func() {
+		dataDirPath = origDir
+		characters = origChars
+		charVaultHeader, charVault = nil, nil
+	})
+	return dir
+}
+
+func TestCharacterVaultMigration(t *testing.T) {
+	dir := useCharacterVault(t)
+	const hash = "0123456789abcdef0123456789abcdef"
+
+	characters = []Character{{Name: "Hero", passHash: hash}}
+	saveCharacters()
+	if err := protectCharacters("correct horse"); err != nil {
+		t.Fatalf("protect: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, charsFilePath))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if strings.Contains(string(data), scrambleHash("Hero", hash)) || !strings.Contains(string(data), `"sealed"`) {
+		t.Fatalf("password not sealed:\n%s", data)
+	}
+
+	// A new session starts locked, and saving keeps the sealed entry.
+	characters = nil
+	loadCharacters()
+	if !charactersLocked() || characters[0].passHash != "" {
+		t.Fatalf("loaded unlocked: %+v", characters)
+	}
+	saveCharacters()
+	loadCharacters()
+	if err := unlockCharacters("battery staple"); !errors.Is(err, credvault.ErrWrongPassphrase) {
+		t.Fatalf("wrong passphrase = %v", err)
+	}
+	if err := unlockCharacters("correct horse"); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if charactersLocked() || characters[0].passHash != hash {
+		t.Fatalf("after unlock: %+v", characters)
+	}
+}
+
+func TestCharacterVaultLockedNewCharacter(t *testing.T) {
+	dir := useCharacterVault(t)
+	const hash = "0123456789abcdef0123456789abcdef"
+
+	// Vault turned on before any password was remembered.
+	if err := protectCharacters("correct horse"); err != nil {
+		t.Fatalf("protect: %v", err)
+	}
+
+	// Next session: nothing is sealed, but the vault is still locked.
+	loadCharacters()
+	if !charactersLocked() {
+		t.Fatalf("vault with no sealed entries reported unlocked")
+	}
+	characters = append(characters, Character{Name: "Alt", passHash: hash})
+	saveCharacters()
+	data, err := os.ReadFile(filepath.Join(dir, charsFilePath))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if strings.Contains(string(data), scrambleHash("Alt", hash)) {
+		t.Fatalf("password saved outside the vault while locked:\n%s", data)
+	}
+
+	// Quit without unlocking: the password was sealed to the vault's
+	// public key and opens in the next session.
+	characters = nil
+	loadCharacters()
+	if len(characters) != 1 || characters[0].Sealed == "" {
+		t.Fatalf("new password not sealed while locked: %+v", characters)
+	}
+	if err := unlockCharacters("correct horse"); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if characters[0].passHash != hash {
+		t.Fatalf("after unlock: %+v", characters)
+	}
+}
+
+func TestCharacterVaultKeepsUnopenedEntry(t *testing.T) {
+	useCharacterVault(t)
+	const hash = "0123456789abcdef0123456789abcdef"
+
+	characters = []Character{{Name: "Hero", passHash: hash}}
+	if err := protectCharacters("correct horse"); err != nil {
+		t.Fatalf("protect: %v", err)
+	}
+	// An entry that does not open is written back untouched.
+	characters = nil
+	loadCharacters()
+	sealed := characters[0].Sealed
+	characters[0].Name = "Renamed"
+	if err := unlockCharacters("correct horse"); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	characters = nil
+	loadCharacters()
+	if len(characters) != 1 || characters[0].Sealed != sealed {
+		t.Fatalf("unopened entry changed: %+v", characters)
+	}
+}
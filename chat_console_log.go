@@ -71,7 +71,7 @@ func ensureTextLog() {
 		base := filepath.Join("Text Logs")
 
 		// Character subfolder (fallback to "Unknown").
-		name := playerName
+		name := focusedSession().playerName
 		if strings.TrimSpace(name) == "" {
 			name = "Unknown"
 		}
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// The chat/console history is kept per character under
+// <data>/History/<name>/: one JSON-lines log per day plus index.json, which
+// maps every word seen to the days it appears on so searches only read the
+// logs that can match.
+const (
+	historyDirName           = "History"
+	historyIndexFile         = "index.json"
+	historyDayLayout         = "2006-01-02"
+	historyIndexSaveInterval = 10 * time.Second
+	historyMaxLine           = 1 << 20
+)
+
+// historyEntry is one chat or console line.
+type historyEntry struct {
+	Time time.Time `json:"t"`
+	// Channel is say, think, yell, whisper or action for chat and console
+	// for everything else.
+	Channel string `json:"ch"`
+	// Tag is the BEPP tag a console line arrived with, if any.
+	Tag     string `json:"tag,omitempty"`
+	Speaker string `json:"who,omitempty"`
+	Text    string `json:"text"`
+}
+
+type historyIndex struct {
+	// Days holds how many bytes of each day's log have been indexed.
+	Days  map[string]int64    `json:"days"`
+	Words map[string][]string `json:"words"`
+}
+
+// historyQuery selects entries. Every word of Text must start a word of the
+// entry; Player must be one of its words. Zero values match everything.
+type historyQuery struct {
+	Text    string
+	Player  string
+	Channel string
+	From    time.Time // inclusive
+	To      time.Time // exclusive
+	Limit   int
+}
+
+type historyStore struct {
+	mu       sync.Mutex
+	name     string
+	dir      string
+	idx      historyIndex
+	dirty    bool
+	lastSave time.Time
+}
+
+var (
+	chatHistory   *historyStore
+	chatHistoryMu sync.Mutex
+)
+
+// recordHistory adds a line to the history of s's character. Nothing is
+// recorded before login or while playing back movies and captures.
+func (s *session) recordHistory(channel, tag, speaker, msg string) {
+	if msg == "" || s.playerName == "" || movieMode || playingMovie || clmov != "" || pcapPath != "" || fake {
+		return
+	}
+	chatHistoryMu.Lock()
+	defer chatHistoryMu.Unlock()
+	if chatHistory == nil || chatHistory.name != s.playerName {
+		if chatHistory != nil {
+			chatHistory.save()
+		}
+		store, err := openHistoryStore(filepath.Join(dataDirPath, historyDirName, s.playerName))
+		if err != nil {
+			log.Printf("chat history: %v", err)
+			chatHistory = nil
+			return
+		}
+		store.name = s.playerName
+		chatHistory = store
+	}
+	e := historyEntry{Time: time.Now(), Channel: channel, Tag: tag, Speaker: speaker, Text: msg}
+	if err := chatHistory.add(e); err != nil {
+		log.Printf("chat history: %v", err)
+	}
+}
+
+// flushChatHistory writes any pending index changes to disk.
+func flushChatHistory() {
+	chatHistoryMu.Lock()
+	defer chatHistoryMu.Unlock()
+	if chatHistory != nil {
+		if err := chatHistory.save(); err != nil {
+			log.Printf("chat history: %v", err)
+		}
+	}
+}
+
+// chatChannel classifies a chat line by the verb following the speaker.
+func chatChannel(msg string) string {
+	m := strings.TrimSpace(msg)
+	if strings.HasPrefix(m, "(") {
+		return "action"
+	}
+	if i := strings.IndexByte(m, ','); i >= 0 {
+		m = m[:i]
+	}
+	switch {
+	case strings.Contains(m, " thinks"):
+		return "think"
+	case strings.Contains(m, " yells"):
+		return "yell"
+	case strings.Contains(m, " whispers"):
+		return "whisper"
+	}
+	for _, v := range languageYellVerb {
+		if strings.Contains(m, " "+v) {
+			return "yell"
+		}
+	}
+	for _, v := range languageWhisperVerb {
+		if strings.Contains(m, " "+v) {
+			return "whisper"
+		}
+	}
+	return "say"
+}
+
+// historyWords splits s into lower-case words.
+func historyWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// openHistoryStore loads the index in dir and indexes any log lines written
+// after it was last saved, such as after a crash.
+func openHistoryStore(dir string) (*historyStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &historyStore{dir: dir, lastSave: time.Now()}
+	if data, err := os.ReadFile(filepath.Join(dir, historyIndexFile)); err == nil {
+		if err := json.Unmarshal(data, &s.idx); err != nil {
+			log.Printf("chat history: rebuilding %v: %v", dir, err)
+			s.idx = historyIndex{}
+		}
+	}
+	if s.idx.Days == nil || s.idx.Words == nil {
+		s.idx = historyIndex{Days: map[string]int64{}, Words: map[string][]string{}}
+	}
+	days, err := s.logDays()
+	if err != nil {
+		return nil, err
+	}
+	for _, day := range days {
+		fi, err := os.Stat(s.dayPath(day))
+		if err != nil {
+			return nil, err
+		}
+		done := s.idx.Days[day]
+		if fi.Size() == done {
+			continue
+		}
+		if fi.Size() < done {
+			// The log was edited; start over rather than trust the index.
+			s.idx = historyIndex{Days: map[string]int64{}, Words: map[string][]string{}}
+			return s, s.reindex(days)
+		}
+		if err := s.indexDay(day, done); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *historyStore) dayPath(day string) string {
+	return filepath.Join(s.dir, day+".jsonl")
+}
+
+// logDays lists the days with a log, oldest first.
+func (s *historyStore) logDays() ([]string, error) {
+	ents, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var days []string
+	for _, e := range ents {
+		day, ok := strings.CutSuffix(e.Name(), ".jsonl")
+		if !ok || e.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(historyDayLayout, day); err == nil {
+			days = append(days, day)
+		}
+	}
+	sort.Strings(days)
+	return days, nil
+}
+
+func (s *historyStore) reindex(days []string) error {
+	for _, day := range days {
+		if err := s.indexDay(day, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexDay indexes the entries in day's log from byte offset off on.
+func (s *historyStore) indexDay(day string, off int64) error {
+	f, err := os.Open(s.dayPath(day))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// Leave a partly written last line for next time.
+			break
+		}
+		if err != nil {
+			return err
+		}
+		off += int64(len(line))
+		var e historyEntry
+		if json.Unmarshal(line, &e) == nil {
+			s.indexEntry(day, e)
+		}
+	}
+	s.idx.Days[day] = off
+	s.dirty = true
+	return nil
+}
+
+func (s *historyStore) indexEntry(day string, e historyEntry) {
+	words := historyWords(e.Text + " " + e.Speaker)
+	for _, w := range words {
+		days := s.idx.Words[w]
+		// Entries arrive day by day, so a repeat is always the last day.
+		if n := len(days); n > 0 && days[n-1] == day {
+			continue
+		}
+		s.idx.Words[w] = append(days, day)
+	}
+}
+
+// add appends e to its day's log and indexes it. The index is written at
+// most every historyIndexSaveInterval; flushChatHistory writes the rest.
+func (s *historyStore) add(e historyEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	day := e.Time.Format(historyDayLayout)
+	f, err := os.OpenFile(s.dayPath(day), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.indexEntry(day, e)
+	s.idx.Days[day] = fi.Size()
+	s.dirty = true
+	if time.Since(s.lastSave) >= historyIndexSaveInterval {
+		return s.saveLocked()
+	}
+	return nil
+}
+
+func (s *historyStore) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveLocked()
+}
+
+func (s *historyStore) saveLocked() error {
+	s.lastSave = time.Now()
+	if !s.dirty {
+		return nil
+	}
+	data, err := json.Marshal(s.idx)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.dir, historyIndexFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, historyIndexFile)); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// candidateDays returns the days that can hold matches for q, newest first.
+func (s *historyStore) candidateDays(q historyQuery, words []string, player []string) []string {
+	var from, to string
+	if !q.From.IsZero() {
+		from = q.From.Format(historyDayLayout)
+	}
+	if !q.To.IsZero() {
+		// To is exclusive, but an entry at 10:00 still lives in its day.
+		to = q.To.Format(historyDayLayout)
+	}
+	set := map[string]bool{}
+	for day := range s.idx.Days {
+		if (from == "" || day >= from) && (to == "" || day <= to) {
+			set[day] = true
+		}
+	}
+	keep := func(days map[string]bool) {
+		for day := range set {
+			if !days[day] {
+				delete(set, day)
+			}
+		}
+	}
+	for _, p := range player {
+		days := map[string]bool{}
+		for _, d := range s.idx.Words[p] {
+			days[d] = true
+		}
+		keep(days)
+	}
+	for _, w := range words {
+		days := map[string]bool{}
+		for word, ds := range s.idx.Words {
+			if strings.HasPrefix(word, w) {
+				for _, d := range ds {
+					days[d] = true
+				}
+			}
+		}
+		keep(days)
+	}
+	out := make([]string, 0, len(set))
+	for day := range set {
+		out = append(out, day)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(out)))
+	return out
+}
+
+// search returns the entries matching q, newest first.
+func (s *historyStore) search(q historyQuery) ([]historyEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	words := historyWords(q.Text)
+	player := historyWords(q.Player)
+	var out []historyEntry
+	for _, day := range s.candidateDays(q, words, player) {
+		var matches []historyEntry
+		err := s.scanDay(day, func(e historyEntry) {
+			if historyMatch(e, q, words, player) {
+				matches = append(matches, e)
+			}
+		})
+		if err != nil {
+			return out, err
+		}
+		for i := len(matches) - 1; i >= 0; i-- {
+			out = append(out, matches[i])
+			if q.Limit > 0 && len(out) >= q.Limit {
+				return out, nil
+			}
+		}
+	}
+	return out, nil
+}
+
+func (s *historyStore) scanDay(day string, fn func(historyEntry)) error {
+	f, err := os.Open(s.dayPath(day))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, historyMaxLine)
+	for sc.Scan() {
+		var e historyEntry
+		if json.Unmarshal(sc.Bytes(), &e) == nil {
+			fn(e)
+		}
+	}
+	return sc.Err()
+}
+
+func historyMatch(e historyEntry, q historyQuery, words, player []string) bool {
+	if q.Channel != "" && e.Channel != q.Channel {
+		return false
+	}
+	if !q.From.IsZero() && e.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !e.Time.Before(q.To) {
+		return false
+	}
+	have := historyWords(e.Text + " " + e.Speaker)
+	for _, p := range player {
+		found := false
+		for _, h := range have {
+			if h == p {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, w := range words {
+		found := false
+		for _, h := range have {
+			if strings.HasPrefix(h, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// searchChatHistory searches the current character's history.
+func searchChatHistory(q historyQuery) ([]historyEntry, error) {
+	chatHistoryMu.Lock()
+	s := chatHistory
+	chatHistoryMu.Unlock()
+	if s == nil {
+		name := focusedSession().playerName
+		if name == "" {
+			return nil, errors.New("no character logged in")
+		}
+		var err error
+		s, err = openHistoryStore(filepath.Join(dataDirPath, historyDirName, name))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.search(q)
+}
+
+// newHistoryQuery builds a query from the History window's fields. Dates
+// are YYYY-MM-DD in local time and both ends are inclusive.
+func newHistoryQuery(player, text, from, to string) (historyQuery, error) {
+	q := historyQuery{Player: strings.TrimSpace(player), Text: strings.TrimSpace(text)}
+	if from = strings.TrimSpace(from); from != "" {
+		t, err := time.ParseInLocation(historyDayLayout, from, time.Local)
+		if err != nil {
+			return q, fmt.Errorf("bad From date %q (use YYYY-MM-DD)", from)
+		}
+		q.From = t
+	}
+	if to = strings.TrimSpace(to); to != "" {
+		t, err := time.ParseInLocation(historyDayLayout, to, time.Local)
+		if err != nil {
+			return q, fmt.Errorf("bad To date %q (use YYYY-MM-DD)", to)
+		}
+		q.To = t.AddDate(0, 0, 1)
+	}
+	return q, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChatChannel(t *testing.T) {
+	cases := map[string]string{
+		"Bob says, hello":                  "say",
+		"Bob thinks to you, psst":          "think",
+		"Bob yells, Help!":                 "yell",
+		"Bob whispers, secret":             "whisper",
+		"Bob roars in People, grr":         "yell",
+		"(Bob waves)":                      "action",
+		"Bob says, he thinks, so he yells": "say",
+	}
+	for msg, want := range cases {
+		if got := chatChannel(msg); got != want {
+			t.Errorf("chatChannel(%q) = %q, want %q", msg, got, want)
+		}
+	}
+}
+
+func TestHistoryStoreSearch(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openHistoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day1 := time.Date(2024, 3, 1, 20, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 7)
+	for _, e := range []historyEntry{
+		{Time: day1, Channel: "console", Tag: "sh", Text: "Bob is sharing experiences with you."},
+		{Time: day1.Add(time.Minute), Channel: "say", Speaker: "Alice", Text: "Alice says, hi Bob"},
+		{Time: day2, Channel: "console", Tag: "sh", Text: "Bob is sharing experiences with you."},
+		{Time: day2.Add(time.Minute), Channel: "think", Speaker: "Carol", Text: "Carol thinks, anyone hunting?"},
+	} {
+		if err := s.add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.search(historyQuery{Player: "bob", Text: "shar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !got[0].Time.Equal(day2) || got[0].Tag != "sh" {
+		t.Fatalf("share search = %+v", got)
+	}
+	// Days without the words are never read.
+	if days := s.candidateDays(historyQuery{}, []string{"hunt"}, nil); len(days) != 1 || days[0] != "2024-03-08" {
+		t.Fatalf("candidate days = %v", days)
+	}
+	q, err := newHistoryQuery("Bob", "", "2024-03-01", "2024-03-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.search(q); len(got) != 2 {
+		t.Fatalf("date range search = %+v", got)
+	}
+	if got, _ := s.search(historyQuery{Channel: "think"}); len(got) != 1 || got[0].Speaker != "Carol" {
+		t.Fatalf("channel search = %+v", got)
+	}
+	if got, _ := s.search(historyQuery{Limit: 3}); len(got) != 3 {
+		t.Fatalf("limited search = %d entries", len(got))
+	}
+	if _, err := newHistoryQuery("", "", "last week", ""); err == nil {
+		t.Fatalf("expected an error for a bad date")
+	}
+}
+
+func TestHistoryStoreCatchUp(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openHistoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 3, 1, 20, 0, 0, 0, time.Local)
+	if err := s.add(historyEntry{Time: now, Channel: "say", Text: "Alice says, saved"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+	// Lines written after the index was last saved, as after a crash.
+	if err := s.add(historyEntry{Time: now.Add(time.Second), Channel: "say", Text: "Alice says, unsaved"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = openHistoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.search(historyQuery{Text: "unsaved"}); len(got) != 1 {
+		t.Fatalf("unsaved line not indexed: %+v", got)
+	}
+
+	// A log that shrank is reindexed from scratch.
+	path := filepath.Join(dir, "2024-03-01.jsonl")
+	if err := os.WriteFile(path, []byte(`{"t":"2024-03-01T20:00:00Z","ch":"say","text":"only line"}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = openHistoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.search(historyQuery{Text: "saved"}); len(got) != 0 {
+		t.Fatalf("stale index entries: %+v", got)
+	}
+	if got, _ := s.search(historyQuery{Text: "only"}); len(got) != 1 {
+		t.Fatalf("rewritten log not indexed: %+v", got)
+	}
+}
@@ -9,37 +9,45 @@ const (
 	maxChatMessages = 1000
 )
 
-var (
-	chatLog             = messageLog{max: maxChatMessages}
-	chatTTSDisabledOnce sync.Once
-)
+var chatTTSDisabledOnce sync.Once
+
+// chatMessage adds a chat line to the focused session.
+func chatMessage(msg string) { focusedSession().chatMessage(msg) }
 
-func chatMessage(msg string) {
+func (s *session) chatMessage(msg string) {
 	if msg == "" {
 		return
 	}
 
 	speaker := chatSpeaker(msg)
 	if speaker != "" {
-		playersMu.RLock()
-		p, ok := players[speaker]
+		s.playersMu.RLock()
+		p, ok := s.players[speaker]
 		blocked := ok && (p.Blocked || p.Ignored)
-		playersMu.RUnlock()
+		s.playersMu.RUnlock()
 		if blocked {
 			return
 		}
 	}
 
-	chatLog.Add(msg)
+	s.chat.Add(msg)
+	if !s.isFocused() {
+		return
+	}
+	headlessEmit("chat", msg)
+	if movieDumpText != nil {
+		movieDumpText("chat", msg)
+	}
 	appendChatLog(msg)
+	s.recordHistory(chatChannel(msg), "", speaker, msg)
 
 	updateChatWindow()
 
-	if gs.ChatTTS && !blockTTS && !isSelfChatMessage(msg) {
+	if gs.ChatTTS && !blockTTS && !s.isSelfChatMessage(msg) {
 		if speaker == "" || !isTTSBlocked(speaker) {
 			speakChatMessage(msg)
 		}
-	} else if !gs.ChatTTS {
+	} else if !gs.ChatTTS && !headless {
 		chatTTSDisabledOnce.Do(func() {
 			consoleMessage("Chat TTS is disabled. Enable it in settings to hear messages.")
 		})
@@ -53,15 +61,15 @@ func getChatMessages() []string {
 	if format == "" {
 		format = "3:04PM"
 	}
-	return chatLog.Entries(format, gs.ChatTimestamps)
+	return focusedSession().chat.Entries(format, gs.ChatTimestamps)
 }
 
-func isSelfChatMessage(msg string) bool {
-	if playerName == "" {
+func (s *session) isSelfChatMessage(msg string) bool {
+	if s.playerName == "" {
 		return false
 	}
 	m := strings.ToLower(strings.TrimSpace(msg))
-	name := strings.ToLower(playerName)
+	name := strings.ToLower(s.playerName)
 
 	if strings.HasPrefix(m, "("+name+" ") {
 		return true
@@ -3,7 +3,7 @@ package main
 import "testing"
 
 func TestIsSelfChatMessage(t *testing.T) {
-	playerName = "Hero"
+	mainSession.playerName = "Hero"
 	cases := []struct {
 		msg  string
 		want bool
@@ -16,19 +16,19 @@ func TestIsSelfChatMessage(t *testing.T) {
 		{"Hero has fallen", false},
 	}
 	for _, c := range cases {
-		if got := isSelfChatMessage(c.msg); got != c.want {
+		if got := mainSession.isSelfChatMessage(c.msg); got != c.want {
 			t.Errorf("isSelfChatMessage(%q) = %v; want %v", c.msg, got, c.want)
 		}
 	}
 }
 
 func TestChatMessageBlocked(t *testing.T) {
-	players = make(map[string]*Player)
-	chatLog = messageLog{max: maxChatMessages}
-	p := getPlayer("Bob")
-	playersMu.Lock()
+	mainSession.players = make(map[string]*Player)
+	mainSession.chat = messageLog{max: maxChatMessages}
+	p := mainSession.getPlayer("Bob")
+	mainSession.playersMu.Lock()
 	p.Blocked = true
-	playersMu.Unlock()
+	mainSession.playersMu.Unlock()
 	chatMessage("Bob says, hi")
 	if len(getChatMessages()) != 0 {
 		t.Fatalf("expected no messages")
@@ -36,12 +36,12 @@ func TestChatMessageBlocked(t *testing.T) {
 }
 
 func TestChatMessageIgnored(t *testing.T) {
-	players = make(map[string]*Player)
-	chatLog = messageLog{max: maxChatMessages}
-	p := getPlayer("Bob")
-	playersMu.Lock()
+	mainSession.players = make(map[string]*Player)
+	mainSession.chat = messageLog{max: maxChatMessages}
+	p := mainSession.getPlayer("Bob")
+	mainSession.playersMu.Lock()
 	p.Ignored = true
-	playersMu.Unlock()
+	mainSession.playersMu.Unlock()
 	chatMessage("Bob says, hi")
 	if len(getChatMessages()) != 0 {
 		t.Fatalf("expected no messages")
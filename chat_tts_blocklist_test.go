@@ -66,14 +66,14 @@ func TestHandleNoTTSList(t *testing.T) {
 	origList := gs.ChatTTSBlocklist
 	gs.ChatTTSBlocklist = []string{"foo", "bar"}
 	syncTTSBlocklist()
-	origLog := consoleLog
-	consoleLog = messageLog{max: maxMessages}
+	origLog := mainSession.console
+	mainSession.console = messageLog{max: maxMessages}
 	handleNoTTSCommand("list")
 	msgs := getConsoleMessages()
 	if len(msgs) != 1 || msgs[0] != "TTS blocklist: foo, bar" {
 		t.Fatalf("got %v", msgs)
 	}
-	consoleLog = origLog
+	mainSession.console = origLog
 	gs.ChatTTSBlocklist = origList
 	syncTTSBlocklist()
 }
@@ -2,13 +2,15 @@ package main
 
 import "sync"
 
-// Mobile represents basic info about a mobile clicked in the world.
+// Mobile represents basic info about a mobile in the world.
 type Mobile struct {
 	Index  uint8
 	Name   string
 	H, V   int16
 	PictID uint16
 	Colors uint8
+	State  uint8
+	Fallen bool
 }
 
 // ClickInfo describes the last click in the game world.
@@ -27,12 +29,13 @@ var (
 )
 
 // worldInfoAt returns information about the world location including any
-// mobile under the provided coordinates.
+// mobile under the provided coordinates in the game window.
 func worldInfoAt(x, y int16) ClickInfo {
 	info := ClickInfo{X: x, Y: y}
-	stateMu.Lock()
-	for _, m := range state.liveMobs {
-		if d, ok := state.descriptors[m.Index]; ok {
+	s := focusedSession()
+	s.stateMu.Lock()
+	for _, m := range s.state.liveMobs {
+		if d, ok := s.state.descriptors[m.Index]; ok {
 			size := mobileSize(d.PictID)
 			half := int16(size / 2)
 			if x >= m.H-half && x < m.H+half && y >= m.V-half && y < m.V+half {
@@ -44,12 +47,14 @@ func worldInfoAt(x, y int16) ClickInfo {
 					V:      m.V,
 					PictID: d.PictID,
 					Colors: m.Colors,
+					State:  m.State,
+					Fallen: m.State == poseDead,
 				}
 				break
 			}
 		}
 	}
-	stateMu.Unlock()
+	s.stateMu.Unlock()
 	return info
 }
 
@@ -3,14 +3,13 @@ package climg
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"image"
 	"io"
 	"log"
 	"os"
 	"sync"
-
-	"github.com/hajimehoshi/ebiten/v2"
 )
 
 type dataLocation struct {
@@ -35,19 +34,23 @@ type dataLocation struct {
 }
 
 type CLImages struct {
+	imageCache // Ebiten images built from decoded pictures
+
 	data             []byte
 	idrefs           map[uint32]*dataLocation
 	colors           map[uint32]*dataLocation
 	images           map[uint32]*dataLocation
 	lights           map[uint32]*dataLocation
 	items            map[uint32]*ClientItem
-	cache            map[string]*ebiten.Image
 	lightInfos       map[uint32]LightInfo
 	masks            map[string]*AlphaMask
 	mu               sync.Mutex
 	Denoise          bool
 	DenoiseSharpness float64
 	DenoiseAmount    float64
+	// VerifyChecksums makes decoding fail with ErrChecksum for pictures
+	// whose data does not match their stored checksum.
+	VerifyChecksums bool
 }
 
 const (
@@ -97,7 +100,6 @@ func Load(path string) (*CLImages, error) {
 		images:     make(map[uint32]*dataLocation, entryCount),
 		lights:     make(map[uint32]*dataLocation, entryCount),
 		items:      make(map[uint32]*ClientItem),
-		cache:      make(map[string]*ebiten.Image),
 		lightInfos: make(map[uint32]LightInfo),
 	}
 
@@ -307,33 +309,8 @@ func Load(path string) (*CLImages, error) {
 			}
 		}
 
-		// verify checksum unless disabled
-		/*
-			bitsLoc := imgs.images[ref.imageID]
-			colLoc := imgs.colors[ref.colorID]
-			if bitsLoc != nil && colLoc != nil {
-				endBits := int(bitsLoc.offset + bitsLoc.size)
-				endCols := int(colLoc.offset + colLoc.size)
-				if endBits <= len(imgs.data) && endCols <= len(imgs.data) {
-					bits := imgs.data[bitsLoc.offset:endBits]
-					colors := imgs.data[colLoc.offset:endCols]
-					var light []byte
-					if ref.lightingID != 0 {
-						if l := imgs.lights[uint32(ref.lightingID)]; l != nil {
-							endLight := int(l.offset + l.size)
-							if endLight <= len(imgs.data) {
-								light = imgs.data[l.offset:endLight]
-							}
-						}
-					}
-						sum := calculateChecksum(bits, colors, light, ref)
-						if ref.checksum != 0 && (ref.flags&pictDefFlagNoChecksum) == 0 && sum != ref.checksum {
-							log.Printf("climg: checksum mismatch for idref %d: have %08x want %08x", ref.id, sum, ref.checksum)
-							loadErr = fmt.Errorf("climg: checksum mismatch for idref %d", ref.id)
-							panic(loadErr)
-						}
-				}
-			} */
+		// Checksums are not verified while loading; VerifyChecksums
+		// checks pictures as they decode.
 	}
 
 	// parse client items (names, slots, pictIDs)
@@ -426,6 +403,17 @@ func (c *CLImages) Item(id uint32) (ClientItem, bool) {
 	return ClientItem{}, false
 }
 
+// ItemIDs returns all client item identifiers present in the archive.
+func (c *CLImages) ItemIDs() []uint32 {
+	ids := make([]uint32, 0, len(c.items))
+	for id, it := range c.items {
+		if it != nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 // ItemName returns the public name for an item id, or empty if unknown.
 func (c *CLImages) ItemName(id uint32) string {
 	if it, ok := c.items[id]; ok && it != nil {
@@ -492,172 +480,6 @@ func alphaTransparentForFlags(flags uint32) (uint8, bool) {
 	}
 }
 
-// Get returns an Ebiten image for the given picture ID. The custom slice
-// provides optional palette overrides. If forceTransparent is true, palette
-// index 0 is treated as fully transparent regardless of the sprite's
-// pictDef flags. The Macintosh client always rendered mobile sprites this
-// way, even when the transparency flag wasn't set.
-func (c *CLImages) Get(id uint32, custom []byte, forceTransparent bool) *ebiten.Image {
-	key := fmt.Sprintf("%d-%x-%t", id, custom, forceTransparent)
-	c.mu.Lock()
-	if img, ok := c.cache[key]; ok {
-		c.mu.Unlock()
-		return img
-	}
-	c.mu.Unlock()
-
-	ref := c.idrefs[id]
-	if ref == nil {
-		return nil
-	}
-	imgLoc := c.images[ref.imageID]
-	colLoc := c.colors[ref.colorID]
-	if imgLoc == nil || colLoc == nil {
-		return nil
-	}
-
-	r := bytes.NewReader(c.data)
-	if _, err := r.Seek(int64(imgLoc.offset), io.SeekStart); err != nil {
-		log.Printf("seek image %d: %v", id, err)
-		return nil
-	}
-
-	var h, w uint16
-	var pad uint32
-	var v, b byte
-	if err := binary.Read(r, binary.BigEndian, &h); err != nil {
-		log.Printf("read h for %d: %v", id, err)
-		return nil
-	}
-	if err := binary.Read(r, binary.BigEndian, &w); err != nil {
-		log.Printf("read w for %d: %v", id, err)
-		return nil
-	}
-	if err := binary.Read(r, binary.BigEndian, &pad); err != nil {
-		log.Printf("read pad for %d: %v", id, err)
-		return nil
-	}
-	if err := binary.Read(r, binary.BigEndian, &v); err != nil {
-		log.Printf("read v for %d: %v", id, err)
-		return nil
-	}
-	if err := binary.Read(r, binary.BigEndian, &b); err != nil {
-		log.Printf("read b for %d: %v", id, err)
-		return nil
-	}
-
-	width := int(w)
-	height := int(h)
-	valueW := int(v)
-	blockLenW := int(b)
-	pixelCount := width * height
-	br := New(r)
-	data := make([]byte, pixelCount)
-	pixPos := 0
-	for pixPos < pixelCount {
-		t, err := br.ReadBit()
-		if err != nil {
-			log.Printf("read bit for %d: %v", id, err)
-			return nil
-		}
-		s, err := br.ReadInt(blockLenW)
-		if err != nil {
-			log.Printf("read int for %d: %v", id, err)
-			return nil
-		}
-		s++
-		if t {
-			for i := 0; i < s; i++ {
-				val, err := br.ReadBits(valueW)
-				if err != nil {
-					log.Printf("read bits for %d: %v", id, err)
-					return nil
-				}
-				if pixPos < pixelCount {
-					data[pixPos] = val
-					pixPos++
-				} else {
-					break
-				}
-			}
-		} else {
-			val, err := br.ReadBits(valueW)
-			if err != nil {
-				log.Printf("read bits for %d: %v", id, err)
-				return nil
-			}
-			for i := 0; i < s; i++ {
-				if pixPos < pixelCount {
-					data[pixPos] = val
-					pixPos++
-				} else {
-					break
-				}
-			}
-		}
-	}
-
-	// prepare color table and handle custom palette row if present
-	pal := palette // from palette.go
-	col := append([]uint16(nil), colLoc.colorBytes...)
-
-	var mapping []byte
-	if ref.flags&pictDefCustomColors != 0 {
-		if len(data) >= width {
-			mapping = data[:width]
-			data = data[width:]
-			height--
-		}
-		if len(custom) > 0 {
-			applyCustomPalette(col, mapping, custom)
-		}
-	}
-	pixelCount = len(data)
-	// Add a 1 pixel transparent border around the decoded image.
-	img := image.NewRGBA(image.Rect(0, 0, width+2, height+2))
-
-	// Determine alpha level and transparency handling based on
-	// sprite definition flags. Some assets (like mobiles) rely on
-	// index 0 being transparent even without the explicit flag, so
-	// allow callers to force this behavior.
-	alpha, transparent := alphaTransparentForFlags(ref.flags)
-	if forceTransparent {
-		transparent = true
-	}
-
-	pix := img.Pix
-	stride := img.Stride
-	for i := 0; i < pixelCount; i++ {
-		idx := col[data[i]]
-		r := uint8(pal[idx*3])
-		g := uint8(pal[idx*3+1])
-		b := uint8(pal[idx*3+2])
-		a := alpha
-		if idx == 0 && transparent {
-			a = 0
-		}
-		// Ebiten expects premultiplied alpha values.
-		r = uint8(int(r) * int(a) / 255)
-		g = uint8(int(g) * int(a) / 255)
-		b = uint8(int(b) * int(a) / 255)
-		off := (i/width+1)*stride + (i%width+1)*4
-		pix[off+0] = r
-		pix[off+1] = g
-		pix[off+2] = b
-		pix[off+3] = a
-	}
-
-	if c.Denoise {
-		denoiseImage(img, c.DenoiseSharpness, c.DenoiseAmount)
-	}
-
-	eimg := newImageFromImage(img)
-	c.mu.Lock()
-	c.cache[key] = eimg
-	c.mu.Unlock()
-	return eimg
-}
-
 // NumFrames returns the number of animation frames for the given image ID.
 // If unknown, it returns 1.
 func (c *CLImages) NumFrames(id uint32) int {
@@ -667,16 +489,6 @@ func (c *CLImages) NumFrames(id uint32) int {
 	return 1
 }
 
-// ClearCache removes all cached images so they will be reloaded on demand.
-func (c *CLImages) ClearCache() {
-	c.mu.Lock()
-	for _, img := range c.cache {
-		img.Deallocate()
-	}
-	c.cache = make(map[string]*ebiten.Image)
-	c.mu.Unlock()
-}
-
 // FrameIndex returns the picture frame for the given global animation counter.
 // If no animation is defined for the image, it returns 0.
 func (c *CLImages) FrameIndex(id uint32, counter int) int {
@@ -742,95 +554,26 @@ func (c *CLImages) NonTransparentPixels(id uint32) int {
 	if ref == nil {
 		return 0
 	}
-	imgLoc := c.images[ref.imageID]
 	colLoc := c.colors[ref.colorID]
-	if imgLoc == nil || colLoc == nil {
+	if colLoc == nil {
 		return 0
 	}
-	r := bytes.NewReader(c.data)
-	if _, err := r.Seek(int64(imgLoc.offset), io.SeekStart); err != nil {
-		log.Printf("seek image %d: %v", id, err)
-		return 0
-	}
-	var h, w uint16
-	var pad uint32
-	var v, b byte
-	if err := binary.Read(r, binary.BigEndian, &h); err != nil {
-		log.Printf("read h for %d: %v", id, err)
-		return 0
-	}
-	if err := binary.Read(r, binary.BigEndian, &w); err != nil {
-		log.Printf("read w for %d: %v", id, err)
-		return 0
-	}
-	if err := binary.Read(r, binary.BigEndian, &pad); err != nil {
-		log.Printf("read pad for %d: %v", id, err)
-		return 0
-	}
-	if err := binary.Read(r, binary.BigEndian, &v); err != nil {
-		log.Printf("read v for %d: %v", id, err)
-		return 0
-	}
-	if err := binary.Read(r, binary.BigEndian, &b); err != nil {
-		log.Printf("read b for %d: %v", id, err)
-		return 0
-	}
-
-	width := int(w)
-	height := int(h)
-	valueW := int(v)
-	blockLenW := int(b)
-	pixelCount := width * height
-	br := New(r)
-	data := make([]byte, pixelCount)
-	pixPos := 0
-	for pixPos < pixelCount {
-		t, err := br.ReadBit()
-		if err != nil {
-			log.Printf("read bit for %d: %v", id, err)
-			return 0
-		}
-		s, err := br.ReadInt(blockLenW)
-		if err != nil {
-			log.Printf("read int for %d: %v", id, err)
-			return 0
-		}
-		s++
-		if t {
-			for i := 0; i < s && pixPos < pixelCount; i++ {
-				val, err := br.ReadBits(valueW)
-				if err != nil {
-					log.Printf("read bits for %d: %v", id, err)
-					return 0
-				}
-				data[pixPos] = val
-				pixPos++
-			}
-		} else {
-			val, err := br.ReadBits(valueW)
-			if err != nil {
-				log.Printf("read bits for %d: %v", id, err)
-				return 0
-			}
-			for i := 0; i < s && pixPos < pixelCount; i++ {
-				data[pixPos] = val
-				pixPos++
-			}
+	p, err := c.decodeIndexed(id)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("decode image %d: %v", id, err)
 		}
-	}
-
-	if ref.flags&pictDefCustomColors != 0 && len(data) >= width {
-		data = data[width:]
+		return 0
 	}
 
 	_, transparent := alphaTransparentForFlags(ref.flags)
 	if !transparent {
-		return len(data)
+		return len(p.pix)
 	}
 
 	col := colLoc.colorBytes
 	count := 0
-	for _, idx := range data {
+	for _, idx := range p.pix {
 		if col[idx] != 0 {
 			count++
 		}
@@ -846,90 +589,21 @@ func (c *CLImages) HasOpaqueRect(id uint32, rect image.Rectangle) bool {
 	if ref == nil {
 		return false
 	}
-	imgLoc := c.images[ref.imageID]
 	colLoc := c.colors[ref.colorID]
-	if imgLoc == nil || colLoc == nil {
+	if colLoc == nil {
 		return false
 	}
-	r := bytes.NewReader(c.data)
-	if _, err := r.Seek(int64(imgLoc.offset), io.SeekStart); err != nil {
-		log.Printf("seek image %d: %v", id, err)
-		return false
-	}
-	var h, w uint16
-	var pad uint32
-	var v, b byte
-	if err := binary.Read(r, binary.BigEndian, &h); err != nil {
-		log.Printf("read h for %d: %v", id, err)
-		return false
-	}
-	if err := binary.Read(r, binary.BigEndian, &w); err != nil {
-		log.Printf("read w for %d: %v", id, err)
-		return false
-	}
-	if err := binary.Read(r, binary.BigEndian, &pad); err != nil {
-		log.Printf("read pad for %d: %v", id, err)
-		return false
-	}
-	if err := binary.Read(r, binary.BigEndian, &v); err != nil {
-		log.Printf("read v for %d: %v", id, err)
-		return false
-	}
-	if err := binary.Read(r, binary.BigEndian, &b); err != nil {
-		log.Printf("read b for %d: %v", id, err)
+	p, err := c.decodeIndexed(id)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("decode image %d: %v", id, err)
+		}
 		return false
 	}
-
-	width := int(w)
-	height := int(h)
-	rect = rect.Intersect(image.Rect(0, 0, width, height))
+	rect = rect.Intersect(image.Rect(0, 0, p.width, p.height))
 	if rect.Empty() {
 		return false
 	}
-	valueW := int(v)
-	blockLenW := int(b)
-	pixelCount := width * height
-	br := New(r)
-	data := make([]byte, pixelCount)
-	pixPos := 0
-	for pixPos < pixelCount {
-		t, err := br.ReadBit()
-		if err != nil {
-			log.Printf("read bit for %d: %v", id, err)
-			return false
-		}
-		s, err := br.ReadInt(blockLenW)
-		if err != nil {
-			log.Printf("read int for %d: %v", id, err)
-			return false
-		}
-		s++
-		if t {
-			for i := 0; i < s && pixPos < pixelCount; i++ {
-				val, err := br.ReadBits(valueW)
-				if err != nil {
-					log.Printf("read bits for %d: %v", id, err)
-					return false
-				}
-				data[pixPos] = val
-				pixPos++
-			}
-		} else {
-			val, err := br.ReadBits(valueW)
-			if err != nil {
-				log.Printf("read bits for %d: %v", id, err)
-				return false
-			}
-			for i := 0; i < s && pixPos < pixelCount; i++ {
-				data[pixPos] = val
-				pixPos++
-			}
-		}
-	}
-
-	if ref.flags&pictDefCustomColors != 0 && len(data) >= width {
-		data = data[width:]
-	}
 
 	_, transparent := alphaTransparentForFlags(ref.flags)
 	if !transparent {
@@ -938,9 +612,9 @@ func (c *CLImages) HasOpaqueRect(id uint32, rect image.Rectangle) bool {
 
 	col := colLoc.colorBytes
 	for y := rect.Min.Y; y < rect.Max.Y; y++ {
-		row := y * width
+		row := y * p.width
 		for x := rect.Min.X; x < rect.Max.X; x++ {
-			if col[data[row+x]] != 0 {
+			if col[p.pix[row+x]] != 0 {
 				return true
 			}
 		}
@@ -0,0 +1,213 @@
+package climg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+var (
+	// ErrNotFound is returned for picture IDs missing from the archive or
+	// whose bitmap or color table is missing.
+	ErrNotFound = errors.New("climg: picture not found")
+	// ErrChecksum is returned when VerifyChecksums is set and a picture's
+	// data does not match the checksum stored with it.
+	ErrChecksum = errors.New("climg: checksum mismatch")
+)
+
+// indexedPict is a picture decoded to color table indices.
+type indexedPict struct {
+	width, height int
+	pix           []byte // one index per pixel, custom color row removed
+	mapping       []byte // color table slots the custom colors replace
+	flags         uint32
+}
+
+// decodeIndexed reads the run-length encoded bitmap of picture id.
+func (c *CLImages) decodeIndexed(id uint32) (*indexedPict, error) {
+	ref := c.idrefs[id]
+	if ref == nil {
+		return nil, ErrNotFound
+	}
+	imgLoc := c.images[ref.imageID]
+	if imgLoc == nil {
+		return nil, ErrNotFound
+	}
+	r := bytes.NewReader(c.data)
+	if _, err := r.Seek(int64(imgLoc.offset), io.SeekStart); err != nil {
+		return nil, fmt.Errorf("seek image %d: %w", id, err)
+	}
+	var hdr struct {
+		H, W uint16
+		Pad  uint32
+		V, B byte
+	}
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("read header for %d: %w", id, err)
+	}
+
+	width := int(hdr.W)
+	height := int(hdr.H)
+	valueW := int(hdr.V)
+	blockLenW := int(hdr.B)
+	pixelCount := width * height
+	br := New(r)
+	data := make([]byte, pixelCount)
+	pixPos := 0
+	for pixPos < pixelCount {
+		t, err := br.ReadBit()
+		if err != nil {
+			return nil, fmt.Errorf("read bit for %d: %w", id, err)
+		}
+		s, err := br.ReadInt(blockLenW)
+		if err != nil {
+			return nil, fmt.Errorf("read int for %d: %w", id, err)
+		}
+		s++
+		if t {
+			for i := 0; i < s && pixPos < pixelCount; i++ {
+				val, err := br.ReadBits(valueW)
+				if err != nil {
+					return nil, fmt.Errorf("read bits for %d: %w", id, err)
+				}
+				data[pixPos] = val
+				pixPos++
+			}
+		} else {
+			val, err := br.ReadBits(valueW)
+			if err != nil {
+				return nil, fmt.Errorf("read bits for %d: %w", id, err)
+			}
+			for i := 0; i < s && pixPos < pixelCount; i++ {
+				data[pixPos] = val
+				pixPos++
+			}
+		}
+	}
+
+	p := &indexedPict{width: width, height: height, pix: data, flags: ref.flags}
+	if ref.flags&pictDefCustomColors != 0 && len(data) >= width {
+		p.mapping = data[:width]
+		p.pix = data[width:]
+		p.height--
+	}
+	return p, nil
+}
+
+// VerifyChecksum checks picture id against the checksum stored with it.
+// Pictures without one, or flagged to skip it, always pass.
+func (c *CLImages) VerifyChecksum(id uint32) error {
+	ref := c.idrefs[id]
+	if ref == nil {
+		return ErrNotFound
+	}
+	if ref.checksum == 0 || ref.flags&pictDefFlagNoChecksum != 0 {
+		return nil
+	}
+	bits := c.entryData(c.images[ref.imageID])
+	colors := c.entryData(c.colors[ref.colorID])
+	if bits == nil || colors == nil {
+		return ErrNotFound
+	}
+	var light []byte
+	if ref.lightingID != 0 {
+		light = c.entryData(c.lights[uint32(ref.lightingID)])
+	}
+	if sum := calculateChecksum(bits, colors, light, ref); sum != ref.checksum {
+		return fmt.Errorf("%w for picture %d: have %08x want %08x", ErrChecksum, id, sum, ref.checksum)
+	}
+	return nil
+}
+
+// entryData returns the bytes of a keyfile entry, or nil if it is missing
+// or out of range.
+func (c *CLImages) entryData(loc *dataLocation) []byte {
+	if loc == nil {
+		return nil
+	}
+	end := int(loc.offset) + int(loc.size)
+	if end > len(c.data) {
+		return nil
+	}
+	return c.data[loc.offset:end]
+}
+
+// DecodeRGBA decodes picture id to an image with alpha-premultiplied
+// pixels, all animation frames stacked top to bottom. custom replaces the
+// picture's customizable colors with palette indices, as the server sends
+// them for mobiles. Transparency and blending follow the picture's flags,
+// and Denoise and VerifyChecksums apply. It needs no graphics context.
+func (c *CLImages) DecodeRGBA(id uint32, custom []byte) (*image.RGBA, error) {
+	img, err := c.decodeRGBA(id, custom, false)
+	if err != nil {
+		return nil, err
+	}
+	w, h := img.Bounds().Dx()-2, img.Bounds().Dy()-2
+	return img.SubImage(image.Rect(0, 0, w, h)).(*image.RGBA), nil
+}
+
+// decodeRGBA decodes picture id with a one pixel transparent border, its
+// bounds starting at (-1, -1). The border keeps sprite edges clean when
+// scaled and lets the denoiser reach the outermost pixels.
+func (c *CLImages) decodeRGBA(id uint32, custom []byte, forceTransparent bool) (*image.RGBA, error) {
+	if c.VerifyChecksums {
+		if err := c.VerifyChecksum(id); err != nil {
+			return nil, err
+		}
+	}
+	p, err := c.decodeIndexed(id)
+	if err != nil {
+		return nil, err
+	}
+	colLoc := c.colors[c.idrefs[id].colorID]
+	if colLoc == nil {
+		return nil, ErrNotFound
+	}
+
+	pal := palette // from palette.go
+	col := append([]uint16(nil), colLoc.colorBytes...)
+	if len(custom) > 0 {
+		applyCustomPalette(col, p.mapping, custom)
+	}
+	width, height := p.width, p.height
+	img := image.NewRGBA(image.Rect(-1, -1, width+1, height+1))
+
+	// Determine alpha level and transparency handling based on
+	// sprite definition flags. Some assets (like mobiles) rely on
+	// index 0 being transparent even without the explicit flag, so
+	// allow callers to force this behavior.
+	alpha, transparent := alphaTransparentForFlags(p.flags)
+	if forceTransparent {
+		transparent = true
+	}
+
+	pix := img.Pix
+	stride := img.Stride
+	for i, v := range p.pix {
+		idx := col[v]
+		r := uint8(pal[idx*3])
+		g := uint8(pal[idx*3+1])
+		b := uint8(pal[idx*3+2])
+		a := alpha
+		if idx == 0 && transparent {
+			a = 0
+		}
+		// Image pixels are premultiplied by alpha.
+		r = uint8(int(r) * int(a) / 255)
+		g = uint8(int(g) * int(a) / 255)
+		b = uint8(int(b) * int(a) / 255)
+		off := (i/width+1)*stride + (i%width+1)*4
+		pix[off+0] = r
+		pix[off+1] = g
+		pix[off+2] = b
+		pix[off+3] = a
+	}
+
+	if c.Denoise {
+		denoiseImage(img, c.DenoiseSharpness, c.DenoiseAmount)
+	}
+	return img, nil
+}
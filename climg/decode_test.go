@@ -0,0 +1,154 @@
+package climg
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"testing"
+)
+
+// testPicture builds an archive holding picture 7, whose pixels are
+// palette-table indices stored as one literal run.
+func testPicture(w, h int, pix []byte, flags uint32, colors []byte) *CLImages {
+	data := binary.BigEndian.AppendUint16(nil, uint16(h))
+	data = binary.BigEndian.AppendUint16(data, uint16(w))
+	data = append(data, 0, 0, 0, 0, 8, 8) // pad, value bits, run length bits
+	var bits []byte
+	n := 0
+	put := func(v, width int) {
+		for i := width - 1; i >= 0; i-- {
+			if n%8 == 0 {
+				bits = append(bits, 0)
+			}
+			if v>>i&1 != 0 {
+				bits[len(bits)-1] |= 0x80 >> (n % 8)
+			}
+			n++
+		}
+	}
+	put(1, 1)
+	put(len(pix)-1, 8)
+	for _, p := range pix {
+		put(int(p), 8)
+	}
+	data = append(data, bits...)
+	colLoc := &dataLocation{offset: uint32(len(data)), size: uint32(len(colors))}
+	for _, c := range colors {
+		colLoc.colorBytes = append(colLoc.colorBytes, uint16(c))
+	}
+	data = append(data, colors...)
+	return &CLImages{
+		data:   data,
+		idrefs: map[uint32]*dataLocation{7: {id: 7, imageID: 1, colorID: 2, flags: flags}},
+		images: map[uint32]*dataLocation{1: {size: uint32(colLoc.offset)}},
+		colors: map[uint32]*dataLocation{2: colLoc},
+	}
+}
+
+func rgbaAt(img *image.RGBA, x, y int) [4]uint8 {
+	c := img.RGBAAt(x, y)
+	return [4]uint8{c.R, c.G, c.B, c.A}
+}
+
+func paletteRGB(idx int) [3]uint8 {
+	return [3]uint8{uint8(palette[idx*3]), uint8(palette[idx*3+1]), uint8(palette[idx*3+2])}
+}
+
+func TestDecodeRGBA(t *testing.T) {
+	c := testPicture(2, 2, []byte{0, 1, 2, 1}, pictDefFlagTransparent, []byte{0, 5, 215})
+	img, err := c.DecodeRGBA(7, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 2, 2) {
+		t.Fatalf("bounds %v", img.Bounds())
+	}
+	if got := rgbaAt(img, 0, 0); got[3] != 0 {
+		t.Errorf("index 0 not transparent: %v", got)
+	}
+	p := paletteRGB(5)
+	if got, want := rgbaAt(img, 1, 0), [4]uint8{p[0], p[1], p[2], 0xff}; got != want {
+		t.Errorf("pixel (1,0) = %v, want %v", got, want)
+	}
+	p = paletteRGB(215)
+	if got, want := rgbaAt(img, 0, 1), [4]uint8{p[0], p[1], p[2], 0xff}; got != want {
+		t.Errorf("pixel (0,1) = %v, want %v", got, want)
+	}
+
+	if _, err := c.DecodeRGBA(8, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing picture: got %v", err)
+	}
+}
+
+func TestDecodeRGBABlendAndCustomColors(t *testing.T) {
+	// The first row maps the custom color slots to table entries 1 and 2.
+	pix := []byte{
+		1, 2,
+		1, 2,
+	}
+	c := testPicture(2, 2, pix, pictDefCustomColors|2, []byte{0, 5, 6})
+	img, err := c.DecodeRGBA(7, []byte{40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 2, 1) {
+		t.Fatalf("bounds %v, want the custom color row dropped", img.Bounds())
+	}
+	premul := func(v uint8) uint8 { return uint8(int(v) * 0x7f / 255) }
+	p := paletteRGB(40)
+	if got, want := rgbaAt(img, 0, 0), [4]uint8{premul(p[0]), premul(p[1]), premul(p[2]), 0x7f}; got != want {
+		t.Errorf("recolored pixel = %v, want %v", got, want)
+	}
+	p = paletteRGB(6)
+	if got, want := rgbaAt(img, 1, 0), [4]uint8{premul(p[0]), premul(p[1]), premul(p[2]), 0x7f}; got != want {
+		t.Errorf("unchanged slot = %v, want %v", got, want)
+	}
+	// The recoloring must not leak into the shared color table.
+	if c.colors[2].colorBytes[1] != 5 {
+		t.Errorf("color table modified")
+	}
+}
+
+func TestDecodeChecksum(t *testing.T) {
+	c := testPicture(1, 1, []byte{1}, 0, []byte{0, 5})
+	ref := c.idrefs[7]
+	ref.checksum = calculateChecksum(c.entryData(c.images[1]), c.entryData(c.colors[2]), nil, ref)
+	c.VerifyChecksums = true
+	if _, err := c.DecodeRGBA(7, nil); err != nil {
+		t.Fatalf("good checksum: %v", err)
+	}
+	ref.checksum ^= 1
+	if _, err := c.DecodeRGBA(7, nil); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("bad checksum: got %v", err)
+	}
+	ref.flags |= pictDefFlagNoChecksum
+	if _, err := c.DecodeRGBA(7, nil); err != nil {
+		t.Fatalf("checksum skipped by flag: %v", err)
+	}
+	ref.flags &^= pictDefFlagNoChecksum
+	c.VerifyChecksums = false
+	if _, err := c.DecodeRGBA(7, nil); err != nil {
+		t.Fatalf("checksum not requested: %v", err)
+	}
+}
+
+func TestIndexedQueries(t *testing.T) {
+	pix := []byte{
+		0, 0, 0, 0, 0,
+		0, 0, 0, 0, 1,
+	}
+	c := testPicture(5, 2, pix, pictDefFlagTransparent, []byte{0, 5})
+	if n := c.NonTransparentPixels(7); n != 1 {
+		t.Errorf("NonTransparentPixels = %d, want 1", n)
+	}
+	if c.HasOpaqueRect(7, image.Rect(0, 0, 4, 2)) {
+		t.Errorf("opaque pixel found outside it")
+	}
+	if !c.HasOpaqueRect(7, image.Rect(3, 1, 9, 9)) {
+		t.Errorf("opaque pixel not found")
+	}
+	m := c.AlphaMaskQuarter(7, false)
+	if m == nil || m.W != 2 || m.H != 1 || m.Opaque(0, 0) || !m.Opaque(1, 0) {
+		t.Errorf("mask %+v", m)
+	}
+}
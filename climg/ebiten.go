@@ -0,0 +1,58 @@
+//go:build !noebiten
+
+package climg
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// imageCache holds the Ebiten images Get has built.
+type imageCache struct {
+	cache map[string]*ebiten.Image
+}
+
+// Get returns an Ebiten image for the given picture ID. The custom slice
+// provides optional palette overrides. If forceTransparent is true, palette
+// index 0 is treated as fully transparent regardless of the sprite's
+// pictDef flags. The Macintosh client always rendered mobile sprites this
+// way, even when the transparency flag wasn't set. The image has a one
+// pixel transparent border around the picture.
+func (c *CLImages) Get(id uint32, custom []byte, forceTransparent bool) *ebiten.Image {
+	key := fmt.Sprintf("%d-%x-%t", id, custom, forceTransparent)
+	c.mu.Lock()
+	if img, ok := c.cache[key]; ok {
+		c.mu.Unlock()
+		return img
+	}
+	c.mu.Unlock()
+
+	img, err := c.decodeRGBA(id, custom, forceTransparent)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("decode image %d: %v", id, err)
+		}
+		return nil
+	}
+	eimg := newImageFromImage(img)
+	c.mu.Lock()
+	if c.cache == nil {
+		c.cache = make(map[string]*ebiten.Image)
+	}
+	c.cache[key] = eimg
+	c.mu.Unlock()
+	return eimg
+}
+
+// ClearCache removes all cached images so they will be reloaded on demand.
+func (c *CLImages) ClearCache() {
+	c.mu.Lock()
+	for _, img := range c.cache {
+		img.Deallocate()
+	}
+	c.cache = make(map[string]*ebiten.Image)
+	c.mu.Unlock()
+}
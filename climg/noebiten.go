@@ -0,0 +1,6 @@
+//go:build noebiten
+
+package climg
+
+// imageCache is empty when built without Ebiten; use DecodeRGBA.
+type imageCache struct{}
@@ -4,15 +4,27 @@ const (
 	maxMessages = 1000
 )
 
-var consoleLog = messageLog{max: maxMessages}
+// consoleMessage adds a console line to the focused session.
+func consoleMessage(msg string) { focusedSession().consoleMessage(msg) }
 
-func consoleMessage(msg string) {
+func (s *session) consoleMessage(msg string) { s.consoleBEPPMessage("", msg) }
+
+// consoleBEPPMessage adds a console line that arrived with the BEPP tag tag.
+func (s *session) consoleBEPPMessage(tag, msg string) {
 	if msg == "" {
 		return
 	}
 
-	consoleLog.Add(msg)
+	s.console.Add(msg)
+	if !s.isFocused() {
+		return
+	}
+	headlessEmit("console", msg)
+	if movieDumpText != nil {
+		movieDumpText("console", msg)
+	}
 	appendConsoleLog(msg)
+	s.recordHistory("console", tag, "", msg)
 
 	updateConsoleWindow()
 
@@ -24,5 +36,5 @@ func getConsoleMessages() []string {
 	if format == "" {
 		format = "3:04PM"
 	}
-	return consoleLog.Entries(format, gs.ConsoleTimestamps)
+	return focusedSession().console.Entries(format, gs.ConsoleTimestamps)
 }
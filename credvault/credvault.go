@@ -0,0 +1,265 @@
+// Package credvault encrypts saved credentials under a master passphrase.
+// Keys are derived with Argon2id and entries are sealed with
+// XChaCha20-Poly1305, each bound to a label such as the character name.
+// The header also carries an X25519 public key derived from the same
+// passphrase, so entries can be added while the vault is locked.
+package credvault
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Version is the vault format written by New.
+const Version = 1
+
+// Default Argon2id cost, the second recommended option of RFC 9106.
+const (
+	DefaultTime    = 3
+	DefaultMemory  = 64 * 1024 // KiB
+	DefaultThreads = 4
+)
+
+// Highest cost Unlock accepts from a header, so a tampered file cannot make
+// key derivation run for minutes or exhaust memory.
+const (
+	MaxTime    = 16
+	MaxMemory  = 1024 * 1024 // KiB
+	MaxThreads = 16
+)
+
+const (
+	saltLen    = 16
+	checkLabel = "credvault check"
+	// Entries sealed to the public key start with publicPrefix, which
+	// cannot occur in base64.
+	publicPrefix = "pub:"
+	publicInfo   = "credvault x25519"
+	sealInfo     = "credvault seal"
+)
+
+var (
+	// ErrWrongPassphrase is returned by Unlock when the passphrase does not
+	// match the one the vault was created with.
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	// ErrCorrupt is returned by Decrypt for entries that were modified or
+	// sealed under another label or vault.
+	ErrCorrupt = errors.New("entry is damaged or belongs to another vault")
+)
+
+// Header is the public part of a vault, stored next to the entries. It
+// holds everything needed to derive the key again, plus a sealed check
+// value used to verify the passphrase.
+type Header struct {
+	Version int    `json:"version"`
+	Salt    string `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Check   string `json:"check"`
+	Public  string `json:"public"`
+}
+
+// Vault is an unlocked vault.
+type Vault struct {
+	header  Header
+	key     []byte
+	private *ecdh.PrivateKey
+}
+
+// New creates a vault for passphrase with a fresh salt and the default cost.
+func New(passphrase string) (*Vault, error) {
+	if passphrase == "" {
+		return nil, errors.New("empty passphrase")
+	}
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	h := Header{
+		Version: Version,
+		Salt:    base64.StdEncoding.EncodeToString(salt),
+		Time:    DefaultTime,
+		Memory:  DefaultMemory,
+		Threads: DefaultThreads,
+	}
+	v, err := newVault(h, deriveKey(passphrase, salt, h))
+	if err != nil {
+		return nil, err
+	}
+	check, err := v.Encrypt([]byte(checkLabel), checkLabel)
+	if err != nil {
+		return nil, err
+	}
+	v.header.Check = check
+	return v, nil
+}
+
+// newVault derives the X25519 key pair from key and fills in the header's
+// public key.
+func newVault(h Header, key []byte) (*Vault, error) {
+	seed, err := hkdf.Key(sha256.New, key, nil, publicInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	h.Public = base64.StdEncoding.EncodeToString(priv.PublicKey().Bytes())
+	return &Vault{header: h, key: key, private: priv}, nil
+}
+
+// Unlock derives the key for h from passphrase and verifies it.
+func Unlock(h Header, passphrase string) (*Vault, error) {
+	if h.Version != Version {
+		return nil, fmt.Errorf("unsupported vault version %d", h.Version)
+	}
+	salt, err := base64.StdEncoding.DecodeString(h.Salt)
+	if err != nil || len(salt) < saltLen || h.Time == 0 || h.Memory == 0 || h.Threads == 0 {
+		return nil, errors.New("invalid vault header")
+	}
+	if h.Time > MaxTime || h.Memory > MaxMemory || h.Threads > MaxThreads {
+		return nil, fmt.Errorf("vault cost too high (time %d, memory %d KiB, threads %d)", h.Time, h.Memory, h.Threads)
+	}
+	v, err := newVault(h, deriveKey(passphrase, salt, h))
+	if err != nil {
+		return nil, err
+	}
+	// The check entry only opens with the right key.
+	if _, err := v.Decrypt(h.Check, checkLabel); err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	// A different public key was not written by this vault.
+	if h.Public != v.header.Public {
+		return nil, errors.New("vault public key does not match the passphrase")
+	}
+	return v, nil
+}
+
+func deriveKey(passphrase string, salt []byte, h Header) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, h.Time, h.Memory, h.Threads, chacha20poly1305.KeySize)
+}
+
+// Header returns the header to store with the vault's entries.
+func (v *Vault) Header() Header { return v.header }
+
+// Seal seals plaintext under label to the public key in h, for entries
+// added while the vault is locked. Only the unlocked vault's Decrypt opens
+// it.
+func (h Header) Seal(plaintext []byte, label string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(h.Public)
+	if err != nil {
+		return "", errors.New("invalid vault header")
+	}
+	pub, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return "", errors.New("invalid vault header")
+	}
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	shared, err := eph.ECDH(pub)
+	if err != nil {
+		return "", err
+	}
+	ephPub := eph.PublicKey().Bytes()
+	aead, err := sealAEAD(shared, ephPub, raw)
+	if err != nil {
+		return "", err
+	}
+	out := make([]byte, len(ephPub)+aead.NonceSize(), len(ephPub)+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	copy(out, ephPub)
+	nonce := out[len(ephPub):]
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	out = aead.Seal(out, nonce, plaintext, []byte(label))
+	return publicPrefix + base64.StdEncoding.EncodeToString(out), nil
+}
+
+// sealAEAD keys the cipher for an entry sealed to pub from an ephemeral
+// key whose public half is ephPub.
+func sealAEAD(shared, ephPub, pub []byte) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, shared, bytes.Join([][]byte{ephPub, pub}, nil), sealInfo, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.NewX(key)
+}
+
+// openPublic opens an entry produced by Header.Seal.
+func (v *Vault) openPublic(sealed, label string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, publicPrefix))
+	const keyLen = 32
+	if err != nil || len(b) < keyLen+chacha20poly1305.NonceSizeX+chacha20poly1305.Overhead {
+		return nil, ErrCorrupt
+	}
+	ephPub, err := ecdh.X25519().NewPublicKey(b[:keyLen])
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	shared, err := v.private.ECDH(ephPub)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	aead, err := sealAEAD(shared, b[:keyLen], v.private.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	nonce, ct := b[keyLen:keyLen+aead.NonceSize()], b[keyLen+aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ct, []byte(label))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return plain, nil
+}
+
+// Encrypt seals plaintext under label and returns it base64 encoded.
+// Decrypt must be given the same label.
+func (v *Vault) Encrypt(plaintext []byte, label string) (string, error) {
+	aead, err := chacha20poly1305.NewX(v.key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(label))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens an entry produced by Encrypt or Header.Seal with the same
+// label.
+func (v *Vault) Decrypt(sealed, label string) ([]byte, error) {
+	if strings.HasPrefix(sealed, publicPrefix) {
+		return v.openPublic(sealed, label)
+	}
+	aead, err := chacha20poly1305.NewX(v.key)
+	if err != nil {
+		return nil, err
+	}
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(b) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrCorrupt
+	}
+	nonce, ct := b[:aead.NonceSize()], b[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ct, []byte(label))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return plain, nil
+}
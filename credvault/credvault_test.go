@@ -0,0 +1,119 @@
+package credvault
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	v, err := New("correct horse")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	sealed, err := v.Encrypt([]byte("0123456789abcdef"), "Hero")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	u, err := Unlock(v.Header(), "correct horse")
+	if err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	got, err := u.Decrypt(sealed, "Hero")
+	if err != nil || string(got) != "0123456789abcdef" {
+		t.Fatalf("Decrypt = %q, %v", got, err)
+	}
+	if again, _ := v.Encrypt([]byte("0123456789abcdef"), "Hero"); again == sealed {
+		t.Fatalf("nonce reused")
+	}
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	v, err := New("correct horse")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := Unlock(v.Header(), "battery staple"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("Unlock = %v, want ErrWrongPassphrase", err)
+	}
+	h := v.Header()
+	h.Version = 9
+	if _, err := Unlock(h, "correct horse"); err == nil {
+		t.Fatalf("unknown version accepted")
+	}
+	if _, err := New(""); err == nil {
+		t.Fatalf("empty passphrase accepted")
+	}
+}
+
+func TestUnlockCapsCost(t *testing.T) {
+	v, err := New("correct horse")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for _, tweak := range []func(*Header){
+		func(h *Header) { h.Time = MaxTime + 1 },
+		func(h *Header) { h.Memory = MaxMemory + 1 },
+		func(h *Header) { h.Threads = MaxThreads + 1 },
+	} {
+		h := v.Header()
+		tweak(&h)
+		if _, err := Unlock(h, "correct horse"); err == nil || errors.Is(err, ErrWrongPassphrase) {
+			t.Fatalf("Unlock(%+v) = %v, want a cost error", h, err)
+		}
+	}
+}
+
+func TestEntriesBoundToLabelAndVault(t *testing.T) {
+	v, _ := New("correct horse")
+	other, _ := New("correct horse")
+	sealed, _ := v.Encrypt([]byte("secret"), "Hero")
+
+	if _, err := v.Decrypt(sealed, "Villain"); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("other label = %v", err)
+	}
+	if _, err := other.Decrypt(sealed, "Hero"); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("other vault = %v", err)
+	}
+	b := []byte(sealed)
+	b[len(b)/2] ^= 1
+	if _, err := v.Decrypt(string(b), "Hero"); err == nil {
+		t.Fatalf("tampered entry opened")
+	}
+	if _, err := v.Decrypt("!!", "Hero"); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("bad base64 = %v", err)
+	}
+}
+
+func TestSealWhileLocked(t *testing.T) {
+	v, err := New("correct horse")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	h := v.Header()
+	sealed, err := h.Seal([]byte("0123456789abcdef"), "Hero")
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	u, err := Unlock(h, "correct horse")
+	if err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	got, err := u.Decrypt(sealed, "Hero")
+	if err != nil || string(got) != "0123456789abcdef" {
+		t.Fatalf("Decrypt = %q, %v", got, err)
+	}
+	if _, err := u.Decrypt(sealed, "Villain"); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("other label = %v", err)
+	}
+	other, _ := New("correct horse")
+	if _, err := other.Decrypt(sealed, "Hero"); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("other vault = %v", err)
+	}
+
+	swapped := h
+	swapped.Public = other.Header().Public
+	if _, err := Unlock(swapped, "correct horse"); err == nil {
+		t.Fatalf("foreign public key accepted")
+	}
+}
@@ -131,7 +131,7 @@ BEPP tag reference (two-letter codes following the 0xC2 prefix):
 | wh  | who list            |
 | yk  | you killed          |
 */
-func decodeBEPP(data []byte) string {
+func (s *session) decodeBEPP(data []byte) string {
 	if len(data) < 3 || data[0] != 0xC2 {
 		return ""
 	}
@@ -167,51 +167,68 @@ func decodeBEPP(data []byte) string {
 			return "info: " + text
 		}
 	case "sh", "su":
-		parseShareText(raw, text)
+		s.parseShareText(raw, text)
 		if text != "" {
 			return text
 		}
 	case "hf", "nf":
 		// Fallen or not-fallen notices
-		parseFallenText(raw, text)
+		s.parseFallenText(raw, text)
 		if text != "" {
 			return text
 		}
 	case "ba", "mu":
 		// Bard guild messages or tunes
-		handled := parseBardText(raw, text)
+		handled := s.parseBardText(raw, text)
 		if !handled && text != "" {
 			return text
 		}
 	case "lg", "lf", "er":
 		// Login/logout presence notices and error messages like
 		// "<name> is not in the lands." which imply logoff
-		parsePresenceText(raw, text)
+		s.parsePresenceText(raw, text)
 		if text != "" {
 			return text
 		}
 	case "be":
 		// Back-end command: handle internally using raw (unstripped) data.
-		parseBackend(raw)
+		s.parseBackend(raw)
 		return ""
 	case "kr":
 		// Karma received: suppress notifications from blocked or ignored players.
 		name := utfFold(firstTagContent(raw, 'p', 'n'))
 		if name != "" {
-			playersMu.RLock()
-			p, ok := players[name]
+			s.playersMu.RLock()
+			p, ok := s.players[name]
 			blocked := ok && (p.Blocked || p.Ignored)
-			playersMu.RUnlock()
+			s.playersMu.RUnlock()
 			if blocked {
 				return ""
 			}
 		}
+		s.emitKarmaEvent(name, text, true)
+		s.recordStat(statEvent{Kind: statKarma, Name: name, Received: true, Bad: isBadKarma(text)})
 		if text != "" {
 			return text
 		}
-	case "yk", "iv", "hp", "cf", "pn", "ka", "tl":
+	case "ka":
+		// Karma given or other karma notices.
+		name := utfFold(firstTagContent(raw, 'p', 'n'))
+		s.emitKarmaEvent(name, text, false)
+		s.recordStat(statEvent{Kind: statKarma, Name: name, Bad: isBadKarma(text)})
+		if text != "" {
+			return text
+		}
+	case "yk":
+		// You killed or helped kill a monster.
+		monster, helped := parseKillText(raw, text)
+		s.recordStat(statEvent{Kind: statKill, Name: monster, Helped: helped})
+		if text != "" {
+			return text
+		}
+	case "iv", "hp", "cf", "pn", "tl":
 		// Known simple pass-through prefixes (e.g., iv: item/verb,
-		// ka: karma, tl: text log only)
+		// tl: text log only)
 		if text != "" {
 			return text
 		}
@@ -292,7 +309,7 @@ func parseThinkText(raw []byte, text string) (name string, target thinkTarget, m
 	return
 }
 
-func decodeBubble(data []byte) (verb, text, name, lang string, code uint8, bubbleType int, target thinkTarget) {
+func (s *session) decodeBubble(data []byte) (verb, text, name, lang string, code uint8, bubbleType int, target thinkTarget) {
 	if len(data) < 2 {
 		return "", "", "", "", kBubbleCodeKnown, kBubbleNormal, thinkNone
 	}
@@ -332,17 +349,17 @@ func decodeBubble(data []byte) (verb, text, name, lang string, code uint8, bubbl
 		if len(ln) == 0 {
 			continue
 		}
-		s := strings.TrimSpace(decodeMacRoman(ln))
-		if s == "" {
+		line := strings.TrimSpace(decodeMacRoman(ln))
+		if line == "" {
 			continue
 		}
-		if parseNightCommand(s) {
+		if s.parseNightCommand(line) {
 			continue
 		}
 		if text == "" {
-			text = s
+			text = line
 		} else {
-			text += " " + s
+			text += " " + line
 		}
 	}
 	if code != kBubbleCodeKnown && bubbleType != kBubbleYell {
@@ -386,20 +403,20 @@ func decodeBubble(data []byte) (verb, text, name, lang string, code uint8, bubbl
 // decodeMessage extracts printable text from a raw server message. It operates
 // directly on m[16:], which may be modified during decoding (e.g., when
 // decrypting).
-func decodeMessage(m []byte) string {
+func (s *session) decodeMessage(m []byte) string {
 	if len(m) <= 16 {
 		return ""
 	}
 	data := m[16:]
 	for attempt := 0; attempt < 2; attempt++ {
 		if len(data) > 0 && data[0] == 0xC2 {
-			if s := decodeBEPP(data); s != "" {
-				return s
+			if txt := s.decodeBEPP(data); txt != "" {
+				return txt
 			}
 			return ""
 		}
-		if _, s, _, _, _, _, _ := decodeBubble(data); s != "" {
-			return s
+		if _, txt, _, _, _, _, _ := s.decodeBubble(data); txt != "" {
+			return txt
 		}
 		if i := bytes.IndexByte(data, 0); i >= 0 {
 			data = data[:i]
@@ -417,48 +434,48 @@ func decodeMessage(m []byte) string {
 	return ""
 }
 
-func handleInfoText(data []byte) {
+func (s *session) handleInfoText(data []byte) {
 	for _, line := range bytes.Split(data, []byte{'\r'}) {
 		if len(line) == 0 {
 			continue
 		}
 		if line[0] == 0xC2 {
-			if txt := decodeBEPP(line); txt != "" {
-				consoleMessage(txt)
+			if txt := s.decodeBEPP(line); txt != "" {
+				s.consoleBEPPMessage(string(line[1:3]), txt)
 			}
 			continue
 		}
-		if _, txt, _, _, _, bubbleType, _ := decodeBubble(line); txt != "" {
+		if _, txt, _, _, _, bubbleType, _ := s.decodeBubble(line); txt != "" {
 			if isChatBubble(bubbleType) {
 				if gs.MessagesToConsole {
-					consoleMessage(txt)
+					s.consoleMessage(txt)
 				} else {
-					chatMessage(txt)
+					s.chatMessage(txt)
 				}
 			} else {
-				consoleMessage(txt)
+				s.consoleMessage(txt)
 			}
 			continue
 		}
-		s := strings.TrimSpace(decodeMacRoman(stripBEPPTags(line)))
-		if s == "" {
+		text := strings.TrimSpace(decodeMacRoman(stripBEPPTags(line)))
+		if text == "" {
 			continue
 		}
-		if parseNightCommand(s) {
+		if s.parseNightCommand(text) {
 			continue
 		}
 		// Empirical: classic client handles server-sent info-text music commands
 		// like "/music/..." here. Accept only this canonical prefix from
 		// info-text (not bubbles), and otherwise avoid parsing plain text.
-		if strings.HasPrefix(s, "/music/") {
-			if parseMusicCommand(s, line) {
+		if strings.HasPrefix(text, "/music/") {
+			if s.parseMusicCommand(text, line) {
 				continue
 			}
 		}
 		// Ignore other command-like lines.
-		if strings.HasPrefix(s, "/") {
+		if strings.HasPrefix(text, "/") {
 			continue
 		}
-		consoleMessage(s)
+		s.consoleMessage(text)
 	}
 }
@@ -557,8 +557,8 @@ var drawStateEncrypted = false
 // When buildCache is false, the draw state is parsed without rebuilding the
 // render cache. This is useful for fast-forward operations where intermediate
 // frames do not need a fully prepared cache.
-func handleDrawState(m []byte, buildCache bool) {
-	frameCounter++
+func (s *session) handleDrawState(m []byte, buildCache bool) {
+	s.frameCounter++
 
 	if len(m) < 11 { // 2 byte tag + 9 bytes minimum
 		return
@@ -568,13 +568,13 @@ func handleDrawState(m []byte, buildCache bool) {
 	if drawStateEncrypted {
 		simpleEncrypt(data)
 	}
-	if err := parseDrawState(data, buildCache); err != nil {
+	if err := s.parseDrawState(data, buildCache); err != nil {
 		logDebugPacket(fmt.Sprintf("parseDrawState error: %v", err), data)
 	}
 }
 
 // handleInvCmdFull resets and rebuilds the inventory from a full list command.
-func handleInvCmdFull(data []byte) ([]byte, bool) {
+func (s *session) handleInvCmdFull(data []byte) ([]byte, bool) {
 	if len(data) < 1 {
 		logError("inventory: full cmd missing count")
 		return nil, false
@@ -601,12 +601,13 @@ func handleInvCmdFull(data []byte) ([]byte, bool) {
 			eq[i] = true
 		}
 	}
-	setFullInventory(ids, eq)
+	s.setFullInventory(ids, eq)
+	s.emitInventoryEvent("full", 0, -1, "")
 	return data[bytesNeeded:], true
 }
 
 // handleInvCmdOther interprets add/delete/equip/name inventory commands.
-func handleInvCmdOther(cmd int, data []byte) ([]byte, bool) {
+func (s *session) handleInvCmdOther(cmd int, data []byte) ([]byte, bool) {
 	logDebug("inventory cmd=%v data=%v", cmd, data)
 
 	base := cmd &^ kInvCmdIndex
@@ -643,28 +644,38 @@ func handleInvCmdOther(cmd int, data []byte) ([]byte, bool) {
 		name = strings.TrimSpace(decodeMacRoman(raw))
 		data = data[nidx+1:]
 	}
+	var action string
 	switch base {
 	case kInvCmdAdd:
-		addInventoryItem(id, idx, name, false)
+		s.addInventoryItem(id, idx, name, false)
+		action = "add"
 	case kInvCmdAddEquip:
-		addInventoryItem(id, idx, name, true)
+		s.addInventoryItem(id, idx, name, true)
+		action = "add"
 	case kInvCmdDelete:
-		removeInventoryItem(id, idx)
+		s.removeInventoryItem(id, idx)
+		action = "remove"
 	case kInvCmdEquip:
-		equipInventoryItem(id, idx, true)
+		s.equipInventoryItem(id, idx, true)
+		action = "equip"
 	case kInvCmdUnequip:
-		equipInventoryItem(id, idx, false)
+		s.equipInventoryItem(id, idx, false)
+		action = "unequip"
 	case kInvCmdName:
-		renameInventoryItem(id, idx, name)
+		s.renameInventoryItem(id, idx, name)
+		action = "rename"
 	default:
 		logError("inventory: unknown command %v", cmd)
 	}
+	if action != "" {
+		s.emitInventoryEvent(action, id, idx, name)
+	}
 	return data, true
 }
 
 // parseInventory walks the inventory command stream and returns the remaining
 // slice and success flag.
-func parseInventory(data []byte) ([]byte, bool) {
+func (s *session) parseInventory(data []byte) ([]byte, bool) {
 	if len(data) == 0 {
 		return data, true
 	}
@@ -690,7 +701,7 @@ func parseInventory(data []byte) ([]byte, bool) {
 		case kInvCmdFull:
 			var ok bool
 			before := data
-			data, ok = handleInvCmdFull(data)
+			data, ok = s.handleInvCmdFull(data)
 			if !ok {
 				logDebug("inventory: cmd %#x failed at %d/%d rem=% x", cmd, i+1, cmdCount, before)
 				return nil, false
@@ -706,7 +717,7 @@ func parseInventory(data []byte) ([]byte, bool) {
 		default:
 			var ok bool
 			before := data
-			data, ok = handleInvCmdOther(cmd, data)
+			data, ok = s.handleInvCmdOther(cmd, data)
 			if !ok {
 				logDebug("inventory: cmd %#x failed at %d/%d rem=% x", cmd, i+1, cmdCount, before)
 				return nil, false
@@ -751,20 +762,20 @@ func parseInventory(data []byte) ([]byte, bool) {
 //
 // When buildCache is false, state is updated without rebuilding the render
 // cache.
-func parseDrawState(data []byte, buildCache bool) error {
+func (s *session) parseDrawState(data []byte, buildCache bool) error {
 	stage := "header"
 	if len(data) < 9 {
 		return errors.New(stage)
 	}
 
 	ackCmd := data[0]
-	ackFrame = int32(binary.BigEndian.Uint32(data[1:5]))
-	resendFrame = int32(binary.BigEndian.Uint32(data[5:9]))
+	s.ackFrame = int32(binary.BigEndian.Uint32(data[1:5]))
+	s.resendFrame = int32(binary.BigEndian.Uint32(data[5:9]))
 	dropped := 0
 	if movieMode {
 		dropped = movieDropped
 	} else {
-		dropped = updateFrameCounters(ackFrame)
+		dropped = s.updateFrameCounters(s.ackFrame)
 	}
 	extra := dropped
 	if extra > 2 {
@@ -795,8 +806,8 @@ func parseDrawState(data []byte, buildCache bool) error {
 		if idx := bytes.IndexByte(data[p:], 0); idx >= 0 {
 			d.Name = utfFold(decodeMacRoman(data[p : p+idx]))
 			p += idx + 1
-			if d.Name == playerName {
-				playerIndex = d.Index
+			if d.Name == s.playerName {
+				s.playerIndex = d.Index
 			}
 		} else {
 			return errors.New(stage)
@@ -819,9 +830,9 @@ func parseDrawState(data []byte, buildCache bool) error {
 		// avoid side effects during playback.
 		if d.Type != kDescNPC && d.Name != "" {
 			if !movieMode {
-				updatePlayerAppearance(d.Name, d.PictID, d.Colors, false)
+				s.updatePlayerAppearance(d.Name, d.PictID, d.Colors, false)
 				// Opportunistically request full info for visible players.
-				queueInfoRequest(d.Name)
+				s.queueInfoRequest(d.Name)
 			}
 		}
 		descs = append(descs, d)
@@ -838,7 +849,7 @@ func parseDrawState(data []byte, buildCache bool) error {
 	bal := int(data[p+4])
 	balMax := int(data[p+5])
 	lighting := data[p+6]
-	gNight.SetFlags(uint(lighting))
+	s.night.SetFlags(uint(lighting), s.frameCounter)
 	p += 7
 
 	stage = "picture count"
@@ -928,49 +939,49 @@ func parseDrawState(data []byte, buildCache bool) error {
 	}
 	stateData := data[p : p+stateLen]
 
-	stateMu.Lock()
-	state.ackCmd = ackCmd
-	state.dropped = extra
-	state.lightingFlags = lighting
-	state.prevHP = state.hp
-	state.prevHPMax = state.hpMax
-	state.prevSP = state.sp
-	state.prevSPMax = state.spMax
-	state.prevBalance = state.balance
-	state.prevBalanceMax = state.balanceMax
-	state.hp = hp
-	state.hpMax = hpMax
-	state.sp = sp
-	state.spMax = spMax
-	state.balance = bal
-	state.balanceMax = balMax
+	s.stateMu.Lock()
+	s.state.ackCmd = ackCmd
+	s.state.dropped = extra
+	s.state.lightingFlags = lighting
+	s.state.prevHP = s.state.hp
+	s.state.prevHPMax = s.state.hpMax
+	s.state.prevSP = s.state.sp
+	s.state.prevSPMax = s.state.spMax
+	s.state.prevBalance = s.state.balance
+	s.state.prevBalanceMax = s.state.balanceMax
+	s.state.hp = hp
+	s.state.hpMax = hpMax
+	s.state.sp = sp
+	s.state.spMax = spMax
+	s.state.balance = bal
+	s.state.balanceMax = balMax
 	changed := false
 	if gs.BlendMobiles && !seekingMov {
 		if len(descs) > 0 {
 			changed = true
 		}
-		if len(mobiles) != len(state.mobiles) {
+		if len(mobiles) != len(s.state.mobiles) {
 			changed = true
 		} else {
 			for _, m := range mobiles {
-				if pm, ok := state.mobiles[m.Index]; !ok || pm.State != m.State {
+				if pm, ok := s.state.mobiles[m.Index]; !ok || pm.State != m.State {
 					changed = true
 					break
 				}
 			}
 		}
 		if changed {
-			if state.prevDescs == nil {
-				state.prevDescs = make(map[uint8]frameDescriptor)
+			if s.state.prevDescs == nil {
+				s.state.prevDescs = make(map[uint8]frameDescriptor)
 			}
-			state.prevDescs = make(map[uint8]frameDescriptor, len(state.descriptors))
-			for idx, d := range state.descriptors {
-				state.prevDescs[idx] = d
+			s.state.prevDescs = make(map[uint8]frameDescriptor, len(s.state.descriptors))
+			for idx, d := range s.state.descriptors {
+				s.state.prevDescs[idx] = d
 			}
 		}
 	}
 	// retain previously drawn pictures when the packet specifies pictAgain
-	prevPics := state.pictures
+	prevPics := s.state.pictures
 	again := pictAgain
 	if again > len(prevPics) {
 		again = len(prevPics)
@@ -995,32 +1006,32 @@ func parseDrawState(data []byte, buildCache bool) error {
 			}
 		}
 		if ok {
-			state.picShiftX = dx
-			state.picShiftY = dy
+			s.state.picShiftX = dx
+			s.state.picShiftY = dy
 		} else {
-			state.picShiftX = 0
-			state.picShiftY = 0
+			s.state.picShiftX = 0
+			s.state.picShiftY = 0
 		}
 	} else {
-		state.picShiftX = 0
-		state.picShiftY = 0
+		s.state.picShiftX = 0
+		s.state.picShiftY = 0
 	}
 	if !ok {
 		prevPics = nil
 		again = 0
 		newPics = append([]framePicture(nil), pics...)
-		state.prevDescs = nil
-		state.prevMobiles = nil
-		state.prevPictures = nil
-		state.prevTime = time.Time{}
-		state.curTime = time.Time{}
+		s.state.prevDescs = nil
+		s.state.prevMobiles = nil
+		s.state.prevPictures = nil
+		s.state.prevTime = time.Time{}
+		s.state.curTime = time.Time{}
 		logDebug("pictureShift failed; bypassing interpolation")
 	}
-	if state.descriptors == nil {
-		state.descriptors = make(map[uint8]frameDescriptor)
+	if s.state.descriptors == nil {
+		s.state.descriptors = make(map[uint8]frameDescriptor)
 	}
 	for _, d := range descs {
-		state.descriptors[d.Index] = d
+		s.state.descriptors[d.Index] = d
 	}
 	for i := range prevPics {
 		prevPics[i].Owned = false
@@ -1030,8 +1041,8 @@ func parseDrawState(data []byte, buildCache bool) error {
 			newPics[i].PrevH = newPics[i].H
 			newPics[i].PrevV = newPics[i].V
 		} else {
-			newPics[i].PrevH = int16(int(newPics[i].H) - state.picShiftX)
-			newPics[i].PrevV = int16(int(newPics[i].V) - state.picShiftY)
+			newPics[i].PrevH = int16(int(newPics[i].H) - s.state.picShiftX)
+			newPics[i].PrevV = int16(int(newPics[i].V) - s.state.picShiftY)
 		}
 		moving := true
 		var owner *framePicture
@@ -1045,8 +1056,8 @@ func parseDrawState(data []byte, buildCache bool) error {
 					continue
 				}
 				if pp.PictID == newPics[i].PictID &&
-					int(pp.H)+state.picShiftX == int(newPics[i].H) &&
-					int(pp.V)+state.picShiftY == int(newPics[i].V) {
+					int(pp.H)+s.state.picShiftX == int(newPics[i].H) &&
+					int(pp.V)+s.state.picShiftY == int(newPics[i].V) {
 					moving = false
 					owner = pp
 					break
@@ -1064,8 +1075,8 @@ func parseDrawState(data []byte, buildCache bool) error {
 				if pp.Owned || pp.PictID != newPics[i].PictID {
 					continue
 				}
-				dh := int(newPics[i].H) - int(pp.H) - state.picShiftX
-				dv := int(newPics[i].V) - int(pp.V) - state.picShiftY
+				dh := int(newPics[i].H) - int(pp.H) - s.state.picShiftX
+				dv := int(newPics[i].V) - int(pp.V) - s.state.picShiftY
 				dist := dh*dh + dv*dv
 				if dist < bestDist {
 					bestDist = dist
@@ -1089,11 +1100,14 @@ func parseDrawState(data []byte, buildCache bool) error {
 			newPics[idx].Background = true
 		}
 	}
+	if s.isFocused() {
+		autoMap.observe(newPics, dx, dy, ok)
+	}
 
 	// Carry over previous-frame ground sprites that are missing this frame.
 	// Advance them by the detected picture shift and keep them while visible
 	// to prevent flashes of black at the viewport edges during camera motion.
-	if (state.picShiftX != 0 || state.picShiftY != 0) && len(prevPics) > 0 {
+	if (s.state.picShiftX != 0 || s.state.picShiftY != 0) && len(prevPics) > 0 {
 		for _, pp := range prevPics {
 			if pp.Owned {
 				continue // already matched/present
@@ -1112,8 +1126,8 @@ func parseDrawState(data []byte, buildCache bool) error {
 				continue
 			}
 			// Advance by detected picture shift for this frame.
-			pp.H = int16(int(pp.H) + state.picShiftX)
-			pp.V = int16(int(pp.V) + state.picShiftY)
+			pp.H = int16(int(pp.H) + s.state.picShiftX)
+			pp.V = int16(int(pp.V) + s.state.picShiftY)
 			pp.PrevH = oldH
 			pp.PrevV = oldV
 			pp.Moving = false
@@ -1124,26 +1138,26 @@ func parseDrawState(data []byte, buildCache bool) error {
 	}
 
 	// Save previous pictures for pinning/interpolation decisions
-	state.prevPictures = append([]framePicture(nil), prevPics...)
-	state.pictures = newPics
+	s.state.prevPictures = append([]framePicture(nil), prevPics...)
+	s.state.pictures = newPics
 
 	needPrev := (gs.MotionSmoothing || gs.BlendMobiles) && !seekingMov && ok
 	if needPrev {
-		if state.prevMobiles == nil {
-			state.prevMobiles = make(map[uint8]frameMobile)
+		if s.state.prevMobiles == nil {
+			s.state.prevMobiles = make(map[uint8]frameMobile)
 		}
-		state.prevMobiles = make(map[uint8]frameMobile, len(state.mobiles))
-		for idx, m := range state.mobiles {
-			state.prevMobiles[idx] = m
+		s.state.prevMobiles = make(map[uint8]frameMobile, len(s.state.mobiles))
+		for idx, m := range s.state.mobiles {
+			s.state.prevMobiles[idx] = m
 		}
 	}
 	needAnimUpdate := (gs.MotionSmoothing || (gs.BlendMobiles && changed)) && ok && !seekingMov
 	if needAnimUpdate {
-		frameMu.Lock()
-		interval := frameInterval
-		frameMu.Unlock()
-		if !state.prevTime.IsZero() && !state.curTime.IsZero() {
-			if d := state.curTime.Sub(state.prevTime); d > 0 {
+		s.frameMu.Lock()
+		interval := s.frameInterval
+		s.frameMu.Unlock()
+		if !s.state.prevTime.IsZero() && !s.state.curTime.IsZero() {
+			if d := s.state.curTime.Sub(s.state.prevTime); d > 0 {
 				interval = d
 			}
 		}
@@ -1152,46 +1166,46 @@ func parseDrawState(data []byte, buildCache bool) error {
 		}
 		interval *= time.Duration(extra + 1)
 		//logDebug("interp mobiles interval=%v extra=%d", interval, extra)
-		state.prevTime = time.Now()
-		state.curTime = state.prevTime.Add(interval)
+		s.state.prevTime = time.Now()
+		s.state.curTime = s.state.prevTime.Add(interval)
 	}
 
 	// Carry over previous-frame mobiles that disappear at the edge to avoid
 	// premature culling from interpolation.
-	if len(state.mobiles) > 0 {
+	if len(s.state.mobiles) > 0 {
 		present := make(map[uint8]struct{}, len(mobiles))
 		for _, m := range mobiles {
 			present[m.Index] = struct{}{}
 		}
-		for idx, pm := range state.mobiles {
+		for idx, pm := range s.state.mobiles {
 			if pm.Persist {
 				continue
 			}
 			if _, ok := present[idx]; ok {
 				continue
 			}
-			if d, ok := state.descriptors[idx]; ok && mobileOnEdge(pm, d) {
-				pm.H = int16(int(pm.H) + state.picShiftX)
-				pm.V = int16(int(pm.V) + state.picShiftY)
+			if d, ok := s.state.descriptors[idx]; ok && mobileOnEdge(pm, d) {
+				pm.H = int16(int(pm.H) + s.state.picShiftX)
+				pm.V = int16(int(pm.V) + s.state.picShiftY)
 				pm.Persist = true
 				mobiles = append(mobiles, pm)
 			}
 		}
 	}
 
-	if state.mobiles == nil {
-		state.mobiles = make(map[uint8]frameMobile)
+	if s.state.mobiles == nil {
+		s.state.mobiles = make(map[uint8]frameMobile)
 	} else {
 		// clear map while keeping allocation
-		for k := range state.mobiles {
-			delete(state.mobiles, k)
+		for k := range s.state.mobiles {
+			delete(s.state.mobiles, k)
 		}
 	}
 	for _, m := range mobiles {
-		if d, ok := state.descriptors[m.Index]; ok && d.Name != "" {
+		if d, ok := s.state.descriptors[m.Index]; ok && d.Name != "" && !headless {
 			style := styleRegular
-			playersMu.RLock()
-			if p, ok := players[d.Name]; ok {
+			s.playersMu.RLock()
+			if p, ok := s.players[d.Name]; ok {
 				if p.Sharing && p.Sharee {
 					style = styleBoldItalic
 				} else if p.Sharing {
@@ -1200,7 +1214,7 @@ func parseDrawState(data []byte, buildCache bool) error {
 					style = styleItalic
 				}
 			}
-			playersMu.RUnlock()
+			s.playersMu.RUnlock()
 			key := nameTagKey{
 				Text:    d.Name,
 				Colors:  m.Colors,
@@ -1208,7 +1222,7 @@ func parseDrawState(data []byte, buildCache bool) error {
 				FontGen: fontGen,
 				Style:   style,
 			}
-			if prev, ok := state.mobiles[m.Index]; ok && prev.nameTag != nil && prev.nameTagKey == key {
+			if prev, ok := s.state.mobiles[m.Index]; ok && prev.nameTag != nil && prev.nameTagKey == key {
 				m.nameTag = prev.nameTag
 				m.nameTagW = prev.nameTagW
 				m.nameTagH = prev.nameTagH
@@ -1221,21 +1235,21 @@ func parseDrawState(data []byte, buildCache bool) error {
 				m.nameTagKey = key
 			}
 		}
-		state.mobiles[m.Index] = m
+		s.state.mobiles[m.Index] = m
 	}
 	// Populate prevMobiles only when pictureShift succeeds so interpolation of
 	// mobiles and pinned effects is skipped on failure.
 	// Prepare render caches now that state has been updated when requested.
 	if buildCache {
-		prepareRenderCacheLocked()
+		s.prepareRenderCacheLocked()
 	}
 	//ack := state.ackCmd
 	//light := state.lightingFlags
-	stateMu.Unlock()
+	s.stateMu.Unlock()
 
 	/*
 		logDebug("draw state cmd=%d ack=%d resend=%d light=%#x desc=%d pict=%d again=%d mobile=%d state=%d",
-			ack, ackFrame, resendFrame, light, len(descs), len(pics), pictAgain, len(mobiles), len(stateData))
+			ack, s.ackFrame, s.resendFrame, light, len(descs), len(pics), pictAgain, len(mobiles), len(stateData))
 	*/
 
 	stage = "info strings"
@@ -1248,7 +1262,7 @@ func parseDrawState(data []byte, buildCache bool) error {
 	}
 	if idx := bytes.IndexByte(stateData, 0); idx >= 0 {
 		if idx > 0 {
-			handleInfoText(stateData[:idx])
+			s.handleInfoText(stateData[:idx])
 		}
 		stateData = stateData[idx+1:]
 	} else {
@@ -1261,7 +1275,7 @@ func parseDrawState(data []byte, buildCache bool) error {
 		// Treat preceding bytes as another info text C string.
 		if idx := bytes.IndexByte(stateData, 0); idx >= 0 {
 			if idx > 0 {
-				handleInfoText(stateData[:idx])
+				s.handleInfoText(stateData[:idx])
 			}
 			stateData = stateData[idx+1:]
 			continue
@@ -1311,14 +1325,14 @@ func parseDrawState(data []byte, buildCache bool) error {
 			return fmt.Errorf("bubble=%d off=%d len=%d", i, off, len(stateData))
 		}
 		bubbleData := stateData[:p+end+1]
-		if verb, txt, bubbleName, lang, code, bubbleType, target := decodeBubble(bubbleData); txt != "" || code != kBubbleCodeKnown {
+		if verb, txt, bubbleName, lang, code, bubbleType, target := s.decodeBubble(bubbleData); txt != "" || code != kBubbleCodeKnown {
 			name := bubbleName
 			if target == thinkNone {
 				if bubbleName == ThinkUnknownName {
 					name = "Someone"
 				} else {
-					stateMu.Lock()
-					if d, ok := state.descriptors[idx]; ok {
+					s.stateMu.Lock()
+					if d, ok := s.state.descriptors[idx]; ok {
 						if bubbleName != "" {
 							if d.Name != "" {
 								name = d.Name
@@ -1330,28 +1344,28 @@ func parseDrawState(data []byte, buildCache bool) error {
 							name = d.Name
 						}
 					}
-					stateMu.Unlock()
+					s.stateMu.Unlock()
 				}
 			} else if bubbleName == ThinkUnknownName {
 				name = "Someone"
 			}
-			if verb == "thinks" && idx == playerIndex && bubbleName != "" {
-				stateMu.Lock()
-				for i, d := range state.descriptors {
+			if verb == "thinks" && idx == s.playerIndex && bubbleName != "" {
+				s.stateMu.Lock()
+				for i, d := range s.state.descriptors {
 					if d.Name == bubbleName {
 						idx = i
 						break
 					}
 				}
-				stateMu.Unlock()
+				s.stateMu.Unlock()
 			}
 			skipRender := false
 			if name != "" {
-				playersMu.RLock()
-				if p, ok := players[name]; ok && (p.Blocked || p.Ignored) {
+				s.playersMu.RLock()
+				if p, ok := s.players[name]; ok && (p.Blocked || p.Ignored) {
 					skipRender = true
 				}
-				playersMu.RUnlock()
+				s.playersMu.RUnlock()
 			}
 			showBubble := gs.SpeechBubbles && txt != "" && !blockBubbles && verb != "thinks"
 			if showBubble && !skipRender {
@@ -1378,7 +1392,7 @@ func parseDrawState(data []byte, buildCache bool) error {
 				}
 				originOK := true
 				switch {
-				case idx == playerIndex:
+				case idx == s.playerIndex:
 					originOK = gs.BubbleSelf
 				case bubbleType == kBubbleMonster:
 					originOK = gs.BubbleMonsters
@@ -1396,7 +1410,7 @@ func parseDrawState(data []byte, buildCache bool) error {
 				if life < 1 {
 					life = 1
 				}
-				b := bubble{Index: idx, Text: txt, Type: typ, CreatedFrame: frameCounter, LifeFrames: life}
+				b := bubble{Index: idx, Text: txt, Type: typ, CreatedFrame: s.frameCounter, LifeFrames: life}
 				switch bubbleType {
 				case kBubbleRealAction, kBubblePlayerAction, kBubbleNarrate:
 					b.NoArrow = true
@@ -1405,9 +1419,9 @@ func parseDrawState(data []byte, buildCache bool) error {
 					b.H, b.V = h, v
 					b.Far = true
 				}
-				stateMu.Lock()
-				state.bubbles = append(state.bubbles, b)
-				stateMu.Unlock()
+				s.stateMu.Lock()
+				s.state.bubbles = append(s.state.bubbles, b)
+				s.stateMu.Unlock()
 			}
 			var msg string
 			switch {
@@ -1434,7 +1448,7 @@ func parseDrawState(data []byte, buildCache bool) error {
 						default:
 							msg = fmt.Sprintf("%v thinks, %v", bubbleName, txt)
 						}
-						if !skipRender {
+						if !skipRender && s.isFocused() {
 							showThinkMessage(msg)
 						}
 					} else if typ&kBubbleNotCommon != 0 {
@@ -1484,9 +1498,9 @@ func parseDrawState(data []byte, buildCache bool) error {
 				}
 			}
 			if gs.MessagesToConsole || !isChatBubble(bubbleType) {
-				consoleMessage(msg)
+				s.consoleMessage(msg)
 			} else {
-				chatMessage(msg)
+				s.chatMessage(msg)
 			}
 		}
 		stateData = stateData[p+end+1:]
@@ -1511,7 +1525,7 @@ func parseDrawState(data []byte, buildCache bool) error {
 
 		if gs.throttleSounds {
 			var found bool
-			for _, item := range prevSounds {
+			for _, item := range s.prevSounds {
 				if item == id {
 					found = true
 					break
@@ -1521,7 +1535,7 @@ func parseDrawState(data []byte, buildCache bool) error {
 				continue
 			}
 
-			for _, item := range prev2Sounds {
+			for _, item := range s.prev2Sounds {
 				if item == id {
 					found = true
 					break
@@ -1545,12 +1559,14 @@ func parseDrawState(data []byte, buildCache bool) error {
 			newSounds = []uint16{id}
 		}
 	}
-	playSound(newSounds)
-	prev2Sounds = prevSounds
-	prevSounds = newSounds
+	if s.isFocused() {
+		playSound(newSounds)
+	}
+	s.prev2Sounds = s.prevSounds
+	s.prevSounds = newSounds
 
 	stage = "inventory"
-	parseInventory(stateData)
+	s.parseInventory(stateData)
 
 	return nil
 }
@@ -12,16 +12,21 @@ type WindowZoneState struct {
 	Zone  WindowZone
 }
 
+// ZoneState returns whether the window is zoned and its zone.
+func (win *windowData) ZoneState() WindowZoneState {
+	st := WindowZoneState{}
+	if win.zone != nil {
+		st.Zoned = true
+		st.Zone = WindowZone{H: win.zone.h, V: win.zone.v}
+	}
+	return st
+}
+
 // SaveWindowZones returns a table of window titles to their zone state.
 func SaveWindowZones() map[string]WindowZoneState {
 	table := make(map[string]WindowZoneState, len(windows))
 	for _, win := range windows {
-		st := WindowZoneState{}
-		if win.zone != nil {
-			st.Zoned = true
-			st.Zone = WindowZone{H: win.zone.h, V: win.zone.v}
-		}
-		table[win.Title] = st
+		table[win.Title] = win.ZoneState()
 	}
 	return table
 }
@@ -0,0 +1,504 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Flags for -export.
+var (
+	exportPath  string
+	exportStart int
+	exportEnd   int
+	exportFPS   int
+	exportScale int
+)
+
+// exportStep is one output frame: the number of movie frames processed
+// before rendering and the interpolation position toward the last one.
+type exportStep struct {
+	cur   int
+	alpha float64
+}
+
+// exportSchedule maps output frames at outFPS onto the movie frames
+// [start,end) recorded at movieFPS.
+func exportSchedule(start, end, movieFPS, outFPS int) []exportStep {
+	if end <= start || movieFPS < 1 || outFPS < 1 {
+		return nil
+	}
+	n := int(math.Ceil(float64(end-start) * float64(outFPS) / float64(movieFPS)))
+	steps := make([]exportStep, 0, n)
+	for i := 0; i < n; i++ {
+		pos := float64(start) + float64(i)*float64(movieFPS)/float64(outFPS)
+		f := math.Floor(pos)
+		steps = append(steps, exportStep{cur: int(f) + 1, alpha: pos - f})
+	}
+	return steps
+}
+
+// frameSink receives rendered frames; close finishes the output.
+type frameSink interface {
+	add(img *image.RGBA) error
+	close() error
+}
+
+// maxGIFFPS is the highest rate a GIF can play: frame delays are in
+// hundredths of a second, and viewers treat delays below 2 as "as fast as
+// possible" or slow them to 10.
+const maxGIFFPS = 50
+
+// newFrameSink picks the output format from the file extension: .gif and
+// .apng write one animated file of frames frames, .png writes a numbered
+// sequence. Frames are written as they arrive.
+func newFrameSink(path string, fps, frames int) (frameSink, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return &pngSequence{path: path}, nil
+	case ".gif":
+		if fps > maxGIFFPS {
+			return nil, fmt.Errorf("GIF cannot play faster than %dfps; lower -exportFPS or export .apng", maxGIFFPS)
+		}
+		return &gifSink{animFile: animFile{path: path}, fps: fps}, nil
+	case ".apng":
+		return &apngSink{animFile: animFile{path: path}, apng: apngWriter{frames: frames, fps: fps}}, nil
+	}
+	return nil, fmt.Errorf("unknown export format %q (use .png, .gif or .apng)", filepath.Ext(path))
+}
+
+// pngSequence writes clip.png as clip-00000.png, clip-00001.png, ...
+type pngSequence struct {
+	path string
+	n    int
+}
+
+func (s *pngSequence) framePath(i int) string {
+	ext := filepath.Ext(s.path)
+	return fmt.Sprintf("%s-%05d%s", strings.TrimSuffix(s.path, ext), i, ext)
+}
+
+func (s *pngSequence) add(img *image.RGBA) error {
+	f, err := os.Create(s.framePath(s.n))
+	if err != nil {
+		return err
+	}
+	s.n++
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *pngSequence) close() error { return nil }
+
+// animFile is the output file of an animated sink, created with the first
+// frame.
+type animFile struct {
+	path string
+	f    *os.File
+	w    *bufio.Writer
+}
+
+func (a *animFile) writer() (io.Writer, error) {
+	if a.w == nil {
+		f, err := os.Create(a.path)
+		if err != nil {
+			return nil, err
+		}
+		a.f, a.w = f, bufio.NewWriter(f)
+	}
+	return a.w, nil
+}
+
+// finish runs trailer, unless nothing was written, and closes the file.
+func (a *animFile) finish(trailer func(io.Writer) error) error {
+	if a.w == nil {
+		return errors.New("no frames to write")
+	}
+	err := trailer(a.w)
+	if ferr := a.w.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := a.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// gifSink writes frames dithered to the Plan 9 palette as a looping GIF.
+type gifSink struct {
+	animFile
+	fps  int
+	n    int
+	head []byte // header, screen descriptor and color table
+}
+
+func (s *gifSink) add(img *image.RGBA) error {
+	p := image.NewPaletted(img.Bounds(), palette.Plan9)
+	draw.FloydSteinberg.Draw(p, p.Rect, img, img.Rect.Min)
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, p, nil); err != nil {
+		return err
+	}
+	head, block, err := splitGIF(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	w, err := s.writer()
+	if err != nil {
+		return err
+	}
+	if s.n == 0 {
+		s.head = head
+		// The NETSCAPE2.0 extension with a loop count of zero repeats
+		// forever.
+		head = append(head[:len(head):len(head)], "\x21\xff\x0bNETSCAPE2.0\x03\x01\x00\x00\x00"...)
+		if _, err := w.Write(head); err != nil {
+			return err
+		}
+	} else if !bytes.Equal(head, s.head) {
+		return errors.New("frame size or palette differs from the first frame")
+	}
+	// Delays are in hundredths of a second; rounding the running time
+	// keeps rates like 30fps from drifting.
+	delay := gifTime(s.n+1, s.fps) - gifTime(s.n, s.fps)
+	s.n++
+	gce := []byte{0x21, 0xf9, 4, 0, byte(delay), byte(delay >> 8), 0, 0}
+	if _, err := w.Write(gce); err != nil {
+		return err
+	}
+	_, err = w.Write(block)
+	return err
+}
+
+// gifTime is when frame n starts at fps, in hundredths of a second.
+func gifTime(n, fps int) int {
+	return int(math.Round(float64(n) * 100 / float64(fps)))
+}
+
+func (s *gifSink) close() error {
+	return s.finish(func(w io.Writer) error {
+		_, err := w.Write([]byte{0x3b})
+		return err
+	})
+}
+
+// splitGIF splits a single-image GIF into its header, screen descriptor and
+// global color table, and the image descriptor with its data. Extensions
+// before the image are dropped.
+func splitGIF(b []byte) (head, block []byte, err error) {
+	if len(b) < 14 || b[len(b)-1] != 0x3b {
+		return nil, nil, errors.New("malformed GIF")
+	}
+	pos := 13
+	if flags := b[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&7 + 1)
+	}
+	head = b[:pos]
+	for pos+1 < len(b) && b[pos] == 0x21 {
+		pos += 2
+		for pos < len(b) && b[pos] != 0 {
+			pos += int(b[pos]) + 1
+		}
+		pos++
+	}
+	if pos >= len(b) || b[pos] != 0x2c {
+		return nil, nil, errors.New("malformed GIF")
+	}
+	return head, b[pos : len(b)-1], nil
+}
+
+// apngSink writes frames as a looping animated PNG.
+type apngSink struct {
+	animFile
+	apng apngWriter
+}
+
+func (s *apngSink) add(img *image.RGBA) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	w, err := s.writer()
+	if err != nil {
+		return err
+	}
+	return s.apng.add(w, buf.Bytes())
+}
+
+func (s *apngSink) close() error { return s.finish(s.apng.finish) }
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+func readPNGChunks(b []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(b, []byte(pngSignature)) {
+		return nil, errors.New("not a PNG")
+	}
+	b = b[len(pngSignature):]
+	var chunks []pngChunk
+	for len(b) >= 12 {
+		n := int(binary.BigEndian.Uint32(b))
+		if len(b) < 12+n {
+			return nil, errors.New("truncated PNG chunk")
+		}
+		chunks = append(chunks, pngChunk{typ: string(b[4:8]), data: b[8 : 8+n]})
+		b = b[12+n:]
+	}
+	return chunks, nil
+}
+
+func writePNGChunk(w io.Writer, typ string, data []byte) error {
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(data)))
+	copy(hdr[4:], typ)
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:])
+	crc.Write(data)
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// apngWriter combines PNG files of identical size and color type into a
+// looping animated PNG shown at fps, one frame at a time. The number of
+// frames goes in the header, so it has to be known up front.
+type apngWriter struct {
+	frames int
+	fps    int
+	n      int
+	ihdr   []byte
+	seq    uint32
+}
+
+// add writes the PNG file frame as the next frame.
+func (a *apngWriter) add(w io.Writer, frame []byte) error {
+	if a.n >= a.frames {
+		return fmt.Errorf("frame %d: more frames than the %d announced", a.n, a.frames)
+	}
+	chunks, err := readPNGChunks(frame)
+	if err != nil {
+		return fmt.Errorf("frame %d: %w", a.n, err)
+	}
+	if len(chunks) == 0 || chunks[0].typ != "IHDR" {
+		return fmt.Errorf("frame %d: missing IHDR", a.n)
+	}
+	if a.n == 0 {
+		a.ihdr = bytes.Clone(chunks[0].data)
+		if _, err := io.WriteString(w, pngSignature); err != nil {
+			return err
+		}
+		if err := writePNGChunk(w, "IHDR", a.ihdr); err != nil {
+			return err
+		}
+		actl := make([]byte, 8)
+		binary.BigEndian.PutUint32(actl, uint32(a.frames))
+		// The second field is the play count; zero loops forever.
+		if err := writePNGChunk(w, "acTL", actl); err != nil {
+			return err
+		}
+	} else if !bytes.Equal(chunks[0].data, a.ihdr) {
+		return fmt.Errorf("frame %d: size or color type differs from the first frame", a.n)
+	}
+
+	fctl := make([]byte, 26)
+	binary.BigEndian.PutUint32(fctl[0:], a.seq)
+	copy(fctl[4:12], a.ihdr[:8]) // width, height
+	binary.BigEndian.PutUint16(fctl[20:], 1)
+	binary.BigEndian.PutUint16(fctl[22:], uint16(a.fps))
+	// Offsets, dispose and blend ops are left at zero: full frames
+	// replace the previous one.
+	a.seq++
+	if err := writePNGChunk(w, "fcTL", fctl); err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if c.typ != "IDAT" {
+			continue
+		}
+		if a.n == 0 {
+			err = writePNGChunk(w, "IDAT", c.data)
+		} else {
+			fdat := binary.BigEndian.AppendUint32(nil, a.seq)
+			a.seq++
+			err = writePNGChunk(w, "fdAT", append(fdat, c.data...))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	a.n++
+	return nil
+}
+
+// finish ends the file once every announced frame was written.
+func (a *apngWriter) finish(w io.Writer) error {
+	if a.n != a.frames {
+		return fmt.Errorf("wrote %d of %d frames", a.n, a.frames)
+	}
+	return writePNGChunk(w, "IEND", nil)
+}
+
+// movieExporter renders a movie offscreen with the client's own drawing
+// code. All frames are rendered during the first Update and the game
+// terminates before anything is drawn to the screen; ebiten only shows its
+// window after the first buffer swap, so the window is never shown.
+type movieExporter struct {
+	player *moviePlayer
+	steps  []exportStep
+	sink   frameSink
+	scale  int
+	tick   time.Duration // between output frames
+	err    error
+}
+
+func (e *movieExporter) Update() error {
+	e.err = e.run()
+	return ebiten.Termination
+}
+
+func (e *movieExporter) Draw(*ebiten.Image) {}
+
+func (e *movieExporter) Layout(int, int) (int, int) { return 1, 1 }
+
+func (e *movieExporter) run() error {
+	w, h := gameAreaSizeX*e.scale, gameAreaSizeY*e.scale
+	dst := ebiten.NewImageWithOptions(image.Rect(0, 0, w, h), &ebiten.NewImageOptions{Unmanaged: true})
+	interval := time.Second / time.Duration(e.player.fps)
+	prevScale := gs.GameScale
+	gs.GameScale = float64(e.scale)
+	defer func() { gs.GameScale = prevScale }()
+
+	clock := time.Now()
+	for i, s := range e.steps {
+		// Frames before the range are stepped through too so the scene,
+		// bubbles and night level match normal playback.
+		for e.player.cur < s.cur {
+			e.player.step()
+		}
+		// Plugins get one tick per output frame; like on screen, what
+		// they draw shows from the next one.
+		clock = clock.Add(e.tick)
+		runPluginTimers(clock)
+		waitPluginTimers(pluginCallbackTimeout)
+
+		snap := e.player.sess.captureDrawSnapshot()
+		elapsed := time.Duration(float64(interval) * s.alpha)
+		alpha, mobileFade, pictFade := interpolationAt(elapsed, interval, gs.MobileBlendAmount, gs.BlendAmount)
+		dst.Fill(color.Black)
+		drawWorld(dst, snap, &gameLights, alpha, mobileFade, pictFade)
+		drawWorldLabels(dst, snap, alpha)
+
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		dst.ReadPixels(img.Pix)
+		if err := e.sink.add(img); err != nil {
+			return fmt.Errorf("frame %d: %w", i, err)
+		}
+		if (i+1)%100 == 0 {
+			log.Printf("export: %d/%d frames", i+1, len(e.steps))
+		}
+	}
+	return e.sink.close()
+}
+
+// exportDisplay checks that ebiten can create its hidden window. On X11
+// systems that needs DISPLAY; ebiten reaches Wayland through XWayland but
+// shows its window at once when WAYLAND_DISPLAY is set, so that is cleared
+// for the export.
+func exportDisplay() error {
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		return nil
+	}
+	if os.Getenv("DISPLAY") == "" {
+		return errors.New("-export renders through the GPU and needs an X display, but DISPLAY is not set; run it under xvfb-run")
+	}
+	return os.Unsetenv("WAYLAND_DISPLAY")
+}
+
+// runExport renders frames [exportStart,exportEnd) of the movie at path to
+// exportPath. An exportEnd of zero means the end of the movie.
+func runExport(path string) error {
+	frames, err := parseMovie(path, clientVersion)
+	if err != nil {
+		return fmt.Errorf("parse movie: %w", err)
+	}
+	end := exportEnd
+	if end <= 0 || end > len(frames) {
+		end = len(frames)
+	}
+	start := max(exportStart, 0)
+	fps := exportFPS
+	if fps <= 0 {
+		fps = clMovFPS
+	}
+	steps := exportSchedule(start, end, clMovFPS, fps)
+	if len(steps) == 0 {
+		return fmt.Errorf("no frames in range %d-%d (movie has %d)", start, end, len(frames))
+	}
+	sink, err := newFrameSink(exportPath, fps, len(steps))
+	if err != nil {
+		return err
+	}
+	if err := exportDisplay(); err != nil {
+		return err
+	}
+
+	drawStateEncrypted = false
+	mainSession.playerName = extractMoviePlayerName(frames)
+	updateBubbleVisibility()
+	initFont()
+	if clImages != nil {
+		clImages.Denoise = gs.DenoiseImages
+		clImages.DenoiseSharpness = gs.DenoiseSharpness
+		clImages.DenoiseAmount = gs.DenoiseAmount
+	}
+	// Plugins run as they do when the movie is played in the client, so
+	// their overlays are in the clip.
+	applyEnabledPlugins()
+	p := newMoviePlayer(mainSession, frames, clMovFPS, nil)
+	p.ticker.Stop()
+	p.playing = false
+
+	e := &movieExporter{player: p, steps: steps, sink: sink, scale: max(exportScale, 1), tick: time.Second / time.Duration(fps)}
+	ebiten.SetRunnableOnUnfocused(true)
+	ebiten.SetVsyncEnabled(false)
+	op := &ebiten.RunGameOptions{InitUnfocused: true, SkipTaskbar: true}
+	if err := ebiten.RunGameWithOptions(e, op); err != nil {
+		return err
+	}
+	if e.err != nil {
+		return e.err
+	}
+	log.Printf("export: wrote %d frames to %s", len(steps), exportPath)
+	return nil
+}
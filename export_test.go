@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExportSchedule(t *testing.T) {
+	// Two output frames per movie frame.
+	got := exportSchedule(10, 12, 5, 10)
+	want := []exportStep{{11, 0}, {11, 0.5}, {12, 0}, {12, 0.5}}
+	if len(got) != len(want) {
+		t.Fatalf("steps = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("steps = %v, want %v", got, want)
+		}
+	}
+	// Exporting below the movie rate skips frames.
+	if got := exportSchedule(0, 10, 10, 5); len(got) != 5 || got[1].cur != 3 {
+		t.Fatalf("downsampled steps = %v", got)
+	}
+	if got := exportSchedule(5, 5, 5, 5); got != nil {
+		t.Fatalf("empty range = %v", got)
+	}
+}
+
+func TestInterpolationAt(t *testing.T) {
+	prev := gs
+	t.Cleanup(func() { gs = prev })
+	gs.MotionSmoothing = true
+	gs.BlendMobiles = false
+	gs.BlendPicts = false
+	if a, _, _ := interpolationAt(50*time.Millisecond, 200*time.Millisecond, 0, 0); a != 0.25 {
+		t.Fatalf("alpha = %v", a)
+	}
+	gs.MotionSmoothing = false
+	if a, _, _ := interpolationAt(50*time.Millisecond, 200*time.Millisecond, 0, 0); a != 1 {
+		t.Fatalf("alpha without smoothing = %v", a)
+	}
+}
+
+func TestNewFrameSink(t *testing.T) {
+	if _, err := newFrameSink("clip.mp4", 10, 1); err == nil {
+		t.Fatalf("expected unknown format error")
+	}
+	if _, err := newFrameSink("clip.gif", 60, 1); err == nil {
+		t.Fatalf("expected an error for a GIF faster than 50fps")
+	}
+	s, err := newFrameSink(filepath.Join("out", "clip.PNG"), 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq, ok := s.(*pngSequence)
+	if !ok {
+		t.Fatalf("sink = %T", s)
+	}
+	if p := seq.framePath(7); p != filepath.Join("out", "clip-00007.PNG") {
+		t.Fatalf("frame path = %q", p)
+	}
+}
+
+func TestWriteAPNG(t *testing.T) {
+	var frames [][]byte
+	for _, c := range []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}} {
+		img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+		for i := 0; i < len(img.Pix); i += 4 {
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, buf.Bytes())
+	}
+	var out bytes.Buffer
+	a := apngWriter{frames: len(frames), fps: 10}
+	for _, f := range frames {
+		if err := a.add(&out, f); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+	if err := a.finish(&out); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+
+	chunks, err := readPNGChunks(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	var seqs []uint32
+	for _, c := range chunks {
+		types = append(types, c.typ)
+		switch c.typ {
+		case "acTL":
+			if n := binary.BigEndian.Uint32(c.data); n != 2 {
+				t.Fatalf("acTL frames = %d", n)
+			}
+		case "fcTL":
+			seqs = append(seqs, binary.BigEndian.Uint32(c.data))
+			if w, h := binary.BigEndian.Uint32(c.data[4:]), binary.BigEndian.Uint32(c.data[8:]); w != 4 || h != 3 {
+				t.Fatalf("fcTL size = %dx%d", w, h)
+			}
+			if den := binary.BigEndian.Uint16(c.data[22:]); den != 10 {
+				t.Fatalf("delay denominator = %d", den)
+			}
+		case "fdAT":
+			seqs = append(seqs, binary.BigEndian.Uint32(c.data))
+		}
+	}
+	want := []string{"IHDR", "acTL", "fcTL", "IDAT", "fcTL", "fdAT", "IEND"}
+	if len(types) != len(want) {
+		t.Fatalf("chunks = %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("chunks = %v, want %v", types, want)
+		}
+	}
+	for i, s := range seqs {
+		if s != uint32(i) {
+			t.Fatalf("sequence numbers = %v", seqs)
+		}
+	}
+
+	// Decoders without APNG support show the first frame.
+	img, err := png.Decode(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if r, _, b, _ := img.At(1, 1).RGBA(); r != 0xffff || b != 0 {
+		t.Fatalf("first frame pixel = %v", img.At(1, 1))
+	}
+}
+
+func TestWriteAPNGMismatchedFrames(t *testing.T) {
+	var frames [][]byte
+	for _, w := range []int{4, 5} {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, 3))); err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, buf.Bytes())
+	}
+	a := apngWriter{frames: len(frames), fps: 10}
+	var out bytes.Buffer
+	if err := a.add(&out, frames[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.add(&out, frames[1]); err == nil {
+		t.Fatalf("expected an error for frames of different sizes")
+	}
+	if err := a.finish(&out); err == nil {
+		t.Fatalf("expected an error for a missing frame")
+	}
+}
+
+func TestGIFSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clip.gif")
+	s, err := newFrameSink(path, 30, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}, {0, 255, 0, 255}} {
+		img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+		draw.Draw(img, img.Rect, image.NewUniform(c), image.Point{}, draw.Src)
+		if err := s.add(img); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+	if err := s.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	g, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(g.Image) != 3 || g.LoopCount != 0 {
+		t.Fatalf("frames = %d, loop count = %d", len(g.Image), g.LoopCount)
+	}
+	// 30fps alternates between 3 and 4 hundredths to stay in time.
+	if want := []int{3, 4, 3}; g.Delay[0] != want[0] || g.Delay[1] != want[1] || g.Delay[2] != want[2] {
+		t.Fatalf("delays = %v, want %v", g.Delay, want)
+	}
+	if r, _, b, _ := g.Image[1].At(1, 1).RGBA(); r != 0 || b != 0xffff {
+		t.Fatalf("second frame pixel = %v", g.Image[1].At(1, 1))
+	}
+}
@@ -34,21 +34,22 @@ func runFakeMode(ctx context.Context) {
 			return
 		}
 
+		s := mainSession
 		p1, p2 := "Bob", "John"
 
 		// Populate simple player descriptors and mobiles so Hero and Bob
 		// appear in the player list and on screen without a server
 		// connection.
-		updatePlayerAppearance(p1, 447, nil, false)
-		updatePlayerAppearance(p2, 447, nil, false)
-		stateMu.Lock()
-		playerIndex = 0
-		state.descriptors[0] = frameDescriptor{Index: 0, Type: kDescPlayer, PictID: 447, Name: p1}
-		state.descriptors[1] = frameDescriptor{Index: 1, Type: kDescPlayer, PictID: 447, Name: p2}
-		state.mobiles[0] = frameMobile{Index: 0, H: 0, V: 0}
-		state.mobiles[1] = frameMobile{Index: 1, H: 32, V: 0}
-		prepareRenderCacheLocked()
-		stateMu.Unlock()
+		s.updatePlayerAppearance(p1, 447, nil, false)
+		s.updatePlayerAppearance(p2, 447, nil, false)
+		s.stateMu.Lock()
+		s.playerIndex = 0
+		s.state.descriptors[0] = frameDescriptor{Index: 0, Type: kDescPlayer, PictID: 447, Name: p1}
+		s.state.descriptors[1] = frameDescriptor{Index: 1, Type: kDescPlayer, PictID: 447, Name: p2}
+		s.state.mobiles[0] = frameMobile{Index: 0, H: 0, V: 0}
+		s.state.mobiles[1] = frameMobile{Index: 1, H: 32, V: 0}
+		s.prepareRenderCacheLocked()
+		s.stateMu.Unlock()
 		playersDirty = true
 
 		// Helper to append a bubble and show corresponding chat message.
@@ -59,21 +60,21 @@ func runFakeMode(ctx context.Context) {
 			if life < 1 {
 				life = 1
 			}
-			b := bubble{Index: idx, Text: txt, Type: typ, CreatedFrame: frameCounter, LifeFrames: life}
+			b := bubble{Index: idx, Text: txt, Type: typ, CreatedFrame: s.frameCounter, LifeFrames: life}
 			switch typ & kBubbleTypeMask {
 			case kBubbleRealAction, kBubblePlayerAction, kBubbleNarrate:
 				b.NoArrow = true
 			}
-			stateMu.Lock()
-			state.bubbles = append(state.bubbles, b)
-			stateMu.Unlock()
+			s.stateMu.Lock()
+			s.state.bubbles = append(s.state.bubbles, b)
+			s.stateMu.Unlock()
 			switch verb {
 			case "", bubbleVerbVerbatim:
-				chatMessage(txt)
+				s.chatMessage(txt)
 			case bubbleVerbParentheses:
-				chatMessage("(" + name + " " + txt + ")")
+				s.chatMessage("(" + name + " " + txt + ")")
 			default:
-				chatMessage(name + " " + verb + ", " + txt)
+				s.chatMessage(name + " " + verb + ", " + txt)
 			}
 		}
 
@@ -90,10 +91,10 @@ func runFakeMode(ctx context.Context) {
 			case 0: // You share Bob
 				msg := append([]byte("You are sharing experiences with "), pnTag(p2)...)
 				msg = append(msg, '.')
-				handleInfoText(append(bepp("sh", msg), '\r'))
+				s.handleInfoText(append(bepp("sh", msg), '\r'))
 			case 1: // Bob shares you
 				msg := append(pnTag(p2), []byte(" is sharing experiences with you.")...)
-				handleInfoText(append(bepp("sh", msg), '\r'))
+				s.handleInfoText(append(bepp("sh", msg), '\r'))
 			case 2: // Hero speaks
 				emitBubble(0, kBubbleNormal, p1, "says", "Hello there!")
 			case 3: // Bob whispers
@@ -121,24 +122,24 @@ func runFakeMode(ctx context.Context) {
 				if life < 1 {
 					life = 1
 				}
-				b := bubble{Index: 1, H: int16(fieldCenterX + 10), V: 0, Far: true, Text: "Over here!", Type: kBubbleNormal, CreatedFrame: frameCounter, LifeFrames: life}
-				stateMu.Lock()
-				state.bubbles = append(state.bubbles, b)
-				stateMu.Unlock()
-				chatMessage(p2 + " says, Over here!")
+				b := bubble{Index: 1, H: int16(fieldCenterX + 10), V: 0, Far: true, Text: "Over here!", Type: kBubbleNormal, CreatedFrame: s.frameCounter, LifeFrames: life}
+				s.stateMu.Lock()
+				s.state.bubbles = append(s.state.bubbles, b)
+				s.stateMu.Unlock()
+				s.chatMessage(p2 + " says, Over here!")
 			case 13: // Bob falls
 				msg := append(pnTag(p2), []byte(" has fallen")...)
-				handleInfoText(append(bepp("hf", msg), '\r'))
+				s.handleInfoText(append(bepp("hf", msg), '\r'))
 			case 14: // Bob recovers
 				msg := append(pnTag(p2), []byte(" is no longer fallen")...)
-				handleInfoText(append(bepp("nf", msg), '\r'))
+				s.handleInfoText(append(bepp("nf", msg), '\r'))
 			case 15: // You unshare Bob
 				msg := append([]byte("You are no longer sharing experiences with "), pnTag(p2)...)
 				msg = append(msg, '.')
-				handleInfoText(append(bepp("su", msg), '\r'))
+				s.handleInfoText(append(bepp("su", msg), '\r'))
 			case 16: // Bob unshares you
 				msg := append(pnTag(p2), []byte(" is no longer sharing experiences with you.")...)
-				handleInfoText(append(bepp("su", msg), '\r'))
+				s.handleInfoText(append(bepp("su", msg), '\r'))
 			}
 			step = (step + 1) % 17
 		}
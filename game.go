@@ -1,9 +1,7 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"image"
@@ -192,14 +190,7 @@ var inputPos int
 var inputHistory []string
 var historyPos int
 
-var (
-	recorder            *movieRecorder
-	gPlayersListIsStale bool
-	loginGameState      []byte
-	loginMobileData     []byte
-	loginPictureTable   []byte
-	wroteLoginBlocks    bool
-)
+var gPlayersListIsStale bool
 
 // gameWin represents the main playfield window. Its size corresponds to the
 // classic client field box (547×540) defined in old_mac_client/client/source/
@@ -220,24 +211,10 @@ var (
 
 // Deprecated: sound settings window removed; kept other windows.
 var gameCtx context.Context
-var frameCounter int
 var gameStarted = make(chan struct{})
 
 const framems = 200
 
-var (
-	frameCh       = make(chan struct{}, 1)
-	lastFrameTime time.Time
-	frameInterval = framems * time.Millisecond
-	intervalHist  = map[int]int{}
-	frameMu       sync.Mutex
-	serverFPS     float64
-	netLatency    time.Duration
-	netJitter     time.Duration
-	lastInputSent time.Time
-	latencyMu     sync.Mutex
-)
-
 // drawState tracks information needed by the Ebiten renderer.
 type drawState struct {
 	descriptors  map[uint8]frameDescriptor
@@ -262,6 +239,12 @@ type drawState struct {
 	ackCmd                      uint8
 	lightingFlags               uint8
 	dropped                     int
+	frame                       int
+	playerIndex                 uint8
+	nightLevel                  int
+
+	// sess is the session the snapshot was taken from, for its player list.
+	sess *session
 
 	// Prepared render caches populated only when a new game state arrives.
 	// These avoid per-frame sorting and partitioning work in Draw.
@@ -273,50 +256,45 @@ type drawState struct {
 	nameMobs []frameMobile
 }
 
-var (
-	state = drawState{
+// newDrawState returns an empty draw state.
+func newDrawState() drawState {
+	return drawState{
 		descriptors: make(map[uint8]frameDescriptor),
 		mobiles:     make(map[uint8]frameMobile),
 		prevMobiles: make(map[uint8]frameMobile),
 		prevDescs:   make(map[uint8]frameDescriptor),
 	}
-	initialState drawState
-	stateMu      sync.Mutex
-)
+}
 
 // resetDrawState clears all game state and interpolation data.
 // It also resets timing counters so new sessions start from a clean slate.
-func resetDrawState() {
-	stateMu.Lock()
-	state = drawState{
-		descriptors: make(map[uint8]frameDescriptor),
-		mobiles:     make(map[uint8]frameMobile),
-		prevMobiles: make(map[uint8]frameMobile),
-		prevDescs:   make(map[uint8]frameDescriptor),
-	}
-	stateMu.Unlock()
+func (s *session) resetDrawState() {
+	s.stateMu.Lock()
+	s.state = newDrawState()
+	s.stateMu.Unlock()
 
-	resetInterpolation()
+	s.resetInterpolation()
 
-	frameCounter = 0
-	serverFPS = 0
-	frameInterval = framems * time.Millisecond
+	s.frameCounter = 0
 
 	// Clear frame timing history so new sessions start fresh without
 	// inherited intervals from previous connections.
-	frameMu.Lock()
-	lastFrameTime = time.Time{}
-	intervalHist = map[int]int{}
-	frameMu.Unlock()
-
-	stateMu.Lock()
-	initialState = cloneDrawState(state)
-	stateMu.Unlock()
+	s.frameMu.Lock()
+	s.serverFPS = 0
+	s.frameInterval = framems * time.Millisecond
+	s.lastFrameTime = time.Time{}
+	s.intervalHist = map[int]int{}
+	s.frameMu.Unlock()
+
+	s.stateMu.Lock()
+	s.initialState = cloneDrawState(s.state)
+	s.stateMu.Unlock()
 }
 
 // prepareRenderCacheLocked populates render-ready, sorted/partitioned slices.
 // Call with stateMu held and only when a new game state is applied.
-func prepareRenderCacheLocked() {
+func (s *session) prepareRenderCacheLocked() {
+	state := &s.state
 	// Mobiles: split into live and dead, sort by V then H, and prepare
 	// a separate slice sorted right-to-left/top-to-bottom for name tags.
 	state.liveMobs = state.liveMobs[:0]
@@ -389,6 +367,12 @@ type drawSnapshot struct {
 	ackCmd                      uint8
 	lightingFlags               uint8
 	dropped                     int
+	frame                       int
+	playerIndex                 uint8
+	nightLevel                  int
+
+	// sess is the session the snapshot was taken from, for its player list.
+	sess *session
 
 	// Precomputed, sorted/partitioned data for rendering
 	picsNeg  []framePicture
@@ -398,10 +382,11 @@ type drawSnapshot struct {
 	deadMobs []frameMobile
 }
 
-// captureDrawSnapshot copies the shared draw state under a mutex.
-func captureDrawSnapshot() drawSnapshot {
-	stateMu.Lock()
-	defer stateMu.Unlock()
+// captureDrawSnapshot copies s's draw state under its mutex.
+func (s *session) captureDrawSnapshot() drawSnapshot {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	state := &s.state
 
 	snap := drawSnapshot{
 		descriptors:    make(map[uint8]frameDescriptor, len(state.descriptors)),
@@ -427,6 +412,10 @@ func captureDrawSnapshot() drawSnapshot {
 		ackCmd:         state.ackCmd,
 		lightingFlags:  state.lightingFlags,
 		dropped:        state.dropped,
+		frame:          s.frameCounter,
+		playerIndex:    s.playerIndex,
+		nightLevel:     s.currentNightLevel(),
+		sess:           s,
 		// prepared caches
 		picsNeg:  append([]framePicture(nil), state.picsNeg...),
 		picsZero: append([]framePicture(nil), state.picsZero...),
@@ -439,7 +428,7 @@ func captureDrawSnapshot() drawSnapshot {
 		snap.descriptors[idx] = d
 	}
 	if len(state.bubbles) > 0 {
-		curFrame := frameCounter
+		curFrame := s.frameCounter
 		kept := state.bubbles[:0]
 		for _, b := range state.bubbles {
 			if (curFrame - b.CreatedFrame) < b.LifeFrames {
@@ -526,12 +515,19 @@ func cloneDrawState(src drawState) drawState {
 // computeInterpolation returns the blend factors for frame interpolation and onion skinning.
 // It returns separate fade values for mobiles and pictures based on their respective rates.
 func computeInterpolation(prevTime, curTime time.Time, mobileRate, pictRate float64) (alpha float64, mobileFade, pictFade float32) {
+	if curTime.IsZero() || !curTime.After(prevTime) {
+		return 1, 1, 1
+	}
+	return interpolationAt(time.Since(prevTime), curTime.Sub(prevTime), mobileRate, pictRate)
+}
+
+// interpolationAt is computeInterpolation for a frame shown elapsed into a
+// frame interval, so offscreen renders can step time themselves.
+func interpolationAt(elapsed, interval time.Duration, mobileRate, pictRate float64) (alpha float64, mobileFade, pictFade float32) {
 	alpha = 1.0
 	mobileFade = 1.0
 	pictFade = 1.0
-	if (gs.MotionSmoothing || gs.BlendMobiles || gs.BlendPicts) && !curTime.IsZero() && curTime.After(prevTime) {
-		elapsed := time.Since(prevTime)
-		interval := curTime.Sub(prevTime)
+	if (gs.MotionSmoothing || gs.BlendMobiles || gs.BlendPicts) && interval > 0 {
 		if gs.MotionSmoothing {
 			alpha = float64(elapsed) / float64(interval)
 			if alpha < 0 {
@@ -574,6 +570,30 @@ type Game struct{}
 var once sync.Once
 var lastBackpace time.Time
 
+var (
+	updateQueueMu sync.Mutex
+	updateQueue   []func()
+)
+
+// queueUpdate defers fn to the next Update, for goroutines that finish work
+// the UI or the window has to pick up.
+func queueUpdate(fn func()) {
+	updateQueueMu.Lock()
+	updateQueue = append(updateQueue, fn)
+	updateQueueMu.Unlock()
+}
+
+// runUpdateQueue runs the functions queued by queueUpdate in order.
+func runUpdateQueue() {
+	updateQueueMu.Lock()
+	q := updateQueue
+	updateQueue = nil
+	updateQueueMu.Unlock()
+	for _, fn := range q {
+		fn()
+	}
+}
+
 func (g *Game) Update() error {
 	select {
 	case <-gameCtx.Done():
@@ -598,6 +618,10 @@ func (g *Game) Update() error {
 		inputText = []rune(plain)
 	}
 	checkPluginMods()
+	checkHDPackMods()
+	runUpdateQueue()
+	runPluginUIQueue()
+	runPluginTimers(time.Now())
 	updateNotifications()
 	updateThinkMessages()
 
@@ -610,7 +634,7 @@ func (g *Game) Update() error {
 	inventoryShortcutMu.RLock()
 	for idx, r := range inventoryShortcuts {
 		if k := keyForRune(r); k >= 0 && inpututil.IsKeyJustPressed(k) {
-			triggerInventoryShortcut(idx)
+			focusedSession().triggerInventoryShortcut(idx)
 		}
 	}
 	inventoryShortcutMu.RUnlock()
@@ -647,6 +671,15 @@ func (g *Game) Update() error {
 		playersDirty = false
 	}
 
+	if sessionsChanged.Swap(false) {
+		if sessionsWin != nil && sessionsWin.IsOpen() {
+			updateSessionsWindow()
+		}
+	}
+	updateAutoMapWindows()
+	updateAssetsWindow()
+	updateStatsWindow()
+
 	if syncWindowSettings() {
 		settingsDirty = true
 	}
@@ -668,7 +701,7 @@ func (g *Game) Update() error {
 
 	if time.Since(lastPlayersSave) >= 10*time.Second {
 		if clmov == "" && !playingMovie && (playersDirty || playersPersistDirty) {
-			savePlayersPersist()
+			mainSession.savePlayersPersist()
 			playersPersistDirty = false
 		}
 		lastPlayersSave = time.Now()
@@ -771,61 +804,7 @@ func (g *Game) Update() error {
 			}
 		}
 		if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
-			orig := string(inputText)
-			txt := runInputHandlers(orig)
-			txt = strings.TrimSpace(txt)
-			if txt == "" {
-				// If handlers removed the text, fall back to the user's
-				// original entry so it's still sent.
-				txt = strings.TrimSpace(orig)
-			}
-			if txt != "" {
-				if strings.HasPrefix(txt, "/play ") {
-					tune := strings.TrimSpace(txt[len("/play "):])
-					if musicDebug {
-						msg := "/play " + tune
-						consoleMessage(msg)
-						chatMessage(msg)
-						log.Print(msg)
-					}
-					go func() {
-						if err := playClanLordTune(tune); err != nil {
-							log.Printf("play tune: %v", err)
-							if musicDebug {
-								consoleMessage("play tune: " + err.Error())
-								chatMessage("play tune: " + err.Error())
-							}
-						}
-					}()
-				} else {
-					// Try plugin-registered commands first
-					if strings.HasPrefix(txt, "/") {
-						parts := strings.SplitN(strings.TrimPrefix(txt, "/"), " ", 2)
-						name := strings.ToLower(parts[0])
-						args := ""
-						if len(parts) > 1 {
-							args = parts[1]
-						}
-						if handler, ok := pluginCommands[name]; ok && handler != nil {
-							owner := pluginCommandOwners[name]
-							if !pluginDisabled[owner] {
-								consoleMessage("> " + txt)
-								go handler(args)
-							} else {
-								// Disabled plugin commands should fall through so the
-								// server still receives the user's input.
-								pendingCommand = txt
-							}
-						} else {
-							pendingCommand = txt
-						}
-					} else {
-						pendingCommand = txt
-					}
-					//consoleMessage("> " + txt)
-				}
-				inputHistory = append(inputHistory, txt)
-			}
+			submitInput(string(inputText))
 			if gs.InputBarAlwaysOpen {
 				inputActive = true
 			} else {
@@ -985,6 +964,7 @@ func (g *Game) Update() error {
 
 	updateHotkeyRecording()
 	checkHotkeys()
+	updateClassicMacros()
 
 	return nil
 }
@@ -1153,30 +1133,19 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	var snap drawSnapshot
 	var alpha float64
 	var haveSnap bool
-	if clmov == "" && tcpConn == nil && pcapPath == "" && !fake {
+	sess := focusedSession()
+	if clmov == "" && !sess.connected() && pcapPath == "" && !fake {
 		prev := gs.GameScale
 		gs.GameScale = float64(offIntScale)
 		drawSplash(worldRT, 0, 0)
 		gs.GameScale = prev
 	} else {
-		snap = captureDrawSnapshot()
+		snap = sess.captureDrawSnapshot()
 		var mobileFade, pictFade float32
 		alpha, mobileFade, pictFade = computeInterpolation(snap.prevTime, snap.curTime, gs.MobileBlendAmount, gs.BlendAmount)
 		prev := gs.GameScale
 		gs.GameScale = float64(offIntScale)
-		drawScene(worldRT, 0, 0, snap, alpha, mobileFade, pictFade)
-		if gs.shaderLighting {
-			// Use shader-based night darkening with inverse-square falloff.
-			addNightDarkSources(offW, offH, float32(alpha))
-		} else {
-			// Classic overlay path when shader is off.
-			//drawNightAmbient(worldRT, 0, 0)
-			drawNightOverlay(worldRT, 0, 0)
-		}
-		if gs.shaderLighting {
-			applyLightingShader(worldRT, frameLights, frameDarks, float32(alpha))
-		}
-		drawStatusBars(worldRT, 0, 0, snap, alpha)
+		drawWorld(worldRT, snap, &gameLights, alpha, mobileFade, pictFade)
 		gs.GameScale = prev
 		haveSnap = true
 	}
@@ -1206,18 +1175,17 @@ func (g *Game) Draw(screen *ebiten.Image) {
 			bottom = bufH
 		}
 		worldView := gameImage.SubImage(image.Rect(left, top, right, bottom)).(*ebiten.Image)
-		if gs.nameTagsNative {
-			drawMobileNameTags(worldView, snap, alpha)
-		}
-		drawSpeechBubbles(worldView, snap, alpha)
+		drawWorldLabels(worldView, snap, alpha)
 		gs.GameScale = prev
 	}
 
+	drawSessionViews()
+
 	// Finally, draw UI (which includes the game window image)
 	eui.Draw(screen)
 
 	//if gs.ShowFPS {
-	//	drawServerFPS(screen, screen.Bounds().Dx()-40, 4, serverFPS)
+	//	s.drawServerFPS(screen, screen.Bounds().Dx()-40, 4, s.serverFPS)
 	//}
 
 	if seekingMov {
@@ -1228,10 +1196,40 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		op.GeoM.Translate(x, y)
 		text.Draw(screen, "SEEKING...", mainFontBold, op)
 	}
+	drawReconnectOverlay(screen)
 }
 
 var lastSeekPrev time.Time
 
+// drawWorld renders the scene and night lighting into dst at the current
+// gs.GameScale, blending the lighting against lights, the history of the view
+// dst belongs to. What goes over them is drawn by drawWorldLabels at the
+// final output scale.
+func drawWorld(dst *ebiten.Image, snap drawSnapshot, lights *lightHistory, alpha float64, mobileFade, pictFade float32) {
+	drawScene(dst, 0, 0, snap, alpha, mobileFade, pictFade)
+	if gs.shaderLighting {
+		// Use shader-based night darkening with inverse-square falloff.
+		lights.addNightDarkSources(dst.Bounds().Dx(), dst.Bounds().Dy(), float32(alpha), snap.nightLevel)
+		applyLightingShader(dst, lights, frameLights, frameDarks, float32(alpha), snap.nightLevel)
+	} else {
+		// Classic overlay path when shader is off.
+		//drawNightAmbient(dst, 0, 0, snap.nightLevel)
+		drawNightOverlay(dst, 0, 0, snap.nightLevel)
+	}
+}
+
+// drawWorldLabels draws native name tags, plugin overlays, status bars and
+// speech bubbles into dst at the output scale, over what drawWorld
+// rendered. Plugin overlays go over name tags and under the status bars.
+func drawWorldLabels(dst *ebiten.Image, snap drawSnapshot, alpha float64) {
+	if gs.nameTagsNative {
+		drawMobileNameTags(dst, snap, alpha)
+	}
+	drawPluginOverlays(dst, 0, 0, snap, alpha)
+	drawStatusBars(dst, 0, 0, snap, alpha)
+	drawSpeechBubbles(dst, snap, alpha)
+}
+
 // drawScene renders all world objects for the current frame.
 func drawScene(screen *ebiten.Image, ox, oy int, snap drawSnapshot, alpha float64, mobileFade, pictFade float32) {
 	if gs.shaderLighting {
@@ -1251,16 +1249,16 @@ func drawScene(screen *ebiten.Image, ox, oy int, snap drawSnapshot, alpha float6
 	dead := snap.deadMobs
 
 	for _, p := range negPics {
-		drawPicture(screen, ox, oy, p, alpha, pictFade, snap.mobiles, descMap, snap.prevMobiles, snap.prevPictures, snap.picShiftX, snap.picShiftY)
+		drawPicture(screen, ox, oy, p, alpha, pictFade, snap)
 	}
 
 	if gs.hideMobiles {
 		for _, p := range zeroPics {
-			drawPicture(screen, ox, oy, p, alpha, pictFade, snap.mobiles, descMap, snap.prevMobiles, snap.prevPictures, snap.picShiftX, snap.picShiftY)
+			drawPicture(screen, ox, oy, p, alpha, pictFade, snap)
 		}
 	} else {
 		for _, m := range dead {
-			drawMobile(screen, ox, oy, m, descMap, snap.prevMobiles, snap.prevDescs, snap.picShiftX, snap.picShiftY, alpha, mobileFade, mobileLimit)
+			drawMobile(screen, snap.sess, ox, oy, m, descMap, snap.prevMobiles, snap.prevDescs, snap.picShiftX, snap.picShiftY, alpha, mobileFade, mobileLimit)
 			if !gs.nameTagsNative {
 				drawMobileNameTag(screen, snap, m, alpha)
 			}
@@ -1280,31 +1278,32 @@ func drawScene(screen *ebiten.Image, ox, oy int, snap drawSnapshot, alpha float6
 			}
 			if mV < pV || (mV == pV && mH <= pH) {
 				if live[i].State != poseDead {
-					drawMobile(screen, ox, oy, live[i], descMap, snap.prevMobiles, snap.prevDescs, snap.picShiftX, snap.picShiftY, alpha, mobileFade, mobileLimit)
+					drawMobile(screen, snap.sess, ox, oy, live[i], descMap, snap.prevMobiles, snap.prevDescs, snap.picShiftX, snap.picShiftY, alpha, mobileFade, mobileLimit)
 					if !gs.nameTagsNative {
 						drawMobileNameTag(screen, snap, live[i], alpha)
 					}
 				}
 				i++
 			} else {
-				drawPicture(screen, ox, oy, zeroPics[j], alpha, pictFade, snap.mobiles, descMap, snap.prevMobiles, snap.prevPictures, snap.picShiftX, snap.picShiftY)
+				drawPicture(screen, ox, oy, zeroPics[j], alpha, pictFade, snap)
 				j++
 			}
 		}
 	}
 
 	for _, p := range posPics {
-		drawPicture(screen, ox, oy, p, alpha, pictFade, snap.mobiles, descMap, snap.prevMobiles, snap.prevPictures, snap.picShiftX, snap.picShiftY)
+		drawPicture(screen, ox, oy, p, alpha, pictFade, snap)
 	}
 }
 
-// drawMobile renders a single mobile object with optional interpolation and onion skinning.
-// When a mobile lacks history but the world shifts, a pseudo-previous position
-// derived from picShift provides a one-frame interpolation. maxDist sets the
-// maximum allowed pixel delta for interpolation.
-func drawMobile(screen *ebiten.Image, ox, oy int, m frameMobile, descMap map[uint8]frameDescriptor, prevMobiles map[uint8]frameMobile, prevDescs map[uint8]frameDescriptor, shiftX, shiftY int, alpha float64, fade float32, maxDist int) {
-	h := float64(m.H)
-	v := float64(m.V)
+// mobilePosition returns where m is drawn at alpha between the previous
+// frame and this one, in world coordinates. When a mobile lacks history
+// but the world shifts, a pseudo-previous position derived from picShift
+// provides a one-frame interpolation. maxDist sets the maximum allowed
+// pixel delta for interpolation.
+func mobilePosition(m frameMobile, prevMobiles map[uint8]frameMobile, shiftX, shiftY int, alpha float64, maxDist int) (h, v float64) {
+	h = float64(m.H)
+	v = float64(m.V)
 	if gs.MotionSmoothing {
 		if pm, ok := prevMobiles[m.Index]; ok {
 			dh := int(m.H) - int(pm.H) - shiftX
@@ -1325,6 +1324,15 @@ func drawMobile(screen *ebiten.Image, ox, oy int, m frameMobile, descMap map[uin
 			}
 		}
 	}
+	return h, v
+}
+
+// drawMobile renders a single mobile object with optional interpolation and onion skinning.
+// When a mobile lacks history but the world shifts, a pseudo-previous position
+// derived from picShift provides a one-frame interpolation. maxDist sets the
+// maximum allowed pixel delta for interpolation.
+func drawMobile(screen *ebiten.Image, s *session, ox, oy int, m frameMobile, descMap map[uint8]frameDescriptor, prevMobiles map[uint8]frameMobile, prevDescs map[uint8]frameDescriptor, shiftX, shiftY int, alpha float64, fade float32, maxDist int) {
+	h, v := mobilePosition(m, prevMobiles, shiftX, shiftY, alpha, maxDist)
 	x := roundToInt((h + float64(fieldCenterX)) * gs.GameScale)
 	y := roundToInt((v + float64(fieldCenterY)) * gs.GameScale)
 	x += ox
@@ -1337,11 +1345,11 @@ func drawMobile(screen *ebiten.Image, ox, oy int, m frameMobile, descMap map[uin
 	if desc, ok := descMap[m.Index]; ok {
 		d = desc
 		colors = d.Colors
-		playersMu.RLock()
-		if p, ok := players[d.Name]; ok && len(p.Colors) > 0 {
+		s.playersMu.RLock()
+		if p, ok := s.players[d.Name]; ok && len(p.Colors) > 0 {
 			colors = append([]byte(nil), p.Colors...)
 		}
-		playersMu.RUnlock()
+		s.playersMu.RUnlock()
 		state = m.State
 		img = loadMobileFrame(d.PictID, state, colors)
 		plane = d.Plane
@@ -1357,11 +1365,11 @@ func drawMobile(screen *ebiten.Image, ox, oy int, m frameMobile, descMap map[uin
 				pd = d
 			}
 			prevColors = pd.Colors
-			playersMu.RLock()
-			if p, ok := players[pd.Name]; ok && len(p.Colors) > 0 {
+			s.playersMu.RLock()
+			if p, ok := s.players[pd.Name]; ok && len(p.Colors) > 0 {
 				prevColors = append([]byte(nil), p.Colors...)
 			}
-			playersMu.RUnlock()
+			s.playersMu.RUnlock()
 			prevImg = loadMobileFrame(pd.PictID, pm.State, prevColors)
 			prevPict = pd.PictID
 			prevState = pm.State
@@ -1559,7 +1567,9 @@ func pictureDrawsAfterMobileAt(p framePicture, pictH, pictV int16, mobH, mobV in
 }
 
 // drawPicture renders a single picture sprite.
-func drawPicture(screen *ebiten.Image, ox, oy int, p framePicture, alpha float64, fade float32, mobiles []frameMobile, descMap map[uint8]frameDescriptor, prevMobiles map[uint8]frameMobile, prevPictures []framePicture, shiftX, shiftY int) {
+func drawPicture(screen *ebiten.Image, ox, oy int, p framePicture, alpha float64, fade float32, snap drawSnapshot) {
+	mobiles, descMap, prevMobiles, prevPictures := snap.mobiles, snap.descriptors, snap.prevMobiles, snap.prevPictures
+	shiftX, shiftY := snap.picShiftX, snap.picShiftY
 	if gs.hideMoving && p.Moving {
 		return
 	}
@@ -1580,8 +1590,8 @@ func drawPicture(screen *ebiten.Image, ox, oy int, p framePicture, alpha float64
 	frame := 0
 	prevFrame := 0
 	if clImages != nil {
-		frame = clImages.FrameIndex(uint32(p.PictID), frameCounter)
-		prevFrame = clImages.FrameIndex(uint32(p.PictID), frameCounter-1)
+		frame = clImages.FrameIndex(uint32(p.PictID), snap.frame)
+		prevFrame = clImages.FrameIndex(uint32(p.PictID), snap.frame-1)
 	}
 	plane := p.Plane
 
@@ -1595,7 +1605,7 @@ func drawPicture(screen *ebiten.Image, ox, oy int, p framePicture, alpha float64
 
 	var mobileX, mobileY float64
 	if gs.ObjectPinning && gs.MotionSmoothing && w <= 500 && h <= 500 {
-		if dx, dy, ok := pictureMobileOffset(p, mobiles, prevMobiles, prevPictures, alpha); ok {
+		if dx, dy, ok := pictureMobileOffset(p, snap.playerIndex, mobiles, prevMobiles, prevPictures, alpha); ok {
 			mobileX, mobileY = dx, dy
 			offX = 0
 			offY = 0
@@ -1609,7 +1619,7 @@ func drawPicture(screen *ebiten.Image, ox, oy int, p framePicture, alpha float64
 
 	addLightSource(uint32(p.PictID), float64(x), float64(y), w)
 
-	img := loadImageFrame(p.PictID, frame)
+	img, imgScale := loadPictureFrame(p.PictID, frame)
 	fadeAlpha := float32(1.0)
 	if gs.FadeObscuringPictures && w > 0 && h > 0 && clImages != nil && !clImages.IsSemiTransparent(uint32(p.PictID)) {
 		for _, m := range mobiles {
@@ -1643,15 +1653,17 @@ func drawPicture(screen *ebiten.Image, ox, oy int, p framePicture, alpha float64
 		}
 	}
 	var prevImg *ebiten.Image
+	prevScale := imgScale
 	if gs.BlendPicts && clImages != nil {
 		if prevFrame != frame {
-			prevImg = loadImageFrame(p.PictID, prevFrame)
+			prevImg, prevScale = loadPictureFrame(p.PictID, prevFrame)
 		}
 	}
 
 	if img != nil {
-		drawW, drawH := w, h
-		blend := gs.BlendPicts && prevImg != nil && fade > 0 && fade < 1
+		// Frames from a texture pack only blend with frames of the same size.
+		blend := gs.BlendPicts && prevImg != nil && fade > 0 && fade < 1 && prevScale == imgScale
+		srcScale := imgScale
 		var src *ebiten.Image
 		if blend {
 			steps := gs.PictBlendFrames
@@ -1670,22 +1682,26 @@ func drawPicture(screen *ebiten.Image, ox, oy int, p framePicture, alpha float64
 			}
 		} else if gs.BlendPicts && prevImg != nil {
 			if fade <= 0 {
-				src = prevImg
+				src, srcScale = prevImg, prevScale
 			} else {
 				src = img
 			}
 		} else {
 			src = img
 		}
-		if src != nil {
-			drawW, drawH = src.Bounds().Dx(), src.Bounds().Dy()
-		}
+		srcW, srcH := src.Bounds().Dx(), src.Bounds().Dy()
+		drawW, drawH := roundToInt(float64(srcW)/srcScale), roundToInt(float64(srcH)/srcScale)
 		sx, sy := scaleForFiltering(gs.GameScale, drawW, drawH)
 		scaledW := float64(roundToInt(float64(drawW) * sx))
 		scaledH := float64(roundToInt(float64(drawH) * sy))
-		sx = scaledW / float64(drawW)
-		sy = scaledH / float64(drawH)
+		sx = scaledW / float64(srcW)
+		sy = scaledH / float64(srcH)
 		op := &ebiten.DrawImageOptions{Filter: ebiten.FilterNearest, DisableMipmaps: true}
+		if sx < 1 || sy < 1 {
+			// Texture pack images are drawn shrunk when the game scale is
+			// below theirs.
+			op.Filter = ebiten.FilterLinear
+		}
 		op.GeoM.Scale(sx, sy)
 		tx := float64(x) - scaledW/2
 		ty := float64(y) - scaledH/2
@@ -1761,12 +1777,12 @@ func drawPicture(screen *ebiten.Image, ox, oy int, p framePicture, alpha float64
 // pictureMobileOffset checks for exact offset match between the picture and a
 // mobile across frames using raw coordinates only (no picShift). When matched,
 // it returns the mobile's interpolated delta so the picture follows smoothly.
-func pictureMobileOffset(p framePicture, mobiles []frameMobile, prevMobiles map[uint8]frameMobile, prevPictures []framePicture, alpha float64) (float64, float64, bool) {
+func pictureMobileOffset(p framePicture, self uint8, mobiles []frameMobile, prevMobiles map[uint8]frameMobile, prevPictures []framePicture, alpha float64) (float64, float64, bool) {
 	// Use exact previous picture position for the same PictID to verify the
 	// picture-to-mobile offset stayed identical across frames.
-	// Try the hero (playerIndex) first to ensure centered player effects pin.
+	// Try the hero (self) first to ensure centered player effects pin.
 	for i := range mobiles {
-		if mobiles[i].Index != playerIndex {
+		if mobiles[i].Index != self {
 			continue
 		}
 		m := mobiles[i]
@@ -1879,8 +1895,8 @@ func drawMobileNameTag(screen *ebiten.Image, snap drawSnapshot, m frameMobile, a
 		offset := float64(size) * gs.GameScale / 2
 		if d.Name != "" {
 			style := styleRegular
-			playersMu.RLock()
-			if p, ok := players[d.Name]; ok {
+			snap.sess.playersMu.RLock()
+			if p, ok := snap.sess.players[d.Name]; ok {
 				if p.Sharing && p.Sharee {
 					style = styleBoldItalic
 				} else if p.Sharing {
@@ -1889,7 +1905,7 @@ func drawMobileNameTag(screen *ebiten.Image, snap drawSnapshot, m frameMobile, a
 					style = styleItalic
 				}
 			}
-			playersMu.RUnlock()
+			snap.sess.playersMu.RUnlock()
 			if m.nameTag != nil && m.nameTagKey.FontGen == fontGen && m.nameTagKey.Opacity == nameAlpha && m.nameTagKey.Text == d.Name && m.nameTagKey.Colors == m.Colors && m.nameTagKey.Style == style {
 				top := y + int(offset)
 				left := x - int(float64(m.nameTagW)/2)
@@ -1898,12 +1914,12 @@ func drawMobileNameTag(screen *ebiten.Image, snap drawSnapshot, m frameMobile, a
 				screen.DrawImage(m.nameTag, op)
 			} else {
 				textClr, bgClr, frameClr := mobileNameColors(m.Colors)
-				playersMu.RLock()
-				if p, ok := players[d.Name]; ok && p.FriendLabel > 0 && p.FriendLabel <= len(labelColors) {
+				snap.sess.playersMu.RLock()
+				if p, ok := snap.sess.players[d.Name]; ok && p.FriendLabel > 0 && p.FriendLabel <= len(labelColors) {
 					lc := labelColors[p.FriendLabel-1]
 					frameClr = color.RGBA{lc.R, lc.G, lc.B, frameClr.A}
 				}
-				playersMu.RUnlock()
+				snap.sess.playersMu.RUnlock()
 				bgClr.A = nameAlpha
 				frameClr.A = nameAlpha
 				face := mainFont
@@ -1994,7 +2010,7 @@ func drawSpeechBubbles(screen *ebiten.Image, snap drawSnapshot, alpha float64) {
 		}
 		originOK := true
 		switch {
-		case b.Index == playerIndex:
+		case b.Index == snap.playerIndex:
 			originOK = gs.BubbleSelf
 		case bubbleType == kBubbleMonster:
 			originOK = gs.BubbleMonsters
@@ -2187,16 +2203,18 @@ var fpsImage *ebiten.Image
 var lastFPS time.Time
 var fpsWidth, fpsHeight float64
 
-func drawServerFPS(screen *ebiten.Image, ox, oy int, fps float64) {
+func (s *session) drawServerFPS(screen *ebiten.Image, ox, oy int, fps float64) {
 	if fps <= 0 {
 		return
 	}
 	if time.Since(lastFPS) >= time.Second {
 		lastFPS = time.Now()
 
-		lat := netLatency
-		jit := netJitter
-		drop := droppedPercent()
+		s.latencyMu.Lock()
+		lat := s.netLatency
+		jit := s.netJitter
+		s.latencyMu.Unlock()
+		drop := s.droppedPercent()
 		msg := fmt.Sprintf("FPS: %0.2f Server: %0.2f Drop: %0.1f%% Ping: %-3v ms Jit: %-3v ms",
 			ebiten.ActualFPS(), fps, drop, lat.Milliseconds(), jit.Milliseconds())
 		w, h := text.Measure(msg, mainFont, 0)
@@ -2217,9 +2235,10 @@ func drawServerFPS(screen *ebiten.Image, ox, oy int, fps float64) {
 
 }
 
-// equippedItemPicts returns pict IDs for items equipped in right and left hands.
+// equippedItemPicts returns pict IDs for items equipped in right and left
+// hands by the character in the game window.
 func equippedItemPicts() (uint16, uint16) {
-	items := getInventory()
+	items := focusedSession().getInventory()
 	var rightID, leftID uint16
 	var bothIDRight, bothIDLeft uint16
 	if clImages != nil {
@@ -2315,6 +2334,7 @@ func runGame(ctx context.Context) {
 		log.Printf("ebiten: %v", err)
 	}
 	saveSettings()
+	flushChatHistory()
 }
 
 func initGame() {
@@ -2323,7 +2343,7 @@ func initGame() {
 	ebiten.SetTPS(ebiten.SyncWithFPS)
 	ebiten.SetCursorShape(ebiten.CursorShapeDefault)
 
-	resetInventory()
+	mainSession.resetInventory()
 
 	loadSettings()
 	theme := gs.Theme
@@ -2451,19 +2471,19 @@ func onGameWindowResize() {
 	layoutNotifications()
 }
 
-func noteFrame() {
+func (s *session) noteFrame() {
 	if playingMovie {
 		return
 	}
 	now := time.Now()
-	frameMu.Lock()
-	if !lastFrameTime.IsZero() {
-		dt := now.Sub(lastFrameTime)
+	s.frameMu.Lock()
+	if !s.lastFrameTime.IsZero() {
+		dt := now.Sub(s.lastFrameTime)
 		ms := int(dt.Round(10*time.Millisecond) / time.Millisecond)
 		if ms > 0 {
-			intervalHist[ms]++
+			s.intervalHist[ms]++
 			var modeMS, modeCount int
-			for v, c := range intervalHist {
+			for v, c := range s.intervalHist {
 				if c > modeCount {
 					modeMS, modeCount = v, c
 				}
@@ -2473,20 +2493,22 @@ func noteFrame() {
 				if fps < 1 {
 					fps = 1
 				}
-				serverFPS = fps
-				frameInterval = time.Second / time.Duration(fps)
+				s.serverFPS = fps
+				s.frameInterval = time.Second / time.Duration(fps)
 			}
 		}
 	}
-	lastFrameTime = now
-	frameMu.Unlock()
+	s.lastFrameTime = now
+	s.frameMu.Unlock()
 	select {
-	case frameCh <- struct{}{}:
+	case s.frames <- struct{}{}:
 	default:
 	}
 }
 
-func sendInputLoop(ctx context.Context, udpConn, tcpConn net.Conn) {
+// sendInputLoop sends s's input once per server frame: the player's mouse
+// while s is in the game window and an idle one otherwise.
+func sendInputLoop(ctx context.Context, s *session, udpConn, tcpConn net.Conn) {
 	// nextReliable determines when to send the next keep-alive packet via
 	// the reliable channel to preserve NAT mappings.
 	var nextReliable time.Time
@@ -2494,21 +2516,24 @@ func sendInputLoop(ctx context.Context, udpConn, tcpConn net.Conn) {
 		select {
 		case <-ctx.Done():
 			return
-		case <-frameCh:
+		case <-s.frames:
 		}
-		frameMu.Lock()
-		last := lastFrameTime
-		frameMu.Unlock()
+		s.frameMu.Lock()
+		last := s.lastFrameTime
+		s.frameMu.Unlock()
 		if time.Since(last) > 2*time.Second || udpConn == nil {
 			continue
 		}
-		inputMu.Lock()
-		s := latestInput
-		inputMu.Unlock()
+		var in inputState
+		if s.isFocused() {
+			inputMu.Lock()
+			in = latestInput
+			inputMu.Unlock()
+		}
 
 		reliable := false
 		now := time.Now()
-		if now.After(nextReliable) && pendingCommand == "" && tcpConn != nil {
+		if now.After(nextReliable) && !s.commandPending() && tcpConn != nil {
 			reliable = true
 			// next packet will be 3 to 5 minutes from now
 			nextReliable = now.Add(3*time.Minute + time.Duration(rand.Intn(120))*time.Second)
@@ -2516,9 +2541,9 @@ func sendInputLoop(ctx context.Context, udpConn, tcpConn net.Conn) {
 
 		var err error
 		if reliable {
-			err = sendPlayerInput(tcpConn, s.mouseX, s.mouseY, s.mouseDown, true)
+			err = s.sendPlayerInput(tcpConn, in.mouseX, in.mouseY, in.mouseDown, true)
 		} else {
-			err = sendPlayerInput(udpConn, s.mouseX, s.mouseY, s.mouseDown, false)
+			err = s.sendPlayerInput(udpConn, in.mouseX, in.mouseY, in.mouseDown, false)
 		}
 		if err != nil {
 			logError("send player input: %v", err)
@@ -2526,7 +2551,7 @@ func sendInputLoop(ctx context.Context, udpConn, tcpConn net.Conn) {
 	}
 }
 
-func udpReadLoop(ctx context.Context, conn net.Conn) {
+func udpReadLoop(ctx context.Context, s *session, conn net.Conn) {
 	for {
 		if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
 			logError("udp deadline: %v", err)
@@ -2543,71 +2568,32 @@ func udpReadLoop(ctx context.Context, conn net.Conn) {
 				}
 			}
 			logError("udp read error: %v", err)
-			handleDisconnect()
+			s.connectionLost()
 			return
 		}
-		tag := binary.BigEndian.Uint16(m[:2])
-		flags := frameFlags(m)
-		if recorder != nil {
-			if !wroteLoginBlocks {
-				if tag == 2 { // first draw state
-					if len(loginGameState) > 0 {
-						recorder.AddBlock(gameStateBlock(loginGameState), flagGameState)
-					}
-					if len(loginMobileData) > 0 {
-						recorder.AddBlock(loginMobileData, flagMobileData)
-					}
-					if len(loginPictureTable) > 0 {
-						recorder.AddBlock(loginPictureTable, flagPictureTable)
-					}
-					wroteLoginBlocks = true
-					if err := recorder.WriteFrame(m, flags); err != nil {
-						logError("record frame: %v", err)
-					}
-				} else {
-					if flags&flagGameState != 0 {
-						payload := append([]byte(nil), m[2:]...)
-						parseGameState(payload, uint16(clientVersion), uint16(movieRevision))
-						loginGameState = payload
-					}
-					if flags&flagMobileData != 0 {
-						payload := append([]byte(nil), m[2:]...)
-						parseMobileTable(payload, 0, uint16(clientVersion), uint16(movieRevision))
-						loginMobileData = payload
-					}
-					if flags&flagPictureTable != 0 {
-						payload := append([]byte(nil), m[2:]...)
-						loginPictureTable = payload
-					}
-				}
-			} else {
-				if err := recorder.WriteFrame(m, flags); err != nil {
-					logError("record frame: %v", err)
-				}
-			}
-		}
-		latencyMu.Lock()
-		if !lastInputSent.IsZero() {
-			rtt := time.Since(lastInputSent)
-			if netLatency == 0 {
-				netLatency = rtt
-				netJitter = 0
+		s.recordMessage(m)
+		s.latencyMu.Lock()
+		if !s.lastInputSent.IsZero() {
+			rtt := time.Since(s.lastInputSent)
+			if s.netLatency == 0 {
+				s.netLatency = rtt
+				s.netJitter = 0
 			} else {
-				diff := rtt - netLatency
+				diff := rtt - s.netLatency
 				if diff < 0 {
 					diff = -diff
 				}
-				netJitter = (netJitter*7 + diff) / 8
-				netLatency = (netLatency*7 + rtt) / 8
+				s.netJitter = (s.netJitter*7 + diff) / 8
+				s.netLatency = (s.netLatency*7 + rtt) / 8
 			}
-			lastInputSent = time.Time{}
+			s.lastInputSent = time.Time{}
 		}
-		latencyMu.Unlock()
-		processServerMessage(m)
+		s.latencyMu.Unlock()
+		s.processServerMessage(m)
 	}
 }
 
-func tcpReadLoop(ctx context.Context, conn net.Conn) {
+func tcpReadLoop(ctx context.Context, s *session, conn net.Conn) {
 loop:
 	for {
 		if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
@@ -2625,56 +2611,17 @@ loop:
 				}
 			}
 			logError("read error: %v", err)
-			handleDisconnect()
+			s.connectionLost()
 			break
 		}
-		tag := binary.BigEndian.Uint16(m[:2])
-		flags := frameFlags(m)
-		if recorder != nil {
-			if !wroteLoginBlocks {
-				if tag == 2 { // first draw state
-					if len(loginGameState) > 0 {
-						recorder.AddBlock(gameStateBlock(loginGameState), flagGameState)
-					}
-					if len(loginMobileData) > 0 {
-						recorder.AddBlock(loginMobileData, flagMobileData)
-					}
-					if len(loginPictureTable) > 0 {
-						recorder.AddBlock(loginPictureTable, flagPictureTable)
-					}
-					wroteLoginBlocks = true
-					if err := recorder.WriteFrame(m, flags); err != nil {
-						logError("record frame: %v", err)
-					}
-				} else {
-					if flags&flagGameState != 0 {
-						payload := append([]byte(nil), m[2:]...)
-						parseGameState(payload, uint16(clientVersion), uint16(movieRevision))
-						loginGameState = payload
-					}
-					if flags&flagMobileData != 0 {
-						payload := append([]byte(nil), m[2:]...)
-						parseMobileTable(payload, 0, uint16(clientVersion), uint16(movieRevision))
-						loginMobileData = payload
-					}
-					if flags&flagPictureTable != 0 {
-						payload := append([]byte(nil), m[2:]...)
-						loginPictureTable = payload
-					}
-				}
-			} else {
-				if err := recorder.WriteFrame(m, flags); err != nil {
-					logError("record frame: %v", err)
-				}
-			}
-		}
-		processServerMessage(m)
+		s.recordMessage(m)
+		s.processServerMessage(m)
 		// Allow maintenance queues to issue commands even when the
 		// player isn't moving; this keeps /be-info and /be-who flowing
 		// during idle periods on live connections.
-		if pendingCommand == "" {
-			if !maybeEnqueueInfo() {
-				_ = maybeEnqueueWho()
+		if !s.commandPending() {
+			if !s.maybeEnqueueInfo() {
+				_ = s.maybeEnqueueWho()
 			}
 		}
 		select {
@@ -2685,43 +2632,6 @@ loop:
 	}
 }
 
-func frameFlags(m []byte) uint16 {
-	flags := uint16(0)
-	if gPlayersListIsStale {
-		flags |= flagStale
-	}
-	switch {
-	case looksLikeGameState(m):
-		flags |= flagGameState
-	case looksLikeMobileData(m):
-		flags |= flagMobileData
-	case looksLikePictureTable(m):
-		flags |= flagPictureTable
-	}
-	return flags
-}
-
-func looksLikeGameState(m []byte) bool {
-	if i := bytes.IndexByte(m, 0); i >= 0 {
-		rest := m[i+1:]
-		return looksLikePictureTable(rest) || looksLikeMobileData(rest)
-	}
-	return false
-}
-
-func looksLikeMobileData(m []byte) bool {
-	return bytes.Contains(m, []byte{0xff, 0xff, 0xff, 0xff})
-}
-
-func looksLikePictureTable(m []byte) bool {
-	if len(m) < 2 {
-		return false
-	}
-	count := int(binary.BigEndian.Uint16(m[:2]))
-	size := 2 + 6*count + 4
-	return count > 0 && size == len(m)
-}
-
 // roundToInt returns the nearest integer to f. It avoids calling math.Round
 // and handles negative values correctly.
 func roundToInt(f float64) int {
@@ -2730,3 +2640,78 @@ func roundToInt(f float64) int {
 	}
 	return int(f - 0.5)
 }
+
+// submitInput handles a line entered in the input bar: macros and local
+// handlers run first, then plugin commands, and anything left is sent to
+// the server.
+func submitInput(line string) {
+	orig := expandClassicReplacements(line)
+	txt := ""
+	if runClassicExpressionMacro(orig) {
+		inputHistory = append(inputHistory, strings.TrimSpace(orig))
+	} else {
+		txt = runInputHandlers(orig)
+		txt = strings.TrimSpace(txt)
+		if txt == "" {
+			// If handlers removed the text, fall back to the user's
+			// original entry so it's still sent.
+			txt = strings.TrimSpace(orig)
+		}
+	}
+	if txt != "" {
+		if strings.HasPrefix(txt, "/play ") {
+			tune := strings.TrimSpace(txt[len("/play "):])
+			if musicDebug {
+				msg := "/play " + tune
+				consoleMessage(msg)
+				chatMessage(msg)
+				log.Print(msg)
+			}
+			go func() {
+				if err := playClanLordTune(tune); err != nil {
+					log.Printf("play tune: %v", err)
+					if musicDebug {
+						consoleMessage("play tune: " + err.Error())
+						chatMessage("play tune: " + err.Error())
+					}
+				}
+			}()
+		} else {
+			// Try alt session and plugin-registered commands first
+			if runSessionCommand(txt) {
+				consoleMessage("> " + txt)
+			} else if strings.HasPrefix(txt, "/") {
+				parts := strings.SplitN(strings.TrimPrefix(txt, "/"), " ", 2)
+				name := strings.ToLower(parts[0])
+				args := ""
+				if len(parts) > 1 {
+					args = parts[1]
+				}
+				if handler, ok := pluginCommands[name]; ok && handler != nil {
+					owner := pluginCommandOwners[name]
+					if !pluginDisabled[owner] {
+						consoleMessage("> " + txt)
+						go handler(args)
+					} else {
+						// Disabled plugin commands should fall through so the
+						// server still receives the user's input.
+						sendInputCommand(txt)
+					}
+				} else {
+					sendInputCommand(txt)
+				}
+			} else {
+				sendInputCommand(txt)
+			}
+			//consoleMessage("> " + txt)
+		}
+		inputHistory = append(inputHistory, txt)
+	}
+}
+
+// sendInputCommand queues txt behind any commands still waiting to go out,
+// so lines submitted within one input tick are all sent in order.
+func sendInputCommand(txt string) {
+	queueCommand(txt)
+	nextCommand()
+}
@@ -22,6 +22,7 @@ func Console(msg string) {}
 func ShowNotification(msg string) {}
 
 // AddHotkey binds a key combo to a slash command.
+// Needs the "commands" permission.
 func AddHotkey(combo, command string) {}
 
 // HotkeyCommand mirrors the command bound to a hotkey.
@@ -42,15 +43,19 @@ type Hotkey struct {
 func Hotkeys() []Hotkey { return nil }
 
 // RemoveHotkey removes a plugin-owned hotkey by combo.
+// Needs the "commands" permission.
 func RemoveHotkey(combo string) {}
 
 // RegisterCommand handles a local slash command like "/example".
+// Needs the "input" permission.
 func RegisterCommand(command string, handler func(args string)) {}
 
 // RunCommand queues a command to send immediately to the server.
+// Needs the "commands" permission.
 func RunCommand(cmd string) {}
 
 // EnqueueCommand queues a command for the next tick without echoing.
+// Needs the "commands" permission.
 func EnqueueCommand(cmd string) {}
 
 // IgnoreCase reports whether a and b are equal ignoring capitalization.
@@ -87,12 +92,15 @@ func Words(text string) []string { return nil }
 func Join(parts []string, sep string) string { return "" }
 
 // AddMacro replaces a short prefix with a full command in the chat box.
+// Needs the "commands" permission.
 func AddMacro(short, full string) {}
 
 // AddMacros registers multiple macros at once.
+// Needs the "commands" permission.
 func AddMacros(macros map[string]string) {}
 
 // AutoReply sends a command when a chat message begins with trigger.
+// Needs the "commands" and "chat" permissions.
 func AutoReply(trigger, command string) {}
 
 // PlayerName returns the current player's name.
@@ -130,16 +138,20 @@ func Players() []Player { return nil }
 
 // RegisterTriggers registers a callback for chat messages containing any phrase
 // from the specified player name. An empty name matches any speaker.
+// Needs the "chat" permission.
 func RegisterTriggers(name string, phrases []string, fn func(msg string)) {}
 
 // RegisterConsoleTriggers registers a callback for console messages containing
 // any phrase.
+// Needs the "chat" permission.
 func RegisterConsoleTriggers(phrases []string, fn func()) {}
 
 // RegisterTriggers registers a callback for messages containing any phrase.
+// Needs the "chat" permission.
 func RegisterTrigger(name string, phrase string, fn func()) {}
 
 // RegisterInputHandler registers a callback to modify input text before sending.
+// Needs the "input" permission.
 func RegisterInputHandler(fn func(text string) string) {}
 
 // RegisterPlayerHandler registers a callback for player info updates.
@@ -161,12 +173,15 @@ type InventoryItem struct {
 func Inventory() []InventoryItem { return nil }
 
 // ToggleEquip toggles the equipped state of an item by ID.
+// Needs the "equipment" permission.
 func ToggleEquip(id uint16) {}
 
 // InputText returns the current text in the input bar.
+// Needs the "input" permission.
 func InputText() string { return "" }
 
 // SetInputText replaces the text in the input bar.
+// Needs the "input" permission.
 func SetInputText(text string) {}
 
 // Stats mirrors the player's HP, SP, and balance values.
@@ -180,38 +195,69 @@ type Stats struct {
 func PlayerStats() Stats { return Stats{} }
 
 // Equip equips the specified item by ID if it isn't already equipped.
+// Needs the "equipment" permission.
 func Equip(id uint16) {}
 
 // Unequip removes the specified item by ID if it is currently equipped.
+// Needs the "equipment" permission.
 func Unequip(id uint16) {}
 
 // PlaySound plays the sounds referenced by the provided IDs.
 func PlaySound(ids []uint16) {}
 
 // KeyPressed reports whether the given key is currently pressed.
+// Needs the "input" permission.
 func KeyPressed(name string) bool { return false }
 
 // KeyJustPressed reports whether the given key was pressed this frame.
+// Needs the "input" permission.
 func KeyJustPressed(name string) bool { return false }
 
 // MousePressed reports whether the given mouse button is pressed.
+// Needs the "input" permission.
 func MousePressed(name string) bool { return false }
 
 // MouseJustPressed reports whether the given mouse button was pressed this frame.
+// Needs the "input" permission.
 func MouseJustPressed(name string) bool { return false }
 
 // MouseWheel returns the scroll wheel delta since the last frame.
+// Needs the "input" permission.
 func MouseWheel() (float64, float64) { return 0, 0 }
 
-// Mobile contains basic info about a clicked mobile.
+// Mobile contains basic info about a mobile in the world.
 type Mobile struct {
 	Index  uint8
 	Name   string
 	H, V   int16
 	PictID uint16
 	Colors uint8
+	State  uint8
+	Fallen bool
 }
 
+// Mobiles returns the mobiles in the current frame.
+func Mobiles() []Mobile { return nil }
+
+// MobileByName finds a visible mobile by name, ignoring case.
+func MobileByName(name string) (Mobile, bool) { return Mobile{}, false }
+
+// SelfPosition returns your mobile's position; ok is false when it is not
+// on screen.
+func SelfPosition() (h, v int16, ok bool) { return 0, 0, false }
+
+// Picture describes a picture placed in the current frame.
+type Picture struct {
+	PictID     uint16
+	H, V       int16
+	Plane      int
+	Moving     bool
+	Background bool
+}
+
+// Pictures returns the pictures in the current frame.
+func Pictures() []Picture { return nil }
+
 // ClickInfo describes the last click in the game world.
 type ClickInfo struct {
 	X, Y     int16
@@ -220,6 +266,7 @@ type ClickInfo struct {
 }
 
 // LastClick returns information about the last left-click in the world.
+// Needs the "input" permission.
 func LastClick() ClickInfo { return ClickInfo{} }
 
 // EquippedItems returns the items currently equipped.
@@ -232,10 +279,172 @@ func HasItem(name string) bool { return false }
 func FrameNumber() int { return 0 }
 
 // StorageGet retrieves a value previously stored with StorageSet.
+// Needs the "storage" permission.
 func StorageGet(key string) any { return nil }
 
 // StorageSet stores a value associated with key for the plugin.
+// Needs the "storage" permission.
 func StorageSet(key string, value any) {}
 
 // StorageDelete removes a stored value for key.
+// Needs the "storage" permission.
 func StorageDelete(key string) {}
+
+// Event names accepted by On.
+const (
+	EventFallen    = "fallen"
+	EventShare     = "share"
+	EventWho       = "who"
+	EventPresence  = "presence"
+	EventKarma     = "karma"
+	EventMusic     = "music"
+	EventInventory = "inventory"
+)
+
+// Event is passed to On handlers. Name says which payload is set.
+type Event struct {
+	Name      string
+	Fallen    *FallenEvent
+	Share     *ShareEvent
+	Who       *WhoEvent
+	Presence  *PresenceEvent
+	Karma     *KarmaEvent
+	Music     *MusicEvent
+	Inventory *InventoryEvent
+}
+
+// FallenEvent reports a player falling or getting back up.
+type FallenEvent struct {
+	Name   string
+	Fallen bool
+	Killer string
+	Where  string
+}
+
+// ShareEvent reports a share starting or ending. Sharee is true when you
+// share Name and false when Name shares you.
+type ShareEvent struct {
+	Name   string
+	Sharee bool
+	Active bool
+}
+
+// WhoEvent lists the players named in a who list.
+type WhoEvent struct {
+	Names []string
+}
+
+// PresenceEvent reports a player logging on or off.
+type PresenceEvent struct {
+	Name   string
+	Online bool
+}
+
+// KarmaEvent reports karma given to you (Received) or by you.
+type KarmaEvent struct {
+	Name     string
+	Good     bool
+	Received bool
+	Text     string // empty unless the plugin has the "chat" permission
+}
+
+// MusicEvent reports a tune or stop request from a bard.
+type MusicEvent struct {
+	Who        int
+	Instrument int
+	Tempo      int
+	Notes      string
+	Stop       bool
+}
+
+// InventoryEvent reports a server change to your inventory. Items is the
+// inventory after the change.
+type InventoryEvent struct {
+	Action string
+	ID     uint16
+	Index  int
+	Name   string
+	Items  []InventoryItem
+}
+
+// On registers fn to run whenever an event with the given name happens.
+func On(event string, fn func(Event)) {}
+
+// OverlayPos places an overlay item. Build one with WorldPos, ScreenPos or
+// MobilePos.
+type OverlayPos struct {
+	Anchor int
+	X, Y   int
+	Mobile string
+}
+
+// Color is an RGBA overlay color.
+type Color struct {
+	R, G, B, A uint8
+}
+
+// RGBA returns a Color.
+func RGBA(r, g, b, a uint8) Color { return Color{r, g, b, a} }
+
+// WorldPos is a position in world coordinates, relative to the field center.
+func WorldPos(h, v int) OverlayPos { return OverlayPos{} }
+
+// ScreenPos is a position in game pixels from the top-left of the field.
+func ScreenPos(x, y int) OverlayPos { return OverlayPos{} }
+
+// MobilePos is offset from the named mobile; items anchored to a mobile that
+// is not on screen are skipped.
+func MobilePos(name string, dh, dv int) OverlayPos { return OverlayPos{} }
+
+// DrawText adds text to the plugin's overlay. Overlay items last one frame,
+// so draw them from an OnFrame callback; up to 256 per frame are kept.
+func DrawText(pos OverlayPos, text string, c Color) {}
+
+// DrawRect adds a rectangle outline, or a filled rectangle, to the overlay.
+func DrawRect(pos OverlayPos, w, h int, c Color, filled bool) {}
+
+// DrawLine adds a line to the overlay.
+func DrawLine(from, to OverlayPos, c Color) {}
+
+// DrawImage adds a picture from CL_Images, centered on pos, to the overlay.
+func DrawImage(pictID uint16, pos OverlayPos) {}
+
+// ClearOverlay discards what the plugin has drawn for the next frame.
+func ClearOverlay() {}
+
+// NewWindow creates a hidden window and returns its handle. Its zone is
+// remembered between sessions by plugin and title.
+func NewWindow(title string) int { return 0 }
+
+// ShowWindow opens a window created with NewWindow.
+func ShowWindow(win int) {}
+
+// CloseWindow closes a window created with NewWindow.
+func CloseWindow(win int) {}
+
+// AddText adds a line of text to a window and returns the item handle.
+func AddText(win int, text string) int { return 0 }
+
+// AddButton adds a button that calls fn when clicked.
+func AddButton(win int, text string, fn func()) int { return 0 }
+
+// AddSlider adds a slider that calls fn with the new value when moved.
+func AddSlider(win int, label string, min, max, value float64, fn func(float64)) int { return 0 }
+
+// AddInput adds a text input that calls fn with the new text when edited.
+func AddInput(win int, label, value string, fn func(string)) int { return 0 }
+
+// SetText changes the text of an item added with AddText, AddButton or AddInput.
+func SetText(item int, text string) {}
+
+// After calls fn once after d and returns a timer id for Cancel.
+func After(d time.Duration, fn func()) int { return 0 }
+
+// Every calls fn every d until cancelled and returns a timer id.
+func Every(d time.Duration, fn func()) int { return 0 }
+
+// OnFrame calls fn once per game tick until cancelled and returns a timer id.
+func OnFrame(fn func()) int { return 0 }
+
+// Cancel stops a timer started with After, Every or OnFrame.
+func Cancel(id int) {}
@@ -0,0 +1,605 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	// hdPackManifestName is the file describing a texture pack.
+	hdPackManifestName = "pack.json"
+	// hdLoosePack is the ID of the implicit pack made of the PNGs placed
+	// directly in data/hd, which is where overrides lived before packs.
+	hdLoosePack = "."
+)
+
+// hdPackManifest is the pack.json at the root of a texture pack.
+type hdPackManifest struct {
+	Name    string `json:"name"`
+	Author  string `json:"author"`
+	Version string `json:"version"`
+	// ImagesVersion is the CL_Images version the pack was made for.
+	ImagesVersion int `json:"imagesVersion"`
+	// Scale is how many times larger than the originals the pack's
+	// images are. Zero means each image's size decides.
+	Scale float64 `json:"scale"`
+}
+
+// hdOverrideKey names what a pack file replaces. frame is -1 for a file
+// holding the whole sprite sheet.
+type hdOverrideKey struct {
+	id    uint16
+	frame int
+}
+
+type hdOverrideFile struct {
+	name  string  // path within the pack
+	scale float64 // from an @2x style suffix, 0 if none
+}
+
+// hdPack is a texture pack: a directory or zip file under data/hd.
+type hdPack struct {
+	id       string // directory or zip name under data/hd
+	path     string
+	zipped   bool
+	prefix   string // folder inside the zip holding the pack, if any
+	manifest hdPackManifest
+	files    map[hdOverrideKey]hdOverrideFile
+	err      string // problem reading the manifest
+}
+
+// hdFrame is an override ready to draw, scale times the original size.
+type hdFrame struct {
+	img   *ebiten.Image
+	scale float64
+}
+
+var (
+	hdPackMu sync.Mutex
+	hdPacks  []*hdPack // every installed pack, by ID
+	hdActive []*hdPack // enabled packs, highest priority first
+
+	// hdFrameCache holds decoded overrides keyed like imageCache, nil
+	// where no enabled pack replaces the frame. Guarded by imageMu.
+	hdFrameCache = make(map[imageKey]*hdFrame)
+	// hdIconCache holds overrides resampled to their CL_Images size for
+	// loadImage, nil where there is none. Guarded by imageMu.
+	hdIconCache = make(map[uint16]*ebiten.Image)
+
+	hdModTimes    map[string]time.Time // pack files as last loaded
+	hdPendingMods map[string]time.Time // pack files as last seen
+	hdModChanged  time.Time            // when hdPendingMods last changed
+	hdModCheck    time.Time
+)
+
+// hdPackDir returns the folder texture packs are installed in.
+func hdPackDir() string {
+	return filepath.Join(dataDirPath, "hd")
+}
+
+// parseHDOverrideName reads a pack file name of the form
+// <id>[-<frame>][@<scale>x].png. Without a frame the file replaces the
+// whole sprite sheet.
+func parseHDOverrideName(name string) (hdOverrideKey, float64, bool) {
+	base, ok := strings.CutSuffix(strings.ToLower(name), ".png")
+	if !ok {
+		return hdOverrideKey{}, 0, false
+	}
+	var scale float64
+	if b, s, ok := strings.Cut(base, "@"); ok {
+		s, ok = strings.CutSuffix(s, "x")
+		v, err := strconv.ParseFloat(s, 64)
+		if !ok || err != nil || v <= 0 || math.IsInf(v, 0) {
+			return hdOverrideKey{}, 0, false
+		}
+		base, scale = b, v
+	}
+	key := hdOverrideKey{frame: -1}
+	if b, f, ok := strings.Cut(base, "-"); ok {
+		v, err := strconv.Atoi(f)
+		if err != nil || v < 0 {
+			return hdOverrideKey{}, 0, false
+		}
+		base, key.frame = b, v
+	}
+	id, err := strconv.ParseUint(base, 10, 16)
+	if err != nil {
+		return hdOverrideKey{}, 0, false
+	}
+	key.id = uint16(id)
+	return key, scale, true
+}
+
+// hdOverrideScale works out how many times larger a pw×ph override is
+// than the w×h frame of a picture with the given number of frames. A
+// sheet file may hold every frame stacked top to bottom, as CL_Images
+// does, or only the first frame; whole reports which. want is the scale
+// the pack declares, or 0 to take it from the width. It returns 0 if the
+// size fits neither.
+func hdOverrideScale(pw, ph, w, h, frames int, sheet bool, want float64) (scale float64, whole bool) {
+	if pw <= 0 || ph <= 0 || w <= 0 || h <= 0 {
+		return 0, false
+	}
+	fits := func(rows int) float64 {
+		s := want
+		if s <= 0 {
+			s = float64(pw) / float64(w)
+		}
+		if math.Abs(float64(pw)-float64(w)*s) > 1 || math.Abs(float64(ph)-float64(rows)*s) > 1 {
+			return 0
+		}
+		return s
+	}
+	if sheet && frames > 1 {
+		if s := fits(h * frames); s > 0 {
+			return s, true
+		}
+	}
+	return fits(h), false
+}
+
+// activeHDPacks orders the enabled packs by priority: those named in
+// enabled first, in that order, then with all set every other pack by ID.
+func activeHDPacks(packs []*hdPack, enabled []string, all bool) []*hdPack {
+	byID := make(map[string]*hdPack, len(packs))
+	for _, p := range packs {
+		byID[p.id] = p
+	}
+	var active []*hdPack
+	for _, id := range enabled {
+		if p := byID[id]; p != nil {
+			active = append(active, p)
+			delete(byID, id)
+		}
+	}
+	if all {
+		for _, p := range packs {
+			if byID[p.id] != nil {
+				active = append(active, p)
+			}
+		}
+	}
+	return active
+}
+
+// findHDOverride returns the highest priority pack file replacing frame
+// of picture id. Within a pack a file for the frame beats a sheet.
+func findHDOverride(packs []*hdPack, id uint16, frame int) (*hdPack, hdOverrideKey, bool) {
+	for _, p := range packs {
+		for _, k := range []hdOverrideKey{{id, frame}, {id, -1}} {
+			if _, ok := p.files[k]; ok {
+				return p, k, true
+			}
+		}
+	}
+	return nil, hdOverrideKey{}, false
+}
+
+// title is the pack's display name.
+func (p *hdPack) title() string {
+	if p.manifest.Name != "" {
+		return p.manifest.Name
+	}
+	if p.id == hdLoosePack {
+		return "Loose files in data/hd"
+	}
+	return strings.TrimSuffix(p.id, ".zip")
+}
+
+// hdPackInfo describes p for the Quality window. imagesVersion is the
+// installed CL_Images version, 0 if unknown.
+func hdPackInfo(p *hdPack, imagesVersion int) []string {
+	var lines []string
+	var about []string
+	if v := p.manifest.Version; v != "" {
+		about = append(about, "v"+v)
+	}
+	if a := p.manifest.Author; a != "" {
+		about = append(about, "by "+a)
+	}
+	about = append(about, fmt.Sprintf("%d images", len(p.files)))
+	lines = append(lines, strings.Join(about, ", "))
+	if want := p.manifest.ImagesVersion; want != 0 && imagesVersion != 0 && want != imagesVersion {
+		lines = append(lines, fmt.Sprintf("Made for CL_Images %d, you have %d", want, imagesVersion))
+	}
+	if p.err != "" {
+		lines = append(lines, p.err)
+	}
+	return lines
+}
+
+// read returns the contents of a file in the pack.
+func (p *hdPack) read(name string) ([]byte, error) {
+	if !p.zipped {
+		return os.ReadFile(filepath.Join(p.path, name))
+	}
+	// The zip is opened for each read rather than kept open so it can
+	// be replaced while the client runs.
+	zr, err := zip.OpenReader(p.path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	f, err := zr.Open(path.Join(p.prefix, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// index records the overrides among names and reads the manifest, if
+// there is one.
+func (p *hdPack) index(names []string) {
+	p.files = make(map[hdOverrideKey]hdOverrideFile)
+	for _, name := range names {
+		if strings.EqualFold(name, hdPackManifestName) {
+			p.readManifest(name)
+			continue
+		}
+		if k, scale, ok := parseHDOverrideName(name); ok {
+			p.files[k] = hdOverrideFile{name: name, scale: scale}
+		}
+	}
+}
+
+func (p *hdPack) readManifest(name string) {
+	data, err := p.read(name)
+	if err == nil {
+		err = json.Unmarshal(data, &p.manifest)
+	}
+	if err != nil {
+		p.err = "Bad " + hdPackManifestName + ": " + err.Error()
+		logError("hd pack %s: %v", p.id, err)
+	}
+}
+
+// openHDPackDir indexes the pack in directory dir. With loose set only
+// the override PNGs count, since the folder also holds the other packs.
+func openHDPackDir(id, dir string, loose bool) (*hdPack, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	p := &hdPack{id: id, path: dir}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() || loose && strings.EqualFold(e.Name(), hdPackManifestName) {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	p.index(names)
+	return p, nil
+}
+
+// openHDPackZip indexes the pack in a zip file. Packs made by zipping
+// their folder keep everything under that folder's name, so when the
+// manifest is not at the root the folder holding it is used.
+func openHDPackZip(id, file string) (*hdPack, error) {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	var all []string
+	for _, f := range zr.File {
+		if !f.FileInfo().IsDir() {
+			all = append(all, f.Name)
+		}
+	}
+	zr.Close()
+
+	p := &hdPack{id: id, path: file, zipped: true}
+	for _, name := range all {
+		if strings.EqualFold(path.Base(name), hdPackManifestName) {
+			if dir := path.Dir(name); p.prefix == "" || len(dir) < len(p.prefix) {
+				p.prefix = dir
+			}
+		}
+	}
+	if p.prefix == "." {
+		p.prefix = ""
+	}
+	var names []string
+	for _, name := range all {
+		rel, ok := name, true
+		if p.prefix != "" {
+			rel, ok = strings.CutPrefix(name, p.prefix+"/")
+		}
+		if ok && !strings.Contains(rel, "/") {
+			names = append(names, rel)
+		}
+	}
+	p.index(names)
+	return p, nil
+}
+
+// scanHDPacks finds the packs installed in dir.
+func scanHDPacks(dir string) []*hdPack {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var packs []*hdPack
+	loose := false
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		var p *hdPack
+		var err error
+		switch {
+		case e.IsDir():
+			p, err = openHDPackDir(name, filepath.Join(dir, name), false)
+		case strings.EqualFold(filepath.Ext(name), ".zip"):
+			p, err = openHDPackZip(name, filepath.Join(dir, name))
+		default:
+			_, _, ok := parseHDOverrideName(name)
+			loose = loose || ok
+			continue
+		}
+		if err != nil {
+			logError("hd pack %s: %v", name, err)
+			continue
+		}
+		packs = append(packs, p)
+	}
+	if loose {
+		if p, err := openHDPackDir(hdLoosePack, dir, true); err == nil {
+			packs = append([]*hdPack{p}, packs...)
+		}
+	}
+	return packs
+}
+
+// hdPackMods returns the modification time of everything in the packs
+// folder, looking one level into pack directories.
+func hdPackMods(dir string) map[string]time.Time {
+	mods := map[string]time.Time{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return mods
+	}
+	for _, e := range entries {
+		p := filepath.Join(dir, e.Name())
+		if info, err := e.Info(); err == nil {
+			mods[p] = info.ModTime()
+		}
+		if !e.IsDir() {
+			continue
+		}
+		sub, err := os.ReadDir(p)
+		if err != nil {
+			continue
+		}
+		for _, s := range sub {
+			if info, err := s.Info(); err == nil {
+				mods[filepath.Join(p, s.Name())] = info.ModTime()
+			}
+		}
+	}
+	return mods
+}
+
+// loadHDPacks scans the packs folder and enables the packs chosen in the
+// Quality window, or all of them with -hd. Cached overrides are dropped.
+func loadHDPacks() {
+	dir := hdPackDir()
+	packs := scanHDPacks(dir)
+	hdPackMu.Lock()
+	hdPacks = packs
+	hdActive = activeHDPacks(packs, gs.HDPacks, hdTextures)
+	hdModTimes = hdPackMods(dir)
+	hdPendingMods = hdModTimes
+	hdPackMu.Unlock()
+	dropHDCaches()
+}
+
+// dropHDCaches forgets decoded overrides and the blends made from them.
+func dropHDCaches() {
+	imageMu.Lock()
+	hdFrameCache = make(map[imageKey]*hdFrame)
+	hdIconCache = make(map[uint16]*ebiten.Image)
+	pictBlendCache = make(map[pictBlendKey]*ebiten.Image)
+	imageMu.Unlock()
+}
+
+// setHDPacks enables the packs in ids, highest priority first.
+func setHDPacks(ids []string) {
+	gs.HDPacks = ids
+	settingsDirty = true
+	hdPackMu.Lock()
+	hdActive = activeHDPacks(hdPacks, ids, hdTextures)
+	hdPackMu.Unlock()
+	dropHDCaches()
+}
+
+// checkHDPackMods polls the packs folder from Update and reloads the packs
+// once changed files have settled. It only looks while a pack is in use
+// or the Quality window could show a new one.
+func checkHDPackMods() {
+	if time.Since(hdModCheck) < 500*time.Millisecond {
+		return
+	}
+	hdModCheck = time.Now()
+	hdPackMu.Lock()
+	watching := len(hdActive) > 0
+	hdPackMu.Unlock()
+	if !watching && (qualityWin == nil || !qualityWin.IsOpen()) {
+		return
+	}
+	mods := hdPackMods(hdPackDir())
+	if !maps.Equal(mods, hdPendingMods) {
+		hdPendingMods = mods
+		hdModChanged = hdModCheck
+		return
+	}
+	if maps.Equal(mods, hdModTimes) || time.Since(hdModChanged) < pluginReloadDebounce {
+		return
+	}
+	loadHDPacks()
+	refreshHDPackList()
+	consoleMessage("HD texture packs reloaded.")
+}
+
+// loadPictureFrame is loadImageFrame for pictures drawn in the game
+// world, where an enabled texture pack may replace the frame. The scale
+// is how many times larger than the original the returned image is.
+func loadPictureFrame(id uint16, frame int) (*ebiten.Image, float64) {
+	if f := loadHDFrame(id, frame); f != nil {
+		return f.img, f.scale
+	}
+	return loadImageFrame(id, frame), 1
+}
+
+// loadHDFrame returns the enabled packs' override for a frame, or nil.
+func loadHDFrame(id uint16, frame int) *hdFrame {
+	hdPackMu.Lock()
+	active := hdActive
+	hdPackMu.Unlock()
+	if len(active) == 0 || clImages == nil {
+		return nil
+	}
+	frames := clImages.NumFrames(uint32(id))
+	if frames <= 0 {
+		frames = 1
+	}
+	frame %= frames
+	key := makeImageKey(id, frame)
+	if !gs.NoCaching {
+		imageMu.Lock()
+		f, ok := hdFrameCache[key]
+		imageMu.Unlock()
+		if ok {
+			return f
+		}
+	}
+
+	loaded := decodeHDOverride(active, id, frame, frames)
+	if !gs.NoCaching {
+		imageMu.Lock()
+		for k, f := range loaded {
+			hdFrameCache[k] = f
+		}
+		if _, ok := loaded[key]; !ok {
+			hdFrameCache[key] = nil
+		}
+		imageMu.Unlock()
+	}
+	return loaded[key]
+}
+
+// loadHDIcon returns the first frame of the enabled packs' override for
+// picture id resampled to its CL_Images size, or nil. Icons in the UI are
+// laid out by that size.
+func loadHDIcon(id uint16) *ebiten.Image {
+	if !gs.NoCaching {
+		imageMu.Lock()
+		img, ok := hdIconCache[id]
+		imageMu.Unlock()
+		if ok {
+			return img
+		}
+	}
+	var img *ebiten.Image
+	if f := loadHDFrame(id, 0); f != nil {
+		b := f.img.Bounds()
+		w, h := roundToInt(float64(b.Dx())/f.scale), roundToInt(float64(b.Dy())/f.scale)
+		if w > 0 && h > 0 {
+			img = newImage(w, h)
+			op := &ebiten.DrawImageOptions{Filter: ebiten.FilterLinear}
+			op.GeoM.Scale(float64(w)/float64(b.Dx()), float64(h)/float64(b.Dy()))
+			img.DrawImage(f.img, op)
+		}
+	}
+	if !gs.NoCaching {
+		imageMu.Lock()
+		hdIconCache[id] = img
+		imageMu.Unlock()
+	}
+	return img
+}
+
+// decodeHDOverride decodes the file replacing frame of picture id. For a
+// whole sheet every frame it covers is returned, so the sheet is only
+// decoded once.
+func decodeHDOverride(active []*hdPack, id uint16, frame, frames int) map[imageKey]*hdFrame {
+	p, k, ok := findHDOverride(active, id, frame)
+	if !ok {
+		return nil
+	}
+	file := p.files[k]
+	data, err := p.read(file.name)
+	var src image.Image
+	if err == nil {
+		src, err = png.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		logError("hd pack %s: %s: %v", p.id, file.name, err)
+		return nil
+	}
+	w, h := clImages.Size(uint32(id))
+	h /= frames
+	want := file.scale
+	if want == 0 {
+		want = p.manifest.Scale
+	}
+	pw, ph := src.Bounds().Dx(), src.Bounds().Dy()
+	scale, whole := hdOverrideScale(pw, ph, w, h, frames, k.frame < 0, want)
+	if scale == 0 {
+		logError("hd pack %s: %s is %dx%d, which does not fit picture %d (%dx%d, %d frames)",
+			p.id, file.name, pw, ph, id, w, h, frames)
+		return nil
+	}
+	img := newImageFromImage(src)
+	if !whole {
+		if k.frame < 0 && frame != 0 {
+			// A sheet file holding one frame only replaces the first.
+			return nil
+		}
+		return map[imageKey]*hdFrame{makeImageKey(id, frame): {img: img, scale: scale}}
+	}
+	loaded := make(map[imageKey]*hdFrame)
+	fh := float64(ph) / float64(frames)
+	for f := 0; f < frames; f++ {
+		// Frames with their own file, here or in a higher priority
+		// pack, are left to be loaded from it.
+		if fp, fk, _ := findHDOverride(active, id, f); fp != p || fk != k {
+			continue
+		}
+		y0, y1 := roundToInt(float64(f)*fh), roundToInt(float64(f+1)*fh)
+		sub := img.SubImage(image.Rect(0, y0, pw, y1)).(*ebiten.Image)
+		loaded[makeImageKey(id, f)] = &hdFrame{img: sub, scale: scale}
+	}
+	return loaded
+}
+
+// installedHDPacks returns every installed pack and the IDs of the
+// enabled ones, highest priority first.
+func installedHDPacks() ([]*hdPack, []string) {
+	hdPackMu.Lock()
+	defer hdPackMu.Unlock()
+	var enabled []string
+	for _, p := range hdActive {
+		enabled = append(enabled, p.id)
+	}
+	return slices.Clone(hdPacks), enabled
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseHDOverrideName(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   hdOverrideKey
+		scale float64
+		ok    bool
+	}{
+		{"1234.png", hdOverrideKey{1234, -1}, 0, true},
+		{"1234-3.PNG", hdOverrideKey{1234, 3}, 0, true},
+		{"7@2x.png", hdOverrideKey{7, -1}, 2, true},
+		{"7-0@1.5x.png", hdOverrideKey{7, 0}, 1.5, true},
+		{"pack.json", hdOverrideKey{}, 0, false},
+		{"tree.png", hdOverrideKey{}, 0, false},
+		{"70000.png", hdOverrideKey{}, 0, false},
+		{"7--1.png", hdOverrideKey{}, 0, false},
+		{"7@0x.png", hdOverrideKey{}, 0, false},
+		{"7@2.png", hdOverrideKey{}, 0, false},
+	}
+	for _, tt := range tests {
+		key, scale, ok := parseHDOverrideName(tt.name)
+		if ok != tt.ok || key != tt.key || scale != tt.scale {
+			t.Errorf("parseHDOverrideName(%q) = %v, %v, %v; want %v, %v, %v",
+				tt.name, key, scale, ok, tt.key, tt.scale, tt.ok)
+		}
+	}
+}
+
+func TestHDOverrideScale(t *testing.T) {
+	tests := []struct {
+		name           string
+		pw, ph         int
+		sheet          bool
+		want           float64
+		w, h, frames   int
+		wantScale      float64
+		wantWholeSheet bool
+	}{
+		{name: "whole sheet", pw: 64, ph: 192, sheet: true, w: 32, h: 32, frames: 3, wantScale: 2, wantWholeSheet: true},
+		{name: "first frame only", pw: 64, ph: 64, sheet: true, w: 32, h: 32, frames: 3, wantScale: 2},
+		{name: "one frame", pw: 96, ph: 96, w: 32, h: 32, frames: 3, wantScale: 3},
+		{name: "frame file with sheet size", pw: 64, ph: 192, w: 32, h: 32, frames: 3},
+		{name: "rounded", pw: 49, ph: 31, w: 33, h: 21, frames: 1, wantScale: 49.0 / 33},
+		{name: "declared scale", pw: 64, ph: 64, want: 2, w: 32, h: 32, frames: 1, wantScale: 2},
+		{name: "declared scale mismatch", pw: 64, ph: 64, want: 4, w: 32, h: 32, frames: 1},
+		{name: "wrong aspect", pw: 64, ph: 40, sheet: true, w: 32, h: 32, frames: 1},
+		{name: "unknown picture", pw: 64, ph: 64, sheet: true},
+	}
+	for _, tt := range tests {
+		scale, whole := hdOverrideScale(tt.pw, tt.ph, tt.w, tt.h, tt.frames, tt.sheet, tt.want)
+		if scale != tt.wantScale || whole != tt.wantWholeSheet {
+			t.Errorf("%s: got %v, %v; want %v, %v", tt.name, scale, whole, tt.wantScale, tt.wantWholeSheet)
+		}
+	}
+}
+
+func testHDPack(id string, keys ...hdOverrideKey) *hdPack {
+	p := &hdPack{id: id, files: map[hdOverrideKey]hdOverrideFile{}}
+	for _, k := range keys {
+		p.files[k] = hdOverrideFile{name: id}
+	}
+	return p
+}
+
+func TestHDPackPriority(t *testing.T) {
+	a := testHDPack("a", hdOverrideKey{1, -1})
+	b := testHDPack("b", hdOverrideKey{1, 2}, hdOverrideKey{5, -1})
+	c := testHDPack("c.zip", hdOverrideKey{5, 0})
+	packs := []*hdPack{a, b, c}
+
+	ids := func(ps []*hdPack) []string {
+		var out []string
+		for _, p := range ps {
+			out = append(out, p.id)
+		}
+		return out
+	}
+	if got := ids(activeHDPacks(packs, []string{"c.zip", "gone", "a"}, false)); !reflect.DeepEqual(got, []string{"c.zip", "a"}) {
+		t.Errorf("enabled = %v", got)
+	}
+	if got := ids(activeHDPacks(packs, []string{"b"}, true)); !reflect.DeepEqual(got, []string{"b", "a", "c.zip"}) {
+		t.Errorf("with -hd = %v", got)
+	}
+
+	active := []*hdPack{c, a, b}
+	tests := []struct {
+		id    uint16
+		frame int
+		pack  *hdPack
+		key   hdOverrideKey
+	}{
+		{1, 0, a, hdOverrideKey{1, -1}},
+		{1, 2, a, hdOverrideKey{1, -1}}, // a outranks b's frame file
+		{5, 0, c, hdOverrideKey{5, 0}},
+		{5, 1, b, hdOverrideKey{5, -1}},
+	}
+	for _, tt := range tests {
+		p, k, ok := findHDOverride(active, tt.id, tt.frame)
+		if !ok || p != tt.pack || k != tt.key {
+			t.Errorf("findHDOverride(%d, %d) = %v, %v, %v", tt.id, tt.frame, p, k, ok)
+		}
+	}
+	if _, _, ok := findHDOverride(active, 9, 0); ok {
+		t.Errorf("override found for a picture no pack has")
+	}
+	p, k, _ := findHDOverride([]*hdPack{b}, 1, 2)
+	if p != b || k != (hdOverrideKey{1, 2}) {
+		t.Errorf("frame file not preferred: %v", k)
+	}
+}
+
+func TestScanHDPacks(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("12.png", "")
+	write("notes.txt", "")
+	write("Trees/pack.json", `{"name":"Trees","author":"Ann","version":"1.2","imagesVersion":1340,"scale":2}`)
+	write("Trees/100.png", "")
+	write("Trees/100-1.png", "")
+	write("Trees/sub/101.png", "")
+	write(".hidden/1.png", "")
+
+	zf, err := os.Create(filepath.Join(dir, "Rocks.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(zf)
+	for name, data := range map[string]string{
+		"Rocks/pack.json":  `{"name":"Rocks"}`,
+		"Rocks/200@4x.png": "",
+		"Rocks/x/201.png":  "",
+		"Rocks2.png":       "",
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zf.Close()
+
+	packs := scanHDPacks(dir)
+	if len(packs) != 3 {
+		t.Fatalf("got %d packs", len(packs))
+	}
+	loose, rocks, trees := packs[0], packs[1], packs[2]
+	if loose.id != hdLoosePack || !reflect.DeepEqual(loose.files, map[hdOverrideKey]hdOverrideFile{{12, -1}: {name: "12.png"}}) {
+		t.Errorf("loose pack %+v", loose)
+	}
+	if rocks.id != "Rocks.zip" || rocks.prefix != "Rocks" || rocks.title() != "Rocks" ||
+		!reflect.DeepEqual(rocks.files, map[hdOverrideKey]hdOverrideFile{{200, -1}: {name: "200@4x.png", scale: 4}}) {
+		t.Errorf("zip pack %+v", rocks)
+	}
+	want := hdPackManifest{Name: "Trees", Author: "Ann", Version: "1.2", ImagesVersion: 1340, Scale: 2}
+	if trees.manifest != want || len(trees.files) != 2 {
+		t.Errorf("dir pack %+v", trees)
+	}
+	if got := hdPackInfo(trees, 1345); !reflect.DeepEqual(got, []string{"v1.2, by Ann, 2 images", "Made for CL_Images 1340, you have 1345"}) {
+		t.Errorf("info %q", got)
+	}
+	if got := hdPackInfo(trees, 1340); len(got) != 1 {
+		t.Errorf("version warning for a matching pack: %q", got)
+	}
+	if data, err := rocks.read("200@4x.png"); err != nil || len(data) != 0 {
+		t.Errorf("read from zip: %v", err)
+	}
+}
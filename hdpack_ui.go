@@ -0,0 +1,130 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+
+	"gothoom/eui"
+)
+
+// hdPackList is the Quality window's list of installed texture packs.
+var hdPackList *eui.ItemData
+
+// makeHDPackPane builds the Quality window's texture pack section.
+func makeHDPackPane(width float32) *eui.ItemData {
+	pane := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL}
+	pane.Size = eui.Point{X: width, Y: 10}
+
+	label, _ := eui.NewText()
+	label.Text = "\nHD Texture Packs:"
+	label.FontSize = 15
+	label.Size = eui.Point{X: width - 20, Y: 50}
+	pane.AddItem(label)
+
+	hdPackList = &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL}
+	hdPackList.Size = eui.Point{X: width, Y: 10}
+	pane.AddItem(hdPackList)
+	refreshHDPackList()
+	return pane
+}
+
+// refreshHDPackList lists the installed packs, enabled ones first in
+// priority order, each with a checkbox and buttons to move it up or down.
+func refreshHDPackList() {
+	if hdPackList == nil {
+		return
+	}
+	width := hdPackList.Size.X - 20
+	hdPackList.Contents = hdPackList.Contents[:0]
+	text := func(s string, size float32) {
+		t, _ := eui.NewText()
+		t.Text = s
+		t.FontSize = 11
+		t.Size = eui.Point{X: width, Y: size}
+		hdPackList.AddItem(t)
+	}
+
+	packs, enabled := installedHDPacks()
+	if len(packs) == 0 {
+		text("No packs installed. Put a pack folder or .zip in data/hd.", 40)
+		if qualityWin != nil {
+			qualityWin.Refresh()
+		}
+		return
+	}
+	if hdTextures {
+		text("All packs are on for this session (-hd).", 24)
+	}
+	imagesVersion := 0
+	if v, err := readKeyFileVersion(filepath.Join(dataDirPath, CL_ImagesFile)); err == nil {
+		imagesVersion = int(v >> 8)
+	}
+	slices.SortStableFunc(packs, func(a, b *hdPack) int {
+		ia, ib := slices.Index(enabled, a.id), slices.Index(enabled, b.id)
+		switch {
+		case ia < 0 && ib < 0:
+			return 0
+		case ia < 0:
+			return 1
+		case ib < 0:
+			return -1
+		}
+		return ia - ib
+	})
+
+	button := func(label string, fn func()) *eui.ItemData {
+		btn, events := eui.NewButton()
+		btn.Text = label
+		btn.Size = eui.Point{X: 24, Y: 24}
+		events.Handle = func(ev eui.UIEvent) {
+			if ev.Type == eui.EventClick {
+				fn()
+				refreshHDPackList()
+			}
+		}
+		return btn
+	}
+	for _, p := range packs {
+		id := p.id
+		row := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
+		cb, cbEvents := eui.NewCheckbox()
+		cb.Text = p.title()
+		cb.Size = eui.Point{X: width - 56, Y: 24}
+		cb.Checked = slices.Contains(enabled, id)
+		cbEvents.Handle = func(ev eui.UIEvent) {
+			if ev.Type != eui.EventCheckboxChanged {
+				return
+			}
+			ids := slices.DeleteFunc(slices.Clone(enabled), func(s string) bool { return s == id })
+			if ev.Checked {
+				ids = append(ids, id)
+			}
+			setHDPacks(ids)
+			refreshHDPackList()
+		}
+		row.AddItem(cb)
+		if i := slices.Index(enabled, id); i >= 0 {
+			row.AddItem(button("^", func() {
+				if i > 0 {
+					ids := slices.Clone(enabled)
+					ids[i-1], ids[i] = ids[i], ids[i-1]
+					setHDPacks(ids)
+				}
+			}))
+			row.AddItem(button("v", func() {
+				if i < len(enabled)-1 {
+					ids := slices.Clone(enabled)
+					ids[i], ids[i+1] = ids[i+1], ids[i]
+					setHDPacks(ids)
+				}
+			}))
+		}
+		hdPackList.AddItem(row)
+		for _, line := range hdPackInfo(p, imagesVersion) {
+			text("    "+line, 18)
+		}
+	}
+	if qualityWin != nil {
+		qualityWin.Refresh()
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// headless runs the client without a window: console and chat lines are
+// written to stdout as JSON and commands are read from stdin.
+var headless bool
+
+var (
+	headlessMu  sync.Mutex
+	headlessOut io.Writer = os.Stdout
+)
+
+// headlessPassEnv names the environment variable holding the -headless
+// character password.
+const headlessPassEnv = "THOOM_PASS"
+
+// headlessTickRate matches Ebiten's default TPS so macros pace the same
+// way they do in the windowed client.
+const headlessTickRate = 60
+
+// headlessLine is one line of the stdout stream. Type is "console",
+// "chat", "status" or "error".
+type headlessLine struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
+// headlessRequest is one line read from stdin. Plain text lines are treated
+// as {"type":"command","text":line}.
+type headlessRequest struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// headlessEmit writes a line to the stdout stream when running headless.
+func headlessEmit(typ, text string) {
+	if !headless {
+		return
+	}
+	data, err := json.Marshal(headlessLine{Type: typ, Time: time.Now(), Text: text})
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+	headlessMu.Lock()
+	headlessOut.Write(data)
+	headlessMu.Unlock()
+}
+
+// parseHeadlessRequest decodes one stdin line. Blank lines return ok=false.
+func parseHeadlessRequest(line string) (headlessRequest, bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return headlessRequest{}, false, nil
+	}
+	if !strings.HasPrefix(line, "{") {
+		return headlessRequest{Type: "command", Text: line}, true, nil
+	}
+	var req headlessRequest
+	if err := json.Unmarshal([]byte(line), &req); err != nil {
+		return headlessRequest{}, false, err
+	}
+	if req.Type == "" {
+		req.Type = "command"
+	}
+	return req, true, nil
+}
+
+// headlessReadInput reads requests from r until EOF or ctx is canceled.
+// A quit request calls quit.
+func headlessReadInput(ctx context.Context, r io.Reader, quit func()) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if ctx.Err() != nil {
+			return
+		}
+		req, ok, err := parseHeadlessRequest(sc.Text())
+		if err != nil {
+			headlessEmit("error", fmt.Sprintf("bad request: %v", err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		switch req.Type {
+		case "command":
+			if strings.TrimSpace(req.Text) != "" {
+				submitInput(req.Text)
+			}
+		case "quit":
+			quit()
+			return
+		default:
+			headlessEmit("error", fmt.Sprintf("unknown request type %q", req.Type))
+		}
+	}
+}
+
+// headlessTickLoop stands in for Game.Update, which never runs without a
+// window.
+func headlessTickLoop(ctx context.Context) {
+	t := time.NewTicker(time.Second / headlessTickRate)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			updateClassicMacros()
+			runPluginTimers(now)
+		}
+	}
+}
+
+// headlessCredentials fills in the password hash from the saved characters
+// when no password was given in THOOM_PASS.
+func headlessCredentials() error {
+	if mainSession.name == "" {
+		return fmt.Errorf("-name is required")
+	}
+	if pass != "" || passHash != "" {
+		return nil
+	}
+	for _, c := range characters {
+		if strings.EqualFold(c.Name, mainSession.name) && c.passHash != "" {
+			mainSession.name = c.Name
+			passHash = c.passHash
+			return nil
+		}
+		if strings.EqualFold(c.Name, mainSession.name) && c.Sealed != "" && charactersLocked() {
+			return fmt.Errorf("the saved password for %s is encrypted; set %s", c.Name, headlessPassEnv)
+		}
+	}
+	return fmt.Errorf("no saved password for %s; set %s", mainSession.name, headlessPassEnv)
+}
+
+// runHeadless logs in and streams the session until the server disconnects,
+// a quit request arrives or ctx is canceled.
+func runHeadless(ctx context.Context) error {
+	if err := headlessCredentials(); err != nil {
+		return err
+	}
+	ctx, quit := context.WithCancel(ctx)
+	defer quit()
+	defer flushChatHistory()
+	gameCtx = ctx
+
+	go headlessReadInput(ctx, os.Stdin, quit)
+	go headlessTickLoop(ctx)
+
+	loginCtx, cancel := context.WithCancel(ctx)
+	loginMu.Lock()
+	loginCancel = cancel
+	loginMu.Unlock()
+
+	headlessEmit("status", "Connecting to "+host+" as "+mainSession.name+".")
+	if err := login(loginCtx, clientVersion); err != nil {
+		headlessEmit("error", "login: "+err.Error())
+		return err
+	}
+	handleDisconnect()
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func useHeadless(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := headlessOut
+	headless = true
+	headlessOut = &buf
+	t.Cleanup(func() {
+		headless = false
+		headlessOut = prev
+		mainSession.clearCommands()
+	})
+	return &buf
+}
+
+func TestParseHeadlessRequest(t *testing.T) {
+	tests := []struct {
+		line string
+		want headlessRequest
+		ok   bool
+	}{
+		{"/who", headlessRequest{Type: "command", Text: "/who"}, true},
+		{`{"text":"/pose sit"}`, headlessRequest{Type: "command", Text: "/pose sit"}, true},
+		{`{"type":"quit"}`, headlessRequest{Type: "quit"}, true},
+		{"   ", headlessRequest{}, false},
+	}
+	for _, tt := range tests {
+		got, ok, err := parseHeadlessRequest(tt.line)
+		if err != nil || ok != tt.ok || got != tt.want {
+			t.Errorf("parseHeadlessRequest(%q) = %+v, %v, %v; want %+v, %v", tt.line, got, ok, err, tt.want, tt.ok)
+		}
+	}
+	if _, _, err := parseHeadlessRequest("{broken"); err == nil {
+		t.Errorf("expected error for malformed JSON")
+	}
+}
+
+func TestHeadlessEmitsConsoleAndChat(t *testing.T) {
+	buf := useHeadless(t)
+
+	consoleMessage("You sense healing energy from Bob.")
+	chatMessage("Bob says, \"hi\"")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines: %q", len(lines), buf.String())
+	}
+	var got []headlessLine
+	for _, l := range lines {
+		var hl headlessLine
+		if err := json.Unmarshal([]byte(l), &hl); err != nil {
+			t.Fatalf("unmarshal %q: %v", l, err)
+		}
+		got = append(got, hl)
+	}
+	if got[0].Type != "console" || got[0].Text != "You sense healing energy from Bob." {
+		t.Errorf("console line = %+v", got[0])
+	}
+	if got[1].Type != "chat" || got[1].Text != "Bob says, \"hi\"" {
+		t.Errorf("chat line = %+v", got[1])
+	}
+	if got[0].Time.IsZero() {
+		t.Errorf("missing timestamp")
+	}
+}
+
+func TestHeadlessReadInput(t *testing.T) {
+	buf := useHeadless(t)
+
+	quit := false
+	in := strings.NewReader("\n/who\n{\"type\":\"dance\"}\n{\"type\":\"quit\"}\n/ignored\n")
+	headlessReadInput(context.Background(), in, func() { quit = true })
+
+	if mainSession.pendingCommand != "/who" {
+		t.Errorf("pendingCommand = %q, want /who", mainSession.pendingCommand)
+	}
+	if !quit {
+		t.Errorf("quit request not handled")
+	}
+	if !strings.Contains(buf.String(), `"type":"error"`) || !strings.Contains(buf.String(), "dance") {
+		t.Errorf("unknown request not reported: %q", buf.String())
+	}
+}
+
+func TestHeadlessReadInputKeepsBackToBackCommands(t *testing.T) {
+	useHeadless(t)
+
+	var in strings.Builder
+	var want []string
+	for i := range 20 {
+		cmd := fmt.Sprintf("/think line %d", i)
+		want = append(want, cmd)
+		in.WriteString(cmd + "\n")
+	}
+	done := make(chan struct{})
+	go func() {
+		headlessReadInput(context.Background(), strings.NewReader(in.String()), func() {})
+		close(done)
+	}()
+
+	// Drain while stdin is still being read, as the network loop does.
+	var got []string
+	drain := func() {
+		for cmd := mainSession.takeCommand(); cmd != ""; cmd = mainSession.takeCommand() {
+			got = append(got, cmd)
+		}
+	}
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			drain()
+		}
+	}
+	drain()
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("sent %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+
+	"gothoom/eui"
+)
+
+const historyResultLimit = 500
+
+var (
+	historyWin     *eui.WindowData
+	historyList    *eui.ItemData
+	historyStatus  *eui.ItemData
+	historyResults []string
+	historyInputs  []*eui.ItemData
+
+	historyPlayer string
+	historyText   string
+	historyFrom   string
+	historyTo     string
+)
+
+func makeHistoryWindow() {
+	if historyWin != nil {
+		return
+	}
+	historyWin = eui.NewWindow()
+	historyWin.Title = "History"
+	historyWin.Size = eui.Point{X: 520, Y: 450}
+	historyWin.Closable = true
+	historyWin.Movable = true
+	historyWin.Resizable = true
+	historyWin.NoScroll = true
+	historyWin.SetZone(eui.HZoneCenter, eui.VZoneMiddleTop)
+
+	flow := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL, Fixed: true}
+	historyWin.AddItem(flow)
+
+	row := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL, Fixed: true}
+	row.Size = eui.Point{X: historyWin.Size.X, Y: 48}
+	field := func(label string, ptr *string, width float32) {
+		in, _ := eui.NewInput()
+		in.Label = label
+		in.TextPtr = ptr
+		in.Size = eui.Point{X: width, Y: 24}
+		in.Action = runHistorySearch
+		row.AddItem(in)
+		historyInputs = append(historyInputs, in)
+	}
+	field("Player", &historyPlayer, 110)
+	field("Text", &historyText, 150)
+	field("From", &historyFrom, 90)
+	field("To", &historyTo, 90)
+	searchBtn, searchEvents := eui.NewButton()
+	searchBtn.Text = "Search"
+	searchBtn.Size = eui.Point{X: 64, Y: 24}
+	searchEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			runHistorySearch()
+		}
+	}
+	row.AddItem(searchBtn)
+	flow.AddItem(row)
+
+	historyStatus, _ = eui.NewText()
+	historyStatus.Text = "Dates are YYYY-MM-DD; leave fields empty to match everything."
+	historyStatus.FontSize = 11
+	historyStatus.Size = eui.Point{X: historyWin.Size.X, Y: 20}
+	flow.AddItem(historyStatus)
+
+	historyList = &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL, Scrollable: true, Fixed: true}
+	flow.AddItem(historyList)
+
+	historyWin.OnResize = func() {
+		updateHistoryWindow()
+		historyWin.Refresh()
+	}
+	historyWin.AddWindow(false)
+	updateHistoryWindow()
+}
+
+func updateHistoryWindow() {
+	if historyWin == nil || historyList == nil {
+		return
+	}
+	updateTextWindow(historyWin, historyList, nil, historyResults, gs.ConsoleFontSize, "", nil)
+}
+
+// runHistorySearch searches the current character's history with the
+// window's filters and lists the newest matches first.
+func runHistorySearch() {
+	if historyWin == nil {
+		return
+	}
+	q, err := newHistoryQuery(historyPlayer, historyText, historyFrom, historyTo)
+	var entries []historyEntry
+	if err == nil {
+		q.Limit = historyResultLimit
+		entries, err = searchChatHistory(q)
+	}
+	format := gs.TimestampFormat
+	if format == "" {
+		format = "3:04PM"
+	}
+	historyResults = historyResults[:0]
+	for _, e := range entries {
+		historyResults = append(historyResults, fmt.Sprintf("[%s %s] %s", e.Time.Format("2006-01-02"), e.Time.Format(format), e.Text))
+	}
+	switch {
+	case err != nil:
+		historyStatus.Text = err.Error()
+	case len(entries) == historyResultLimit:
+		historyStatus.Text = fmt.Sprintf("Showing the newest %d matches", len(entries))
+	default:
+		historyStatus.Text = fmt.Sprintf("%d matches", len(entries))
+	}
+	historyStatus.Dirty = true
+	historyList.Scroll.Y = 0
+	updateHistoryWindow()
+	historyWin.Refresh()
+}
+
+// showPlayerHistory opens the History window filtered to name.
+func showPlayerHistory(name string) {
+	if historyWin == nil {
+		return
+	}
+	historyPlayer = name
+	historyText, historyFrom, historyTo = "", "", ""
+	for _, in := range historyInputs {
+		in.Dirty = true
+	}
+	historyWin.MarkOpen()
+	runHistorySearch()
+}
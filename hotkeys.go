@@ -889,7 +889,7 @@ func hotkeyEquipAlreadyEquipped(cmd string) bool {
 		return false
 	}
 	id := uint16(id64)
-	items := getInventory()
+	items := focusedSession().getInventory()
 	for _, it := range items {
 		if it.ID == id && it.Equipped {
 			name := it.Name
@@ -908,6 +908,9 @@ func checkHotkeys() {
 		return
 	}
 	if combo := detectCombo(); combo != "" {
+		if runClassicKeyMacro(combo) {
+			return
+		}
 		hotkeysMu.RLock()
 		list := append([]Hotkey(nil), hotkeys...)
 		hotkeysMu.RUnlock()
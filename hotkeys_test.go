@@ -290,9 +290,9 @@ func TestApplyHotkeyVarsNoHovered(t *testing.T) {
 
 // Test that hotkey equip commands skip already equipped items.
 func TestHotkeyEquipAlreadyEquipped(t *testing.T) {
-	resetInventory()
-	addInventoryItem(100, -1, "Sword", true)
-	consoleLog = messageLog{max: maxMessages}
+	mainSession.resetInventory()
+	mainSession.addInventoryItem(100, -1, "Sword", true)
+	mainSession.console = messageLog{max: maxMessages}
 	if !hotkeyEquipAlreadyEquipped("/equip 100") {
 		t.Fatalf("expected command to be skipped")
 	}
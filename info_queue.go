@@ -2,52 +2,47 @@ package main
 
 import (
 	"strings"
-	"sync"
 	"time"
 )
 
-// A tiny, throttled queue of /be-info lookups for players missing details.
-var (
-	infoQueue    = map[string]struct{}{}
-	infoQueueMu  sync.Mutex
-	lastInfoSent time.Time
-	infoCooldown = 500 * time.Millisecond
-)
+const infoCooldown = 500 * time.Millisecond
 
 // queueInfoRequest enqueues a be-info for name when details are incomplete.
-func queueInfoRequest(name string) {
+func (s *session) queueInfoRequest(name string) {
 	name = strings.TrimSpace(name)
 	if name == "" {
 		return
 	}
-	playersMu.RLock()
-	p, ok := players[name]
-	playersMu.RUnlock()
+	s.playersMu.RLock()
+	p, ok := s.players[name]
+	s.playersMu.RUnlock()
 	if ok {
 		if p.Class != "" && p.Gender != "" && p.Race != "" && p.Clan != "" {
 			return // no need
 		}
 	}
-	infoQueueMu.Lock()
-	infoQueue[name] = struct{}{}
-	infoQueueMu.Unlock()
+	s.infoQueueMu.Lock()
+	s.infoQueue[name] = struct{}{}
+	s.infoQueueMu.Unlock()
 }
 
 // maybeEnqueueInfo sets pendingCommand to "/be-info <name>" when throttled and
 // a name is queued. Returns true if it queued a command.
-func maybeEnqueueInfo() bool {
-	if pendingCommand != "" {
+func (s *session) maybeEnqueueInfo() bool {
+	if s.commandPending() {
 		return false
 	}
-	if time.Since(lastInfoSent) < infoCooldown {
+	s.infoQueueMu.Lock()
+	defer s.infoQueueMu.Unlock()
+	if time.Since(s.lastInfoSent) < infoCooldown {
 		return false
 	}
-	infoQueueMu.Lock()
-	defer infoQueueMu.Unlock()
-	for name := range infoQueue {
-		pendingCommand = "/be-info " + name
-		delete(infoQueue, name)
-		lastInfoSent = time.Now()
+	for name := range s.infoQueue {
+		if !s.trySetPendingCommand("/be-info " + name) {
+			return false
+		}
+		delete(s.infoQueue, name)
+		s.lastInfoSent = time.Now()
 		return true
 	}
 	return false
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"sort"
 	"strings"
-	"sync"
 
 	"golang.org/x/text/cases"
 )
@@ -34,12 +33,6 @@ type inventoryKey struct {
 	IDIndex int16
 }
 
-var (
-	inventoryMu    sync.RWMutex
-	inventoryItems []InventoryItem
-	inventoryNames = make(map[inventoryKey]string)
-)
-
 var invFoldCaser = cases.Fold()
 
 const kItemFlagData = 0x0400
@@ -53,89 +46,89 @@ func normalizeInventoryName(name string) string {
 	return invFoldCaser.String(name)
 }
 
-func resetInventory() {
-	inventoryMu.Lock()
-	inventoryItems = inventoryItems[:0]
-	inventoryNames = make(map[inventoryKey]string)
-	inventoryMu.Unlock()
+func (s *session) resetInventory() {
+	s.inventoryMu.Lock()
+	s.inventoryItems = s.inventoryItems[:0]
+	s.inventoryNames = make(map[inventoryKey]string)
+	s.inventoryMu.Unlock()
 	inventoryDirty = true
 }
 
 // rebuildInventoryIndices recalculates sequential display indices for all
 // inventory items and rebuilds the inventoryNames map based on the current
 // state. inventoryMu must be held by the caller.
-func rebuildInventoryIndices() {
-	inventoryNames = make(map[inventoryKey]string)
-	for i := range inventoryItems {
-		inventoryItems[i].Index = i
+func (s *session) rebuildInventoryIndices() {
+	s.inventoryNames = make(map[inventoryKey]string)
+	for i := range s.inventoryItems {
+		s.inventoryItems[i].Index = i
 		// Persist only the per-instance extra (custom) text, not the full display name.
-		if inventoryItems[i].Extra != "" {
-			key := inventoryKey{ID: inventoryItems[i].ID, IDIndex: int16(inventoryItems[i].IDIndex)}
-			if inventoryItems[i].IDIndex < 0 {
+		if s.inventoryItems[i].Extra != "" {
+			key := inventoryKey{ID: s.inventoryItems[i].ID, IDIndex: int16(s.inventoryItems[i].IDIndex)}
+			if s.inventoryItems[i].IDIndex < 0 {
 				key.IDIndex = -1
 			}
-			inventoryNames[key] = inventoryItems[i].Extra
+			s.inventoryNames[key] = s.inventoryItems[i].Extra
 		}
 	}
 }
 
-func addInventoryItem(id uint16, idx int, name string, equip bool) {
-	inventoryMu.Lock()
+func (s *session) addInventoryItem(id uint16, idx int, name string, equip bool) {
+	s.inventoryMu.Lock()
 	if idx >= 0 {
 		// Template item with explicit per-ID index; insert a new entry and renumber
 		// existing items of the same ID whose IDIndex >= idx.
-		for i := range inventoryItems {
-			if inventoryItems[i].ID == id && inventoryItems[i].IDIndex >= idx {
-				inventoryItems[i].IDIndex++
+		for i := range s.inventoryItems {
+			if s.inventoryItems[i].ID == id && s.inventoryItems[i].IDIndex >= idx {
+				s.inventoryItems[i].IDIndex++
 			}
 		}
 		// Append as a distinct instance; keep display order by placing at end
 		disp := fmt.Sprintf("%s <#%d>", name, idx+1)
-		item := InventoryItem{ID: id, Name: disp, Base: name, Extra: "", Equipped: equip, Index: len(inventoryItems), IDIndex: idx, Quantity: 1}
-		inventoryItems = append(inventoryItems, item)
+		item := InventoryItem{ID: id, Name: disp, Base: name, Extra: "", Equipped: equip, Index: len(s.inventoryItems), IDIndex: idx, Quantity: 1}
+		s.inventoryItems = append(s.inventoryItems, item)
 	} else {
 		// Legacy/non-template: coalesce by ID only when normalized names match.
 		found := false
 		normName := normalizeInventoryName(name)
-		for i := range inventoryItems {
-			if inventoryItems[i].ID == id && inventoryItems[i].IDIndex < 0 && normalizeInventoryName(inventoryItems[i].Name) == normName {
-				inventoryItems[i].Quantity++
+		for i := range s.inventoryItems {
+			if s.inventoryItems[i].ID == id && s.inventoryItems[i].IDIndex < 0 && normalizeInventoryName(s.inventoryItems[i].Name) == normName {
+				s.inventoryItems[i].Quantity++
 				if equip {
-					inventoryItems[i].Equipped = true
+					s.inventoryItems[i].Equipped = true
 				}
 				found = true
 				break
 			}
 		}
 		if !found {
-			item := InventoryItem{ID: id, Name: name, Base: name, Extra: "", Equipped: equip, Index: len(inventoryItems), IDIndex: -1, Quantity: 1}
-			inventoryItems = append(inventoryItems, item)
+			item := InventoryItem{ID: id, Name: name, Base: name, Extra: "", Equipped: equip, Index: len(s.inventoryItems), IDIndex: -1, Quantity: 1}
+			s.inventoryItems = append(s.inventoryItems, item)
 		}
 	}
-	rebuildInventoryIndices()
+	s.rebuildInventoryIndices()
 	// If this item was equipped, clear any other equipped items occupying the
 	// same slot (e.g., hands, head). Mirrors BumpItemsFromSlot in the reference client.
 	if equip && clImages != nil {
 		slot := clImages.ItemSlot(uint32(id))
-		for i := range inventoryItems {
-			if inventoryItems[i].Equipped && (inventoryItems[i].ID != id || i != idx) {
-				if clImages.ItemSlot(uint32(inventoryItems[i].ID)) == slot {
-					inventoryItems[i].Equipped = false
+		for i := range s.inventoryItems {
+			if s.inventoryItems[i].Equipped && (s.inventoryItems[i].ID != id || i != idx) {
+				if clImages.ItemSlot(uint32(s.inventoryItems[i].ID)) == slot {
+					s.inventoryItems[i].Equipped = false
 				}
 			}
 		}
 	}
-	inventoryMu.Unlock()
+	s.inventoryMu.Unlock()
 	inventoryDirty = true
 }
 
-func removeInventoryItem(id uint16, idx int) {
-	inventoryMu.Lock()
+func (s *session) removeInventoryItem(id uint16, idx int) {
+	s.inventoryMu.Lock()
 	removed := false
 	if idx >= 0 {
 		// Remove by per-ID index
 		pos := -1
-		for i, it := range inventoryItems {
+		for i, it := range s.inventoryItems {
 			if it.ID == id && it.IDIndex == idx {
 				pos = i
 				break
@@ -143,21 +136,21 @@ func removeInventoryItem(id uint16, idx int) {
 		}
 		if pos >= 0 {
 			// Remove and renumber subsequent per-ID indices
-			inventoryItems = append(inventoryItems[:pos], inventoryItems[pos+1:]...)
-			for i := range inventoryItems {
-				if inventoryItems[i].ID == id && inventoryItems[i].IDIndex > idx {
-					inventoryItems[i].IDIndex--
+			s.inventoryItems = append(s.inventoryItems[:pos], s.inventoryItems[pos+1:]...)
+			for i := range s.inventoryItems {
+				if s.inventoryItems[i].ID == id && s.inventoryItems[i].IDIndex > idx {
+					s.inventoryItems[i].IDIndex--
 				}
 			}
 			removed = true
 		}
 	} else {
-		for i, it := range inventoryItems {
+		for i, it := range s.inventoryItems {
 			if it.ID == id && it.IDIndex < 0 {
 				if it.Quantity > 1 {
-					inventoryItems[i].Quantity--
+					s.inventoryItems[i].Quantity--
 				} else {
-					inventoryItems = append(inventoryItems[:i], inventoryItems[i+1:]...)
+					s.inventoryItems = append(s.inventoryItems[:i], s.inventoryItems[i+1:]...)
 					removed = true
 				}
 				break
@@ -165,31 +158,31 @@ func removeInventoryItem(id uint16, idx int) {
 		}
 	}
 	if removed {
-		rebuildInventoryIndices()
+		s.rebuildInventoryIndices()
 	}
-	inventoryMu.Unlock()
+	s.inventoryMu.Unlock()
 	inventoryDirty = true
 }
 
-func equipInventoryItem(id uint16, idx int, equip bool) {
-	inventoryMu.Lock()
+func (s *session) equipInventoryItem(id uint16, idx int, equip bool) {
+	s.inventoryMu.Lock()
 	// Find target by per-ID index when provided. Without an explicit index
 	// choose an item by ID, preferring an already equipped instance when
 	// unequipping.
 	target := -1
 	if idx >= 0 {
-		for i := range inventoryItems {
-			if inventoryItems[i].ID == id && inventoryItems[i].IDIndex == idx {
+		for i := range s.inventoryItems {
+			if s.inventoryItems[i].ID == id && s.inventoryItems[i].IDIndex == idx {
 				target = i
 				break
 			}
 		}
 	} else {
-		for i := range inventoryItems {
-			if inventoryItems[i].ID != id {
+		for i := range s.inventoryItems {
+			if s.inventoryItems[i].ID != id {
 				continue
 			}
-			if !equip && inventoryItems[i].Equipped {
+			if !equip && s.inventoryItems[i].Equipped {
 				target = i
 				break
 			}
@@ -199,21 +192,21 @@ func equipInventoryItem(id uint16, idx int, equip bool) {
 		}
 	}
 	if target >= 0 {
-		inventoryItems[target].Equipped = equip
+		s.inventoryItems[target].Equipped = equip
 	}
 	// When equipping, make sure other items in the same slot are unequipped.
 	if equip && clImages != nil {
 		slot := clImages.ItemSlot(uint32(id))
-		for i := range inventoryItems {
+		for i := range s.inventoryItems {
 			if i == target {
 				continue
 			}
-			if inventoryItems[i].Equipped && clImages.ItemSlot(uint32(inventoryItems[i].ID)) == slot {
-				inventoryItems[i].Equipped = false
+			if s.inventoryItems[i].Equipped && clImages.ItemSlot(uint32(s.inventoryItems[i].ID)) == slot {
+				s.inventoryItems[i].Equipped = false
 			}
 		}
 	}
-	inventoryMu.Unlock()
+	s.inventoryMu.Unlock()
 	inventoryDirty = true
 }
 
@@ -222,21 +215,21 @@ func equipInventoryItem(id uint16, idx int, equip bool) {
 // /unequip commands are sent here. The local inventory state is adjusted via
 // equipInventoryItem to mirror the server's behavior. idx is the server-
 // provided 0-based index for template items or -1 otherwise.
-func queueEquipCommand(id uint16, idx int) {
+func (s *session) queueEquipCommand(id uint16, idx int) {
 	if idx >= 0 {
-		enqueueCommand(fmt.Sprintf("/equip %d %d", id, idx+1))
+		s.queueCommand(fmt.Sprintf("/equip %d %d", id, idx+1))
 	} else {
-		enqueueCommand(fmt.Sprintf("/equip %d", id))
+		s.queueCommand(fmt.Sprintf("/equip %d", id))
 	}
-	nextCommand()
+	s.nextCommand()
 }
 
 // toggleInventoryEquipAt equips or unequips a specific item index. When idx is
 // negative, the first matching item is targeted similar to the legacy
 // behavior. The server is informed via pendingCommand and local inventory state
 // is updated immediately.
-func toggleInventoryEquipAt(id uint16, idx int) {
-	items := getInventory()
+func (s *session) toggleInventoryEquipAt(id uint16, idx int) {
+	items := s.getInventory()
 	equip := true
 	if idx >= 0 {
 		for _, it := range items {
@@ -262,32 +255,32 @@ func toggleInventoryEquipAt(id uint16, idx int) {
 		}
 	}
 	if equip {
-		queueEquipCommand(id, idx)
-		equipInventoryItem(id, idx, true)
+		s.queueEquipCommand(id, idx)
+		s.equipInventoryItem(id, idx, true)
 	} else {
-		enqueueCommand(fmt.Sprintf("/unequip %d", id))
-		nextCommand()
-		equipInventoryItem(id, -1, false)
+		s.queueCommand(fmt.Sprintf("/unequip %d", id))
+		s.nextCommand()
+		s.equipInventoryItem(id, -1, false)
 	}
 }
 
 // toggleInventoryEquip equips the specified item without specifying an index.
 // It retains the previous behavior and is kept for compatibility with
 // existing plugin APIs.
-func toggleInventoryEquip(id uint16) {
-	toggleInventoryEquipAt(id, -1)
+func (s *session) toggleInventoryEquip(id uint16) {
+	s.toggleInventoryEquipAt(id, -1)
 }
 
-func renameInventoryItem(id uint16, idx int, name string) {
-	inventoryMu.Lock()
+func (s *session) renameInventoryItem(id uint16, idx int, name string) {
+	s.inventoryMu.Lock()
 	if idx >= 0 {
 		// Template items are addressed by a per-ID index. Update only the
 		// matching instance so multiple containers of the same type can
 		// retain distinct names.
-		for i := range inventoryItems {
-			if inventoryItems[i].ID == id && inventoryItems[i].IDIndex == idx {
+		for i := range s.inventoryItems {
+			if s.inventoryItems[i].ID == id && s.inventoryItems[i].IDIndex == idx {
 				// Determine base (official) name without any suffix
-				base := inventoryItems[i].Name
+				base := s.inventoryItems[i].Name
 				if p := strings.Index(base, " <#"); p >= 0 {
 					base = base[:p]
 				}
@@ -301,14 +294,14 @@ func renameInventoryItem(id uint16, idx int, name string) {
 				}
 				if name != "" {
 					// Canonical: include colon for custom template names
-					inventoryItems[i].Name = fmt.Sprintf("%s <#%d: %s>", base, idx+1, name)
-					inventoryItems[i].Base = base
-					inventoryItems[i].Extra = name
-					inventoryNames[inventoryKey{ID: id, IDIndex: int16(idx)}] = name
+					s.inventoryItems[i].Name = fmt.Sprintf("%s <#%d: %s>", base, idx+1, name)
+					s.inventoryItems[i].Base = base
+					s.inventoryItems[i].Extra = name
+					s.inventoryNames[inventoryKey{ID: id, IDIndex: int16(idx)}] = name
 				} else {
-					inventoryItems[i].Name = fmt.Sprintf("%s <#%d>", base, idx+1)
-					inventoryItems[i].Base = base
-					inventoryItems[i].Extra = ""
+					s.inventoryItems[i].Name = fmt.Sprintf("%s <#%d>", base, idx+1)
+					s.inventoryItems[i].Base = base
+					s.inventoryItems[i].Extra = ""
 				}
 				break
 			}
@@ -316,13 +309,13 @@ func renameInventoryItem(id uint16, idx int, name string) {
 	} else {
 		// Legacy items without a template index: rename all matching IDs.
 		if name != "" {
-			inventoryNames[inventoryKey{ID: id, IDIndex: -1}] = name
+			s.inventoryNames[inventoryKey{ID: id, IDIndex: -1}] = name
 		}
-		for i := range inventoryItems {
+		for i := range s.inventoryItems {
 			// Only update legacy instances; do not override template instances.
-			if inventoryItems[i].ID == id && inventoryItems[i].IDIndex < 0 {
+			if s.inventoryItems[i].ID == id && s.inventoryItems[i].IDIndex < 0 {
 				// Compose canonical legacy name: Base <custom> when set, otherwise Base
-				base := inventoryItems[i].Name
+				base := s.inventoryItems[i].Name
 				if p := strings.Index(base, " <"); p >= 0 {
 					base = base[:p]
 				}
@@ -339,26 +332,26 @@ func renameInventoryItem(id uint16, idx int, name string) {
 					}
 				}
 				if name != "" {
-					inventoryItems[i].Name = fmt.Sprintf("%s <%s>", base, name)
-					inventoryItems[i].Base = base
-					inventoryItems[i].Extra = name
+					s.inventoryItems[i].Name = fmt.Sprintf("%s <%s>", base, name)
+					s.inventoryItems[i].Base = base
+					s.inventoryItems[i].Extra = name
 				} else {
-					inventoryItems[i].Name = base
-					inventoryItems[i].Base = base
-					inventoryItems[i].Extra = ""
+					s.inventoryItems[i].Name = base
+					s.inventoryItems[i].Base = base
+					s.inventoryItems[i].Extra = ""
 				}
 			}
 		}
 	}
-	inventoryMu.Unlock()
+	s.inventoryMu.Unlock()
 	inventoryDirty = true
 }
 
-func getInventory() []InventoryItem {
-	inventoryMu.RLock()
-	defer inventoryMu.RUnlock()
-	out := make([]InventoryItem, len(inventoryItems))
-	copy(out, inventoryItems)
+func (s *session) getInventory() []InventoryItem {
+	s.inventoryMu.RLock()
+	defer s.inventoryMu.RUnlock()
+	out := make([]InventoryItem, len(s.inventoryItems))
+	copy(out, s.inventoryItems)
 	sort.SliceStable(out, func(i, j int) bool {
 		if out[i].Equipped != out[j].Equipped {
 			return out[i].Equipped && !out[j].Equipped
@@ -369,40 +362,40 @@ func getInventory() []InventoryItem {
 }
 
 // inventoryItemByIndex returns the InventoryItem at the given index.
-func inventoryItemByIndex(idx int) (InventoryItem, bool) {
-	inventoryMu.RLock()
-	defer inventoryMu.RUnlock()
-	if idx < 0 || idx >= len(inventoryItems) {
+func (s *session) inventoryItemByIndex(idx int) (InventoryItem, bool) {
+	s.inventoryMu.RLock()
+	defer s.inventoryMu.RUnlock()
+	if idx < 0 || idx >= len(s.inventoryItems) {
 		return InventoryItem{}, false
 	}
-	return inventoryItems[idx], true
+	return s.inventoryItems[idx], true
 }
 
 // triggerInventoryShortcut activates the inventory item assigned to idx.
 // Wearable items toggle equip state; others are used.
-func triggerInventoryShortcut(idx int) {
-	it, ok := inventoryItemByIndex(idx)
+func (s *session) triggerInventoryShortcut(idx int) {
+	it, ok := s.inventoryItemByIndex(idx)
 	if !ok {
 		return
 	}
 	if clImages != nil {
 		slot := clImages.ItemSlot(uint32(it.ID))
 		if slot >= kItemSlotFirstReal && slot <= kItemSlotLastReal {
-			toggleInventoryEquipAt(it.ID, it.IDIndex)
+			s.toggleInventoryEquipAt(it.ID, it.IDIndex)
 			return
 		}
 	}
-	enqueueCommand(fmt.Sprintf("/useitem %d", it.ID))
-	nextCommand()
+	s.queueCommand(fmt.Sprintf("/useitem %d", it.ID))
+	s.nextCommand()
 }
 
-func setFullInventory(ids []uint16, equipped []bool) {
+func (s *session) setFullInventory(ids []uint16, equipped []bool) {
 	oldNames := make(map[inventoryKey]string)
-	inventoryMu.RLock()
-	for k, v := range inventoryNames {
+	s.inventoryMu.RLock()
+	for k, v := range s.inventoryNames {
 		oldNames[k] = v
 	}
-	inventoryMu.RUnlock()
+	s.inventoryMu.RUnlock()
 
 	type groupKey struct {
 		id   uint16
@@ -494,9 +487,9 @@ func setFullInventory(ids []uint16, equipped []bool) {
 		}
 	}
 
-	inventoryMu.Lock()
-	inventoryItems = grouped
-	inventoryNames = newNames
-	inventoryMu.Unlock()
+	s.inventoryMu.Lock()
+	s.inventoryItems = grouped
+	s.inventoryNames = newNames
+	s.inventoryMu.Unlock()
 	inventoryDirty = true
 }
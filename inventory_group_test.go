@@ -3,20 +3,20 @@ package main
 import "testing"
 
 func TestInventorySeparateNames(t *testing.T) {
-	resetInventory()
-	addInventoryItem(100, -1, "First", false)
-	addInventoryItem(100, -1, "Second", false)
-	items := getInventory()
+	mainSession.resetInventory()
+	mainSession.addInventoryItem(100, -1, "First", false)
+	mainSession.addInventoryItem(100, -1, "Second", false)
+	items := mainSession.getInventory()
 	if len(items) != 2 {
 		t.Fatalf("expected 2 items, got %d", len(items))
 	}
 }
 
 func TestInventoryGroupNormalizedNames(t *testing.T) {
-	resetInventory()
-	addInventoryItem(100, -1, "Shadow Bell", false)
-	addInventoryItem(100, -1, "shadow bell", false)
-	items := getInventory()
+	mainSession.resetInventory()
+	mainSession.addInventoryItem(100, -1, "Shadow Bell", false)
+	mainSession.addInventoryItem(100, -1, "shadow bell", false)
+	items := mainSession.getInventory()
 	if len(items) != 1 {
 		t.Fatalf("expected 1 item, got %d", len(items))
 	}
@@ -26,11 +26,11 @@ func TestInventoryGroupNormalizedNames(t *testing.T) {
 }
 
 func TestToggleInventoryEquipAt(t *testing.T) {
-	resetInventory()
-	addInventoryItem(100, 0, "Ring A", false)
-	addInventoryItem(100, 1, "Ring B", false)
-	toggleInventoryEquipAt(100, 1)
-	items := getInventory()
+	mainSession.resetInventory()
+	mainSession.addInventoryItem(100, 0, "Ring A", false)
+	mainSession.addInventoryItem(100, 1, "Ring B", false)
+	mainSession.toggleInventoryEquipAt(100, 1)
+	items := mainSession.getInventory()
 	if !items[1].Equipped {
 		t.Fatalf("expected second item equipped")
 	}
@@ -8,17 +8,17 @@ import (
 )
 
 func TestParseInventoryFull(t *testing.T) {
-	resetInventory()
+	mainSession.resetInventory()
 	inventoryDirty = false
 	data := []byte{byte(kInvCmdFull), 2, 0x02, 0x00, 0x64, 0x00, 0xC8, byte(kInvCmdNone), 0x99}
-	rest, ok := parseInventory(data)
+	rest, ok := mainSession.parseInventory(data)
 	if !ok {
 		t.Fatalf("parse failed")
 	}
 	if len(rest) != 1 || rest[0] != 0x99 {
 		t.Fatalf("unexpected rest %v", rest)
 	}
-	inv := getInventory()
+	inv := mainSession.getInventory()
 	if len(inv) != 2 {
 		t.Fatalf("unexpected inventory length %d", len(inv))
 	}
@@ -40,7 +40,7 @@ func TestParseInventoryFull(t *testing.T) {
 }
 
 func TestParseInventoryOther(t *testing.T) {
-	resetInventory()
+	mainSession.resetInventory()
 	inventoryDirty = false
 	data := []byte{
 		byte(kInvCmdMultiple), 4, byte(kInvCmdAdd | kInvCmdIndex),
@@ -50,7 +50,7 @@ func TestParseInventoryOther(t *testing.T) {
 		byte(kInvCmdDelete | kInvCmdIndex), 0x00, 0x64, 0,
 		byte(kInvCmdNone), 0x77,
 	}
-	rest, ok := parseInventory(data)
+	rest, ok := mainSession.parseInventory(data)
 	if !ok {
 		t.Fatalf("parse failed")
 	}
@@ -63,7 +63,7 @@ func TestParseInventoryOther(t *testing.T) {
 }
 
 func TestParseInventoryMacRomanName(t *testing.T) {
-	resetInventory()
+	mainSession.resetInventory()
 	inventoryDirty = false
 	nameBytes := []byte{'M', 0x8e, 'm', 'e'}
 	data := []byte{
@@ -71,14 +71,14 @@ func TestParseInventoryMacRomanName(t *testing.T) {
 	}
 	data = append(data, nameBytes...)
 	data = append(data, 0, byte(kInvCmdNone), 0x55)
-	rest, ok := parseInventory(data)
+	rest, ok := mainSession.parseInventory(data)
 	if !ok {
 		t.Fatalf("parse failed")
 	}
 	if len(rest) != 1 || rest[0] != 0x55 {
 		t.Fatalf("unexpected rest %v", rest)
 	}
-	inv := getInventory()
+	inv := mainSession.getInventory()
 	want := decodeMacRoman(nameBytes) + " <#1>"
 	if len(inv) != 1 || inv[0].Name != want {
 		t.Fatalf("unexpected inventory %v", inv)
@@ -89,13 +89,13 @@ func TestParseInventoryMacRomanName(t *testing.T) {
 }
 
 func TestParseInventoryTrailingB1(t *testing.T) {
-	resetInventory()
+	mainSession.resetInventory()
 	inventoryDirty = false
 	data := []byte{
 		byte(kInvCmdFull), 1, 0x00, 0x00, 0x64,
 		kInvCmdLegacyPadding, byte(kInvCmdNone), 0x55,
 	}
-	rest, ok := parseInventory(data)
+	rest, ok := mainSession.parseInventory(data)
 	if !ok {
 		t.Fatalf("parse failed")
 	}
@@ -108,13 +108,13 @@ func TestParseInventoryTrailingB1(t *testing.T) {
 }
 
 func TestParseInventoryTrailingD(t *testing.T) {
-	resetInventory()
+	mainSession.resetInventory()
 	inventoryDirty = false
 	data := []byte{
 		byte(kInvCmdFull), 1, 0x00, 0x00, 0x64,
 		'd', byte(kInvCmdNone), 0x55,
 	}
-	rest, ok := parseInventory(data)
+	rest, ok := mainSession.parseInventory(data)
 	if !ok {
 		t.Fatalf("parse failed")
 	}
@@ -127,7 +127,7 @@ func TestParseInventoryTrailingD(t *testing.T) {
 }
 
 func TestParseInventoryMidstreamD(t *testing.T) {
-	resetInventory()
+	mainSession.resetInventory()
 	inventoryDirty = false
 	var buf bytes.Buffer
 	errorLogger = log.New(&buf, "", 0)
@@ -140,7 +140,7 @@ func TestParseInventoryMidstreamD(t *testing.T) {
 		byte(kInvCmdDelete | kInvCmdIndex), 0x00, 0x64, 0,
 		byte(kInvCmdNone), 0x55,
 	}
-	rest, ok := parseInventory(data)
+	rest, ok := mainSession.parseInventory(data)
 	if !ok {
 		t.Fatalf("parse failed")
 	}
@@ -156,7 +156,7 @@ func TestParseInventoryMidstreamD(t *testing.T) {
 }
 
 func TestInventoryRenameIndexed(t *testing.T) {
-	resetInventory()
+	mainSession.resetInventory()
 	inventoryDirty = false
 	data := []byte{
 		byte(kInvCmdMultiple), 4,
@@ -166,14 +166,14 @@ func TestInventoryRenameIndexed(t *testing.T) {
 		byte(kInvCmdName | kInvCmdIndex), 0x00, 0x64, 2, 'S', 'e', 'c', 'o', 'n', 'd', 0,
 		byte(kInvCmdNone), 0x33,
 	}
-	rest, ok := parseInventory(data)
+	rest, ok := mainSession.parseInventory(data)
 	if !ok {
 		t.Fatalf("parse failed")
 	}
 	if len(rest) != 1 || rest[0] != 0x33 {
 		t.Fatalf("unexpected rest %v", rest)
 	}
-	inv := getInventory()
+	inv := mainSession.getInventory()
 	if len(inv) != 2 {
 		t.Fatalf("unexpected inventory length %d", len(inv))
 	}
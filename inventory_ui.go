@@ -100,7 +100,7 @@ func updateInventoryWindow() {
 	// grouped by ID and name so identical items appear once with a quantity,
 	// while clothing items are listed individually to allow swapping similar
 	// pieces (e.g. different pairs of shoes).
-	items := getInventory()
+	items := focusedSession().getInventory()
 	counts := make(map[invGroupKey]int)
 	first := make(map[invGroupKey]InventoryItem)
 	anyEquipped := make(map[invGroupKey]bool)
@@ -351,7 +351,7 @@ func handleInventoryClick(id uint16, idx int) {
 			enqueueCommand(fmt.Sprintf("/useitem %d", id))
 			nextCommand()
 		} else {
-			toggleInventoryEquipAt(id, idx)
+			focusedSession().toggleInventoryEquipAt(id, idx)
 		}
 		lastInvClickTime = time.Time{}
 	} else {
@@ -408,7 +408,7 @@ func openInventoryContextMenu(ref invRef, pos eui.Point) {
 	slotVal := -1
 	displayName := ""
 	examineName := ""
-	if it, ok := inventoryItemByIndex(ref.global); ok {
+	if it, ok := focusedSession().inventoryItemByIndex(ref.global); ok {
 		equipped = it.Equipped
 		if clImages != nil {
 			slot := clImages.ItemSlot(uint32(it.ID))
@@ -447,8 +447,8 @@ func openInventoryContextMenu(ref invRef, pos eui.Point) {
 	if wearable && !equipped {
 		options = append(options, "Equip")
 		actions = append(actions, func() {
-			queueEquipCommand(ref.id, ref.idx)
-			equipInventoryItem(ref.id, ref.idx, true)
+			focusedSession().queueEquipCommand(ref.id, ref.idx)
+			focusedSession().equipInventoryItem(ref.id, ref.idx, true)
 		})
 	}
 	if wearable && equipped {
@@ -456,7 +456,7 @@ func openInventoryContextMenu(ref invRef, pos eui.Point) {
 		actions = append(actions, func() {
 			enqueueCommand(fmt.Sprintf("/unequip %d", ref.id))
 			nextCommand()
-			equipInventoryItem(ref.id, -1, false)
+			focusedSession().equipInventoryItem(ref.id, -1, false)
 		})
 	}
 	// Always offer Examine when we know the item's name.
@@ -3,15 +3,15 @@ package main
 import "testing"
 
 func TestInventoryOrderSortedWithShortcuts(t *testing.T) {
-	resetInventory()
+	mainSession.resetInventory()
 	inventoryShortcutMu.Lock()
 	inventoryShortcuts = map[int]rune{}
 	inventoryShortcutMu.Unlock()
 
-	addInventoryItem(1, -1, "Banana", false)
-	addInventoryItem(2, -1, "Ápple", false)
-	addInventoryItem(3, -1, "apple", false)
-	addInventoryItem(4, -1, "ápple", false)
+	mainSession.addInventoryItem(1, -1, "Banana", false)
+	mainSession.addInventoryItem(2, -1, "Ápple", false)
+	mainSession.addInventoryItem(3, -1, "apple", false)
+	mainSession.addInventoryItem(4, -1, "ápple", false)
 
 	inventoryShortcutMu.Lock()
 	inventoryShortcuts[1] = '1'
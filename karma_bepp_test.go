@@ -6,8 +6,8 @@ func TestDecodeKarmaBlockedIgnored(t *testing.T) {
 	raw := bepp("kr", append(pnTag("Bob"), []byte(" gives you good karma")...))
 
 	// Sanity check: unblocked message should be returned.
-	players = make(map[string]*Player)
-	if got := decodeBEPP(raw); got == "" {
+	mainSession.players = make(map[string]*Player)
+	if got := mainSession.decodeBEPP(raw); got == "" {
 		t.Fatalf("decodeBEPP returned empty for unblocked message")
 	}
 
@@ -20,8 +20,8 @@ func TestDecodeKarmaBlockedIgnored(t *testing.T) {
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			players = map[string]*Player{"Bob": tc.p}
-			if got := decodeBEPP(raw); got != "" {
+			mainSession.players = map[string]*Player{"Bob": tc.p}
+			if got := mainSession.decodeBEPP(raw); got != "" {
 				t.Fatalf("decodeBEPP returned %q, want empty", got)
 			}
 		})
@@ -0,0 +1,174 @@
+package keyfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// ChangeKind says how an entry differs between two keyfiles.
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota
+	Changed
+	Removed
+	// Moved entries keep their data but change place relative to the
+	// other base entries. The patch's order entry puts them there.
+	Moved
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Changed:
+		return "changed"
+	case Removed:
+		return "removed"
+	case Moved:
+		return "moved"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change describes one entry of a Diff. Sizes are zero for a side the
+// entry is missing from.
+type Change struct {
+	Kind    ChangeKind
+	Type    uint32
+	ID      uint32
+	OldSize int
+	NewSize int
+}
+
+// DiffOptions controls Diff.
+type DiffOptions struct {
+	// Remove lets the patch drop base entries that the target no longer
+	// has. Without it Diff refuses such targets.
+	Remove bool
+}
+
+// Diff compares base and target entry by entry and returns the smallest
+// patch that Merge applies to base to get target, along with the changes
+// it carries. The patch only holds new and changed entries. When target
+// is not base with new entries appended, it is an ordered patch whose
+// TypeOrder entry lists target's layout; clients that predate ordered
+// patches reject it.
+func Diff(base, target []byte, opts DiffOptions) ([]byte, []Change, error) {
+	baseEntries, err := Parse(base)
+	if err != nil {
+		return nil, nil, fmt.Errorf("base: %w", err)
+	}
+	targetEntries, err := Parse(target)
+	if err != nil {
+		return nil, nil, fmt.Errorf("target: %w", err)
+	}
+	pos := make(map[key]int, len(baseEntries))
+	for i, e := range baseEntries {
+		if _, dup := pos[key{e.Type, e.ID}]; dup {
+			return nil, nil, fmt.Errorf("base: entry %08x/%d appears twice", e.Type, e.ID)
+		}
+		pos[key{e.Type, e.ID}] = i
+	}
+	inTarget := make(map[key]bool, len(targetEntries))
+	for _, e := range targetEntries {
+		if inTarget[key{e.Type, e.ID}] {
+			return nil, nil, fmt.Errorf("target: entry %08x/%d appears twice", e.Type, e.ID)
+		}
+		inTarget[key{e.Type, e.ID}] = true
+	}
+
+	var changes []Change
+	var removed []Change
+	for _, e := range baseEntries {
+		if !inTarget[key{e.Type, e.ID}] {
+			removed = append(removed, Change{Kind: Removed, Type: e.Type, ID: e.ID, OldSize: len(e.Data)})
+		}
+	}
+	if len(removed) > 0 && !opts.Remove {
+		return nil, nil, fmt.Errorf("target drops %d base entries; removals must be allowed explicitly", len(removed))
+	}
+
+	stay := inOrder(targetEntries, pos)
+	var patch []Entry
+	for i, e := range targetEntries {
+		p, ok := pos[key{e.Type, e.ID}]
+		if !ok {
+			patch = append(patch, e)
+			changes = append(changes, Change{Kind: Added, Type: e.Type, ID: e.ID, NewSize: len(e.Data)})
+			continue
+		}
+		old := baseEntries[p]
+		c := Change{Kind: Moved, Type: e.Type, ID: e.ID, OldSize: len(old.Data), NewSize: len(e.Data)}
+		if !bytes.Equal(old.Data, e.Data) {
+			patch = append(patch, e)
+			c.Kind = Changed
+		} else if stay[i] {
+			continue
+		}
+		changes = append(changes, c)
+	}
+	changes = append(changes, removed...)
+
+	if len(removed) == 0 && appendsOnly(baseEntries, targetEntries, pos) {
+		return Build(patch), changes, nil
+	}
+	order := make([]byte, 0, 8*len(targetEntries))
+	for _, e := range targetEntries {
+		order = binary.BigEndian.AppendUint32(order, e.Type)
+		order = binary.BigEndian.AppendUint32(order, e.ID)
+	}
+	patch = append(patch, Entry{Type: TypeOrder, Data: order})
+	return build(patch, orderedMagic), changes, nil
+}
+
+// appendsOnly reports whether target is every base entry in base order
+// followed by new ones, the layout a plain patch merges to.
+func appendsOnly(baseEntries, targetEntries []Entry, pos map[key]int) bool {
+	if len(targetEntries) < len(baseEntries) {
+		return false
+	}
+	for i, e := range targetEntries[:len(baseEntries)] {
+		if p, ok := pos[key{e.Type, e.ID}]; !ok || p != i {
+			return false
+		}
+	}
+	return true
+}
+
+// inOrder marks the target entries that form a longest run of base
+// entries in base order; the other base entries are the ones reported as
+// moved.
+func inOrder(targetEntries []Entry, pos map[key]int) []bool {
+	// Patience sorting over base positions: tails[l] is the index of the
+	// entry ending the best increasing run of length l+1.
+	var tails []int
+	prev := make([]int, len(targetEntries))
+	for i, e := range targetEntries {
+		p, ok := pos[key{e.Type, e.ID}]
+		if !ok {
+			continue
+		}
+		l := sort.Search(len(tails), func(j int) bool {
+			return pos[key{targetEntries[tails[j]].Type, targetEntries[tails[j]].ID}] >= p
+		})
+		prev[i] = -1
+		if l > 0 {
+			prev[i] = tails[l-1]
+		}
+		if l == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[l] = i
+		}
+	}
+	stay := make([]bool, len(targetEntries))
+	if len(tails) > 0 {
+		for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+			stay[i] = true
+		}
+	}
+	return stay
+}
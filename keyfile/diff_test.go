@@ -0,0 +1,136 @@
+package keyfile
+
+import (
+	"bytes"
+	"testing"
+)
+
+func entry(typ, id uint32, data string) Entry {
+	return Entry{Type: typ, ID: id, Data: []byte(data)}
+}
+
+func TestDiffRoundTrip(t *testing.T) {
+	const img, snd = 0x496d6167, 0x536e6420
+	base := Build([]Entry{
+		entry(img, 1, "one"),
+		entry(img, 2, "two"),
+		entry(snd, 1, "beep"),
+		entry(img, 3, "three"),
+		entry(img, 4, "four"),
+	})
+	tests := []struct {
+		name   string
+		target []Entry
+		want   []ChangeKind
+	}{
+		{"same", []Entry{
+			entry(img, 1, "one"), entry(img, 2, "two"), entry(snd, 1, "beep"), entry(img, 3, "three"), entry(img, 4, "four"),
+		}, nil},
+		{"change and append", []Entry{
+			entry(img, 1, "one"), entry(img, 2, "TWO"), entry(snd, 1, "beep"), entry(img, 3, "three"), entry(img, 4, "four"), entry(img, 5, "five"),
+		}, []ChangeKind{Changed, Added}},
+		{"remove", []Entry{
+			entry(img, 1, "one"), entry(snd, 1, "beep"), entry(img, 4, "four"),
+		}, []ChangeKind{Removed, Removed}},
+		{"insert and remove", []Entry{
+			entry(img, 1, "one"), entry(img, 9, "nine"), entry(img, 2, "two"), entry(snd, 1, "boop"), entry(img, 4, "four"),
+		}, []ChangeKind{Added, Changed, Removed}},
+		{"move", []Entry{
+			entry(img, 1, "one"), entry(img, 3, "three"), entry(img, 2, "two"), entry(snd, 1, "beep"), entry(img, 4, "four"),
+		}, []ChangeKind{Moved}},
+	}
+	for _, tt := range tests {
+		target := Build(tt.target)
+		patch, changes, err := Diff(base, target, DiffOptions{Remove: true})
+		if err != nil {
+			t.Fatalf("%s: Diff: %v", tt.name, err)
+		}
+		var kinds []ChangeKind
+		for _, c := range changes {
+			kinds = append(kinds, c.Kind)
+		}
+		if len(kinds) != len(tt.want) {
+			t.Errorf("%s: changes = %v, want %v", tt.name, kinds, tt.want)
+		} else {
+			for i := range kinds {
+				if kinds[i] != tt.want[i] {
+					t.Errorf("%s: changes = %v, want %v", tt.name, kinds, tt.want)
+					break
+				}
+			}
+		}
+		merged, err := Merge(base, patch)
+		if err != nil {
+			t.Fatalf("%s: Merge: %v", tt.name, err)
+		}
+		if !bytes.Equal(merged, target) {
+			t.Errorf("%s: merged patch differs from target", tt.name)
+		}
+	}
+}
+
+func TestDiffPatchIsMinimal(t *testing.T) {
+	base := Build([]Entry{entry(1, 1, "a"), entry(1, 2, "b")})
+	target := Build([]Entry{entry(1, 1, "a"), entry(1, 2, "c")})
+	patch, _, err := Diff(base, target, DiffOptions{})
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	entries, err := Parse(patch)
+	if err != nil || len(entries) != 1 || entries[0].ID != 2 {
+		t.Fatalf("patch entries = %+v, %v", entries, err)
+	}
+}
+
+func TestDiffInsertInMiddle(t *testing.T) {
+	var baseEntries []Entry
+	for i := range 1000 {
+		baseEntries = append(baseEntries, Entry{Type: 1, ID: uint32(i), Data: bytes.Repeat([]byte{byte(i)}, 100)})
+	}
+	targetEntries := append([]Entry{}, baseEntries[:10]...)
+	targetEntries = append(targetEntries, entry(1, 5000, "new"))
+	targetEntries = append(targetEntries, baseEntries[10:]...)
+	base, target := Build(baseEntries), Build(targetEntries)
+
+	patch, changes, err := Diff(base, target, DiffOptions{})
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Kind != Added {
+		t.Fatalf("changes = %+v", changes)
+	}
+	// One new entry plus the order list, not the entries after it.
+	if len(patch) > 12+16*2+3+8*len(targetEntries) {
+		t.Fatalf("patch is %d bytes for a %d byte target", len(patch), len(target))
+	}
+	merged, err := Merge(base, patch)
+	if err != nil || !bytes.Equal(merged, target) {
+		t.Fatalf("Merge = %v, equal %v", err, bytes.Equal(merged, target))
+	}
+	// Readers that only overlay entries refuse ordered patches.
+	if _, err := Parse(patch); err == nil {
+		t.Fatalf("ordered patch parsed as a plain keyfile")
+	}
+}
+
+func TestDiffRefusesRemovalsByDefault(t *testing.T) {
+	base := Build([]Entry{entry(1, 1, "a"), entry(1, 2, "b")})
+	target := Build([]Entry{entry(1, 1, "a")})
+	if _, _, err := Diff(base, target, DiffOptions{}); err == nil {
+		t.Fatalf("removal accepted without DiffOptions.Remove")
+	}
+}
+
+func TestMergeRejectsBadOrder(t *testing.T) {
+	base := Build([]Entry{entry(1, 1, "a")})
+	for name, patch := range map[string][]byte{
+		"short":    build([]Entry{{Type: TypeOrder, Data: []byte{1, 2, 3}}}, orderedMagic),
+		"missing":  build([]Entry{{Type: TypeOrder, Data: []byte{0, 0, 0, 1, 0, 0, 0, 9}}}, orderedMagic),
+		"none":     build([]Entry{entry(1, 1, "b")}, orderedMagic),
+		"unlisted": build([]Entry{entry(1, 2, "b"), {Type: TypeOrder, Data: []byte{0, 0, 0, 1, 0, 0, 0, 1}}}, orderedMagic),
+	} {
+		if _, err := Merge(base, patch); err == nil {
+			t.Errorf("%s: bad ordered patch accepted", name)
+		}
+	}
+}
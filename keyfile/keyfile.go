@@ -12,12 +12,29 @@ type Entry struct {
 	Data []byte
 }
 
-// parse reads keyfile data and returns all entries.
-func parse(data []byte) ([]Entry, error) {
+// Keyfiles start with fileMagic. Patches that set the order of the merged
+// file start with orderedMagic instead, so readers that only overlay
+// entries reject them rather than storing the order entry as data.
+const (
+	fileMagic    = 0xffff
+	orderedMagic = 0xfffe
+)
+
+// TypeOrder is the entry of an ordered patch that lists the type/ID pairs
+// of the merged keyfile in order, as big-endian uint32s. Base entries it
+// does not list are removed.
+const TypeOrder = 0x4f726472 // 'Ordr'
+
+// Parse reads keyfile data and returns all entries.
+func Parse(data []byte) ([]Entry, error) {
+	return parse(data, fileMagic)
+}
+
+func parse(data []byte, magic uint16) ([]Entry, error) {
 	if len(data) < 12 {
 		return nil, fmt.Errorf("short header")
 	}
-	if binary.BigEndian.Uint16(data[0:2]) != 0xffff {
+	if binary.BigEndian.Uint16(data[0:2]) != magic {
 		return nil, fmt.Errorf("bad header")
 	}
 	n := int(binary.BigEndian.Uint32(data[2:6]))
@@ -45,9 +62,13 @@ func parse(data []byte) ([]Entry, error) {
 
 // Build assembles a keyfile from the provided entries.
 func Build(entries []Entry) []byte {
+	return build(entries, fileMagic)
+}
+
+func build(entries []Entry, magic uint16) []byte {
 	n := len(entries)
 	header := make([]byte, 12+16*n)
-	binary.BigEndian.PutUint16(header[0:2], 0xffff)
+	binary.BigEndian.PutUint16(header[0:2], magic)
 	binary.BigEndian.PutUint32(header[2:6], uint32(n))
 	// pad1 and pad2 are zero
 	off := uint32(12 + 16*n)
@@ -65,17 +86,28 @@ func Build(entries []Entry) []byte {
 	return buf
 }
 
+type key struct{ t, id uint32 }
+
 // Merge overlays patch entries onto base and returns the merged keyfile.
+// A plain patch keeps the base order and appends its new entries; an
+// ordered patch, as written by Diff, lays out the result by its TypeOrder
+// entry.
 func Merge(base, patch []byte) ([]byte, error) {
-	baseEntries, err := parse(base)
+	baseEntries, err := Parse(base)
 	if err != nil {
 		return nil, err
 	}
-	patchEntries, err := parse(patch)
+	if len(patch) >= 2 && binary.BigEndian.Uint16(patch[0:2]) == orderedMagic {
+		patchEntries, err := parse(patch, orderedMagic)
+		if err != nil {
+			return nil, err
+		}
+		return mergeOrdered(baseEntries, patchEntries)
+	}
+	patchEntries, err := Parse(patch)
 	if err != nil {
 		return nil, err
 	}
-	type key struct{ t, id uint32 }
 	m := make(map[key]Entry, len(baseEntries)+len(patchEntries))
 	for _, e := range baseEntries {
 		m[key{e.Type, e.ID}] = e
@@ -101,3 +133,54 @@ func Merge(base, patch []byte) ([]byte, error) {
 	}
 	return Build(final), nil
 }
+
+// mergeOrdered builds the entries listed in the patch's TypeOrder entry,
+// taking each from the patch or else from base.
+func mergeOrdered(baseEntries, patchEntries []Entry) ([]byte, error) {
+	var order []byte
+	haveOrder := false
+	data := make(map[key]Entry, len(patchEntries))
+	for _, e := range patchEntries {
+		if e.Type == TypeOrder {
+			if haveOrder {
+				return nil, fmt.Errorf("duplicate order entry")
+			}
+			order, haveOrder = e.Data, true
+			continue
+		}
+		data[key{e.Type, e.ID}] = e
+	}
+	if !haveOrder {
+		return nil, fmt.Errorf("ordered patch without order entry")
+	}
+	if len(order)%8 != 0 {
+		return nil, fmt.Errorf("bad order entry")
+	}
+	m := make(map[key]Entry, len(baseEntries))
+	for _, e := range baseEntries {
+		m[key{e.Type, e.ID}] = e
+	}
+	final := make([]Entry, 0, len(order)/8)
+	listed := make(map[key]bool, len(order)/8)
+	for d := order; len(d) > 0; d = d[8:] {
+		k := key{binary.BigEndian.Uint32(d[0:4]), binary.BigEndian.Uint32(d[4:8])}
+		if listed[k] {
+			return nil, fmt.Errorf("entry %08x/%d listed twice", k.t, k.id)
+		}
+		listed[k] = true
+		e, ok := data[k]
+		if !ok {
+			e, ok = m[k]
+		}
+		if !ok {
+			return nil, fmt.Errorf("entry %08x/%d is in neither base nor patch", k.t, k.id)
+		}
+		final = append(final, e)
+	}
+	for k := range data {
+		if !listed[k] {
+			return nil, fmt.Errorf("patch entry %08x/%d is not in the order", k.t, k.id)
+		}
+	}
+	return Build(final), nil
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kills, falls, raises and karma are logged per character to
+// <data>/Stats/<name>.jsonl, one entry per message. Reports are tallied
+// from the log when the Stats window asks for them.
+const statsDirName = "Stats"
+
+// Kinds of statEvent.
+const (
+	statKill  = "kill"
+	statFall  = "fall"
+	statRaise = "raise"
+	statKarma = "karma"
+)
+
+// statEvent is one line of a character's stats log.
+type statEvent struct {
+	Time time.Time `json:"t"`
+	Kind string    `json:"kind"`
+	// Name is the monster killed, the player who fell or got up, or the
+	// other player in a karma exchange.
+	Name string `json:"name"`
+	// By is what felled Name, or who raised them.
+	By       string `json:"by,omitempty"`
+	Where    string `json:"where,omitempty"`
+	Helped   bool   `json:"helped,omitempty"`   // a kill shared with others
+	Bad      bool   `json:"bad,omitempty"`      // bad karma
+	Received bool   `json:"received,omitempty"` // karma given to you
+}
+
+// statsPeriod selects which events a report covers.
+type statsPeriod int
+
+const (
+	statsSession statsPeriod = iota
+	statsToday
+	statsLifetime
+)
+
+var statsPeriodNames = []string{"Session", "Today", "Lifetime"}
+
+// statRow is one line of a statTable: a name and a count per column.
+type statRow struct {
+	Name   string
+	Counts []int
+}
+
+// statTable is one breakdown in a report.
+type statTable struct {
+	Title   string
+	Columns []string
+	Rows    []statRow
+}
+
+type statsStore struct {
+	mu      sync.Mutex
+	name    string
+	path    string
+	started time.Time // when this session began logging
+	events  []statEvent
+	partial bool // the log ends in a cut off line
+}
+
+var (
+	killStats        *statsStore
+	killStatsMu      sync.Mutex
+	killStatsChanged bool // an event arrived since the Stats window drew
+)
+
+// recordStat logs e for the current character. Nothing is recorded before
+// login, for an alt in the background or while playing back movies and
+// captures.
+func (s *session) recordStat(e statEvent) {
+	if e.Name == "" || s.playerName == "" || !s.isFocused() || movieMode || playingMovie || clmov != "" || pcapPath != "" || fake {
+		return
+	}
+	store := currentStats(s.playerName)
+	if store == nil {
+		return
+	}
+	e.Time = time.Now()
+	if err := store.add(e); err != nil {
+		log.Printf("stats: %v", err)
+	}
+	killStatsMu.Lock()
+	killStatsChanged = true
+	killStatsMu.Unlock()
+}
+
+// currentStats returns the store for the character name, opening it on
+// first use. It returns nil before login, when name is empty.
+func currentStats(name string) *statsStore {
+	if name == "" {
+		return nil
+	}
+	killStatsMu.Lock()
+	defer killStatsMu.Unlock()
+	if killStats == nil || killStats.name != name {
+		s, err := openStatsStore(filepath.Join(dataDirPath, statsDirName, name+".jsonl"))
+		if err != nil {
+			log.Printf("stats: %v", err)
+			killStats = nil
+			return nil
+		}
+		s.name = name
+		killStats = s
+	}
+	return killStats
+}
+
+// openStatsStore reads the log at path. A partly written last line, as
+// left by a crash, is skipped.
+func openStatsStore(path string) (*statsStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	s := &statsStore{path: path, started: time.Now()}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			s.partial = len(line) > 0
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var e statEvent
+		if json.Unmarshal(line, &e) == nil {
+			s.events = append(s.events, e)
+		}
+	}
+	return s, nil
+}
+
+// add appends e to the log.
+func (s *statsStore) add(e statEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if s.partial {
+		line = append([]byte{'\n'}, line...)
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.partial = false
+	s.events = append(s.events, e)
+	return nil
+}
+
+// since returns the events of period p, as of now.
+func (s *statsStore) since(p statsPeriod, now time.Time) []statEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var from time.Time
+	switch p {
+	case statsSession:
+		from = s.started
+	case statsToday:
+		y, m, d := now.Date()
+		from = time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	}
+	i := sort.Search(len(s.events), func(i int) bool { return !s.events[i].Time.Before(from) })
+	return append([]statEvent(nil), s.events[i:]...)
+}
+
+// parseKillText reads a "you killed" message such as "You helped
+// slaughter a Rat." The monster comes from its -mn tag when there is one.
+func parseKillText(raw []byte, s string) (monster string, helped bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(s), "You ")
+	if !ok {
+		return "", false
+	}
+	rest, helped = strings.CutPrefix(rest, "helped ")
+	if m := firstTagContent(raw, 'm', 'n'); m != "" {
+		return m, helped
+	}
+	// Drop the verb and the article before the monster.
+	if _, after, ok := strings.Cut(rest, " "); ok {
+		rest = after
+	} else {
+		return "", helped
+	}
+	for _, a := range []string{"a ", "an ", "the "} {
+		if r, ok := strings.CutPrefix(rest, a); ok {
+			rest = r
+			break
+		}
+	}
+	return strings.TrimRight(rest, ".!"), helped
+}
+
+// tagContents returns the text of every a/b2 tag pair in b.
+func tagContents(b []byte, a, b2 byte) []string {
+	tag := []byte{0xC2, a, b2}
+	var out []string
+	for {
+		i := bytes.Index(b, tag)
+		if i < 0 {
+			return out
+		}
+		b = b[i+3:]
+		j := bytes.Index(b, tag)
+		if j < 0 {
+			return out
+		}
+		out = append(out, strings.TrimSpace(decodeMacRoman(b[:j])))
+		b = b[j+3:]
+	}
+}
+
+// tallyStats breaks events down into the Stats window's tables. me is the
+// character the log belongs to. Tables with nothing in them are left out.
+func tallyStats(events []statEvent, me string) []statTable {
+	type counter struct {
+		title   string
+		columns []string
+		counts  map[string][]int
+	}
+	kills := &counter{title: "Kills", columns: []string{"Killed", "Helped"}}
+	killers := &counter{title: "Your falls by killer", columns: []string{"Falls"}}
+	places := &counter{title: "Your falls by location", columns: []string{"Falls"}}
+	falls := &counter{title: "Falls seen", columns: []string{"Falls"}}
+	raises := &counter{title: "Raises", columns: []string{"You raised", "Raised you"}}
+	karma := &counter{title: "Karma", columns: []string{"Gave good", "Gave bad", "Got good", "Got bad"}}
+	add := func(c *counter, name string, col int) {
+		if name == "" {
+			name = "unknown"
+		}
+		if c.counts == nil {
+			c.counts = map[string][]int{}
+		}
+		if c.counts[name] == nil {
+			c.counts[name] = make([]int, len(c.columns))
+		}
+		c.counts[name][col]++
+	}
+	for _, e := range events {
+		switch e.Kind {
+		case statKill:
+			col := 0
+			if e.Helped {
+				col = 1
+			}
+			add(kills, e.Name, col)
+		case statFall:
+			add(falls, e.Name, 0)
+			if strings.EqualFold(e.Name, me) {
+				add(killers, e.By, 0)
+				add(places, e.Where, 0)
+			}
+		case statRaise:
+			switch {
+			case e.By != "" && strings.EqualFold(e.By, me):
+				add(raises, e.Name, 0)
+			case e.By != "" && strings.EqualFold(e.Name, me):
+				add(raises, e.By, 1)
+			}
+		case statKarma:
+			col := 0
+			if e.Bad {
+				col = 1
+			}
+			if e.Received {
+				col += 2
+			}
+			add(karma, e.Name, col)
+		}
+	}
+
+	var tables []statTable
+	for _, c := range []*counter{kills, killers, places, falls, raises, karma} {
+		if len(c.counts) == 0 {
+			continue
+		}
+		t := statTable{Title: c.title, Columns: c.columns}
+		for name, counts := range c.counts {
+			t.Rows = append(t.Rows, statRow{Name: name, Counts: counts})
+		}
+		total := func(r statRow) int {
+			n := 0
+			for _, v := range r.Counts {
+				n += v
+			}
+			return n
+		}
+		sort.Slice(t.Rows, func(i, j int) bool {
+			if a, b := total(t.Rows[i]), total(t.Rows[j]); a != b {
+				return a > b
+			}
+			return t.Rows[i].Name < t.Rows[j].Name
+		})
+		tables = append(tables, t)
+	}
+	return tables
+}
+
+// writeStatsCSV writes events as CSV, one row each.
+func writeStatsCSV(w io.Writer, events []statEvent) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "kind", "name", "by", "where", "helped", "karma"})
+	for _, e := range events {
+		helped := ""
+		if e.Helped {
+			helped = "yes"
+		}
+		karma := ""
+		if e.Kind == statKarma {
+			karma = "good"
+			if e.Bad {
+				karma = "bad"
+			}
+			if e.Received {
+				karma += " received"
+			} else {
+				karma += " given"
+			}
+		}
+		cw.Write([]string{e.Time.Format(time.RFC3339), e.Kind, e.Name, e.By, e.Where, helped, karma})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// exportStatsCSV writes period p's events for the current character next
+// to its log and returns the file's path.
+func exportStatsCSV(p statsPeriod) (string, error) {
+	s := currentStats(focusedSession().playerName)
+	if s == nil {
+		return "", fmt.Errorf("not logged in")
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s-%s.csv", s.name, strings.ToLower(statsPeriodNames[p]), now.Format("2006-01-02-150405"))
+	path := filepath.Join(filepath.Dir(s.path), name)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := writeStatsCSV(f, s.since(p, now)); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseKillText(t *testing.T) {
+	mn := func(s string) []byte { return []byte("\xC2mn" + s + "\xC2mn") }
+	tests := []struct {
+		raw     []byte
+		text    string
+		monster string
+		helped  bool
+	}{
+		{append(append([]byte("You slaughtered a "), mn("Greater Vermine")...), '.'), "You slaughtered a Greater Vermine.", "Greater Vermine", false},
+		{append([]byte("You helped kill an "), mn("Orga Fury")...), "You helped kill an Orga Fury", "Orga Fury", true},
+		{nil, "You helped vanquish the Noid.", "Noid", true},
+		{nil, "You dispatched a Rat!", "Rat", false},
+		{nil, "Bob killed a Rat.", "", false},
+	}
+	for _, tt := range tests {
+		monster, helped := parseKillText(tt.raw, tt.text)
+		if monster != tt.monster || helped != tt.helped {
+			t.Errorf("parseKillText(%q) = %q, %v; want %q, %v", tt.text, monster, helped, tt.monster, tt.helped)
+		}
+	}
+}
+
+func TestRaiserName(t *testing.T) {
+	raw := append(pnTag("Bob"), " is no longer fallen, thanks to "...)
+	raw = append(raw, pnTag("Healer")...)
+	if got := raiserName(raw, "Bob"); got != "Healer" {
+		t.Errorf("raiser = %q", got)
+	}
+	if got := raiserName(append(pnTag("Bob"), " is no longer fallen"...), "Bob"); got != "" {
+		t.Errorf("raiser without a second name = %q", got)
+	}
+}
+
+func TestTallyStats(t *testing.T) {
+	events := []statEvent{
+		{Kind: statKill, Name: "Rat"},
+		{Kind: statKill, Name: "Rat", Helped: true},
+		{Kind: statKill, Name: "Orga"},
+		{Kind: statKill, Name: "Rat"},
+		{Kind: statFall, Name: "Hero", By: "Orga", Where: "Orga Camp"},
+		{Kind: statFall, Name: "Hero", Where: "Orga Camp"},
+		{Kind: statFall, Name: "Bob", By: "Rat"},
+		{Kind: statRaise, Name: "Bob", By: "Hero"},
+		{Kind: statRaise, Name: "Hero", By: "Healer"},
+		{Kind: statRaise, Name: "Bob"},
+		{Kind: statKarma, Name: "Bob", Received: true},
+		{Kind: statKarma, Name: "Bob", Bad: true},
+	}
+	got := tallyStats(events, "Hero")
+	want := []statTable{
+		{"Kills", []string{"Killed", "Helped"}, []statRow{{"Rat", []int{2, 1}}, {"Orga", []int{1, 0}}}},
+		{"Your falls by killer", []string{"Falls"}, []statRow{{"Orga", []int{1}}, {"unknown", []int{1}}}},
+		{"Your falls by location", []string{"Falls"}, []statRow{{"Orga Camp", []int{2}}}},
+		{"Falls seen", []string{"Falls"}, []statRow{{"Hero", []int{2}}, {"Bob", []int{1}}}},
+		{"Raises", []string{"You raised", "Raised you"}, []statRow{{"Bob", []int{1, 0}}, {"Healer", []int{0, 1}}}},
+		{"Karma", []string{"Gave good", "Gave bad", "Got good", "Got bad"}, []statRow{{"Bob", []int{0, 1, 1, 0}}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+	if got := tallyStats(nil, "Hero"); got != nil {
+		t.Errorf("empty log: %+v", got)
+	}
+}
+
+func TestStatsStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Stats", "Hero.jsonl")
+	s, err := openStatsStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 3, 4, 15, 0, 0, 0, time.Local)
+	s.started = now.Add(-time.Hour)
+	for _, e := range []statEvent{
+		{Time: now.AddDate(0, 0, -2), Kind: statKill, Name: "Rat"},
+		{Time: now.Add(-2 * time.Hour), Kind: statFall, Name: "Hero", By: "Orga", Where: "Orga Camp"},
+		{Time: now.Add(-time.Minute), Kind: statKarma, Name: "Bob", Received: true},
+	} {
+		if err := s.add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A line cut short by a crash is skipped.
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString(`{"t":"2026-03-04T15:00:00Z","ki`)
+	f.Close()
+
+	s2, err := openStatsStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2.started = s.started
+	// The next entry starts on a line of its own.
+	if err := s2.add(statEvent{Time: now, Kind: statKill, Name: "Rat"}); err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[statsPeriod]int{statsSession: 2, statsToday: 3, statsLifetime: 4} {
+		if got := len(s2.since(p, now)); got != want {
+			t.Errorf("%s: %d events, want %d", statsPeriodNames[p], got, want)
+		}
+	}
+
+	if s3, err := openStatsStore(path); err != nil || len(s3.events) != 4 {
+		t.Fatalf("reopened: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeStatsCSV(&buf, s2.since(statsToday, now)); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || lines[0] != "time,kind,name,by,where,helped,karma" ||
+		!strings.HasSuffix(lines[1], ",fall,Hero,Orga,Orga Camp,,") ||
+		!strings.HasSuffix(lines[2], ",karma,Bob,,,,good received") {
+		t.Errorf("csv:\n%s", buf.String())
+	}
+}
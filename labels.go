@@ -62,37 +62,72 @@ func applyPlayerLabel(p *Player) {
 	}
 }
 
+// setPlayerLabel labels name for the character in the game window, or for
+// every character when global is set.
 func setPlayerLabel(name string, label int, global bool) {
-	p := getPlayer(name)
-	playersMu.Lock()
 	if global {
+		setGlobalLabel(name, label, false)
+		return
+	}
+	focusedSession().setLocalLabel(name, label)
+}
+
+// setGlobalLabel sets name's global label in the player list of every
+// session, since global labels hold for all characters. forget also drops
+// the local label.
+func setGlobalLabel(name string, label int, forget bool) {
+	for _, s := range allSessions() {
+		p := s.getPlayer(name)
+		s.playersMu.Lock()
 		p.GlobalLabel = label
-	} else {
-		p.LocalLabel = label
-		for i := range characters {
-			if strings.EqualFold(characters[i].Name, playerName) {
-				if characters[i].Labels == nil {
-					characters[i].Labels = make(map[string]int)
-				}
-				if label == 0 {
-					delete(characters[i].Labels, name)
-				} else {
-					characters[i].Labels[name] = label
-				}
-				saveCharacters()
-				break
+		if forget {
+			p.LocalLabel = 0
+		}
+		applyPlayerLabel(p)
+		playerCopy := *p
+		s.playersMu.Unlock()
+		s.killNameTagCacheFor(name)
+		s.notifyPlayerHandlers(playerCopy)
+	}
+	playersDirty = true
+	playersPersistDirty = true
+}
+
+// globalLabel returns name's global label as the session in the game window
+// knows it.
+func globalLabel(name string) int {
+	s := focusedSession()
+	p := s.getPlayer(name)
+	s.playersMu.RLock()
+	defer s.playersMu.RUnlock()
+	return p.GlobalLabel
+}
+
+// setLocalLabel labels name for s's character only.
+func (s *session) setLocalLabel(name string, label int) {
+	p := s.getPlayer(name)
+	s.playersMu.Lock()
+	p.LocalLabel = label
+	for i := range characters {
+		if strings.EqualFold(characters[i].Name, s.playerName) {
+			if characters[i].Labels == nil {
+				characters[i].Labels = make(map[string]int)
+			}
+			if label == 0 {
+				delete(characters[i].Labels, name)
+			} else {
+				characters[i].Labels[name] = label
 			}
+			saveCharacters()
+			break
 		}
 	}
 	applyPlayerLabel(p)
 	playerCopy := *p
-	playersMu.Unlock()
+	s.playersMu.Unlock()
 	playersDirty = true
-	if global {
-		playersPersistDirty = true
-	}
-	killNameTagCacheFor(name)
-	notifyPlayerHandlers(playerCopy)
+	s.killNameTagCacheFor(name)
+	s.notifyPlayerHandlers(playerCopy)
 }
 
 func showLabelMenu(name string, pos eui.Point, global bool) {
@@ -153,14 +188,15 @@ func openLabelEditWindow() {
 	labelEditWin.Refresh()
 }
 
-func applyLocalLabels() {
-	if playerName == "" {
+// applyLocalLabels loads the labels s's character gave other players.
+func (s *session) applyLocalLabels() {
+	if s.playerName == "" {
 		return
 	}
 	for i := range characters {
-		if strings.EqualFold(characters[i].Name, playerName) {
+		if strings.EqualFold(characters[i].Name, s.playerName) {
 			for n, lbl := range characters[i].Labels {
-				p := getPlayer(n)
+				p := s.getPlayer(n)
 				p.LocalLabel = lbl
 				if p.GlobalLabel == 0 {
 					applyPlayerLabel(p)
@@ -97,7 +97,7 @@ func ensureLightingTmp(w, h int) {
 	}
 }
 
-func applyLightingShader(dst *ebiten.Image, lights []lightSource, darks []darkSource, t float32) {
+func applyLightingShader(dst *ebiten.Image, lh *lightHistory, lights []lightSource, darks []darkSource, t float32, nightLevel int) {
 	w, h := dst.Bounds().Dx(), dst.Bounds().Dy()
 	ensureLightingTmp(w, h)
 	lightingTmp.DrawImage(dst, nil)
@@ -109,8 +109,8 @@ func applyLightingShader(dst *ebiten.Image, lights []lightSource, darks []darkSo
 	// Build a temporally smoothed set by blending previous and current
 	// light parameters. Positions are already interpolated elsewhere;
 	// we blend color/radius and add fade in/out intensities.
-	il := interpolateLights(lights, t)
-	id := interpolateDarks(darks, t)
+	il := lh.interpolateLights(lights, t)
+	id := lh.interpolateDarks(darks, t)
 
 	uniforms := map[string]any{
 		"LightCount": len(il),
@@ -167,8 +167,8 @@ func applyLightingShader(dst *ebiten.Image, lights []lightSource, darks []darkSo
 	// Compute smoothed night factor for reveal scaling in shader.
 	// If we have night smoothing state, use it; otherwise fall back to current level.
 	nightFactor := float32(0)
-	if nightAlphaInited {
-		nf := lerpf(nightPrevTarget, nightCurTarget, ease(t)) / float32(shaderNightStrength)
+	if lh.nightAlphaInited {
+		nf := lerpf(lh.nightPrevTarget, lh.nightCurTarget, ease(t)) / float32(shaderNightStrength)
 		if nf < 0 {
 			nf = 0
 		} else if nf > 1 {
@@ -176,8 +176,7 @@ func applyLightingShader(dst *ebiten.Image, lights []lightSource, darks []darkSo
 		}
 		nightFactor = nf
 	} else {
-		lvl := currentNightLevel()
-		nightFactor = float32(lvl) / 100
+		nightFactor = float32(nightLevel) / 100
 	}
 	uniforms["NightFactor"] = nightFactor
 
@@ -199,16 +198,7 @@ func min(a, b int) int {
 // addNightDarkSources appends dark sources to produce a smooth inverse-square
 // vignette-like darkening using the shader path. The overall strength scales
 // with the current/effective night level and ambientNightStrength.
-// Night smoothing state
-var (
-	nightAlphaInited bool
-	nightLastT       float32
-	nightPrevTarget  float32
-	nightCurTarget   float32
-)
-
-func addNightDarkSources(w, h int, t float32) {
-	lvl := currentNightLevel()
+func (lh *lightHistory) addNightDarkSources(w, h int, t float32, lvl int) {
 	if lvl <= 0 {
 		return
 	}
@@ -220,20 +210,20 @@ func addNightDarkSources(w, h int, t float32) {
 	// Photometric-like response; tweak exponent if needed (2.2 is typical)
 	gamma := 2.2
 	target := float32(math.Pow(frac, gamma) * float64(shaderNightStrength))
-	if nightAlphaInited {
-		if t < nightLastT { // new frame
-			nightPrevTarget = nightCurTarget
-			nightCurTarget = target
+	if lh.nightAlphaInited {
+		if t < lh.nightLastT { // new frame
+			lh.nightPrevTarget = lh.nightCurTarget
+			lh.nightCurTarget = target
 		} else {
-			nightCurTarget = target
+			lh.nightCurTarget = target
 		}
 	} else {
-		nightAlphaInited = true
-		nightPrevTarget = target
-		nightCurTarget = target
+		lh.nightAlphaInited = true
+		lh.nightPrevTarget = target
+		lh.nightCurTarget = target
 	}
-	nightLastT = t
-	alpha := lerpf(nightPrevTarget, nightCurTarget, ease(t))
+	lh.nightLastT = t
+	alpha := lerpf(lh.nightPrevTarget, lh.nightCurTarget, ease(t))
 	if alpha <= 0 {
 		return
 	}
@@ -288,12 +278,22 @@ func addLightSource(pictID uint32, x, y float64, size int) {
 	}
 }
 
-// Previous frame lighting state for temporal blending
-var (
-	prevLights []lightSource
-	prevDarks  []darkSource
-	havePrev   bool
-)
+// gameLights is the lighting history of the game window.
+var gameLights lightHistory
+
+// lightHistory holds the temporal lighting state of one rendered view:
+// the smoothed night level and the previous frame's lights for blending.
+// Each alt session view keeps its own so it never blends against the game
+// window's frames.
+type lightHistory struct {
+	nightAlphaInited bool
+	nightLastT       float32
+	nightPrevTarget  float32
+	nightCurTarget   float32
+	prevLights       []lightSource
+	prevDarks        []darkSource
+	havePrev         bool
+}
 
 // smoothstep easing for temporal interpolation
 func ease(t float32) float32 {
@@ -322,13 +322,13 @@ func dist2(ax, ay, bx, by float32) float32 {
 }
 
 // interpolateLights blends current lights with previous for smoother fades.
-func interpolateLights(curr []lightSource, t float32) []lightSource {
-	if len(curr) == 0 && !havePrev {
+func (lh *lightHistory) interpolateLights(curr []lightSource, t float32) []lightSource {
+	if len(curr) == 0 && !lh.havePrev {
 		return curr
 	}
 	u := ease(t)
 	// If we have no previous, start small radius and grow during first interval.
-	if !havePrev {
+	if !lh.havePrev {
 		out := make([]lightSource, min(len(curr), maxLights))
 		for i := 0; i < len(out); i++ {
 			out[i] = curr[i]
@@ -337,14 +337,14 @@ func interpolateLights(curr []lightSource, t float32) []lightSource {
 			out[i].Radius = lerpf(curr[i].Radius*newLightStartRadiusFactor, curr[i].Radius, u)
 		}
 		// store prev for next frame (persist grown radius)
-		prevLights = cloneLights(out)
-		havePrev = true
+		lh.prevLights = cloneLights(out)
+		lh.havePrev = true
 		return out
 	}
 
 	// Track matches
-	matchedPrev := make([]bool, len(prevLights))
-	out := make([]lightSource, 0, min(len(curr)+len(prevLights), maxLights))
+	matchedPrev := make([]bool, len(lh.prevLights))
+	out := make([]lightSource, 0, min(len(curr)+len(lh.prevLights), maxLights))
 
 	// Greedy nearest match by position
 	for _, c := range curr {
@@ -358,7 +358,7 @@ func interpolateLights(curr []lightSource, t float32) []lightSource {
 			thresh = 96
 		}
 		thresh2 := thresh * thresh
-		for j, p := range prevLights {
+		for j, p := range lh.prevLights {
 			if matchedPrev[j] {
 				continue
 			}
@@ -369,7 +369,7 @@ func interpolateLights(curr []lightSource, t float32) []lightSource {
 			}
 		}
 		if best >= 0 {
-			p := prevLights[best]
+			p := lh.prevLights[best]
 			matchedPrev[best] = true
 			// Positions already interpolated elsewhere; use current.
 			o := c
@@ -393,7 +393,7 @@ func interpolateLights(curr []lightSource, t float32) []lightSource {
 	}
 	// Unmatched previous lights: fade out
 	if len(out) < maxLights {
-		for j, p := range prevLights {
+		for j, p := range lh.prevLights {
 			if matchedPrev[j] {
 				continue
 			}
@@ -409,29 +409,29 @@ func interpolateLights(curr []lightSource, t float32) []lightSource {
 	}
 
 	// store blended result as previous for next frame
-	prevLights = cloneLights(out)
-	havePrev = true
+	lh.prevLights = cloneLights(out)
+	lh.havePrev = true
 	return out
 }
 
-func interpolateDarks(curr []darkSource, t float32) []darkSource {
-	if len(curr) == 0 && !havePrev {
+func (lh *lightHistory) interpolateDarks(curr []darkSource, t float32) []darkSource {
+	if len(curr) == 0 && !lh.havePrev {
 		return curr
 	}
 	u := ease(t)
-	if !havePrev {
+	if !lh.havePrev {
 		out := make([]darkSource, min(len(curr), maxLights))
 		for i := 0; i < len(out); i++ {
 			out[i] = curr[i]
 			out[i].Intensity = 1
 			out[i].Radius = lerpf(curr[i].Radius*newDarkStartRadiusFactor, curr[i].Radius, u)
 		}
-		prevDarks = cloneDarks(out)
-		havePrev = true
+		lh.prevDarks = cloneDarks(out)
+		lh.havePrev = true
 		return out
 	}
-	matchedPrev := make([]bool, len(prevDarks))
-	out := make([]darkSource, 0, min(len(curr)+len(prevDarks), maxLights))
+	matchedPrev := make([]bool, len(lh.prevDarks))
+	out := make([]darkSource, 0, min(len(curr)+len(lh.prevDarks), maxLights))
 	for _, c := range curr {
 		best := -1
 		bestD2 := float32(1e12)
@@ -442,7 +442,7 @@ func interpolateDarks(curr []darkSource, t float32) []darkSource {
 			thresh = 128
 		}
 		thresh2 := thresh * thresh
-		for j, p := range prevDarks {
+		for j, p := range lh.prevDarks {
 			if matchedPrev[j] {
 				continue
 			}
@@ -453,7 +453,7 @@ func interpolateDarks(curr []darkSource, t float32) []darkSource {
 			}
 		}
 		if best >= 0 {
-			p := prevDarks[best]
+			p := lh.prevDarks[best]
 			matchedPrev[best] = true
 			o := c
 			o.Alpha = lerpf(p.Alpha, c.Alpha, u)
@@ -471,7 +471,7 @@ func interpolateDarks(curr []darkSource, t float32) []darkSource {
 		}
 	}
 	if len(out) < maxLights {
-		for j, p := range prevDarks {
+		for j, p := range lh.prevDarks {
 			if matchedPrev[j] {
 				continue
 			}
@@ -484,8 +484,8 @@ func interpolateDarks(curr []darkSource, t float32) []darkSource {
 			}
 		}
 	}
-	prevDarks = cloneDarks(out)
-	havePrev = true
+	lh.prevDarks = cloneDarks(out)
+	lh.havePrev = true
 	return out
 }
 
@@ -22,6 +22,10 @@ var (
 	// debugPacketDumpLen limits how many bytes of a packet payload are logged.
 	// A value of 0 dumps the entire payload.
 	debugPacketDumpLen = 256
+
+	// logOutput mirrors log lines to the terminal. Headless mode points it
+	// at stderr so stdout only carries the JSON stream.
+	logOutput io.Writer = os.Stdout
 )
 
 func setupLogging(debug bool) {
@@ -33,7 +37,7 @@ func setupLogging(debug bool) {
 
 	errorLogPath = filepath.Join(logDir, fmt.Sprintf("error-%s.log", ts))
 	errorLogOnce = sync.Once{}
-	errorLogger = log.New(os.Stdout, "", log.LstdFlags)
+	errorLogger = log.New(logOutput, "", log.LstdFlags)
 	log.SetOutput(errorLogger.Writer())
 
 	setDebugLogging(debug)
@@ -43,7 +47,7 @@ func logError(format string, v ...interface{}) {
 	if errorLogger != nil {
 		errorLogOnce.Do(func() {
 			if f, err := os.Create(errorLogPath); err == nil {
-				errorLogger.SetOutput(io.MultiWriter(os.Stdout, f))
+				errorLogger.SetOutput(io.MultiWriter(logOutput, f))
 				log.SetOutput(errorLogger.Writer())
 			}
 		})
@@ -58,7 +62,7 @@ func logDebug(format string, v ...interface{}) {
 	if debugLogger != nil {
 		debugLogOnce.Do(func() {
 			if f, err := os.Create(debugLogPath); err == nil {
-				debugLogger.SetOutput(io.MultiWriter(os.Stdout, f))
+				debugLogger.SetOutput(io.MultiWriter(logOutput, f))
 			}
 		})
 		debugLogger.Printf(format, v...)
@@ -71,7 +75,7 @@ func logDebugPacket(prefix string, data []byte) {
 	}
 	debugLogOnce.Do(func() {
 		if f, err := os.Create(debugLogPath); err == nil {
-			debugLogger.SetOutput(io.MultiWriter(os.Stdout, f))
+			debugLogger.SetOutput(io.MultiWriter(logOutput, f))
 		}
 	})
 	n := len(data)
@@ -91,7 +95,7 @@ func setDebugLogging(enabled bool) {
 		ts := time.Now().Format("20060102-150405")
 		debugLogPath = filepath.Join(logDir, fmt.Sprintf("debug-%s.log", ts))
 		debugLogOnce = sync.Once{}
-		debugLogger = log.New(os.Stdout, "", log.LstdFlags)
+		debugLogger = log.New(logOutput, "", log.LstdFlags)
 	} else {
 		debugLogger = nil
 	}
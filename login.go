@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -22,9 +23,25 @@ var (
 	loginMu     sync.Mutex
 )
 
+var errClientOutOfDate = errors.New("client out of date; please download the latest release")
+
+// loginError is returned by login when the server rejects the log-on with
+// a kError code.
+type loginError struct {
+	code int16
+}
+
+func (e *loginError) Error() string {
+	if name, ok := errorNames[e.code]; ok {
+		return fmt.Sprintf("login failed: %s (%d)", name, e.code)
+	}
+	return fmt.Sprintf("login failed: %d", e.code)
+}
+
 func handleDisconnect() {
+	stopped := cancelReconnect()
 	loginMu.Lock()
-	if loginCancel == nil {
+	if loginCancel == nil && !stopped {
 		loginMu.Unlock()
 		return
 	}
@@ -32,14 +49,23 @@ func handleDisconnect() {
 	loginCancel = nil
 	loginMu.Unlock()
 
-	cancel()
+	if cancel != nil {
+		cancel()
+	}
+	endSessions()
+	mainSession.stopMovieRecording()
+	stopClassicMacros()
 	// Reset session sources so we return to splash state
 	clmov = ""
 	pcapPath = ""
 	pass = ""
-	if name != "" {
+	if name := mainSession.name; name != "" {
 		for i := range characters {
 			if characters[i].Name == name {
+				if charactersLocked() && characters[i].Sealed != "" {
+					// Typed instead of unlocking; keep the sealed password.
+					break
+				}
 				if passHash == "" && (!characters[i].DontRemember || characters[i].passHash != "") {
 					characters[i].passHash = ""
 					characters[i].DontRemember = true
@@ -51,6 +77,9 @@ func handleDisconnect() {
 		}
 	}
 	consoleMessage("Disconnected from server.")
+	if headless {
+		return
+	}
 	loginWin.MarkOpen()
 	updateCharacterButtons()
 }
@@ -211,215 +240,229 @@ func fetchRandomDemoCharacter(clientVersion int) (string, error) {
 // login connects to the server and performs the login handshake.
 // It runs the network loops and blocks until the context is canceled.
 func login(ctx context.Context, clientVersion int) error {
-	resetDrawState()
-	for {
-		imagesVersion, err := readKeyFileVersion(filepath.Join(dataDirPath, CL_ImagesFile))
-		imagesMissing := false
-		if err != nil {
-			if os.IsNotExist(err) {
-				log.Printf("CL_Images missing; will fetch from server")
-				imagesVersion = 0
-				imagesMissing = true
-			} else {
-				log.Printf("warning: %v", err)
-				imagesVersion = encodeFullVersion(clientVersion)
-			}
+	s := mainSession
+	s.resetDrawState()
+	tcpConn, udpConn, err := dialLogin(s.name, pass, passHash, clientVersion)
+	if err != nil {
+		// Headless runs report the error on stdout instead.
+		if errors.Is(err, errClientOutOfDate) && !headless {
+			browser.OpenURL("https://github.com/Distortions81/goThoom/releases")
 		}
-
-		soundsVersion, err := readKeyFileVersion(filepath.Join(dataDirPath, CL_SoundsFile))
-		soundsMissing := false
-		if err != nil {
-			if os.IsNotExist(err) {
-				log.Printf("CL_Sounds missing; will fetch from server")
-				soundsVersion = 0
-				soundsMissing = true
-			} else {
-				log.Printf("warning: %v", err)
-				soundsVersion = encodeFullVersion(clientVersion)
-			}
+		return err
+	}
+	s.playerName = utfFold(s.name)
+	s.applyLocalLabels()
+	s.setConns(tcpConn, udpConn)
+	applyEnabledPlugins()
+
+	logDebug("login succeeded, reading messages (Ctrl-C to quit)...")
+	reconnectSucceeded()
+	loadClassicMacros()
+
+	if recordPath != "" {
+		if err := s.startMovieRecording(recordPath); err != nil {
+			logError("%v", err)
 		}
+	}
 
-		sendVersion := int(imagesVersion >> 8)
-		clientFull := encodeFullVersion(sendVersion)
-		soundsOutdated := soundsVersion != clientFull
-		if soundsOutdated && !soundsMissing {
-			log.Printf("warning: CL_Sounds version %d does not match client version %d", soundsVersion>>8, sendVersion)
-		}
+	inputMu.Lock()
+	in := latestInput
+	inputMu.Unlock()
+	if err := s.sendPlayerInput(udpConn, in.mouseX, in.mouseY, in.mouseDown, false); err != nil {
+		logError("send player input: %v", err)
+	}
 
-		if imagesMissing || soundsMissing || soundsOutdated || sendVersion == 0 {
-			sendVersion = clVersion - 1
-		}
+	go sendInputLoop(ctx, s, udpConn, tcpConn)
+	go udpReadLoop(ctx, s, udpConn)
+	go tcpReadLoop(ctx, s, tcpConn)
 
-		var errDial error
-		tcpConn, errDial = net.Dial("tcp", host)
-		if errDial != nil {
-			return fmt.Errorf("tcp connect: %w", errDial)
-		}
-		udpConn, err := net.Dial("udp", host)
-		if err != nil {
-			tcpConn.Close()
-			return fmt.Errorf("udp connect: %w", err)
-		}
+	<-ctx.Done()
+	s.stopMovieRecording()
+	s.setConns(nil, nil)
+	tcpConn.Close()
+	udpConn.Close()
+	return nil
+}
 
-		var idBuf [4]byte
-		if _, err := io.ReadFull(tcpConn, idBuf[:]); err != nil {
-			tcpConn.Close()
-			udpConn.Close()
-			return fmt.Errorf("read id: %w", err)
+// dialLogin connects to the server and logs charName on with password or,
+// when that is empty, the saved hash. It returns the open connections.
+func dialLogin(charName, password, hash string, clientVersion int) (tcpConn, udpConn net.Conn, err error) {
+	imagesVersion, err := readKeyFileVersion(filepath.Join(dataDirPath, CL_ImagesFile))
+	imagesMissing := false
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Printf("CL_Images missing; will fetch from server")
+			imagesVersion = 0
+			imagesMissing = true
+		} else {
+			log.Printf("warning: %v", err)
+			imagesVersion = encodeFullVersion(clientVersion)
 		}
+	}
 
-		handshake := append([]byte{0xff, 0xff}, idBuf[:]...)
-		if _, err := udpConn.Write(handshake); err != nil {
-			tcpConn.Close()
-			udpConn.Close()
-			return fmt.Errorf("send handshake: %w", err)
+	soundsVersion, err := readKeyFileVersion(filepath.Join(dataDirPath, CL_SoundsFile))
+	soundsMissing := false
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Printf("CL_Sounds missing; will fetch from server")
+			soundsVersion = 0
+			soundsMissing = true
+		} else {
+			log.Printf("warning: %v", err)
+			soundsVersion = encodeFullVersion(clientVersion)
 		}
+	}
 
-		var confirm [2]byte
-		if _, err := io.ReadFull(tcpConn, confirm[:]); err != nil {
-			tcpConn.Close()
-			udpConn.Close()
-			return fmt.Errorf("confirm handshake: %w", err)
-		}
-		if err := sendClientIdentifiers(tcpConn, encodeFullVersion(sendVersion), imagesVersion, soundsVersion); err != nil {
-			tcpConn.Close()
-			udpConn.Close()
-			return fmt.Errorf("send identifiers: %w", err)
-		}
-		logDebug("connected to %v", host)
+	sendVersion := int(imagesVersion >> 8)
+	clientFull := encodeFullVersion(sendVersion)
+	soundsOutdated := soundsVersion != clientFull
+	if soundsOutdated && !soundsMissing {
+		log.Printf("warning: CL_Sounds version %d does not match client version %d", soundsVersion>>8, sendVersion)
+	}
 
-		msg, err := readTCPMessage(tcpConn)
-		if err != nil {
-			tcpConn.Close()
-			udpConn.Close()
-			return fmt.Errorf("read challenge: %w", err)
-		}
-		if len(msg) < 16 {
-			tcpConn.Close()
-			udpConn.Close()
-			return fmt.Errorf("short challenge message")
-		}
-		tag := binary.BigEndian.Uint16(msg[:2])
-		const kMsgChallenge = 18
-		if tag != kMsgChallenge {
-			tcpConn.Close()
-			udpConn.Close()
-			return fmt.Errorf("unexpected msg tag %d", tag)
-		}
-		// Obtain the server's client version from the challenge and, if
-		// ours is newer, downgrade so we can connect to an older server.
-		serverVersion := int(binary.BigEndian.Uint32(msg[4:8]) >> 8)
-		if sendVersion > serverVersion {
-			sendVersion = serverVersion
-		}
-		challenge := msg[16 : 16+16]
+	if imagesMissing || soundsMissing || soundsOutdated || sendVersion == 0 {
+		sendVersion = clVersion - 1
+	}
 
-		if pass == "" && passHash == "" {
-			tcpConn.Close()
-			udpConn.Close()
-			return fmt.Errorf("character password required")
-		}
-		playerName = utfFold(name)
-		applyLocalLabels()
-		applyEnabledPlugins()
-
-		var resp []byte
-		var result int16
-		for {
-			var answer []byte
-			if pass != "" {
-				answer, err = answerChallenge(pass, challenge)
-			} else {
-				answer, err = answerChallengeHash(passHash, challenge)
-			}
-			if err != nil {
-				tcpConn.Close()
-				udpConn.Close()
-				return fmt.Errorf("hash: %w", err)
-			}
+	tcpConn, err = net.Dial("tcp", host)
+	if err != nil {
+		return nil, nil, fmt.Errorf("tcp connect: %w", err)
+	}
+	udpConn, err = net.Dial("udp", host)
+	if err != nil {
+		tcpConn.Close()
+		return nil, nil, fmt.Errorf("udp connect: %w", err)
+	}
 
-			const kMsgLogOn = 13
-			nameBytes := encodeMacRoman(name)
-			buf := make([]byte, 16+len(nameBytes)+1+len(answer))
-			binary.BigEndian.PutUint16(buf[0:2], kMsgLogOn)
-			binary.BigEndian.PutUint16(buf[2:4], 0)
-			binary.BigEndian.PutUint32(buf[4:8], encodeFullVersion(sendVersion))
-			binary.BigEndian.PutUint32(buf[8:12], imagesVersion)
-			binary.BigEndian.PutUint32(buf[12:16], soundsVersion)
-			copy(buf[16:], nameBytes)
-			buf[16+len(nameBytes)] = 0
-			copy(buf[17+len(nameBytes):], answer)
-			simpleEncrypt(buf[16:])
-
-			if err := sendTCPMessage(tcpConn, buf); err != nil {
-				tcpConn.Close()
-				udpConn.Close()
-				return fmt.Errorf("send login: %w", err)
-			}
+	var idBuf [4]byte
+	if _, err := io.ReadFull(tcpConn, idBuf[:]); err != nil {
+		tcpConn.Close()
+		udpConn.Close()
+		return nil, nil, fmt.Errorf("read id: %w", err)
+	}
 
-			resp, err = readTCPMessage(tcpConn)
-			if err != nil {
-				tcpConn.Close()
-				udpConn.Close()
-				return fmt.Errorf("read login response: %w", err)
-			}
-			resTag := binary.BigEndian.Uint16(resp[:2])
-			const kMsgLogOnResp = 13
-			if resTag == kMsgLogOnResp {
-				result = int16(binary.BigEndian.Uint16(resp[2:4]))
-				if name, ok := errorNames[result]; ok && result != 0 {
-					logDebug("login result: %d (%v)", result, name)
-				} else {
-					logDebug("login result: %d", result)
-				}
-				break
-			}
-			if resTag == kMsgChallenge {
-				challenge = resp[16 : 16+16]
-				continue
-			}
+	handshake := append([]byte{0xff, 0xff}, idBuf[:]...)
+	if _, err := udpConn.Write(handshake); err != nil {
+		tcpConn.Close()
+		udpConn.Close()
+		return nil, nil, fmt.Errorf("send handshake: %w", err)
+	}
+
+	var confirm [2]byte
+	if _, err := io.ReadFull(tcpConn, confirm[:]); err != nil {
+		tcpConn.Close()
+		udpConn.Close()
+		return nil, nil, fmt.Errorf("confirm handshake: %w", err)
+	}
+	if err := sendClientIdentifiers(tcpConn, encodeFullVersion(sendVersion), imagesVersion, soundsVersion); err != nil {
+		tcpConn.Close()
+		udpConn.Close()
+		return nil, nil, fmt.Errorf("send identifiers: %w", err)
+	}
+	logDebug("connected to %v", host)
+
+	msg, err := readTCPMessage(tcpConn)
+	if err != nil {
+		tcpConn.Close()
+		udpConn.Close()
+		return nil, nil, fmt.Errorf("read challenge: %w", err)
+	}
+	if len(msg) < 16 {
+		tcpConn.Close()
+		udpConn.Close()
+		return nil, nil, fmt.Errorf("short challenge message")
+	}
+	tag := binary.BigEndian.Uint16(msg[:2])
+	const kMsgChallenge = 18
+	if tag != kMsgChallenge {
+		tcpConn.Close()
+		udpConn.Close()
+		return nil, nil, fmt.Errorf("unexpected msg tag %d", tag)
+	}
+	// Obtain the server's client version from the challenge and, if
+	// ours is newer, downgrade so we can connect to an older server.
+	serverVersion := int(binary.BigEndian.Uint32(msg[4:8]) >> 8)
+	if sendVersion > serverVersion {
+		sendVersion = serverVersion
+	}
+	challenge := msg[16 : 16+16]
+
+	if password == "" && hash == "" {
+		tcpConn.Close()
+		udpConn.Close()
+		return nil, nil, fmt.Errorf("character password required")
+	}
+
+	var resp []byte
+	var result int16
+	for {
+		var answer []byte
+		if password != "" {
+			answer, err = answerChallenge(password, challenge)
+		} else {
+			answer, err = answerChallengeHash(hash, challenge)
+		}
+		if err != nil {
 			tcpConn.Close()
 			udpConn.Close()
-			return fmt.Errorf("unexpected response tag %d", resTag)
+			return nil, nil, fmt.Errorf("hash: %w", err)
 		}
 
-		if result == -30972 || result == -30973 {
-			browser.OpenURL("https://github.com/Distortions81/goThoom/releases")
+		const kMsgLogOn = 13
+		nameBytes := encodeMacRoman(charName)
+		buf := make([]byte, 16+len(nameBytes)+1+len(answer))
+		binary.BigEndian.PutUint16(buf[0:2], kMsgLogOn)
+		binary.BigEndian.PutUint16(buf[2:4], 0)
+		binary.BigEndian.PutUint32(buf[4:8], encodeFullVersion(sendVersion))
+		binary.BigEndian.PutUint32(buf[8:12], imagesVersion)
+		binary.BigEndian.PutUint32(buf[12:16], soundsVersion)
+		copy(buf[16:], nameBytes)
+		buf[16+len(nameBytes)] = 0
+		copy(buf[17+len(nameBytes):], answer)
+		simpleEncrypt(buf[16:])
+
+		if err := sendTCPMessage(tcpConn, buf); err != nil {
 			tcpConn.Close()
 			udpConn.Close()
-			return fmt.Errorf("client out of date; please download the latest release")
+			return nil, nil, fmt.Errorf("send login: %w", err)
 		}
 
-		if result != 0 {
+		resp, err = readTCPMessage(tcpConn)
+		if err != nil {
 			tcpConn.Close()
 			udpConn.Close()
-			if name, ok := errorNames[result]; ok {
-				return fmt.Errorf("login failed: %s (%d)", name, result)
+			return nil, nil, fmt.Errorf("read login response: %w", err)
+		}
+		resTag := binary.BigEndian.Uint16(resp[:2])
+		const kMsgLogOnResp = 13
+		if resTag == kMsgLogOnResp {
+			result = int16(binary.BigEndian.Uint16(resp[2:4]))
+			if name, ok := errorNames[result]; ok && result != 0 {
+				logDebug("login result: %d (%v)", result, name)
+			} else {
+				logDebug("login result: %d", result)
 			}
-			return fmt.Errorf("login failed: %d", result)
+			break
 		}
-
-		logDebug("login succeeded, reading messages (Ctrl-C to quit)...")
-
-		inputMu.Lock()
-		s := latestInput
-		inputMu.Unlock()
-		if err := sendPlayerInput(udpConn, s.mouseX, s.mouseY, s.mouseDown, false); err != nil {
-			logError("send player input: %v", err)
+		if resTag == kMsgChallenge {
+			challenge = resp[16 : 16+16]
+			continue
 		}
+		tcpConn.Close()
+		udpConn.Close()
+		return nil, nil, fmt.Errorf("unexpected response tag %d", resTag)
+	}
 
-		go sendInputLoop(ctx, udpConn, tcpConn)
-		go udpReadLoop(ctx, udpConn)
-		go tcpReadLoop(ctx, tcpConn)
+	if result == -30972 || result == -30973 {
+		tcpConn.Close()
+		udpConn.Close()
+		return nil, nil, errClientOutOfDate
+	}
 
-		<-ctx.Done()
-		if tcpConn != nil {
-			tcpConn.Close()
-			tcpConn = nil
-		}
-		if udpConn != nil {
-			udpConn.Close()
-		}
-		return nil
+	if result != 0 {
+		tcpConn.Close()
+		udpConn.Close()
+		return nil, nil, &loginError{code: result}
 	}
+	return tcpConn, udpConn, nil
 }
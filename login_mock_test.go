@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gothoom/eui"
+	"gothoom/mockserver"
+)
+
+// startMockServer points the client at a mock server for the duration of
+// the test.
+func startMockServer(t *testing.T, cfg mockserver.Config) *mockserver.Server {
+	t.Helper()
+	srv, err := mockserver.Start(cfg)
+	if err != nil {
+		t.Fatalf("start mock server: %v", err)
+	}
+	origHost, origName, origPass := host, mainSession.name, pass
+	t.Cleanup(func() {
+		srv.Close()
+		host, mainSession.name, pass = origHost, origName, origPass
+	})
+	host = srv.Addr()
+	if gameCtx == nil {
+		gameCtx = context.Background()
+	}
+	mainSession.console = messageLog{max: maxMessages}
+	if loginWin == nil {
+		loginWin = eui.NewWindow()
+	}
+	return srv
+}
+
+// startMockLogin runs login in the background the way startLogin does.
+func startMockLogin(t *testing.T) <-chan error {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	loginMu.Lock()
+	loginCancel = cancel
+	loginMu.Unlock()
+	t.Cleanup(handleDisconnect)
+	errCh := make(chan error, 1)
+	go func() { errCh <- login(ctx, clVersion) }()
+	return errCh
+}
+
+func waitForConsole(t *testing.T, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if slices.ContainsFunc(mainSession.console.Entries("", false), func(s string) bool {
+			return strings.Contains(s, want)
+		}) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("console never showed %q: %q", want, mainSession.console.Entries("", false))
+}
+
+func TestLoginMockServerSession(t *testing.T) {
+	srv := startMockServer(t, mockserver.Config{
+		Password:      "secret",
+		FrameInterval: 10 * time.Millisecond,
+		Frames: [][]byte{
+			mockserver.Frame{AckFrame: 1, Info: "Welcome to the mock server."}.Encode(),
+		},
+	})
+	mainSession.name, pass = "Tester", "secret"
+	errCh := startMockLogin(t)
+
+	select {
+	case l := <-srv.Logins():
+		if l.Name != "Tester" || l.Result != mockserver.ResultOK {
+			t.Fatalf("login = %v", l)
+		}
+	case err := <-errCh:
+		t.Fatalf("login returned early: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server never saw a login")
+	}
+	waitForConsole(t, "Welcome to the mock server.")
+
+	enqueueCommand("/mockping")
+	timeout := time.After(5 * time.Second)
+	for got := false; !got; {
+		select {
+		case in := <-srv.Inputs():
+			got = in.Command == "/mockping"
+		case <-timeout:
+			t.Fatalf("command never reached the server")
+		}
+	}
+
+	srv.Disconnect()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("login: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("login did not return after the server dropped the connection")
+	}
+	waitForConsole(t, "Disconnected from server.")
+	loginMu.Lock()
+	defer loginMu.Unlock()
+	if loginCancel != nil {
+		t.Fatalf("handleDisconnect left the session active")
+	}
+}
+
+func TestLoginMockServerBadPassword(t *testing.T) {
+	srv := startMockServer(t, mockserver.Config{Password: "secret"})
+	mainSession.name, pass = "Tester", "wrong"
+	errCh := startMockLogin(t)
+
+	select {
+	case err := <-errCh:
+		if err == nil || !strings.Contains(err.Error(), "kBadCharPass") {
+			t.Fatalf("login error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("login did not fail")
+	}
+	if srv.Sessions() != 0 {
+		t.Fatalf("rejected login left a session")
+	}
+}
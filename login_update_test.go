@@ -114,7 +114,7 @@ func TestLoginTriggersAutoUpdate(t *testing.T) {
 	fs := newFakeServer(t)
 	defer fs.close()
 	host = fs.addr()
-	name = "test"
+	mainSession.name = "test"
 	pass = "pw"
 	dir := t.TempDir()
 	cwd, err := os.Getwd()
@@ -0,0 +1,1460 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// This file implements the macro language of the original Clan Lord client
+// (Macros_cl.cp) so existing "Macros" folders keep working. A folder holds one
+// file per character plus a shared "Default" file; each file defines
+// expression macros ("yy"), replacement macros ('brb'), key macros (f1,
+// control-k) and function macros (for "call"). Macros are interpreted one
+// command at a time from the game's update loop and send their text through
+// enqueueCommand.
+
+const (
+	classicMacroDir         = "Macros"
+	classicMacroDefaultFile = "Default"
+	// classicMacroMaxParams mirrors kCLMacros_MaxCmdParam.
+	classicMacroMaxParams = 10
+	// classicMacroStepLimit bounds the commands run per tick so that a
+	// runaway "goto" loop cannot stall the client.
+	classicMacroStepLimit = 1000
+	// classicMaxCallDepth bounds nested "call"s so that a function that
+	// calls itself stops instead of growing the stack without end. The
+	// original client had no limit short of running out of memory.
+	classicMaxCallDepth = 32
+)
+
+// errClassicStop marks execution errors that end the whole macro rather
+// than just the function that hit them.
+var errClassicStop = errors.New("macro stopped")
+
+type classicMacroKind int
+
+const (
+	classicExpression classicMacroKind = iota
+	classicReplacement
+	classicKey
+	classicFunction
+)
+
+func (k classicMacroKind) String() string {
+	switch k {
+	case classicExpression:
+		return "expression"
+	case classicReplacement:
+		return "replacement"
+	case classicKey:
+		return "key"
+	default:
+		return "function"
+	}
+}
+
+type classicCmdKind int
+
+const (
+	classicCmdText classicCmdKind = iota
+	classicCmdPause
+	classicCmdMove
+	classicCmdSet
+	classicCmdSetGlobal
+	classicCmdCall
+	classicCmdEnd
+	classicCmdIf
+	classicCmdElseIf
+	classicCmdElse
+	classicCmdEndIf
+	classicCmdRandom
+	classicCmdOr
+	classicCmdEndRandom
+	classicCmdLabel
+	classicCmdGoto
+	classicCmdMessage
+)
+
+var classicCmdWords = map[string]classicCmdKind{
+	"pause":     classicCmdPause,
+	"move":      classicCmdMove,
+	"set":       classicCmdSet,
+	"setglobal": classicCmdSetGlobal,
+	"call":      classicCmdCall,
+	"end":       classicCmdEnd,
+	"if":        classicCmdIf,
+	"else":      classicCmdElse,
+	"random":    classicCmdRandom,
+	"or":        classicCmdOr,
+	"label":     classicCmdLabel,
+	"goto":      classicCmdGoto,
+	"message":   classicCmdMessage,
+}
+
+// classicObsoleteVars maps variable names from older clients to the names
+// they were replaced with.
+var classicObsoleteVars = map[string]string{
+	"@name":           "@my.name",
+	"@splayer":        "@selplayer.simple_name",
+	"@rplayer":        "@selplayer.name",
+	"@rhanditem":      "@my.right_item",
+	"@lhanditem":      "@my.left_item",
+	"@echo":           "@env.echo",
+	"@debug":          "@env.debug",
+	"@interruptclick": "@env.click_interrupts",
+	"@interruptkey":   "@env.key_interrupts",
+	"@clicksplayer":   "@click.simple_name",
+	"@clickrplayer":   "@click.name",
+	"@wordcount":      "@text.num_words",
+}
+
+// classicItemSlots maps @my.<slot>_item variables to inventory slots.
+var classicItemSlots = map[string]int{
+	"left_item":      kItemSlotLeftHand,
+	"right_item":     kItemSlotRightHand,
+	"forehead_item":  kItemSlotForehead,
+	"neck_item":      kItemSlotNeck,
+	"shoulders_item": kItemSlotShoulder,
+	"arms_item":      kItemSlotArms,
+	"gloves_item":    kItemSlotGloves,
+	"finger_item":    kItemSlotFinger,
+	"coat_item":      kItemSlotCoat,
+	"cloak_item":     kItemSlotCloak,
+	"torso_item":     kItemSlotTorso,
+	"waist_item":     kItemSlotWaist,
+	"legs_item":      kItemSlotLegs,
+	"feet_item":      kItemSlotFeet,
+	"hands_item":     kItemSlotBothHands,
+	"head_item":      kItemSlotHead,
+}
+
+// classicKeyNames maps the original client's key names to Ebiten key names.
+var classicKeyNames = map[string]string{
+	"escape":   "Escape",
+	"clear":    "Escape",
+	"minus":    "Minus",
+	"delete":   "Backspace",
+	"tab":      "Tab",
+	"return":   "Enter",
+	"enter":    "NumpadEnter",
+	"space":    "Space",
+	"help":     "Insert",
+	"home":     "Home",
+	"pageup":   "PageUp",
+	"del":      "Delete",
+	"end":      "End",
+	"pagedown": "PageDown",
+	"up":       "ArrowUp",
+	"down":     "ArrowDown",
+	"left":     "ArrowLeft",
+	"right":    "ArrowRight",
+}
+
+// classicMouseNames maps click and wheel names to hotkey combo names.
+var classicMouseNames = map[string]string{
+	"click":       "LeftClick",
+	"click2":      "RightClick",
+	"right-click": "RightClick",
+	"click3":      "MiddleClick",
+	"wheelup":     "WheelUp",
+	"wheeldown":   "WheelDown",
+	"wheelleft":   "WheelLeft",
+	"wheelright":  "WheelRight",
+}
+
+var classicPunctKeys = map[rune]string{
+	'-': "Minus", '=': "Equal", ',': "Comma", '.': "Period", '/': "Slash",
+	';': "Semicolon", '\'': "Quote", '[': "BracketLeft", ']': "BracketRight",
+	'\\': "Backslash", '`': "Backquote",
+}
+
+var classicNumpadKeys = map[rune]string{
+	'+': "NumpadAdd", '-': "NumpadSubtract", '*': "NumpadMultiply",
+	'/': "NumpadDivide", '.': "NumpadDecimal", '=': "NumpadEqual",
+}
+
+type classicCommand struct {
+	kind   classicCmdKind
+	params []string
+	line   int
+	// lastChosen remembers the branch picked by "random no-repeat".
+	lastChosen int
+}
+
+type classicMacro struct {
+	kind    classicMacroKind
+	trigger string // expression, replacement, function name or hotkey combo
+	source  string // trigger as written in the file
+	summary string // rest of the defining line, for the Macros window
+	file    string
+	line    int
+
+	ignoreCase bool
+	anyClick   bool
+	noOverride bool
+
+	cmds []*classicCommand
+}
+
+// classicMacroSet holds everything loaded from one Macros folder.
+type classicMacroSet struct {
+	dir      string
+	file     string
+	macros   []*classicMacro
+	globals  map[string]string
+	included map[string]bool
+	errors   []string
+}
+
+var (
+	classicMacroMu sync.Mutex
+	classicMacros  *classicMacroSet
+	classicRunning []*classicExec
+)
+
+// classicMacroFileName returns the per-character file name, avoiding ':'
+// which the original client also replaced.
+func classicMacroFileName(player string) string {
+	return strings.ReplaceAll(player, ":", "-")
+}
+
+// loadClassicMacroSet parses the macro file for player inside dir, falling
+// back to the shared "Default" file when the character has none.
+func loadClassicMacroSet(dir, player string) (*classicMacroSet, error) {
+	s := &classicMacroSet{dir: dir, globals: map[string]string{}, included: map[string]bool{}}
+	name := classicMacroDefaultFile
+	if player != "" {
+		if _, err := os.Stat(filepath.Join(dir, classicMacroFileName(player))); err == nil {
+			name = classicMacroFileName(player)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+		return nil, err
+	}
+	s.file = name
+	s.parseFile(name)
+	return s, nil
+}
+
+func (s *classicMacroSet) errorf(file string, line int, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if file != "" {
+		msg = fmt.Sprintf("%s:%d: %s", file, line, msg)
+	}
+	s.errors = append(s.errors, msg)
+}
+
+func (s *classicMacroSet) parseFile(name string) {
+	key := strings.ToLower(name)
+	if s.included[key] {
+		return
+	}
+	s.included[key] = true
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		s.errorf(name, 0, "%v", err)
+		return
+	}
+	s.parse(name, data)
+}
+
+// parse reads macro definitions from data. Files written by the Mac client
+// are MacRoman encoded; anything that is valid UTF-8 is taken as is.
+func (s *classicMacroSet) parse(name string, data []byte) {
+	text := string(data)
+	if !utf8.Valid(data) {
+		text = decodeMacRoman(data)
+	}
+	text = stripClassicBlockComments(text)
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	p := &classicParser{set: s, file: name}
+	for i, line := range strings.Split(text, "\n") {
+		p.line = i + 1
+		words, err := classicWords(line)
+		if err != nil {
+			s.errorf(name, p.line, "%v", err)
+		}
+		p.parseLine(line, words)
+	}
+	if p.level > 0 {
+		s.errorf(name, p.line, "file is missing end brackets '}'")
+	}
+}
+
+// stripClassicBlockComments removes /* */ comments without regard to quotes,
+// as the original parser did.
+func stripClassicBlockComments(text string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(text, "/*")
+		if i < 0 {
+			b.WriteString(text)
+			return b.String()
+		}
+		b.WriteString(text[:i])
+		j := strings.Index(text[i+2:], "*/")
+		if j < 0 {
+			return b.String()
+		}
+		rest := text[i+2+j+2:]
+		// Keep line numbers intact.
+		b.WriteString(strings.Repeat("\n", strings.Count(text[i:i+2+j+2], "\n")))
+		text = rest
+	}
+}
+
+// classicWords splits a line into words the way CMacroParser::GetWord does:
+// words are separated by blanks, quoted words keep their quotes, backslash
+// escapes are expanded and an unquoted "//" ends the line.
+func classicWords(line string) ([]string, error) {
+	var words []string
+	i := 0
+	for {
+		for i < len(line) && strings.IndexByte(" \t", line[i]) >= 0 {
+			i++
+		}
+		if i >= len(line) {
+			return words, nil
+		}
+		if strings.HasPrefix(line[i:], "//") {
+			return words, nil
+		}
+		var b strings.Builder
+		var quote byte
+		if line[i] == '"' || line[i] == '\'' {
+			quote = line[i]
+			b.WriteByte(quote)
+			i++
+		}
+		done := false
+		for i < len(line) && !done {
+			c := line[i]
+			switch {
+			case quote != 0 && c == quote:
+				b.WriteByte(c)
+				i++
+				quote = 0
+				done = true
+			case c == '\\':
+				i++
+				if i >= len(line) {
+					b.WriteByte('\\')
+					break
+				}
+				switch line[i] {
+				case 'r':
+					b.WriteByte('\r')
+					i++
+				case '"', '\'', '\\':
+					b.WriteByte(line[i])
+					i++
+				default:
+					b.WriteByte('\\')
+				}
+			case quote == 0 && c == '/' && i+1 < len(line) && line[i+1] == '/':
+				done = true
+			case quote == 0 && (c == ' ' || c == '\t'):
+				done = true
+			default:
+				b.WriteByte(c)
+				i++
+			}
+		}
+		if quote != 0 {
+			return words, fmt.Errorf("matching %c not found: %s", quote, b.String())
+		}
+		words = append(words, b.String())
+		if !done {
+			return words, nil
+		}
+	}
+}
+
+type classicParser struct {
+	set   *classicMacroSet
+	file  string
+	line  int
+	level int
+	last  *classicMacro
+}
+
+// parseLine handles one line of a macro file. Braces open and close macro
+// bodies; unlike the original they may share a line with other words.
+func (p *classicParser) parseLine(raw string, words []string) {
+	for len(words) > 0 {
+		switch words[0] {
+		case "{":
+			p.level++
+			words = words[1:]
+			continue
+		case "}":
+			p.level--
+			if p.level < 0 {
+				p.set.errorf(p.file, p.line, "unexpected closing brace '}'")
+				p.level = 0
+			}
+			words = words[1:]
+			continue
+		}
+		n := 1
+		for n < len(words) && words[n] != "{" && words[n] != "}" {
+			n++
+		}
+		p.statement(raw, words[:n])
+		words = words[n:]
+	}
+}
+
+func (p *classicParser) statement(raw string, words []string) {
+	if p.level == 0 {
+		p.last = nil
+		words = p.newMacro(raw, words)
+	}
+	if p.last == nil || len(words) == 0 {
+		return
+	}
+	p.newCommand(words)
+}
+
+// newMacro classifies a top-level definition by its first word and returns
+// the words that remain for the macro's first command.
+func (p *classicParser) newMacro(raw string, words []string) []string {
+	w := words[0]
+	rest := words[1:]
+	m := &classicMacro{source: w, file: p.file, line: p.line}
+	switch {
+	case strings.HasPrefix(w, `"`):
+		m.kind = classicExpression
+		m.trigger, _ = classicUnquote(w)
+	case strings.HasPrefix(w, "'"):
+		m.kind = classicReplacement
+		m.trigger, _ = classicUnquote(w)
+	case strings.EqualFold(w, "set"), strings.EqualFold(w, "setglobal"):
+		if len(rest) < 2 {
+			return nil
+		}
+		switch strings.ToLower(rest[0]) {
+		case "@name", "@splayer", "@rplayer", "@rhanditem", "@lhanditem":
+			// read-only variables
+			return nil
+		}
+		e := &classicExec{set: p.set, vars: map[string]string{}}
+		e.setVariable(rest[0], e.expr(rest[1]), true)
+		return nil
+	case strings.EqualFold(w, "include"):
+		if len(rest) == 0 {
+			return nil
+		}
+		name, ok := classicUnquote(rest[0])
+		if !ok {
+			name = rest[0]
+		}
+		p.set.parseFile(name)
+		return nil
+	default:
+		if combo, ok := classicKeyCombo(w); ok {
+			m.kind = classicKey
+			m.trigger = combo
+		} else {
+			m.kind = classicFunction
+			m.trigger = w
+		}
+	}
+	if p.set.find(m.kind, m.trigger) != nil {
+		// The first definition wins, as in the original client.
+		return nil
+	}
+	if i := strings.Index(raw, w); i >= 0 {
+		m.summary = strings.TrimSpace(raw[i+len(w):])
+	}
+	p.set.macros = append(p.set.macros, m)
+	p.last = m
+	return rest
+}
+
+func (p *classicParser) newCommand(words []string) {
+	m := p.last
+	for len(words) > 0 {
+		switch strings.ToLower(words[0]) {
+		case "$ignore_case", "ignore_case":
+			m.ignoreCase = true
+		case "$any_click":
+			m.anyClick = true
+		case "$no_override":
+			m.noOverride = true
+		default:
+			goto command
+		}
+		words = words[1:]
+	}
+	return
+
+command:
+	add := func(kind classicCmdKind, params []string) {
+		m.cmds = append(m.cmds, &classicCommand{kind: kind, params: params, line: p.line, lastChosen: -1})
+	}
+	kind, ok := classicCmdWords[strings.ToLower(words[0])]
+	if !ok {
+		add(classicCmdText, words)
+		return
+	}
+	params := words[1:]
+	next := ""
+	if len(params) > 0 {
+		next = strings.ToLower(params[0])
+	}
+	switch kind {
+	case classicCmdEnd:
+		switch next {
+		case "if":
+			add(classicCmdEndIf, params[1:])
+		case "random":
+			add(classicCmdEndRandom, params[1:])
+		default:
+			add(classicCmdEnd, params)
+		}
+	case classicCmdElse:
+		if next == "if" {
+			// "else if" is an else followed by an if that does not open a
+			// new level, exactly as the original parser stored it.
+			add(classicCmdElse, nil)
+			add(classicCmdElseIf, params[1:])
+		} else {
+			add(classicCmdElse, params)
+		}
+	default:
+		add(kind, params)
+	}
+}
+
+// find returns the macro of kind matching trigger. Expression and
+// replacement macros honour $ignore_case.
+func (s *classicMacroSet) find(kind classicMacroKind, trigger string) *classicMacro {
+	if s == nil {
+		return nil
+	}
+	for _, m := range s.macros {
+		if m.kind != kind {
+			continue
+		}
+		if m.trigger == trigger || (m.ignoreCase && strings.EqualFold(m.trigger, trigger)) {
+			return m
+		}
+	}
+	return nil
+}
+
+// classicKeyCombo converts a key macro name such as "control-shift-f1" or
+// "numpad-5" into the combo format used by hotkeys.go.
+func classicKeyCombo(name string) (string, bool) {
+	lower := strings.ToLower(name)
+	var ctrl, alt, shift, numpad bool
+	key := lower
+	if strings.HasSuffix(lower, "right-click") {
+		key = "right-click"
+		lower = strings.TrimSuffix(lower, "right-click")
+	} else if i := strings.LastIndex(lower, "-"); i >= 0 && i < len(lower)-1 {
+		key = lower[i+1:]
+		lower = lower[:i+1]
+	} else if strings.HasSuffix(lower, "--") {
+		key = "-"
+		lower = lower[:len(lower)-1]
+	} else {
+		lower = ""
+	}
+	for _, mod := range strings.Split(strings.TrimSuffix(lower, "-"), "-") {
+		switch mod {
+		case "control", "command":
+			ctrl = true
+		case "option":
+			alt = true
+		case "shift":
+			shift = true
+		case "numpad":
+			numpad = true
+		}
+	}
+
+	var keyName string
+	if n, ok := classicMouseNames[key]; ok {
+		keyName = n
+	} else {
+		if r, size := utf8.DecodeRuneInString(key); size == len(key) {
+			switch {
+			case numpad && unicode.IsDigit(r):
+				keyName = "Numpad" + string(r)
+			case numpad && classicNumpadKeys[r] != "":
+				keyName = classicNumpadKeys[r]
+			case unicode.IsDigit(r):
+				keyName = "Digit" + string(r)
+			case unicode.IsLetter(r) && r < utf8.RuneSelf:
+				keyName = strings.ToUpper(key)
+			default:
+				keyName = classicPunctKeys[r]
+			}
+		} else if n, ok := classicKeyNames[key]; ok {
+			keyName = n
+		} else if strings.HasPrefix(key, "f") {
+			if n, err := strconv.Atoi(key[1:]); err == nil && n >= 1 && n <= 16 {
+				keyName = fmt.Sprintf("F%d", n)
+			}
+		}
+		if keyName == "" {
+			return "", false
+		}
+		var k ebiten.Key
+		if err := k.UnmarshalText([]byte(keyName)); err != nil {
+			return "", false
+		}
+		keyName = k.String()
+	}
+
+	var parts []string
+	if ctrl {
+		parts = append(parts, "Ctrl")
+	}
+	if alt {
+		parts = append(parts, "Alt")
+	}
+	if shift {
+		parts = append(parts, "Shift")
+	}
+	parts = append(parts, keyName)
+	return strings.Join(parts, "-"), true
+}
+
+// classicUnquote strips matching surrounding quotes.
+func classicUnquote(w string) (string, bool) {
+	if len(w) >= 2 && (w[0] == '"' || w[0] == '\'') && w[len(w)-1] == w[0] {
+		return w[1 : len(w)-1], true
+	}
+	return w, false
+}
+
+// classicAtoi parses a leading integer like sscanf("%d").
+func classicAtoi(s string) (int, bool) {
+	s = strings.TrimLeft(s, " \t\r\n")
+	end := 0
+	if end < len(s) && (s[end] == '-' || s[end] == '+') {
+		end++
+	}
+	start := end
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	if end == start {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s[:end])
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// classicSimpleName strips everything but letters and digits from a name.
+func classicSimpleName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+type classicFrame struct {
+	cmds []*classicCommand
+	pc   int
+}
+
+// classicExec is one running macro.
+type classicExec struct {
+	set   *classicMacroSet
+	macro *classicMacro
+	stack []classicFrame
+	vars  map[string]string
+	buf   string
+	// wait holds the frame at which a pause ends.
+	wait int
+	err  error
+}
+
+func newClassicExec(set *classicMacroSet, m *classicMacro, text string) *classicExec {
+	e := &classicExec{set: set, macro: m, vars: map[string]string{}}
+	e.vars["@text"] = text
+	e.vars["@textsel"] = text
+	lastClickMu.Lock()
+	click := lastClick.Mobile.Name
+	lastClickMu.Unlock()
+	e.vars["@click.name"] = click
+	e.vars["@click.simple_name"] = classicSimpleName(click)
+	e.stack = []classicFrame{{cmds: m.cmds}}
+	return e
+}
+
+// run executes commands until the macro pauses, sends a line of text or
+// finishes. Only one line is sent per call, like the original client which
+// sent at most one command per frame. It reports whether the macro is done.
+func (e *classicExec) run(now int, send func(string)) bool {
+	if e.wait != 0 {
+		if now < e.wait {
+			return false
+		}
+		e.wait = 0
+	}
+	for n := 0; n < classicMacroStepLimit && e.wait == 0; n++ {
+		if i := strings.IndexByte(e.buf, '\r'); i >= 0 {
+			if e.macro.kind == classicReplacement {
+				e.err = fmt.Errorf("replacement macros may not send a return")
+				return true
+			}
+			line := e.buf[:i]
+			e.buf = e.buf[i+1:]
+			send(line)
+			return false
+		}
+		for len(e.stack) > 0 && e.top().pc >= len(e.top().cmds) {
+			e.stack = e.stack[:len(e.stack)-1]
+		}
+		if len(e.stack) == 0 {
+			return true
+		}
+		if err := e.execute(now); err != nil {
+			consoleMessage("macro " + e.macro.source + ": " + err.Error())
+			if errors.Is(err, errClassicStop) {
+				e.stack = nil
+				e.buf = ""
+				return true
+			}
+			e.stack = e.stack[:len(e.stack)-1]
+		}
+	}
+	return false
+}
+
+func (e *classicExec) top() *classicFrame {
+	return &e.stack[len(e.stack)-1]
+}
+
+func (e *classicExec) execute(now int) error {
+	f := e.top()
+	cmd := f.cmds[f.pc]
+	f.pc++
+	raw := cmd.params
+	if len(raw) > classicMacroMaxParams {
+		raw = raw[:classicMacroMaxParams]
+	}
+	params := make([]string, len(raw))
+	for i, p := range raw {
+		params[i] = e.expr(p)
+	}
+	if e.testBool("@env.debug") && cmd.kind != classicCmdMessage {
+		consoleMessage(strings.TrimSpace(classicCmdName(cmd.kind) + " " + strings.Join(params, " ")))
+	}
+
+	switch cmd.kind {
+	case classicCmdText:
+		e.buf += strings.Join(params, "")
+
+	case classicCmdMessage:
+		consoleMessage(strings.Join(params, " "))
+
+	case classicCmdPause:
+		if len(params) != 1 {
+			return fmt.Errorf("pause <number of frames>")
+		}
+		n, ok := classicAtoi(params[0])
+		if !ok {
+			return fmt.Errorf("pause <number of frames>: '%s' is not a number", params[0])
+		}
+		if e.macro.kind == classicReplacement {
+			return fmt.Errorf("pauses are not allowed in replacement macros")
+		}
+		if n > 0 {
+			e.wait = now + n
+		}
+
+	case classicCmdMove:
+		return fmt.Errorf("move is not supported")
+
+	case classicCmdSet, classicCmdSetGlobal:
+		if len(params) != 2 && len(params) != 3 {
+			return fmt.Errorf("set <variable> <value> OR set <variable> <operation> <value>")
+		}
+		// The variable name is used as written, not its value.
+		name := raw[0]
+		global := cmd.kind == classicCmdSetGlobal
+		if len(params) == 2 {
+			e.setVariable(name, params[1], global)
+			return nil
+		}
+		value, err := e.arith(name, params[1], params[2])
+		if err != nil {
+			return err
+		}
+		e.setVariable(name, value, global)
+
+	case classicCmdCall:
+		if len(params) != 1 {
+			return fmt.Errorf("call <function>")
+		}
+		fn := e.set.find(classicFunction, params[0])
+		if fn == nil {
+			return fmt.Errorf("'%s' not a defined function", params[0])
+		}
+		if len(e.stack) >= classicMaxCallDepth {
+			return fmt.Errorf("call %s: functions nested more than %d deep, %w", params[0], classicMaxCallDepth, errClassicStop)
+		}
+		e.stack = append(e.stack, classicFrame{cmds: fn.cmds})
+
+	case classicCmdIf, classicCmdElseIf:
+		passed, err := classicCompare(params)
+		if err != nil {
+			return err
+		}
+		if !passed {
+			idx := classicFindSameLevel(f.cmds, f.pc, classicCmdEndIf, classicCmdElse)
+			if idx < 0 {
+				return fmt.Errorf("no closing \"end if\" found")
+			}
+			f.pc = idx
+			if f.cmds[idx].kind == classicCmdElse {
+				f.pc++
+			}
+		}
+
+	case classicCmdElse:
+		idx := classicFindSameLevel(f.cmds, f.pc, classicCmdEndIf)
+		if idx < 0 {
+			return fmt.Errorf("no closing \"end if\" found")
+		}
+		f.pc = idx + 1
+
+	case classicCmdRandom:
+		noRepeat := false
+		switch len(params) {
+		case 0:
+		case 1:
+			if !strings.EqualFold(params[0], "no-repeat") {
+				return fmt.Errorf("random: '%s' is not a recognized option", params[0])
+			}
+			noRepeat = true
+		default:
+			return fmt.Errorf("random <option>")
+		}
+		var branches []int
+		pos := f.pc
+		for {
+			idx := classicFindSameLevel(f.cmds, pos, classicCmdOr, classicCmdEndRandom)
+			if idx < 0 {
+				return fmt.Errorf("no ending \"end random\" found")
+			}
+			if f.cmds[idx].kind == classicCmdEndRandom {
+				break
+			}
+			branches = append(branches, idx+1)
+			pos = idx + 1
+		}
+		last := -1
+		if noRepeat {
+			last = cmd.lastChosen
+		}
+		chosen := 0
+		if n := len(branches) + 1; n > 1 {
+			for {
+				chosen = rand.Intn(n)
+				if chosen != last {
+					break
+				}
+			}
+		}
+		if noRepeat {
+			cmd.lastChosen = chosen
+		}
+		if chosen > 0 {
+			f.pc = branches[chosen-1]
+		}
+
+	case classicCmdOr:
+		idx := classicFindSameLevel(f.cmds, f.pc, classicCmdEndRandom)
+		if idx < 0 {
+			return fmt.Errorf("no closing \"end random\" found")
+		}
+		f.pc = idx + 1
+
+	case classicCmdGoto:
+		if len(params) != 1 {
+			return fmt.Errorf("goto <label>")
+		}
+		found := false
+		for i, c := range f.cmds {
+			if c.kind == classicCmdLabel && len(c.params) > 0 && c.params[0] == params[0] {
+				f.pc = i + 1
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("label %s not found in the current macro", params[0])
+		}
+
+	case classicCmdLabel, classicCmdEndIf, classicCmdEndRandom, classicCmdEnd:
+	}
+	return nil
+}
+
+func classicCmdName(k classicCmdKind) string {
+	switch k {
+	case classicCmdElseIf:
+		return "else if"
+	case classicCmdEndIf:
+		return "end if"
+	case classicCmdEndRandom:
+		return "end random"
+	case classicCmdText:
+		return ""
+	}
+	for w, kind := range classicCmdWords {
+		if kind == k {
+			return w
+		}
+	}
+	return ""
+}
+
+// classicFindSameLevel returns the index of the first command at or after
+// start whose kind is in kinds and which is not nested inside another if or
+// random block, or -1.
+func classicFindSameLevel(cmds []*classicCommand, start int, kinds ...classicCmdKind) int {
+	level := 0
+	for i := start; i < len(cmds); i++ {
+		k := cmds[i].kind
+		if level == 0 {
+			for _, want := range kinds {
+				if k == want {
+					return i
+				}
+			}
+		}
+		switch k {
+		case classicCmdIf, classicCmdRandom:
+			level++
+		case classicCmdEndIf, classicCmdEndRandom:
+			level--
+		}
+	}
+	return -1
+}
+
+// classicCompare evaluates "<value> <comparison> <value>". When either side
+// is not a number the original's substring semantics apply: a < b means b is
+// contained in a, and == compares case-insensitively.
+func classicCompare(params []string) (bool, error) {
+	if len(params) != 3 {
+		return false, fmt.Errorf("if <value> <comparison> <value>")
+	}
+	a, op, b := params[0], params[1], params[2]
+	n1, ok1 := classicAtoi(a)
+	n2, ok2 := classicAtoi(b)
+	text := !ok1 || !ok2
+	switch op {
+	case ">":
+		if text {
+			return strings.Contains(b, a) && !strings.EqualFold(a, b), nil
+		}
+		return n1 > n2, nil
+	case "<":
+		if text {
+			return strings.Contains(a, b) && !strings.EqualFold(a, b), nil
+		}
+		return n1 < n2, nil
+	case ">=":
+		if text {
+			return strings.Contains(a, b), nil
+		}
+		return n1 >= n2, nil
+	case "<=":
+		if text {
+			return strings.Contains(b, a), nil
+		}
+		return n1 <= n2, nil
+	case "==":
+		if text {
+			return strings.EqualFold(a, b), nil
+		}
+		return n1 == n2, nil
+	case "!=":
+		if text {
+			return !strings.EqualFold(a, b), nil
+		}
+		return n1 != n2, nil
+	}
+	return false, fmt.Errorf("'%s' is not a recognized comparison", op)
+}
+
+// arith implements "set var <op> value". Addition concatenates when the
+// variable holds text.
+func (e *classicExec) arith(name, op, rhs string) (string, error) {
+	lhs, ok := e.lookup(name)
+	if !ok {
+		return "", fmt.Errorf("the variable %s is not defined", name)
+	}
+	n1, num1 := classicAtoi(lhs)
+	n2, num2 := classicAtoi(rhs)
+	switch op {
+	case "+":
+		switch {
+		case !num1 && !num2:
+			return lhs + rhs, nil
+		case !num1:
+			return lhs + strconv.Itoa(n2), nil
+		case !num2:
+			return "", fmt.Errorf("<number> + <string> not allowed")
+		}
+		return strconv.Itoa(n1 + n2), nil
+	case "-", "*", "/", "%":
+	default:
+		return "", fmt.Errorf("'%s' is not a recognized operation", op)
+	}
+	if !num1 {
+		return "", fmt.Errorf("%s is not a number", lhs)
+	}
+	if !num2 {
+		return "", fmt.Errorf("%s is not a number", rhs)
+	}
+	switch op {
+	case "-":
+		n1 -= n2
+	case "*":
+		n1 *= n2
+	case "/", "%":
+		if n2 == 0 {
+			return "", fmt.Errorf("division by zero")
+		}
+		if op == "/" {
+			n1 /= n2
+		} else {
+			n1 %= n2
+		}
+	}
+	return strconv.Itoa(n1), nil
+}
+
+func (e *classicExec) testBool(name string) bool {
+	v, ok := e.lookup(name)
+	return ok && strings.EqualFold(v, "true")
+}
+
+// expr evaluates a parameter: quoted text is literal, otherwise a variable's
+// value is used when one exists, and anything else is taken literally.
+func (e *classicExec) expr(w string) string {
+	if s, ok := classicUnquote(w); ok {
+		return s
+	}
+	if v, ok := e.lookup(w); ok {
+		return v
+	}
+	return w
+}
+
+func (e *classicExec) setVariable(name, value string, global bool) {
+	if n, ok := classicObsoleteVars[strings.ToLower(name)]; ok {
+		name = n
+	}
+	name = e.resolveIndexes(name)
+	if global && e.set != nil {
+		e.set.globals[name] = value
+		return
+	}
+	e.vars[name] = value
+}
+
+// resolveIndexes rewrites array subscripts to their numeric value so that
+// "a[@i]" and "a[2]" name the same variable when @i is 2.
+func (e *classicExec) resolveIndexes(name string) string {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(name, '[')
+		if i < 0 {
+			b.WriteString(name)
+			return b.String()
+		}
+		j := strings.IndexByte(name[i:], ']')
+		if j < 0 {
+			b.WriteString(name)
+			return b.String()
+		}
+		j += i
+		idx := e.expr(name[i+1 : j])
+		if n, ok := classicAtoi(idx); ok {
+			idx = strconv.Itoa(n)
+		}
+		b.WriteString(name[:i+1])
+		b.WriteString(idx)
+		b.WriteByte(']')
+		name = name[j+1:]
+	}
+}
+
+// splitClassicVar splits name at the first period outside brackets.
+func splitClassicVar(name string) (string, string) {
+	depth := 0
+	for i, r := range name {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '.':
+			if depth == 0 {
+				return name[:i], name[i+1:]
+			}
+		}
+	}
+	return name, ""
+}
+
+// lookup returns the value of a variable including built-ins such as
+// @my.name and accessors like .word[n] and .num_letters.
+func (e *classicExec) lookup(name string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+	if n, ok := classicObsoleteVars[strings.ToLower(name)]; ok {
+		name = n
+	}
+	if len(name) > 6 && strings.EqualFold(name[:6], "@word[") {
+		name = "@text." + name[1:]
+	}
+
+	base, rest := splitClassicVar(name)
+	var (
+		value string
+		ok    bool
+	)
+	switch strings.ToLower(base) {
+	case "@my", "@selplayer", "@env", "@click":
+		field, more := splitClassicVar(rest)
+		rest = more
+		value, ok = classicBuiltinVar(strings.ToLower(base), strings.ToLower(field))
+		base = base + "." + field
+	case "@random":
+		value, ok = strconv.Itoa(rand.Intn(10000)), true
+	}
+	if !ok {
+		key := e.resolveIndexes(base)
+		value, ok = e.vars[key]
+		if !ok && e.set != nil {
+			value, ok = e.set.globals[key]
+		}
+	}
+	if !ok {
+		return "", false
+	}
+	for rest != "" {
+		var acc string
+		acc, rest = splitClassicVar(rest)
+		value = e.accessor(value, acc)
+	}
+	return value, true
+}
+
+// accessor applies one of .word[n], .letter[n], .num_words or .num_letters.
+func (e *classicExec) accessor(value, acc string) string {
+	lower := strings.ToLower(acc)
+	index := func() (int, bool) {
+		i := strings.IndexByte(acc, '[')
+		j := strings.LastIndexByte(acc, ']')
+		if i < 0 || j < i {
+			return 0, false
+		}
+		return classicAtoi(e.expr(acc[i+1 : j]))
+	}
+	switch {
+	case strings.HasPrefix(lower, "word["):
+		n, ok := index()
+		if !ok {
+			return value
+		}
+		words := strings.Fields(value)
+		if n < 0 || n >= len(words) {
+			return ""
+		}
+		return words[n]
+	case strings.HasPrefix(lower, "letter["):
+		n, ok := index()
+		if !ok {
+			return value
+		}
+		r := []rune(value)
+		if n < 0 || n >= len(r) {
+			return ""
+		}
+		return string(r[n])
+	case lower == "num_words":
+		return strconv.Itoa(len(strings.Fields(value)))
+	case lower == "num_letters":
+		return strconv.Itoa(utf8.RuneCountInString(value))
+	}
+	return value
+}
+
+// classicBuiltinVar answers the read-only @my, @selplayer and @env
+// variables. @click and most of @env are ordinary variables that are set
+// when a macro starts or by the user.
+func classicBuiltinVar(base, field string) (string, bool) {
+	switch base {
+	case "@my":
+		switch field {
+		case "name":
+			return focusedSession().playerName, true
+		case "simple_name":
+			return classicSimpleName(focusedSession().playerName), true
+		case "selected_item":
+			for _, it := range focusedSession().getInventory() {
+				if it.ID == selectedInvID && it.IDIndex == selectedInvIdx {
+					return it.Name, true
+				}
+			}
+			return "", true
+		case "shares_in", "shares_out":
+			var names []string
+			for _, p := range focusedSession().getPlayers() {
+				if (field == "shares_in" && p.Sharing) || (field == "shares_out" && p.Sharee) {
+					names = append(names, p.Name)
+				}
+			}
+			return strings.Join(names, " "), true
+		}
+		if slot, ok := classicItemSlots[field]; ok {
+			return classicEquippedItem(slot), true
+		}
+	case "@selplayer":
+		switch field {
+		case "name":
+			return selectedPlayerName, true
+		case "simple_name":
+			return classicSimpleName(selectedPlayerName), true
+		}
+	}
+	return "", false
+}
+
+// classicEquippedItem returns the name of the item worn in slot. Two-handed
+// items count for both hands.
+func classicEquippedItem(slot int) string {
+	if clImages == nil {
+		return ""
+	}
+	both := ""
+	for _, it := range focusedSession().getInventory() {
+		if !it.Equipped {
+			continue
+		}
+		s := clImages.ItemSlot(uint32(it.ID))
+		if s == slot {
+			return it.Name
+		}
+		if s == kItemSlotBothHands {
+			both = it.Name
+		}
+	}
+	if slot == kItemSlotLeftHand || slot == kItemSlotRightHand {
+		return both
+	}
+	return ""
+}
+
+// loadClassicMacros (re)loads the Macros folder for the current character
+// and runs its "@login" function. Nothing happens when the folder does not
+// exist.
+func loadClassicMacros() {
+	dir := filepath.Join(dataDirPath, classicMacroDir)
+	set, err := loadClassicMacroSet(dir, focusedSession().playerName)
+	classicMacroMu.Lock()
+	classicMacros = set
+	classicRunning = nil
+	classicMacroMu.Unlock()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logError("load macros: %v", err)
+		}
+		refreshMacrosList()
+		return
+	}
+	for _, msg := range set.errors {
+		consoleMessage("macros: " + msg)
+	}
+	consoleMessage(fmt.Sprintf("macros: loaded %d from %s", len(set.macros), set.file))
+	refreshMacrosList()
+	if m := set.find(classicFunction, "@login"); m != nil {
+		startClassicMacro(m, "")
+	}
+}
+
+// stopClassicMacros halts every running macro.
+func stopClassicMacros() {
+	classicMacroMu.Lock()
+	classicRunning = nil
+	classicMacroMu.Unlock()
+}
+
+func startClassicMacro(m *classicMacro, text string) {
+	classicMacroMu.Lock()
+	e := newClassicExec(classicMacros, m, text)
+	classicRunning = append(classicRunning, e)
+	classicMacroMu.Unlock()
+}
+
+// updateClassicMacros advances running macros. It is called once per game
+// update; pauses are measured in server frames.
+func updateClassicMacros() {
+	classicMacroMu.Lock()
+	if len(classicRunning) == 0 {
+		classicMacroMu.Unlock()
+		return
+	}
+	now := focusedSession().frameCounter
+	var leftover []string
+	kept := classicRunning[:0]
+	for _, e := range classicRunning {
+		if !e.run(now, sendClassicMacroLine(e)) {
+			kept = append(kept, e)
+			continue
+		}
+		if e.buf != "" {
+			leftover = append(leftover, e.buf)
+		}
+	}
+	classicRunning = kept
+	classicMacroMu.Unlock()
+	for _, txt := range leftover {
+		setClassicInputText(txt)
+	}
+}
+
+func sendClassicMacroLine(e *classicExec) func(string) {
+	return func(line string) {
+		if e.testBool("@env.echo") {
+			consoleMessage("> " + line)
+		}
+		enqueueCommand(line)
+	}
+}
+
+// setClassicInputText places unsent macro text in the input bar so the user
+// can finish typing it, like the original client did.
+func setClassicInputText(txt string) {
+	inputActive = true
+	inputText = []rune(txt)
+	inputPos = len(inputText)
+	updateConsoleWindow()
+	if consoleWin != nil {
+		consoleWin.Refresh()
+	}
+}
+
+// runClassicExpressionMacro starts the expression macro named by the first
+// word of txt, returning true when one was found.
+func runClassicExpressionMacro(txt string) bool {
+	classicMacroMu.Lock()
+	set := classicMacros
+	classicMacroMu.Unlock()
+	if set == nil {
+		return false
+	}
+	trimmed := strings.TrimLeft(txt, " \t")
+	word := trimmed
+	if i := strings.IndexAny(trimmed, " \t"); i >= 0 {
+		word = trimmed[:i]
+	}
+	m := set.find(classicExpression, word)
+	if m == nil {
+		return false
+	}
+	startClassicMacro(m, strings.TrimLeft(trimmed[len(word):], " \t"))
+	return true
+}
+
+// expandClassicReplacements replaces whole words in txt with the output of
+// matching replacement macros. Trailing punctuation is kept, mirroring the
+// original client which expanded a word when punctuation was typed after it.
+func expandClassicReplacements(txt string) string {
+	classicMacroMu.Lock()
+	set := classicMacros
+	classicMacroMu.Unlock()
+	if set == nil {
+		return txt
+	}
+	has := false
+	for _, m := range set.macros {
+		if m.kind == classicReplacement {
+			has = true
+			break
+		}
+	}
+	if !has {
+		return txt
+	}
+	words := strings.Split(txt, " ")
+	for i, w := range words {
+		core := strings.TrimRightFunc(w, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if core == "" {
+			continue
+		}
+		m := set.find(classicReplacement, core)
+		if m == nil {
+			continue
+		}
+		e := newClassicExec(set, m, txt)
+		if !e.run(focusedSession().frameCounter, func(string) {}) || e.err != nil {
+			msg := "replacement macros may not pause"
+			if e.err != nil {
+				msg = e.err.Error()
+			}
+			consoleMessage("macro " + m.source + ": " + msg)
+			continue
+		}
+		words[i] = e.buf + w[len(core):]
+	}
+	return strings.Join(words, " ")
+}
+
+// runClassicKeyMacro runs the key macro bound to combo. It returns true when
+// normal hotkey handling should be skipped.
+func runClassicKeyMacro(combo string) bool {
+	classicMacroMu.Lock()
+	set := classicMacros
+	classicMacroMu.Unlock()
+	m := set.find(classicKey, combo)
+	if m == nil {
+		return false
+	}
+	startClassicMacro(m, "")
+	return !m.noOverride
+}
+
+// classicMacroEntries lists loaded macros for the Macros window.
+func classicMacroEntries() (string, []*classicMacro) {
+	classicMacroMu.Lock()
+	defer classicMacroMu.Unlock()
+	if classicMacros == nil {
+		return "", nil
+	}
+	return classicMacros.file, append([]*classicMacro(nil), classicMacros.macros...)
+}
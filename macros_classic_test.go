@@ -0,0 +1,341 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeClassicMacros(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func useClassicMacros(t *testing.T, set *classicMacroSet) {
+	t.Helper()
+	classicMacros = set
+	classicRunning = nil
+	mainSession.commandQueue = nil
+	mainSession.pendingCommand = ""
+	t.Cleanup(func() {
+		classicMacros = nil
+		classicRunning = nil
+		mainSession.commandQueue = nil
+		mainSession.pendingCommand = ""
+	})
+}
+
+// runClassicFrames advances running macros until they finish or the frame
+// budget runs out.
+func runClassicFrames(frames int) {
+	for i := 0; i < frames*10 && len(classicRunning) > 0; i++ {
+		updateClassicMacros()
+		if i%10 == 9 {
+			mainSession.frameCounter++
+		}
+	}
+}
+
+func TestClassicMacroParse(t *testing.T) {
+	dir := writeClassicMacros(t, map[string]string{
+		"Tester": "// per character\n\"yy\" \"/yell \" @text \"\\r\"\ninclude \"Default\"\n",
+		"Default": `/* shared
+   macros */
+"yy"  "/shout " @text "\r"
+'brb' "be right back"
+set greeting "hello there"
+control-shift-f1
+{
+	"/pose sit\r"
+}
+numpad-5 "/pose stand\r"
+@login
+{
+	message "welcome"
+}
+`,
+	})
+	set, err := loadClassicMacroSet(dir, "Tester")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(set.errors) != 0 {
+		t.Fatalf("unexpected errors: %v", set.errors)
+	}
+	if set.file != "Tester" {
+		t.Fatalf("loaded %q, want per-character file", set.file)
+	}
+	yy := set.find(classicExpression, "yy")
+	if yy == nil || yy.file != "Tester" {
+		t.Fatalf("expected the first yy definition to win: %+v", yy)
+	}
+	if set.find(classicReplacement, "brb") == nil {
+		t.Fatalf("replacement macro missing")
+	}
+	if m := set.find(classicKey, "Ctrl-Shift-F1"); m == nil || len(m.cmds) != 1 {
+		t.Fatalf("key macro missing: %+v", m)
+	}
+	if set.find(classicKey, "Numpad5") == nil {
+		t.Fatalf("numpad macro missing")
+	}
+	if set.find(classicFunction, "@login") == nil {
+		t.Fatalf("function macro missing")
+	}
+	if got := set.globals["greeting"]; got != "hello there" {
+		t.Fatalf("global = %q", got)
+	}
+}
+
+func TestClassicMacroDefaultFallback(t *testing.T) {
+	dir := writeClassicMacros(t, map[string]string{"Default": "\"w\" \"/who\\r\"\n"})
+	set, err := loadClassicMacroSet(dir, "Nobody")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if set.file != "Default" || set.find(classicExpression, "w") == nil {
+		t.Fatalf("Default not loaded: %+v", set)
+	}
+	if _, err := loadClassicMacroSet(t.TempDir(), "Nobody"); !os.IsNotExist(err) {
+		t.Fatalf("expected not-exist error, got %v", err)
+	}
+}
+
+func TestClassicWords(t *testing.T) {
+	words, err := classicWords(`"yy"	"/yell \"hi\" " @text "\r" // comment`)
+	if err != nil {
+		t.Fatalf("classicWords: %v", err)
+	}
+	want := []string{`"yy"`, `"/yell "hi" "`, "@text", "\"\r\""}
+	if !reflect.DeepEqual(words, want) {
+		t.Fatalf("got %q, want %q", words, want)
+	}
+	if _, err := classicWords(`"open`); err == nil {
+		t.Fatalf("expected unmatched quote error")
+	}
+}
+
+func TestClassicKeyCombo(t *testing.T) {
+	tests := map[string]string{
+		"f1":               "F1",
+		"control-shift-f1": "Ctrl-Shift-F1",
+		"option-k":         "Alt-K",
+		"command-1":        "Ctrl-Digit1",
+		"numpad-+":         "NumpadAdd",
+		"shift-click":      "Shift-LeftClick",
+		"right-click":      "RightClick",
+		"wheelup":          "WheelUp",
+		"pageup":           "PageUp",
+	}
+	for name, want := range tests {
+		got, ok := classicKeyCombo(name)
+		if !ok || got != want {
+			t.Errorf("classicKeyCombo(%q) = %q, %v; want %q", name, got, ok, want)
+		}
+	}
+	for _, name := range []string{"heal", "@login", "fire", "f17"} {
+		if got, ok := classicKeyCombo(name); ok {
+			t.Errorf("classicKeyCombo(%q) = %q, want function name", name, got)
+		}
+	}
+}
+
+func TestClassicExpressionMacroSendsText(t *testing.T) {
+	dir := writeClassicMacros(t, map[string]string{
+		"Default": "\"yy\" \"/yell \" @text \"\\r\"\n\"ss\" \"/sleep\"\n",
+	})
+	set, err := loadClassicMacroSet(dir, "")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	useClassicMacros(t, set)
+
+	if !runClassicExpressionMacro("yy hello world") {
+		t.Fatalf("expression macro not run")
+	}
+	runClassicFrames(5)
+	if want := []string{"/yell hello world"}; !reflect.DeepEqual(mainSession.commandQueue, want) {
+		t.Fatalf("queue = %q, want %q", mainSession.commandQueue, want)
+	}
+	if runClassicExpressionMacro("yyy hello") {
+		t.Fatalf("partial word should not match")
+	}
+
+	// Text without a return is left in the input bar.
+	inputText = nil
+	t.Cleanup(func() { inputText = nil; inputActive = false })
+	runClassicExpressionMacro("ss")
+	runClassicFrames(5)
+	if string(inputText) != "/sleep" || !inputActive {
+		t.Fatalf("input = %q active=%v", string(inputText), inputActive)
+	}
+}
+
+func TestClassicMacroControlFlow(t *testing.T) {
+	dir := writeClassicMacros(t, map[string]string{"Default": `
+"go"
+{
+	set count 0
+	label again
+	set count + 1
+	if count < 3
+		goto again
+	end if
+	if @text == "north"
+		"/say north\r"
+	else if @text.word[1] == "south"
+		"/say " @text.word[1] "\r"
+	else
+		call fallback
+	end if
+	pause 2
+	"/count " count "\r"
+}
+fallback
+{
+	set msg "none"
+	set msg + "!"
+	"/say " msg "\r"
+}
+`})
+	set, err := loadClassicMacroSet(dir, "")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	useClassicMacros(t, set)
+	mainSession.frameCounter = 100
+
+	runClassicExpressionMacro("go north")
+	runClassicFrames(10)
+	runClassicExpressionMacro("go far south")
+	runClassicFrames(10)
+	runClassicExpressionMacro("go east")
+	runClassicFrames(10)
+
+	want := []string{
+		"/say north", "/count 3",
+		"/say south", "/count 3",
+		"/say none!", "/count 3",
+	}
+	if !reflect.DeepEqual(mainSession.commandQueue, want) {
+		t.Fatalf("queue = %q, want %q", mainSession.commandQueue, want)
+	}
+}
+
+func TestClassicMacroCallDepthLimit(t *testing.T) {
+	dir := writeClassicMacros(t, map[string]string{"Default": `
+"go"
+{
+	call forever
+	"/after\r"
+}
+forever
+{
+	call forever
+}
+`})
+	set, err := loadClassicMacroSet(dir, "")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	useClassicMacros(t, set)
+	mainSession.console = messageLog{max: maxMessages}
+
+	runClassicExpressionMacro("go")
+	runClassicFrames(10)
+
+	if len(classicRunning) != 0 {
+		t.Fatalf("macro still running after exceeding the call depth")
+	}
+	if len(mainSession.commandQueue) != 0 {
+		t.Fatalf("macro kept going after it was stopped: %q", mainSession.commandQueue)
+	}
+	msgs := getConsoleMessages()
+	if len(msgs) == 0 || !strings.Contains(msgs[len(msgs)-1], "nested more than 32 deep") {
+		t.Fatalf("console = %q", msgs)
+	}
+}
+
+func TestClassicMacroPauseWaitsForFrames(t *testing.T) {
+	dir := writeClassicMacros(t, map[string]string{"Default": "\"p\"\n{\n\"/one\\r\"\npause 3\n\"/two\\r\"\n}\n"})
+	set, err := loadClassicMacroSet(dir, "")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	useClassicMacros(t, set)
+	mainSession.frameCounter = 0
+
+	runClassicExpressionMacro("p")
+	for i := 0; i < 5; i++ {
+		updateClassicMacros()
+	}
+	if want := []string{"/one"}; !reflect.DeepEqual(mainSession.commandQueue, want) {
+		t.Fatalf("queue before pause ended = %q", mainSession.commandQueue)
+	}
+	mainSession.frameCounter = 3
+	for i := 0; i < 5; i++ {
+		updateClassicMacros()
+	}
+	if want := []string{"/one", "/two"}; !reflect.DeepEqual(mainSession.commandQueue, want) {
+		t.Fatalf("queue = %q, want %q", mainSession.commandQueue, want)
+	}
+}
+
+func TestClassicMacroVariables(t *testing.T) {
+	mainSession.playerName = "Sir Test-a-lot"
+	selectedPlayerName = "Bob O'Hara"
+	t.Cleanup(func() { mainSession.playerName = ""; selectedPlayerName = "" })
+
+	e := newClassicExec(&classicMacroSet{globals: map[string]string{"g": "global"}}, &classicMacro{}, "one two three")
+	tests := map[string]string{
+		"@my.name":                "Sir Test-a-lot",
+		"@my.simple_name":         "SirTestalot",
+		"@name":                   "Sir Test-a-lot",
+		"@selplayer.simple_name":  "BobOHara",
+		"@text.num_words":         "3",
+		"@text.word[2]":           "three",
+		"@word[0]":                "one",
+		"@text.word[1].letter[0]": "t",
+		"@my.name.num_letters":    "14",
+		"g":                       "global",
+		`"@my.name"`:              "@my.name",
+		"undefined":               "undefined",
+	}
+	for in, want := range tests {
+		if got := e.expr(in); got != want {
+			t.Errorf("expr(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	e.setVariable("i", "1", false)
+	e.setVariable("list[i]", "second", false)
+	if got := e.expr("list[1]"); got != "second" {
+		t.Fatalf("array element = %q", got)
+	}
+}
+
+func TestClassicReplacementMacro(t *testing.T) {
+	dir := writeClassicMacros(t, map[string]string{"Default": "'brb' \"be right back\"\n'bad' \"oops\\r\"\n"})
+	set, err := loadClassicMacroSet(dir, "")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	useClassicMacros(t, set)
+
+	if got := expandClassicReplacements("brb, going afk"); got != "be right back, going afk" {
+		t.Fatalf("got %q", got)
+	}
+	if got := expandClassicReplacements("bad idea"); got != "bad idea" {
+		t.Fatalf("replacement sending a return should be rejected, got %q", got)
+	}
+	if len(mainSession.commandQueue) != 0 {
+		t.Fatalf("replacement macros must not send: %q", mainSession.commandQueue)
+	}
+}
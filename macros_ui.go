@@ -29,10 +29,38 @@ func makeMacrosWindow() {
 	flow := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL, Fixed: true}
 	macrosWin.AddItem(flow)
 
+	btnRow := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL, Fixed: true}
+	reloadBtn, reloadEvents := eui.NewButton()
+	reloadBtn.Text = "Reload"
+	reloadBtn.Size = eui.Point{X: 70, Y: 20}
+	reloadBtn.FontSize = 12
+	reloadBtn.Tooltip = "Reload the Macros folder"
+	reloadEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			loadClassicMacros()
+		}
+	}
+	btnRow.AddItem(reloadBtn)
+	stopBtn, stopEvents := eui.NewButton()
+	stopBtn.Text = "Stop"
+	stopBtn.Size = eui.Point{X: 70, Y: 20}
+	stopBtn.FontSize = 12
+	stopBtn.Tooltip = "Stop running macros"
+	stopEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			stopClassicMacros()
+		}
+	}
+	btnRow.AddItem(stopBtn)
+	btnRow.Size = eui.Point{X: macrosWin.Size.X, Y: reloadBtn.Size.Y}
+	flow.AddItem(btnRow)
+
 	macrosList = &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL, Scrollable: true, Fixed: true}
-	macrosList.Size = macrosWin.Size
+	macrosList.Size = eui.Point{X: macrosWin.Size.X, Y: macrosWin.Size.Y - btnRow.Size.Y}
 	flow.AddItem(macrosList)
-	macrosWin.OnResize = func() { macrosList.Size = macrosWin.Size }
+	macrosWin.OnResize = func() {
+		macrosList.Size = eui.Point{X: macrosWin.Size.X, Y: macrosWin.Size.Y - btnRow.Size.Y}
+	}
 	macrosWin.AddWindow(false)
 	refreshMacrosList()
 }
@@ -71,6 +99,17 @@ func refreshMacrosList() {
 			macrosList.AddItem(item)
 		}
 	}
+	if file, macros := classicMacroEntries(); file != "" {
+		macrosList.AddItem(&eui.ItemData{ItemType: eui.ITEM_TEXT, Text: "Macros folder (" + file + "):", Fixed: true})
+		for _, m := range macros {
+			body := m.summary
+			if body == "" {
+				body = fmt.Sprintf("{ %d commands }", len(m.cmds))
+			}
+			txt := fmt.Sprintf("  %s = %s", m.source, body)
+			macrosList.AddItem(&eui.ItemData{ItemType: eui.ITEM_TEXT, Text: txt, Fixed: true})
+		}
+	}
 	if macrosWin != nil {
 		macrosWin.Refresh()
 	}
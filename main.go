@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/binary"
 	"flag"
+	"fmt"
 	"image"
 	"image/png"
 	"log"
@@ -32,12 +33,13 @@ var (
 	clMovFPS int = 5
 
 	host     string = "server.deltatao.com:5010"
-	name     string
 	pass     string
 	passHash string
 
 	clmov         string
 	pcapPath      string
+	pcapPort      int
+	recordPath    string
 	fake          bool
 	blockSound    bool
 	blockBubbles  bool
@@ -56,9 +58,33 @@ var (
 
 func main() {
 	clientVersion = clVersion
+	if len(os.Args) > 1 && os.Args[1] == "movie" {
+		if err := runMovieTool(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "plugintest" {
+		if err := runPluginTestTool(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	flag.StringVar(&clmov, "clmov", "", "play back a .clMov file")
 	flag.StringVar(&pcapPath, "pcap", "", "replay network frames from a .pcap/.pcapng file")
+	flag.IntVar(&pcapPort, "pcapPort", 0, "with -pcap, the server port in the capture, for connections captured without their handshake (0 = the -host port)")
+	flag.StringVar(&recordPath, "record", "", "record live sessions to this .clMov file")
 	flag.BoolVar(&fake, "fake", false, "simulate server messages without connecting")
+	flag.BoolVar(&headless, "headless", false, "log in without a window; print chat/console as JSON on stdout and read commands from stdin")
+	flag.StringVar(&mainSession.name, "name", "", "character name for -headless")
+	flag.StringVar(&host, "host", host, "server address")
+	flag.StringVar(&exportPath, "export", "", "render the -clmov movie offscreen to a .png sequence, .gif or .apng and exit (needs a display, e.g. xvfb-run)")
+	flag.IntVar(&exportStart, "exportStart", 0, "first movie frame for -export")
+	flag.IntVar(&exportEnd, "exportEnd", 0, "movie frame -export stops before (0 = end of movie)")
+	flag.IntVar(&exportFPS, "exportFPS", 0, "output frame rate for -export (0 = the movie's rate)")
+	flag.IntVar(&exportScale, "exportScale", 1, "render scale for -export")
 	flag.BoolVar(&doDebug, "debug", false, "verbose/debug logging")
 	flag.BoolVar(&eui.CacheCheck, "cacheCheck", false, "display window and item render counts")
 	flag.BoolVar(&dumpMusic, "dumpMusic", false, "write played music as a .wav file")
@@ -68,12 +94,35 @@ func main() {
 	flag.BoolVar(&musicDebug, "musicDebug", false, "show bard music messages in chat")
 	flag.BoolVar(&experimental, "experimental", false, "enable experimental features like CL_Images/CL_Sounds patching")
 	flag.BoolVar(&showUIScale, "uiscale", false, "show UI scaling options")
-	flag.BoolVar(&hdTextures, "hd", false, "enable HD texture loading from data/hd")
+	flag.BoolVar(&hdTextures, "hd", false, "enable every HD texture pack in data/hd for this session")
 	genPGO := flag.Bool("pgo", false, "create default.pgo using test.clMov at 30 fps for 30s")
 	flag.Parse()
 
-	if err := clipboard.Init(); err != nil {
-		log.Printf("clipboard init: %v", err)
+	if pcapPort == 0 {
+		pcapPort = pcapServerPort()
+	}
+	if exportPath != "" && clmov == "" {
+		log.Fatal("-export needs a movie: pass it with -clmov")
+	}
+	// Headless and export runs never open a window or play audio.
+	batch := headless || exportPath != ""
+	if batch {
+		blockSound = true
+		blockMusic = true
+		blockTTS = true
+	}
+	if headless {
+		logOutput = os.Stderr
+		blockBubbles = true
+		// The password is taken from the environment so it does not show
+		// up in the process list; stdin carries commands.
+		pass = os.Getenv(headlessPassEnv)
+		os.Unsetenv(headlessPassEnv)
+	}
+	if !batch {
+		if err := clipboard.Init(); err != nil {
+			log.Printf("clipboard init: %v", err)
+		}
 	}
 
 	if *genPGO {
@@ -88,22 +137,27 @@ func main() {
 	if gs.WindowHeight < 384 {
 		gs.WindowHeight = initialWindowH
 	}
-	ebiten.SetWindowSize(gs.WindowWidth, gs.WindowHeight)
+	if !batch {
+		ebiten.SetWindowSize(gs.WindowWidth, gs.WindowHeight)
 
-	if img, err := png.Decode(bytes.NewReader(windowIconPNG)); err == nil {
-		ebiten.SetWindowIcon([]image.Image{img})
-	} else {
-		log.Printf("decode icon: %v", err)
+		if img, err := png.Decode(bytes.NewReader(windowIconPNG)); err == nil {
+			ebiten.SetWindowIcon([]image.Image{img})
+		} else {
+			log.Printf("decode icon: %v", err)
+		}
 	}
 
 	var err error
 
 	loadCharacters()
-	initSoundContext()
-
-	applySettings()
+	if !batch {
+		initSoundContext()
+		applySettings()
+	}
 	setupLogging(doDebug)
-	go versionCheckLoop()
+	if !batch {
+		go versionCheckLoop()
+	}
 	defer func() {
 		if r := recover(); r != nil {
 			logPanic(r)
@@ -137,7 +191,9 @@ func main() {
 		}()
 	}
 
-	initDiscordRPC(ctx)
+	if !batch {
+		initDiscordRPC(ctx)
+	}
 
 	clImages, err = climg.Load(filepath.Join(dataDirPath, CL_ImagesFile))
 	if err != nil {
@@ -148,6 +204,9 @@ func main() {
 		clImages.DenoiseSharpness = gs.DenoiseSharpness
 		clImages.DenoiseAmount = gs.DenoiseAmount
 	}
+	loadHDPacks()
+	loadAutoMap()
+	defer saveAutoMap()
 
 	clSounds, err = clsnd.Load(filepath.Join("data/CL_Sounds"))
 	if err != nil {
@@ -155,6 +214,26 @@ func main() {
 		// Do not exit; allow UI to open download window.
 	}
 
+	if headless {
+		err := runHeadless(ctx)
+		cancel()
+		if err != nil {
+			saveStats()
+			log.Fatalf("headless: %v", err)
+		}
+		return
+	}
+
+	if exportPath != "" {
+		err := runExport(clmovPath)
+		cancel()
+		if err != nil {
+			saveStats()
+			log.Fatalf("export: %v", err)
+		}
+		return
+	}
+
 	if (gs.precacheSounds || gs.precacheImages) && !gs.NoCaching {
 		go precacheAssets()
 	}
@@ -167,10 +246,10 @@ func main() {
 				log.Fatalf("parse movie: %v", err)
 			}
 
-			playerName = extractMoviePlayerName(frames)
+			mainSession.playerName = extractMoviePlayerName(frames)
 			applyEnabledPlugins()
 
-			mp := newMoviePlayer(frames, clMovFPS, cancel)
+			mp := newMoviePlayer(mainSession, frames, clMovFPS, cancel)
 			mp.makePlaybackWindow()
 
 			if (gs.precacheSounds || gs.precacheImages) && !assetsPrecached {
@@ -215,6 +294,8 @@ func main() {
 		}
 	}()
 	runGame(ctx)
+	stopSessions()
+	mainSession.stopMovieRecording()
 	cancel()
 
 	<-ctx.Done()
@@ -335,7 +416,7 @@ func playerFromDrawState(data []byte) string {
 		p += 7
 		if h == 0 && v == 0 {
 			if d, ok := descs[idx]; ok && d.Type == kDescPlayer {
-				playerIndex = idx
+				mainSession.playerIndex = idx
 				return d.Name
 			}
 		}
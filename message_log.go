@@ -45,3 +45,10 @@ func (l *messageLog) Entries(format string, useTimestamps bool) []string {
 	}
 	return out
 }
+
+// timed returns a copy of the log's entries.
+func (l *messageLog) timed() []timedMessage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]timedMessage(nil), l.entries...)
+}
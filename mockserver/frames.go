@@ -0,0 +1,176 @@
+package mockserver
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/crypto/twofish"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Descriptor is a mobile descriptor carried in a draw state.
+type Descriptor struct {
+	Index  uint8
+	Type   uint8
+	PictID uint16
+	Name   string
+	Colors []byte
+}
+
+// Picture is a picture placement carried in a draw state.
+type Picture struct {
+	ID   uint16
+	H, V int16
+}
+
+// Mobile is a mobile position carried in a draw state.
+type Mobile struct {
+	Index  uint8
+	State  uint8
+	H, V   int16
+	Colors uint8
+}
+
+// Frame describes a kMsgDrawState message.
+type Frame struct {
+	AckCmd      uint8
+	AckFrame    int32
+	ResendFrame int32
+	Descriptors []Descriptor
+
+	HP, HPMax           uint8
+	SP, SPMax           uint8
+	Balance, BalanceMax uint8
+	Lighting            uint8
+
+	// PictAgain keeps that many pictures from the previous frame ahead of
+	// Pictures.
+	PictAgain uint8
+	Pictures  []Picture
+	Mobiles   []Mobile
+
+	// Info holds CR-separated info-text lines shown in the console.
+	Info string
+	// Tail is appended after the empty bubble and sound lists, e.g. an
+	// inventory command. Nil ends the frame with no inventory change.
+	Tail []byte
+}
+
+// Encode returns the frame as a whole server message, tag included.
+func (f Frame) Encode() []byte {
+	b := make([]byte, 2, 64)
+	binary.BigEndian.PutUint16(b, MsgDrawState)
+	b = append(b, f.AckCmd)
+	b = binary.BigEndian.AppendUint32(b, uint32(f.AckFrame))
+	b = binary.BigEndian.AppendUint32(b, uint32(f.ResendFrame))
+
+	b = append(b, uint8(len(f.Descriptors)))
+	for _, d := range f.Descriptors {
+		b = append(b, d.Index, d.Type)
+		b = binary.BigEndian.AppendUint16(b, d.PictID)
+		b = append(b, encodeMacRoman(d.Name)...)
+		b = append(b, 0, uint8(len(d.Colors)))
+		b = append(b, d.Colors...)
+	}
+
+	b = append(b, f.HP, f.HPMax, f.SP, f.SPMax, f.Balance, f.BalanceMax, f.Lighting)
+
+	// Pictures are packed as 14-bit IDs followed by 11-bit H and V.
+	if f.PictAgain > 0 || len(f.Pictures) >= 255 {
+		b = append(b, 255, f.PictAgain)
+	}
+	b = append(b, uint8(len(f.Pictures)))
+	var bits bitWriter
+	for _, p := range f.Pictures {
+		bits.write(uint32(p.ID), 14)
+		bits.write(uint32(p.H), 11)
+		bits.write(uint32(p.V), 11)
+	}
+	b = append(b, bits.buf...)
+
+	b = append(b, uint8(len(f.Mobiles)))
+	for _, m := range f.Mobiles {
+		b = append(b, m.Index, m.State)
+		b = binary.BigEndian.AppendUint16(b, uint16(m.H))
+		b = binary.BigEndian.AppendUint16(b, uint16(m.V))
+		b = append(b, m.Colors)
+	}
+
+	state := append(encodeMacRoman(f.Info), 0)
+	state = append(state, 0, 0) // no bubbles, no sounds
+	state = append(state, f.Tail...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(state)))
+	return append(b, state...)
+}
+
+type bitWriter struct {
+	buf []byte
+	n   int
+}
+
+func (w *bitWriter) write(v uint32, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v&(1<<uint(i)) != 0 {
+			w.buf[len(w.buf)-1] |= 0x80 >> uint(w.n%8)
+		}
+		w.n++
+	}
+}
+
+// ChallengeAnswer computes the client's reply to a kMsgChallenge for the
+// given password: the challenge is decrypted with Twofish keyed by the
+// password's MD5, hashed, and encrypted again.
+func ChallengeAnswer(password string, challenge []byte) ([]byte, error) {
+	digest := md5.Sum([]byte(password))
+	key := make([]byte, len(digest))
+	for i := 0; i < len(key); i += 4 {
+		binary.LittleEndian.PutUint32(key[i:i+4], binary.BigEndian.Uint32(digest[i:i+4]))
+	}
+	block, err := twofish.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	bs := block.BlockSize()
+	if len(challenge)%bs != 0 {
+		return nil, fmt.Errorf("invalid challenge length")
+	}
+	plain := make([]byte, len(challenge))
+	for i := 0; i < len(challenge); i += bs {
+		block.Decrypt(plain[i:i+bs], challenge[i:i+bs])
+	}
+	h := md5.Sum(plain)
+	answer := make([]byte, len(h))
+	for i := 0; i < len(h); i += bs {
+		block.Encrypt(answer[i:i+bs], h[i:i+bs])
+	}
+	return answer, nil
+}
+
+// simpleEncrypt applies the XOR scrambling used for login payloads. It is
+// its own inverse.
+func simpleEncrypt(data []byte) {
+	key := []byte{0x3c, 0x5a, 0x69, 0x93, 0xa5, 0xc6}
+	for i := range data {
+		data[i] ^= key[i%len(key)]
+	}
+}
+
+func encodeMacRoman(s string) []byte {
+	b, err := charmap.Macintosh.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		return []byte(s)
+	}
+	return b
+}
+
+func decodeMacRoman(b []byte) string {
+	s, err := charmap.Macintosh.NewDecoder().Bytes(b)
+	if err != nil {
+		return string(b)
+	}
+	return string(s)
+}
@@ -0,0 +1,120 @@
+package mockserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+const (
+	movieSignature     = 0xdeadbeef
+	oldestMovieVersion = 193
+
+	movieMobileData   = 0x02
+	movieGameState    = 0x04
+	moviePictureTable = 0x08
+
+	// movieDescTableSize is kDescTableSize: descriptor-only records in a
+	// mobile table have it added to their index.
+	movieDescTableSize = 266
+)
+
+// ReadMovie extracts the server messages recorded in a .clMov, in order,
+// for use as Config.Frames. The login blocks that open a movie (game state,
+// mobile and picture tables) are skipped; only the frames' data blocks are
+// returned.
+func ReadMovie(path string) ([][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 24 || binary.BigEndian.Uint32(data[:4]) != movieSignature {
+		return nil, fmt.Errorf("%v: not a movie", path)
+	}
+	version := int(binary.BigEndian.Uint16(data[4:6]))
+	// Arindal movies store version numbers 100x larger.
+	if version > 50000 {
+		version /= 100
+	}
+	if version < oldestMovieVersion {
+		return nil, fmt.Errorf("%v: movie version too old: %d", path, version)
+	}
+	pos := int(binary.BigEndian.Uint16(data[6:8]))
+	if pos <= 0 || pos > len(data) {
+		pos = 24
+	}
+
+	sign := binary.BigEndian.AppendUint32(nil, movieSignature)
+	var msgs [][]byte
+	for pos+12 <= len(data) {
+		if binary.BigEndian.Uint32(data[pos:pos+4]) != movieSignature {
+			idx := bytes.Index(data[pos:], sign)
+			if idx < 0 {
+				break
+			}
+			pos += idx
+			continue
+		}
+		size := int(binary.BigEndian.Uint16(data[pos+8 : pos+10]))
+		flags := binary.BigEndian.Uint16(data[pos+10 : pos+12])
+		pos += 12
+		if flags&movieGameState != 0 {
+			if pos+24 > len(data) {
+				break
+			}
+			pos += 24 + int(binary.BigEndian.Uint32(data[pos+12:pos+16]))
+		}
+		if flags&movieMobileData != 0 {
+			pos = skipMobileTable(data, pos, version)
+		}
+		if flags&moviePictureTable != 0 && pos+2 <= len(data) {
+			pos += 2 + 6*int(binary.BigEndian.Uint16(data[pos:pos+2])) + 4
+		}
+		if pos > len(data) {
+			break
+		}
+		if size == 0 {
+			continue
+		}
+		if pos+size > len(data) {
+			break
+		}
+		msgs = append(msgs, append([]byte(nil), data[pos:pos+size]...))
+		pos += size
+	}
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("%v: no frames", path)
+	}
+	return msgs, nil
+}
+
+// skipMobileTable returns the offset just past the mobile table at pos. The
+// descriptor sizes follow the client's parseMobileTable.
+func skipMobileTable(data []byte, pos, version int) int {
+	var descSize int
+	switch {
+	case version > 141:
+		descSize = 156
+	case version > 113:
+		descSize = 150
+	case version > 105:
+		descSize = 142
+	case version > 97:
+		descSize = 130
+	default:
+		descSize = 126
+	}
+	for pos+4 <= len(data) {
+		idx := int32(binary.BigEndian.Uint32(data[pos : pos+4]))
+		pos += 4
+		if idx == -1 {
+			break
+		}
+		if idx < movieDescTableSize {
+			pos += 16
+		}
+		pos += descSize
+	}
+	return pos
+}
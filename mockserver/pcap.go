@@ -0,0 +1,185 @@
+package mockserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/google/gopacket/tcpassembly"
+)
+
+// Packet is one UDP game message for WritePCAP.
+type Packet struct {
+	Time       time.Time
+	FromServer bool
+	Msg        []byte
+}
+
+// WritePCAP writes packets to a .pcap file as UDP datagrams between
+// serverPort and a client, for tests of capture tooling.
+func WritePCAP(path string, serverPort int, packets []Packet) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := pcapgo.NewWriter(f)
+	if err := w.WriteFileHeader(65535, layers.LinkTypeEthernet); err != nil {
+		f.Close()
+		return err
+	}
+	const clientPort = 40000
+	for _, p := range packets {
+		src, dst := clientPort, serverPort
+		if p.FromServer {
+			src, dst = serverPort, clientPort
+		}
+		eth := &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 0, 0, 0, 0, 1}, DstMAC: net.HardwareAddr{0, 0, 0, 0, 0, 2}, EthernetType: layers.EthernetTypeIPv4}
+		ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+		udp := &layers.UDP{SrcPort: layers.UDPPort(src), DstPort: layers.UDPPort(dst)}
+		udp.SetNetworkLayerForChecksum(ip)
+		buf := gopacket.NewSerializeBuffer()
+		opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+		if err := gopacket.SerializeLayers(buf, opts, eth, ip, udp, gopacket.Payload(frameBytes(p.Msg))); err != nil {
+			f.Close()
+			return err
+		}
+		data := buf.Bytes()
+		ts := p.Time
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		ci := gopacket.CaptureInfo{Timestamp: ts, CaptureLength: len(data), Length: len(data)}
+		if err := w.WritePacket(ci, data); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// ReadPCAP extracts the game messages a server sent in a .pcap or .pcapng
+// capture, in capture order, for use as Config.Frames. Packets whose source
+// port is not serverPort are ignored, as are the login replies.
+func ReadPCAP(path string, serverPort int) ([][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var source *gopacket.PacketSource
+	if ng, err := pcapgo.NewNgReader(f, pcapgo.NgReaderOptions{}); err == nil {
+		source = gopacket.NewPacketSource(ng, ng.LinkType())
+	} else {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		r, err := pcapgo.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		source = gopacket.NewPacketSource(r, r.LinkType())
+	}
+
+	var msgs [][]byte
+	factory := &pcapStreamFactory{port: serverPort, out: &msgs}
+	assembler := tcpassembly.NewAssembler(tcpassembly.NewStreamPool(factory))
+	for {
+		pkt, err := source.NextPacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		netLayer := pkt.NetworkLayer()
+		if netLayer == nil {
+			continue
+		}
+		switch t := pkt.TransportLayer().(type) {
+		case *layers.UDP:
+			if int(t.SrcPort) != serverPort {
+				continue
+			}
+			if msg, ok := unframe(t.Payload); ok {
+				appendGameMessage(&msgs, msg)
+			}
+		case *layers.TCP:
+			assembler.AssembleWithTimestamp(netLayer.NetworkFlow(), t, pkt.Metadata().Timestamp)
+		}
+	}
+	assembler.FlushAll()
+	return msgs, nil
+}
+
+type pcapStreamFactory struct {
+	port int
+	out  *[][]byte
+}
+
+func (f *pcapStreamFactory) New(_, transport gopacket.Flow) tcpassembly.Stream {
+	src := transport.Src().Raw()
+	fromServer := len(src) == 2 && int(binary.BigEndian.Uint16(src)) == f.port
+	return &pcapStream{keep: fromServer, out: f.out}
+}
+
+type pcapStream struct {
+	keep    bool
+	out     *[][]byte
+	buf     bytes.Buffer
+	started bool
+	preface int
+}
+
+func (s *pcapStream) Reassembled(rs []tcpassembly.Reassembly) {
+	if !s.keep {
+		return
+	}
+	for _, r := range rs {
+		if !s.started {
+			s.started = true
+			// A connection captured from its SYN starts with the 4 byte
+			// connection ID and the 2 byte handshake confirmation, neither
+			// of which is length-prefixed.
+			if r.Start {
+				s.preface = 6
+			}
+		}
+		s.buf.Write(r.Bytes)
+	}
+	if s.preface > 0 {
+		n := min(s.preface, s.buf.Len())
+		s.buf.Next(n)
+		s.preface -= n
+	}
+	for {
+		b := s.buf.Bytes()
+		if len(b) < 2 {
+			return
+		}
+		l := int(binary.BigEndian.Uint16(b[:2]))
+		if len(b) < 2+l {
+			return
+		}
+		appendGameMessage(s.out, b[2:2+l])
+		s.buf.Next(2 + l)
+	}
+}
+
+func (s *pcapStream) ReassemblyComplete() {}
+
+// appendGameMessage copies msg into out unless it belongs to the login
+// exchange.
+func appendGameMessage(out *[][]byte, msg []byte) {
+	switch tag(msg) {
+	case MsgChallenge, MsgLogOn:
+		return
+	}
+	*out = append(*out, append([]byte(nil), msg...))
+}
@@ -0,0 +1,570 @@
+// Package mockserver implements enough of the Clan Lord game server to log a
+// client in and stream draw-state frames to it. It speaks the same TCP/UDP
+// framing as the real server so tests can exercise the login handshake,
+// reconnects and disconnect handling without a network.
+package mockserver
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Message tags used by the login and game protocol.
+const (
+	MsgDrawState   = 2
+	MsgPlayerInput = 3
+	MsgLogOn       = 13
+	MsgChallenge   = 18
+	MsgIdentifiers = 19
+)
+
+// Login result codes returned in the kMsgLogOn reply.
+const (
+	ResultOK           int16 = 0
+	ResultBadCharName  int16 = -30999
+	ResultBadCharPass  int16 = -30998
+	ResultIncompatible int16 = -30996
+)
+
+// DefaultFrameInterval matches the server's 200ms frame rate.
+const DefaultFrameInterval = 200 * time.Millisecond
+
+// handshakeTimeout bounds how long a new connection waits for the UDP
+// handshake packet.
+const handshakeTimeout = 5 * time.Second
+
+// Config describes how the server responds to clients.
+type Config struct {
+	// Password is the character password the server accepts. When empty
+	// any answer to the challenge is accepted.
+	Password string
+	// Version is the server version reported in the challenge; clients
+	// newer than this downgrade. Zero accepts any client version.
+	Version int
+	// Result, when non-zero, is returned for every login attempt instead
+	// of checking the password.
+	Result int16
+	// Frames are whole server messages (tag included) sent after login,
+	// one per FrameInterval. ReadPCAP and ReadMovie load them from a
+	// capture or a movie. Once they run out the server keeps sending
+	// empty draw states like an idle live server.
+	Frames [][]byte
+	// FrameInterval defaults to DefaultFrameInterval.
+	FrameInterval time.Duration
+	// FramesOverTCP sends frames over the reliable stream instead of UDP.
+	FramesOverTCP bool
+	// Loop replays Frames from the start instead of idling.
+	Loop bool
+}
+
+// Identifiers is the content of a client's kMsgIdentifiers message.
+type Identifiers struct {
+	ClientVersion uint32
+	ImagesVersion uint32
+	SoundsVersion uint32
+	User          string
+	Host          string
+}
+
+// Login describes one login attempt.
+type Login struct {
+	Name          string
+	ClientVersion uint32
+	ImagesVersion uint32
+	SoundsVersion uint32
+	Identifiers   Identifiers
+	Result        int16
+}
+
+// Input is a kMsgPlayerInput packet received from a client.
+type Input struct {
+	MouseX, MouseY int16
+	Flags          uint16
+	AckFrame       int32
+	ResendFrame    int32
+	CommandNum     uint32
+	Command        string
+	Reliable       bool
+}
+
+// Server is a running mock server. It listens for TCP and UDP on the same
+// port, as the real server does.
+type Server struct {
+	cfg Config
+	tcp net.Listener
+	udp *net.UDPConn
+
+	mu       sync.Mutex
+	nextID   uint32
+	pending  map[uint32]chan *net.UDPAddr
+	sessions map[*session]struct{}
+	closed   bool
+	quit     chan struct{}
+
+	logins chan Login
+	inputs chan Input
+	wg     sync.WaitGroup
+}
+
+type session struct {
+	conn net.Conn
+	addr *net.UDPAddr
+	done chan struct{}
+	wmu  sync.Mutex
+}
+
+// Start listens on a random loopback port and begins serving.
+func Start(cfg Config) (*Server, error) {
+	if cfg.FrameInterval <= 0 {
+		cfg.FrameInterval = DefaultFrameInterval
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	s := &Server{
+		cfg:      cfg,
+		tcp:      ln,
+		udp:      udp,
+		nextID:   1,
+		pending:  make(map[uint32]chan *net.UDPAddr),
+		sessions: make(map[*session]struct{}),
+		logins:   make(chan Login, 16),
+		inputs:   make(chan Input, 256),
+		quit:     make(chan struct{}),
+	}
+	s.wg.Add(2)
+	go s.acceptLoop()
+	go s.udpLoop()
+	return s, nil
+}
+
+// Addr returns the host:port clients should dial.
+func (s *Server) Addr() string { return s.tcp.Addr().String() }
+
+// Logins reports every login attempt, successful or not.
+func (s *Server) Logins() <-chan Login { return s.logins }
+
+// Inputs reports player input packets. Packets are dropped when nobody is
+// reading.
+func (s *Server) Inputs() <-chan Input { return s.inputs }
+
+// Sessions returns the number of logged-in clients.
+func (s *Server) Sessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// Send writes msg over TCP to every logged-in client.
+func (s *Server) Send(msg []byte) error {
+	var firstErr error
+	for _, sess := range s.activeSessions() {
+		if err := sess.sendTCP(msg); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Disconnect drops every logged-in client, as when the server kicks a
+// player or the connection is lost.
+func (s *Server) Disconnect() {
+	for _, sess := range s.activeSessions() {
+		sess.conn.Close()
+	}
+}
+
+// Close stops the server and drops all clients.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.quit)
+	s.mu.Unlock()
+	err := s.tcp.Close()
+	s.udp.Close()
+	s.Disconnect()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) activeSessions() []*session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*session, 0, len(s.sessions))
+	for sess := range s.sessions {
+		list = append(list, sess)
+	}
+	return list
+}
+
+func (s *Server) acceptLoop() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) udpLoop() {
+	defer s.wg.Done()
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.udp.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		p := buf[:n]
+		if n == 6 && p[0] == 0xff && p[1] == 0xff {
+			id := binary.BigEndian.Uint32(p[2:6])
+			s.mu.Lock()
+			ch := s.pending[id]
+			delete(s.pending, id)
+			s.mu.Unlock()
+			if ch != nil {
+				ch <- addr
+			}
+			continue
+		}
+		msg, ok := unframe(p)
+		if !ok {
+			continue
+		}
+		if in, ok := parseInput(msg); ok {
+			s.report(in)
+		}
+	}
+}
+
+func (s *Server) report(in Input) {
+	select {
+	case s.inputs <- in:
+	default:
+	}
+}
+
+// handle runs one client connection through the login sequence used by
+// login() in the client and then serves the session until it drops.
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-s.quit:
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	s.mu.Lock()
+	id := s.nextID
+	s.nextID++
+	ch := make(chan *net.UDPAddr, 1)
+	s.pending[id] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, id)
+		s.mu.Unlock()
+	}()
+
+	var idBuf [4]byte
+	binary.BigEndian.PutUint32(idBuf[:], id)
+	if _, err := conn.Write(idBuf[:]); err != nil {
+		return
+	}
+	var addr *net.UDPAddr
+	select {
+	case addr = <-ch:
+	case <-time.After(handshakeTimeout):
+		return
+	case <-s.quit:
+		return
+	}
+	if _, err := conn.Write([]byte{0, 0}); err != nil {
+		return
+	}
+
+	msg, err := readTCP(conn)
+	if err != nil || tag(msg) != MsgIdentifiers {
+		return
+	}
+	ids := parseIdentifiers(msg)
+
+	challenge := make([]byte, 16)
+	if _, err := rand.Read(challenge); err != nil {
+		return
+	}
+	if err := writeTCP(conn, s.challengeMsg(challenge)); err != nil {
+		return
+	}
+	msg, err = readTCP(conn)
+	if err != nil || tag(msg) != MsgLogOn || len(msg) < 16 {
+		return
+	}
+	login, answer := parseLogOn(msg)
+	login.Identifiers = ids
+	login.Result = s.check(challenge, answer)
+
+	select {
+	case s.logins <- login:
+	default:
+	}
+	if err := writeTCP(conn, logOnReply(login.Result)); err != nil || login.Result != ResultOK {
+		return
+	}
+
+	sess := &session{conn: conn, addr: addr, done: make(chan struct{})}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.sessions[sess] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, sess)
+		s.mu.Unlock()
+		close(sess.done)
+	}()
+
+	s.wg.Add(1)
+	go s.stream(sess)
+
+	for {
+		msg, err := readTCP(conn)
+		if err != nil {
+			return
+		}
+		if in, ok := parseInput(msg); ok {
+			in.Reliable = true
+			s.report(in)
+		}
+	}
+}
+
+func (s *Server) challengeMsg(challenge []byte) []byte {
+	msg := make([]byte, 32)
+	binary.BigEndian.PutUint16(msg[0:2], MsgChallenge)
+	version := uint32(s.cfg.Version)
+	if version == 0 {
+		version = 0xffffff
+	}
+	binary.BigEndian.PutUint32(msg[4:8], version<<8)
+	copy(msg[16:], challenge)
+	return msg
+}
+
+func (s *Server) check(challenge, answer []byte) int16 {
+	if s.cfg.Result != ResultOK {
+		return s.cfg.Result
+	}
+	if s.cfg.Password == "" {
+		return ResultOK
+	}
+	want, err := ChallengeAnswer(s.cfg.Password, challenge)
+	if err != nil || len(answer) < len(want) || string(answer[:len(want)]) != string(want) {
+		return ResultBadCharPass
+	}
+	return ResultOK
+}
+
+// stream sends the scripted frames to sess and then idles with empty draw
+// states until the session ends.
+func (s *Server) stream(sess *session) {
+	defer s.wg.Done()
+	t := time.NewTicker(s.cfg.FrameInterval)
+	defer t.Stop()
+	i := 0
+	var frame int32
+	for {
+		select {
+		case <-sess.done:
+			return
+		case <-t.C:
+		}
+		frame++
+		var msg []byte
+		if i < len(s.cfg.Frames) {
+			msg = s.cfg.Frames[i]
+			i++
+			if s.cfg.Loop && i == len(s.cfg.Frames) {
+				i = 0
+			}
+		} else {
+			msg = Frame{AckFrame: frame, ResendFrame: frame}.Encode()
+		}
+		var err error
+		if s.cfg.FramesOverTCP {
+			err = sess.sendTCP(msg)
+		} else {
+			_, err = s.udp.WriteToUDP(frameBytes(msg), sess.addr)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (sess *session) sendTCP(msg []byte) error {
+	sess.wmu.Lock()
+	defer sess.wmu.Unlock()
+	return writeTCP(sess.conn, msg)
+}
+
+func tag(msg []byte) uint16 {
+	if len(msg) < 2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(msg[:2])
+}
+
+// frameBytes prefixes msg with its big-endian length.
+func frameBytes(msg []byte) []byte {
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf[:2], uint16(len(msg)))
+	copy(buf[2:], msg)
+	return buf
+}
+
+// unframe strips the length prefix from a UDP packet.
+func unframe(p []byte) ([]byte, bool) {
+	if len(p) < 2 {
+		return nil, false
+	}
+	sz := int(binary.BigEndian.Uint16(p[:2]))
+	if sz > len(p)-2 {
+		return nil, false
+	}
+	return p[2 : 2+sz], true
+}
+
+func writeTCP(conn net.Conn, msg []byte) error {
+	_, err := conn.Write(frameBytes(msg))
+	return err
+}
+
+func readTCP(conn net.Conn) ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func parseIdentifiers(msg []byte) Identifiers {
+	ids := Identifiers{}
+	if len(msg) < 16 {
+		return ids
+	}
+	ids.ClientVersion = binary.BigEndian.Uint32(msg[4:8])
+	ids.ImagesVersion = binary.BigEndian.Uint32(msg[8:12])
+	ids.SoundsVersion = binary.BigEndian.Uint32(msg[12:16])
+	data := append([]byte(nil), msg[16:]...)
+	simpleEncrypt(data)
+	// 8 bytes of file info and a 6 byte ethernet address precede the
+	// NUL-terminated user, host and boot volume names.
+	if len(data) > 14 {
+		strs := splitCStrings(data[14:], 2)
+		if len(strs) > 0 {
+			ids.User = strs[0]
+		}
+		if len(strs) > 1 {
+			ids.Host = strs[1]
+		}
+	}
+	return ids
+}
+
+func parseLogOn(msg []byte) (Login, []byte) {
+	l := Login{
+		ClientVersion: binary.BigEndian.Uint32(msg[4:8]),
+		ImagesVersion: binary.BigEndian.Uint32(msg[8:12]),
+		SoundsVersion: binary.BigEndian.Uint32(msg[12:16]),
+	}
+	data := append([]byte(nil), msg[16:]...)
+	simpleEncrypt(data)
+	for i, b := range data {
+		if b == 0 {
+			l.Name = decodeMacRoman(data[:i])
+			return l, data[i+1:]
+		}
+	}
+	l.Name = decodeMacRoman(data)
+	return l, nil
+}
+
+func logOnReply(result int16) []byte {
+	msg := make([]byte, 16)
+	binary.BigEndian.PutUint16(msg[0:2], MsgLogOn)
+	binary.BigEndian.PutUint16(msg[2:4], uint16(result))
+	return msg
+}
+
+func parseInput(msg []byte) (Input, bool) {
+	if tag(msg) != MsgPlayerInput || len(msg) < 20 {
+		return Input{}, false
+	}
+	in := Input{
+		MouseX:      int16(binary.BigEndian.Uint16(msg[2:4])),
+		MouseY:      int16(binary.BigEndian.Uint16(msg[4:6])),
+		Flags:       binary.BigEndian.Uint16(msg[6:8]),
+		AckFrame:    int32(binary.BigEndian.Uint32(msg[8:12])),
+		ResendFrame: int32(binary.BigEndian.Uint32(msg[12:16])),
+		CommandNum:  binary.BigEndian.Uint32(msg[16:20]),
+	}
+	if strs := splitCStrings(msg[20:], 1); len(strs) > 0 {
+		in.Command = strs[0]
+	}
+	return in, true
+}
+
+// splitCStrings returns up to max NUL-terminated strings from data.
+func splitCStrings(data []byte, max int) []string {
+	var out []string
+	for len(data) > 0 && len(out) < max {
+		end := len(data)
+		for i, b := range data {
+			if b == 0 {
+				end = i
+				break
+			}
+		}
+		out = append(out, decodeMacRoman(data[:end]))
+		if end == len(data) {
+			break
+		}
+		data = data[end+1:]
+	}
+	return out
+}
+
+// String implements fmt.Stringer for test failure messages.
+func (l Login) String() string {
+	return fmt.Sprintf("%s (client %d, result %d)", l.Name, l.ClientVersion>>8, l.Result)
+}
@@ -0,0 +1,205 @@
+package mockserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testClient performs the client side of the login sequence.
+type testClient struct {
+	tcp net.Conn
+	udp net.Conn
+}
+
+func dialAndLogin(t *testing.T, addr, name, password string) (*testClient, int16) {
+	t.Helper()
+	tcp, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial tcp: %v", err)
+	}
+	udp, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatalf("dial udp: %v", err)
+	}
+	c := &testClient{tcp: tcp, udp: udp}
+	t.Cleanup(func() { tcp.Close(); udp.Close() })
+	tcp.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var id [4]byte
+	if _, err := io.ReadFull(tcp, id[:]); err != nil {
+		t.Fatalf("read id: %v", err)
+	}
+	udp.Write(append([]byte{0xff, 0xff}, id[:]...))
+	var confirm [2]byte
+	if _, err := io.ReadFull(tcp, confirm[:]); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+
+	ids := make([]byte, 16)
+	binary.BigEndian.PutUint16(ids, MsgIdentifiers)
+	binary.BigEndian.PutUint32(ids[4:], 1440<<8)
+	payload := append(make([]byte, 14), "user\x00host\x00/\x00\x00"...)
+	simpleEncrypt(payload)
+	writeTCP(tcp, append(ids, payload...))
+
+	msg, err := readTCP(tcp)
+	if err != nil || tag(msg) != MsgChallenge {
+		t.Fatalf("challenge: %v %v", msg, err)
+	}
+	answer, err := ChallengeAnswer(password, msg[16:32])
+	if err != nil {
+		t.Fatalf("answer: %v", err)
+	}
+	logon := make([]byte, 16)
+	binary.BigEndian.PutUint16(logon, MsgLogOn)
+	binary.BigEndian.PutUint32(logon[4:], 1440<<8)
+	body := append([]byte(name+"\x00"), answer...)
+	simpleEncrypt(body)
+	writeTCP(tcp, append(logon, body...))
+
+	resp, err := readTCP(tcp)
+	if err != nil || tag(resp) != MsgLogOn {
+		t.Fatalf("logon reply: %v %v", resp, err)
+	}
+	return c, int16(binary.BigEndian.Uint16(resp[2:4]))
+}
+
+func TestLoginAndFrames(t *testing.T) {
+	script := [][]byte{Frame{AckFrame: 1, Info: "Welcome to Clan Lord"}.Encode()}
+	s, err := Start(Config{Password: "secret", Frames: script, FrameInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer s.Close()
+
+	c, result := dialAndLogin(t, s.Addr(), "Tester", "secret")
+	if result != ResultOK {
+		t.Fatalf("result = %d", result)
+	}
+	login := <-s.Logins()
+	if login.Name != "Tester" || login.Identifiers.User != "user" || login.Identifiers.Host != "host" {
+		t.Fatalf("login = %+v", login)
+	}
+
+	c.udp.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 65535)
+	n, err := c.udp.Read(buf)
+	if err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	msg, ok := unframe(buf[:n])
+	if !ok || !bytes.Equal(msg, script[0]) {
+		t.Fatalf("first frame = % x", buf[:n])
+	}
+	// Idle frames follow the script.
+	n, err = c.udp.Read(buf)
+	if msg, ok := unframe(buf[:n]); err != nil || !ok || tag(msg) != MsgDrawState {
+		t.Fatalf("idle frame = % x, %v", buf[:n], err)
+	}
+
+	input := make([]byte, 20)
+	binary.BigEndian.PutUint16(input, MsgPlayerInput)
+	binary.BigEndian.PutUint32(input[16:], 7)
+	input = append(input, "/who\x00"...)
+	c.udp.Write(frameBytes(input))
+	select {
+	case in := <-s.Inputs():
+		if in.Command != "/who" || in.CommandNum != 7 || in.Reliable {
+			t.Fatalf("input = %+v", in)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no input received")
+	}
+
+	if s.Sessions() != 1 {
+		t.Fatalf("sessions = %d", s.Sessions())
+	}
+	s.Disconnect()
+	if _, err := readTCP(c.tcp); err == nil {
+		t.Fatalf("expected connection to drop")
+	}
+}
+
+func TestLoginBadPassword(t *testing.T) {
+	s, err := Start(Config{Password: "secret"})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer s.Close()
+
+	if _, result := dialAndLogin(t, s.Addr(), "Tester", "wrong"); result != ResultBadCharPass {
+		t.Fatalf("result = %d, want %d", result, ResultBadCharPass)
+	}
+	if s.Sessions() != 0 {
+		t.Fatalf("rejected login left a session")
+	}
+}
+
+func TestFrameEncodePictures(t *testing.T) {
+	f := Frame{Pictures: []Picture{{ID: 0x3fff, H: -1, V: 5}, {ID: 1, H: 2, V: -3}}}
+	msg := f.Encode()
+	// tag, header, descriptor count, stats, picture count
+	p := 2 + 9 + 1 + 7
+	if msg[p] != 2 {
+		t.Fatalf("picture count = %d", msg[p])
+	}
+	// Two pictures take 72 bits; the first 36 are the 0x3fff/-1/5 entry.
+	v := binary.BigEndian.Uint64(msg[p+1:])
+	if id := v >> 50; id != 0x3fff {
+		t.Fatalf("first id = %#x", id)
+	}
+	if h := (v >> 39) & 0x7ff; h != 0x7ff {
+		t.Fatalf("first h = %#x", h)
+	}
+	if m := msg[p+1+9]; m != 0 {
+		t.Fatalf("mobile count = %d", m)
+	}
+}
+
+func TestReadPCAP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cap.pcap")
+	frame := Frame{AckFrame: 3}.Encode()
+	err := WritePCAP(path, 5010, []Packet{
+		{FromServer: true, Msg: frame},
+		{Msg: []byte{0, 3, 0, 0}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := ReadPCAP(path, 5010)
+	if err != nil {
+		t.Fatalf("ReadPCAP: %v", err)
+	}
+	if len(msgs) != 1 || !bytes.Equal(msgs[0], frame) {
+		t.Fatalf("msgs = %x", msgs)
+	}
+}
+
+func TestReadMovie(t *testing.T) {
+	msgs, err := ReadMovie(filepath.Join("..", "clmovFiles", "chaintest.clMov"))
+	if err != nil {
+		t.Fatalf("ReadMovie: %v", err)
+	}
+	if len(msgs) != 127 {
+		t.Fatalf("got %d frames, want 127", len(msgs))
+	}
+	for i, m := range msgs {
+		if tag(m) != MsgDrawState {
+			t.Fatalf("frame %d has tag %d", i, tag(m))
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "cap.pcap")
+	if err := WritePCAP(path, 5010, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadMovie(path); err == nil {
+		t.Fatalf("expected an error for a file that is not a movie")
+	}
+}
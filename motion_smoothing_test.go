@@ -17,7 +17,7 @@ func TestMotionSmoothingFailure(t *testing.T) {
 	}
 	parsed := 0
 	for _, f := range frames {
-		if err := parseDrawState(f.data, false); err != nil {
+		if err := mainSession.parseDrawState(f.data, false); err != nil {
 			continue
 		}
 		parsed++
@@ -28,7 +28,7 @@ func TestMotionSmoothingFailure(t *testing.T) {
 	if parsed < 2 {
 		t.Fatalf("parsed %d frames", parsed)
 	}
-	if dx, dy, _, ok := pictureShift(state.prevPictures, state.pictures, maxInterpPixels); ok {
+	if dx, dy, _, ok := pictureShift(mainSession.state.prevPictures, mainSession.state.pictures, maxInterpPixels); ok {
 		t.Fatalf("pictureShift succeeded unexpectedly: (%d,%d)", dx, dy)
 	}
 }
@@ -17,6 +17,10 @@ const (
 const movieSignature = 0xdeadbeef
 const oldestMovieVersion = 193
 
+// descTableSize mirrors kDescTableSize; descriptor-only records in a mobile
+// table are stored with this offset added to their index.
+const descTableSize = 266
+
 var gameFrame int
 
 var movieRevision int32
@@ -24,9 +28,84 @@ var movieRevision int32
 type movieFrame struct {
 	data  []byte
 	index int32
+	flags uint16
+	// reset is the state built from login blocks that appear after the
+	// first data frame, as in concatenated movies. It replaces the draw
+	// state before this frame is applied.
+	reset *drawState
+}
+
+// applyMovieReset restores the state carried by a frame that follows a
+// mid-movie set of login blocks.
+func (s *session) applyMovieReset(m movieFrame) {
+	if m.reset == nil {
+		return
+	}
+	s.stateMu.Lock()
+	s.state = cloneDrawState(*m.reset)
+	s.stateMu.Unlock()
+}
+
+// movieFile is a parsed .clMov.
+type movieFile struct {
+	frames []movieFrame
+	// opening is the state from the login blocks before the first frame.
+	opening drawState
+	// info holds the info text of the game state blocks and descriptors
+	// every descriptor in the login blocks, for the client to pick up
+	// when it plays the movie.
+	info        [][]byte
+	descriptors []frameDescriptor
 }
 
+// movieParser builds a movieFile, keeping the draw state the login blocks
+// describe.
+type movieParser struct {
+	movieFile
+	version uint16
+	state   drawState
+}
+
+func newMovieParser(version uint16) *movieParser {
+	return &movieParser{version: version, state: drawState{
+		descriptors: make(map[uint8]frameDescriptor),
+		mobiles:     make(map[uint8]frameMobile),
+		prevMobiles: make(map[uint8]frameMobile),
+		prevDescs:   make(map[uint8]frameDescriptor),
+	}}
+}
+
+// parseMovie reads the movie at path and loads its opening state into the
+// main session for playback.
 func parseMovie(path string, clientVersion int) ([]movieFrame, error) {
+	m, err := readMovie(path)
+	if err != nil {
+		return nil, err
+	}
+	m.load(mainSession)
+	return m.frames, nil
+}
+
+// load resets s's draw state to the movie's opening and applies what its
+// login blocks carry besides: info text and the players' appearance.
+func (m *movieFile) load(s *session) {
+	s.resetDrawState()
+	for _, txt := range m.info {
+		s.handleInfoText(txt)
+	}
+	for _, d := range m.descriptors {
+		// Mirror live behavior so movies show avatars right away.
+		s.updatePlayerAppearance(d.Name, d.PictID, d.Colors, d.Type == kDescNPC)
+		s.queueInfoRequest(d.Name)
+	}
+	s.stateMu.Lock()
+	s.state = cloneDrawState(m.opening)
+	s.initialState = cloneDrawState(m.opening)
+	s.stateMu.Unlock()
+}
+
+// readMovie parses the movie at path without touching client state.
+func readMovie(path string) (*movieFile, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -52,12 +131,14 @@ func parseMovie(path string, clientVersion int) ([]movieFrame, error) {
 	}
 	logDebug("movie version %d.%d headerLen %d", version, revision, headerLen)
 
-	resetDrawState()
-
+	p := newMovieParser(version)
 	pos := headerLen
 	sign := []byte{0xde, 0xad, 0xbe, 0xef}
 	frames := []movieFrame{}
 	var lastFrame int32 = -1
+	// Login blocks after the first data frame start a new segment whose
+	// state is attached to the segment's first data frame.
+	sawData, pendingReset := false, false
 	for pos+12 <= len(data) {
 		if binary.BigEndian.Uint32(data[pos:pos+4]) != movieSignature {
 			idx := bytes.Index(data[pos:], sign)
@@ -76,6 +157,10 @@ func parseMovie(path string, clientVersion int) ([]movieFrame, error) {
 		flags := binary.BigEndian.Uint16(data[pos+10 : pos+12])
 		//logDebug("frame %d index=%d size=%d flags=0x%x", frameNum, frame, size, flags)
 		pos += 12
+		if sawData && !pendingReset && flags&(flagGameState|flagMobileData|flagPictureTable) != 0 {
+			p.state = newMovieParser(version).state
+			pendingReset = true
+		}
 		if flags&flagGameState != 0 {
 			//logDebug("GameState block at %d", pos)
 			if pos+24 > len(data) {
@@ -87,12 +172,12 @@ func parseMovie(path string, clientVersion int) ([]movieFrame, error) {
 			if end > len(data) {
 				break
 			}
-			parseGameState(data[start:end], version, revision)
+			p.parseGameState(data[start:end])
 			pos = end
 		}
 		if flags&flagMobileData != 0 {
 			//logDebug("MobileData table at %d", pos)
-			pos = parseMobileTable(data, pos, version, revision)
+			pos = p.parseMobileTable(data, pos)
 		}
 		if flags&flagPictureTable != 0 {
 			//logDebug("PictureTable at %d", pos)
@@ -116,16 +201,23 @@ func parseMovie(path string, clientVersion int) ([]movieFrame, error) {
 			if pos+4 <= len(data) {
 				pos += 4
 			}
-			stateMu.Lock()
 			// Preserve on-disk ordering for pictAgain semantics.
-			state.pictures = pics
-			stateMu.Unlock()
+			p.state.pictures = pics
 		}
 		if size > 0 {
 			if pos+size > len(data) {
 				break
 			}
-			frames = append(frames, movieFrame{data: append([]byte(nil), data[pos:pos+size]...), index: frame})
+			mf := movieFrame{data: append([]byte(nil), data[pos:pos+size]...), index: frame, flags: flags}
+			if pendingReset {
+				reset := cloneDrawState(p.state)
+				mf.reset = &reset
+				pendingReset = false
+			} else if !sawData {
+				p.opening = cloneDrawState(p.state)
+			}
+			sawData = true
+			frames = append(frames, mf)
 			pos += size
 		} else {
 			idx := bytes.Index(data[pos:], sign)
@@ -135,23 +227,24 @@ func parseMovie(path string, clientVersion int) ([]movieFrame, error) {
 			pos += idx
 		}
 	}
-	stateMu.Lock()
-	initialState = cloneDrawState(state)
-	stateMu.Unlock()
-	return frames, nil
+	if !sawData {
+		p.opening = p.state
+	}
+	p.frames = frames
+	return &p.movieFile, nil
 }
 
 // parseGameState decodes an initial game state block found in movies. The
 // payload mirrors the data sent by the server after login and may embed
 // descriptor and picture tables. The decoding here is intentionally
-// lightweight; only the pieces needed to prime state.mobiles and
-// state.descriptors are extracted.
-func parseGameState(gs []byte, version, revision uint16) {
+// lightweight; only the pieces needed to prime the mobiles and
+// descriptors are extracted.
+func (p *movieParser) parseGameState(gs []byte) {
 	if len(gs) == 0 {
 		return
 	}
 	if i := bytes.IndexByte(gs, 0); i >= 0 {
-		handleInfoText(gs[:i])
+		p.info = append(p.info, append([]byte(nil), gs[:i]...))
 		gs = gs[i+1:]
 	}
 
@@ -177,10 +270,8 @@ func parseGameState(gs []byte, version, revision uint16) {
 			if pos+4 <= len(gs) {
 				pos += 4
 			}
-			stateMu.Lock()
 			// Preserve on-disk ordering for pictAgain semantics.
-			state.pictures = pics
-			stateMu.Unlock()
+			p.state.pictures = pics
 			gs = gs[pos:]
 		}
 	}
@@ -188,7 +279,7 @@ func parseGameState(gs []byte, version, revision uint16) {
 	// Mobile tables end with a -1 index sentinel. If that marker exists,
 	// feed the data through the regular parser.
 	if bytes.Contains(gs, []byte{0xff, 0xff, 0xff, 0xff}) {
-		parseMobileTable(gs, 0, version, revision)
+		p.parseMobileTable(gs, 0)
 	}
 }
 
@@ -197,9 +288,8 @@ func parseGameState(gs []byte, version, revision uint16) {
 // checks below mirror the Mac client's ReadMobileTable/Read1Descriptor logic.
 // Version breakpoints correspond to kOldestMovieVersion and friends in the
 // original source.
-func parseMobileTable(data []byte, pos int, version, revision uint16) int {
-	const descTableSize = 266 // kDescTableSize
-
+func (p *movieParser) parseMobileTable(data []byte, pos int) int {
+	version := p.version
 	type layout struct {
 		descSize            int
 		colorsOffset        int
@@ -296,23 +386,11 @@ func parseMobileTable(data []byte, pos int, version, revision uint16) int {
 			pos += lgt
 		}
 
-		stateMu.Lock()
 		if hasMobile {
-			if state.mobiles == nil {
-				state.mobiles = make(map[uint8]frameMobile)
-			}
-			state.mobiles[mob.Index] = mob
-		}
-		if state.descriptors == nil {
-			state.descriptors = make(map[uint8]frameDescriptor)
+			p.state.mobiles[mob.Index] = mob
 		}
-		state.descriptors[d.Index] = d
-		stateMu.Unlock()
-
-		// Update the Players list appearance immediately from descriptor data,
-		// mirroring live behavior so movies show avatars right away.
-		updatePlayerAppearance(d.Name, d.PictID, d.Colors, d.Type == kDescNPC)
-		queueInfoRequest(d.Name)
+		p.state.descriptors[d.Index] = d
+		p.descriptors = append(p.descriptors, d)
 	}
 	return pos
 }
@@ -8,14 +8,14 @@ import (
 
 // helper to reset global state
 func resetState() {
-	stateMu.Lock()
-	state = drawState{
+	mainSession.stateMu.Lock()
+	mainSession.state = drawState{
 		descriptors: make(map[uint8]frameDescriptor),
 		mobiles:     make(map[uint8]frameMobile),
 		prevMobiles: make(map[uint8]frameMobile),
 		prevDescs:   make(map[uint8]frameDescriptor),
 	}
-	stateMu.Unlock()
+	mainSession.stateMu.Unlock()
 }
 
 func TestParseGameStatePictureTableOrder(t *testing.T) {
@@ -38,10 +38,9 @@ func TestParseGameStatePictureTableOrder(t *testing.T) {
 	// Prepend a dummy string and null terminator
 	data := append([]byte("x\x00"), pt...)
 
-	parseGameState(data, 200, 0)
-	stateMu.Lock()
-	pics := append([]framePicture(nil), state.pictures...)
-	stateMu.Unlock()
+	p := newMovieParser(200)
+	p.parseGameState(data)
+	pics := p.state.pictures
 	if len(pics) != 3 {
 		t.Fatalf("expected 3 pictures, got %d", len(pics))
 	}
@@ -97,9 +96,9 @@ func TestParseMoviePictureTableOrder(t *testing.T) {
 	if _, err := parseMovie(tmp.Name(), 200); err != nil {
 		t.Fatalf("parseMovie: %v", err)
 	}
-	stateMu.Lock()
-	pics := append([]framePicture(nil), state.pictures...)
-	stateMu.Unlock()
+	mainSession.stateMu.Lock()
+	pics := append([]framePicture(nil), mainSession.state.pictures...)
+	mainSession.stateMu.Unlock()
 	if len(pics) != 3 {
 		t.Fatalf("expected 3 pictures, got %d", len(pics))
 	}
@@ -34,6 +34,7 @@ const checkpointInterval = 300
 
 // moviePlayer manages clMov playback with basic controls.
 type moviePlayer struct {
+	sess    *session // plays the movie
 	frames  []movieFrame
 	fps     int
 	baseFPS int
@@ -51,20 +52,23 @@ type moviePlayer struct {
 	playButton *eui.ItemData
 }
 
-func newMoviePlayer(frames []movieFrame, fps int, cancel context.CancelFunc) *moviePlayer {
-	setInterpFPS(fps)
-	serverFPS = float64(fps)
-	frameInterval = time.Second / time.Duration(fps)
+func newMoviePlayer(s *session, frames []movieFrame, fps int, cancel context.CancelFunc) *moviePlayer {
+	s.setInterpFPS(fps)
+	s.frameMu.Lock()
+	s.serverFPS = float64(fps)
+	s.frameInterval = time.Second / time.Duration(fps)
+	s.frameMu.Unlock()
 	playingMovie = true
 	movieMode = true
 	return &moviePlayer{
+		sess:        s,
 		frames:      frames,
 		fps:         fps,
 		baseFPS:     fps,
 		playing:     true,
 		ticker:      time.NewTicker(time.Second / time.Duration(fps)),
 		cancel:      cancel,
-		checkpoints: []movieCheckpoint{{idx: 0, state: cloneDrawState(initialState)}},
+		checkpoints: []movieCheckpoint{{idx: 0, state: cloneDrawState(s.initialState)}},
 	}
 }
 
@@ -302,10 +306,11 @@ func (p *moviePlayer) makePlaybackWindow() {
 		movieMode = false
 		// Clear any players loaded during playback so GT_Players.json
 		// is unaffected.
-		playersMu.Lock()
-		players = make(map[string]*Player)
-		playersMu.Unlock()
-		loadPlayersPersist()
+		s := p.sess
+		s.playersMu.Lock()
+		s.players = make(map[string]*Player)
+		s.playersMu.Unlock()
+		s.loadPlayersPersist()
 		updatePlayersWindow()
 		playersPersistDirty = false
 		playersDirty = false
@@ -346,6 +351,7 @@ func (p *moviePlayer) run(ctx context.Context) {
 }
 
 func (p *moviePlayer) step() {
+	s := p.sess
 	if p.cur >= len(p.frames) {
 		p.playing = false
 		playingMovie = false
@@ -354,21 +360,22 @@ func (p *moviePlayer) step() {
 		return
 	}
 	m := p.frames[p.cur]
-	movieDropped = updateFrameCounters(m.index)
+	s.applyMovieReset(m)
+	movieDropped = s.updateFrameCounters(m.index)
 	if len(m.data) >= 2 && binary.BigEndian.Uint16(m.data[:2]) == 2 {
-		handleDrawState(m.data, true)
+		s.handleDrawState(m.data, true)
 	} else {
 		// Advance the logical frame counter even when this movie frame
 		// does not contain a draw-state update so time-based effects
 		// (e.g., bubble expiration) progress correctly during playback.
-		frameCounter++
+		s.frameCounter++
 	}
-	maybeDecodeMessage(m.data)
+	s.maybeDecodeMessage(m.data)
 	p.cur++
 	if p.cur%checkpointInterval == 0 {
-		stateMu.Lock()
-		cp := movieCheckpoint{idx: p.cur, state: cloneDrawState(state)}
-		stateMu.Unlock()
+		s.stateMu.Lock()
+		cp := movieCheckpoint{idx: p.cur, state: cloneDrawState(s.state)}
+		s.stateMu.Unlock()
 		p.checkpoints = append(p.checkpoints, cp)
 	}
 	if p.cur >= len(p.frames) {
@@ -412,9 +419,12 @@ func (p *moviePlayer) setFPS(fps int) {
 	}
 	p.fps = fps
 	p.ticker.Reset(time.Second / time.Duration(p.fps))
-	frameInterval = time.Second / time.Duration(p.fps)
-	setInterpFPS(p.fps)
-	serverFPS = float64(p.fps)
+	s := p.sess
+	s.frameMu.Lock()
+	s.frameInterval = time.Second / time.Duration(p.fps)
+	s.serverFPS = float64(p.fps)
+	s.frameMu.Unlock()
+	s.setInterpFPS(p.fps)
 	p.updateUI()
 }
 
@@ -451,6 +461,7 @@ func (p *moviePlayer) skipForwardMilli(milli int) {
 }
 
 func (p *moviePlayer) seek(idx int) {
+	s := p.sess
 	seekingMov = true
 	defer func() { seekingMov = false }()
 
@@ -486,46 +497,47 @@ func (p *moviePlayer) seek(idx int) {
 		}
 	}
 
-	stateMu.Lock()
-	state = cloneDrawState(cp.state)
+	s.stateMu.Lock()
+	s.state = cloneDrawState(cp.state)
 	// Ensure render caches reflect the restored checkpoint state. The cache
 	// will be rebuilt again if additional frames are parsed.
-	prepareRenderCacheLocked()
-	stateMu.Unlock()
-	frameCounter = cp.idx
+	s.prepareRenderCacheLocked()
+	s.stateMu.Unlock()
+	s.frameCounter = cp.idx
 
 	for i := cp.idx; i < idx; i++ {
 		m := p.frames[i]
-		movieDropped = updateFrameCounters(m.index)
+		s.applyMovieReset(m)
+		movieDropped = s.updateFrameCounters(m.index)
 		if len(m.data) >= 2 && binary.BigEndian.Uint16(m.data[:2]) == 2 {
 			// Skip render cache preparation for intermediate frames.
-			handleDrawState(m.data, i == idx-1)
+			s.handleDrawState(m.data, i == idx-1)
 		} else {
 			// Keep timeline consistent during scrubbing when frames
 			// without draw-state are encountered.
-			frameCounter++
+			s.frameCounter++
 		}
-		maybeDecodeMessage(m.data)
-		if frameCounter%checkpointInterval == 0 {
+		s.maybeDecodeMessage(m.data)
+		if s.frameCounter%checkpointInterval == 0 {
 			last := p.checkpoints[len(p.checkpoints)-1]
-			if last.idx != frameCounter {
-				stateMu.Lock()
-				snap := movieCheckpoint{idx: frameCounter, state: cloneDrawState(state)}
-				stateMu.Unlock()
+			if last.idx != s.frameCounter {
+				s.stateMu.Lock()
+				snap := movieCheckpoint{idx: s.frameCounter, state: cloneDrawState(s.state)}
+				s.stateMu.Unlock()
 				p.checkpoints = append(p.checkpoints, snap)
 			}
 		}
 	}
 	last := p.checkpoints[len(p.checkpoints)-1]
 	if last.idx != idx {
-		stateMu.Lock()
-		snap := movieCheckpoint{idx: idx, state: cloneDrawState(state)}
-		stateMu.Unlock()
+		s.stateMu.Lock()
+		snap := movieCheckpoint{idx: idx, state: cloneDrawState(s.state)}
+		s.stateMu.Unlock()
 		p.checkpoints = append(p.checkpoints, snap)
 	}
 	p.cur = idx
-	resetInterpolation()
-	setInterpFPS(p.fps)
+	s.resetInterpolation()
+	s.setInterpFPS(p.fps)
 	p.updateUI()
 	p.playing = wasPlaying
 }
@@ -534,7 +546,7 @@ func (p *moviePlayer) seek(idx int) {
 // could contain a textual message. Frames shorter than the 16-byte prefix or
 // tagged as draw-state (tag 2) are skipped to avoid needless decoding.
 // This heuristic may be refined as additional frame types are understood.
-func maybeDecodeMessage(m []byte) {
+func (s *session) maybeDecodeMessage(m []byte) {
 	if len(m) <= 16 {
 		return
 	}
@@ -543,28 +555,28 @@ func maybeDecodeMessage(m []byte) {
 	}
 	// decodeMessage mutates the message body; use a copy to keep the stored
 	// frame unchanged.
-	if txt := decodeMessage(append([]byte(nil), m...)); txt != "" {
+	if txt := s.decodeMessage(append([]byte(nil), m...)); txt != "" {
 		_ = txt
 	}
 }
 
-func resetInterpolation() {
-	stateMu.Lock()
-	state.prevMobiles = make(map[uint8]frameMobile)
-	state.prevDescs = make(map[uint8]frameDescriptor)
-	state.prevTime = state.curTime
-	stateMu.Unlock()
+func (s *session) resetInterpolation() {
+	s.stateMu.Lock()
+	s.state.prevMobiles = make(map[uint8]frameMobile)
+	s.state.prevDescs = make(map[uint8]frameDescriptor)
+	s.state.prevTime = s.state.curTime
+	s.stateMu.Unlock()
 }
 
-func setInterpFPS(fps int) {
+func (s *session) setInterpFPS(fps int) {
 	if fps < 1 {
 		fps = 1
 	}
 	d := time.Second / time.Duration(fps)
-	stateMu.Lock()
-	if state.prevTime.IsZero() {
-		state.prevTime = time.Now()
+	s.stateMu.Lock()
+	if s.state.prevTime.IsZero() {
+		s.state.prevTime = time.Now()
 	}
-	state.curTime = state.prevTime.Add(d)
-	stateMu.Unlock()
+	s.state.curTime = s.state.prevTime.Add(d)
+	s.stateMu.Unlock()
 }
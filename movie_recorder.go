@@ -2,7 +2,11 @@ package main
 
 import (
 	"encoding/binary"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -24,20 +28,24 @@ type frameHead struct {
 }
 
 type movieRecorder struct {
-	f        *os.File
-	head     fileHead
-	preFlags uint16
-	preData  []byte
+	f    *os.File
+	path string
+	head fileHead
+	size int64
 }
 
 const macEpochDelta = 2082844800
 
+// maxMovieFileSize caps a single recording. Longer sessions continue in a
+// new numbered file that starts with a fresh set of login blocks.
+const maxMovieFileSize = 256 << 20
+
 func newMovieRecorder(path string, version, revision int) (*movieRecorder, error) {
 	f, err := os.Create(path)
 	if err != nil {
 		return nil, err
 	}
-	mr := &movieRecorder{f: f}
+	mr := &movieRecorder{f: f, path: path}
 	mr.head = fileHead{
 		Signature:    movieSignature,
 		Version:      uint16(version),
@@ -51,6 +59,7 @@ func newMovieRecorder(path string, version, revision int) (*movieRecorder, error
 		f.Close()
 		return nil, err
 	}
+	mr.size = 24
 	return mr, nil
 }
 
@@ -63,19 +72,31 @@ func (m *movieRecorder) writeHeader() error {
 	binary.BigEndian.PutUint32(buf[12:], m.head.StartTime)
 	binary.BigEndian.PutUint32(buf[16:], uint32(m.head.Revision))
 	binary.BigEndian.PutUint32(buf[20:], uint32(m.head.OldestReader))
-	if _, err := m.f.Seek(0, 0); err != nil {
+	if _, err := m.f.WriteAt(buf, 0); err != nil {
 		return err
 	}
-	_, err := m.f.Write(buf)
-	return err
+	return nil
 }
 
-func (m *movieRecorder) AddBlock(data []byte, flag uint16) {
-	if len(data) == 0 {
-		return
+// loginGameState builds the game state payload in the layout parseGameState
+// reads: the info text up to a NUL, the picture table when there are
+// pictures, then one mobile table holding both mobile and descriptor-only
+// records.
+func loginGameState(info string, descs map[uint8]frameDescriptor, mobiles map[uint8]frameMobile, pics []framePicture) []byte {
+	buf := append(encodeMacRoman(info), 0)
+	if len(pics) > 0 {
+		buf = append(buf, encodePictureTable(pics)...)
 	}
-	m.preData = append(m.preData, data...)
-	m.preFlags |= flag
+	withMobile, descOnly := encodeMobileTables(descs, mobiles)
+	if withMobile != nil {
+		buf = append(buf, withMobile[:len(withMobile)-4]...)
+	}
+	if descOnly != nil {
+		buf = append(buf, descOnly...)
+	} else if withMobile != nil {
+		buf = append(buf, 0xff, 0xff, 0xff, 0xff)
+	}
+	return buf
 }
 
 func gameStateBlock(payload []byte) []byte {
@@ -85,34 +106,61 @@ func gameStateBlock(payload []byte) []byte {
 	return buf
 }
 
+// WriteFrame appends a frame to the movie. Data frames carry the raw server
+// message; pseudo-frames (game state, mobile data, picture table) have an
+// empty size and their table follows the header, as in the Mac client.
 func (m *movieRecorder) WriteFrame(data []byte, flags uint16) error {
 	if m.f == nil {
 		return os.ErrClosed
 	}
+	size := len(data)
+	if flags&(flagGameState|flagMobileData|flagPictureTable) != 0 {
+		size = 0
+	}
 	fh := frameHead{
 		Signature: movieSignature,
 		Frame:     m.head.Frames,
-		Size:      uint16(len(data)),
-		Flags:     flags | m.preFlags,
+		Size:      uint16(size),
+		Flags:     flags,
 	}
 	m.head.Frames++
-	buf := make([]byte, 12)
+	buf := make([]byte, 12, 12+len(data))
 	binary.BigEndian.PutUint32(buf[0:], fh.Signature)
 	binary.BigEndian.PutUint32(buf[4:], uint32(fh.Frame))
 	binary.BigEndian.PutUint16(buf[8:], fh.Size)
 	binary.BigEndian.PutUint16(buf[10:], fh.Flags)
-	if _, err := m.f.Write(buf); err != nil {
+	buf = append(buf, data...)
+	n, err := m.f.Write(buf)
+	m.size += int64(n)
+	return err
+}
+
+// writeLoginBlocks stores the game state, mobile table and picture table
+// ahead of the first data frame so playback starts from the same state the
+// live client had when recording began. The game state carries the night
+// command as its info text.
+func (m *movieRecorder) writeLoginBlocks(night string, descs map[uint8]frameDescriptor, mobiles map[uint8]frameMobile, pics []framePicture) error {
+	gs := loginGameState(night, descs, mobiles, pics)
+	if err := m.WriteFrame(gameStateBlock(gs), flagGameState); err != nil {
 		return err
 	}
-	if len(m.preData) > 0 {
-		if _, err := m.f.Write(m.preData); err != nil {
+	withMobile, descOnly := encodeMobileTables(descs, mobiles)
+	if withMobile != nil {
+		if err := m.WriteFrame(withMobile, flagMobileData); err != nil {
 			return err
 		}
-		m.preData = nil
-		m.preFlags = 0
 	}
-	_, err := m.f.Write(data)
-	return err
+	if descOnly != nil {
+		if err := m.WriteFrame(descOnly, flagMobileData); err != nil {
+			return err
+		}
+	}
+	if len(pics) > 0 {
+		if err := m.WriteFrame(encodePictureTable(pics), flagPictureTable); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (m *movieRecorder) Close() error {
@@ -128,3 +176,266 @@ func (m *movieRecorder) Close() error {
 	m.f = nil
 	return err
 }
+
+// encodeMobileTables builds the two mobile data tables written by the Mac
+// client's SaveMobileTable: descriptors referenced by an on-screen mobile
+// (with the mobile record) and the remaining named descriptors. Each table
+// ends with a -1 sentinel. A nil table means there was nothing to store.
+func encodeMobileTables(descs map[uint8]frameDescriptor, mobiles map[uint8]frameMobile) (withMobile, descOnly []byte) {
+	idxs := make([]int, 0, len(descs))
+	for idx := range descs {
+		idxs = append(idxs, int(idx))
+	}
+	sort.Ints(idxs)
+	for _, i := range idxs {
+		d := descs[uint8(i)]
+		if mob, ok := mobiles[uint8(i)]; ok {
+			rec := make([]byte, 20)
+			binary.BigEndian.PutUint32(rec[0:], uint32(i))
+			binary.BigEndian.PutUint32(rec[4:], uint32(mob.State))
+			binary.BigEndian.PutUint32(rec[8:], uint32(int32(mob.H)))
+			binary.BigEndian.PutUint32(rec[12:], uint32(int32(mob.V)))
+			binary.BigEndian.PutUint32(rec[16:], uint32(mob.Colors))
+			withMobile = append(withMobile, rec...)
+			withMobile = append(withMobile, encodeDescriptor(d)...)
+			continue
+		}
+		if d.Name == "" && d.PictID == 0 {
+			continue
+		}
+		var rec [4]byte
+		binary.BigEndian.PutUint32(rec[:], uint32(i+descTableSize))
+		descOnly = append(descOnly, rec[:]...)
+		descOnly = append(descOnly, encodeDescriptor(d)...)
+	}
+	trailer := []byte{0xff, 0xff, 0xff, 0xff}
+	if withMobile != nil {
+		withMobile = append(withMobile, trailer...)
+	}
+	if descOnly != nil {
+		descOnly = append(descOnly, trailer...)
+	}
+	return withMobile, descOnly
+}
+
+// encodeDescriptor writes a descriptor using the v142+ DescTable layout
+// understood by parseMobileTable. The bubble counter is left at zero so no
+// bubble text follows.
+func encodeDescriptor(d frameDescriptor) []byte {
+	buf := make([]byte, 156)
+	binary.BigEndian.PutUint32(buf[0:], uint32(d.PictID))
+	binary.BigEndian.PutUint32(buf[16:], uint32(d.Type))
+	colors := d.Colors
+	if len(colors) > 30 {
+		colors = colors[:30]
+	}
+	binary.BigEndian.PutUint32(buf[48:], uint32(len(colors)))
+	copy(buf[56:86], colors)
+	name := encodeMacRoman(d.Name)
+	if len(name) > 47 {
+		name = name[:47]
+	}
+	copy(buf[86:134], name)
+	return buf
+}
+
+// encodePictureTable writes the picture table block: a count, the
+// pictures in draw order, and a -1 trailer.
+func encodePictureTable(pics []framePicture) []byte {
+	buf := make([]byte, 2+6*len(pics)+4)
+	binary.BigEndian.PutUint16(buf[0:], uint16(len(pics)))
+	p := 2
+	for _, pic := range pics {
+		binary.BigEndian.PutUint16(buf[p:], pic.PictID)
+		binary.BigEndian.PutUint16(buf[p+2:], uint16(pic.H))
+		binary.BigEndian.PutUint16(buf[p+4:], uint16(pic.V))
+		p += 6
+	}
+	binary.BigEndian.PutUint32(buf[p:], 0xffffffff)
+	return buf
+}
+
+// defaultRecordPath returns a timestamped path in the Movies folder, named
+// after s's character like screenshots are.
+func (s *session) defaultRecordPath() string {
+	who := s.playerName
+	if who == "" {
+		who = "clanlord"
+	}
+	ts := time.Now().Format("2006-01-02-15-04-05")
+	return filepath.Join(dataDirPath, "Movies", fmt.Sprintf("%v__%s.clMov", who, ts))
+}
+
+// nextRecordPath returns path, or path with a numeric suffix when a file of
+// that name already exists, so reconnects and rotation never overwrite an
+// earlier recording.
+func nextRecordPath(path string) string {
+	if _, err := os.Stat(path); err != nil {
+		return path
+	}
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 2; ; i++ {
+		p := fmt.Sprintf("%s-%d%s", base, i, ext)
+		if _, err := os.Stat(p); err != nil {
+			return p
+		}
+	}
+}
+
+// openRecorderLocked creates a recorder at path and writes the login blocks
+// from s's draw state. Call with s.recorderMu held.
+func (s *session) openRecorderLocked(path string) (*movieRecorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	rec, err := newMovieRecorder(nextRecordPath(path), clientVersion, int(movieRevision))
+	if err != nil {
+		return nil, err
+	}
+	s.stateMu.Lock()
+	descs := make(map[uint8]frameDescriptor, len(s.state.descriptors))
+	for k, v := range s.state.descriptors {
+		descs[k] = v
+	}
+	mobiles := make(map[uint8]frameMobile, len(s.state.mobiles))
+	for k, v := range s.state.mobiles {
+		mobiles[k] = v
+	}
+	pics := append([]framePicture(nil), s.state.pictures...)
+	s.stateMu.Unlock()
+	if err := rec.writeLoginBlocks(s.night.command(), descs, mobiles, pics); err != nil {
+		rec.Close()
+		return nil, err
+	}
+	return rec, nil
+}
+
+// startMovieRecording begins writing s to a .clMov file. An empty path
+// records to the Movies folder in the data directory.
+func (s *session) startMovieRecording(path string) error {
+	s.recorderMu.Lock()
+	defer s.recorderMu.Unlock()
+	if s.recorder != nil {
+		return nil
+	}
+	if path == "" {
+		path = s.defaultRecordPath()
+	}
+	rec, err := s.openRecorderLocked(path)
+	if err != nil {
+		return fmt.Errorf("record movie: %w", err)
+	}
+	s.recorder = rec
+	s.consoleMessage(fmt.Sprintf("Recording to %s", filepath.Base(rec.path)))
+	s.updateRecordStatusLocked()
+	return nil
+}
+
+// stopMovieRecording finalizes the active recording, if any.
+func (s *session) stopMovieRecording() {
+	s.recorderMu.Lock()
+	defer s.recorderMu.Unlock()
+	if s.recorder == nil {
+		return
+	}
+	path := s.recorder.path
+	if err := s.recorder.Close(); err != nil {
+		logError("record movie: close %v: %v", path, err)
+	}
+	s.recorder = nil
+	s.consoleMessage(fmt.Sprintf("Recording saved: %s", filepath.Base(path)))
+	s.updateRecordStatusLocked()
+}
+
+// toggleMovieRecording starts or stops recording the session in the game
+// window.
+func toggleMovieRecording() {
+	s := focusedSession()
+	s.recorderMu.Lock()
+	active := s.recorder != nil
+	s.recorderMu.Unlock()
+	if active {
+		s.stopMovieRecording()
+		return
+	}
+	if !s.connected() {
+		s.consoleMessage("Not connected; nothing to record.")
+		return
+	}
+	if err := s.startMovieRecording(""); err != nil {
+		logError("%v", err)
+		makeErrorWindow("Error: " + err.Error())
+	}
+}
+
+// recordMessage appends a server message to the active recording, rotating
+// to a new file once the current one grows past maxMovieFileSize. It must be
+// called before the message is applied so rotated files start from the
+// state the message builds on.
+func (s *session) recordMessage(m []byte) {
+	s.recorderMu.Lock()
+	defer s.recorderMu.Unlock()
+	if s.recorder == nil {
+		return
+	}
+	if s.recorder.size >= maxMovieFileSize {
+		path := s.recorder.path
+		if err := s.recorder.Close(); err != nil {
+			logError("record movie: close %v: %v", path, err)
+		}
+		rec, err := s.openRecorderLocked(path)
+		if err != nil {
+			logError("record movie: rotate: %v", err)
+			s.recorder = nil
+			s.updateRecordStatusLocked()
+			return
+		}
+		s.recorder = rec
+		logDebug("recording continued in %v", rec.path)
+	}
+	var flags uint16
+	if gPlayersListIsStale {
+		flags |= flagStale
+	}
+	if err := s.recorder.WriteFrame(m, flags); err != nil {
+		logError("record frame: %v", err)
+	}
+}
+
+// updateRecordStatus refreshes the toolbar recording indicator for the
+// session in the game window.
+func updateRecordStatus() {
+	s := focusedSession()
+	s.recorderMu.Lock()
+	defer s.recorderMu.Unlock()
+	s.updateRecordStatusLocked()
+}
+
+// updateRecordStatusLocked refreshes the indicator if s is in the game
+// window. Call with s.recorderMu held.
+func (s *session) updateRecordStatusLocked() {
+	if !s.isFocused() {
+		return
+	}
+	active := s.recorder != nil
+	if recordStatus != nil {
+		if active {
+			recordStatus.Text = "REC"
+		} else {
+			recordStatus.Text = ""
+		}
+		recordStatus.Dirty = true
+	}
+	if recordBtn != nil {
+		if active {
+			recordBtn.Text = "Stop Rec"
+		} else {
+			recordBtn.Text = "Record"
+		}
+		recordBtn.Dirty = true
+	}
+	if hudWin != nil {
+		hudWin.Refresh()
+	}
+}
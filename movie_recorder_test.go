@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMovieRecorderRoundTrip(t *testing.T) {
+	resetState()
+	t.Cleanup(func() { mainSession.parseNightCommand("/nt 0 /sa 0 /cl 0") })
+	path := filepath.Join(t.TempDir(), "rec.clMov")
+	rec, err := newMovieRecorder(path, 1440, 0)
+	if err != nil {
+		t.Fatalf("newMovieRecorder: %v", err)
+	}
+
+	descs := map[uint8]frameDescriptor{
+		1: {Index: 1, Type: kDescPlayer, PictID: 100, Name: "Tester", Colors: []byte{1, 2, 3}},
+		7: {Index: 7, Type: kDescMonster, PictID: 200, Name: "Rat"},
+	}
+	mobiles := map[uint8]frameMobile{
+		1: {Index: 1, State: 3, H: -10, V: 20, Colors: 5},
+	}
+	pics := []framePicture{{PictID: 9, H: 1, V: 2}, {PictID: 8, H: -3, V: 4}}
+	if err := rec.writeLoginBlocks("/nt 40 /sa 90 /cl 1", descs, mobiles, pics); err != nil {
+		t.Fatalf("writeLoginBlocks: %v", err)
+	}
+	frame := []byte{0, 2, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	if err := rec.WriteFrame(frame, 0); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	checkState := func(what string) {
+		t.Helper()
+		mainSession.stateMu.Lock()
+		defer mainSession.stateMu.Unlock()
+		m, ok := mainSession.state.mobiles[1]
+		if !ok || m.State != 3 || m.H != -10 || m.V != 20 || m.Colors != 5 {
+			t.Fatalf("%s: mobile not restored: %+v", what, mainSession.state.mobiles)
+		}
+		if _, ok := mainSession.state.mobiles[7]; ok {
+			t.Fatalf("%s: descriptor-only entry restored as mobile", what)
+		}
+		d := mainSession.state.descriptors[1]
+		if d.Name != "Tester" || d.PictID != 100 || d.Type != kDescPlayer || !bytes.Equal(d.Colors, []byte{1, 2, 3}) {
+			t.Fatalf("%s: descriptor not restored: %+v", what, d)
+		}
+		if mainSession.state.descriptors[7].Name != "Rat" {
+			t.Fatalf("%s: descriptor-only entry missing: %+v", what, mainSession.state.descriptors)
+		}
+		if len(mainSession.state.pictures) != 2 || mainSession.state.pictures[0].PictID != 9 || mainSession.state.pictures[1].H != -3 {
+			t.Fatalf("%s: pictures not restored: %+v", what, mainSession.state.pictures)
+		}
+	}
+	checkNight := func(what string) {
+		t.Helper()
+		mainSession.night.mu.Lock()
+		defer mainSession.night.mu.Unlock()
+		if mainSession.night.BaseLevel != 40 || mainSession.night.Azimuth != 90 || !mainSession.night.Cloudy {
+			t.Fatalf("%s: night = %d /sa %d /cl %v", what, mainSession.night.BaseLevel, mainSession.night.Azimuth, mainSession.night.Cloudy)
+		}
+	}
+
+	mainSession.parseNightCommand("/nt 0 /sa 0 /cl 0")
+	frames, err := parseMovie(path, 1440)
+	if err != nil {
+		t.Fatalf("parseMovie: %v", err)
+	}
+	if len(frames) != 1 || !bytes.Equal(frames[0].data, frame) {
+		t.Fatalf("unexpected frames: %+v", frames)
+	}
+	// game state, two mobile tables and the picture table precede the data.
+	if frames[0].index != 4 {
+		t.Fatalf("frame index %d, want 4", frames[0].index)
+	}
+	checkState("movie")
+	checkNight("movie")
+
+	// The game state block alone carries the whole opening state.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := data[24:]
+	if flags := binary.BigEndian.Uint16(block[10:12]); flags != flagGameState {
+		t.Fatalf("first block flags %#x, want game state", flags)
+	}
+	size := int(binary.BigEndian.Uint32(block[12+12:]))
+	resetState()
+	mainSession.parseNightCommand("/nt 0 /sa 0 /cl 0")
+	p := newMovieParser(1440)
+	p.parseGameState(block[12+24 : 12+24+size])
+	p.opening = p.state
+	p.load(mainSession)
+	checkState("game state")
+	checkNight("game state")
+}
+
+func TestNextRecordPath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rec.clMov")
+	if got := nextRecordPath(path); got != path {
+		t.Fatalf("got %v, want %v", got, path)
+	}
+	rec, err := newMovieRecorder(path, 1440, 0)
+	if err != nil {
+		t.Fatalf("newMovieRecorder: %v", err)
+	}
+	rec.Close()
+	want := filepath.Join(dir, "rec-2.clMov")
+	if got := nextRecordPath(path); got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
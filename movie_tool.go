@@ -0,0 +1,527 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// movieToolUsage is printed for "gothoom movie" without a valid command.
+// Dumps are for reading; nothing turns JSON back into a movie.
+const movieToolUsage = `usage:
+  gothoom movie dump [-o out.json] movie.clMov
+  gothoom movie trim -start N [-end M] -o out.clMov movie.clMov
+  gothoom movie concat -o out.clMov first.clMov second.clMov...
+  gothoom movie pcap [-port N] -o out.clMov capture.pcapng`
+
+// movieDumpText receives console and chat lines while the movie tool
+// applies frames, so decoded text can be attached to the frame that
+// produced it.
+var movieDumpText func(typ, text string)
+
+// runMovieTool implements the "movie" subcommand: args are the arguments
+// after "movie" and JSON dumps without -o go to stdout.
+func runMovieTool(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(movieToolUsage)
+	}
+	quietMovieSetup()
+
+	switch args[0] {
+	case "dump":
+		return movieDumpCmd(args[1:], stdout)
+	case "trim":
+		return movieTrimCmd(args[1:])
+	case "concat":
+		return movieConcatCmd(args[1:])
+	case "pcap":
+		return moviePCAPCmd(args[1:])
+	}
+	return fmt.Errorf("unknown movie command %q\n%s", args[0], movieToolUsage)
+}
+
+// quietMovieSetup prepares the client state for applying movie frames
+// outside the game: nothing may touch the terminal, audio or Text Logs.
+func quietMovieSetup() {
+	logOutput = os.Stderr
+	silent = true
+	blockSound = true
+	blockMusic = true
+	blockTTS = true
+	blockBubbles = true
+	movieMode = true
+	textLogOnce.Do(func() {})
+	initFont()
+}
+
+func newMovieFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("movie "+name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// movieFileInfo is the part of a .clMov header the tool carries over to
+// the files it writes.
+type movieFileInfo struct {
+	version   uint16 // as stored; Arindal movies use 100x larger numbers
+	revision  int32
+	startTime uint32 // seconds since the Mac epoch
+}
+
+func readMovieFileInfo(path string) (movieFileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return movieFileInfo{}, err
+	}
+	defer f.Close()
+	var head [24]byte
+	if _, err := io.ReadFull(f, head[:]); err != nil {
+		return movieFileInfo{}, fmt.Errorf("%v: short file", path)
+	}
+	if binary.BigEndian.Uint32(head[:4]) != movieSignature {
+		return movieFileInfo{}, fmt.Errorf("%v: bad signature", path)
+	}
+	return movieFileInfo{
+		version:   binary.BigEndian.Uint16(head[4:6]),
+		revision:  int32(binary.BigEndian.Uint32(head[16:20])),
+		startTime: binary.BigEndian.Uint32(head[12:16]),
+	}, nil
+}
+
+// startMovieState makes open s's draw state, so applyMovieFrames replays a
+// movie from there.
+func (s *session) startMovieState(open drawState) {
+	s.resetDrawState()
+	s.stateMu.Lock()
+	s.state = cloneDrawState(open)
+	s.stateMu.Unlock()
+}
+
+// applyMovieFrames advances the draw state through frames the way the
+// movie player does.
+func (s *session) applyMovieFrames(frames []movieFrame) {
+	for _, m := range frames {
+		s.applyMovieReset(m)
+		movieDropped = s.updateFrameCounters(m.index)
+		if len(m.data) >= 2 && binary.BigEndian.Uint16(m.data[:2]) == 2 {
+			s.handleDrawState(m.data, false)
+		} else {
+			s.frameCounter++
+		}
+	}
+}
+
+// writeMovieSegment writes login blocks for open followed by frames. A frame
+// that starts a new segment gets its own login blocks. night is the night
+// command the login blocks carry.
+func writeMovieSegment(rec *movieRecorder, night string, open drawState, frames []movieFrame) error {
+	if err := rec.writeLoginBlocks(night, open.descriptors, open.mobiles, open.pictures); err != nil {
+		return err
+	}
+	for i, m := range frames {
+		if m.reset != nil && i > 0 {
+			if err := rec.writeLoginBlocks(night, m.reset.descriptors, m.reset.mobiles, m.reset.pictures); err != nil {
+				return err
+			}
+		}
+		if err := rec.WriteFrame(m.data, m.flags&flagStale); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createMovie(path string, info movieFileInfo) (*movieRecorder, error) {
+	rec, err := newMovieRecorder(path, int(info.version), int(info.revision))
+	if err != nil {
+		return nil, err
+	}
+	rec.head.StartTime = info.startTime
+	return rec, nil
+}
+
+// trimMovie writes frames [start,end) of the movie at in to out. The state
+// the earlier frames built up is written as login blocks so the new movie
+// opens on the same scene.
+func trimMovie(in, out string, start, end int) error {
+	info, err := readMovieFileInfo(in)
+	if err != nil {
+		return err
+	}
+	m, err := readMovie(in)
+	if err != nil {
+		return err
+	}
+	frames := m.frames
+	if end <= 0 || end > len(frames) {
+		end = len(frames)
+	}
+	if start < 0 || start >= end {
+		return fmt.Errorf("no frames in range %d-%d (movie has %d)", start, end, len(frames))
+	}
+	s := mainSession
+	s.startMovieState(m.opening)
+	s.applyMovieFrames(frames[:start])
+	s.stateMu.Lock()
+	open := cloneDrawState(s.state)
+	s.stateMu.Unlock()
+	if r := frames[start].reset; r != nil {
+		open = *r
+	}
+
+	info.startTime += uint32(start / clMovFPS)
+	rec, err := createMovie(out, info)
+	if err != nil {
+		return err
+	}
+	if err := writeMovieSegment(rec, s.night.command(), open, frames[start:end]); err != nil {
+		rec.Close()
+		return err
+	}
+	return rec.Close()
+}
+
+// concatMovies joins movies recorded with the same client version into
+// out. Each input keeps its own opening state.
+func concatMovies(out string, ins []string) error {
+	var first movieFileInfo
+	for i, in := range ins {
+		info, err := readMovieFileInfo(in)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			first = info
+		} else if info.version != first.version || info.revision != first.revision {
+			return fmt.Errorf("%v: version %d.%d does not match %v (%d.%d)", in, info.version, info.revision, ins[0], first.version, first.revision)
+		}
+	}
+	rec, err := createMovie(out, first)
+	if err != nil {
+		return err
+	}
+	for _, in := range ins {
+		m, err := readMovie(in)
+		if err == nil {
+			err = writeMovieSegment(rec, mainSession.night.command(), m.opening, m.frames)
+		}
+		if err != nil {
+			rec.Close()
+			return fmt.Errorf("%v: %w", in, err)
+		}
+	}
+	return rec.Close()
+}
+
+func movieTrimCmd(args []string) error {
+	fs := newMovieFlagSet("trim")
+	start := fs.Int("start", 0, "first frame to keep")
+	end := fs.Int("end", 0, "frame to stop before (0 = end of movie)")
+	out := fs.String("o", "", "output .clMov")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *out == "" {
+		return errors.New(movieToolUsage)
+	}
+	return trimMovie(fs.Arg(0), *out, *start, *end)
+}
+
+func movieConcatCmd(args []string) error {
+	fs := newMovieFlagSet("concat")
+	out := fs.String("o", "", "output .clMov")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 || *out == "" {
+		return errors.New(movieToolUsage)
+	}
+	return concatMovies(*out, fs.Args())
+}
+
+func moviePCAPCmd(args []string) error {
+	fs := newMovieFlagSet("pcap")
+	port := fs.Int("port", pcapServerPort(), "server port in the capture")
+	out := fs.String("o", "", "output .clMov")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *out == "" {
+		return errors.New(movieToolUsage)
+	}
+	n, err := convertPCAP(fs.Arg(0), *out, *port)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d frames to %s\n", n, *out)
+	return nil
+}
+
+func movieDumpCmd(args []string, stdout io.Writer) error {
+	fs := newMovieFlagSet("dump")
+	out := fs.String("o", "", "output file (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New(movieToolUsage)
+	}
+	dump, err := dumpMovie(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	w := stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dump)
+}
+
+// movieDump is the JSON timeline written by "movie dump".
+type movieDump struct {
+	Version  int       `json:"version"`
+	Revision int32     `json:"revision"`
+	Start    time.Time `json:"start"`
+	Player   string    `json:"player,omitempty"`
+	// Opening is the state stored in the login blocks.
+	Opening dumpState   `json:"opening"`
+	Frames  []dumpFrame `json:"frames"`
+}
+
+type dumpState struct {
+	Descriptors []dumpDescriptor `json:"descriptors,omitempty"`
+	Mobiles     []dumpMobile     `json:"mobiles,omitempty"`
+	Pictures    []dumpPicture    `json:"pictures,omitempty"`
+}
+
+type dumpDescriptor struct {
+	Index  uint8  `json:"index"`
+	Type   uint8  `json:"type"`
+	PictID uint16 `json:"pict"`
+	Name   string `json:"name,omitempty"`
+	Colors []byte `json:"colors,omitempty"`
+}
+
+type dumpMobile struct {
+	Index  uint8  `json:"index"`
+	Name   string `json:"name,omitempty"`
+	State  uint8  `json:"state"`
+	H      int16  `json:"h"`
+	V      int16  `json:"v"`
+	Colors uint8  `json:"colors"`
+}
+
+type dumpPicture struct {
+	ID uint16 `json:"id"`
+	H  int16  `json:"h"`
+	V  int16  `json:"v"`
+}
+
+type dumpStats struct {
+	HP         int `json:"hp"`
+	HPMax      int `json:"hpMax"`
+	SP         int `json:"sp"`
+	SPMax      int `json:"spMax"`
+	Balance    int `json:"balance"`
+	BalanceMax int `json:"balanceMax"`
+}
+
+type dumpText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// dumpFrame is one movie frame. Draw-state frames list the descriptors
+// they introduce, how many of the previous frame's pictures are kept
+// (PictAgain) followed by the new Pictures, and every mobile.
+type dumpFrame struct {
+	Index int    `json:"index"`
+	Frame int32  `json:"frame"`
+	Tag   uint16 `json:"tag"`
+	Size  int    `json:"size"`
+	Stale bool   `json:"stale,omitempty"`
+	// Reset is set on the first frame after mid-movie login blocks.
+	Reset *dumpState `json:"reset,omitempty"`
+
+	AckCmd      uint8            `json:"ackCmd,omitempty"`
+	AckFrame    int32            `json:"ackFrame,omitempty"`
+	ResendFrame int32            `json:"resendFrame,omitempty"`
+	Stats       *dumpStats       `json:"stats,omitempty"`
+	Lighting    uint8            `json:"lighting,omitempty"`
+	Descriptors []dumpDescriptor `json:"descriptors,omitempty"`
+	PictAgain   int              `json:"pictAgain,omitempty"`
+	Pictures    []dumpPicture    `json:"pictures,omitempty"`
+	Mobiles     []dumpMobile     `json:"mobiles,omitempty"`
+	Text        []dumpText       `json:"text,omitempty"`
+	Error       string           `json:"error,omitempty"`
+}
+
+func dumpMovie(path string) (*movieDump, error) {
+	info, err := readMovieFileInfo(path)
+	if err != nil {
+		return nil, err
+	}
+	mov, err := readMovie(path)
+	if err != nil {
+		return nil, err
+	}
+	frames := mov.frames
+	d := &movieDump{
+		Version:  int(info.version),
+		Revision: info.revision,
+		Start:    time.Unix(int64(info.startTime)-macEpochDelta, 0).UTC(),
+		Player:   extractMoviePlayerName(frames),
+		Opening:  dumpDrawState(mov.opening),
+	}
+	s := mainSession
+	s.startMovieState(mov.opening)
+
+	var text []dumpText
+	movieDumpText = func(typ, t string) { text = append(text, dumpText{Type: typ, Text: t}) }
+	defer func() { movieDumpText = nil }()
+
+	d.Frames = make([]dumpFrame, 0, len(frames))
+	for i, m := range frames {
+		f := dumpFrame{Index: i, Frame: m.index, Size: len(m.data), Stale: m.flags&flagStale != 0}
+		if m.reset != nil {
+			r := dumpDrawState(*m.reset)
+			f.Reset = &r
+		}
+		if len(m.data) >= 2 {
+			f.Tag = binary.BigEndian.Uint16(m.data[:2])
+		}
+		text = nil
+		s.applyMovieFrames(frames[i : i+1])
+		if f.Tag == 2 {
+			s.stateMu.Lock()
+			descs := s.state.descriptors
+			s.stateMu.Unlock()
+			if err := decodeDrawStateDump(m.data[2:], descs, &f); err != nil {
+				f.Error = err.Error()
+			}
+		} else if txt := s.decodeMessage(append([]byte(nil), m.data...)); txt != "" {
+			text = append(text, dumpText{Type: "message", Text: txt})
+		}
+		f.Text = text
+		d.Frames = append(d.Frames, f)
+	}
+	return d, nil
+}
+
+// dumpDrawState lists a draw state's descriptors, mobiles and pictures.
+func dumpDrawState(s drawState) dumpState {
+	var out dumpState
+	for i := 0; i < 256; i++ {
+		if desc, ok := s.descriptors[uint8(i)]; ok {
+			out.Descriptors = append(out.Descriptors, dumpDescriptor{Index: desc.Index, Type: desc.Type, PictID: desc.PictID, Name: desc.Name, Colors: desc.Colors})
+		}
+		if m, ok := s.mobiles[uint8(i)]; ok {
+			out.Mobiles = append(out.Mobiles, dumpMobile{Index: m.Index, Name: s.descriptors[m.Index].Name, State: m.State, H: m.H, V: m.V, Colors: m.Colors})
+		}
+	}
+	for _, p := range s.pictures {
+		out.Pictures = append(out.Pictures, dumpPicture{ID: p.PictID, H: p.H, V: p.V})
+	}
+	return out
+}
+
+// decodeDrawStateDump fills f from a draw-state message body (without the
+// tag). Mobile names come from descs, the descriptors known after the
+// frame was applied.
+func decodeDrawStateDump(data []byte, descs map[uint8]frameDescriptor, f *dumpFrame) error {
+	if len(data) < 10 {
+		return errors.New("short draw state")
+	}
+	f.AckCmd = data[0]
+	f.AckFrame = int32(binary.BigEndian.Uint32(data[1:5]))
+	f.ResendFrame = int32(binary.BigEndian.Uint32(data[5:9]))
+	p := 9
+	descCount := int(data[p])
+	p++
+	for i := 0; i < descCount; i++ {
+		if p+4 > len(data) {
+			return errors.New("truncated descriptor")
+		}
+		d := dumpDescriptor{Index: data[p], Type: data[p+1], PictID: binary.BigEndian.Uint16(data[p+2:])}
+		p += 4
+		n := bytes.IndexByte(data[p:], 0)
+		if n < 0 || p+n+1 >= len(data) {
+			return errors.New("truncated descriptor")
+		}
+		d.Name = utfFold(decodeMacRoman(data[p : p+n]))
+		p += n + 1
+		cnt := int(data[p])
+		p++
+		if p+cnt > len(data) {
+			return errors.New("truncated descriptor")
+		}
+		d.Colors = append([]byte(nil), data[p:p+cnt]...)
+		p += cnt
+		f.Descriptors = append(f.Descriptors, d)
+	}
+	if p+8 > len(data) {
+		return errors.New("truncated stats")
+	}
+	f.Stats = &dumpStats{
+		HP: int(data[p]), HPMax: int(data[p+1]),
+		SP: int(data[p+2]), SPMax: int(data[p+3]),
+		Balance: int(data[p+4]), BalanceMax: int(data[p+5]),
+	}
+	f.Lighting = data[p+6]
+	p += 7
+	pictCount := int(data[p])
+	p++
+	if pictCount == 255 {
+		if p+2 > len(data) {
+			return errors.New("truncated picture header")
+		}
+		f.PictAgain = int(data[p])
+		pictCount = int(data[p+1])
+		p += 2
+	}
+	br := bitReader{data: data[p:]}
+	for i := 0; i < pictCount; i++ {
+		id, ok1 := br.readBits(14)
+		h, ok2 := br.readBits(11)
+		v, ok3 := br.readBits(11)
+		if !ok1 || !ok2 || !ok3 {
+			return errors.New("truncated picture bit stream")
+		}
+		f.Pictures = append(f.Pictures, dumpPicture{ID: uint16(id), H: signExtend(h, 11), V: signExtend(v, 11)})
+	}
+	p += (br.bitPos + 7) / 8
+	if p >= len(data) {
+		return errors.New("truncated mobiles")
+	}
+	mobileCount := int(data[p])
+	p++
+	for i := 0; i < mobileCount; i++ {
+		if p+7 > len(data) {
+			return errors.New("truncated mobiles")
+		}
+		m := dumpMobile{
+			Index:  data[p],
+			State:  data[p+1],
+			H:      int16(binary.BigEndian.Uint16(data[p+2:])),
+			V:      int16(binary.BigEndian.Uint16(data[p+4:])),
+			Colors: data[p+6],
+		}
+		m.Name = descs[m.Index].Name
+		f.Mobiles = append(f.Mobiles, m)
+		p += 7
+	}
+	return nil
+}
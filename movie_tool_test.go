@@ -0,0 +1,180 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gothoom/mockserver"
+)
+
+// writeTestMovie records frames after login blocks holding descs.
+func writeTestMovie(t *testing.T, path string, version int, descs map[uint8]frameDescriptor, frames ...mockserver.Frame) {
+	t.Helper()
+	rec, err := newMovieRecorder(path, version, 0)
+	if err != nil {
+		t.Fatalf("newMovieRecorder: %v", err)
+	}
+	if err := rec.writeLoginBlocks("", descs, nil, nil); err != nil {
+		t.Fatalf("writeLoginBlocks: %v", err)
+	}
+	for _, f := range frames {
+		if err := rec.WriteFrame(f.Encode(), 0); err != nil {
+			t.Fatalf("WriteFrame: %v", err)
+		}
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestTrimMovie(t *testing.T) {
+	resetState()
+	initFont()
+	movieMode = true
+	t.Cleanup(func() { movieMode = false })
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.clMov")
+	writeTestMovie(t, in, 1440, map[uint8]frameDescriptor{1: {Index: 1, Name: "Tester", PictID: 100}},
+		mockserver.Frame{AckFrame: 1, Pictures: []mockserver.Picture{{ID: 5, H: 1, V: 2}}},
+		mockserver.Frame{AckFrame: 2,
+			Descriptors: []mockserver.Descriptor{{Index: 2, Name: "Rat", PictID: 200}},
+			Pictures:    []mockserver.Picture{{ID: 6, H: 3, V: 4}},
+			Mobiles:     []mockserver.Mobile{{Index: 2, H: 10, V: 20}}},
+		mockserver.Frame{AckFrame: 3},
+		mockserver.Frame{AckFrame: 4},
+	)
+
+	out := filepath.Join(dir, "out.clMov")
+	if err := trimMovie(in, out, 2, 3); err != nil {
+		t.Fatalf("trimMovie: %v", err)
+	}
+	frames, err := parseMovie(out, clientVersion)
+	if err != nil {
+		t.Fatalf("parseMovie: %v", err)
+	}
+	if len(frames) != 1 || string(frames[0].data) != string(mockserver.Frame{AckFrame: 3}.Encode()) {
+		t.Fatalf("frames = %+v", frames)
+	}
+	// The descriptors, mobile and pictures from the cut frames open the
+	// trimmed movie.
+	mainSession.stateMu.Lock()
+	defer mainSession.stateMu.Unlock()
+	if mainSession.state.descriptors[1].Name != "Tester" || mainSession.state.descriptors[2].Name != "Rat" {
+		t.Fatalf("descriptors = %+v", mainSession.state.descriptors)
+	}
+	if m, ok := mainSession.state.mobiles[2]; !ok || m.H != 10 || m.V != 20 {
+		t.Fatalf("mobiles = %+v", mainSession.state.mobiles)
+	}
+	if len(mainSession.state.pictures) == 0 || mainSession.state.pictures[0].PictID != 6 {
+		t.Fatalf("pictures = %+v", mainSession.state.pictures)
+	}
+
+	if err := trimMovie(in, out, 4, 0); err == nil {
+		t.Fatalf("expected an error for an empty range")
+	}
+}
+
+func TestConcatMovies(t *testing.T) {
+	resetState()
+	movieMode = true
+	t.Cleanup(func() { movieMode = false })
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.clMov")
+	b := filepath.Join(dir, "b.clMov")
+	writeTestMovie(t, a, 1440, map[uint8]frameDescriptor{1: {Index: 1, Name: "Alpha"}},
+		mockserver.Frame{AckFrame: 1}, mockserver.Frame{AckFrame: 2})
+	writeTestMovie(t, b, 1440, map[uint8]frameDescriptor{3: {Index: 3, Name: "Beta"}},
+		mockserver.Frame{AckFrame: 9})
+
+	out := filepath.Join(dir, "ab.clMov")
+	if err := concatMovies(out, []string{a, b}); err != nil {
+		t.Fatalf("concatMovies: %v", err)
+	}
+	frames, err := parseMovie(out, clientVersion)
+	if err != nil {
+		t.Fatalf("parseMovie: %v", err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames, want 3", len(frames))
+	}
+	if frames[0].reset != nil || frames[1].reset != nil {
+		t.Fatalf("first movie's frames carry a reset")
+	}
+	r := frames[2].reset
+	if r == nil || r.descriptors[3].Name != "Beta" {
+		t.Fatalf("second movie's state not attached: %+v", r)
+	}
+	if _, ok := r.descriptors[1]; ok {
+		t.Fatalf("second movie inherited the first one's descriptors")
+	}
+	mainSession.stateMu.Lock()
+	name := mainSession.state.descriptors[1].Name
+	mainSession.stateMu.Unlock()
+	if name != "Alpha" {
+		t.Fatalf("opening state = %q, want the first movie's", name)
+	}
+
+	c := filepath.Join(dir, "c.clMov")
+	writeTestMovie(t, c, 1441, nil, mockserver.Frame{AckFrame: 1})
+	if err := concatMovies(out, []string{a, c}); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Fatalf("mismatched versions: %v", err)
+	}
+}
+
+func TestDumpMovie(t *testing.T) {
+	resetState()
+	initFont()
+	movieMode = true
+	t.Cleanup(func() { movieMode = false })
+	path := filepath.Join(t.TempDir(), "in.clMov")
+	writeTestMovie(t, path, 1440, map[uint8]frameDescriptor{1: {Index: 1, Name: "Tester"}},
+		mockserver.Frame{AckFrame: 7, HP: 10, HPMax: 20,
+			Pictures: []mockserver.Picture{{ID: 5, H: -1, V: 2}},
+			Mobiles:  []mockserver.Mobile{{Index: 1, H: 3, V: 4}},
+			Info:     "The dump says hello."},
+	)
+	d, err := dumpMovie(path)
+	if err != nil {
+		t.Fatalf("dumpMovie: %v", err)
+	}
+	if d.Version != 1440 || len(d.Opening.Descriptors) != 1 || len(d.Frames) != 1 {
+		t.Fatalf("dump = %+v", d)
+	}
+	f := d.Frames[0]
+	if f.Tag != 2 || f.AckFrame != 7 || f.Stats == nil || f.Stats.HP != 10 || f.Stats.HPMax != 20 {
+		t.Fatalf("frame = %+v", f)
+	}
+	if len(f.Pictures) != 1 || f.Pictures[0] != (dumpPicture{ID: 5, H: -1, V: 2}) {
+		t.Fatalf("pictures = %+v", f.Pictures)
+	}
+	if len(f.Mobiles) != 1 || f.Mobiles[0].Name != "Tester" || f.Mobiles[0].H != 3 {
+		t.Fatalf("mobiles = %+v", f.Mobiles)
+	}
+	if len(f.Text) != 1 || f.Text[0].Text != "The dump says hello." {
+		t.Fatalf("text = %+v", f.Text)
+	}
+	if f.Error != "" {
+		t.Fatalf("decode error: %v", f.Error)
+	}
+}
+
+func TestReadMovieLeavesClientState(t *testing.T) {
+	resetState()
+	path := filepath.Join(t.TempDir(), "in.clMov")
+	writeTestMovie(t, path, 1440, map[uint8]frameDescriptor{1: {Index: 1, Name: "Tester"}},
+		mockserver.Frame{AckFrame: 1})
+	m, err := readMovie(path)
+	if err != nil {
+		t.Fatalf("readMovie: %v", err)
+	}
+	if len(m.frames) != 1 || m.opening.descriptors[1].Name != "Tester" {
+		t.Fatalf("movie = %+v", m)
+	}
+	mainSession.stateMu.Lock()
+	n := len(mainSession.state.descriptors)
+	mainSession.stateMu.Unlock()
+	if n != 0 {
+		t.Fatalf("readMovie changed the draw state: %d descriptors", n)
+	}
+}
@@ -11,13 +11,13 @@ import (
 
 func TestParseMusicCommandWithWho(t *testing.T) {
 	// Ensure /music commands with a leading /who segment are parsed.
-	if !parseMusicCommand("/music/who123/play/inst2/notesabc", nil) {
+	if !mainSession.parseMusicCommand("/music/who123/play/inst2/notesabc", nil) {
 		t.Fatalf("parseMusicCommand failed to parse /music with /who prefix")
 	}
 }
 
 func TestParseMusicCommandRawFallback(t *testing.T) {
-	if !parseMusicCommand("", []byte("/music/play/inst1/notesabc")) {
+	if !mainSession.parseMusicCommand("", []byte("/music/play/inst1/notesabc")) {
 		t.Fatalf("parseMusicCommand failed to parse raw payload")
 	}
 }
@@ -66,21 +66,21 @@ func TestParseMusicCommandFromMovie(t *testing.T) {
 	notes = strings.Trim(notes, "/")
 	expected := "/play " + inst + " " + notes
 
-	consoleLog.entries = nil
+	mainSession.console.entries = nil
 	musicDebug = true
 	defer func() { musicDebug = false }()
-	if !parseMusicCommand("", msg) {
+	if !mainSession.parseMusicCommand("", msg) {
 		t.Fatalf("parseMusicCommand failed to parse clMov payload")
 	}
 	found := false
-	for _, m := range consoleLog.entries {
+	for _, m := range mainSession.console.entries {
 		if m.Text == expected {
 			found = true
 			break
 		}
 	}
 	if !found {
-		t.Fatalf("expected %q in console log, got %#v", expected, consoleLog.entries)
+		t.Fatalf("expected %q in console log, got %#v", expected, mainSession.console.entries)
 	}
 }
 
@@ -92,7 +92,7 @@ func TestParseMusicCommandWithMalformedWith(t *testing.T) {
 	for _, cmd := range cases {
 		done := make(chan struct{})
 		go func(c string) {
-			parseMusicCommand(c, nil)
+			mainSession.parseMusicCommand(c, nil)
 			close(done)
 		}(cmd)
 		select {
@@ -1,27 +1,27 @@
 package main
 
 // killNameTagCache clears all cached mobile name tag images.
-func killNameTagCache() {
-	stateMu.Lock()
-	for idx, m := range state.mobiles {
+func (s *session) killNameTagCache() {
+	s.stateMu.Lock()
+	for idx, m := range s.state.mobiles {
 		m.nameTag = nil
 		m.nameTagKey = nameTagKey{}
-		state.mobiles[idx] = m
+		s.state.mobiles[idx] = m
 	}
-	stateMu.Unlock()
+	s.stateMu.Unlock()
 }
 
 // killNameTagCacheFor clears the cached name tag for the mobile with the given name.
-func killNameTagCacheFor(name string) {
-	stateMu.Lock()
-	for idx, d := range state.descriptors {
+func (s *session) killNameTagCacheFor(name string) {
+	s.stateMu.Lock()
+	for idx, d := range s.state.descriptors {
 		if d.Name == name {
-			if m, ok := state.mobiles[idx]; ok {
+			if m, ok := s.state.mobiles[idx]; ok {
 				m.nameTag = nil
 				m.nameTagKey = nameTagKey{}
-				state.mobiles[idx] = m
+				s.state.mobiles[idx] = m
 			}
 		}
 	}
-	stateMu.Unlock()
+	s.stateMu.Unlock()
 }
@@ -9,9 +9,6 @@ import (
 	"time"
 )
 
-// tcpConn is the active TCP connection to the game server.
-var tcpConn net.Conn
-
 // sendClientIdentifiers transmits the client, image and sound versions to the server.
 func sendClientIdentifiers(connection net.Conn, clientVersion, imagesVersion, soundsVersion uint32) error {
 	const kMsgIdentifiers = 19
@@ -126,7 +123,7 @@ func readUDPMessage(connection net.Conn) ([]byte, error) {
 // sendPlayerInput sends the provided mouse state to the server. When
 // reliable is true the packet is written to the TCP connection; otherwise
 // it is sent via UDP.
-func sendPlayerInput(connection net.Conn, mouseX, mouseY int16, mouseDown bool, reliable bool) error {
+func (s *session) sendPlayerInput(connection net.Conn, mouseX, mouseY int16, mouseDown bool, reliable bool) error {
 	const kMsgPlayerInput = 3
 	flags := uint16(0)
 
@@ -134,38 +131,36 @@ func sendPlayerInput(connection net.Conn, mouseX, mouseY int16, mouseDown bool,
 		flags = kPIMDownField
 	}
 
-	nextCommand()
+	s.nextCommand()
 	// Before reading the pending command, give background queues
 	// a chance to schedule maintenance commands.
-	if pendingCommand == "" {
-		if !maybeEnqueueInfo() {
-			_ = maybeEnqueueWho()
+	if !s.commandPending() {
+		if !s.maybeEnqueueInfo() {
+			_ = s.maybeEnqueueWho()
 		}
 	}
-	cmd := pendingCommand
+	cmd := s.takeCommand()
 	cmdBytes := encodeMacRoman(cmd)
 	packet := make([]byte, 20+len(cmdBytes)+1)
 	binary.BigEndian.PutUint16(packet[0:2], kMsgPlayerInput)
 	binary.BigEndian.PutUint16(packet[2:4], uint16(mouseX))
 	binary.BigEndian.PutUint16(packet[4:6], uint16(mouseY))
 	binary.BigEndian.PutUint16(packet[6:8], flags)
-	binary.BigEndian.PutUint32(packet[8:12], uint32(ackFrame))
-	binary.BigEndian.PutUint32(packet[12:16], uint32(resendFrame))
-	packetCommand := commandNum
+	binary.BigEndian.PutUint32(packet[8:12], uint32(s.ackFrame))
+	binary.BigEndian.PutUint32(packet[12:16], uint32(s.resendFrame))
+	packetCommand := s.commandNum
 	binary.BigEndian.PutUint32(packet[16:20], packetCommand)
 	copy(packet[20:], cmdBytes)
 	packet[20+len(cmdBytes)] = 0
 	if cmd != "" {
 		// Record last-command frame for who throttling.
-		whoLastCommandFrame = ackFrame
-		pendingCommand = ""
-		nextCommand()
-	}
-	commandNum++
-	logDebug("player input ack=%d resend=%d cmd=%d mouse=%d,%d flags=%#x", ackFrame, resendFrame, packetCommand, mouseX, mouseY, flags)
-	latencyMu.Lock()
-	lastInputSent = time.Now()
-	latencyMu.Unlock()
+		s.whoLastCommandFrame = s.ackFrame
+	}
+	s.commandNum++
+	logDebug("player input ack=%d resend=%d cmd=%d mouse=%d,%d flags=%#x", s.ackFrame, s.resendFrame, packetCommand, mouseX, mouseY, flags)
+	s.latencyMu.Lock()
+	s.lastInputSent = time.Now()
+	s.latencyMu.Unlock()
 	if reliable {
 		return sendTCPMessage(connection, packet)
 	}
@@ -195,18 +190,18 @@ func readTCPMessage(connection net.Conn) ([]byte, error) {
 // routing it appropriately. Draw state messages (tag 2) are forwarded to
 // handleDrawState after noting a frame. All other messages are decoded and any
 // resulting text is logged to the in-game console.
-func processServerMessage(msg []byte) {
+func (s *session) processServerMessage(msg []byte) {
 	if len(msg) < 2 {
 		return
 	}
 	tag := binary.BigEndian.Uint16(msg[:2])
 	if tag == 2 {
-		noteFrame()
-		handleDrawState(msg, true)
+		s.noteFrame()
+		s.handleDrawState(msg, !headless)
 		return
 	}
-	if txt := decodeMessage(msg); txt != "" {
-		consoleMessage(txt)
+	if txt := s.decodeMessage(msg); txt != "" {
+		s.consoleMessage(txt)
 	} else {
 		logDebug("msg tag %d len %d", tag, len(msg))
 	}
@@ -42,21 +42,21 @@ func extractCommand(t *testing.T, buf *bufConn) uint32 {
 
 func TestSendPlayerInputCommandNumIncrements(t *testing.T) {
 	// Preserve globals used by sendPlayerInput.
-	oldCommandNum := commandNum
-	oldPending := pendingCommand
+	oldCommandNum := mainSession.commandNum
+	oldPending := mainSession.pendingCommand
 	defer func() {
-		commandNum = oldCommandNum
-		pendingCommand = oldPending
+		mainSession.commandNum = oldCommandNum
+		mainSession.pendingCommand = oldPending
 	}()
 
-	commandNum = 1
-	pendingCommand = ""
+	mainSession.commandNum = 1
+	mainSession.pendingCommand = ""
 
 	conn := &bufConn{}
-	if err := sendPlayerInput(conn, 0, 0, false, false); err != nil {
+	if err := mainSession.sendPlayerInput(conn, 0, 0, false, false); err != nil {
 		t.Fatalf("sendPlayerInput: %v", err)
 	}
-	if got, want := commandNum, uint32(2); got != want {
+	if got, want := mainSession.commandNum, uint32(2); got != want {
 		t.Fatalf("commandNum=%d, want %d", got, want)
 	}
 	if cmd := extractCommand(t, conn); cmd != 1 {
@@ -64,10 +64,10 @@ func TestSendPlayerInputCommandNumIncrements(t *testing.T) {
 	}
 
 	conn2 := &bufConn{}
-	if err := sendPlayerInput(conn2, 0, 0, false, false); err != nil {
+	if err := mainSession.sendPlayerInput(conn2, 0, 0, false, false); err != nil {
 		t.Fatalf("sendPlayerInput: %v", err)
 	}
-	if got, want := commandNum, uint32(3); got != want {
+	if got, want := mainSession.commandNum, uint32(3); got != want {
 		t.Fatalf("commandNum=%d, want %d", got, want)
 	}
 	if cmd := extractCommand(t, conn2); cmd != 2 {
@@ -76,21 +76,21 @@ func TestSendPlayerInputCommandNumIncrements(t *testing.T) {
 }
 
 func TestSendPlayerInputCommandNumIncrementsWithCommand(t *testing.T) {
-	oldCommandNum := commandNum
-	oldPending := pendingCommand
+	oldCommandNum := mainSession.commandNum
+	oldPending := mainSession.pendingCommand
 	defer func() {
-		commandNum = oldCommandNum
-		pendingCommand = oldPending
+		mainSession.commandNum = oldCommandNum
+		mainSession.pendingCommand = oldPending
 	}()
 
-	commandNum = 10
-	pendingCommand = "/test"
+	mainSession.commandNum = 10
+	mainSession.pendingCommand = "/test"
 
 	conn := &bufConn{}
-	if err := sendPlayerInput(conn, 0, 0, false, false); err != nil {
+	if err := mainSession.sendPlayerInput(conn, 0, 0, false, false); err != nil {
 		t.Fatalf("sendPlayerInput: %v", err)
 	}
-	if got, want := commandNum, uint32(11); got != want {
+	if got, want := mainSession.commandNum, uint32(11); got != want {
 		t.Fatalf("commandNum=%d, want %d", got, want)
 	}
 	if cmd := extractCommand(t, conn); cmd != 10 {
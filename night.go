@@ -32,8 +32,6 @@ type NightInfo struct {
 	startOfTwilight int
 }
 
-var gNight NightInfo
-
 var (
 	nightImg *ebiten.Image
 )
@@ -49,6 +47,18 @@ var blackImg *ebiten.Image
 
 var nightRE = regexp.MustCompile(`^/nt ([0-9]+) /sa ([-0-9]+) /cl ([01])`)
 
+// command returns the night state as the info-text command parseNightCommand
+// reads.
+func (n *NightInfo) command() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	cloudy := 0
+	if n.Cloudy {
+		cloudy = 1
+	}
+	return fmt.Sprintf("/nt %d /sa %d /cl %d", n.BaseLevel, n.Azimuth, cloudy)
+}
+
 func (n *NightInfo) calcCurLevel() {
 	delta := 0
 	if n.Flags&kLightNoNightMods != 0 {
@@ -84,14 +94,15 @@ func (n *NightInfo) calcCurLevel() {
 	}
 }
 
-func (n *NightInfo) calcRedshift() {
+// calcRedshift updates the twilight tint; frame is the current frame number.
+func (n *NightInfo) calcRedshift(frame int) {
 	const ticksPerGameSecond = 60.0 / 4.09
 	const twilightLength = 30 * 60 * ticksPerGameSecond
 	const maxRedshift = 1.25
 
 	if n.oldAzimuth != n.Azimuth {
 		if (n.oldAzimuth == -2 && n.Azimuth == -1) || (n.oldAzimuth == 179 && n.Azimuth == 180) {
-			n.startOfTwilight = frameCounter
+			n.startOfTwilight = frame
 		} else {
 			n.startOfTwilight = 0
 		}
@@ -103,7 +114,7 @@ func (n *NightInfo) calcRedshift() {
 	}
 
 	if n.startOfTwilight != 0 {
-		shift := float64(frameCounter-n.startOfTwilight) / twilightLength
+		shift := float64(frame-n.startOfTwilight) / twilightLength
 		if shift < 0 {
 			shift = 0
 		} else if shift > 1 {
@@ -119,21 +130,21 @@ func (n *NightInfo) calcRedshift() {
 	}
 }
 
-func (n *NightInfo) SetFlags(f uint) {
+func (n *NightInfo) SetFlags(f uint, frame int) {
 	n.mu.Lock()
 	n.Flags = f
 	n.calcCurLevel()
-	n.calcRedshift()
+	n.calcRedshift(frame)
 	n.mu.Unlock()
 }
 
 // currentNightLevel computes the effective night percentage (0..100) after
 // applying client preferences and server flags.
-func currentNightLevel() int {
-	gNight.mu.Lock()
-	lvl := gNight.Level
-	flags := gNight.Flags
-	gNight.mu.Unlock()
+func (s *session) currentNightLevel() int {
+	s.night.mu.Lock()
+	lvl := s.night.Level
+	flags := s.night.Flags
+	s.night.mu.Unlock()
 	limit := gs.MaxNightLevel
 	if flags&kLightForce100Pct != 0 {
 		limit = 100
@@ -150,44 +161,44 @@ func currentNightLevel() int {
 	return lvl
 }
 
-func parseNightCommand(s string) bool {
-	if m := nightRE.FindStringSubmatch(s); m != nil {
+func (s *session) parseNightCommand(text string) bool {
+	if m := nightRE.FindStringSubmatch(text); m != nil {
 		lvl, _ := strconv.Atoi(m[1])
 		sa, _ := strconv.Atoi(m[2])
 		cloudy := m[3] != "0"
-		gNight.mu.Lock()
-		gNight.BaseLevel = lvl
-		gNight.Level = lvl
-		gNight.Azimuth = sa
-		gNight.Cloudy = cloudy
-		gNight.calcCurLevel()
-		gNight.calcRedshift()
-		gNight.mu.Unlock()
+		s.night.mu.Lock()
+		s.night.BaseLevel = lvl
+		s.night.Level = lvl
+		s.night.Azimuth = sa
+		s.night.Cloudy = cloudy
+		s.night.calcCurLevel()
+		s.night.calcRedshift(s.frameCounter)
+		s.night.mu.Unlock()
 		return true
 	}
 	const prefix = "/nt "
-	if !strings.HasPrefix(s, prefix) {
+	if !strings.HasPrefix(text, prefix) {
 		return false
 	}
-	rest := s[len(prefix):]
+	rest := text[len(prefix):]
 	var nightLevel, shadowLevel, sunAngle, declination int
 	if n, err := fmt.Sscanf(rest, "%d %d %d %d", &nightLevel, &shadowLevel, &sunAngle, &declination); err == nil && n >= 3 {
-		gNight.mu.Lock()
-		gNight.BaseLevel = nightLevel
-		gNight.Level = nightLevel
-		gNight.Azimuth = sunAngle
-		gNight.calcCurLevel()
-		gNight.calcRedshift()
-		gNight.mu.Unlock()
+		s.night.mu.Lock()
+		s.night.BaseLevel = nightLevel
+		s.night.Level = nightLevel
+		s.night.Azimuth = sunAngle
+		s.night.calcCurLevel()
+		s.night.calcRedshift(s.frameCounter)
+		s.night.mu.Unlock()
 		return true
 	}
 	if n, err := fmt.Sscanf(rest, "%d", &nightLevel); err == nil && n == 1 {
-		gNight.mu.Lock()
-		gNight.BaseLevel = nightLevel
-		gNight.Level = nightLevel
-		gNight.calcCurLevel()
-		gNight.calcRedshift()
-		gNight.mu.Unlock()
+		s.night.mu.Lock()
+		s.night.BaseLevel = nightLevel
+		s.night.Level = nightLevel
+		s.night.calcCurLevel()
+		s.night.calcRedshift(s.frameCounter)
+		s.night.mu.Unlock()
 		return true
 	}
 	return false
@@ -210,24 +221,9 @@ func init() {
 }
 
 // drawNightAmbient applies a uniform darkening to the scene based on the
-// current night level. This keeps overall brightness appropriate even without
+// effective night level lvl. This keeps overall brightness appropriate even without
 // the shader path.
-func drawNightAmbient(screen *ebiten.Image, ox, oy int) {
-	gNight.mu.Lock()
-	lvl := gNight.Level
-	flags := gNight.Flags
-	gNight.mu.Unlock()
-
-	limit := gs.MaxNightLevel
-	if flags&kLightForce100Pct != 0 {
-		limit = 100
-	}
-	if gs.ForceNightLevel >= 0 {
-		lvl = gs.ForceNightLevel
-	}
-	if lvl > limit {
-		lvl = limit
-	}
+func drawNightAmbient(screen *ebiten.Image, ox, oy, lvl int) {
 	if lvl <= 0 {
 		return
 	}
@@ -248,22 +244,7 @@ func drawNightAmbient(screen *ebiten.Image, ox, oy int) {
 	screen.DrawImage(blackImg, op)
 }
 
-func drawNightOverlay(screen *ebiten.Image, ox, oy int) {
-	gNight.mu.Lock()
-	lvl := gNight.Level
-	flags := gNight.Flags
-	gNight.mu.Unlock()
-
-	limit := gs.MaxNightLevel
-	if flags&kLightForce100Pct != 0 {
-		limit = 100
-	}
-	if gs.ForceNightLevel >= 0 {
-		lvl = gs.ForceNightLevel
-	}
-	if lvl > limit {
-		lvl = limit
-	}
+func drawNightOverlay(screen *ebiten.Image, ox, oy, lvl int) {
 	if lvl <= 0 {
 		return
 	}
@@ -15,6 +15,13 @@ type notification struct {
 
 var notifications []*notification
 
+// notify shows msg for s when it is in the game window.
+func (s *session) notify(msg string) {
+	if s.isFocused() {
+		showNotification(msg)
+	}
+}
+
 // showNotification displays msg in the Clan Lord window if notifications are
 // enabled. Messages disappear after a timeout or when clicked.
 func showNotification(msg string) {
@@ -4,8 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"fmt"
 	"io"
+	"log"
+	"net"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/google/gopacket"
@@ -14,6 +18,13 @@ import (
 	"github.com/google/gopacket/tcpassembly"
 )
 
+// pcapMessage is one length-prefixed message found in a capture.
+type pcapMessage struct {
+	time       time.Time
+	data       []byte
+	fromServer bool
+}
+
 func replayPCAP(ctx context.Context, path string) error {
 	// Ebiten must be running before ReadPixels is invoked, so wait for the game
 	// to start before opening the PCAP. Propagate context cancellation so that
@@ -24,6 +35,47 @@ func replayPCAP(ctx context.Context, path string) error {
 		return ctx.Err()
 	}
 
+	var (
+		prevTS  time.Time
+		matched int
+	)
+	err := readPCAP(ctx, path, pcapPort, func(m pcapMessage) {
+		if !m.fromServer {
+			return
+		}
+		matched++
+		if !prevTS.IsZero() {
+			if d := m.time.Sub(prevTS); d > 0 {
+				time.Sleep(d)
+			}
+		}
+		prevTS = m.time
+		dispatchMessage(m.data)
+	})
+	if err == nil && matched == 0 {
+		msg := fmt.Sprintf("replay PCAP: no server messages found in %s (server port %d)", path, pcapPort)
+		log.Print(msg)
+		consoleMessage(msg)
+	}
+	return err
+}
+
+// pcapServerPort is the port of the -host server, which captures are
+// assumed to have been made against.
+func pcapServerPort() int {
+	_, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return 0
+	}
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+// readPCAP calls fn with each message in the .pcap/.pcapng capture at path,
+// in capture order. TCP connections captured from their handshake take
+// their direction from it: the side that sent the SYN-ACK is the server.
+// Otherwise messages sent from serverPort are marked fromServer.
+func readPCAP(ctx context.Context, path string, serverPort int, fn func(pcapMessage)) error {
 	f, err := os.Open(path)
 	if err != nil {
 		return err
@@ -46,12 +98,10 @@ func replayPCAP(ctx context.Context, path string) error {
 		source = gopacket.NewPacketSource(r, r.LinkType())
 	}
 
-	factory := &pcapStreamFactory{}
+	factory := &pcapStreamFactory{port: serverPort, fn: fn, servers: map[pcapEndpoint]bool{}}
 	pool := tcpassembly.NewStreamPool(factory)
 	assembler := tcpassembly.NewAssembler(pool)
 
-	var prevTS time.Time
-
 	for {
 		select {
 		case <-ctx.Done():
@@ -68,14 +118,8 @@ func replayPCAP(ctx context.Context, path string) error {
 		}
 
 		ts := pkt.Metadata().CaptureInfo.Timestamp
-		if !prevTS.IsZero() {
-			if d := ts.Sub(prevTS); d > 0 {
-				time.Sleep(d)
-			}
-		}
-
-		net := pkt.NetworkLayer()
-		if net == nil {
+		netLayer := pkt.NetworkLayer()
+		if netLayer == nil {
 			continue
 		}
 		transport := pkt.TransportLayer()
@@ -84,44 +128,97 @@ func replayPCAP(ctx context.Context, path string) error {
 		}
 		switch t := transport.(type) {
 		case *layers.UDP:
-			handlePayload(t.Payload)
+			if msg, ok := unframePayload(t.Payload); ok {
+				fn(pcapMessage{time: ts, data: msg, fromServer: int(t.SrcPort) == serverPort})
+			}
 		case *layers.TCP:
-			assembler.AssembleWithTimestamp(net.NetworkFlow(), t, ts)
+			if t.SYN {
+				nf, tf := netLayer.NetworkFlow(), t.TransportFlow()
+				if t.ACK {
+					factory.servers[pcapEndpoint{nf.Src(), tf.Src()}] = true
+				} else {
+					factory.servers[pcapEndpoint{nf.Dst(), tf.Dst()}] = true
+				}
+			}
+			assembler.AssembleWithTimestamp(netLayer.NetworkFlow(), t, ts)
 		}
-
-		prevTS = ts
 	}
 	assembler.FlushAll()
 	return nil
 }
 
-func handlePayload(p []byte) {
+// unframePayload returns the message inside a length-prefixed UDP payload.
+func unframePayload(p []byte) ([]byte, bool) {
 	if len(p) < 2 {
-		return
+		return nil, false
 	}
 	sz := int(binary.BigEndian.Uint16(p[:2]))
 	if len(p) < 2+sz {
-		return
+		return nil, false
 	}
-	msg := p[2 : 2+sz]
-	dispatchMessage(msg)
+	return p[2 : 2+sz], true
 }
 
-type pcapStreamFactory struct{}
+// pcapEndpoint is one side of a TCP connection.
+type pcapEndpoint struct {
+	addr, port gopacket.Endpoint
+}
 
-func (f *pcapStreamFactory) New(net, transport gopacket.Flow) tcpassembly.Stream {
-	return &pcapStream{}
+type pcapStreamFactory struct {
+	port int
+	fn   func(pcapMessage)
+	// servers holds the endpoints seen answering a handshake.
+	servers map[pcapEndpoint]bool
+}
+
+func (f *pcapStreamFactory) New(network, transport gopacket.Flow) tcpassembly.Stream {
+	s := &pcapStream{fn: f.fn}
+	switch {
+	case f.servers[pcapEndpoint{network.Src(), transport.Src()}]:
+		s.fromServer = true
+		s.handshake = true
+	case f.servers[pcapEndpoint{network.Dst(), transport.Dst()}]:
+		s.handshake = true
+	default:
+		if src := transport.Src().Raw(); len(src) == 2 && int(binary.BigEndian.Uint16(src)) == f.port {
+			s.fromServer = true
+		}
+	}
+	return s
 }
 
 type pcapStream struct {
-	buf bytes.Buffer
+	buf        bytes.Buffer
+	fn         func(pcapMessage)
+	fromServer bool
+	// handshake is set when the capture saw the connection open, so
+	// fromServer came from the SYN-ACK rather than the port.
+	handshake bool
+	started   bool
+	// preface counts handshake bytes still to skip: a connection captured
+	// from its SYN starts with the server's 4 byte connection ID and 2 byte
+	// confirmation, which are not length-prefixed.
+	preface int
 }
 
 func (s *pcapStream) Reassembled(rs []tcpassembly.Reassembly) {
+	var ts time.Time
 	for _, r := range rs {
+		if !s.started {
+			s.started = true
+			if r.Start && s.handshake && s.fromServer {
+				s.preface = 6
+			}
+		}
 		if len(r.Bytes) > 0 {
 			s.buf.Write(r.Bytes)
 		}
+		ts = r.Seen
+	}
+	if s.preface > 0 {
+		n := min(s.preface, s.buf.Len())
+		s.buf.Next(n)
+		s.preface -= n
 	}
 	for {
 		b := s.buf.Bytes()
@@ -133,7 +230,7 @@ func (s *pcapStream) Reassembled(rs []tcpassembly.Reassembly) {
 			return
 		}
 		msg := append([]byte(nil), b[2:2+l]...)
-		dispatchMessage(msg)
+		s.fn(pcapMessage{time: ts, data: msg, fromServer: s.fromServer})
 		s.buf.Next(2 + l)
 	}
 }
@@ -141,5 +238,91 @@ func (s *pcapStream) Reassembled(rs []tcpassembly.Reassembly) {
 func (s *pcapStream) ReassemblyComplete() {}
 
 func dispatchMessage(msg []byte) {
-	processServerMessage(msg)
+	mainSession.processServerMessage(msg)
+}
+
+// convertPCAP writes the server side of a captured session to a .clMov at
+// out and returns the number of frames written. The opening login blocks
+// are synthesized from the capture's first draw states: everything up to
+// the first frame that sends its full picture list is folded into the
+// opening state, and recording starts at that frame.
+func convertPCAP(in, out string, serverPort int) (int, error) {
+	var (
+		msgs    [][]byte
+		start   time.Time
+		version = clientVersion
+	)
+	err := readPCAP(context.Background(), in, serverPort, func(m pcapMessage) {
+		if len(m.data) < 2 {
+			return
+		}
+		tag := binary.BigEndian.Uint16(m.data[:2])
+		if !m.fromServer {
+			// The client's kMsgLogOn carries the version it logged in with.
+			if tag == 13 && len(m.data) >= 8 {
+				version = int(binary.BigEndian.Uint32(m.data[4:8]) >> 8)
+			}
+			return
+		}
+		switch tag {
+		case 13, 18: // login reply and challenge
+			return
+		}
+		if start.IsZero() {
+			start = m.time
+		}
+		msgs = append(msgs, m.data)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	first := -1
+	for i, m := range msgs {
+		if binary.BigEndian.Uint16(m[:2]) != 2 {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		var f dumpFrame
+		if decodeDrawStateDump(m[2:], nil, &f) == nil && f.PictAgain == 0 {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return 0, fmt.Errorf("%v: no draw states from port %d", in, serverPort)
+	}
+
+	s := mainSession
+	s.resetDrawState()
+	for _, m := range msgs[:first+1] {
+		if binary.BigEndian.Uint16(m[:2]) == 2 {
+			s.handleDrawState(m, false)
+		}
+	}
+	s.stateMu.Lock()
+	open := cloneDrawState(s.state)
+	s.stateMu.Unlock()
+
+	rec, err := newMovieRecorder(out, version, 0)
+	if err != nil {
+		return 0, err
+	}
+	if !start.IsZero() {
+		rec.head.StartTime = uint32(start.Unix() + macEpochDelta)
+	}
+	err = rec.writeLoginBlocks(s.night.command(), open.descriptors, open.mobiles, open.pictures)
+	for _, m := range msgs[first:] {
+		if err != nil {
+			break
+		}
+		err = rec.WriteFrame(m, 0)
+	}
+	if err != nil {
+		rec.Close()
+		return 0, err
+	}
+	return len(msgs) - first, rec.Close()
 }
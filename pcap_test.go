@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"gothoom/mockserver"
+)
+
+func TestConvertPCAP(t *testing.T) {
+	resetState()
+	initFont()
+	movieMode = true
+	t.Cleanup(func() { movieMode = false })
+	dir := t.TempDir()
+	in := filepath.Join(dir, "cap.pcap")
+	logon := make([]byte, 16)
+	binary.BigEndian.PutUint16(logon, mockserver.MsgLogOn)
+	binary.BigEndian.PutUint32(logon[4:], 1441<<8)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	full := mockserver.Frame{AckFrame: 2, Pictures: []mockserver.Picture{{ID: 7, H: 1, V: 2}}}.Encode()
+	next := mockserver.Frame{AckFrame: 3, PictAgain: 1}.Encode()
+	err := mockserver.WritePCAP(in, 5010, []mockserver.Packet{
+		{Time: start, Msg: logon},
+		// Captured mid-session: this frame only adds to pictures the
+		// capture never saw.
+		{Time: start, FromServer: true, Msg: mockserver.Frame{AckFrame: 1, PictAgain: 3,
+			Descriptors: []mockserver.Descriptor{{Index: 1, Name: "Early", PictID: 100}}}.Encode()},
+		{Time: start.Add(200 * time.Millisecond), FromServer: true, Msg: full},
+		{Time: start.Add(400 * time.Millisecond), FromServer: true, Msg: next},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "out.clMov")
+	n, err := convertPCAP(in, out, 5010)
+	if err != nil {
+		t.Fatalf("convertPCAP: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("wrote %d frames, want 2", n)
+	}
+	info, err := readMovieFileInfo(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.version != 1441 {
+		t.Fatalf("version = %d, want the client's 1441", info.version)
+	}
+	frames, err := parseMovie(out, clientVersion)
+	if err != nil {
+		t.Fatalf("parseMovie: %v", err)
+	}
+	if len(frames) != 2 || string(frames[0].data) != string(full) || string(frames[1].data) != string(next) {
+		t.Fatalf("frames = %+v", frames)
+	}
+	mainSession.stateMu.Lock()
+	defer mainSession.stateMu.Unlock()
+	if mainSession.state.descriptors[1].Name != "Early" {
+		t.Fatalf("descriptors = %+v", mainSession.state.descriptors)
+	}
+	if len(mainSession.state.pictures) != 1 || mainSession.state.pictures[0].PictID != 7 {
+		t.Fatalf("pictures = %+v", mainSession.state.pictures)
+	}
+
+	if _, err := convertPCAP(in, out, 6000); err == nil {
+		t.Fatalf("expected an error without draw states from the port")
+	}
+}
+
+type tcpSegment struct {
+	fromServer bool
+	syn, ack   bool
+	seq        uint32
+	payload    []byte
+}
+
+// writeTCPPCAP writes segs as one TCP connection between a client on port
+// 40000 and a server on port 5010.
+func writeTCPPCAP(t *testing.T, path string, segs []tcpSegment) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := pcapgo.NewWriter(f)
+	if err := w.WriteFileHeader(65535, layers.LinkTypeEthernet); err != nil {
+		t.Fatal(err)
+	}
+	clientIP, serverIP := net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, sg := range segs {
+		ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: clientIP, DstIP: serverIP}
+		tcp := &layers.TCP{SrcPort: 40000, DstPort: 5010, Seq: sg.seq, SYN: sg.syn, ACK: sg.ack, PSH: len(sg.payload) > 0, Window: 65535}
+		if sg.fromServer {
+			ip.SrcIP, ip.DstIP = serverIP, clientIP
+			tcp.SrcPort, tcp.DstPort = 5010, 40000
+		}
+		tcp.SetNetworkLayerForChecksum(ip)
+		eth := &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 0, 0, 0, 0, 1}, DstMAC: net.HardwareAddr{0, 0, 0, 0, 0, 2}, EthernetType: layers.EthernetTypeIPv4}
+		buf := gopacket.NewSerializeBuffer()
+		opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+		if err := gopacket.SerializeLayers(buf, opts, eth, ip, tcp, gopacket.Payload(sg.payload)); err != nil {
+			t.Fatal(err)
+		}
+		ts = ts.Add(10 * time.Millisecond)
+		ci := gopacket.CaptureInfo{Timestamp: ts, CaptureLength: len(buf.Bytes()), Length: len(buf.Bytes())}
+		if err := w.WritePacket(ci, buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadPCAPTCPDirectionFromHandshake(t *testing.T) {
+	frame := func(m []byte) []byte {
+		return append(binary.BigEndian.AppendUint16(nil, uint16(len(m))), m...)
+	}
+	fromServer := []byte{0, 2, 'd', 's'}
+	fromClient := []byte{0, 3, 'i', 'n'}
+	path := filepath.Join(t.TempDir(), "tcp.pcap")
+	writeTCPPCAP(t, path, []tcpSegment{
+		{syn: true, seq: 100},
+		{fromServer: true, syn: true, ack: true, seq: 500},
+		{ack: true, seq: 101, payload: frame(fromClient)},
+		// Connection ID and confirmation, then the first message.
+		{fromServer: true, ack: true, seq: 501, payload: append([]byte{0, 0, 0, 42, 0, 1}, frame(fromServer)...)},
+	})
+
+	// The handshake decides direction whatever port is configured.
+	for _, port := range []int{0, 5010, 6000} {
+		var got []pcapMessage
+		if err := readPCAP(context.Background(), path, port, func(m pcapMessage) {
+			got = append(got, m)
+		}); err != nil {
+			t.Fatalf("port %d: %v", port, err)
+		}
+		if len(got) != 2 {
+			t.Fatalf("port %d: got %d messages: %+v", port, len(got), got)
+		}
+		for _, m := range got {
+			want := fromClient
+			if m.fromServer {
+				want = fromServer
+			}
+			if string(m.data) != string(want) {
+				t.Errorf("port %d: fromServer=%v message = %v, want %v", port, m.fromServer, m.data, want)
+			}
+		}
+		if got[0].fromServer == got[1].fromServer {
+			t.Errorf("port %d: both streams have fromServer=%v", port, got[0].fromServer)
+		}
+	}
+}
@@ -44,40 +44,38 @@ type playerHandler struct {
 }
 
 var (
-	players              = make(map[string]*Player)
-	playersMu            sync.RWMutex
 	playerHandlers       []func(Player)
 	playerHandlersMu     sync.RWMutex
 	pluginPlayerHandlers []playerHandler
 )
 
-func getPlayer(name string) *Player {
-	playersMu.RLock()
-	p, ok := players[name]
-	playersMu.RUnlock()
+func (s *session) getPlayer(name string) *Player {
+	s.playersMu.RLock()
+	p, ok := s.players[name]
+	s.playersMu.RUnlock()
 	if ok {
 		return p
 	}
-	playersMu.Lock()
-	defer playersMu.Unlock()
-	if p, ok = players[name]; ok {
+	s.playersMu.Lock()
+	defer s.playersMu.Unlock()
+	if p, ok = s.players[name]; ok {
 		return p
 	}
 	p = &Player{Name: name}
-	players[name] = p
+	s.players[name] = p
 	playersDirty = true
 	return p
 }
 
-func updatePlayerAppearance(name string, pictID uint16, colors []byte, isNPC bool) {
+func (s *session) updatePlayerAppearance(name string, pictID uint16, colors []byte, isNPC bool) {
 	if isNPC {
 		return
 	}
-	playersMu.Lock()
-	p, ok := players[name]
+	s.playersMu.Lock()
+	p, ok := s.players[name]
 	if !ok {
 		p = &Player{Name: name}
-		players[name] = p
+		s.players[name] = p
 	}
 	p.PictID = pictID
 	if len(colors) > 0 {
@@ -90,21 +88,21 @@ func updatePlayerAppearance(name string, pictID uint16, colors []byte, isNPC boo
 	bwChanged := !p.BeWho
 	p.BeWho = true
 	prevSC := p.SameClan
-	if me, ok := players[playerName]; ok {
+	if me, ok := s.players[s.playerName]; ok {
 		p.SameClan = me.Clan != "" && p.Clan != "" && strings.EqualFold(p.Clan, me.Clan)
 	}
 	playerCopy := *p
-	playersMu.Unlock()
+	s.playersMu.Unlock()
 	playersDirty = true
 	if bwChanged || prevSC != p.SameClan {
 		playersPersistDirty = true
 	}
 	if prevSC != p.SameClan {
-		killNameTagCacheFor(name)
+		s.killNameTagCacheFor(name)
 	}
-	notifyPlayerHandlers(playerCopy)
+	s.notifyPlayerHandlers(playerCopy)
 
-	if playerName != "" && strings.EqualFold(name, playerName) {
+	if s.playerName != "" && strings.EqualFold(name, s.playerName) {
 		changed := false
 		for i := range characters {
 			if strings.EqualFold(characters[i].Name, name) {
@@ -125,25 +123,41 @@ func updatePlayerAppearance(name string, pictID uint16, colors []byte, isNPC boo
 	}
 }
 
-func getPlayers() []Player {
-	playersMu.RLock()
-	defer playersMu.RUnlock()
-	out := make([]Player, 0, len(players))
-	for _, p := range players {
+func (s *session) getPlayers() []Player {
+	s.playersMu.RLock()
+	defer s.playersMu.RUnlock()
+	out := make([]Player, 0, len(s.players))
+	for _, p := range s.players {
 		out = append(out, *p)
 	}
 	return out
 }
 
-func notifyPlayerHandlers(p Player) {
+func (s *session) notifyPlayerHandlers(p Player) {
 	playerHandlersMu.RLock()
 	handlers := make([]func(Player), 0, len(playerHandlers)+len(pluginPlayerHandlers))
 	handlers = append(handlers, playerHandlers...)
-	for _, h := range pluginPlayerHandlers {
-		handlers = append(handlers, h.fn)
+	if s.isFocused() {
+		for _, h := range pluginPlayerHandlers {
+			handlers = append(handlers, h.fn)
+		}
 	}
 	playerHandlersMu.RUnlock()
 	for _, fn := range handlers {
 		go fn(p)
 	}
 }
+
+// copyPlayers returns a deep copy of the player list so another session
+// can start from what this one already knows.
+func (s *session) copyPlayers() map[string]*Player {
+	s.playersMu.RLock()
+	defer s.playersMu.RUnlock()
+	out := make(map[string]*Player, len(s.players))
+	for k, p := range s.players {
+		cp := *p
+		cp.Colors = append([]byte(nil), p.Colors...)
+		out[k] = &cp
+	}
+	return out
+}
@@ -42,7 +42,7 @@ var (
 	playersPersistDirty bool
 )
 
-func loadPlayersPersist() {
+func (s *session) loadPlayersPersist() {
 	path := filepath.Join(dataDirPath, PlayersFile)
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -66,8 +66,8 @@ func loadPlayersPersist() {
 			continue
 		}
 		last := time.Unix(p.LastSeen, 0)
-		pr := getPlayer(p.Name)
-		playersMu.Lock()
+		pr := s.getPlayer(p.Name)
+		s.playersMu.Lock()
 		pr.Gender = p.Gender
 		pr.Class = p.Class
 		pr.Clan = p.Clan
@@ -101,18 +101,18 @@ func loadPlayersPersist() {
 		if pr.LastSeen.IsZero() && p.LastSeen > 0 {
 			pr.LastSeen = last
 		}
-		playersMu.Unlock()
+		s.playersMu.Unlock()
 	}
 	playersDirty = true
 }
 
-func savePlayersPersist() {
+func (s *session) savePlayersPersist() {
 	// Ensure data directory exists
 	_ = os.MkdirAll(dataDirPath, 0o755)
-	playersMu.RLock()
-	list := make([]persistPlayer, 0, len(players))
-	names := make([]string, 0, len(players))
-	for name, p := range players {
+	s.playersMu.RLock()
+	list := make([]persistPlayer, 0, len(s.players))
+	names := make([]string, 0, len(s.players))
+	for name, p := range s.players {
 		if p == nil || p.IsNPC || name == "" {
 			continue
 		}
@@ -120,7 +120,7 @@ func savePlayersPersist() {
 	}
 	sort.Strings(names)
 	for _, name := range names {
-		p := players[name]
+		p := s.players[name]
 		if p == nil {
 			continue
 		}
@@ -170,7 +170,7 @@ func savePlayersPersist() {
 			LastSeen:    lastSeen,
 		})
 	}
-	playersMu.RUnlock()
+	s.playersMu.RUnlock()
 
 	pp := persistPlayers{Players: list, LabelNames: labelNames}
 	data, err := json.MarshalIndent(pp, "", "  ")
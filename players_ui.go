@@ -45,7 +45,8 @@ func updatePlayersWindow() {
 	}
 
 	// Gather current players and filter to non-NPCs with names.
-	ps := getPlayers()
+	sess := focusedSession()
+	ps := sess.getPlayers()
 	// Sort: online (recently seen and not explicitly offline) first, by name; offline last, by name.
 	sort.Slice(ps, func(i, j int) bool {
 		staleI := time.Since(ps[i].LastSeen) > 5*time.Minute
@@ -78,12 +79,12 @@ func updatePlayersWindow() {
 	}
 
 	myClan := ""
-	if playerName != "" {
-		playersMu.RLock()
-		if me, ok := players[playerName]; ok {
+	if sess.playerName != "" {
+		sess.playersMu.RLock()
+		if me, ok := sess.players[sess.playerName]; ok {
 			myClan = me.Clan
 		}
-		playersMu.RUnlock()
+		sess.playersMu.RUnlock()
 	}
 
 	// Compute client area for sizing children similar to updateTextWindow.
@@ -204,7 +205,7 @@ func updatePlayersWindow() {
 			avItem.Disabled = offline
 			var img *ebiten.Image
 			state := uint8(0)
-			if p.Dead && !strings.EqualFold(p.Name, playerName) {
+			if p.Dead && !strings.EqualFold(p.Name, sess.playerName) {
 				state = 32
 			}
 			if p.PictID != 0 {
@@ -246,7 +247,7 @@ func updatePlayersWindow() {
 			face = mainFontItalic
 		}
 		t.Face = face
-		if (p.Dead && !strings.EqualFold(p.Name, playerName)) || offline {
+		if (p.Dead && !strings.EqualFold(p.Name, sess.playerName)) || offline {
 			t.TextColor = eui.ColorVeryDarkGray
 			t.ForceTextColor = true
 		}
@@ -407,6 +408,12 @@ func openPlayersContextMenu(name string, pos eui.Point) {
 		})
 	}
 
+	if displayName != "" {
+		options = append(options, "History")
+		n := displayName
+		actions = append(actions, func() { showPlayerHistory(n) })
+	}
+
 	if displayName != "" {
 		options = append(options, "Label")
 		n := displayName
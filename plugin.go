@@ -9,7 +9,8 @@ import (
 	"path/filepath"
 	"reflect"
 	"regexp"
-	"runtime"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -45,6 +46,17 @@ var basePluginExports = interp.Exports{
 		"LastClick":        reflect.ValueOf(pluginLastClick),
 		"ClickInfo":        reflect.ValueOf((*ClickInfo)(nil)),
 		"Mobile":           reflect.ValueOf((*Mobile)(nil)),
+		"Mobiles":          reflect.ValueOf(pluginMobiles),
+		"MobileByName":     reflect.ValueOf(pluginMobileByName),
+		"Picture":          reflect.ValueOf((*Picture)(nil)),
+		"Pictures":         reflect.ValueOf(pluginPictures),
+		"SelfPosition":     reflect.ValueOf(pluginSelfPosition),
+		"OverlayPos":       reflect.ValueOf((*OverlayPos)(nil)),
+		"Color":            reflect.ValueOf((*Color)(nil)),
+		"RGBA":             reflect.ValueOf(pluginRGBA),
+		"WorldPos":         reflect.ValueOf(pluginWorldPos),
+		"ScreenPos":        reflect.ValueOf(pluginScreenPos),
+		"MobilePos":        reflect.ValueOf(pluginMobilePos),
 		"EquippedItems":    reflect.ValueOf(pluginEquippedItems),
 		"HasItem":          reflect.ValueOf(pluginHasItem),
 		"FrameNumber":      reflect.ValueOf(pluginFrameNumber),
@@ -61,6 +73,21 @@ var basePluginExports = interp.Exports{
 		"Join":             reflect.ValueOf(pluginJoin),
 		"Replace":          reflect.ValueOf(pluginReplace),
 		"Split":            reflect.ValueOf(pluginSplit),
+		"Event":            reflect.ValueOf((*Event)(nil)),
+		"FallenEvent":      reflect.ValueOf((*FallenEvent)(nil)),
+		"ShareEvent":       reflect.ValueOf((*ShareEvent)(nil)),
+		"WhoEvent":         reflect.ValueOf((*WhoEvent)(nil)),
+		"PresenceEvent":    reflect.ValueOf((*PresenceEvent)(nil)),
+		"KarmaEvent":       reflect.ValueOf((*KarmaEvent)(nil)),
+		"MusicEvent":       reflect.ValueOf((*MusicEvent)(nil)),
+		"InventoryEvent":   reflect.ValueOf((*InventoryEvent)(nil)),
+		"EventFallen":      reflect.ValueOf(EventFallen),
+		"EventShare":       reflect.ValueOf(EventShare),
+		"EventWho":         reflect.ValueOf(EventWho),
+		"EventPresence":    reflect.ValueOf(EventPresence),
+		"EventKarma":       reflect.ValueOf(EventKarma),
+		"EventMusic":       reflect.ValueOf(EventMusic),
+		"EventInventory":   reflect.ValueOf(EventInventory),
 	},
 }
 
@@ -73,6 +100,7 @@ func exportsForPlugin(owner string) interp.Exports {
 		}
 		m["Equip"] = reflect.ValueOf(func(id uint16) { pluginEquip(owner, id) })
 		m["Unequip"] = reflect.ValueOf(func(id uint16) { pluginUnequip(owner, id) })
+		m["ToggleEquip"] = reflect.ValueOf(func(id uint16) { pluginToggleEquip(owner, id) })
 		m["AddHotkey"] = reflect.ValueOf(func(combo, command string) { pluginAddHotkey(owner, combo, command) })
 		m["RemoveHotkey"] = reflect.ValueOf(func(combo string) { pluginRemoveHotkey(owner, combo) })
 		m["RegisterCommand"] = reflect.ValueOf(func(name string, handler PluginCommandHandler) {
@@ -80,6 +108,7 @@ func exportsForPlugin(owner string) interp.Exports {
 		})
 		m["AddMacro"] = reflect.ValueOf(func(short, full string) { pluginAddMacro(owner, short, full) })
 		m["AddMacros"] = reflect.ValueOf(func(macros map[string]string) { pluginAddMacros(owner, macros) })
+		m["AutoReply"] = reflect.ValueOf(func(trigger, command string) { pluginAutoReply(owner, trigger, command) })
 		m["RegisterTriggers"] = reflect.ValueOf(func(name string, phrases []string, handler func()) {
 			pluginRegisterTriggers(owner, name, phrases, handler)
 		})
@@ -95,6 +124,29 @@ func exportsForPlugin(owner string) interp.Exports {
 		m["StorageGet"] = reflect.ValueOf(func(key string) any { return pluginStorageGet(owner, key) })
 		m["StorageSet"] = reflect.ValueOf(func(key string, value any) { pluginStorageSet(owner, key, value) })
 		m["StorageDelete"] = reflect.ValueOf(func(key string) { pluginStorageDelete(owner, key) })
+		m["On"] = reflect.ValueOf(func(event string, fn func(Event)) { pluginOn(owner, event, fn) })
+		m["DrawText"] = reflect.ValueOf(func(pos OverlayPos, text string, c Color) { pluginDrawText(owner, pos, text, c) })
+		m["DrawRect"] = reflect.ValueOf(func(pos OverlayPos, w, h int, c Color, filled bool) { pluginDrawRect(owner, pos, w, h, c, filled) })
+		m["DrawLine"] = reflect.ValueOf(func(from, to OverlayPos, c Color) { pluginDrawLine(owner, from, to, c) })
+		m["DrawImage"] = reflect.ValueOf(func(pictID uint16, pos OverlayPos) { pluginDrawImage(owner, pictID, pos) })
+		m["ClearOverlay"] = reflect.ValueOf(func() { pluginClearOverlay(owner) })
+		m["NewWindow"] = reflect.ValueOf(func(title string) int { return pluginNewWindow(owner, title) })
+		m["ShowWindow"] = reflect.ValueOf(func(win int) { pluginShowWindow(owner, win) })
+		m["CloseWindow"] = reflect.ValueOf(func(win int) { pluginCloseWindow(owner, win) })
+		m["AddText"] = reflect.ValueOf(func(win int, text string) int { return pluginAddText(owner, win, text) })
+		m["AddButton"] = reflect.ValueOf(func(win int, text string, fn func()) int { return pluginAddButton(owner, win, text, fn) })
+		m["AddSlider"] = reflect.ValueOf(func(win int, label string, min, max, value float64, fn func(float64)) int {
+			return pluginAddSlider(owner, win, label, min, max, value, fn)
+		})
+		m["AddInput"] = reflect.ValueOf(func(win int, label, value string, fn func(string)) int {
+			return pluginAddInput(owner, win, label, value, fn)
+		})
+		m["SetText"] = reflect.ValueOf(func(item int, text string) { pluginSetText(owner, item, text) })
+		m["After"] = reflect.ValueOf(func(d time.Duration, fn func()) int { return pluginAfter(owner, d, fn) })
+		m["Every"] = reflect.ValueOf(func(d time.Duration, fn func()) int { return pluginEvery(owner, d, fn) })
+		m["OnFrame"] = reflect.ValueOf(func(fn func()) int { return pluginOnFrame(owner, fn) })
+		m["Cancel"] = reflect.ValueOf(func(id int) { pluginCancel(owner, id) })
+		filterPluginExports(owner, m)
 		ex[pkg] = m
 	}
 	return ex
@@ -206,19 +258,68 @@ var pluginAllowedPkgs = []string{
 	"unicode/utf8/utf8",
 }
 
-const pluginGoroutineLimit = 256
+// pluginOwnerGoroutineLimit caps the goroutines running one plugin's
+// callbacks at once.
+const pluginOwnerGoroutineLimit = 64
+
+// Goroutines the client starts to run plugin code (timer, event, trigger and
+// UI callbacks) are counted per plugin so the watchdog knows whose they are.
+// Goroutines a plugin starts itself cannot be told apart.
+var (
+	pluginGoroutinesMu sync.Mutex
+	pluginGoroutines   = map[string]int{}
+)
+
+// pluginGo runs fn on a new goroutine counted against owner.
+func pluginGo(owner string, fn func()) {
+	pluginGoroutinesMu.Lock()
+	pluginGoroutines[owner]++
+	pluginGoroutinesMu.Unlock()
+	go func() {
+		defer func() {
+			pluginGoroutinesMu.Lock()
+			if pluginGoroutines[owner]--; pluginGoroutines[owner] <= 0 {
+				delete(pluginGoroutines, owner)
+			}
+			pluginGoroutinesMu.Unlock()
+		}()
+		fn()
+	}()
+}
+
+// pluginGoroutineHogs returns the enabled plugins with more than limit
+// callbacks running, in name order.
+func pluginGoroutineHogs(limit int) []string {
+	pluginGoroutinesMu.Lock()
+	var hogs []string
+	for owner, n := range pluginGoroutines {
+		if n > limit {
+			hogs = append(hogs, owner)
+		}
+	}
+	pluginGoroutinesMu.Unlock()
+	hogs = slices.DeleteFunc(hogs, pluginIsDisabled)
+	sort.Strings(hogs)
+	return hogs
+}
 
 func init() {
 	go pluginGoroutineWatchdog()
 }
 
+// pluginGoroutineWatchdog disables plugins whose timers hang or whose
+// callbacks pile up. It runs for the life of the process, so plugins
+// enabled later are watched too.
 func pluginGoroutineWatchdog() {
 	for {
-		if runtime.NumGoroutine() > pluginGoroutineLimit {
-			log.Printf("[plugin] goroutine limit exceeded; stopping all plugins")
-			consoleMessage("[plugin] goroutine limit exceeded; stopping plugins")
-			stopAllPlugins()
-			return
+		now := time.Now()
+		for _, owner := range pluginTimerOffenders(now) {
+			log.Printf("[plugin] %s: timer callback ran longer than %v", owner, pluginCallbackTimeout)
+			disablePlugin(owner, "timer callback did not return")
+		}
+		for _, owner := range pluginGoroutineHogs(pluginOwnerGoroutineLimit) {
+			log.Printf("[plugin] %s: more than %d callbacks running", owner, pluginOwnerGoroutineLimit)
+			disablePlugin(owner, "too many goroutines")
 		}
 		time.Sleep(time.Millisecond * 100)
 	}
@@ -334,7 +435,6 @@ var (
 	inputHandlersMu       sync.RWMutex
 	pluginCommandOwners   = map[string]string{}
 	pluginSendHistory     = map[string][]time.Time{}
-	pluginModTime         time.Time
 	pluginModCheck        time.Time
 )
 
@@ -387,6 +487,10 @@ func pluginRunCommand(owner, cmd string) {
 		return
 	}
 	consoleMessage("> " + cmd)
+	if pluginSendHook != nil {
+		pluginSendHook(owner, cmd)
+		return
+	}
 	enqueueCommand(cmd)
 	nextCommand()
 }
@@ -403,38 +507,87 @@ func pluginEnqueueCommand(owner, cmd string) {
 	if cmd == "" {
 		return
 	}
+	if pluginSendHook != nil {
+		pluginSendHook(owner, cmd)
+		return
+	}
 	enqueueCommand(cmd)
 }
 
 func loadPluginSource(owner, name, path string, src []byte, restricted interp.Exports) {
+	pluginMu.Lock()
+	pluginDisabled[owner] = false
+	pluginMu.Unlock()
+	i, err := compilePluginSource(owner, src, restricted)
+	if err != nil {
+		msg := err.Error() + pluginPermissionHint(owner, err.Error())
+		log.Printf("plugin %s: %v", path, err)
+		consoleMessage("[plugin] load error for " + path + ": " + msg)
+		disablePlugin(owner, "load error")
+		setPluginLoadError(owner, msg)
+		return
+	}
+	startPlugin(owner, i, nil, false)
+	log.Printf("loaded plugin %s", path)
+	consoleMessage("[plugin] loaded: " + name)
+}
+
+// compilePluginSource evaluates src in a new interpreter with owner's gt
+// exports. Top-level declarations run, but Init does not.
+func compilePluginSource(owner string, src []byte, restricted interp.Exports) (*interp.Interpreter, error) {
 	i := interp.New(interp.Options{})
 	if len(restricted) > 0 {
 		i.Use(restricted)
 	}
 	i.Use(exportsForPlugin(owner))
+	if _, err := i.Eval(string(src)); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// startPlugin records the Terminate and SaveState functions of a compiled
+// plugin and runs its Init. After a reload, RestoreState receives state
+// once Init returns.
+func startPlugin(owner string, i *interp.Interpreter, state any, reloaded bool) {
+	term, _ := pluginFunc[func()](i, "Terminate")
+	save, _ := pluginFunc[func() any](i, "SaveState")
 	pluginMu.Lock()
-	pluginDisabled[owner] = false
+	delete(pluginLoadErrors, owner)
+	if term != nil {
+		pluginTerminators[owner] = term
+	}
+	if save != nil {
+		pluginStateSavers[owner] = save
+	}
 	pluginMu.Unlock()
-	if _, err := i.Eval(string(src)); err != nil {
-		log.Printf("plugin %s: %v", path, err)
-		consoleMessage("[plugin] load error for " + path + ": " + err.Error())
-		disablePlugin(owner, "load error")
+	initFn, _ := pluginFunc[func()](i, "Init")
+	var restore func(any)
+	if reloaded {
+		restore, _ = pluginFunc[func(any)](i, "RestoreState")
+	}
+	if initFn == nil && restore == nil {
 		return
 	}
-	if v, err := i.Eval("Terminate"); err == nil {
-		if fn, ok := v.Interface().(func()); ok {
-			pluginMu.Lock()
-			pluginTerminators[owner] = fn
-			pluginMu.Unlock()
+	pluginGo(owner, func() {
+		if initFn != nil {
+			initFn()
 		}
-	}
-	if v, err := i.Eval("Init"); err == nil {
-		if fn, ok := v.Interface().(func()); ok {
-			go fn()
+		if restore != nil {
+			restore(state)
 		}
+	})
+}
+
+// pluginFunc looks up a top-level function of a compiled plugin.
+func pluginFunc[T any](i *interp.Interpreter, name string) (T, bool) {
+	var fn T
+	v, err := i.Eval(name)
+	if err != nil {
+		return fn, false
 	}
-	log.Printf("loaded plugin %s", path)
-	consoleMessage("[plugin] loaded: " + name)
+	fn, ok := v.Interface().(T)
+	return fn, ok
 }
 
 func enablePlugin(owner string) {
@@ -492,9 +645,10 @@ func disablePlugin(owner, reason string) {
 	}
 	term := pluginTerminators[owner]
 	delete(pluginTerminators, owner)
+	delete(pluginStateSavers, owner)
 	pluginMu.Unlock()
 	if term != nil {
-		go term()
+		pluginGo(owner, term)
 	}
 	for _, hk := range pluginHotkeys(owner) {
 		pluginRemoveHotkey(owner, hk.Combo)
@@ -545,6 +699,10 @@ func disablePlugin(owner, reason string) {
 		}
 	}
 	playerHandlersMu.Unlock()
+	pluginRemoveEventHandlers(owner)
+	pluginRemoveOverlay(owner)
+	pluginRemoveWindows(owner)
+	pluginCancelTimers(owner)
 	pluginMu.Lock()
 	for cmd, o := range pluginCommandOwners {
 		if o == owner {
@@ -577,8 +735,7 @@ func stopAllPlugins() {
 		disablePlugin(o, "stopped by user")
 	}
 	if len(owners) > 0 {
-		commandQueue = nil
-		pendingCommand = ""
+		focusedSession().clearCommands()
 		consoleMessage("[plugin] all plugins stopped")
 	}
 }
@@ -590,6 +747,7 @@ func applyEnabledPlugins() {
 		owners = append(owners, o)
 	}
 	pluginMu.RUnlock()
+	me := focusedSession().playerName
 	for _, o := range owners {
 		pluginMu.RLock()
 		scope := pluginEnabledFor[o]
@@ -602,7 +760,13 @@ func applyEnabledPlugins() {
 			pluginMu.Unlock()
 			continue
 		}
-		shouldEnable := scope == "all" || (playerName != "" && scope == playerName)
+		shouldEnable := scope == "all" || (me != "" && scope == me)
+		if shouldEnable && pluginNeedsConsent(o) {
+			if !disabled {
+				disablePlugin(o, "needs permission")
+			}
+			continue
+		}
 		if disabled && shouldEnable {
 			enablePlugin(o)
 		} else if !disabled && !shouldEnable {
@@ -616,6 +780,13 @@ func applyEnabledPlugins() {
 }
 
 func setPluginEnabled(owner string, char, all bool) {
+	me := focusedSession().playerName
+	if (all || (char && me != "")) && pluginNeedsConsent(owner) {
+		// Ask first; the checkbox stays clear unless the user allows it.
+		refreshPluginsWindow()
+		showPluginConsent(owner, func() { setPluginEnabled(owner, char, all) })
+		return
+	}
 	pluginMu.Lock()
 	if pluginInvalid[owner] {
 		pluginMu.Unlock()
@@ -623,8 +794,8 @@ func setPluginEnabled(owner string, char, all bool) {
 	}
 	if all {
 		pluginEnabledFor[owner] = "all"
-	} else if char && playerName != "" {
-		pluginEnabledFor[owner] = playerName
+	} else if char && me != "" {
+		pluginEnabledFor[owner] = me
 	} else {
 		delete(pluginEnabledFor, owner)
 	}
@@ -635,25 +806,25 @@ func setPluginEnabled(owner string, char, all bool) {
 }
 
 func pluginPlayerName() string {
-	return playerName
+	return focusedSession().playerName
 }
 
 func pluginPlayers() []Player {
-	ps := getPlayers()
+	ps := focusedSession().getPlayers()
 	out := make([]Player, len(ps))
 	copy(out, ps)
 	return out
 }
 
 func pluginInventory() []InventoryItem {
-	return getInventory()
+	return focusedSession().getInventory()
 }
 
 func pluginToggleEquip(owner string, id uint16) {
 	if recordPluginSend(owner) {
 		return
 	}
-	toggleInventoryEquip(id)
+	focusedSession().toggleInventoryEquip(id)
 }
 
 type Stats struct {
@@ -663,16 +834,17 @@ type Stats struct {
 }
 
 func pluginPlayerStats() Stats {
-	stateMu.Lock()
+	sess := focusedSession()
+	sess.stateMu.Lock()
 	s := Stats{
-		HP:         state.hp,
-		HPMax:      state.hpMax,
-		SP:         state.sp,
-		SPMax:      state.spMax,
-		Balance:    state.balance,
-		BalanceMax: state.balanceMax,
-	}
-	stateMu.Unlock()
+		HP:         sess.state.hp,
+		HPMax:      sess.state.hpMax,
+		SP:         sess.state.sp,
+		SPMax:      sess.state.spMax,
+		Balance:    sess.state.balance,
+		BalanceMax: sess.state.balanceMax,
+	}
+	sess.stateMu.Unlock()
 	return s
 }
 
@@ -695,7 +867,7 @@ func pluginEquip(owner string, id uint16) {
 	if recordPluginSend(owner) {
 		return
 	}
-	items := getInventory()
+	items := focusedSession().getInventory()
 	idx := -1
 	for _, it := range items {
 		if it.ID != id {
@@ -716,15 +888,15 @@ func pluginEquip(owner string, id uint16) {
 	if idx < 0 {
 		return
 	}
-	queueEquipCommand(id, idx)
-	equipInventoryItem(id, idx, true)
+	focusedSession().queueEquipCommand(id, idx)
+	focusedSession().equipInventoryItem(id, idx, true)
 }
 
 func pluginUnequip(owner string, id uint16) {
 	if recordPluginSend(owner) {
 		return
 	}
-	items := getInventory()
+	items := focusedSession().getInventory()
 	equipped := false
 	for _, it := range items {
 		if it.ID == id && it.Equipped {
@@ -735,8 +907,9 @@ func pluginUnequip(owner string, id uint16) {
 	if !equipped {
 		return
 	}
-	pendingCommand = fmt.Sprintf("/unequip %d", id)
-	equipInventoryItem(id, -1, false)
+	queueCommand(fmt.Sprintf("/unequip %d", id))
+	nextCommand()
+	focusedSession().equipInventoryItem(id, -1, false)
 }
 
 func pluginRegisterInputHandler(owner string, fn func(string) string) {
@@ -833,7 +1006,7 @@ func runChatTriggers(msg string) {
 		if strings.Contains(msg, phrase) {
 			for _, h := range hs {
 				if h.name == "" || h.name == chatSpeaker(msg) {
-					go h.fn()
+					pluginGo(h.owner, h.fn)
 				}
 			}
 		}
@@ -847,7 +1020,7 @@ func runConsoleTriggers(msg string) {
 	for phrase, hs := range pluginConsoleTriggers {
 		if strings.Contains(msgLower, phrase) {
 			for _, h := range hs {
-				go h.fn()
+				pluginGo(h.owner, h.fn)
 			}
 		}
 	}
@@ -884,28 +1057,6 @@ func pluginSource(owner string) string {
 	return string(data)
 }
 
-func refreshPluginMod() {
-	dirs := []string{userPluginsDir(), "plugins"}
-	latest := time.Time{}
-	for _, dir := range dirs {
-		entries, err := os.ReadDir(dir)
-		if err != nil {
-			continue
-		}
-		for _, e := range entries {
-			if e.IsDir() || !strings.HasSuffix(e.Name(), ".go") {
-				continue
-			}
-			if info, err := e.Info(); err == nil {
-				if info.ModTime().After(latest) {
-					latest = info.ModTime()
-				}
-			}
-		}
-	}
-	pluginModTime = latest
-}
-
 type pluginInfo struct {
 	name        string
 	author      string
@@ -914,6 +1065,7 @@ type pluginInfo struct {
 	path        string
 	src         []byte
 	invalid     bool
+	permissions []string
 }
 
 func scanPlugins(pluginDirs []string, dup func(name, path string)) map[string]pluginInfo {
@@ -961,6 +1113,10 @@ func scanPlugins(pluginDirs []string, dup func(name, path string)) map[string]pl
 			if match := authorRE.FindSubmatch(src); len(match) >= 2 {
 				author = strings.TrimSpace(string(match[1]))
 			}
+			perms, unknown := parsePluginPermissions(src)
+			for _, p := range unknown {
+				consoleMessage(fmt.Sprintf("[plugin] unknown permission %q: %s", p, path))
+			}
 			invalid := false
 			if len(nameMatch) < 2 || name == "" || invalidPluginValue(name) {
 				if len(nameMatch) < 2 || name == "" {
@@ -1004,6 +1160,7 @@ func scanPlugins(pluginDirs []string, dup func(name, path string)) map[string]pl
 				path:        path,
 				src:         src,
 				invalid:     invalid,
+				permissions: perms,
 			}
 		}
 	}
@@ -1013,6 +1170,7 @@ func scanPlugins(pluginDirs []string, dup func(name, path string)) map[string]pl
 func rescanPlugins() {
 	pluginDirs := []string{userPluginsDir(), "plugins"}
 	scanned := scanPlugins(pluginDirs, nil)
+	me := focusedSession().playerName
 
 	pluginMu.RLock()
 	oldDisabled := make(map[string]bool, len(pluginDisabled))
@@ -1039,9 +1197,11 @@ func rescanPlugins() {
 	pluginSubCategories = make(map[string]string, len(scanned))
 	pluginInvalid = make(map[string]bool, len(scanned))
 	pluginDisabled = make(map[string]bool, len(scanned))
+	pluginRequested = make(map[string][]string, len(scanned))
 	newEnabled := map[string]string{}
 	for o, info := range scanned {
 		pluginDisplayNames[o] = info.name
+		pluginRequested[o] = info.permissions
 		pluginPaths[o] = info.path
 		pluginAuthors[o] = info.author
 		pluginCategories[o] = info.category
@@ -1059,7 +1219,7 @@ func rescanPlugins() {
 			}
 		}
 		en := newEnabled[o]
-		pluginDisabled[o] = !(en == "all" || (playerName != "" && en == playerName))
+		pluginDisabled[o] = !(en == "all" || (me != "" && en == me))
 	}
 	pluginEnabledFor = newEnabled
 	pluginNames = make(map[string]bool, len(scanned))
@@ -1073,18 +1233,6 @@ func rescanPlugins() {
 	settingsDirty = true
 }
 
-func checkPluginMods() {
-	if time.Since(pluginModCheck) < 500*time.Millisecond {
-		return
-	}
-	pluginModCheck = time.Now()
-	old := pluginModTime
-	refreshPluginMod()
-	if pluginModTime.After(old) {
-		rescanPlugins()
-	}
-}
-
 func loadPlugins() {
 	ensureExamplePlugins()
 	ensureDefaultPlugins()
@@ -1095,6 +1243,7 @@ func loadPlugins() {
 		consoleMessage("[plugin] duplicate name: " + name)
 	})
 
+	me := focusedSession().playerName
 	pluginNames = make(map[string]bool, len(scanned))
 	for o, info := range scanned {
 		pluginNames[strings.ToLower(info.name)] = true
@@ -1104,7 +1253,14 @@ func loadPlugins() {
 				en = val
 			}
 		}
-		disabled := info.invalid || !(en == "all" || (playerName != "" && en == playerName))
+		pluginMu.Lock()
+		pluginRequested[o] = info.permissions
+		pluginMu.Unlock()
+		disabled := info.invalid || !(en == "all" || (me != "" && en == me))
+		if !disabled && pluginNeedsConsent(o) {
+			consoleMessage("[plugin] " + info.name + " needs permission; enable it in the Plugins window")
+			disabled = true
+		}
 		pluginMu.Lock()
 		pluginDisplayNames[o] = info.name
 		pluginCategories[o] = info.category
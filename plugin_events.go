@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Plugin event names accepted by gt.On.
+const (
+	EventFallen    = "fallen"
+	EventShare     = "share"
+	EventWho       = "who"
+	EventPresence  = "presence"
+	EventKarma     = "karma"
+	EventMusic     = "music"
+	EventInventory = "inventory"
+)
+
+var pluginEventNames = []string{EventFallen, EventShare, EventWho, EventPresence, EventKarma, EventMusic, EventInventory}
+
+// Event is passed to gt.On handlers. Name says which payload is set.
+type Event struct {
+	Name      string
+	Fallen    *FallenEvent
+	Share     *ShareEvent
+	Who       *WhoEvent
+	Presence  *PresenceEvent
+	Karma     *KarmaEvent
+	Music     *MusicEvent
+	Inventory *InventoryEvent
+}
+
+// FallenEvent reports a player falling or getting back up.
+type FallenEvent struct {
+	Name   string
+	Fallen bool   // false when the player is no longer fallen
+	Killer string // what felled them, if known
+	Where  string // where they fell, if known
+}
+
+// ShareEvent reports a share starting or ending.
+type ShareEvent struct {
+	Name   string
+	Sharee bool // true if you share Name, false if Name shares you
+	Active bool // false when the share ended
+}
+
+// WhoEvent lists the players named in one who list or who batch.
+type WhoEvent struct {
+	Names []string
+}
+
+// PresenceEvent reports a player logging on or off.
+type PresenceEvent struct {
+	Name   string
+	Online bool
+}
+
+// KarmaEvent reports karma given to you or by you.
+type KarmaEvent struct {
+	Name     string // the other player
+	Good     bool
+	Received bool   // true if Name gave you karma
+	Text     string // the message, for plugins with the chat permission
+}
+
+// MusicEvent reports a tune or stop request from a bard.
+type MusicEvent struct {
+	Who        int // mobile index of the player, 0 if unknown
+	Instrument int
+	Tempo      int
+	Notes      string
+	Stop       bool
+}
+
+// InventoryEvent reports a change made by the server to your inventory.
+// Action is "full", "add", "remove", "equip", "unequip" or "rename";
+// Items is the inventory after the change.
+type InventoryEvent struct {
+	Action string
+	ID     uint16
+	Index  int // per-ID index for template items, -1 otherwise
+	Name   string
+	Items  []InventoryItem
+}
+
+type pluginEventHandler struct {
+	owner string
+	fn    func(Event)
+}
+
+var (
+	pluginEventHandlers   = map[string][]pluginEventHandler{}
+	pluginEventHandlersMu sync.RWMutex
+)
+
+// pluginOn registers fn for events named name.
+func pluginOn(owner, name string, fn func(Event)) {
+	if pluginIsDisabled(owner) || fn == nil {
+		return
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !isPluginEventName(name) {
+		msg := fmt.Sprintf("[plugin] unknown event %q (use %s)", name, strings.Join(pluginEventNames, ", "))
+		consoleMessage(msg)
+		log.Print(msg)
+		return
+	}
+	pluginEventHandlersMu.Lock()
+	pluginEventHandlers[name] = append(pluginEventHandlers[name], pluginEventHandler{owner: owner, fn: fn})
+	pluginEventHandlersMu.Unlock()
+}
+
+func isPluginEventName(name string) bool {
+	for _, n := range pluginEventNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pluginRemoveEventHandlers drops every event handler owned by owner.
+func pluginRemoveEventHandlers(owner string) {
+	pluginEventHandlersMu.Lock()
+	for name, hs := range pluginEventHandlers {
+		n := 0
+		for _, h := range hs {
+			if h.owner != owner {
+				hs[n] = h
+				n++
+			}
+		}
+		if n == 0 {
+			delete(pluginEventHandlers, name)
+		} else {
+			pluginEventHandlers[name] = hs[:n]
+		}
+	}
+	pluginEventHandlersMu.Unlock()
+}
+
+func pluginHasEventHandlers(name string) bool {
+	pluginEventHandlersMu.RLock()
+	defer pluginEventHandlersMu.RUnlock()
+	return len(pluginEventHandlers[name]) > 0
+}
+
+// emitPluginEvent runs the handlers for ev.Name, each on its own goroutine
+// like player handlers. Plugins only hear the session in the game window.
+func (s *session) emitPluginEvent(ev Event) {
+	if !s.isFocused() {
+		return
+	}
+	pluginEventHandlersMu.RLock()
+	hs := append([]pluginEventHandler(nil), pluginEventHandlers[ev.Name]...)
+	pluginEventHandlersMu.RUnlock()
+	for _, h := range hs {
+		ev := eventFor(h.owner, ev)
+		pluginGo(h.owner, func() { h.fn(ev) })
+	}
+}
+
+// eventFor strips message text from ev unless owner may read chat.
+func eventFor(owner string, ev Event) Event {
+	if ev.Karma != nil && ev.Karma.Text != "" && !pluginHasPermission(owner, "chat") {
+		k := *ev.Karma
+		k.Text = ""
+		ev.Karma = &k
+	}
+	return ev
+}
+
+func (s *session) emitFallenEvent(name string, fallen bool, killer, where string) {
+	s.emitPluginEvent(Event{Name: EventFallen, Fallen: &FallenEvent{Name: name, Fallen: fallen, Killer: killer, Where: where}})
+}
+
+func (s *session) emitPresenceEvent(name string, online bool) {
+	s.emitPluginEvent(Event{Name: EventPresence, Presence: &PresenceEvent{Name: name, Online: online}})
+}
+
+func (s *session) emitWhoEvent(names []string) {
+	if len(names) == 0 {
+		return
+	}
+	s.emitPluginEvent(Event{Name: EventWho, Who: &WhoEvent{Names: append([]string(nil), names...)}})
+}
+
+// emitKarmaEvent reports a karma line; text is the decoded message.
+func (s *session) emitKarmaEvent(name, text string, received bool) {
+	if !pluginHasEventHandlers(EventKarma) {
+		return
+	}
+	s.emitPluginEvent(Event{Name: EventKarma, Karma: &KarmaEvent{Name: name, Good: !isBadKarma(text), Received: received, Text: text}})
+}
+
+// isBadKarma reports whether a karma message is about bad karma.
+func isBadKarma(text string) bool {
+	return strings.Contains(strings.ToLower(text), "bad karma")
+}
+
+func (s *session) emitMusicEvent(mp MusicParams) {
+	s.emitPluginEvent(Event{Name: EventMusic, Music: &MusicEvent{Who: mp.Who, Instrument: mp.Inst, Tempo: mp.Tempo, Notes: mp.Notes, Stop: mp.Stop}})
+}
+
+func (s *session) emitInventoryEvent(action string, id uint16, idx int, name string) {
+	if !pluginHasEventHandlers(EventInventory) {
+		return
+	}
+	s.emitPluginEvent(Event{Name: EventInventory, Inventory: &InventoryEvent{Action: action, ID: id, Index: idx, Name: name, Items: s.getInventory()}})
+}
+
+const (
+	shareSharee = 1 << iota
+	shareSharing
+)
+
+// shareSnapshot records who shares with whom so emitShareChanges can report
+// what a share message changed. It returns nil when nobody is listening.
+func (s *session) shareSnapshot() map[string]int {
+	if !pluginHasEventHandlers(EventShare) {
+		return nil
+	}
+	s.playersMu.RLock()
+	defer s.playersMu.RUnlock()
+	m := map[string]int{}
+	for name, p := range s.players {
+		var bits int
+		if p.Sharee {
+			bits |= shareSharee
+		}
+		if p.Sharing {
+			bits |= shareSharing
+		}
+		if bits != 0 {
+			m[name] = bits
+		}
+	}
+	return m
+}
+
+// emitShareChanges reports the differences between before and the current
+// share state, in name order.
+func (s *session) emitShareChanges(before map[string]int) {
+	if before == nil {
+		return
+	}
+	after := s.shareSnapshot()
+	if after == nil {
+		return
+	}
+	names := make([]string, 0, len(before)+len(after))
+	for n := range before {
+		names = append(names, n)
+	}
+	for n := range after {
+		if _, ok := before[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		b, a := before[n], after[n]
+		for _, bit := range []int{shareSharee, shareSharing} {
+			if b&bit != a&bit {
+				s.emitPluginEvent(Event{Name: EventShare, Share: &ShareEvent{Name: n, Sharee: bit == shareSharee, Active: a&bit != 0}})
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func resetPluginEvents() {
+	pluginEventHandlers = map[string][]pluginEventHandler{}
+	pluginEventHandlersMu = sync.RWMutex{}
+	pluginMu = sync.RWMutex{}
+	pluginDisabled = map[string]bool{}
+	pluginInvalid = map[string]bool{}
+	pluginEnabledFor = map[string]string{}
+	mainSession.players = make(map[string]*Player)
+	mainSession.playerName = ""
+}
+
+func waitEvent(t *testing.T, ch <-chan Event) Event {
+	t.Helper()
+	select {
+	case ev := <-ch:
+		return ev
+	case <-time.After(time.Second):
+		t.Fatalf("no event delivered")
+	}
+	return Event{}
+}
+
+func TestPluginOnFallen(t *testing.T) {
+	resetPluginEvents()
+	ch := make(chan Event, 4)
+	pluginOn("plug", "Fallen", func(ev Event) { ch <- ev })
+
+	raw := []byte(string(pn("Bob")) + " has fallen to a \xc2mnRat\xc2mn in \xc2loTown\xc2lo")
+	if !mainSession.parseFallenText(raw, "Bob has fallen to a Rat in Town") {
+		t.Fatalf("fallen line not handled")
+	}
+	ev := waitEvent(t, ch)
+	if ev.Name != EventFallen || ev.Fallen == nil {
+		t.Fatalf("event = %+v", ev)
+	}
+	if got := *ev.Fallen; got != (FallenEvent{Name: "Bob", Fallen: true, Killer: "Rat", Where: "Town"}) {
+		t.Fatalf("fallen = %+v", got)
+	}
+
+	mainSession.parseFallenText(append(pn("Bob"), " is no longer fallen"...), "Bob is no longer fallen")
+	if ev := waitEvent(t, ch); ev.Fallen.Fallen || ev.Fallen.Name != "Bob" {
+		t.Fatalf("unfallen = %+v", ev.Fallen)
+	}
+}
+
+func TestPluginOnShare(t *testing.T) {
+	resetPluginEvents()
+	ch := make(chan Event, 4)
+	pluginOn("plug", EventShare, func(ev Event) { ch <- ev })
+
+	mainSession.parseBackendShare([]byte(string(pn("Ann")) + "\t" + string(pn("Cid"))))
+	got := map[string]ShareEvent{}
+	for i := 0; i < 2; i++ {
+		ev := waitEvent(t, ch)
+		got[ev.Share.Name] = *ev.Share
+	}
+	if !got["Ann"].Sharee || !got["Ann"].Active || got["Cid"].Sharee || !got["Cid"].Active {
+		t.Fatalf("share events = %+v", got)
+	}
+
+	// Re-sending the same state reports nothing; dropping Ann reports one end.
+	mainSession.parseBackendShare([]byte(string(pn("Ann")) + "\t" + string(pn("Cid"))))
+	mainSession.parseBackendShare(append([]byte("\t"), pn("Cid")...))
+	ev := waitEvent(t, ch)
+	if *ev.Share != (ShareEvent{Name: "Ann", Sharee: true, Active: false}) {
+		t.Fatalf("unshare event = %+v", ev.Share)
+	}
+	select {
+	case ev := <-ch:
+		t.Fatalf("unexpected event %+v", ev.Share)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestPluginOnUnknownAndDisable(t *testing.T) {
+	resetPluginEvents()
+	mainSession.console = messageLog{max: maxMessages}
+	pluginOn("plug", "sneeze", func(Event) {})
+	if len(pluginEventHandlers) != 0 {
+		t.Fatalf("unknown event registered: %+v", pluginEventHandlers)
+	}
+	pluginOn("plug", EventWho, func(Event) {})
+	pluginOn("other", EventWho, func(Event) {})
+	pluginRemoveEventHandlers("plug")
+	if hs := pluginEventHandlers[EventWho]; len(hs) != 1 || hs[0].owner != "other" {
+		t.Fatalf("handlers after removal = %+v", hs)
+	}
+	pluginDisabled["other"] = true
+	pluginOn("other", EventWho, func(Event) {})
+	if len(pluginEventHandlers[EventWho]) != 1 {
+		t.Fatalf("disabled plugin registered a handler")
+	}
+}
@@ -83,7 +83,7 @@ func pluginLastClick() ClickInfo {
 }
 
 func pluginEquippedItems() []InventoryItem {
-	items := getInventory()
+	items := focusedSession().getInventory()
 	res := make([]InventoryItem, 0, len(items))
 	for _, it := range items {
 		if it.Equipped {
@@ -95,7 +95,7 @@ func pluginEquippedItems() []InventoryItem {
 
 func pluginHasItem(name string) bool {
 	n := strings.ToLower(name)
-	for _, it := range getInventory() {
+	for _, it := range focusedSession().getInventory() {
 		if strings.ToLower(it.Name) == n {
 			return true
 		}
@@ -104,5 +104,5 @@ func pluginHasItem(name string) bool {
 }
 
 func pluginFrameNumber() int {
-	return frameCounter
+	return focusedSession().frameCounter
 }
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pluginTestUsage is printed for "gothoom plugintest" without valid arguments.
+const pluginTestUsage = `usage:
+  gothoom plugintest [-v] plugin.go transcript.txt
+  gothoom plugintest [-v] plugin.go movie.clMov`
+
+// pluginHarnessSettle is how long the harness waits for a plugin's handlers
+// and timers to finish after each step, and for an expected command.
+const pluginHarnessSettle = 2 * time.Second
+
+// pluginSendHook, when set, receives the commands plugins send instead of
+// the command queue. The plugin test harness records them with it.
+var pluginSendHook func(owner, cmd string)
+
+// pluginHarness runs one plugin against a scripted transcript or a movie
+// and records the commands it sends.
+type pluginHarness struct {
+	owner    string
+	dir      string        // transcript paths are relative to this
+	log      io.Writer     // console and chat lines; nil discards them
+	baseline int           // goroutines running while the plugin is idle
+	offset   time.Duration // how far wait lines moved the timer clock
+
+	mu      sync.Mutex
+	sent    []string
+	loadErr string
+}
+
+// runPluginTestTool implements the "plugintest" subcommand: args are the
+// arguments after "plugintest".
+func runPluginTestTool(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("plugintest", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	verbose := fs.Bool("v", false, "print console and chat lines")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New(pluginTestUsage)
+	}
+	quietMovieSetup()
+	dir, err := os.MkdirTemp("", "gothoom-plugintest")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	// Plugin storage and settings saves land in the scratch directory.
+	dataDirPath = dir
+
+	pluginPath, script := fs.Arg(0), fs.Arg(1)
+	src, err := os.ReadFile(pluginPath)
+	if err != nil {
+		return err
+	}
+	var log io.Writer
+	if *verbose {
+		log = stdout
+	}
+	h, err := newPluginHarness(pluginPath, src, log)
+	if err != nil {
+		return err
+	}
+	defer h.close()
+
+	var r io.Reader
+	if strings.EqualFold(filepath.Ext(script), ".clMov") {
+		r = strings.NewReader("movie " + strconv.Quote(filepath.Base(script)))
+	} else {
+		f, err := os.Open(script)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	h.dir = filepath.Dir(script)
+	if err := h.run(r); err != nil {
+		return fmt.Errorf("%s: %w", script, err)
+	}
+	fmt.Fprintf(stdout, "ok %s %s\n", pluginPath, script)
+	return nil
+}
+
+// newPluginHarness loads src as the plugin at path with every permission it
+// asks for granted. Sent commands are recorded rather than queued.
+func newPluginHarness(path string, src []byte, log io.Writer) (*pluginHarness, error) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	h := &pluginHarness{owner: "test_" + name, dir: filepath.Dir(path), log: log}
+	perms, unknown := parsePluginPermissions(src)
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("%s: unknown permissions %s", path, strings.Join(unknown, ", "))
+	}
+	pluginMu.Lock()
+	pluginRequested[h.owner] = perms
+	if gs.PluginGrants == nil {
+		gs.PluginGrants = map[string][]string{}
+	}
+	gs.PluginGrants[h.owner] = perms
+	pluginDisplayNames[h.owner] = name
+	pluginPaths[h.owner] = path
+	pluginMu.Unlock()
+
+	pluginSendHook = h.record
+	movieDumpText = h.text
+	h.baseline = runtime.NumGoroutine()
+	loadPluginSource(h.owner, name, path, src, restrictedStdlib())
+	h.settle()
+	if pluginIsDisabled(h.owner) {
+		h.close()
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.loadErr == "" {
+			h.loadErr = "plugin stopped while loading"
+		}
+		return nil, errors.New(h.loadErr)
+	}
+	return h, nil
+}
+
+// close stops the plugin and removes the harness hooks.
+func (h *pluginHarness) close() {
+	if !pluginIsDisabled(h.owner) {
+		disablePlugin(h.owner, "test finished")
+	}
+	pluginSendHook = nil
+	movieDumpText = nil
+}
+
+func (h *pluginHarness) record(owner, cmd string) {
+	if owner != h.owner {
+		return
+	}
+	h.mu.Lock()
+	h.sent = append(h.sent, cmd)
+	h.mu.Unlock()
+}
+
+func (h *pluginHarness) text(typ, text string) {
+	h.mu.Lock()
+	if strings.HasPrefix(text, "[plugin] load error") {
+		h.loadErr = strings.TrimPrefix(text, "[plugin] ")
+	}
+	h.mu.Unlock()
+	if h.log != nil {
+		fmt.Fprintf(h.log, "%s: %s\n", typ, text)
+	}
+}
+
+// settle waits for the handlers a step started to return. A plugin that
+// keeps a goroutine running costs one pluginHarnessSettle, after which the
+// extra goroutine counts as idle.
+func (h *pluginHarness) settle() {
+	deadline := time.Now().Add(pluginHarnessSettle)
+	for runtime.NumGoroutine() > h.baseline {
+		if time.Now().After(deadline) {
+			h.baseline = runtime.NumGoroutine()
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// advance moves the timer clock forward by d one game tick at a time,
+// letting each tick's callbacks finish before the next.
+func (h *pluginHarness) advance(d time.Duration) {
+	const tick = time.Second / headlessTickRate
+	for left := d; left > 0; left -= tick {
+		if left < tick {
+			h.offset += left
+		} else {
+			h.offset += tick
+		}
+		runPluginTimers(time.Now().Add(h.offset))
+		deadline := time.Now().Add(pluginHarnessSettle)
+		for time.Now().Before(deadline) {
+			pluginTimersMu.Lock()
+			busy := pluginTimerRunning[h.owner] > 0
+			pluginTimersMu.Unlock()
+			if !busy {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	h.settle()
+}
+
+// next returns the oldest command not yet matched by an expect line,
+// waiting up to pluginHarnessSettle for one to be sent.
+func (h *pluginHarness) next() (string, bool) {
+	deadline := time.Now().Add(pluginHarnessSettle)
+	for {
+		h.mu.Lock()
+		if len(h.sent) > 0 {
+			cmd := h.sent[0]
+			h.sent = h.sent[1:]
+			h.mu.Unlock()
+			return cmd, true
+		}
+		h.mu.Unlock()
+		if time.Now().After(deadline) {
+			return "", false
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// playMovie applies every frame of the movie at path, routing its text
+// through the console and chat the way the client does.
+func (h *pluginHarness) playMovie(path string) error {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(h.dir, path)
+	}
+	frames, err := parseMovie(path, clientVersion)
+	if err != nil {
+		return err
+	}
+	for i, m := range frames {
+		mainSession.applyMovieFrames(frames[i : i+1])
+		if len(m.data) >= 2 && binary.BigEndian.Uint16(m.data[:2]) != 2 {
+			if txt := mainSession.decodeMessage(append([]byte(nil), m.data...)); txt != "" {
+				consoleMessage(txt)
+			}
+		}
+		h.settle()
+	}
+	return nil
+}
+
+// run executes a transcript. Each line is one step; blank lines and lines
+// starting with # are ignored. Names with spaces are written in quotes.
+//
+//	chat <text>                  a chat line, as if from the server
+//	console <text>               a console line
+//	player <name> online|offline a presence change
+//	fallen <name> [killer] [where]
+//	unfallen <name>
+//	wait <duration>              advance plugin timers, e.g. "wait 1.5s"
+//	movie <file.clMov>           replay a recorded session
+//	expect <command>             the next command the plugin sent
+//	expect-none                  the plugin sent nothing else
+func (h *pluginHarness) run(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := h.step(line); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	return sc.Err()
+}
+
+func (h *pluginHarness) step(line string) error {
+	verb, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch verb {
+	case "chat":
+		chatMessage(arg)
+	case "console":
+		consoleMessage(arg)
+	case "player":
+		f, err := transcriptFields(arg)
+		if err != nil {
+			return err
+		}
+		if len(f) != 2 || (f[1] != "online" && f[1] != "offline") {
+			return errors.New("usage: player <name> online|offline")
+		}
+		online := f[1] == "online"
+		mainSession.notifyPlayerHandlers(Player{Name: f[0], Offline: !online, LastSeen: time.Now()})
+		mainSession.emitPresenceEvent(f[0], online)
+	case "fallen", "unfallen":
+		f, err := transcriptFields(arg)
+		if err != nil {
+			return err
+		}
+		if len(f) == 0 || len(f) > 3 || (verb == "unfallen" && len(f) > 1) {
+			return errors.New("usage: fallen <name> [killer] [where] or unfallen <name>")
+		}
+		f = append(f, "", "")
+		mainSession.emitFallenEvent(f[0], verb == "fallen", f[1], f[2])
+	case "wait":
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return err
+		}
+		h.advance(d)
+		return nil
+	case "movie":
+		f, err := transcriptFields(arg)
+		if err != nil {
+			return err
+		}
+		if len(f) != 1 {
+			return errors.New("usage: movie <file.clMov>")
+		}
+		return h.playMovie(f[0])
+	case "expect":
+		cmd, ok := h.next()
+		if !ok {
+			return fmt.Errorf("nothing sent, want %q", arg)
+		}
+		if cmd != arg {
+			return fmt.Errorf("sent %q, want %q", cmd, arg)
+		}
+		return nil
+	case "expect-none":
+		h.settle()
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if len(h.sent) > 0 {
+			return fmt.Errorf("unexpected %q", h.sent[0])
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown step %q", verb)
+	}
+	h.settle()
+	return nil
+}
+
+// transcriptFields splits s at spaces, treating double-quoted Go strings as
+// single fields.
+func transcriptFields(s string) ([]string, error) {
+	var out []string
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if s[0] == '"' {
+			q, err := strconv.QuotedPrefix(s)
+			if err != nil {
+				return nil, err
+			}
+			v, _ := strconv.Unquote(q)
+			out = append(out, v)
+			s = s[len(q):]
+			continue
+		}
+		f, rest, _ := strings.Cut(s, " ")
+		out = append(out, f)
+		s = rest
+	}
+	return out, nil
+}
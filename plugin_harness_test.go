@@ -0,0 +1,118 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const harnessPlugin = `package main
+
+import (
+	"gt"
+	"time"
+)
+
+var PluginName = "Greeter"
+var PluginPermissions = []string{"commands", "chat"}
+
+func Init() {
+	gt.RegisterTrigger("", "hello", func() { gt.RunCommand("/wave") })
+	gt.On(gt.EventFallen, func(ev gt.Event) {
+		if ev.Fallen.Fallen {
+			gt.After(time.Second, func() { gt.EnqueueCommand("/pray " + ev.Fallen.Name) })
+		}
+	})
+}
+`
+
+func resetPluginHarness(t *testing.T) {
+	pluginTriggers = map[string][]triggerHandler{}
+	pluginConsoleTriggers = map[string][]triggerHandler{}
+	triggerHandlersMu = sync.RWMutex{}
+	pluginMu = sync.RWMutex{}
+	pluginDisabled = map[string]bool{}
+	pluginEnabledFor = map[string]string{}
+	pluginDisplayNames = map[string]string{}
+	pluginPaths = map[string]string{}
+	pluginTerminators = map[string]func(){}
+	pluginCommandOwners = map[string]string{}
+	pluginCommands = map[string]PluginCommandHandler{}
+	pluginSendHistory = map[string][]time.Time{}
+	pluginRequested = map[string][]string{}
+	pluginTimers = map[int]*pluginTimer{}
+	pluginTimerRunning = map[string]int{}
+	pluginEventHandlers = map[string][]pluginEventHandler{}
+	pluginStateSavers = map[string]func() any{}
+	pluginLoadErrors = map[string]string{}
+	mainSession.players = map[string]*Player{}
+	mainSession.console = messageLog{max: maxMessages}
+	mainSession.chat = messageLog{max: maxChatMessages}
+	origDir, origGrants := dataDirPath, gs.PluginGrants
+	dataDirPath = t.TempDir()
+	gs.PluginGrants = nil
+	t.Cleanup(func() { dataDirPath, gs.PluginGrants = origDir, origGrants })
+}
+
+func TestPluginHarnessTranscript(t *testing.T) {
+	resetPluginHarness(t)
+	h, err := newPluginHarness("greeter.go", []byte(harnessPlugin), nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	defer h.close()
+	script := `
+# greet, then pray for the fallen a second later
+chat Bob says, "hello"
+expect /wave
+fallen "Sir Test" "a Large Vermine"
+expect-none
+wait 1s
+expect /pray Sir Test
+expect-none
+`
+	if err := h.run(strings.NewReader(script)); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+}
+
+func TestPluginHarnessFailures(t *testing.T) {
+	resetPluginHarness(t)
+	h, err := newPluginHarness("greeter.go", []byte(harnessPlugin), nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	defer h.close()
+	err = h.run(strings.NewReader("chat Bob says, \"hello\"\nexpect /bow\n"))
+	if err == nil || !strings.Contains(err.Error(), `line 2: sent "/wave", want "/bow"`) {
+		t.Fatalf("err = %v", err)
+	}
+	if err := h.run(strings.NewReader("dance")); err == nil {
+		t.Fatalf("unknown step accepted")
+	}
+}
+
+func TestPluginHarnessLoadError(t *testing.T) {
+	resetPluginHarness(t)
+	src := strings.Replace(harnessPlugin, `"commands", "chat"`, `"chat"`, 1)
+	_, err := newPluginHarness("greeter.go", []byte(src), nil)
+	if err == nil || !strings.Contains(err.Error(), `needs "commands"`) {
+		t.Fatalf("err = %v", err)
+	}
+	if pluginSendHook != nil {
+		t.Fatalf("send hook left installed")
+	}
+}
+
+func TestTranscriptFields(t *testing.T) {
+	got, err := transcriptFields(`"Sir Test"  Orga "the \"Mare\""`)
+	want := []string{"Sir Test", "Orga", `the "Mare"`}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("fields = %q, %v", got, err)
+	}
+	if _, err := transcriptFields(`"open`); err == nil {
+		t.Fatalf("unterminated quote accepted")
+	}
+}
@@ -44,7 +44,7 @@ const PluginName = "MetaTest"
 		t.Fatalf("plugin not disabled")
 	}
 
-	playerName = "Tester"
+	mainSession.playerName = "Tester"
 	setPluginEnabled(owner, true, false)
 	if pluginEnabledFor[owner] != "" {
 		t.Fatalf("invalid plugin unexpectedly enabled: %q", pluginEnabledFor[owner])
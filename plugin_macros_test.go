@@ -88,9 +88,9 @@ func TestPluginAutoReplyRunsCommand(t *testing.T) {
 	triggerHandlersMu = sync.RWMutex{}
 	pluginTriggers = map[string][]triggerHandler{}
 	pluginConsoleTriggers = map[string][]triggerHandler{}
-	consoleLog = messageLog{max: maxMessages}
-	commandQueue = nil
-	pendingCommand = ""
+	mainSession.console = messageLog{max: maxMessages}
+	mainSession.commandQueue = nil
+	mainSession.pendingCommand = ""
 	pluginSendHistory = map[string][]time.Time{}
 
 	pluginAutoReply("bot", "hi", "/wave")
@@ -99,8 +99,8 @@ func TestPluginAutoReplyRunsCommand(t *testing.T) {
 	if msgs := getConsoleMessages(); len(msgs) != 0 {
 		t.Fatalf("unexpected console messages %v", msgs)
 	}
-	if pendingCommand != "/wave" {
-		t.Fatalf("pending command %q, want %q", pendingCommand, "/wave")
+	if mainSession.pendingCommand != "/wave" {
+		t.Fatalf("pending command %q, want %q", mainSession.pendingCommand, "/wave")
 	}
 }
 
@@ -125,7 +125,7 @@ func TestPluginRemoveMacrosOnDisable(t *testing.T) {
 	hotkeysMu = sync.RWMutex{}
 	hotkeys = nil
 	pluginHotkeyEnabled = map[string]map[string]bool{}
-	consoleLog = messageLog{max: maxMessages}
+	mainSession.console = messageLog{max: maxMessages}
 
 	owner := "plug"
 	pluginAddMacro(owner, "pp", "/ponder ")
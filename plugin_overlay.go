@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// Overlays are drawn per frame: what a plugin draws during one game tick is
+// shown from the next tick until the one after, so plugins redraw from
+// gt.OnFrame. A plugin whose callbacks are still running keeps its last
+// frame up rather than flicker.
+
+// pluginOverlayBudget caps how many primitives one plugin may draw per frame
+// so a runaway script cannot stall drawing.
+const pluginOverlayBudget = 256
+
+// Overlay anchors.
+const (
+	overlayWorld = iota
+	overlayScreen
+	overlayMobile
+)
+
+// OverlayPos places an overlay primitive in world coordinates (relative to
+// the field center, like mobiles), screen coordinates (game pixels from the
+// top-left of the field) or relative to a visible mobile.
+type OverlayPos struct {
+	Anchor int
+	X, Y   int
+	Mobile string
+}
+
+// Color is an RGBA overlay color.
+type Color struct {
+	R, G, B, A uint8
+}
+
+func (c Color) rgba() color.RGBA {
+	// Plugins pass straight alpha; ebiten expects premultiplied colors.
+	a := uint16(c.A)
+	return color.RGBA{uint8(uint16(c.R) * a / 255), uint8(uint16(c.G) * a / 255), uint8(uint16(c.B) * a / 255), c.A}
+}
+
+const (
+	overlayText = iota
+	overlayRect
+	overlayFilledRect
+	overlayLine
+	overlayImage
+)
+
+type overlayCmd struct {
+	kind   int
+	pos    OverlayPos
+	to     OverlayPos
+	w, h   int
+	text   string
+	pictID uint16
+	color  Color
+}
+
+var (
+	pluginOverlays     = map[string][]overlayCmd{} // shown this frame
+	pluginOverlayNext  = map[string][]overlayCmd{} // drawn for the next frame
+	pluginOverlayFull  = map[string]bool{}         // warned about the budget
+	pluginOverlaysMu   sync.Mutex
+	pluginOverlayOrder []string
+)
+
+func pluginWorldPos(h, v int) OverlayPos { return OverlayPos{Anchor: overlayWorld, X: h, Y: v} }
+
+func pluginScreenPos(x, y int) OverlayPos { return OverlayPos{Anchor: overlayScreen, X: x, Y: y} }
+
+func pluginMobilePos(name string, dh, dv int) OverlayPos {
+	return OverlayPos{Anchor: overlayMobile, X: dh, Y: dv, Mobile: name}
+}
+
+func pluginRGBA(r, g, b, a uint8) Color { return Color{r, g, b, a} }
+
+// addPluginOverlay queues cmd on owner's next frame. Commands past the
+// budget are dropped with a single console warning.
+func addPluginOverlay(owner string, cmd overlayCmd) {
+	if pluginIsDisabled(owner) {
+		return
+	}
+	pluginOverlaysMu.Lock()
+	cmds, ok := pluginOverlayNext[owner]
+	if len(cmds) >= pluginOverlayBudget {
+		warn := !pluginOverlayFull[owner]
+		pluginOverlayFull[owner] = true
+		pluginOverlaysMu.Unlock()
+		if warn {
+			consoleMessage(fmt.Sprintf("[plugin:%s] overlay limit of %d items per frame reached", pluginDisplayName(owner), pluginOverlayBudget))
+		}
+		return
+	}
+	if !ok {
+		if _, shown := pluginOverlays[owner]; !shown {
+			pluginOverlayOrder = append(pluginOverlayOrder, owner)
+			sort.Strings(pluginOverlayOrder)
+		}
+	}
+	pluginOverlayNext[owner] = append(cmds, cmd)
+	pluginOverlaysMu.Unlock()
+}
+
+// flipPluginOverlays shows what each plugin drew since the last call and
+// starts a new frame. Plugins in busy, which still have callbacks running,
+// keep their shown frame and go on drawing the next one.
+func flipPluginOverlays(busy map[string]int) {
+	pluginOverlaysMu.Lock()
+	for _, owner := range pluginOverlayOrder {
+		if busy[owner] > 0 {
+			continue
+		}
+		shown := pluginOverlays[owner]
+		pluginOverlays[owner] = pluginOverlayNext[owner]
+		pluginOverlayNext[owner] = shown[:0]
+	}
+	pluginOverlaysMu.Unlock()
+}
+
+// pluginClearOverlay discards what owner has drawn for the next frame.
+func pluginClearOverlay(owner string) {
+	pluginOverlaysMu.Lock()
+	if cmds, ok := pluginOverlayNext[owner]; ok {
+		pluginOverlayNext[owner] = cmds[:0]
+	}
+	pluginOverlaysMu.Unlock()
+}
+
+// pluginRemoveOverlay drops owner's overlay entirely.
+func pluginRemoveOverlay(owner string) {
+	pluginOverlaysMu.Lock()
+	delete(pluginOverlays, owner)
+	delete(pluginOverlayNext, owner)
+	delete(pluginOverlayFull, owner)
+	for i, o := range pluginOverlayOrder {
+		if o == owner {
+			pluginOverlayOrder = append(pluginOverlayOrder[:i], pluginOverlayOrder[i+1:]...)
+			break
+		}
+	}
+	pluginOverlaysMu.Unlock()
+}
+
+func pluginDisplayName(owner string) string {
+	pluginMu.RLock()
+	disp := pluginDisplayNames[owner]
+	pluginMu.RUnlock()
+	if disp == "" {
+		disp = owner
+	}
+	return disp
+}
+
+func pluginDrawText(owner string, pos OverlayPos, txt string, c Color) {
+	addPluginOverlay(owner, overlayCmd{kind: overlayText, pos: pos, text: txt, color: c})
+}
+
+func pluginDrawRect(owner string, pos OverlayPos, w, h int, c Color, filled bool) {
+	kind := overlayRect
+	if filled {
+		kind = overlayFilledRect
+	}
+	addPluginOverlay(owner, overlayCmd{kind: kind, pos: pos, w: w, h: h, color: c})
+}
+
+func pluginDrawLine(owner string, from, to OverlayPos, c Color) {
+	addPluginOverlay(owner, overlayCmd{kind: overlayLine, pos: from, to: to, color: c})
+}
+
+func pluginDrawImage(owner string, pictID uint16, pos OverlayPos) {
+	addPluginOverlay(owner, overlayCmd{kind: overlayImage, pos: pos, pictID: pictID})
+}
+
+// overlayPoint converts pos to field pixels (unscaled, from the top-left).
+// Mobile anchors move with the mobile as it is drawn at alpha. ok is false
+// when pos is anchored to a mobile that is not on screen.
+func overlayPoint(pos OverlayPos, snap drawSnapshot, alpha float64) (x, y float64, ok bool) {
+	switch pos.Anchor {
+	case overlayScreen:
+		return float64(pos.X), float64(pos.Y), true
+	case overlayMobile:
+		maxDist := maxMobileInterpPixels * (snap.dropped + 1)
+		for _, m := range snap.liveMobs {
+			if d, ok := snap.descriptors[m.Index]; ok && strings.EqualFold(d.Name, pos.Mobile) {
+				h, v := mobilePosition(m, snap.prevMobiles, snap.picShiftX, snap.picShiftY, alpha, maxDist)
+				return h + float64(pos.X+fieldCenterX), v + float64(pos.Y+fieldCenterY), true
+			}
+		}
+		return 0, 0, false
+	default:
+		return float64(pos.X + fieldCenterX), float64(pos.Y + fieldCenterY), true
+	}
+}
+
+// drawPluginOverlays composites every plugin overlay onto screen at alpha
+// between the previous frame and this one.
+func drawPluginOverlays(screen *ebiten.Image, ox, oy int, snap drawSnapshot, alpha float64) {
+	if !snap.sess.isFocused() {
+		// Plugins draw for the character in the game window only.
+		return
+	}
+	pluginOverlaysMu.Lock()
+	if len(pluginOverlayOrder) == 0 {
+		pluginOverlaysMu.Unlock()
+		return
+	}
+	var cmds []overlayCmd
+	for _, owner := range pluginOverlayOrder {
+		cmds = append(cmds, pluginOverlays[owner]...)
+	}
+	pluginOverlaysMu.Unlock()
+
+	scale := gs.GameScale
+	at := func(pos OverlayPos) (float32, float32, bool) {
+		x, y, ok := overlayPoint(pos, snap, alpha)
+		return float32(x*scale) + float32(ox), float32(y*scale) + float32(oy), ok
+	}
+	for _, c := range cmds {
+		x, y, ok := at(c.pos)
+		if !ok {
+			continue
+		}
+		switch c.kind {
+		case overlayText:
+			op := &text.DrawOptions{}
+			op.GeoM.Translate(float64(x), float64(y))
+			op.ColorScale.ScaleWithColor(c.color.rgba())
+			text.Draw(screen, c.text, mainFont, op)
+		case overlayRect:
+			vector.StrokeRect(screen, x, y, float32(float64(c.w)*scale), float32(float64(c.h)*scale), float32(scale), c.color.rgba(), false)
+		case overlayFilledRect:
+			vector.DrawFilledRect(screen, x, y, float32(float64(c.w)*scale), float32(float64(c.h)*scale), c.color.rgba(), false)
+		case overlayLine:
+			x2, y2, ok := at(c.to)
+			if !ok {
+				continue
+			}
+			vector.StrokeLine(screen, x, y, x2, y2, float32(scale), c.color.rgba(), true)
+		case overlayImage:
+			// Animated pictures play in step with the world.
+			frame := 0
+			if clImages != nil {
+				frame = clImages.FrameIndex(uint32(c.pictID), snap.frame)
+			}
+			img, imgScale := loadPictureFrame(c.pictID, frame)
+			if img == nil {
+				continue
+			}
+			b := img.Bounds()
+			s := scale / imgScale
+			op := &ebiten.DrawImageOptions{Filter: ebiten.FilterNearest, DisableMipmaps: true}
+			op.GeoM.Scale(s, s)
+			op.GeoM.Translate(float64(x)-float64(b.Dx())*s/2, float64(y)-float64(b.Dy())*s/2)
+			screen.DrawImage(img, op)
+		}
+	}
+}
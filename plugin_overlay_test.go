@@ -0,0 +1,91 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func resetPluginOverlays() {
+	pluginOverlays = map[string][]overlayCmd{}
+	pluginOverlayNext = map[string][]overlayCmd{}
+	pluginOverlayFull = map[string]bool{}
+	pluginOverlayOrder = nil
+	pluginOverlaysMu = sync.Mutex{}
+	pluginMu = sync.RWMutex{}
+	pluginDisabled = map[string]bool{}
+	pluginDisplayNames = map[string]string{}
+	mainSession.console = messageLog{max: maxMessages}
+}
+
+func TestPluginOverlayFrames(t *testing.T) {
+	resetPluginOverlays()
+	white := pluginRGBA(255, 255, 255, 255)
+	for i := 0; i < pluginOverlayBudget+10; i++ {
+		pluginDrawText("plug", pluginWorldPos(i, 0), "x", white)
+	}
+	pluginDrawLine("other", pluginWorldPos(0, 0), pluginScreenPos(1, 1), white)
+	if len(pluginOverlays["plug"]) != 0 {
+		t.Fatalf("items shown before the frame ended")
+	}
+	flipPluginOverlays(nil)
+	if n := len(pluginOverlays["plug"]); n != pluginOverlayBudget {
+		t.Fatalf("kept %d items, want %d", n, pluginOverlayBudget)
+	}
+	if len(pluginOverlays["other"]) != 1 {
+		t.Fatalf("budget shared between plugins")
+	}
+
+	// The budget is per frame, and a plugin still busy keeps its frame.
+	pluginDrawText("plug", pluginWorldPos(0, 0), "gone", white)
+	pluginClearOverlay("plug")
+	pluginDrawRect("plug", pluginWorldPos(0, 0), 4, 4, white, true)
+	flipPluginOverlays(map[string]int{"other": 1})
+	if cmds := pluginOverlays["plug"]; len(cmds) != 1 || cmds[0].kind != overlayFilledRect {
+		t.Fatalf("second frame = %+v", cmds)
+	}
+	if len(pluginOverlays["other"]) != 1 {
+		t.Fatalf("busy plugin's frame dropped")
+	}
+	flipPluginOverlays(nil)
+	if len(pluginOverlays["plug"]) != 0 || len(pluginOverlays["other"]) != 0 {
+		t.Fatalf("frames kept after nothing was drawn")
+	}
+
+	pluginRemoveOverlay("plug")
+	if _, ok := pluginOverlays["plug"]; ok || len(pluginOverlayOrder) != 1 {
+		t.Fatalf("overlay not removed: %v", pluginOverlayOrder)
+	}
+	pluginDisabled["other"] = true
+	pluginDrawImage("other", 12, pluginWorldPos(0, 0))
+	if len(pluginOverlayNext["other"]) != 0 {
+		t.Fatalf("disabled plugin drew")
+	}
+}
+
+func TestOverlayPoint(t *testing.T) {
+	snap := drawSnapshot{
+		descriptors: map[uint8]frameDescriptor{3: {Index: 3, Name: "Bob"}},
+		liveMobs:    []frameMobile{{Index: 3, H: 10, V: -5}},
+	}
+	if x, y, ok := overlayPoint(pluginWorldPos(1, 2), snap, 1); !ok || x != float64(fieldCenterX+1) || y != float64(fieldCenterY+2) {
+		t.Fatalf("world = %v,%v,%v", x, y, ok)
+	}
+	if x, y, ok := overlayPoint(pluginScreenPos(4, 5), snap, 1); !ok || x != 4 || y != 5 {
+		t.Fatalf("screen = %v,%v,%v", x, y, ok)
+	}
+	if x, y, ok := overlayPoint(pluginMobilePos("bob", 0, -20), snap, 1); !ok || x != float64(fieldCenterX+10) || y != float64(fieldCenterY-25) {
+		t.Fatalf("mobile = %v,%v,%v", x, y, ok)
+	}
+	if _, _, ok := overlayPoint(pluginMobilePos("Carol", 0, 0), snap, 1); ok {
+		t.Fatalf("anchored to a missing mobile")
+	}
+	// Halfway between frames the anchor sits where the mobile is drawn.
+	prev := gs.MotionSmoothing
+	t.Cleanup(func() { gs.MotionSmoothing = prev })
+	gs.MotionSmoothing = true
+	snap.prevMobiles = map[uint8]frameMobile{3: {Index: 3, H: 0, V: -5}}
+	snap.dropped = 0
+	if x, _, ok := overlayPoint(pluginMobilePos("Bob", 0, 0), snap, 0.5); !ok || x != float64(fieldCenterX+5) {
+		t.Fatalf("interpolated mobile x = %v,%v", x, ok)
+	}
+}
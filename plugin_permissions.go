@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gothoom/eui"
+)
+
+// pluginPermission describes a capability a plugin can request in its
+// PluginPermissions variable and the gt symbols it unlocks.
+type pluginPermission struct {
+	name    string
+	desc    string
+	symbols []string
+}
+
+var pluginPermissionList = []pluginPermission{
+	{"commands", "Send commands, hotkeys and macros to the server",
+		[]string{"RunCommand", "EnqueueCommand", "AddHotkey", "RemoveHotkey", "AddMacro", "AddMacros", "AutoReply"}},
+	{"chat", "Read chat and console messages",
+		[]string{"RegisterTriggers", "RegisterTrigger", "RegisterConsoleTriggers", "AutoReply"}},
+	{"storage", "Save its own settings to disk",
+		[]string{"StorageGet", "StorageSet", "StorageDelete"}},
+	{"input", "Read and rewrite what you type, and watch your keys and mouse",
+		[]string{"InputText", "SetInputText", "RegisterInputHandler", "RegisterCommand",
+			"KeyPressed", "KeyJustPressed", "MousePressed", "MouseJustPressed", "MouseWheel", "LastClick"}},
+	{"equipment", "Equip and unequip items",
+		[]string{"Equip", "Unequip", "ToggleEquip"}},
+}
+
+// pluginSymbolREs matches each gated symbol as a whole word in load errors.
+var pluginSymbolREs = func() map[string]*regexp.Regexp {
+	m := map[string]*regexp.Regexp{}
+	for _, p := range pluginPermissionList {
+		for _, sym := range p.symbols {
+			m[sym] = regexp.MustCompile(`\b` + sym + `\b`)
+		}
+	}
+	return m
+}()
+
+var (
+	pluginPermsRE   = regexp.MustCompile(`(?m)^\s*(?:var|const)\s+PluginPermissions\s*=\s*\[\]string\s*\{([^}]*)\}`)
+	pluginQuotedRE  = regexp.MustCompile(`"([^"]*)"`)
+	pluginRequested = map[string][]string{}
+)
+
+func findPluginPermission(name string) *pluginPermission {
+	for i := range pluginPermissionList {
+		if pluginPermissionList[i].name == name {
+			return &pluginPermissionList[i]
+		}
+	}
+	return nil
+}
+
+// parsePluginPermissions returns the known permissions declared in src,
+// sorted and without duplicates, plus any names it does not recognize.
+func parsePluginPermissions(src []byte) (perms, unknown []string) {
+	m := pluginPermsRE.FindSubmatch(src)
+	if len(m) < 2 {
+		return nil, nil
+	}
+	seen := map[string]bool{}
+	for _, q := range pluginQuotedRE.FindAllSubmatch(m[1], -1) {
+		name := strings.ToLower(strings.TrimSpace(string(q[1])))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		if findPluginPermission(name) == nil {
+			unknown = append(unknown, name)
+			continue
+		}
+		perms = append(perms, name)
+	}
+	sort.Strings(perms)
+	return perms, unknown
+}
+
+// pluginGranted reports whether owner both requested and was granted perm.
+// Call with pluginMu held.
+func pluginGranted(owner, perm string) bool {
+	requested := false
+	for _, p := range pluginRequested[owner] {
+		if p == perm {
+			requested = true
+			break
+		}
+	}
+	if !requested {
+		return false
+	}
+	for _, p := range gs.PluginGrants[owner] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// pluginHasPermission is pluginGranted for callers not holding pluginMu.
+func pluginHasPermission(owner, perm string) bool {
+	pluginMu.RLock()
+	defer pluginMu.RUnlock()
+	return pluginGranted(owner, perm)
+}
+
+// pluginNeedsConsent reports whether owner requests permissions the user has
+// not approved yet.
+func pluginNeedsConsent(owner string) bool {
+	pluginMu.RLock()
+	defer pluginMu.RUnlock()
+	for _, p := range pluginRequested[owner] {
+		if !pluginGranted(owner, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// grantPluginPermissions records approval of everything owner requests.
+func grantPluginPermissions(owner string) {
+	pluginMu.Lock()
+	if gs.PluginGrants == nil {
+		gs.PluginGrants = map[string][]string{}
+	}
+	gs.PluginGrants[owner] = append([]string(nil), pluginRequested[owner]...)
+	pluginMu.Unlock()
+	settingsDirty = true
+}
+
+// filterPluginExports removes the gt symbols owner has no permission for.
+func filterPluginExports(owner string, m map[string]reflect.Value) {
+	pluginMu.RLock()
+	defer pluginMu.RUnlock()
+	for _, p := range pluginPermissionList {
+		if pluginGranted(owner, p.name) {
+			continue
+		}
+		for _, sym := range p.symbols {
+			delete(m, sym)
+		}
+	}
+}
+
+// pluginPermissionHint suggests the permission to declare when a load error
+// mentions a gt symbol owner has no permission for.
+func pluginPermissionHint(owner, errText string) string {
+	pluginMu.RLock()
+	defer pluginMu.RUnlock()
+	for _, p := range pluginPermissionList {
+		if pluginGranted(owner, p.name) {
+			continue
+		}
+		for _, sym := range p.symbols {
+			if pluginSymbolREs[sym].MatchString(errText) {
+				return fmt.Sprintf(" (gt.%s needs %q in PluginPermissions)", sym, p.name)
+			}
+		}
+	}
+	return ""
+}
+
+// showPluginConsent asks the user to approve owner's permissions and calls
+// allow if they do.
+func showPluginConsent(owner string, allow func()) {
+	pluginMu.RLock()
+	name := pluginDisplayNames[owner]
+	author := pluginAuthors[owner]
+	perms := append([]string(nil), pluginRequested[owner]...)
+	pluginMu.RUnlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s by %s asks to:\n", name, author)
+	for _, p := range perms {
+		b.WriteString("• " + findPluginPermission(p).desc + "\n")
+	}
+	b.WriteString("\nOnly allow plugins you trust.")
+	showPopup("Plugin Permissions", b.String(), []popupButton{
+		{Text: "Cancel"},
+		{Text: "Allow", Color: &eui.ColorDarkGreen, HoverColor: &eui.ColorGreen, Action: func() {
+			grantPluginPermissions(owner)
+			allow()
+		}},
+	})
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParsePluginPermissions(t *testing.T) {
+	src := []byte(`package main
+
+var PluginPermissions = []string{
+	"storage", "Commands",
+	"storage", // duplicate
+	"teleport",
+}
+`)
+	perms, unknown := parsePluginPermissions(src)
+	if !reflect.DeepEqual(perms, []string{"commands", "storage"}) {
+		t.Fatalf("perms = %v", perms)
+	}
+	if !reflect.DeepEqual(unknown, []string{"teleport"}) {
+		t.Fatalf("unknown = %v", unknown)
+	}
+	if perms, _ := parsePluginPermissions([]byte("package main\n")); perms != nil {
+		t.Fatalf("undeclared perms = %v", perms)
+	}
+}
+
+func TestPluginExportsFollowPermissions(t *testing.T) {
+	pluginMu = sync.RWMutex{}
+	pluginRequested = map[string][]string{"plug": {"commands", "storage"}}
+	origGrants := gs.PluginGrants
+	t.Cleanup(func() { gs.PluginGrants = origGrants })
+	gs.PluginGrants = map[string][]string{}
+
+	has := func(sym string) bool {
+		_, ok := exportsForPlugin("plug")["gt/gt"][sym]
+		return ok
+	}
+	if !pluginNeedsConsent("plug") {
+		t.Fatalf("requested permissions did not need consent")
+	}
+	if has("RunCommand") || has("StorageSet") {
+		t.Fatalf("gated symbols exported before consent")
+	}
+	if !has("Players") || !has("On") {
+		t.Fatalf("ungated symbols missing")
+	}
+	if hint := pluginPermissionHint("plug", "undefined selector RunCommand"); !strings.Contains(hint, `"commands"`) {
+		t.Fatalf("hint = %q", hint)
+	}
+
+	grantPluginPermissions("plug")
+	if pluginNeedsConsent("plug") {
+		t.Fatalf("consent still needed after grant")
+	}
+	if !has("RunCommand") || !has("StorageSet") {
+		t.Fatalf("granted symbols missing")
+	}
+	if has("Equip") || has("SetInputText") || has("RegisterTrigger") {
+		t.Fatalf("undeclared symbols exported")
+	}
+	for _, sym := range []string{"RegisterCommand", "KeyPressed", "KeyJustPressed", "MousePressed", "MouseJustPressed", "MouseWheel", "LastClick"} {
+		if has(sym) {
+			t.Fatalf("gt.%s exported without the input permission", sym)
+		}
+	}
+
+	// Asking for more later needs a new approval.
+	pluginRequested["plug"] = []string{"commands", "equipment", "storage"}
+	if !pluginNeedsConsent("plug") || has("Equip") {
+		t.Fatalf("new permission granted without consent")
+	}
+	if pluginNeedsConsent("other") {
+		t.Fatalf("plugin without permissions needs consent")
+	}
+}
+
+// pluginSymbolSources parses the package and maps each gt symbol to the
+// expression exportsForPlugin builds it from, along with every top-level
+// function by name.
+func pluginSymbolSources(t *testing.T) (map[string]ast.Node, map[string]*ast.FuncDecl) {
+	t.Helper()
+	paths, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	funcs := map[string]*ast.FuncDecl{}
+	var exports []ast.Node
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range f.Decls {
+			switch d := d.(type) {
+			case *ast.FuncDecl:
+				if d.Recv == nil {
+					funcs[d.Name.Name] = d
+				}
+				if d.Name.Name == "exportsForPlugin" {
+					exports = append(exports, d)
+				}
+			case *ast.GenDecl:
+				for _, s := range d.Specs {
+					if vs, ok := s.(*ast.ValueSpec); ok && vs.Names[0].Name == "basePluginExports" {
+						exports = append(exports, vs)
+					}
+				}
+			}
+		}
+	}
+	sources := map[string]ast.Node{}
+	key := func(e ast.Expr) string {
+		if lit, ok := e.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			s, _ := strconv.Unquote(lit.Value)
+			return s
+		}
+		return ""
+	}
+	for _, n := range exports {
+		ast.Inspect(n, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.KeyValueExpr:
+				if k := key(n.Key); k != "" {
+					sources[k] = n.Value
+				}
+			case *ast.AssignStmt:
+				if ix, ok := n.Lhs[0].(*ast.IndexExpr); ok {
+					if k := key(ix.Index); k != "" {
+						sources[k] = n.Rhs[0]
+					}
+				}
+			}
+			return true
+		})
+	}
+	return sources, funcs
+}
+
+// TestUngrantedPluginCannotSendOrEquip follows every symbol exported to a
+// plugin without permissions through the functions it names, and fails if
+// any of them can queue a command or change equipment.
+func TestUngrantedPluginCannotSendOrEquip(t *testing.T) {
+	pluginMu = sync.RWMutex{}
+	pluginRequested = map[string][]string{}
+	origGrants := gs.PluginGrants
+	t.Cleanup(func() { gs.PluginGrants = origGrants })
+	gs.PluginGrants = map[string][]string{}
+
+	sources, funcs := pluginSymbolSources(t)
+	sinks := map[string]bool{
+		"enqueueCommand":         true,
+		"queueEquipCommand":      true,
+		"equipInventoryItem":     true,
+		"toggleInventoryEquip":   true,
+		"toggleInventoryEquipAt": true,
+	}
+	// reaches returns the call path from n to a sink, if there is one.
+	var reaches func(n ast.Node, seen map[string]bool, via []string) []string
+	reaches = func(n ast.Node, seen map[string]bool, via []string) []string {
+		var path []string
+		ast.Inspect(n, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if path != nil || !ok || seen[id.Name] {
+				return path == nil
+			}
+			seen[id.Name] = true
+			if sinks[id.Name] {
+				path = append(via, id.Name)
+			} else if fd := funcs[id.Name]; fd != nil && fd.Body != nil {
+				path = reaches(fd.Body, seen, append(via, id.Name))
+			}
+			return path == nil
+		})
+		return path
+	}
+
+	for sym := range exportsForPlugin("plug")["gt/gt"] {
+		src := sources[sym]
+		if src == nil {
+			t.Errorf("no source found for gt.%s", sym)
+			continue
+		}
+		// exportsForPlugin only builds closures; walking into it would
+		// reach every symbol.
+		seen := map[string]bool{"exportsForPlugin": true}
+		if path := reaches(src, seen, nil); path != nil {
+			t.Errorf("gt.%s is ungated but reaches %s", sym, strings.Join(path, " -> "))
+		}
+	}
+
+	// The walk does find the gated paths.
+	for _, sym := range []string{"RunCommand", "EnqueueCommand", "AutoReply", "Equip", "Unequip", "ToggleEquip"} {
+		if reaches(sources[sym], map[string]bool{"exportsForPlugin": true}, nil) == nil {
+			t.Errorf("gt.%s does not reach a command or equip call", sym)
+		}
+	}
+}
+
+func TestKarmaTextNeedsChat(t *testing.T) {
+	pluginMu = sync.RWMutex{}
+	pluginRequested = map[string][]string{"plug": {"chat"}}
+	origGrants := gs.PluginGrants
+	t.Cleanup(func() { gs.PluginGrants = origGrants })
+	gs.PluginGrants = map[string][]string{}
+
+	ev := Event{Name: EventKarma, Karma: &KarmaEvent{Name: "Bob", Good: true, Text: "Bob gave you good karma."}}
+	if got := eventFor("plug", ev).Karma; got.Text != "" || got.Name != "Bob" || !got.Good {
+		t.Errorf("without chat: %+v", got)
+	}
+	if ev.Karma.Text == "" {
+		t.Errorf("original event changed")
+	}
+	grantPluginPermissions("plug")
+	if got := eventFor("plug", ev).Karma; got.Text != ev.Karma.Text {
+		t.Errorf("with chat: %+v", got)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// pluginReloadDebounce is how long plugin files must stay unchanged
+	// before they are reloaded, so an editor's burst of writes reloads once.
+	pluginReloadDebounce = time.Second
+	// pluginStateTimeout bounds how long SaveState may take during a reload.
+	pluginStateTimeout = 2 * time.Second
+)
+
+var (
+	pluginModTimes    map[string]time.Time // sources as last loaded
+	pluginPendingMods map[string]time.Time // sources as last seen
+	pluginModChanged  time.Time            // when pluginPendingMods last changed
+	pluginStateSavers = map[string]func() any{}
+	pluginLoadErrors  = map[string]string{}
+)
+
+// pluginErrorLineLen is how many characters of a compile error fit on one
+// line of the Plugins window.
+const pluginErrorLineLen = 40
+
+// pluginSourceMods returns the modification time of every plugin source.
+func pluginSourceMods() map[string]time.Time {
+	mods := map[string]time.Time{}
+	for _, dir := range []string{userPluginsDir(), "plugins"} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasSuffix(e.Name(), ".go") {
+				continue
+			}
+			if info, err := e.Info(); err == nil {
+				mods[filepath.Join(dir, e.Name())] = info.ModTime()
+			}
+		}
+	}
+	return mods
+}
+
+func refreshPluginMod() {
+	pluginModTimes = pluginSourceMods()
+	pluginPendingMods = pluginModTimes
+}
+
+// checkPluginMods polls the plugin folders from Update and reloads what
+// changed once the files have settled for pluginReloadDebounce.
+func checkPluginMods() {
+	if time.Since(pluginModCheck) < 500*time.Millisecond {
+		return
+	}
+	pluginModCheck = time.Now()
+	mods := pluginSourceMods()
+	if !maps.Equal(mods, pluginPendingMods) {
+		pluginPendingMods = mods
+		pluginModChanged = pluginModCheck
+		return
+	}
+	if maps.Equal(mods, pluginModTimes) || time.Since(pluginModChanged) < pluginReloadDebounce {
+		return
+	}
+	old := pluginModTimes
+	pluginModTimes = mods
+	reloadChangedPlugins(old, mods)
+}
+
+// reloadChangedPlugins hot reloads running plugins whose source changed.
+// New, removed or renamed plugins, and changes to permissions, go through
+// rescanPlugins instead.
+func reloadChangedPlugins(old, mods map[string]time.Time) {
+	rescan := false
+	for path := range old {
+		if _, ok := mods[path]; !ok {
+			rescan = true
+		}
+	}
+	var changed []string
+	for path, t := range mods {
+		prev, ok := old[path]
+		if !ok {
+			rescan = true
+		} else if !t.Equal(prev) {
+			changed = append(changed, path)
+		}
+	}
+	if len(changed) == 0 {
+		if rescan {
+			rescanPlugins()
+		}
+		return
+	}
+	scanned := scanPlugins([]string{userPluginsDir(), "plugins"}, nil)
+	byPath := make(map[string]string, len(scanned))
+	for o, info := range scanned {
+		byPath[info.path] = o
+	}
+	slices.Sort(changed)
+	for _, path := range changed {
+		owner, ok := byPath[path]
+		if !ok {
+			rescan = true
+			continue
+		}
+		info := scanned[owner]
+		pluginMu.RLock()
+		_, known := pluginPaths[owner]
+		running := known && !pluginDisabled[owner]
+		samePerms := slices.Equal(pluginRequested[owner], info.permissions)
+		pluginMu.RUnlock()
+		if !running || info.invalid || !samePerms {
+			// The old error no longer describes the source; loading it
+			// again reports a new one.
+			pluginMu.Lock()
+			delete(pluginLoadErrors, owner)
+			pluginMu.Unlock()
+			rescan = true
+			continue
+		}
+		pluginMu.Lock()
+		pluginAuthors[owner] = info.author
+		pluginCategories[owner] = info.category
+		pluginSubCategories[owner] = info.subCategory
+		pluginMu.Unlock()
+		hotReloadPlugin(owner, info.src)
+	}
+	if rescan {
+		rescanPlugins()
+	} else {
+		refreshPluginsWindow()
+	}
+}
+
+// reloadPlugin reads owner's source again and hot reloads it.
+func reloadPlugin(owner string) {
+	pluginMu.RLock()
+	path := pluginPaths[owner]
+	pluginMu.RUnlock()
+	src, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("read plugin %s: %v", path, err)
+		consoleMessage("[plugin] read error for " + path + ": " + err.Error())
+		return
+	}
+	hotReloadPlugin(owner, src)
+	refreshPluginsWindow()
+}
+
+// hotReloadPlugin replaces the running owner with src. The new source is
+// compiled first; if that fails the running version is kept and the error
+// is shown in the Plugins window. Otherwise the old version's SaveState
+// result is handed to the new version's RestoreState.
+func hotReloadPlugin(owner string, src []byte) {
+	pluginMu.RLock()
+	name := pluginDisplayNames[owner]
+	path := pluginPaths[owner]
+	pluginMu.RUnlock()
+
+	i, err := compilePluginSource(owner, src, restrictedStdlib())
+	if err != nil {
+		msg := err.Error() + pluginPermissionHint(owner, err.Error())
+		log.Printf("plugin %s: %v", path, err)
+		consoleMessage("[plugin] reload error for " + path + ": " + msg + "; keeping the running version")
+		setPluginLoadError(owner, msg)
+		return
+	}
+	state, saved := savePluginState(owner)
+	disablePlugin(owner, "reloaded")
+	pluginMu.Lock()
+	pluginDisabled[owner] = false
+	pluginMu.Unlock()
+	startPlugin(owner, i, state, saved)
+	log.Printf("reloaded plugin %s", path)
+	consoleMessage("[plugin] reloaded: " + name)
+}
+
+// savePluginState calls owner's SaveState, giving up after
+// pluginStateTimeout or if it panics.
+func savePluginState(owner string) (any, bool) {
+	pluginMu.RLock()
+	save := pluginStateSavers[owner]
+	pluginMu.RUnlock()
+	if save == nil {
+		return nil, false
+	}
+	type result struct {
+		state any
+		ok    bool
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[plugin] SaveState panic in %s: %v", owner, r)
+				done <- result{}
+			}
+		}()
+		done <- result{save(), true}
+	}()
+	select {
+	case r := <-done:
+		return r.state, r.ok
+	case <-time.After(pluginStateTimeout):
+		consoleMessage(fmt.Sprintf("[plugin:%s] SaveState took too long; reloading without state", pluginDisplayName(owner)))
+		return nil, false
+	}
+}
+
+func setPluginLoadError(owner, msg string) {
+	pluginMu.Lock()
+	pluginLoadErrors[owner] = msg
+	pluginMu.Unlock()
+	refreshPluginsWindow()
+}
+
+// pluginLoadError returns the last compile error for owner, if the current
+// source failed to load.
+func pluginLoadError(owner string) string {
+	pluginMu.RLock()
+	defer pluginMu.RUnlock()
+	return pluginLoadErrors[owner]
+}
+
+// pluginErrorLines breaks a compile error into lines short enough for the
+// Plugins window, splitting at spaces where possible.
+func pluginErrorLines(msg string) []string {
+	var lines []string
+	for _, para := range strings.Split(msg, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			for r := []rune(word); len(r) > pluginErrorLineLen; r = r[pluginErrorLineLen:] {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				lines = append(lines, string(r[:pluginErrorLineLen]))
+				word = string(r[pluginErrorLineLen:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= pluginErrorLineLen:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+const reloadPluginV1 = `package main
+
+import "gt"
+
+var PluginName = "Counter"
+var PluginPermissions = []string{"commands", "chat"}
+
+var count = 41
+
+func Init() {
+	gt.RegisterTrigger("", "hello", func() { gt.RunCommand("/wave") })
+}
+
+func SaveState() any { return count }
+`
+
+const reloadPluginV2 = `package main
+
+import (
+	"fmt"
+	"gt"
+)
+
+var PluginName = "Counter"
+var PluginPermissions = []string{"commands", "chat"}
+
+var count int
+
+func RestoreState(state any) {
+	count = state.(int) + 1
+	gt.EnqueueCommand(fmt.Sprintf("/count %d", count))
+}
+`
+
+func TestHotReloadHandsOffState(t *testing.T) {
+	resetPluginHarness(t)
+	h, err := newPluginHarness("counter.go", []byte(reloadPluginV1), nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	defer h.close()
+
+	hotReloadPlugin(h.owner, []byte(reloadPluginV2))
+	if err := h.run(strings.NewReader("expect /count 42\nchat Bob says, \"hello\"\nexpect-none")); err != nil {
+		t.Fatalf("after reload: %v", err)
+	}
+}
+
+func TestHotReloadCompileErrorKeepsRunning(t *testing.T) {
+	resetPluginHarness(t)
+	h, err := newPluginHarness("counter.go", []byte(reloadPluginV1), nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	defer h.close()
+
+	broken := strings.Replace(reloadPluginV1, "return count", "return cuont", 1)
+	hotReloadPlugin(h.owner, []byte(broken))
+	if pluginIsDisabled(h.owner) {
+		t.Fatalf("compile error stopped the running version")
+	}
+	if msg := pluginLoadError(h.owner); !strings.Contains(msg, "cuont") {
+		t.Fatalf("load error = %q", msg)
+	}
+	if err := h.run(strings.NewReader("chat Bob says, \"hello\"\nexpect /wave")); err != nil {
+		t.Fatalf("old version: %v", err)
+	}
+
+	hotReloadPlugin(h.owner, []byte(reloadPluginV1))
+	if msg := pluginLoadError(h.owner); msg != "" {
+		t.Fatalf("error kept after a good reload: %q", msg)
+	}
+}
+
+func TestPluginErrorLines(t *testing.T) {
+	msg := "plugins/counter.go:14:9: undefined: cuont\n" + strings.Repeat("é", pluginErrorLineLen+5)
+	lines := pluginErrorLines(msg)
+	want := []string{"plugins/counter.go:14:9: undefined:", "cuont", strings.Repeat("é", pluginErrorLineLen), "ééééé"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Fatalf("lines = %q", lines)
+	}
+	for _, l := range lines {
+		if utf8.RuneCountInString(l) > pluginErrorLineLen {
+			t.Fatalf("line too long: %q", l)
+		}
+	}
+}
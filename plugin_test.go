@@ -9,25 +9,25 @@ import (
 
 // Test that plugin equip command skips already equipped items.
 func TestPluginEquipAlreadyEquipped(t *testing.T) {
-	resetInventory()
-	addInventoryItem(200, -1, "Shield", true)
-	consoleLog = messageLog{max: maxMessages}
-	pendingCommand = ""
+	mainSession.resetInventory()
+	mainSession.addInventoryItem(200, -1, "Shield", true)
+	mainSession.console = messageLog{max: maxMessages}
+	mainSession.pendingCommand = ""
 	pluginEquip("tester", 200)
 	msgs := getConsoleMessages()
 	if len(msgs) == 0 || msgs[len(msgs)-1] != "Shield already equipped, skipping" {
 		t.Fatalf("unexpected console messages %v", msgs)
 	}
-	if pendingCommand != "" {
-		t.Fatalf("pending command queued: %q", pendingCommand)
+	if mainSession.pendingCommand != "" {
+		t.Fatalf("pending command queued: %q", mainSession.pendingCommand)
 	}
 }
 
 // getQueuedCommands returns the pending command followed by any queued commands.
 func getQueuedCommands() []string {
-	cmds := append([]string{}, commandQueue...)
-	if pendingCommand != "" {
-		cmds = append([]string{pendingCommand}, cmds...)
+	cmds := append([]string{}, mainSession.commandQueue...)
+	if mainSession.pendingCommand != "" {
+		cmds = append([]string{mainSession.pendingCommand}, cmds...)
 	}
 	return cmds
 }
@@ -43,9 +43,9 @@ func TestPluginRegisterAndDisableCommand(t *testing.T) {
 	pluginInvalid = map[string]bool{}
 	pluginEnabledFor = map[string]string{}
 	pluginSendHistory = map[string][]time.Time{}
-	consoleLog = messageLog{max: maxMessages}
-	commandQueue = nil
-	pendingCommand = ""
+	mainSession.console = messageLog{max: maxMessages}
+	mainSession.commandQueue = nil
+	mainSession.pendingCommand = ""
 
 	owner := "tester"
 	pluginRegisterCommand(owner, "MiXeD", func(args string) {
@@ -66,9 +66,9 @@ func TestPluginRegisterAndDisableCommand(t *testing.T) {
 
 	// Disable plugin and ensure pluginRunCommand does nothing.
 	pluginDisabled[owner] = true
-	consoleLog = messageLog{max: maxMessages}
-	commandQueue = nil
-	pendingCommand = ""
+	mainSession.console = messageLog{max: maxMessages}
+	mainSession.commandQueue = nil
+	mainSession.pendingCommand = ""
 
 	pluginRunCommand(owner, "/wave")
 
@@ -87,7 +87,7 @@ func TestDisabledPluginCommandFallsThrough(t *testing.T) {
 	pluginCommands = map[string]PluginCommandHandler{}
 	pluginCommandOwners = map[string]string{}
 	pluginDisabled = map[string]bool{}
-	pendingCommand = ""
+	mainSession.pendingCommand = ""
 
 	owner := "tester"
 	pluginRegisterCommand(owner, "sleep", func(args string) {})
@@ -107,15 +107,15 @@ func TestDisabledPluginCommandFallsThrough(t *testing.T) {
 				consoleMessage("> " + txt)
 				go handler(args)
 			} else {
-				pendingCommand = txt
+				mainSession.pendingCommand = txt
 			}
 		} else {
-			pendingCommand = txt
+			mainSession.pendingCommand = txt
 		}
 	}
 
-	if pendingCommand != "/sleep" {
-		t.Fatalf("pending command %q, want %q", pendingCommand, "/sleep")
+	if mainSession.pendingCommand != "/sleep" {
+		t.Fatalf("pending command %q, want %q", mainSession.pendingCommand, "/sleep")
 	}
 }
 
@@ -125,7 +125,7 @@ func TestPluginRegisterCommandConflict(t *testing.T) {
 	pluginMu = sync.RWMutex{}
 	pluginCommands = map[string]PluginCommandHandler{}
 	pluginCommandOwners = map[string]string{}
-	consoleLog = messageLog{max: maxMessages}
+	mainSession.console = messageLog{max: maxMessages}
 
 	owner1 := "one"
 	owner2 := "two"
@@ -134,7 +134,7 @@ func TestPluginRegisterCommandConflict(t *testing.T) {
 	pluginRegisterCommand(owner1, "cmd", func(args string) { ran = true })
 
 	// Clear console messages before second registration attempt.
-	consoleLog = messageLog{max: maxMessages}
+	mainSession.console = messageLog{max: maxMessages}
 
 	pluginRegisterCommand(owner2, "cmd", func(args string) {})
 
@@ -229,7 +229,7 @@ func TestDisablePluginRemovesHandlers(t *testing.T) {
 	pluginCommandOwners = map[string]string{}
 	pluginCommands = map[string]PluginCommandHandler{}
 	pluginSendHistory = map[string][]time.Time{}
-	consoleLog = messageLog{max: maxMessages}
+	mainSession.console = messageLog{max: maxMessages}
 	origDir := dataDirPath
 	dataDirPath = t.TempDir()
 	t.Cleanup(func() { dataDirPath = origDir })
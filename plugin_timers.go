@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"sync"
+	"time"
+)
+
+const (
+	// pluginTimerLimit caps how many timers one plugin may have pending.
+	pluginTimerLimit = 64
+	// pluginMinInterval is the shortest gt.Every period.
+	pluginMinInterval = 10 * time.Millisecond
+	// pluginCallbackTimeout is how long a timer callback may run before the
+	// watchdog stops its plugin.
+	pluginCallbackTimeout = 10 * time.Second
+)
+
+type pluginTimer struct {
+	id      int
+	owner   string
+	due     time.Time
+	every   time.Duration
+	frame   bool
+	fn      func()
+	started time.Time // zero unless the callback is running
+}
+
+var (
+	pluginTimers       = map[int]*pluginTimer{}
+	pluginTimerNextID  int
+	pluginTimersMu     sync.Mutex
+	pluginTimerRunning = map[string]int{}
+)
+
+// addPluginTimer registers t for owner and returns its id, or 0 when the
+// plugin is disabled or over its limit.
+func addPluginTimer(owner string, t *pluginTimer) int {
+	if pluginIsDisabled(owner) || t.fn == nil {
+		return 0
+	}
+	pluginTimersMu.Lock()
+	n := 0
+	for _, o := range pluginTimers {
+		if o.owner == owner {
+			n++
+		}
+	}
+	if n >= pluginTimerLimit {
+		pluginTimersMu.Unlock()
+		consoleMessage(fmt.Sprintf("[plugin:%s] timer limit of %d reached", pluginDisplayName(owner), pluginTimerLimit))
+		return 0
+	}
+	pluginTimerNextID++
+	t.id = pluginTimerNextID
+	t.owner = owner
+	pluginTimers[t.id] = t
+	pluginTimersMu.Unlock()
+	return t.id
+}
+
+func pluginAfter(owner string, d time.Duration, fn func()) int {
+	return addPluginTimer(owner, &pluginTimer{due: time.Now().Add(d), fn: fn})
+}
+
+func pluginEvery(owner string, d time.Duration, fn func()) int {
+	if d < pluginMinInterval {
+		d = pluginMinInterval
+	}
+	return addPluginTimer(owner, &pluginTimer{due: time.Now().Add(d), every: d, fn: fn})
+}
+
+func pluginOnFrame(owner string, fn func()) int {
+	return addPluginTimer(owner, &pluginTimer{frame: true, fn: fn})
+}
+
+// pluginCancel stops one of owner's timers.
+func pluginCancel(owner string, id int) {
+	pluginTimersMu.Lock()
+	if t, ok := pluginTimers[id]; ok && t.owner == owner {
+		delete(pluginTimers, id)
+	}
+	pluginTimersMu.Unlock()
+}
+
+// pluginCancelTimers stops every timer owned by owner.
+func pluginCancelTimers(owner string) {
+	pluginTimersMu.Lock()
+	for id, t := range pluginTimers {
+		if t.owner == owner {
+			delete(pluginTimers, id)
+		}
+	}
+	pluginTimersMu.Unlock()
+}
+
+// runPluginTimers fires due timers and frame callbacks and starts a new
+// overlay frame. It is called once per tick from Update, or from the
+// headless tick loop. A callback that is still running from an earlier tick
+// is skipped rather than started again.
+func runPluginTimers(now time.Time) {
+	pluginTimersMu.Lock()
+	busy := maps.Clone(pluginTimerRunning)
+	var due []*pluginTimer
+	for _, t := range pluginTimers {
+		if !t.started.IsZero() {
+			continue
+		}
+		if !t.frame && now.Before(t.due) {
+			continue
+		}
+		due = append(due, t)
+		t.started = now
+		pluginTimerRunning[t.owner]++
+		if t.every > 0 {
+			t.due = t.due.Add(t.every)
+			if t.due.Before(now) {
+				t.due = now.Add(t.every)
+			}
+		}
+	}
+	pluginTimersMu.Unlock()
+	flipPluginOverlays(busy)
+	for _, t := range due {
+		pluginGo(t.owner, func() { runPluginTimer(t) })
+	}
+}
+
+// waitPluginTimers waits up to timeout for the callbacks runPluginTimers
+// started to return, for callers that step time themselves.
+func waitPluginTimers(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		pluginTimersMu.Lock()
+		busy := len(pluginTimerRunning) > 0
+		pluginTimersMu.Unlock()
+		if !busy {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func runPluginTimer(t *pluginTimer) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[plugin] timer panic in %s: %v", t.owner, r)
+			disablePlugin(t.owner, fmt.Sprintf("timer panic: %v", r))
+		}
+		pluginTimersMu.Lock()
+		t.started = time.Time{}
+		if !t.frame && t.every == 0 && pluginTimers[t.id] == t {
+			delete(pluginTimers, t.id)
+		}
+		if pluginTimerRunning[t.owner]--; pluginTimerRunning[t.owner] <= 0 {
+			delete(pluginTimerRunning, t.owner)
+		}
+		pluginTimersMu.Unlock()
+	}()
+	t.fn()
+}
+
+// pluginTimerOffenders returns plugins with a callback running longer than
+// pluginCallbackTimeout.
+func pluginTimerOffenders(now time.Time) (stuck []string) {
+	pluginTimersMu.Lock()
+	defer pluginTimersMu.Unlock()
+	seen := map[string]bool{}
+	for _, t := range pluginTimers {
+		if !t.started.IsZero() && now.Sub(t.started) > pluginCallbackTimeout && !seen[t.owner] {
+			seen[t.owner] = true
+			stuck = append(stuck, t.owner)
+		}
+	}
+	return stuck
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func resetPluginTimers() {
+	pluginTimers = map[int]*pluginTimer{}
+	pluginTimerRunning = map[string]int{}
+	pluginTimerNextID = 0
+	pluginTimersMu = sync.Mutex{}
+	pluginMu = sync.RWMutex{}
+	pluginDisabled = map[string]bool{}
+	pluginDisplayNames = map[string]string{}
+	mainSession.console = messageLog{max: maxMessages}
+}
+
+func TestPluginTimers(t *testing.T) {
+	resetPluginTimers()
+	now := time.Now()
+	fired := make(chan string, 16)
+	after := pluginAfter("plug", time.Minute, func() { fired <- "after" })
+	pluginEvery("plug", time.Second, func() { fired <- "every" })
+	frame := pluginOnFrame("plug", func() { fired <- "frame" })
+	if after == 0 || frame == 0 {
+		t.Fatalf("timers not registered")
+	}
+
+	runPluginTimers(now)
+	if got := <-fired; got != "frame" {
+		t.Fatalf("first tick fired %q", got)
+	}
+	waitTimersIdle(t)
+
+	pluginCancel("other", frame)
+	pluginCancel("plug", frame)
+	runPluginTimers(now.Add(2 * time.Minute))
+	got := map[string]bool{<-fired: true, <-fired: true}
+	if !got["after"] || !got["every"] {
+		t.Fatalf("fired %v", got)
+	}
+	waitTimersIdle(t)
+	if _, ok := pluginTimers[after]; ok {
+		t.Fatalf("one-shot timer kept after firing")
+	}
+	if len(pluginTimers) != 1 {
+		t.Fatalf("timers = %v", pluginTimers)
+	}
+	pluginCancelTimers("plug")
+	if len(pluginTimers) != 0 {
+		t.Fatalf("timers left after cancel: %v", pluginTimers)
+	}
+}
+
+func waitTimersIdle(t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		pluginTimersMu.Lock()
+		n := len(pluginTimerRunning)
+		pluginTimersMu.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("callbacks still running")
+}
+
+func TestPluginTimerSkipsBusyAndFindsOffenders(t *testing.T) {
+	resetPluginTimers()
+	release := make(chan struct{})
+	var calls int
+	var mu sync.Mutex
+	pluginOnFrame("slow", func() {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		<-release
+	})
+	now := time.Now()
+	runPluginTimers(now)
+	runPluginTimers(now.Add(time.Second))
+
+	stuck := pluginTimerOffenders(now.Add(pluginCallbackTimeout + time.Second))
+	if len(stuck) != 1 || stuck[0] != "slow" {
+		t.Fatalf("offenders = %v", stuck)
+	}
+	pluginGoroutinesMu.Lock()
+	n := pluginGoroutines["slow"]
+	pluginGoroutinesMu.Unlock()
+	if n != 1 {
+		t.Fatalf("timer goroutines counted for slow = %d", n)
+	}
+	close(release)
+	waitTimersIdle(t)
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Fatalf("busy frame callback started %d times", calls)
+	}
+}
+
+func TestPluginTimerLimit(t *testing.T) {
+	resetPluginTimers()
+	for i := 0; i < pluginTimerLimit; i++ {
+		if pluginAfter("plug", time.Hour, func() {}) == 0 {
+			t.Fatalf("timer %d rejected", i)
+		}
+	}
+	if pluginAfter("plug", time.Hour, func() {}) != 0 {
+		t.Fatalf("timer over the limit accepted")
+	}
+	pluginDisabled["other"] = true
+	if pluginEvery("other", time.Second, func() {}) != 0 {
+		t.Fatalf("disabled plugin added a timer")
+	}
+}
+
+func TestPluginGoroutineHogs(t *testing.T) {
+	resetPluginTimers()
+	pluginGoroutinesMu.Lock()
+	clear(pluginGoroutines)
+	pluginGoroutinesMu.Unlock()
+	release := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		pluginGo("hog", func() { <-release })
+	}
+	pluginGo("quiet", func() { <-release })
+	if hogs := pluginGoroutineHogs(3); len(hogs) != 1 || hogs[0] != "hog" {
+		t.Fatalf("hogs = %v", hogs)
+	}
+	pluginDisabled["hog"] = true
+	if hogs := pluginGoroutineHogs(3); len(hogs) != 0 {
+		t.Fatalf("disabled plugin reported again: %v", hogs)
+	}
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		pluginGoroutinesMu.Lock()
+		n := len(pluginGoroutines)
+		pluginGoroutinesMu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines still counted: %v", pluginGoroutines)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
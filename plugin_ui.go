@@ -0,0 +1,277 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"gothoom/eui"
+)
+
+// pluginWidgetWidth is the width of items plugins add to their windows.
+const pluginWidgetWidth = 240
+
+type pluginWindow struct {
+	owner string
+	win   *eui.WindowData
+	flow  *eui.ItemData
+}
+
+type pluginItem struct {
+	owner string
+	item  *eui.ItemData
+}
+
+var (
+	pluginWindows   = map[int]*pluginWindow{}
+	pluginItems     = map[int]*pluginItem{}
+	pluginUINextID  int
+	pluginUIQueue   []func()
+	pluginWindowsMu sync.Mutex
+)
+
+// queuePluginUI defers fn to the next Update so plugin goroutines never
+// touch eui while it is drawing.
+func queuePluginUI(fn func()) {
+	pluginWindowsMu.Lock()
+	pluginUIQueue = append(pluginUIQueue, fn)
+	pluginWindowsMu.Unlock()
+}
+
+// runPluginUIQueue applies queued plugin window changes. Called from Update.
+func runPluginUIQueue() {
+	pluginWindowsMu.Lock()
+	q := pluginUIQueue
+	pluginUIQueue = nil
+	pluginWindowsMu.Unlock()
+	for _, fn := range q {
+		fn()
+	}
+}
+
+// pluginNewWindow creates a hidden window owned by owner and returns its
+// handle. The window's zone is restored from WindowZones under
+// pluginZoneKey.
+func pluginNewWindow(owner, title string) int {
+	if pluginIsDisabled(owner) || title == "" {
+		return 0
+	}
+	win := eui.NewWindow()
+	win.Title = title
+	win.Closable = true
+	win.Movable = true
+	win.Resizable = false
+	win.AutoSize = true
+	flow := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL}
+	win.AddItem(flow)
+
+	pluginWindowsMu.Lock()
+	pluginUINextID++
+	id := pluginUINextID
+	pluginWindows[id] = &pluginWindow{owner: owner, win: win, flow: flow}
+	pluginWindowsMu.Unlock()
+
+	queuePluginUI(func() {
+		if st, ok := gs.WindowZones[pluginZoneKey(owner, title)]; ok && st.Zoned {
+			win.SetZone(st.Zone.H, st.Zone.V)
+		} else if !ok {
+			win.SetZone(eui.HZoneCenter, eui.VZoneMiddleTop)
+		}
+		win.AddWindow(false)
+	})
+	return id
+}
+
+// pluginWindowFor returns owner's window with handle id.
+func pluginWindowFor(owner string, id int) *pluginWindow {
+	pluginWindowsMu.Lock()
+	defer pluginWindowsMu.Unlock()
+	pw := pluginWindows[id]
+	if pw == nil || pw.owner != owner {
+		return nil
+	}
+	return pw
+}
+
+// addPluginItem registers item under owner and appends it to window id.
+func addPluginItem(owner string, id int, item *eui.ItemData) int {
+	pw := pluginWindowFor(owner, id)
+	if pw == nil || pluginIsDisabled(owner) {
+		return 0
+	}
+	item.Size = eui.Point{X: pluginWidgetWidth, Y: 24}
+	pluginWindowsMu.Lock()
+	pluginUINextID++
+	itemID := pluginUINextID
+	pluginItems[itemID] = &pluginItem{owner: owner, item: item}
+	pluginWindowsMu.Unlock()
+	queuePluginUI(func() {
+		pw.flow.AddItem(item)
+		pw.win.Refresh()
+	})
+	return itemID
+}
+
+func pluginAddText(owner string, win int, text string) int {
+	t, _ := eui.NewText()
+	t.Text = text
+	return addPluginItem(owner, win, t)
+}
+
+func pluginAddButton(owner string, win int, text string, fn func()) int {
+	btn, events := eui.NewButton()
+	btn.Text = text
+	events.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick && fn != nil && !pluginIsDisabled(owner) {
+			pluginGo(owner, fn)
+		}
+	}
+	return addPluginItem(owner, win, btn)
+}
+
+func pluginAddSlider(owner string, win int, label string, min, max, value float64, fn func(float64)) int {
+	s, events := eui.NewSlider()
+	s.Label = label
+	s.MinValue = float32(min)
+	s.MaxValue = float32(max)
+	s.Value = float32(value)
+	events.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventSliderChanged && fn != nil && !pluginIsDisabled(owner) {
+			v := float64(ev.Value)
+			pluginGo(owner, func() { fn(v) })
+		}
+	}
+	return addPluginItem(owner, win, s)
+}
+
+func pluginAddInput(owner string, win int, label, value string, fn func(string)) int {
+	in, events := eui.NewInput()
+	in.Label = label
+	in.Text = value
+	events.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventInputChanged && fn != nil && !pluginIsDisabled(owner) {
+			text := ev.Text
+			pluginGo(owner, func() { fn(text) })
+		}
+	}
+	return addPluginItem(owner, win, in)
+}
+
+// pluginSetText changes the text of a text, button or input item.
+func pluginSetText(owner string, id int, text string) {
+	pluginWindowsMu.Lock()
+	pi := pluginItems[id]
+	pluginWindowsMu.Unlock()
+	if pi == nil || pi.owner != owner {
+		return
+	}
+	queuePluginUI(func() {
+		pi.item.Text = text
+		pi.item.Dirty = true
+	})
+}
+
+func pluginShowWindow(owner string, id int) {
+	if pw := pluginWindowFor(owner, id); pw != nil && !pluginIsDisabled(owner) {
+		queuePluginUI(pw.win.MarkOpen)
+	}
+}
+
+func pluginCloseWindow(owner string, id int) {
+	if pw := pluginWindowFor(owner, id); pw != nil {
+		queuePluginUI(pw.win.Close)
+	}
+}
+
+// pluginRemoveWindows closes and forgets every window owned by owner.
+func pluginRemoveWindows(owner string) {
+	pluginWindowsMu.Lock()
+	var wins []*eui.WindowData
+	for id, pw := range pluginWindows {
+		if pw.owner == owner {
+			wins = append(wins, pw.win)
+			delete(pluginWindows, id)
+		}
+	}
+	for id, pi := range pluginItems {
+		if pi.owner == owner {
+			delete(pluginItems, id)
+		}
+	}
+	pluginWindowsMu.Unlock()
+	for _, win := range wins {
+		win := win
+		queuePluginUI(func() {
+			// Remember where the window was so it reopens there.
+			if gs.WindowZones == nil {
+				gs.WindowZones = map[string]eui.WindowZoneState{}
+			}
+			gs.WindowZones[pluginZoneKey(owner, win.Title)] = win.ZoneState()
+			if win.Open {
+				win.Close()
+			}
+			win.RemoveWindow()
+		})
+	}
+}
+
+// pluginZonePrefix starts the WindowZones keys of plugin windows.
+const pluginZonePrefix = "plugin:"
+
+// pluginZoneKey is the WindowZones key of a plugin window. Keying by owner
+// keeps plugin windows from sharing a zone with a built-in window or another
+// plugin's window of the same title.
+func pluginZoneKey(owner, title string) string {
+	return pluginZonePrefix + owner + ":" + title
+}
+
+// windowZones returns the zone table to save: built-in windows by title,
+// plugin windows by pluginZoneKey.
+func windowZones() map[string]eui.WindowZoneState {
+	pluginWindowsMu.Lock()
+	keys := make(map[*eui.WindowData]string, len(pluginWindows))
+	for _, pw := range pluginWindows {
+		keys[pw.win] = pluginZoneKey(pw.owner, pw.win.Title)
+	}
+	pluginWindowsMu.Unlock()
+	zones := map[string]eui.WindowZoneState{}
+	for _, win := range eui.Windows() {
+		key, ok := keys[win]
+		if !ok {
+			key = win.Title
+		}
+		zones[key] = win.ZoneState()
+	}
+	keepPluginWindowZones(zones)
+	return zones
+}
+
+// keepPluginWindowZones carries saved zones for plugin windows that are not
+// currently loaded, such as those of disabled plugins, into zones. Other
+// stale keys are dropped.
+func keepPluginWindowZones(zones map[string]eui.WindowZoneState) {
+	for key, st := range gs.WindowZones {
+		if !strings.HasPrefix(key, pluginZonePrefix) {
+			continue
+		}
+		if _, ok := zones[key]; !ok {
+			zones[key] = st
+		}
+	}
+}
+
+// restorePluginWindowZones reapplies saved zones to open plugin windows,
+// which eui.LoadWindowZones does not know by their keys.
+func restorePluginWindowZones() {
+	pluginWindowsMu.Lock()
+	defer pluginWindowsMu.Unlock()
+	for _, pw := range pluginWindows {
+		st, ok := gs.WindowZones[pluginZoneKey(pw.owner, pw.win.Title)]
+		switch {
+		case !ok:
+		case st.Zoned:
+			pw.win.SetZone(st.Zone.H, st.Zone.V)
+		default:
+			pw.win.ClearZone()
+		}
+	}
+}
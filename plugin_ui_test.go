@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"gothoom/eui"
+)
+
+func resetPluginWindows() {
+	pluginWindows = map[int]*pluginWindow{}
+	pluginItems = map[int]*pluginItem{}
+	pluginUINextID = 0
+	pluginUIQueue = nil
+	pluginWindowsMu = sync.Mutex{}
+	pluginMu = sync.RWMutex{}
+	pluginDisabled = map[string]bool{}
+}
+
+func TestPluginWindowOwnership(t *testing.T) {
+	resetPluginWindows()
+	win := pluginNewWindow("plug", "Plug Settings")
+	if win == 0 {
+		t.Fatalf("window not created")
+	}
+	txt := pluginAddText("plug", win, "hello")
+	if txt == 0 {
+		t.Fatalf("text not added")
+	}
+	if pluginAddButton("other", win, "steal", func() {}) != 0 {
+		t.Fatalf("another plugin added to the window")
+	}
+	pluginSetText("other", txt, "changed")
+	runPluginUIQueue()
+	if got := pluginItems[txt].item.Text; got != "hello" {
+		t.Fatalf("text = %q after another plugin's SetText", got)
+	}
+	pluginSetText("plug", txt, "bye")
+	runPluginUIQueue()
+	if got := pluginItems[txt].item.Text; got != "bye" {
+		t.Fatalf("text = %q", got)
+	}
+
+	pluginRemoveWindows("plug")
+	if len(pluginWindows) != 0 || len(pluginItems) != 0 {
+		t.Fatalf("windows not removed: %v %v", pluginWindows, pluginItems)
+	}
+	runPluginUIQueue()
+	if pluginAddText("plug", win, "late") != 0 {
+		t.Fatalf("added to a removed window")
+	}
+}
+
+func TestKeepPluginWindowZones(t *testing.T) {
+	orig := gs.WindowZones
+	t.Cleanup(func() { gs.WindowZones = orig })
+	saved := eui.WindowZoneState{Zoned: true, Zone: eui.WindowZone{H: eui.HZoneRight, V: eui.VZoneTop}}
+	key := pluginZoneKey("plug", "Players")
+	gs.WindowZones = map[string]eui.WindowZoneState{key: saved, "Players": {}, "Old Plugin Window": saved}
+	zones := map[string]eui.WindowZoneState{"Players": {Zoned: true}}
+	keepPluginWindowZones(zones)
+	if zones[key] != saved || !zones["Players"].Zoned {
+		t.Fatalf("zones = %+v", zones)
+	}
+	if _, ok := zones["Old Plugin Window"]; ok {
+		t.Fatalf("kept a stale zone that is not a plugin window's: %+v", zones)
+	}
+}
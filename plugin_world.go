@@ -0,0 +1,88 @@
+package main
+
+import "strings"
+
+// Picture is a read-only copy of a picture placed in the current frame.
+type Picture struct {
+	PictID     uint16
+	H, V       int16
+	Plane      int
+	Moving     bool
+	Background bool
+}
+
+// pluginMobiles returns the current frame's mobiles sorted top to bottom
+// then left to right. It reads state.mobiles rather than the render cache,
+// which headless runs and movie tools never build.
+func pluginMobiles() []Mobile {
+	return focusedSession().pluginMobiles()
+}
+
+func (s *session) pluginMobiles() []Mobile {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	mobs := make([]frameMobile, 0, len(s.state.mobiles))
+	for _, m := range s.state.mobiles {
+		mobs = append(mobs, m)
+	}
+	sortMobiles(mobs)
+	out := make([]Mobile, 0, len(mobs))
+	for _, m := range mobs {
+		mob := Mobile{
+			Index:  m.Index,
+			H:      m.H,
+			V:      m.V,
+			Colors: m.Colors,
+			State:  m.State,
+			Fallen: m.State == poseDead,
+		}
+		if d, ok := s.state.descriptors[m.Index]; ok {
+			mob.Name = d.Name
+			mob.PictID = d.PictID
+		}
+		out = append(out, mob)
+	}
+	return out
+}
+
+func pluginPictures() []Picture {
+	snap := focusedSession().captureDrawSnapshot()
+	out := make([]Picture, 0, len(snap.pictures))
+	for _, p := range snap.pictures {
+		out = append(out, Picture{
+			PictID:     p.PictID,
+			H:          p.H,
+			V:          p.V,
+			Plane:      p.Plane,
+			Moving:     p.Moving,
+			Background: p.Background,
+		})
+	}
+	return out
+}
+
+// pluginSelfPosition returns the player's mobile position. ok is false
+// while the player's mobile is not on screen.
+func pluginSelfPosition() (h, v int16, ok bool) {
+	s := focusedSession()
+	for _, m := range s.pluginMobiles() {
+		if m.Index == s.playerIndex {
+			return m.H, m.V, true
+		}
+	}
+	return 0, 0, false
+}
+
+// pluginMobileByName finds a visible mobile by name, ignoring case.
+func pluginMobileByName(name string) (Mobile, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Mobile{}, false
+	}
+	for _, m := range pluginMobiles() {
+		if strings.EqualFold(m.Name, name) {
+			return m, true
+		}
+	}
+	return Mobile{}, false
+}
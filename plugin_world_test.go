@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	"gothoom/mockserver"
+)
+
+func TestPluginWorldState(t *testing.T) {
+	resetState()
+	origIndex := mainSession.playerIndex
+	t.Cleanup(func() {
+		mainSession.playerIndex = origIndex
+		resetState()
+	})
+	mainSession.playerIndex = 1
+
+	mainSession.stateMu.Lock()
+	mainSession.state.descriptors[1] = frameDescriptor{Index: 1, Name: "Me", PictID: 447}
+	mainSession.state.descriptors[2] = frameDescriptor{Index: 2, Name: "Bob", PictID: 448}
+	mainSession.state.mobiles[1] = frameMobile{Index: 1, H: 0, V: 0}
+	mainSession.state.mobiles[2] = frameMobile{Index: 2, H: 30, V: -12, State: poseDead}
+	mainSession.state.pictures = []framePicture{{PictID: 9, H: 5, V: 6, Plane: 1}}
+	mainSession.stateMu.Unlock()
+
+	mobs := pluginMobiles()
+	if len(mobs) != 2 {
+		t.Fatalf("mobiles = %+v", mobs)
+	}
+	bob, ok := pluginMobileByName("bob")
+	if !ok || !bob.Fallen || bob.PictID != 448 || bob.H != 30 || bob.V != -12 {
+		t.Fatalf("MobileByName = %+v, %v", bob, ok)
+	}
+	if _, ok := pluginMobileByName("Carol"); ok {
+		t.Fatalf("found a mobile that is not on screen")
+	}
+	if h, v, ok := pluginSelfPosition(); !ok || h != 0 || v != 0 {
+		t.Fatalf("SelfPosition = %d,%d,%v", h, v, ok)
+	}
+	if pics := pluginPictures(); len(pics) != 1 || pics[0] != (Picture{PictID: 9, H: 5, V: 6, Plane: 1}) {
+		t.Fatalf("pictures = %+v", pics)
+	}
+
+	mainSession.playerIndex = 7
+	if _, _, ok := pluginSelfPosition(); ok {
+		t.Fatalf("SelfPosition found an off-screen player")
+	}
+}
+
+// Headless runs and movie tools apply draw states without building the
+// render cache; plugins must still see the mobiles.
+func TestPluginWorldStateWithoutRenderCache(t *testing.T) {
+	resetState()
+	origIndex := mainSession.playerIndex
+	t.Cleanup(func() {
+		mainSession.playerIndex = origIndex
+		resetState()
+	})
+	mainSession.playerIndex = 1
+
+	mainSession.handleDrawState(mockserver.Frame{
+		AckFrame: 1,
+		Descriptors: []mockserver.Descriptor{
+			{Index: 1, Name: "Me", PictID: 447},
+			{Index: 2, Name: "Bob", PictID: 448},
+		},
+		Mobiles: []mockserver.Mobile{
+			{Index: 2, H: 30, V: -12},
+			{Index: 1, H: 4, V: -20},
+		},
+	}.Encode(), false)
+
+	mobs := pluginMobiles()
+	if len(mobs) != 2 || mobs[0].Name != "Me" || mobs[1].Name != "Bob" {
+		t.Fatalf("mobiles = %+v", mobs)
+	}
+	if bob, ok := pluginMobileByName("Bob"); !ok || bob.PictID != 448 || bob.H != 30 {
+		t.Fatalf("MobileByName = %+v, %v", bob, ok)
+	}
+	if h, v, ok := pluginSelfPosition(); !ok || h != 4 || v != -20 {
+		t.Fatalf("SelfPosition = %d,%d,%v", h, v, ok)
+	}
+}
@@ -12,32 +12,32 @@ func presenceLine(prefix string, msg []byte) []byte {
 }
 
 func TestDecodeLoginBEPP(t *testing.T) {
-	players = make(map[string]*Player)
-	players["Bob"] = &Player{Name: "Bob", Offline: true}
+	mainSession.players = make(map[string]*Player)
+	mainSession.players["Bob"] = &Player{Name: "Bob", Offline: true}
 	msg := append(pnTag("Bob"), []byte(" has logged on")...)
 	raw := presenceLine("lg", msg)
-	if got := decodeBEPP(raw); got != "Bob has logged on" {
+	if got := mainSession.decodeBEPP(raw); got != "Bob has logged on" {
 		t.Fatalf("decodeBEPP returned %q", got)
 	}
-	playersMu.RLock()
-	offline := players["Bob"].Offline
-	playersMu.RUnlock()
+	mainSession.playersMu.RLock()
+	offline := mainSession.players["Bob"].Offline
+	mainSession.playersMu.RUnlock()
 	if offline {
 		t.Errorf("player still offline")
 	}
 }
 
 func TestDecodeLogoutBEPP(t *testing.T) {
-	players = make(map[string]*Player)
-	players["Bob"] = &Player{Name: "Bob", Offline: false}
+	mainSession.players = make(map[string]*Player)
+	mainSession.players["Bob"] = &Player{Name: "Bob", Offline: false}
 	msg := append(pnTag("Bob"), []byte(" has left the lands")...)
 	raw := presenceLine("lf", msg)
-	if got := decodeBEPP(raw); got != "Bob has left the lands" {
+	if got := mainSession.decodeBEPP(raw); got != "Bob has left the lands" {
 		t.Fatalf("decodeBEPP returned %q", got)
 	}
-	playersMu.RLock()
-	offline := players["Bob"].Offline
-	playersMu.RUnlock()
+	mainSession.playersMu.RLock()
+	offline := mainSession.players["Bob"].Offline
+	mainSession.playersMu.RUnlock()
 	if !offline {
 		t.Errorf("player not marked offline")
 	}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	reconnectMaxDelay = 2 * time.Minute
+	reconnectMaxTries = 10
+)
+
+// reconnectBaseDelay is the wait before the first attempt. It is a
+// variable so tests can shorten it.
+var reconnectBaseDelay = 2 * time.Second
+
+var (
+	reconnectMu      sync.Mutex
+	reconnectCancel  context.CancelFunc
+	reconnectAttempt int
+	// reconnectAt is when the next attempt starts; zero while an attempt
+	// is in progress.
+	reconnectAt time.Time
+)
+
+// transientLoginErrors are kError codes that may clear up on their own, so
+// a reconnect keeps trying. Every other known code is treated as fatal.
+var transientLoginErrors = map[int16]bool{
+	-30992: true, // kShuttingDown
+	-30991: true, // kGameNotOpen
+	-30985: true, // kNoFreeSlot
+	-30981: true, // kCharOnline: the server may not have noticed the drop yet
+	-30975: true, // kBadIdentifiers
+}
+
+// fatalLoginError reports whether retrying after err is pointless, e.g. a
+// bad password or a locked account.
+func fatalLoginError(err error) bool {
+	if errors.Is(err, errClientOutOfDate) {
+		return true
+	}
+	var le *loginError
+	if !errors.As(err, &le) {
+		return false
+	}
+	if _, _, ok := describeKError(le.code); !ok {
+		return false
+	}
+	return !transientLoginErrors[le.code]
+}
+
+// reconnectDelay returns how long to wait before the given attempt
+// (starting at 1). The delay doubles each attempt up to reconnectMaxDelay
+// and jitter, in [0,1), spreads it by ±25% so clients dropped together do
+// not all return at once.
+func reconnectDelay(attempt int, jitter float64) time.Duration {
+	d := float64(reconnectBaseDelay) * math.Pow(2, float64(attempt-1))
+	if d > float64(reconnectMaxDelay) {
+		d = float64(reconnectMaxDelay)
+	}
+	return time.Duration(d * (0.75 + 0.5*jitter))
+}
+
+// handleConnectionLost is called when a network read loop fails. With
+// auto-reconnect enabled the session is torn down without returning to the
+// login window and the last character is logged back in; otherwise it
+// behaves like handleDisconnect.
+func handleConnectionLost() {
+	if !gs.AutoReconnect || headless {
+		handleDisconnect()
+		return
+	}
+	loginMu.Lock()
+	cancel := loginCancel
+	loginCancel = nil
+	loginMu.Unlock()
+	if cancel == nil {
+		// The other read loop already handled it.
+		return
+	}
+	cancel()
+	mainSession.stopMovieRecording()
+	stopClassicMacros()
+	consoleMessage("Connection lost.")
+
+	ctx, stop := context.WithCancel(gameCtx)
+	reconnectMu.Lock()
+	if reconnectCancel != nil {
+		reconnectCancel()
+	}
+	reconnectCancel = stop
+	reconnectAttempt = 0
+	reconnectAt = time.Time{}
+	reconnectMu.Unlock()
+	go reconnectLoop(ctx)
+}
+
+// reconnectLoop retries login until it succeeds, a fatal error is
+// returned, the attempts run out or ctx is canceled.
+func reconnectLoop(ctx context.Context) {
+	var err error
+	for attempt := 1; attempt <= reconnectMaxTries; attempt++ {
+		wait := reconnectDelay(attempt, rand.Float64())
+		reconnectMu.Lock()
+		reconnectAttempt = attempt
+		reconnectAt = time.Now().Add(wait)
+		reconnectMu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		reconnectMu.Lock()
+		reconnectAt = time.Time{}
+		reconnectMu.Unlock()
+		consoleMessage(fmt.Sprintf("Reconnecting (attempt %d of %d)...", attempt, reconnectMaxTries))
+
+		loginCtx, cancel := context.WithCancel(gameCtx)
+		loginMu.Lock()
+		loginCancel = cancel
+		loginMu.Unlock()
+		// On success login blocks for the whole session and
+		// reconnectSucceeded cancels ctx.
+		err = login(loginCtx, clientVersion)
+		if ctx.Err() != nil {
+			return
+		}
+		cancel()
+		loginMu.Lock()
+		loginCancel = nil
+		loginMu.Unlock()
+		logError("reconnect: %v", err)
+		if fatalLoginError(err) {
+			break
+		}
+	}
+	if !cancelReconnect() {
+		return
+	}
+	consoleMessage("Gave up reconnecting.")
+	pass = ""
+	loginWin.MarkOpen()
+	updateCharacterButtons()
+	makeErrorWindow("Error: Login: " + err.Error())
+}
+
+// reconnectSucceeded ends a pending reconnect once login is accepted.
+func reconnectSucceeded() {
+	if cancelReconnect() {
+		consoleMessage("Reconnected.")
+	}
+}
+
+// cancelReconnect stops a pending reconnect and reports whether one was
+// running.
+func cancelReconnect() bool {
+	reconnectMu.Lock()
+	defer reconnectMu.Unlock()
+	if reconnectCancel == nil {
+		return false
+	}
+	reconnectCancel()
+	reconnectCancel = nil
+	reconnectAttempt = 0
+	reconnectAt = time.Time{}
+	return true
+}
+
+// reconnectPending reports whether a reconnect is waiting or in progress.
+func reconnectPending() bool {
+	reconnectMu.Lock()
+	defer reconnectMu.Unlock()
+	return reconnectCancel != nil
+}
+
+// reconnectStatus returns the overlay text for a pending reconnect.
+func reconnectStatus(now time.Time) (string, bool) {
+	reconnectMu.Lock()
+	defer reconnectMu.Unlock()
+	if reconnectCancel == nil {
+		return "", false
+	}
+	if reconnectAt.IsZero() {
+		return fmt.Sprintf("Reconnecting... (attempt %d of %d)", reconnectAttempt, reconnectMaxTries), true
+	}
+	secs := int(math.Ceil(reconnectAt.Sub(now).Seconds()))
+	if secs < 0 {
+		secs = 0
+	}
+	return fmt.Sprintf("Connection lost. Reconnecting in %ds (attempt %d of %d)", secs, reconnectAttempt, reconnectMaxTries), true
+}
+
+// drawReconnectOverlay shows the reconnect countdown over the game view.
+func drawReconnectOverlay(screen *ebiten.Image) {
+	msg, ok := reconnectStatus(time.Now())
+	if !ok {
+		return
+	}
+	w, h := text.Measure(msg, mainFontBold, 0)
+	x := (float64(screen.Bounds().Dx()) - w) / 2
+	y := float64(screen.Bounds().Dy()) / 3
+	const pad = 8
+	vector.DrawFilledRect(screen, float32(x-pad), float32(y-pad), float32(w+2*pad), float32(h+2*pad), color.RGBA{0, 0, 0, 200}, false)
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(x, y)
+	text.Draw(screen, msg, mainFontBold, op)
+}
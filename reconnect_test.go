@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gothoom/mockserver"
+)
+
+func TestReconnectDelay(t *testing.T) {
+	if d := reconnectDelay(1, 0.5); d != reconnectBaseDelay {
+		t.Fatalf("first delay = %v, want %v", d, reconnectBaseDelay)
+	}
+	if d := reconnectDelay(3, 0.5); d != 4*reconnectBaseDelay {
+		t.Fatalf("third delay = %v", d)
+	}
+	lo, hi := reconnectDelay(2, 0), reconnectDelay(2, 0.999)
+	if lo != reconnectBaseDelay*3/2 || hi <= lo || hi > reconnectBaseDelay*5/2 {
+		t.Fatalf("jitter range = %v..%v", lo, hi)
+	}
+	if d := reconnectDelay(30, 0.999); d > reconnectMaxDelay*5/4 {
+		t.Fatalf("delay not capped: %v", d)
+	}
+}
+
+func TestFatalLoginError(t *testing.T) {
+	tests := map[error]bool{
+		&loginError{code: -30998}:                            true,  // kBadCharPass
+		&loginError{code: -30971}:                            true,  // kMachineLockedOut
+		&loginError{code: -30981}:                            false, // kCharOnline
+		&loginError{code: -30992}:                            false, // kShuttingDown
+		&loginError{code: -1}:                                false,
+		errClientOutOfDate:                                   true,
+		fmt.Errorf("tcp connect: boom"):                      false,
+		fmt.Errorf("wrapped: %w", &loginError{code: -30989}): true,
+	}
+	for err, want := range tests {
+		if got := fatalLoginError(err); got != want {
+			t.Errorf("fatalLoginError(%v) = %v, want %v", err, got, want)
+		}
+	}
+}
+
+func TestReconnectAfterServerDrop(t *testing.T) {
+	srv := startMockServer(t, mockserver.Config{Password: "secret", FrameInterval: 10 * time.Millisecond})
+	mainSession.name, pass = "Tester", "secret"
+	origAuto, origDelay := gs.AutoReconnect, reconnectBaseDelay
+	gs.AutoReconnect = true
+	reconnectBaseDelay = 10 * time.Millisecond
+	t.Cleanup(func() { gs.AutoReconnect, reconnectBaseDelay = origAuto, origDelay })
+	mainSession.chat = messageLog{max: maxMessages}
+	mainSession.chat.Add("Bob says, \"before the drop\"")
+
+	startMockLogin(t)
+	waitForLogins(t, srv, 1)
+
+	srv.Disconnect()
+	waitForLogins(t, srv, 1)
+	waitForConsole(t, "Reconnected.")
+	if reconnectPending() {
+		t.Fatalf("reconnect still pending after success")
+	}
+	if got := mainSession.chat.Entries("", false); len(got) != 1 {
+		t.Fatalf("chat history lost: %q", got)
+	}
+	for _, l := range mainSession.console.Entries("", false) {
+		if l == "Disconnected from server." {
+			t.Fatalf("auto-reconnect fell back to the login window")
+		}
+	}
+}
+
+func waitForLogins(t *testing.T, srv *mockserver.Server, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case l := <-srv.Logins():
+			if l.Result != mockserver.ResultOK {
+				t.Fatalf("login rejected: %v", l)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("server never saw login %d", i+1)
+		}
+	}
+}
@@ -1,3 +1,7 @@
 module releaseHelper
 
-go 1.24.3
+go 1.25
+
+require gothoom v0.0.0
+
+replace gothoom => ../
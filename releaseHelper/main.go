@@ -34,6 +34,10 @@ type VersionFile struct {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "patch" {
+		os.Exit(runPatch(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	var (
 		versionPath = flag.String("version-file", "../data/versions.json", "path to versions json")
 		binariesDir = flag.String("dataPath", "../binaries", "directory containing release zips")
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gothoom/keyfile"
+)
+
+const patchUsage = `usage: releaseHelper patch [-o file.gz] [-remove] [-v] <old keyfile> <new keyfile>
+
+Writes a gzip patch keyfile that turns the old CL_Images or CL_Sounds into
+the new one, as fetched by the client's updater. By default the patch is
+named like CL_Images.1352to1353.gz after the version entries and placed
+next to the new file. A patch that inserts, moves or removes entries is an
+ordered patch, which clients from before ordered patches refuse to apply.
+Entries missing from the new file are only removed with -remove. When the
+patch would not be smaller than the new file, none is written: clients
+download the full file when the patch is missing.
+`
+
+// kTypeVersion is the keyfile entry that holds the data version.
+const kTypeVersion = 0x56657273 // 'Vers'
+
+// runPatch diffs two keyfiles, checks that the patch rebuilds the new one
+// exactly and writes it. It returns the process exit code.
+func runPatch(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("patch", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprint(stderr, patchUsage) }
+	out := flags.String("o", "", "patch file to write")
+	remove := flags.Bool("remove", false, "allow the patch to remove entries")
+	verbose := flags.Bool("v", false, "list every changed entry")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+	oldPath, newPath := flags.Arg(0), flags.Arg(1)
+	path, err := writePatch(oldPath, newPath, *out, keyfile.DiffOptions{Remove: *remove}, *verbose, stdout)
+	if err != nil {
+		fmt.Fprintln(stderr, "patch:", err)
+		return 1
+	}
+	if path != "" {
+		fmt.Fprintln(stdout, "wrote", path)
+	}
+	return 0
+}
+
+// writePatch writes the patch and returns its path, or "" when shipping
+// the full file is smaller.
+func writePatch(oldPath, newPath, out string, opts keyfile.DiffOptions, verbose bool, stdout io.Writer) (string, error) {
+	base, err := os.ReadFile(oldPath)
+	if err != nil {
+		return "", err
+	}
+	target, err := os.ReadFile(newPath)
+	if err != nil {
+		return "", err
+	}
+	patch, changes, err := keyfile.Diff(base, target, opts)
+	if err != nil {
+		if !opts.Remove {
+			err = fmt.Errorf("%w (pass -remove)", err)
+		}
+		return "", err
+	}
+	if err := verifyPatch(base, target, patch); err != nil {
+		return "", err
+	}
+
+	var counts [4]int
+	for _, c := range changes {
+		counts[c.Kind]++
+		if verbose {
+			fmt.Fprintf(stdout, "%-7s %s %d (%d -> %d bytes)\n", c.Kind, typeName(c.Type), c.ID, c.OldSize, c.NewSize)
+		}
+	}
+	fmt.Fprintf(stdout, "%d added, %d changed, %d removed, %d moved; patch is %d bytes before compression\n",
+		counts[keyfile.Added], counts[keyfile.Changed], counts[keyfile.Removed], counts[keyfile.Moved], len(patch))
+	if binary.BigEndian.Uint16(patch[0:2]) != 0xffff {
+		fmt.Fprintln(stdout, "note: this is an ordered patch; clients from before ordered patches refuse it instead of applying it")
+	}
+
+	if out == "" {
+		from, err := keyfileVersion(base)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w; name the patch with -o", oldPath, err)
+		}
+		to, err := keyfileVersion(target)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w; name the patch with -o", newPath, err)
+		}
+		out = filepath.Join(filepath.Dir(newPath), fmt.Sprintf("%s.%dto%d.gz", filepath.Base(newPath), from, to))
+	}
+	gzPatch, err := gzipBytes(patch)
+	if err != nil {
+		return "", err
+	}
+	gzTarget, err := gzipBytes(target)
+	if err != nil {
+		return "", err
+	}
+	if len(gzPatch) >= len(gzTarget) {
+		fmt.Fprintf(stdout, "patch (%d bytes) is not smaller than the full file (%d bytes); ship the full file instead\n", len(gzPatch), len(gzTarget))
+		// An older patch under the same name would still be offered.
+		if err := os.Remove(out); err == nil {
+			fmt.Fprintln(stdout, "removed", out)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		return "", nil
+	}
+	return out, os.WriteFile(out, gzPatch, 0o644)
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if _, err := gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// verifyPatch checks that merging patch into base reproduces target byte
+// for byte.
+func verifyPatch(base, target, patch []byte) error {
+	merged, err := keyfile.Merge(base, patch)
+	if err != nil {
+		return fmt.Errorf("apply: %w", err)
+	}
+	if bytes.Equal(merged, target) {
+		return nil
+	}
+	// Merge always writes the canonical layout: header, table, then the
+	// data in table order with no gaps.
+	if entries, err := keyfile.Parse(target); err == nil && !bytes.Equal(keyfile.Build(entries), target) {
+		return errors.New("the new keyfile is not in the canonical layout (free space or out-of-order data), so no patch can rebuild it exactly; ship the full file")
+	}
+	return errors.New("applying the patch does not reproduce the new keyfile")
+}
+
+// keyfileVersion returns the version number stored in a keyfile the way
+// the client's updater reads it.
+func keyfileVersion(data []byte) (int, error) {
+	entries, err := keyfile.Parse(data)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		if e.Type == kTypeVersion && e.ID == 0 && len(e.Data) >= 4 {
+			v := binary.BigEndian.Uint32(e.Data)
+			if v <= 0xff {
+				v <<= 8
+			}
+			return int(v >> 8), nil
+		}
+	}
+	return 0, errors.New("no version entry")
+}
+
+// typeName prints four-character entry types like 'Vers' as text.
+func typeName(t uint32) string {
+	b := binary.BigEndian.AppendUint32(nil, t)
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			return fmt.Sprintf("%#08x", t)
+		}
+	}
+	return "'" + string(b) + "'"
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gothoom/keyfile"
+)
+
+const kTypeImage = 0x496d6167 // 'Imag'
+
+// versionEntry stores v the way release keyfiles do, in the top three
+// bytes.
+func versionEntry(v int) keyfile.Entry {
+	return keyfile.Entry{Type: kTypeVersion, Data: binary.BigEndian.AppendUint32(nil, uint32(v)<<8)}
+}
+
+// randomEntries returns n image entries of incompressible data, so patch
+// sizes compare the way they do for real pictures.
+func randomEntries(r *rand.Rand, n, size int) []keyfile.Entry {
+	entries := make([]keyfile.Entry, n)
+	for i := range entries {
+		data := make([]byte, size)
+		r.Read(data)
+		entries[i] = keyfile.Entry{Type: kTypeImage, ID: uint32(i + 1), Data: data}
+	}
+	return entries
+}
+
+func writeKeyfile(t *testing.T, path string, entries []keyfile.Entry) []byte {
+	t.Helper()
+	data := keyfile.Build(entries)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func readGzip(t *testing.T, path string) []byte {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestWritePatchRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	r := rand.New(rand.NewSource(1))
+	images := randomEntries(r, 8, 4096)
+	oldPath := filepath.Join(dir, "old", "CL_Images")
+	newPath := filepath.Join(dir, "CL_Images")
+	if err := os.Mkdir(filepath.Dir(oldPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	base := writeKeyfile(t, oldPath, append([]keyfile.Entry{versionEntry(1352)}, images...))
+
+	changed := append([]keyfile.Entry(nil), images...)
+	changed[2] = randomEntries(r, 1, 4096)[0]
+	changed[2].ID = images[2].ID
+	target := writeKeyfile(t, newPath, append([]keyfile.Entry{versionEntry(1353)}, changed...))
+
+	if v, err := keyfileVersion(target); err != nil || v != 1353 {
+		t.Fatalf("keyfileVersion = %d, %v", v, err)
+	}
+	var out bytes.Buffer
+	path, err := writePatch(oldPath, newPath, "", keyfile.DiffOptions{}, false, &out)
+	if err != nil {
+		t.Fatalf("writePatch: %v", err)
+	}
+	if want := filepath.Join(dir, "CL_Images.1352to1353.gz"); path != want {
+		t.Fatalf("patch path = %q, want %q", path, want)
+	}
+	patch := readGzip(t, path)
+	if err := verifyPatch(base, target, patch); err != nil {
+		t.Fatalf("verifyPatch: %v", err)
+	}
+	if err := verifyPatch(base, base, patch); err == nil {
+		t.Fatalf("verifyPatch accepted a patch for another file")
+	}
+	if !strings.Contains(out.String(), "0 added, 2 changed, 0 removed") {
+		t.Fatalf("summary = %q", out.String())
+	}
+}
+
+func TestWritePatchSkipsOversizePatch(t *testing.T) {
+	dir := t.TempDir()
+	r := rand.New(rand.NewSource(2))
+	oldPath := filepath.Join(dir, "CL_Images.old")
+	newPath := filepath.Join(dir, "CL_Images")
+	writeKeyfile(t, oldPath, append([]keyfile.Entry{versionEntry(7)}, randomEntries(r, 4, 4096)...))
+	// Every picture changes, so the patch is as large as the file.
+	writeKeyfile(t, newPath, append([]keyfile.Entry{versionEntry(8)}, randomEntries(r, 4, 4096)...))
+
+	// An older patch under the same name must not stay on offer.
+	stale := filepath.Join(dir, "CL_Images.7to8.gz")
+	if err := os.WriteFile(stale, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	path, err := writePatch(oldPath, newPath, "", keyfile.DiffOptions{}, false, &out)
+	if err != nil {
+		t.Fatalf("writePatch: %v", err)
+	}
+	if path != "" {
+		t.Fatalf("wrote %q for a patch larger than the file", path)
+	}
+	if _, err := os.Stat(stale); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("stale patch not removed: %v", err)
+	}
+}
+
+func TestWritePatchGatesRemovals(t *testing.T) {
+	dir := t.TempDir()
+	r := rand.New(rand.NewSource(3))
+	images := randomEntries(r, 6, 4096)
+	oldPath := filepath.Join(dir, "CL_Images.old")
+	newPath := filepath.Join(dir, "CL_Images")
+	out := filepath.Join(dir, "removal.gz")
+	base := writeKeyfile(t, oldPath, append([]keyfile.Entry{versionEntry(20)}, images...))
+	target := writeKeyfile(t, newPath, append([]keyfile.Entry{versionEntry(21)}, images[:5]...))
+
+	_, err := writePatch(oldPath, newPath, out, keyfile.DiffOptions{}, false, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "-remove") {
+		t.Fatalf("removal without -remove = %v", err)
+	}
+	if _, err := os.Stat(out); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("patch written without -remove: %v", err)
+	}
+
+	path, err := writePatch(oldPath, newPath, out, keyfile.DiffOptions{Remove: true}, false, io.Discard)
+	if err != nil || path != out {
+		t.Fatalf("writePatch -remove = %q, %v", path, err)
+	}
+	if err := verifyPatch(base, target, readGzip(t, path)); err != nil {
+		t.Fatalf("verifyPatch: %v", err)
+	}
+}
+
+func TestKeyfileVersion(t *testing.T) {
+	// Older files store a one-byte version in the low byte.
+	short := keyfile.Build([]keyfile.Entry{{Type: kTypeVersion, Data: []byte{0, 0, 0, 42}}})
+	if v, err := keyfileVersion(short); err != nil || v != 42 {
+		t.Fatalf("short version = %d, %v", v, err)
+	}
+	none := keyfile.Build([]keyfile.Entry{{Type: kTypeImage, ID: 1, Data: []byte("x")}})
+	if _, err := keyfileVersion(none); err == nil {
+		t.Fatalf("expected an error without a version entry")
+	}
+}
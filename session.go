@@ -0,0 +1,586 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A session is one character's connection to the server and everything the
+// client has learned through it: frame and command counters, draw state,
+// inventory, chat, console, night, the player list and any recording. The
+// network loops, the decoder and the recorder are handed the session they
+// serve, so characters logged in side by side never share any of it.
+//
+// mainSession plays the character logged in from the login window; movies,
+// pcap replays and the fake server play into it too. Alts are started from
+// the Alt Sessions window. The focused session is shown in the game window,
+// takes the mouse and keys and is what the UI, hotkeys and plugins act on;
+// the others keep running and can be shown in view windows. "/as <name>
+// <command>" sends a command to a chosen session.
+
+const (
+	maxSessionMessages = 200
+	sessionStopTimeout = 3 * time.Second
+)
+
+type session struct {
+	name   string          // character name
+	ctx    context.Context // alts only
+	cancel context.CancelFunc
+	done   chan struct{} // closed when an alt has logged out
+	frames chan struct{} // signaled by noteFrame
+
+	// Guarded by mu.
+	mu       sync.Mutex
+	tcp, udp net.Conn
+	status   string
+
+	// commandMu guards pendingCommand and commandQueue. Commands are
+	// queued from the UI, plugin and stdin goroutines and drained by the
+	// network loop.
+	commandMu      sync.Mutex
+	commandNum     uint32
+	pendingCommand string
+	commandQueue   []string
+
+	// Kept by the read loops and sendPlayerInput.
+	ackFrame, resendFrame, lastAckFrame int32
+	numFrames, lostFrames               int
+	frameBuckets, lostBuckets           [5]int
+	bucketTimes                         [5]int64
+	frameCounter                        int
+	playerName                          string
+	playerIndex                         uint8
+	prevSounds, prev2Sounds             []uint16
+
+	// Guarded by frameMu.
+	frameMu       sync.Mutex
+	lastFrameTime time.Time
+	frameInterval time.Duration
+	intervalHist  map[int]int
+	serverFPS     float64
+
+	// Guarded by latencyMu.
+	latencyMu             sync.Mutex
+	netLatency, netJitter time.Duration
+	lastInputSent         time.Time
+
+	// Guarded by stateMu.
+	stateMu             sync.Mutex
+	state, initialState drawState
+
+	// Guarded by inventoryMu.
+	inventoryMu    sync.RWMutex
+	inventoryItems []InventoryItem
+	inventoryNames map[inventoryKey]string
+
+	// Guarded by playersMu.
+	playersMu sync.RWMutex
+	players   map[string]*Player
+
+	chat, console messageLog
+	night         NightInfo
+
+	// A tiny, throttled queue of /be-info lookups for players missing
+	// details, and the state of multi-batch /be-who scans.
+	infoQueueMu         sync.Mutex
+	infoQueue           map[string]struct{}
+	lastInfoSent        time.Time
+	whoActive           bool
+	whoLastRequest      time.Time
+	whoLastCommandFrame int32
+
+	// Guarded by recorderMu.
+	recorderMu sync.Mutex
+	recorder   *movieRecorder
+
+	// Only touched by the game goroutine.
+	view *sessionView
+}
+
+// newSession returns the session of a character that has not logged on.
+func newSession(charName string) *session {
+	return &session{
+		name:                charName,
+		frames:              make(chan struct{}, 1),
+		commandNum:          1,
+		playerIndex:         0xff,
+		frameInterval:       framems * time.Millisecond,
+		intervalHist:        map[int]int{},
+		state:               newDrawState(),
+		initialState:        newDrawState(),
+		inventoryNames:      make(map[inventoryKey]string),
+		players:             make(map[string]*Player),
+		chat:                messageLog{max: maxChatMessages},
+		console:             messageLog{max: maxMessages},
+		infoQueue:           map[string]struct{}{},
+		whoLastCommandFrame: -1,
+	}
+}
+
+var (
+	mainSession = newSession("")
+	// focused is the session in the game window; nil means mainSession.
+	focused atomic.Pointer[session]
+
+	sessionsMu sync.Mutex
+	sessions   = map[string]*session{} // alts, keyed by lower-case name
+	// sessionsChanged is set when an alt starts, ends or gets messages so
+	// the Alt Sessions window refreshes on the next frame.
+	sessionsChanged atomic.Bool
+)
+
+// focusedSession returns the session shown in the game window.
+func focusedSession() *session {
+	if s := focused.Load(); s != nil {
+		return s
+	}
+	return mainSession
+}
+
+// isFocused reports whether s is in the game window. Sounds, notifications,
+// the automap and plugin hooks only follow the focused session.
+func (s *session) isFocused() bool {
+	return focusedSession() == s
+}
+
+// focusSession shows s in the game window, or the main session when s is
+// nil. Typed commands, hotkeys and plugins act on it from then on. It runs
+// on the game goroutine.
+func focusSession(s *session) error {
+	if s == nil {
+		s = mainSession
+	}
+	prev := focusedSession()
+	if s == prev {
+		return nil
+	}
+	if s != mainSession && !s.online() {
+		return fmt.Errorf("%s is not online", s.name)
+	}
+	focused.Store(s)
+	if v := s.view; v != nil {
+		// The view s had shows the session it replaces now.
+		if prev.view != nil {
+			prev.view.win.Close()
+		}
+		s.view, prev.view = nil, v
+		v.win.Title = prev.name
+		v.lights = lightHistory{}
+	}
+
+	inputMu.Lock()
+	latestInput = inputState{}
+	inputMu.Unlock()
+	walkToggled = false
+	gameLights = lightHistory{}
+	inventoryDirty = true
+	playersDirty = true
+	updateChatWindow()
+	updateConsoleWindow()
+	updateRecordStatus()
+	if gameWin != nil {
+		gameWin.Title = "Clan Lord"
+		if s != mainSession {
+			gameWin.Title += ": " + s.name
+		}
+	}
+	sessionsChanged.Store(true)
+	return nil
+}
+
+// startSession logs in the saved character charName as an alt. It runs on
+// the game goroutine.
+func startSession(charName string) error {
+	var c *Character
+	for i := range characters {
+		if strings.EqualFold(characters[i].Name, charName) {
+			c = &characters[i]
+			break
+		}
+	}
+	switch {
+	case c == nil:
+		return fmt.Errorf("%s is not a saved character", charName)
+	case !mainSession.online():
+		return errors.New("log in from the login window first")
+	case strings.EqualFold(c.Name, mainSession.name):
+		return fmt.Errorf("%s is already logged in", c.Name)
+	case c.passHash == "" && c.Sealed != "" && charactersLocked():
+		return errors.New("unlock saved passwords first")
+	case c.passHash == "":
+		return fmt.Errorf("no saved password for %s", c.Name)
+	}
+	key := strings.ToLower(c.Name)
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if s, ok := sessions[key]; ok && s.running() {
+		return fmt.Errorf("%s is already running", c.Name)
+	}
+	s := newSession(c.Name)
+	s.ctx, s.cancel = context.WithCancel(gameCtx)
+	s.done = make(chan struct{})
+	s.status = "connecting"
+	// Labels, blocks and what is known about other players carry over
+	// from the main character.
+	s.players = mainSession.copyPlayers()
+	sessions[key] = s
+	sessionsChanged.Store(true)
+	go s.run(c.passHash)
+	return nil
+}
+
+// run logs the alt on and runs its network loops until it is stopped or
+// its connection drops.
+func (s *session) run(hash string) {
+	defer close(s.done)
+	defer queueUpdate(s.detach)
+	tcp, udp, err := dialLogin(s.name, "", hash, clientVersion)
+	if err != nil {
+		s.setStatus("failed")
+		queueUpdate(func() { consoleMessage(s.name + ": " + err.Error()) })
+		return
+	}
+	s.playerName = utfFold(s.name)
+	s.applyLocalLabels()
+	s.setConns(tcp, udp)
+	s.setStatus("online")
+
+	if err := s.sendPlayerInput(udp, 0, 0, false, false); err != nil {
+		logError("%s: send player input: %v", s.name, err)
+	}
+	go sendInputLoop(s.ctx, s, udp, tcp)
+	go udpReadLoop(s.ctx, s, udp)
+	go tcpReadLoop(s.ctx, s, tcp)
+	<-s.ctx.Done()
+	s.setConns(nil, nil)
+	tcp.Close()
+	udp.Close()
+	s.mu.Lock()
+	if s.status == "online" {
+		s.status = "logged out"
+	}
+	s.mu.Unlock()
+}
+
+// detach takes an alt that has ended out of the game window and closes its
+// view. It runs on the game goroutine.
+func (s *session) detach() {
+	if s.isFocused() {
+		_ = focusSession(nil)
+	}
+	if s.view != nil {
+		s.view.win.Close()
+	}
+	sessionsChanged.Store(true)
+}
+
+// connectionLost handles a failed read on one of s's connections.
+func (s *session) connectionLost() {
+	if s != mainSession {
+		if s.ctx.Err() == nil {
+			s.setStatus("connection lost")
+		}
+		s.cancel()
+		return
+	}
+	if !s.isFocused() {
+		// Bring the main character back so its reconnect is shown.
+		queueUpdate(func() { _ = focusSession(nil) })
+	}
+	handleConnectionLost()
+}
+
+// connected reports whether s has open connections to the server.
+func (s *session) connected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tcp != nil
+}
+
+// setConns records the connections s plays on, or nil ones once it has
+// logged off.
+func (s *session) setConns(tcp, udp net.Conn) {
+	s.mu.Lock()
+	s.tcp, s.udp = tcp, udp
+	s.mu.Unlock()
+}
+
+// online reports whether s is logged on.
+func (s *session) online() bool {
+	return s.connected() && s.running()
+}
+
+func (s *session) setStatus(status string) {
+	s.mu.Lock()
+	s.status = status
+	s.mu.Unlock()
+	sessionsChanged.Store(true)
+}
+
+func (s *session) Status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// running reports whether s has not ended; the main session never does.
+func (s *session) running() bool {
+	if s.done == nil {
+		return true
+	}
+	select {
+	case <-s.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// sendToSession queues cmd for the session playing charName, whether or not
+// it is in the game window.
+func sendToSession(charName, cmd string) error {
+	s := findSession(charName)
+	if s == nil || !s.running() {
+		return fmt.Errorf("%s is not running", charName)
+	}
+	s.queueCommand(cmd)
+	return nil
+}
+
+// stopSession logs the alt playing charName out and waits for it to end.
+// The session stays listed until it is removed.
+func stopSession(charName string) {
+	if s := getSession(charName); s != nil {
+		s.stop()
+	}
+}
+
+func (s *session) stop() {
+	s.cancel()
+	select {
+	case <-s.done:
+	case <-time.After(sessionStopTimeout):
+	}
+}
+
+// removeSession logs charName's alt out and drops it from the list.
+func removeSession(charName string) {
+	sessionsMu.Lock()
+	s := sessions[strings.ToLower(charName)]
+	delete(sessions, strings.ToLower(charName))
+	sessionsMu.Unlock()
+	if s != nil {
+		s.cancel()
+	}
+	sessionsChanged.Store(true)
+}
+
+// endSessions logs every alt out without waiting; the alts end with the
+// character logged in from the login window.
+func endSessions() {
+	for _, s := range altSessions() {
+		s.cancel()
+	}
+}
+
+// stopSessions logs every alt out and waits for them; the client calls it
+// on exit.
+func stopSessions() {
+	var wg sync.WaitGroup
+	for _, s := range altSessions() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.stop()
+		}()
+	}
+	wg.Wait()
+}
+
+// altSessions lists the alts by character name.
+func altSessions() []*session {
+	sessionsMu.Lock()
+	list := make([]*session, 0, len(sessions))
+	for _, s := range sessions {
+		list = append(list, s)
+	}
+	sessionsMu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
+
+// allSessions lists the main session followed by the alts.
+func allSessions() []*session {
+	return append([]*session{mainSession}, altSessions()...)
+}
+
+// sessionNames lists the alts by character name.
+func sessionNames() []string {
+	list := altSessions()
+	names := make([]string, len(list))
+	for i, s := range list {
+		names[i] = s.name
+	}
+	return names
+}
+
+// getSession returns the alt playing charName.
+func getSession(charName string) *session {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	return sessions[strings.ToLower(charName)]
+}
+
+// findSession returns the session playing charName, the main one included.
+func findSession(charName string) *session {
+	if s := getSession(charName); s != nil {
+		return s
+	}
+	if mainSession.name != "" && strings.EqualFold(mainSession.name, charName) {
+		return mainSession
+	}
+	return nil
+}
+
+// sessionMessages returns the latest console and chat lines of s, oldest
+// first, formatted like the console.
+func sessionMessages(s *session) []string {
+	msgs := append(s.console.timed(), s.chat.timed()...)
+	sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].Time.Before(msgs[j].Time) })
+	if len(msgs) > maxSessionMessages {
+		msgs = msgs[len(msgs)-maxSessionMessages:]
+	}
+	l := &messageLog{entries: msgs}
+	return l.Entries(gs.TimestampFormat, gs.ConsoleTimestamps)
+}
+
+// tileRects splits area into n tiles, in columns first: two views sit side
+// by side, more fill a grid.
+func tileRects(n int, area image.Rectangle) []image.Rectangle {
+	if n <= 0 {
+		return nil
+	}
+	cols := int(math.Ceil(math.Sqrt(float64(n))))
+	if n == 2 {
+		cols = 2
+	}
+	rows := (n + cols - 1) / cols
+	w, h := area.Dx()/cols, area.Dy()/rows
+	rects := make([]image.Rectangle, n)
+	for i := range rects {
+		x := area.Min.X + (i%cols)*w
+		y := area.Min.Y + (i/cols)*h
+		rects[i] = image.Rect(x, y, x+w, y+h)
+	}
+	return rects
+}
+
+// splitSessionCommand splits the arguments of "/as <name> <command>".
+// Names may contain spaces, so the longest name in names that prefixes
+// args wins; a quoted name is also accepted. Otherwise the first word is
+// the name.
+func splitSessionCommand(args string, names []string) (string, string, bool) {
+	args = strings.TrimSpace(args)
+	if strings.HasPrefix(args, `"`) {
+		end := strings.Index(args[1:], `"`)
+		if end < 0 {
+			return "", "", false
+		}
+		name, rest := args[1:end+1], strings.TrimSpace(args[end+2:])
+		return name, rest, name != "" && rest != ""
+	}
+	best := ""
+	for _, n := range names {
+		if len(n) <= len(best) || len(args) <= len(n) {
+			continue
+		}
+		if strings.EqualFold(args[:len(n)], n) && args[len(n)] == ' ' {
+			best = n
+		}
+	}
+	if best == "" {
+		// Unknown names still split so the caller can say who is missing.
+		name, rest, _ := strings.Cut(args, " ")
+		return name, strings.TrimSpace(rest), name != "" && strings.TrimSpace(rest) != ""
+	}
+	rest := strings.TrimSpace(args[len(best):])
+	return best, rest, rest != ""
+}
+
+// runSessionCommand handles "/as <name> <command>" and "/alts" from the
+// input bar, hotkeys, macros and plugins. It reports whether cmd was such a
+// command.
+func runSessionCommand(cmd string) bool {
+	if headless {
+		// Alts need the game window, so headless clients have none.
+		return false
+	}
+	lower := strings.ToLower(cmd)
+	if lower == "/alts" || strings.HasPrefix(lower, "/alts ") {
+		args := strings.TrimSpace(cmd[len("/alts"):])
+		// Focus and views belong to the game goroutine; plugins and
+		// stdin send commands from others.
+		queueUpdate(func() { runAltsCommand(args) })
+		return true
+	}
+	if lower != "/as" && !strings.HasPrefix(lower, "/as ") {
+		return false
+	}
+	names := sessionNames()
+	// The character logged in from the login window can be named too.
+	if mainSession.name != "" {
+		names = append(names, mainSession.name)
+	}
+	who, text, ok := splitSessionCommand(cmd[len("/as"):], names)
+	if !ok {
+		consoleMessage("usage: /as <character name> <command>")
+		return true
+	}
+	if err := sendToSession(who, text); err != nil {
+		consoleMessage("/as: " + err.Error())
+	}
+	return true
+}
+
+// runAltsCommand handles "/alts", which lists the alts, "/alts view [name]",
+// which shows an alt in the game window (or the main character without a
+// name), and "/alts tile". It runs on the game goroutine.
+func runAltsCommand(args string) {
+	verb, rest, _ := strings.Cut(args, " ")
+	switch strings.ToLower(verb) {
+	case "":
+		list := altSessions()
+		if len(list) == 0 {
+			consoleMessage("No alts are running.")
+			return
+		}
+		for _, s := range list {
+			consoleMessage(s.name + " (" + s.Status() + ")")
+		}
+	case "view":
+		var s *session
+		if who := strings.Trim(strings.TrimSpace(rest), `"`); who != "" {
+			if s = findSession(who); s == nil || !s.running() {
+				consoleMessage("/alts: " + who + " is not running")
+				return
+			}
+		}
+		if err := focusSession(s); err != nil {
+			consoleMessage("/alts: " + err.Error())
+		}
+	case "tile":
+		tileSessionViews()
+	default:
+		consoleMessage("usage: /alts [view [alt name] | tile]")
+	}
+}
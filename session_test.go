@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitSessionCommand(t *testing.T) {
+	names := []string{"Sir", "Sir Test", "Healer"}
+	tests := []struct {
+		args, name, cmd string
+		ok              bool
+	}{
+		{" Sir Test /cast heal", "Sir Test", "/cast heal", true},
+		{"sir /bow", "Sir", "/bow", true},
+		{"healer   /pray Bob", "Healer", "/pray Bob", true},
+		{`"Sir Test" /ponder`, "Sir Test", "/ponder", true},
+		{"Nobody /wave", "Nobody", "/wave", true},
+		{"Healer", "Healer", "", false},
+		{`"Sir Test /ponder`, "", "", false},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		name, cmd, ok := splitSessionCommand(tt.args, names)
+		if name != tt.name || cmd != tt.cmd || ok != tt.ok {
+			t.Errorf("split(%q) = %q, %q, %v; want %q, %q, %v", tt.args, name, cmd, ok, tt.name, tt.cmd, tt.ok)
+		}
+	}
+}
+
+func TestSessionCommandWithoutAlt(t *testing.T) {
+	mainSession.console = messageLog{max: maxMessages}
+	mainSession.commandQueue = nil
+	enqueueCommand("/as Healer /cast heal")
+	if len(mainSession.commandQueue) != 0 {
+		t.Fatalf("queued %q", mainSession.commandQueue)
+	}
+	got := mainSession.console.Entries("", false)
+	if len(got) == 0 || got[len(got)-1] != "/as: Healer is not running" {
+		t.Fatalf("console = %q", got)
+	}
+	if runSessionCommand("/ask Bob") {
+		t.Fatalf("/ask taken as /as")
+	}
+	enqueueCommand("/alts view Healer")
+	runUpdateQueue()
+	got = mainSession.console.Entries("", false)
+	if len(mainSession.commandQueue) != 0 || got[len(got)-1] != "/alts: Healer is not running" {
+		t.Fatalf("queue = %q, console = %q", mainSession.commandQueue, got)
+	}
+}
+
+func TestSessionsKeepStateApart(t *testing.T) {
+	origTimestamps := gs.ConsoleTimestamps
+	t.Cleanup(func() {
+		focused.Store(nil)
+		sessions = map[string]*session{}
+		gs.ConsoleTimestamps = origTimestamps
+		mainSession.clearCommands()
+		mainSession.players = map[string]*Player{}
+		mainSession.playerName = ""
+		resetState()
+	})
+	gs.ConsoleTimestamps = false
+	mainSession.console = messageLog{max: maxMessages}
+	mainSession.clearCommands()
+	mainSession.players = map[string]*Player{}
+	mainSession.playerName = "main"
+	resetState()
+	mainSession.state.descriptors[1] = frameDescriptor{Index: 1, Type: kDescPlayer, Name: "Main"}
+	alt := newSession("Healer")
+	alt.done = make(chan struct{})
+	alt.playerName = "healer"
+	alt.state.descriptors[1] = frameDescriptor{Index: 1, Type: kDescPlayer, Name: "Healer"}
+	sessions["healer"] = alt
+
+	consoleMessage("main line")
+	enqueueCommand("/as Healer /cast heal")
+	enqueueCommand("/wave")
+	if !reflect.DeepEqual(mainSession.commandQueue, []string{"/wave"}) || !reflect.DeepEqual(alt.commandQueue, []string{"/cast heal"}) {
+		t.Fatalf("main queue = %q, alt queue = %q", mainSession.commandQueue, alt.commandQueue)
+	}
+
+	alt.getPlayer("Bob").Clan = "Healers"
+	if _, ok := mainSession.players["Bob"]; ok {
+		t.Fatalf("alt player landed in the main list")
+	}
+
+	focused.Store(alt)
+	if !alt.isFocused() || mainSession.isFocused() {
+		t.Fatalf("alt not focused")
+	}
+	consoleMessage("alt line")
+	if cmd := focusedSession().takeCommand(); cmd != "/cast heal" {
+		t.Fatalf("alt command = %q", cmd)
+	}
+	if got := mainSession.console.Entries("", false); !reflect.DeepEqual(got, []string{"main line"}) {
+		t.Fatalf("main console = %q", got)
+	}
+	if got := sessionMessages(alt); !reflect.DeepEqual(got, []string{"alt line"}) {
+		t.Fatalf("alt console = %q", got)
+	}
+
+	// A recording started for the main character opens with its own state
+	// whichever session is focused.
+	path := filepath.Join(t.TempDir(), "main.clMov")
+	if err := mainSession.startMovieRecording(path); err != nil {
+		t.Fatal(err)
+	}
+	mainSession.stopMovieRecording()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("Main")) || bytes.Contains(data, []byte("Healer")) {
+		t.Fatalf("recording does not hold the main character's state")
+	}
+}
+
+func TestTileRects(t *testing.T) {
+	area := image.Rect(0, 32, 1920, 1048)
+	tests := []struct {
+		n    int
+		want []image.Rectangle
+	}{
+		{1, []image.Rectangle{area}},
+		{2, []image.Rectangle{image.Rect(0, 32, 960, 1048), image.Rect(960, 32, 1920, 1048)}},
+		{3, []image.Rectangle{
+			image.Rect(0, 32, 960, 540), image.Rect(960, 32, 1920, 540),
+			image.Rect(0, 540, 960, 1048),
+		}},
+		{0, nil},
+	}
+	for _, tt := range tests {
+		if got := tileRects(tt.n, area); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tileRects(%d) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"gothoom/eui"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+var (
+	sessionsWin     *eui.WindowData
+	sessionsCharDD  *eui.ItemData
+	sessionsRows    *eui.ItemData
+	sessionsLogList *eui.ItemData
+	sessionsInput   *eui.ItemData
+	sessionsShown   string
+	sessionsText    string
+)
+
+// sessionView is a window showing the game view of a session that is not in
+// the game window. It keeps its own lighting history so it does not blend
+// against the game window's frames.
+type sessionView struct {
+	win    *eui.WindowData
+	item   *eui.ItemData
+	img    *ebiten.Image
+	rt     *ebiten.Image
+	lights lightHistory
+}
+
+// makeSessionsWindow builds the window that starts alt sessions, picks the
+// one in the game window, opens or tiles the views of the others, shows the
+// chat and console of one of them and sends it commands.
+func makeSessionsWindow() {
+	if sessionsWin != nil {
+		return
+	}
+	sessionsWin = eui.NewWindow()
+	sessionsWin.Title = "Alt Sessions"
+	sessionsWin.Size = eui.Point{X: 460, Y: 450}
+	sessionsWin.Closable = true
+	sessionsWin.Movable = true
+	sessionsWin.Resizable = true
+	sessionsWin.NoScroll = true
+	sessionsWin.SetZone(eui.HZoneCenter, eui.VZoneMiddleTop)
+
+	flow := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL, Fixed: true}
+	sessionsWin.AddItem(flow)
+
+	startRow := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL, Fixed: true}
+	dd, _ := eui.NewDropdown()
+	dd.Label = "Character"
+	dd.Size = eui.Point{X: 300, Y: 24}
+	sessionsCharDD = dd
+	startRow.AddItem(dd)
+	startBtn, startEvents := eui.NewButton()
+	startBtn.Text = "Log In Alt"
+	startBtn.Size = eui.Point{X: 100, Y: 24}
+	startEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type != eui.EventClick {
+			return
+		}
+		if dd.Selected < 0 || dd.Selected >= len(dd.Options) {
+			return
+		}
+		name := dd.Options[dd.Selected]
+		if err := startSession(name); err != nil {
+			makeErrorWindow("Error: Log In Alt: " + err.Error())
+			return
+		}
+		sessionsShown = name
+		updateSessionsWindow()
+	}
+	startRow.AddItem(startBtn)
+	flow.AddItem(startRow)
+
+	viewRow := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL, Fixed: true}
+	mainBtn, mainEvents := eui.NewButton()
+	mainBtn.Text = "Play Main Character"
+	mainBtn.Size = eui.Point{X: 200, Y: 24}
+	mainEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			_ = focusSession(nil)
+		}
+	}
+	viewRow.AddItem(mainBtn)
+	tileBtn, tileEvents := eui.NewButton()
+	tileBtn.Text = "Tile Views"
+	tileBtn.Size = eui.Point{X: 200, Y: 24}
+	tileEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			tileSessionViews()
+		}
+	}
+	viewRow.AddItem(tileBtn)
+	flow.AddItem(viewRow)
+
+	sessionsRows = &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL, Fixed: true}
+	flow.AddItem(sessionsRows)
+
+	inputRow := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL, Fixed: true}
+	in, _ := eui.NewInput()
+	in.Label = "Command"
+	in.TextPtr = &sessionsText
+	in.Size = eui.Point{X: 340, Y: 24}
+	in.Action = sendSessionsInput
+	sessionsInput = in
+	inputRow.AddItem(in)
+	sendBtn, sendEvents := eui.NewButton()
+	sendBtn.Text = "Send"
+	sendBtn.Size = eui.Point{X: 60, Y: 24}
+	sendEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			sendSessionsInput()
+		}
+	}
+	inputRow.AddItem(sendBtn)
+	flow.AddItem(inputRow)
+
+	sessionsLogList = &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL, Scrollable: true, Fixed: true}
+	flow.AddItem(sessionsLogList)
+
+	sessionsWin.OnResize = func() {
+		updateSessionsWindow()
+	}
+	sessionsWin.AddWindow(false)
+	updateSessionsWindow()
+}
+
+// sendSessionsInput sends the input line to the alt shown in the window.
+func sendSessionsInput() {
+	txt := strings.TrimSpace(sessionsText)
+	if txt == "" || sessionsShown == "" {
+		return
+	}
+	if err := sendToSession(sessionsShown, txt); err != nil {
+		makeErrorWindow("Error: Send: " + err.Error())
+		return
+	}
+	sessionsText = ""
+	sessionsInput.Text = ""
+	sessionsInput.Dirty = true
+	updateSessionsWindow()
+}
+
+// updateSessionsWindow lists the alts and shows the selected one's log.
+func updateSessionsWindow() {
+	if sessionsWin == nil {
+		return
+	}
+	var opts []string
+	for _, c := range characters {
+		if !strings.EqualFold(c.Name, mainSession.name) {
+			opts = append(opts, c.Name)
+		}
+	}
+	sessionsCharDD.Options = opts
+	if sessionsCharDD.Selected >= len(opts) {
+		sessionsCharDD.Selected = 0
+	}
+	sessionsCharDD.Dirty = true
+
+	names := sessionNames()
+	if getSession(sessionsShown) == nil {
+		sessionsShown = ""
+		if len(names) > 0 {
+			sessionsShown = names[0]
+		}
+	}
+	focused := focusedSession()
+	sessionsRows.Contents = sessionsRows.Contents[:0]
+	for _, n := range names {
+		s := getSession(n)
+		if s == nil {
+			continue
+		}
+		row := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
+		label, _ := eui.NewText()
+		label.Text = n + " (" + s.Status() + ")"
+		if s == focused {
+			label.Text = n + " (playing)"
+		}
+		if n == sessionsShown {
+			label.Text = "> " + label.Text
+		}
+		label.Size = eui.Point{X: 180, Y: 24}
+		label.FontSize = 12
+		row.AddItem(label)
+
+		name := n
+		playBtn, playEvents := eui.NewButton()
+		playBtn.Text = "Play"
+		playBtn.Size = eui.Point{X: 50, Y: 24}
+		playEvents.Handle = func(ev eui.UIEvent) {
+			if ev.Type != eui.EventClick {
+				return
+			}
+			s := getSession(name)
+			if s == nil {
+				return
+			}
+			if err := focusSession(s); err != nil {
+				makeErrorWindow("Error: Play: " + err.Error())
+			}
+		}
+		row.AddItem(playBtn)
+
+		viewBtn, viewEvents := eui.NewButton()
+		viewBtn.Text = "View"
+		viewBtn.Size = eui.Point{X: 50, Y: 24}
+		viewEvents.Handle = func(ev eui.UIEvent) {
+			if ev.Type == eui.EventClick {
+				openSessionView(getSession(name))
+			}
+		}
+		row.AddItem(viewBtn)
+
+		logBtn, logEvents := eui.NewButton()
+		logBtn.Text = "Log"
+		logBtn.Size = eui.Point{X: 50, Y: 24}
+		logEvents.Handle = func(ev eui.UIEvent) {
+			if ev.Type == eui.EventClick {
+				sessionsShown = name
+				updateSessionsWindow()
+			}
+		}
+		row.AddItem(logBtn)
+
+		stopBtn, stopEvents := eui.NewButton()
+		stopBtn.Size = eui.Point{X: 80, Y: 24}
+		if s.running() {
+			stopBtn.Text = "Log Out"
+			stopEvents.Handle = func(ev eui.UIEvent) {
+				if ev.Type == eui.EventClick {
+					go stopSession(name)
+				}
+			}
+		} else {
+			stopBtn.Text = "Remove"
+			stopEvents.Handle = func(ev eui.UIEvent) {
+				if ev.Type == eui.EventClick {
+					removeSession(name)
+					updateSessionsWindow()
+				}
+			}
+		}
+		row.AddItem(stopBtn)
+		sessionsRows.AddItem(row)
+	}
+	if len(names) == 0 {
+		hint, _ := eui.NewText()
+		hint.Text = "Play shows an alt in the game window, where hotkeys and plugins act on it; View opens its game view beside it. /as <name> <command> sends to any character, /alts view <name> and /alts tile switch views."
+		hint.FontSize = 11
+		hint.Size = eui.Point{X: sessionsWin.Size.X, Y: 36}
+		sessionsRows.AddItem(hint)
+	}
+
+	var msgs []string
+	if s := getSession(sessionsShown); s != nil {
+		msgs = sessionMessages(s)
+	}
+	updateTextWindow(sessionsWin, sessionsLogList, nil, msgs, gs.ConsoleFontSize, "", nil)
+	sessionsWin.Refresh()
+}
+
+// openSessionView opens the view window of s unless s is in the game window.
+// It runs on the game goroutine.
+func openSessionView(s *session) {
+	if s == nil || s.isFocused() {
+		return
+	}
+	if s.view == nil {
+		s.view = newSessionView(s.name)
+	}
+	s.view.win.MarkOpen()
+}
+
+func newSessionView(title string) *sessionView {
+	v := &sessionView{}
+	v.win = eui.NewWindow()
+	v.win.Title = title
+	v.win.Closable = true
+	v.win.Movable = true
+	v.win.Resizable = true
+	v.win.NoScroll = true
+	v.win.Size = eui.Point{X: 300, Y: 320}
+	v.win.SetZone(eui.HZoneRight, eui.VZoneMiddleTop)
+	v.item, v.img = eui.NewImageFastItem(1, 1)
+	v.win.AddItem(v.item)
+	v.win.OnResize = v.resize
+	v.win.AddWindow(false)
+	v.resize()
+	return v
+}
+
+// resize fits the view image to the window.
+func (v *sessionView) resize() {
+	s := eui.UIScale()
+	size := v.win.GetSize()
+	pad := float32(2*v.win.Padding) * s
+	w := int(size.X - pad - 4)
+	h := int(size.Y - pad - v.win.GetTitleSize() - 4)
+	if w < 16 || h < 16 {
+		return
+	}
+	if b := v.img.Bounds(); b.Dx() != w || b.Dy() != h {
+		v.img = ebiten.NewImage(w, h)
+		v.item.Image = v.img
+		v.item.Size = eui.Point{X: float32(w) / s, Y: float32(h) / s}
+	}
+}
+
+// drawSessionViews renders every open view from its own session.
+func drawSessionViews() {
+	focused := focusedSession()
+	for _, s := range append([]*session{mainSession}, altSessions()...) {
+		if s == focused || s.view == nil || !s.view.win.IsOpen() {
+			continue
+		}
+		s.view.draw(s)
+	}
+}
+
+// draw renders s into the view at 1x and scales it to fit, like Draw does
+// for the game window.
+func (v *sessionView) draw(s *session) {
+	if v.rt == nil {
+		v.rt = ebiten.NewImage(gameAreaSizeX, gameAreaSizeY)
+	}
+	v.rt.Fill(color.Black)
+	snap := s.captureDrawSnapshot()
+	alpha, mobileFade, pictFade := computeInterpolation(snap.prevTime, snap.curTime, gs.MobileBlendAmount, gs.BlendAmount)
+	prev := gs.GameScale
+	defer func() { gs.GameScale = prev }()
+	gs.GameScale = 1
+	drawWorld(v.rt, snap, &v.lights, alpha, mobileFade, pictFade)
+
+	b := v.img.Bounds()
+	scale := math.Min(float64(b.Dx())/gameAreaSizeX, float64(b.Dy())/gameAreaSizeY)
+	drawW, drawH := gameAreaSizeX*scale, gameAreaSizeY*scale
+	tx, ty := (float64(b.Dx())-drawW)/2, (float64(b.Dy())-drawH)/2
+	v.img.Clear()
+	op := &ebiten.DrawImageOptions{Filter: ebiten.FilterLinear, DisableMipmaps: true}
+	op.GeoM.Scale(scale, scale)
+	op.GeoM.Translate(tx, ty)
+	v.img.DrawImage(v.rt, op)
+	gs.GameScale = scale
+	r := image.Rect(roundToInt(tx), roundToInt(ty), roundToInt(tx+drawW), roundToInt(ty+drawH)).Intersect(b)
+	drawWorldLabels(v.img.SubImage(r).(*ebiten.Image), snap, alpha)
+	v.item.Dirty = true
+}
+
+// tileSessionViews opens the views of the other online sessions and lays
+// them out with the game window across the screen. It runs on the game
+// goroutine.
+func tileSessionViews() {
+	var list []*session
+	focused := focusedSession()
+	for _, s := range append([]*session{mainSession}, altSessions()...) {
+		if s != focused && s.online() {
+			list = append(list, s)
+		}
+	}
+	w, h := eui.ScreenSize()
+	rects := tileRects(1+len(list), image.Rect(0, 0, w, h))
+	placeWindow(gameWin, rects[0])
+	for i, s := range list {
+		openSessionView(s)
+		placeWindow(s.view.win, rects[i+1])
+	}
+}
+
+func placeWindow(win *eui.WindowData, r image.Rectangle) {
+	win.ClearZone()
+	_ = win.SetSize(eui.Point{X: float32(r.Dx()), Y: float32(r.Dy())})
+	_ = win.SetPos(eui.Point{X: float32(r.Min.X), Y: float32(r.Min.Y)})
+}
@@ -16,7 +16,7 @@ func testCLImages(items map[uint32]*climg.ClientItem) *climg.CLImages {
 }
 
 func TestSetFullInventoryGroupsNonTemplate(t *testing.T) {
-	resetInventory()
+	mainSession.resetInventory()
 	old := clImages
 	defer func() { clImages = old }()
 	clImages = testCLImages(map[uint32]*climg.ClientItem{
@@ -25,8 +25,8 @@ func TestSetFullInventoryGroupsNonTemplate(t *testing.T) {
 	})
 	ids := []uint16{100, 100, 200, 200}
 	eq := []bool{false, false, false, false}
-	setFullInventory(ids, eq)
-	items := getInventory()
+	mainSession.setFullInventory(ids, eq)
+	items := mainSession.getInventory()
 	if len(items) != 3 {
 		t.Fatalf("expected 3 items, got %d", len(items))
 	}
@@ -122,6 +122,7 @@ type settings struct {
 	ClickToToggle           bool
 	MiddleClickMoveWindow   bool
 	InputBarAlwaysOpen      bool
+	AutoReconnect           bool
 	KBWalkSpeed             float64
 	MainFontSize            float64
 	BubbleFontSize          float64
@@ -161,6 +162,7 @@ type settings struct {
 	DenoiseImages        bool
 	DenoiseSharpness     float64
 	DenoiseAmount        float64
+	HDPacks              []string // enabled texture packs, highest priority first
 	ShowFPS              bool
 	UIScale              float64
 	Fullscreen           bool
@@ -220,6 +222,7 @@ type settings struct {
 	hideMoving          bool
 	hideMobiles         bool
 	EnabledPlugins      map[string]string
+	PluginGrants        map[string][]string
 	vsync               bool
 	nightEffect         bool
 	shaderLighting      bool
@@ -462,7 +465,7 @@ func syncWindowSettings() bool {
 		gs.ChatWindow.Open = false
 		changed = true
 	}
-	zones := eui.SaveWindowZones()
+	zones := windowZones()
 	if !reflect.DeepEqual(zones, gs.WindowZones) {
 		gs.WindowZones = zones
 		changed = true
@@ -555,6 +558,7 @@ func applyWindowState(win *eui.WindowData, st *WindowState) {
 
 func restoreWindowSettings() {
 	eui.LoadWindowZones(gs.WindowZones)
+	restorePluginWindowZones()
 	applyWindowState(gameWin, &gs.GameWindow)
 	if gameWin != nil {
 		gameWin.MarkOpen()
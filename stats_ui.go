@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"gothoom/eui"
+)
+
+const (
+	statsNameWidth  = 180
+	statsCountWidth = 72
+)
+
+var (
+	statsWin      *eui.WindowData
+	statsList     *eui.ItemData
+	statsStatus   *eui.ItemData
+	statsSelected = statsSession
+	statsShown    bool // the list was built since the window last opened
+)
+
+func makeStatsWindow() {
+	if statsWin != nil {
+		return
+	}
+	statsWin = eui.NewWindow()
+	statsWin.Title = "Stats"
+	statsWin.Size = eui.Point{X: statsNameWidth + 4*statsCountWidth + 40, Y: 480}
+	statsWin.Closable = true
+	statsWin.Movable = true
+	statsWin.Resizable = false
+	statsWin.NoScroll = true
+	statsWin.SetZone(eui.HZoneCenter, eui.VZoneMiddleTop)
+
+	flow := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL, Fixed: true}
+	statsWin.AddItem(flow)
+
+	top := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL, Fixed: true}
+	dd, ddEvents := eui.NewDropdown()
+	dd.Label = "Period"
+	dd.Options = statsPeriodNames
+	dd.Selected = int(statsSelected)
+	dd.Size = eui.Point{X: 140, Y: 24}
+	ddEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventDropdownSelected && ev.Index < len(statsPeriodNames) {
+			statsSelected = statsPeriod(ev.Index)
+			refreshStatsWindow()
+		}
+	}
+	top.AddItem(dd)
+	export, exportEvents := eui.NewButton()
+	export.Text = "Export CSV"
+	export.Size = eui.Point{X: 100, Y: 24}
+	exportEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type != eui.EventClick {
+			return
+		}
+		path, err := exportStatsCSV(statsSelected)
+		if err != nil {
+			makeErrorWindow("Error: Export stats: " + err.Error())
+			return
+		}
+		consoleMessage("Stats exported to " + path)
+	}
+	top.AddItem(export)
+	flow.AddItem(top)
+
+	statsStatus, _ = eui.NewText()
+	statsStatus.FontSize = 11
+	statsStatus.Size = eui.Point{X: statsWin.Size.X - 20, Y: 20}
+	flow.AddItem(statsStatus)
+
+	statsList = &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL, Scrollable: true, Fixed: true}
+	statsList.Size = eui.Point{X: statsWin.Size.X - 20, Y: statsWin.Size.Y - 90}
+	flow.AddItem(statsList)
+
+	statsWin.AddWindow(false)
+}
+
+// refreshStatsWindow lists the tallies for the selected period.
+func refreshStatsWindow() {
+	if statsWin == nil || statsList == nil {
+		return
+	}
+	statsShown = true
+	killStatsMu.Lock()
+	killStatsChanged = false
+	killStatsMu.Unlock()
+
+	statsList.Contents = statsList.Contents[:0]
+	cell := func(row *eui.ItemData, s string, width float32) {
+		t, _ := eui.NewText()
+		t.Text = s
+		t.FontSize = 11
+		t.Size = eui.Point{X: width, Y: 18}
+		row.AddItem(t)
+	}
+	s := currentStats(focusedSession().playerName)
+	if s == nil {
+		statsStatus.Text = "Log in to see your stats."
+		statsStatus.Dirty = true
+		statsWin.Refresh()
+		return
+	}
+	events := s.since(statsSelected, time.Now())
+	statsStatus.Text = fmt.Sprintf("%s: %d events", s.name, len(events))
+	statsStatus.Dirty = true
+	tables := tallyStats(events, s.name)
+	if len(tables) == 0 {
+		row := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
+		cell(row, "Nothing recorded yet. Kills, falls, raises and karma show up here as they happen.", statsList.Size.X)
+		statsList.AddItem(row)
+	}
+	for _, t := range tables {
+		title, _ := eui.NewText()
+		title.Text = "\n" + t.Title
+		title.FontSize = 14
+		title.Size = eui.Point{X: statsList.Size.X, Y: 36}
+		statsList.AddItem(title)
+
+		header := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
+		cell(header, "", statsNameWidth)
+		for _, c := range t.Columns {
+			cell(header, c, statsCountWidth)
+		}
+		statsList.AddItem(header)
+		for _, r := range t.Rows {
+			row := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
+			cell(row, r.Name, statsNameWidth)
+			for _, n := range r.Counts {
+				cell(row, strconv.Itoa(n), statsCountWidth)
+			}
+			statsList.AddItem(row)
+		}
+	}
+	statsWin.Refresh()
+}
+
+// updateStatsWindow redraws the open Stats window when new events arrive.
+func updateStatsWindow() {
+	if statsWin == nil || !statsWin.IsOpen() {
+		statsShown = false
+		return
+	}
+	killStatsMu.Lock()
+	changed := killStatsChanged
+	killStatsMu.Unlock()
+	if changed || !statsShown {
+		refreshStatsWindow()
+	}
+}
@@ -11,12 +11,12 @@ import (
 
 // parseWhoText parses a plain-text /who line with embedded BEPP player tags.
 // Returns true if handled and should be suppressed from console.
-func parseWhoText(raw []byte, s string) bool {
-	if strings.HasPrefix(s, "You are the only one in the lands.") {
+func (s *session) parseWhoText(raw []byte, text string) bool {
+	if strings.HasPrefix(text, "You are the only one in the lands.") {
 		// Nothing to add
 		return true
 	}
-	if !strings.HasPrefix(s, "In the world are ") {
+	if !strings.HasPrefix(text, "In the world are ") {
 		return false
 	}
 	// Find first -pn tag segment and extract all names.
@@ -30,68 +30,70 @@ func parseWhoText(raw []byte, s string) bool {
 		return true
 	}
 	for _, name := range names {
-		p := getPlayer(name)
-		playersMu.Lock()
+		p := s.getPlayer(name)
+		s.playersMu.Lock()
 		prevSC := p.SameClan
 		prevBW := p.BeWho
-		if me, ok := players[playerName]; ok {
+		if me, ok := s.players[s.playerName]; ok {
 			p.SameClan = me.Clan != "" && p.Clan != "" && strings.EqualFold(p.Clan, me.Clan)
 		}
 		p.LastSeen = time.Now()
 		p.Offline = false
 		p.BeWho = true
 		playerCopy := *p
-		playersMu.Unlock()
+		s.playersMu.Unlock()
 		if prevSC != p.SameClan {
-			killNameTagCacheFor(name)
+			s.killNameTagCacheFor(name)
 		}
 		if !prevBW {
 			playersPersistDirty = true
 		}
-		notifyPlayerHandlers(playerCopy)
+		s.notifyPlayerHandlers(playerCopy)
 	}
 	playersDirty = true
+	s.emitWhoEvent(names)
 	return true
 }
 
 // parseShareText parses plain share/unshare lines with embedded -pn tags.
 // Returns true if the line was recognized and handled.
-func parseShareText(raw []byte, s string) bool {
+func (s *session) parseShareText(raw []byte, text string) bool {
+	defer s.emitShareChanges(s.shareSnapshot())
 	switch {
-	case strings.HasPrefix(s, "You are not sharing experiences with anyone.") ||
-		strings.HasPrefix(s, "You are no longer sharing experiences with anyone."):
+	case strings.HasPrefix(text, "You are not sharing experiences with anyone.") ||
+		strings.HasPrefix(text, "You are no longer sharing experiences with anyone."):
 		// Clear sharees
-		playersMu.Lock()
-		changed := make([]Player, 0, len(players))
-		for _, p := range players {
+		s.playersMu.Lock()
+		changed := make([]Player, 0, len(s.players))
+		for _, p := range s.players {
 			if p.Sharee {
 				p.Sharee = false
 				changed = append(changed, *p)
 			}
 		}
-		playersMu.Unlock()
+		s.playersMu.Unlock()
 		for _, pl := range changed {
-			killNameTagCacheFor(pl.Name)
-			notifyPlayerHandlers(pl)
+			s.killNameTagCacheFor(pl.Name)
+			s.notifyPlayerHandlers(pl)
 		}
 		playersDirty = true
 		return true
-	case strings.HasPrefix(s, "You are no longer sharing experiences with "):
+	case strings.HasPrefix(text, "You are no longer sharing experiences with "):
 		// a single sharee removed
 		// name will be in -pn tags
 		off := bytes.Index(raw, []byte{0xC2, 'p', 'n'})
 		if off >= 0 {
 			names := parseNames(raw[off:])
-			playersMu.Lock()
+			s.playersMu.Lock()
 			changed := make([]Player, 0, len(names))
 			for _, name := range names {
-				if p, ok := players[name]; ok {
+				if p, ok := s.players[name]; ok {
 					changedPlayer := false
 					if p.Sharee {
 						p.Sharee = false
 						changedPlayer = true
 					}
-					if me, ok := players[playerName]; ok {
+					if me, ok := s.players[s.playerName]; ok {
 						sc := me.Clan != "" && p.Clan != "" && strings.EqualFold(p.Clan, me.Clan)
 						if p.SameClan != sc {
 							p.SameClan = sc
@@ -107,41 +109,41 @@ func parseShareText(raw []byte, s string) bool {
 					}
 				}
 			}
-			playersMu.Unlock()
+			s.playersMu.Unlock()
 			for _, pl := range changed {
-				killNameTagCacheFor(pl.Name)
-				notifyPlayerHandlers(pl)
+				s.killNameTagCacheFor(pl.Name)
+				s.notifyPlayerHandlers(pl)
 			}
 			playersDirty = true
 		}
 		return true
-	case strings.HasPrefix(s, "You are sharing experiences with ") || strings.HasPrefix(s, "You begin sharing your experiences with "):
+	case strings.HasPrefix(text, "You are sharing experiences with ") || strings.HasPrefix(text, "You begin sharing your experiences with "):
 		// Self -> sharees
 		// Clear any existing sharees first
-		playersMu.Lock()
-		cleared := make([]Player, 0, len(players))
-		for _, p := range players {
+		s.playersMu.Lock()
+		cleared := make([]Player, 0, len(s.players))
+		for _, p := range s.players {
 			if p.Sharee {
 				p.Sharee = false
 				cleared = append(cleared, *p)
 			}
 		}
-		playersMu.Unlock()
+		s.playersMu.Unlock()
 		for _, pl := range cleared {
-			killNameTagCacheFor(pl.Name)
-			notifyPlayerHandlers(pl)
+			s.killNameTagCacheFor(pl.Name)
+			s.notifyPlayerHandlers(pl)
 		}
 		off := bytes.Index(raw, []byte{0xC2, 'p', 'n'})
 		if off >= 0 {
 			names := parseNames(raw[off:])
 			added := make([]Player, 0, len(names))
 			for _, name := range names {
-				p := getPlayer(name)
+				p := s.getPlayer(name)
 				if !p.Sharee {
 					p.Sharee = true
 					added = append(added, *p)
 				}
-				if me, ok := players[playerName]; ok {
+				if me, ok := s.players[s.playerName]; ok {
 					sc := me.Clan != "" && p.Clan != "" && strings.EqualFold(p.Clan, me.Clan)
 					if p.SameClan != sc {
 						p.SameClan = sc
@@ -154,54 +156,54 @@ func parseShareText(raw []byte, s string) bool {
 				}
 			}
 			for _, pl := range added {
-				killNameTagCacheFor(pl.Name)
-				notifyPlayerHandlers(pl)
+				s.killNameTagCacheFor(pl.Name)
+				s.notifyPlayerHandlers(pl)
 			}
 			playersDirty = true
 		}
 		return true
-	case playerName != "" && (strings.HasPrefix(s, playerName+" is sharing experiences with ") || strings.HasPrefix(s, playerName+" begins sharing experiences with ")):
+	case s.playerName != "" && (strings.HasPrefix(text, s.playerName+" is sharing experiences with ") || strings.HasPrefix(text, s.playerName+" begins sharing experiences with ")):
 		// Hero (you) sharing others in third-person form
-		playersMu.Lock()
-		cleared := make([]Player, 0, len(players))
-		for _, p := range players {
+		s.playersMu.Lock()
+		cleared := make([]Player, 0, len(s.players))
+		for _, p := range s.players {
 			if p.Sharee {
 				p.Sharee = false
 				cleared = append(cleared, *p)
 			}
 		}
-		playersMu.Unlock()
+		s.playersMu.Unlock()
 		for _, pl := range cleared {
-			killNameTagCacheFor(pl.Name)
-			notifyPlayerHandlers(pl)
+			s.killNameTagCacheFor(pl.Name)
+			s.notifyPlayerHandlers(pl)
 		}
-		phrase := playerName + " is sharing experiences with "
-		rest := strings.TrimPrefix(s, phrase)
-		if rest == s {
-			phrase = playerName + " begins sharing experiences with "
-			rest = strings.TrimPrefix(s, phrase)
+		phrase := s.playerName + " is sharing experiences with "
+		rest := strings.TrimPrefix(text, phrase)
+		if rest == text {
+			phrase = s.playerName + " begins sharing experiences with "
+			rest = strings.TrimPrefix(text, phrase)
 		}
 		rest = strings.TrimSuffix(rest, ".")
 		rest = strings.ReplaceAll(rest, " and ", ",")
 		parts := strings.Split(rest, ",")
-		playersMu.Lock()
+		s.playersMu.Lock()
 		added := make([]Player, 0, len(parts))
 		for _, name := range parts {
 			name = strings.TrimSpace(name)
-			if name == "" || strings.EqualFold(name, playerName) {
+			if name == "" || strings.EqualFold(name, s.playerName) {
 				continue
 			}
-			p, ok := players[name]
+			p, ok := s.players[name]
 			if !ok {
 				p = &Player{Name: name}
-				players[name] = p
+				s.players[name] = p
 			}
 			changed := false
 			if !p.Sharee {
 				p.Sharee = true
 				changed = true
 			}
-			if me, ok := players[playerName]; ok {
+			if me, ok := s.players[s.playerName]; ok {
 				sc := me.Clan != "" && p.Clan != "" && strings.EqualFold(p.Clan, me.Clan)
 				if p.SameClan != sc {
 					p.SameClan = sc
@@ -216,34 +218,34 @@ func parseShareText(raw []byte, s string) bool {
 				added = append(added, *p)
 			}
 		}
-		playersMu.Unlock()
+		s.playersMu.Unlock()
 		for _, pl := range added {
-			killNameTagCacheFor(pl.Name)
-			notifyPlayerHandlers(pl)
+			s.killNameTagCacheFor(pl.Name)
+			s.notifyPlayerHandlers(pl)
 		}
 		playersDirty = true
 		return true
-	case playerName != "" && strings.HasPrefix(s, playerName+" is no longer sharing experiences with "):
+	case s.playerName != "" && strings.HasPrefix(text, s.playerName+" is no longer sharing experiences with "):
 		// Hero (you) unsharing others in third-person form
-		phrase := playerName + " is no longer sharing experiences with "
-		rest := strings.TrimPrefix(s, phrase)
+		phrase := s.playerName + " is no longer sharing experiences with "
+		rest := strings.TrimPrefix(text, phrase)
 		rest = strings.TrimSuffix(rest, ".")
 		rest = strings.ReplaceAll(rest, " and ", ",")
 		parts := strings.Split(rest, ",")
-		playersMu.Lock()
+		s.playersMu.Lock()
 		changed := make([]Player, 0, len(parts))
 		for _, name := range parts {
 			name = strings.TrimSpace(name)
-			if name == "" || strings.EqualFold(name, playerName) {
+			if name == "" || strings.EqualFold(name, s.playerName) {
 				continue
 			}
-			if p, ok := players[name]; ok {
+			if p, ok := s.players[name]; ok {
 				changedPlayer := false
 				if p.Sharee {
 					p.Sharee = false
 					changedPlayer = true
 				}
-				if me, ok := players[playerName]; ok {
+				if me, ok := s.players[s.playerName]; ok {
 					sc := me.Clan != "" && p.Clan != "" && strings.EqualFold(p.Clan, me.Clan)
 					if p.SameClan != sc {
 						p.SameClan = sc
@@ -259,70 +261,70 @@ func parseShareText(raw []byte, s string) bool {
 				}
 			}
 		}
-		playersMu.Unlock()
+		s.playersMu.Unlock()
 		for _, pl := range changed {
-			killNameTagCacheFor(pl.Name)
-			notifyPlayerHandlers(pl)
+			s.killNameTagCacheFor(pl.Name)
+			s.notifyPlayerHandlers(pl)
 		}
 		playersDirty = true
 		return true
-	case strings.HasSuffix(s, " is sharing experiences with you."):
+	case strings.HasSuffix(text, " is sharing experiences with you."):
 		name := utfFold(firstTagContent(raw, 'p', 'n'))
 		if name != "" {
-			p := getPlayer(name)
-			playersMu.Lock()
+			p := s.getPlayer(name)
+			s.playersMu.Lock()
 			changed := !p.Sharing
 			p.Sharing = true
 			playerCopy := *p
-			playersMu.Unlock()
+			s.playersMu.Unlock()
 			if changed {
-				killNameTagCacheFor(name)
-				notifyPlayerHandlers(playerCopy)
+				s.killNameTagCacheFor(name)
+				s.notifyPlayerHandlers(playerCopy)
 			}
 			playersDirty = true
-			showNotification(name + " is sharing with you")
+			s.notify(name + " is sharing with you")
 		}
 		return true
-	case strings.Contains(s, " is no longer sharing experiences with you"):
+	case strings.Contains(text, " is no longer sharing experiences with you"):
 		name := utfFold(firstTagContent(raw, 'p', 'n'))
 		if name != "" {
-			playersMu.Lock()
+			s.playersMu.Lock()
 			changed := false
 			var playerCopy Player
-			if p, ok := players[name]; ok {
+			if p, ok := s.players[name]; ok {
 				if p.Sharing {
 					p.Sharing = false
 					changed = true
 					playerCopy = *p
 				}
 			}
-			playersMu.Unlock()
+			s.playersMu.Unlock()
 			if changed {
-				killNameTagCacheFor(name)
-				notifyPlayerHandlers(playerCopy)
+				s.killNameTagCacheFor(name)
+				s.notifyPlayerHandlers(playerCopy)
 			}
 			playersDirty = true
 		}
 		return true
-	case strings.HasPrefix(s, "Currently sharing their experiences with you"):
+	case strings.HasPrefix(text, "Currently sharing their experiences with you"):
 		// Upstream sharers
 		off := bytes.Index(raw, []byte{0xC2, 'p', 'n'})
 		if off >= 0 {
 			names := parseNames(raw[off:])
-			playersMu.Lock()
+			s.playersMu.Lock()
 			changed := make([]Player, 0, len(names))
 			for _, name := range names {
-				p, ok := players[name]
+				p, ok := s.players[name]
 				if !ok {
 					p = &Player{Name: name}
-					players[name] = p
+					s.players[name] = p
 				}
 				changedPlayer := false
 				if !p.Sharing {
 					p.Sharing = true
 					changedPlayer = true
 				}
-				if me, ok := players[playerName]; ok {
+				if me, ok := s.players[s.playerName]; ok {
 					sc := me.Clan != "" && p.Clan != "" && strings.EqualFold(p.Clan, me.Clan)
 					if p.SameClan != sc {
 						p.SameClan = sc
@@ -337,10 +339,10 @@ func parseShareText(raw []byte, s string) bool {
 					changed = append(changed, *p)
 				}
 			}
-			playersMu.Unlock()
+			s.playersMu.Unlock()
 			for _, pl := range changed {
-				killNameTagCacheFor(pl.Name)
-				notifyPlayerHandlers(pl)
+				s.killNameTagCacheFor(pl.Name)
+				s.notifyPlayerHandlers(pl)
 			}
 			playersDirty = true
 		}
@@ -351,56 +353,60 @@ func parseShareText(raw []byte, s string) bool {
 
 // parseFallenText detects fallen/not-fallen messages and updates state.
 // Returns true if handled.
-func parseFallenText(raw []byte, s string) bool {
-	if playerName != "" {
-		if strings.HasPrefix(s, "You have fallen") {
-			playersMu.Lock()
-			if p, ok := players[playerName]; ok {
+func (s *session) parseFallenText(raw []byte, text string) bool {
+	if s.playerName != "" {
+		if strings.HasPrefix(text, "You have fallen") {
+			s.playersMu.Lock()
+			if p, ok := s.players[s.playerName]; ok {
 				p.Dead = true
 				p.KillerName = ""
 				p.FellWhere = ""
 				p.FellTime = time.Now()
 				playerCopy := *p
-				playersMu.Unlock()
+				s.playersMu.Unlock()
 				playersDirty = true
-				notifyPlayerHandlers(playerCopy)
+				s.notifyPlayerHandlers(playerCopy)
 			} else {
-				playersMu.Unlock()
+				s.playersMu.Unlock()
 				playersDirty = true
 			}
 			if gs.NotifyFallen {
-				showNotification(playerName + " has fallen")
+				s.notify(s.playerName + " has fallen")
 			}
+			s.emitFallenEvent(s.playerName, true, "", "")
+			s.recordStat(statEvent{Kind: statFall, Name: s.playerName, By: utfFold(firstTagContent(raw, 'm', 'n')), Where: firstTagContent(raw, 'l', 'o')})
 			return true
 		}
-		if strings.HasPrefix(s, "You are no longer fallen") {
-			playersMu.Lock()
-			if p, ok := players[playerName]; ok {
+		if strings.HasPrefix(text, "You are no longer fallen") {
+			s.playersMu.Lock()
+			if p, ok := s.players[s.playerName]; ok {
 				p.Dead = false
 				p.FellWhere = ""
 				p.KillerName = ""
 				p.FellTime = time.Time{}
 				playerCopy := *p
-				playersMu.Unlock()
+				s.playersMu.Unlock()
 				playersDirty = true
-				notifyPlayerHandlers(playerCopy)
+				s.notifyPlayerHandlers(playerCopy)
 			} else {
-				playersMu.Unlock()
+				s.playersMu.Unlock()
 				playersDirty = true
 			}
 			if gs.NotifyNotFallen {
-				showNotification(playerName + " is no longer fallen")
+				s.notify(s.playerName + " is no longer fallen")
 			}
+			s.emitFallenEvent(s.playerName, false, "", "")
+			s.recordStat(statEvent{Kind: statRaise, Name: s.playerName, By: raiserName(raw, s.playerName)})
 			return true
 		}
 	}
 	// Fallen: "<pn name> has fallen" (with optional -mn and -lo tags)
-	if strings.Contains(s, " has fallen") {
+	if strings.Contains(text, " has fallen") {
 		// Extract main player name
 		name := utfFold(firstTagContent(raw, 'p', 'n'))
 		if name == "" {
-			if idx := strings.Index(s, " has fallen"); idx >= 0 {
-				name = utfFold(strings.TrimSpace(s[:idx]))
+			if idx := strings.Index(text, " has fallen"); idx >= 0 {
+				name = utfFold(strings.TrimSpace(text[:idx]))
 			}
 		}
 		if name == "" {
@@ -408,59 +414,74 @@ func parseFallenText(raw []byte, s string) bool {
 		}
 		killer := utfFold(firstTagContent(raw, 'm', 'n'))
 		where := firstTagContent(raw, 'l', 'o')
-		p := getPlayer(name)
-		playersMu.Lock()
+		p := s.getPlayer(name)
+		s.playersMu.Lock()
 		p.Dead = true
 		p.KillerName = killer
 		p.FellWhere = where
 		p.FellTime = time.Now()
 		playerCopy := *p
-		playersMu.Unlock()
+		s.playersMu.Unlock()
 		playersDirty = true
-		notifyPlayerHandlers(playerCopy)
+		s.notifyPlayerHandlers(playerCopy)
 		if gs.NotifyFallen {
-			showNotification(name + " has fallen")
+			s.notify(name + " has fallen")
 		}
+		s.emitFallenEvent(name, true, killer, where)
+		s.recordStat(statEvent{Kind: statFall, Name: name, By: killer, Where: where})
 		return true
 	}
 	// Not fallen: "<pn name> is no longer fallen"
-	if strings.Contains(s, " is no longer fallen") {
+	if strings.Contains(text, " is no longer fallen") {
 		name := utfFold(firstTagContent(raw, 'p', 'n'))
 		if name == "" {
-			if idx := strings.Index(s, " is no longer fallen"); idx >= 0 {
-				name = utfFold(strings.TrimSpace(s[:idx]))
+			if idx := strings.Index(text, " is no longer fallen"); idx >= 0 {
+				name = utfFold(strings.TrimSpace(text[:idx]))
 			}
 		}
 		if name == "" {
 			return false
 		}
-		playersMu.Lock()
-		if p, ok := players[name]; ok {
+		s.playersMu.Lock()
+		if p, ok := s.players[name]; ok {
 			p.Dead = false
 			p.FellWhere = ""
 			p.KillerName = ""
 			p.FellTime = time.Time{}
 			playerCopy := *p
-			playersMu.Unlock()
+			s.playersMu.Unlock()
 			playersDirty = true
-			notifyPlayerHandlers(playerCopy)
+			s.notifyPlayerHandlers(playerCopy)
 		} else {
-			playersMu.Unlock()
+			s.playersMu.Unlock()
 			playersDirty = true
 		}
 		if gs.NotifyNotFallen {
-			showNotification(name + " is no longer fallen")
+			s.notify(name + " is no longer fallen")
 		}
+		s.emitFallenEvent(name, false, "", "")
+		s.recordStat(statEvent{Kind: statRaise, Name: name, By: raiserName(raw, name)})
 		return true
 	}
 	return false
 }
 
+// raiserName returns who raised name when a no-longer-fallen message names
+// a second player.
+func raiserName(raw []byte, name string) string {
+	for _, n := range tagContents(raw, 'p', 'n') {
+		if n = utfFold(n); n != "" && n != name {
+			return n
+		}
+	}
+	return ""
+}
+
 // parsePresenceText detects login/logoff/plain presence changes. Returns true if handled.
-func parsePresenceText(raw []byte, s string) bool {
+func (s *session) parsePresenceText(raw []byte, text string) bool {
 	// Attempt to detect common phrases. Names are provided in -pn tags.
 	// We treat any recognized login as Online and any recognized logout as Offline.
-	lower := strings.ToLower(s)
+	lower := strings.ToLower(text)
 	name := utfFold(firstTagContent(raw, 'p', 'n'))
 	if name == "" {
 		return false
@@ -478,8 +499,8 @@ func parsePresenceText(raw []byte, s string) bool {
 		var playerCopy Player
 		var labelChanged bool
 		changed := false
-		playersMu.Lock()
-		if p, ok := players[name]; ok {
+		s.playersMu.Lock()
+		if p, ok := s.players[name]; ok {
 			p.LastSeen = time.Now()
 			p.Offline = false
 			if label >= 0 {
@@ -493,39 +514,41 @@ func parsePresenceText(raw []byte, s string) bool {
 			playerCopy = *p
 			changed = true
 		}
-		playersMu.Unlock()
+		s.playersMu.Unlock()
 		if labelChanged {
-			killNameTagCacheFor(name)
+			s.killNameTagCacheFor(name)
 			playersPersistDirty = true
 		}
 		playersDirty = true
 		if changed {
-			notifyPlayerHandlers(playerCopy)
+			s.notifyPlayerHandlers(playerCopy)
 		}
 		if friend && gs.NotifyFriendOnline {
-			showNotification(name + " is online")
+			s.notify(name + " is online")
 		}
+		s.emitPresenceEvent(name, true)
 		return true
 	}
 	// Logout-like phrases
 	if strings.Contains(lower, "has logged off") || strings.Contains(lower, "has left the lands") || strings.Contains(lower, "has left the world") || strings.Contains(lower, "has departed") || strings.Contains(lower, "has signed off") {
-		playersMu.Lock()
-		if p, ok := players[name]; ok {
+		s.playersMu.Lock()
+		if p, ok := s.players[name]; ok {
 			p.Offline = true
 			if label >= 0 && p.GlobalLabel != label {
 				p.GlobalLabel = label
 				applyPlayerLabel(p)
 				playersPersistDirty = true
-				killNameTagCacheFor(name)
+				s.killNameTagCacheFor(name)
 			}
 			playerCopy := *p
-			playersMu.Unlock()
+			s.playersMu.Unlock()
 			playersDirty = true
-			notifyPlayerHandlers(playerCopy)
+			s.notifyPlayerHandlers(playerCopy)
 		} else {
-			playersMu.Unlock()
+			s.playersMu.Unlock()
 			playersDirty = true
 		}
+		s.emitPresenceEvent(name, false)
 		return true
 	}
 	return false
@@ -534,20 +557,20 @@ func parsePresenceText(raw []byte, s string) bool {
 // parseBardText detects bard guild messages and updates bard status.
 // It also handles bard tune messages. Returns true if the message was fully
 // handled and should not be displayed.
-func parseBardText(raw []byte, s string) bool {
-	s = strings.TrimSpace(s)
-	if strings.HasPrefix(s, "* ") {
-		s = strings.TrimSpace(s[2:])
+func (s *session) parseBardText(raw []byte, text string) bool {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "* ") {
+		text = strings.TrimSpace(text[2:])
 	}
-	if strings.HasPrefix(s, "¥ ") {
-		s = strings.TrimSpace(s[2:])
+	if strings.HasPrefix(text, "¥ ") {
+		text = strings.TrimSpace(text[2:])
 	}
 
 	// Only treat this as music when BEPP explicitly marks it as such ("-mu" or
 	// "-ba"). Avoid acting on plain text without tags.
 	hasMu := bytes.Contains(raw, []byte{0xC2, 'm', 'u'}) || bytes.Contains(raw, []byte{0xC2, 'b', 'a'})
 	if hasMu {
-		if parseMusicCommand(s, raw) {
+		if s.parseMusicCommand(text, raw) {
 			return true
 		}
 	}
@@ -566,21 +589,21 @@ func parseBardText(raw []byte, s string) bool {
 		{" is not a Bard", false},
 	}
 	for _, ph := range phrases {
-		if strings.HasSuffix(s, ph.suffix) {
-			name := strings.TrimSpace(strings.TrimSuffix(s, ph.suffix))
+		if strings.HasSuffix(text, ph.suffix) {
+			name := strings.TrimSpace(strings.TrimSuffix(text, ph.suffix))
 			if name == "" {
 				return false
 			}
-			p := getPlayer(name)
-			playersMu.Lock()
+			p := s.getPlayer(name)
+			s.playersMu.Lock()
 			p.Bard = ph.bard
 			p.LastSeen = time.Now()
 			p.Offline = false
 			playerCopy := *p
-			playersMu.Unlock()
+			s.playersMu.Unlock()
 			playersDirty = true
 			playersPersistDirty = true
-			notifyPlayerHandlers(playerCopy)
+			s.notifyPlayerHandlers(playerCopy)
 			return false
 		}
 	}
@@ -591,54 +614,54 @@ func parseBardText(raw []byte, s string) bool {
 // It supports both the simple "/play <inst> <notes>" form and the slash-delimited
 // backend messages like "/music/.../play/inst<inst>/notes<notes>". If the
 // stripped text is empty, it falls back to decoding the raw BEPP payload.
-func parseMusicCommand(s string, raw []byte) bool {
-	orig := s
+func (s *session) parseMusicCommand(text string, raw []byte) bool {
+	orig := text
 	debug := func(msg string) {
 		if musicDebug {
-			consoleMessage(msg)
-			chatMessage(msg)
+			s.consoleMessage(msg)
+			s.chatMessage(msg)
 			log.Print(msg)
 		}
 	}
-	if s == "" && len(raw) > 0 {
-		s = strings.TrimSpace(decodeMacRoman(raw))
-		orig = s
+	if text == "" && len(raw) > 0 {
+		text = strings.TrimSpace(decodeMacRoman(raw))
+		orig = text
 	}
-	if s == "" {
+	if text == "" {
 		if orig != "" {
 			debug(orig)
 		}
 		return false
 	}
-	if strings.HasPrefix(s, "/music/") {
-		s = s[len("/music/"):]
+	if strings.HasPrefix(text, "/music/") {
+		text = text[len("/music/"):]
 	}
 
 	// Recognize and act on /stop (or /S) even if combined with play.
 	stop := false
-	if strings.Contains(s, "/stop") || strings.Contains(s, "/S") {
+	if strings.Contains(text, "/stop") || strings.Contains(text, "/S") {
 		stop = true
 	}
 
 	// Look for an explicit play command: "/play", "/P" or a leading
 	// "play " (plain text). Avoid misclassifying arbitrary 'P...' lines.
 	simplePlay := false
-	if idx := strings.Index(s, "/play"); idx >= 0 {
-		s = s[idx+len("/play"):]
-	} else if idx := strings.Index(s, "/P"); idx >= 0 {
-		s = s[idx+len("/P"):]
-	} else if strings.HasPrefix(s, "play/") {
-		s = s[len("play"):]
+	if idx := strings.Index(text, "/play"); idx >= 0 {
+		text = text[idx+len("/play"):]
+	} else if idx := strings.Index(text, "/P"); idx >= 0 {
+		text = text[idx+len("/P"):]
+	} else if strings.HasPrefix(text, "play/") {
+		text = text[len("play"):]
 		simplePlay = true
-	} else if strings.HasPrefix(s, "play ") {
-		s = s[len("play "):]
+	} else if strings.HasPrefix(text, "play ") {
+		text = text[len("play "):]
 		simplePlay = true
 	} else {
 		debug(orig)
 		return false
 	}
 
-	s = strings.TrimSpace(s)
+	text = strings.TrimSpace(text)
 
 	// Parse parameters
 	inst := defaultInstrument
@@ -650,8 +673,8 @@ func parseMusicCommand(s string, raw []byte) bool {
 	withIDs := []int{}
 
 	getInt := func(after string) (int, bool) {
-		if idx := strings.Index(s, after); idx >= 0 {
-			v := s[idx+len(after):]
+		if idx := strings.Index(text, after); idx >= 0 {
+			v := text[idx+len(after):]
 			if len(v) > 0 && v[0] == '/' {
 				v = v[1:]
 			}
@@ -685,23 +708,23 @@ func parseMusicCommand(s string, raw []byte) bool {
 	} else if n, ok := getInt("/W"); ok {
 		who = n
 	}
-	if strings.Contains(s, "/me") || strings.Contains(s, "/E") {
+	if strings.Contains(text, "/me") || strings.Contains(text, "/E") {
 		me = true
 	}
-	if strings.Contains(s, "/part") || strings.Contains(s, "/M") {
+	if strings.Contains(text, "/part") || strings.Contains(text, "/M") {
 		part = true
 	}
 	// Extract all /with or /H occurrences
 	scanWith := func(tag string) {
 		pos := 0
 		for {
-			idx := strings.Index(s[pos:], tag)
+			idx := strings.Index(text[pos:], tag)
 			if idx < 0 {
 				break
 			}
 			idx += pos + len(tag)
 			start := idx
-			v := s[idx:]
+			v := text[idx:]
 			if len(v) > 0 && v[0] == '/' {
 				v = v[1:]
 				idx++
@@ -716,7 +739,7 @@ func parseMusicCommand(s string, raw []byte) bool {
 			if pos <= start {
 				pos = start + 1
 			}
-			if pos >= len(s) {
+			if pos >= len(text) {
 				break
 			}
 		}
@@ -725,15 +748,15 @@ func parseMusicCommand(s string, raw []byte) bool {
 	scanWith("/H")
 
 	notes := ""
-	if idx := strings.Index(s, "/notes"); idx >= 0 {
-		notes = s[idx+len("/notes"):]
-	} else if idx := strings.Index(s, "/N"); idx >= 0 {
-		notes = s[idx+len("/N"):]
+	if idx := strings.Index(text, "/notes"); idx >= 0 {
+		notes = text[idx+len("/notes"):]
+	} else if idx := strings.Index(text, "/N"); idx >= 0 {
+		notes = text[idx+len("/N"):]
 	} else if simplePlay {
 		// Accept the simple "play <inst> <notes>" form only when starting with
 		// "play ". Require an instrument integer before notes to avoid false
 		// positives on regular sentences.
-		f := strings.Fields(s)
+		f := strings.Fields(text)
 		if len(f) >= 2 {
 			if n, err := strconv.Atoi(f[0]); err == nil {
 				inst = n
@@ -744,7 +767,7 @@ func parseMusicCommand(s string, raw []byte) bool {
 	notes = strings.Trim(notes, "/")
 
 	if stop {
-		handleMusicParams(MusicParams{Stop: true})
+		s.handleMusicParams(MusicParams{Stop: true})
 		// Continue to parse play if present; otherwise return.
 		if strings.TrimSpace(notes) == "" && !part {
 			return true
@@ -762,7 +785,7 @@ func parseMusicCommand(s string, raw []byte) bool {
 		debug(msg)
 	}
 	go func() {
-		handleMusicParams(MusicParams{Inst: inst, Notes: notes, Tempo: tempo, VolPct: vol, Part: part, Who: who, With: withIDs, Me: me})
+		s.handleMusicParams(MusicParams{Inst: inst, Notes: notes, Tempo: tempo, VolPct: vol, Part: part, Who: who, With: withIDs, Me: me})
 	}()
 	return true
 }
@@ -3,15 +3,15 @@ package main
 import "testing"
 
 func TestParseShareTextHeroShareUnshareOthers(t *testing.T) {
-	playerName = "Hero"
-	players = make(map[string]*Player)
+	mainSession.playerName = "Hero"
+	mainSession.players = make(map[string]*Player)
 
 	// Hero shares Bob
 	shareRaw := append(pn("Hero"), []byte(" is sharing experiences with ")...)
 	shareRaw = append(shareRaw, pn("Bob")...)
 	shareRaw = append(shareRaw, '.')
-	parseShareText(shareRaw, "Hero is sharing experiences with Bob.")
-	if p, ok := players["Bob"]; !ok || !p.Sharee {
+	mainSession.parseShareText(shareRaw, "Hero is sharing experiences with Bob.")
+	if p, ok := mainSession.players["Bob"]; !ok || !p.Sharee {
 		t.Fatalf("Bob not marked sharee after share: %+v", p)
 	}
 
@@ -19,8 +19,8 @@ func TestParseShareTextHeroShareUnshareOthers(t *testing.T) {
 	unshareRaw := append(pn("Hero"), []byte(" is no longer sharing experiences with ")...)
 	unshareRaw = append(unshareRaw, pn("Bob")...)
 	unshareRaw = append(unshareRaw, '.')
-	parseShareText(unshareRaw, "Hero is no longer sharing experiences with Bob.")
-	if p, ok := players["Bob"]; ok && p.Sharee {
+	mainSession.parseShareText(unshareRaw, "Hero is no longer sharing experiences with Bob.")
+	if p, ok := mainSession.players["Bob"]; ok && p.Sharee {
 		t.Fatalf("Bob still marked sharee after unshare: %+v", p)
 	}
 }
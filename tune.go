@@ -719,7 +719,12 @@ var (
 
 // handleMusicParams translates parsed music params into queued playback. It
 // supports /stop, /part accumulation and tempo/volume/instrument parameters.
-func handleMusicParams(mp MusicParams) {
+// Only the session in the game window plays music.
+func (s *session) handleMusicParams(mp MusicParams) {
+	if !s.isFocused() {
+		return
+	}
+	s.emitMusicEvent(mp)
 	if mp.Stop {
 		// Scoped stop: if who provided, clear that pending and stop if playing.
 		if mp.Who != 0 {
@@ -69,6 +69,12 @@ var windowsInventoryCB *eui.ItemData
 var windowsChatCB *eui.ItemData
 var windowsConsoleCB *eui.ItemData
 var windowsHelpCB *eui.ItemData
+var windowsHistoryCB *eui.ItemData
+var windowsSessionsCB *eui.ItemData
+var windowsMinimapCB *eui.ItemData
+var windowsWorldMapCB *eui.ItemData
+var windowsAssetsCB *eui.ItemData
+var windowsStatsCB *eui.ItemData
 var hudWin *eui.WindowData
 var rightHandImg *eui.ItemData
 var leftHandImg *eui.ItemData
@@ -141,6 +147,30 @@ func init() {
 			windowsHelpCB.Checked = helpWin != nil && helpWin.IsOpen()
 			windowsHelpCB.Dirty = true
 		}
+		if windowsHistoryCB != nil {
+			windowsHistoryCB.Checked = historyWin != nil && historyWin.IsOpen()
+			windowsHistoryCB.Dirty = true
+		}
+		if windowsSessionsCB != nil {
+			windowsSessionsCB.Checked = sessionsWin != nil && sessionsWin.IsOpen()
+			windowsSessionsCB.Dirty = true
+		}
+		if windowsMinimapCB != nil {
+			windowsMinimapCB.Checked = minimapWin != nil && minimapWin.IsOpen()
+			windowsMinimapCB.Dirty = true
+		}
+		if windowsWorldMapCB != nil {
+			windowsWorldMapCB.Checked = worldMapWin != nil && worldMapWin.IsOpen()
+			windowsWorldMapCB.Dirty = true
+		}
+		if windowsAssetsCB != nil {
+			windowsAssetsCB.Checked = assetsWin != nil && assetsWin.IsOpen()
+			windowsAssetsCB.Dirty = true
+		}
+		if windowsStatsCB != nil {
+			windowsStatsCB.Checked = statsWin != nil && statsWin.IsOpen()
+			windowsStatsCB.Dirty = true
+		}
 		if windowsWin != nil {
 			windowsWin.Refresh()
 		}
@@ -150,8 +180,9 @@ func init() {
 		// list includes everyone online, not just nearby mobiles.
 		if playersWin != nil && playersWin.IsOpen() {
 			if time.Since(lastWhoRequest) > 5*time.Second {
-				pendingCommand = "/be-who"
-				lastWhoRequest = time.Now()
+				if focusedSession().trySetPendingCommand("/be-who") {
+					lastWhoRequest = time.Now()
+				}
 			}
 		}
 	}
@@ -187,14 +218,20 @@ func initUI() {
 	makeMacrosWindow()
 	makeHotkeysWindow()
 	makeTriggersWindow()
+	makeHistoryWindow()
+	makeSessionsWindow()
+	makeMinimapWindow()
+	makeWorldMapWindow()
+	makeAssetsWindow()
+	makeStatsWindow()
 	makePluginsWindow()
 	makeMixerWindow()
 	makeToolbar()
 
 	// Load any persisted players data (e.g., from prior sessions) so
 	// avatars/classes can show up immediately.
-	loadPlayersPersist()
-	backfillCharactersFromPlayers()
+	mainSession.loadPlayersPersist()
+	mainSession.backfillCharactersFromPlayers()
 
 	if status.NeedImages || status.NeedSounds {
 		downloadWin.MarkOpen()
@@ -269,6 +306,19 @@ func buildToolbar(toolFontSize, buttonWidth, buttonHeight float32) *eui.ItemData
 	}
 	row1.AddItem(actionsBtn)
 
+	var recEvents *eui.EventHandler
+	recordBtn, recEvents = eui.NewButton()
+	recordBtn.Text = "Record"
+	recordBtn.Size = eui.Point{X: buttonWidth, Y: buttonHeight}
+	recordBtn.FontSize = toolFontSize
+	recordBtn.Tooltip = "Record this session to a .clMov file"
+	recEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventClick {
+			toggleMovieRecording()
+		}
+	}
+	row1.AddItem(recordBtn)
+
 	helpBtn, helpEvents := eui.NewButton()
 	helpBtn.Text = "Help"
 	helpBtn.Size = eui.Point{X: buttonWidth, Y: buttonHeight}
@@ -432,6 +482,7 @@ func refreshPluginsWindow() {
 		cat     string
 		sub     string
 		invalid bool
+		failed  bool
 	}
 	pluginMu.RLock()
 	cats := make(map[string][]entry)
@@ -443,6 +494,7 @@ func refreshPluginsWindow() {
 			cat:     pluginCategories[o],
 			sub:     pluginSubCategories[o],
 			invalid: pluginInvalid[o],
+			failed:  pluginLoadErrors[o] != "",
 		})
 	}
 	pluginMu.RUnlock()
@@ -472,13 +524,14 @@ func refreshPluginsWindow() {
 		sort.Slice(plist, func(i, j int) bool {
 			return strings.ToLower(plist[i].name) < strings.ToLower(plist[j].name)
 		})
+		me := focusedSession().playerName
 		for _, e := range plist {
 			row := &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_HORIZONTAL}
 			charCB, charEvents := eui.NewCheckbox()
 			charCB.Size = checkSize
 			allCB, allEvents := eui.NewCheckbox()
 			allCB.Size = checkSize
-			charCB.Checked = playerName != "" && e.scope == playerName
+			charCB.Checked = me != "" && e.scope == me
 			charCB.Disabled = e.invalid
 			allCB.Checked = e.scope == "all"
 			allCB.Disabled = e.invalid
@@ -486,6 +539,9 @@ func refreshPluginsWindow() {
 			if e.sub != "" {
 				label += " [" + e.sub + "]"
 			}
+			if e.failed {
+				label += " (error)"
+			}
 			owner := e.owner
 			click := func() { selectPlugin(owner) }
 			if selectedPlugin == owner {
@@ -527,8 +583,7 @@ func refreshPluginsWindow() {
 						enabled := !pluginDisabled[owner]
 						pluginMu.RUnlock()
 						if enabled {
-							disablePlugin(owner, "reloaded")
-							enablePlugin(owner)
+							reloadPlugin(owner)
 						}
 					}
 				}
@@ -615,7 +670,38 @@ func refreshPluginDetails() {
 	if invalid {
 		errText = "Invalid plugin"
 	}
-	line("Errors: " + errText)
+	if loadErr := pluginLoadError(owner); loadErr != "" {
+		line("Errors:")
+		for _, l := range pluginErrorLines(loadErr) {
+			line("  " + l)
+		}
+	} else {
+		line("Errors: " + errText)
+	}
+
+	pluginMu.RLock()
+	perms := append([]string(nil), pluginRequested[owner]...)
+	pluginMu.RUnlock()
+	if len(perms) == 0 {
+		line("Permissions: none")
+	} else if pluginNeedsConsent(owner) {
+		line("Permissions: " + strings.Join(perms, ", ") + " (not allowed)")
+		reviewBtn, rh := eui.NewButton()
+		reviewBtn.Text = "Review permissions"
+		reviewBtn.Size = eui.Point{X: 160, Y: 24}
+		rh.Handle = func(ev eui.UIEvent) {
+			if ev.Type == eui.EventClick {
+				showPluginConsent(owner, func() {
+					applyEnabledPlugins()
+					saveSettings()
+					refreshPluginsWindow()
+				})
+			}
+		}
+		pluginDetails.AddItem(reviewBtn)
+	} else {
+		line("Permissions: " + strings.Join(perms, ", "))
+	}
 
 	macroMu.RLock()
 	m := macroMaps[owner]
@@ -939,8 +1025,12 @@ func makeToolbar() {
 	go func() {
 		for {
 			time.Sleep(time.Second * 5)
+			s := focusedSession()
+			s.latencyMu.Lock()
+			latency, jitter := s.netLatency, s.netJitter
+			s.latencyMu.Unlock()
 			hudWin.Title = fmt.Sprintf("Toolbar - FPS: %4.0f Loss: %0.0f%% Ping: %-3v Jit: %-3v",
-				ebiten.ActualFPS(), droppedPercent(), netLatency.Milliseconds(), netJitter.Milliseconds())
+				ebiten.ActualFPS(), s.droppedPercent(), latency.Milliseconds(), jitter.Milliseconds())
 			hudWin.Refresh()
 
 		}
@@ -1033,7 +1123,7 @@ func confirmExitSession() {
 		})
 		return
 	}
-	if tcpConn != nil { // Connected to server
+	if mainSession.connected() || reconnectPending() { // Connected or reconnecting
 		showPopup("Exit Session", "Disconnect and return to login?", []popupButton{
 			{Text: "Cancel"},
 			{Text: "Disconnect", Color: &eui.ColorDarkRed, HoverColor: &eui.ColorRed, Action: func() {
@@ -1369,6 +1459,7 @@ func makeDownloadsWindow() {
 				img.DenoiseSharpness = gs.DenoiseSharpness
 				img.DenoiseAmount = gs.DenoiseAmount
 				clImages = img
+				autoMap.relayout()
 			}
 
 			clSounds, err = clsnd.Load(filepath.Join("data/CL_Sounds"))
@@ -1380,7 +1471,7 @@ func makeDownloadsWindow() {
 			if s, err := checkDataFiles(clientVersion); err == nil {
 				status = s
 			}
-			if name == "" && loginWin != nil {
+			if mainSession.name == "" && loginWin != nil {
 				// Force reselect from LastCharacter if available
 				passHash = ""
 				pass = ""
@@ -1391,7 +1482,7 @@ func makeDownloadsWindow() {
 			downloadStatus = nil
 			downloadProgress = nil
 			downloadWin.Close()
-			if name == "" && loginWin != nil {
+			if mainSession.name == "" && loginWin != nil {
 				loginWin.MarkOpen()
 			}
 		}()
@@ -1441,19 +1532,19 @@ func updateCharacterButtons() {
 	if charactersList == nil {
 		return
 	}
-	if name == "" {
+	if mainSession.name == "" {
 		if gs.LastCharacter != "" {
 			for _, c := range characters {
 				if c.Name == gs.LastCharacter {
-					name = c.Name
+					mainSession.name = c.Name
 					passHash = c.passHash
 					pass = ""
 					break
 				}
 			}
 		}
-		if name == "" && len(characters) == 1 {
-			name = characters[0].Name
+		if mainSession.name == "" && len(characters) == 1 {
+			mainSession.name = characters[0].Name
 			passHash = characters[0].passHash
 			pass = ""
 		}
@@ -1469,7 +1560,7 @@ func updateCharacterButtons() {
 		empty.FontSize = 14
 		empty.Size = eui.Point{X: charWinWidth, Y: 64}
 		charactersList.AddItem(empty)
-		name = ""
+		mainSession.name = ""
 		passHash = ""
 		pass = ""
 	} else {
@@ -1518,16 +1609,16 @@ func updateCharacterButtons() {
 			radio.Text = c.Name
 			radio.RadioGroup = "characters"
 			radio.Size = eui.Point{X: 150, Y: 24}
-			radio.Checked = name == c.Name
+			radio.Checked = mainSession.name == c.Name
 			nameCopy := c.Name
 			hashCopy := c.passHash
-			if name == c.Name {
+			if mainSession.name == c.Name {
 				passHash = c.passHash
 				pass = ""
 			}
 			radioEvents.Handle = func(ev eui.UIEvent) {
 				if ev.Type == eui.EventRadioSelected {
-					name = nameCopy
+					mainSession.name = nameCopy
 					passHash = hashCopy
 					pass = ""
 					gs.LastCharacter = nameCopy
@@ -1557,6 +1648,7 @@ func updateCharacterButtons() {
 			charactersList.AddItem(row)
 		}
 	}
+	updateVaultRow()
 	// Preserve window position while contents change size
 	loginWin.Refresh()
 }
@@ -1623,7 +1715,7 @@ func makeAddCharacterWindow() {
 			}
 			saveCharacters()
 			// Update selection to the newly added character
-			name = addCharName
+			mainSession.name = addCharName
 			passHash = hash
 			pass = ""
 			gs.LastCharacter = addCharName
@@ -1813,7 +1905,7 @@ func makeLoginWindow() {
 	loginWin.DefaultButton = connBtn
 	connEvents.Handle = func(ev eui.UIEvent) {
 		if ev.Type == eui.EventClick {
-			if name == "" {
+			if mainSession.name == "" {
 				makeErrorWindow("Error: Login: login is empty")
 				return
 			}
@@ -1829,7 +1921,7 @@ func makeLoginWindow() {
 				passWin.MarkOpenNear(ev.Item)
 				return
 			}
-			gs.LastCharacter = name
+			gs.LastCharacter = mainSession.name
 			saveSettings()
 			startLogin()
 			updateCharacterButtons()
@@ -1849,7 +1941,7 @@ func makeLoginWindow() {
 					makeErrorWindow("Error: Demo: " + err.Error())
 					return
 				}
-				name = n
+				mainSession.name = n
 				passHash = ""
 				pass = "demo"
 				startLogin()
@@ -1899,10 +1991,10 @@ func makeLoginWindow() {
 					makeErrorWindow("Error: Open clMov: " + err.Error())
 					return
 				}
-				playerName = extractMoviePlayerName(frames)
+				mainSession.playerName = extractMoviePlayerName(frames)
 				applyEnabledPlugins()
 				ctx, cancel := context.WithCancel(gameCtx)
-				mp := newMoviePlayer(frames, clMovFPS, cancel)
+				mp := newMoviePlayer(mainSession, frames, clMovFPS, cancel)
 				mp.makePlaybackWindow()
 				if (gs.precacheSounds || gs.precacheImages) && !assetsPrecached {
 					for !assetsPrecached {
@@ -1951,6 +2043,8 @@ func makeLoginWindow() {
 	label.FontSize = 15
 	label.Size = eui.Point{X: 1, Y: 25}
 	loginFlow.AddItem(label)
+	vaultRow = &eui.ItemData{ItemType: eui.ITEM_FLOW, FlowType: eui.FLOW_VERTICAL}
+	loginFlow.AddItem(vaultRow)
 	loginFlow.AddItem(charactersList)
 	label, _ = eui.NewText()
 	label.Text = ""
@@ -2308,6 +2402,21 @@ func makeSettingsWindow() {
 	}
 	left.AddItem(inputOpenCB)
 
+	reconnectCB, reconnectEvents := eui.NewCheckbox()
+	reconnectCB.Text = "Reconnect automatically"
+	reconnectCB.Size = eui.Point{X: panelWidth, Y: 24}
+	reconnectCB.Checked = gs.AutoReconnect
+	reconnectCB.Tooltip = "Log the same character back in when the connection drops"
+	reconnectEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			SettingsLock.Lock()
+			gs.AutoReconnect = ev.Checked
+			SettingsLock.Unlock()
+			settingsDirty = true
+		}
+	}
+	left.AddItem(reconnectCB)
+
 	keySpeedSlider, keySpeedEvents := eui.NewSlider()
 	keySpeedSlider.Label = "Keyboard Walk Speed"
 	keySpeedSlider.MinValue = 0.1
@@ -2568,7 +2677,9 @@ func makeSettingsWindow() {
 			defer SettingsLock.Unlock()
 
 			gs.NameBgOpacity = float64(ev.Value)
-			killNameTagCache()
+			for _, s := range allSessions() {
+				s.killNameTagCache()
+			}
 			settingsDirty = true
 		}
 	}
@@ -3226,8 +3337,8 @@ func confirmRemoveCharacter(c Character) {
 			{Text: "Cancel"},
 			{Text: "Yes, remove it", Color: &eui.ColorDarkRed, HoverColor: &eui.ColorRed, Action: func() {
 				removeCharacter(c.Name)
-				if name == c.Name {
-					name = ""
+				if mainSession.name == c.Name {
+					mainSession.name = ""
 					passHash = ""
 					pass = ""
 				}
@@ -3733,6 +3844,7 @@ func makeQualityWindow() {
 
 	outer.AddItem(left)
 	outer.AddItem(center)
+	outer.AddItem(makeHDPackPane(panelWidth))
 	qualityWin.AddItem(outer)
 	qualityWin.AddWindow(false)
 }
@@ -4259,6 +4371,105 @@ func makeWindowsWindow() {
 	}
 	flow.AddItem(consoleBox)
 
+	historyBox, historyBoxEvents := eui.NewCheckbox()
+	windowsHistoryCB = historyBox
+	historyBox.Text = "History"
+	historyBox.Size = eui.Point{X: 128, Y: 24}
+	historyBox.Checked = historyWin != nil && historyWin.IsOpen()
+	historyBoxEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			if ev.Checked {
+				historyWin.MarkOpenNear(ev.Item)
+			} else {
+				historyWin.Close()
+			}
+		}
+	}
+	flow.AddItem(historyBox)
+
+	sessionsBox, sessionsBoxEvents := eui.NewCheckbox()
+	windowsSessionsCB = sessionsBox
+	sessionsBox.Text = "Alt Sessions"
+	sessionsBox.Size = eui.Point{X: 128, Y: 24}
+	sessionsBox.Checked = sessionsWin != nil && sessionsWin.IsOpen()
+	sessionsBoxEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			if ev.Checked {
+				updateSessionsWindow()
+				sessionsWin.MarkOpenNear(ev.Item)
+			} else {
+				sessionsWin.Close()
+			}
+		}
+	}
+	flow.AddItem(sessionsBox)
+
+	minimapBox, minimapBoxEvents := eui.NewCheckbox()
+	windowsMinimapCB = minimapBox
+	minimapBox.Text = "Minimap"
+	minimapBox.Size = eui.Point{X: 128, Y: 24}
+	minimapBox.Checked = minimapWin != nil && minimapWin.IsOpen()
+	minimapBoxEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			if ev.Checked {
+				minimapWin.MarkOpenNear(ev.Item)
+			} else {
+				minimapWin.Close()
+			}
+		}
+	}
+	flow.AddItem(minimapBox)
+
+	worldMapBox, worldMapBoxEvents := eui.NewCheckbox()
+	windowsWorldMapCB = worldMapBox
+	worldMapBox.Text = "World Map"
+	worldMapBox.Size = eui.Point{X: 128, Y: 24}
+	worldMapBox.Checked = worldMapWin != nil && worldMapWin.IsOpen()
+	worldMapBoxEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			if ev.Checked {
+				openFullMap()
+			} else {
+				worldMapWin.Close()
+			}
+		}
+	}
+	flow.AddItem(worldMapBox)
+
+	assetsBox, assetsBoxEvents := eui.NewCheckbox()
+	windowsAssetsCB = assetsBox
+	assetsBox.Text = "Assets"
+	assetsBox.Size = eui.Point{X: 128, Y: 24}
+	assetsBox.Checked = assetsWin != nil && assetsWin.IsOpen()
+	assetsBoxEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			if ev.Checked {
+				refreshAssets()
+				assetsWin.MarkOpenNear(ev.Item)
+			} else {
+				assetsWin.Close()
+			}
+		}
+	}
+	flow.AddItem(assetsBox)
+
+	statsBox, statsBoxEvents := eui.NewCheckbox()
+	windowsStatsCB = statsBox
+	statsBox.Text = "Stats"
+	statsBox.Size = eui.Point{X: 128, Y: 24}
+	statsBox.Checked = statsWin != nil && statsWin.IsOpen()
+	statsBoxEvents.Handle = func(ev eui.UIEvent) {
+		if ev.Type == eui.EventCheckboxChanged {
+			if ev.Checked {
+				refreshStatsWindow()
+				statsWin.MarkOpenNear(ev.Item)
+			} else {
+				statsWin.Close()
+			}
+		}
+	}
+	flow.AddItem(statsBox)
+
 	helpBox, helpBoxEvents := eui.NewCheckbox()
 	windowsHelpCB = helpBox
 	helpBox.Text = "Help"
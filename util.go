@@ -78,11 +78,17 @@ var errorNames = map[int16]string{
 	-30996: "kIncompatibleVersions",
 	-30992: "kShuttingDown",
 	-30991: "kGameNotOpen",
+	-30989: "kAccountLockedOut",
 	-30988: "kBadAcctName",
 	-30987: "kBadAcctPass",
 	-30985: "kNoFreeSlot",
 	-30984: "kBadAcctChar",
+	-30982: "kCharDeleted",
 	-30981: "kCharOnline",
+	-30978: "kAccountExpired",
+	-30975: "kBadIdentifiers",
+	-30971: "kMachineLockedOut",
+	-30970: "kImageChecksumError",
 }
 
 // errorFriendly maps known kError codes to concise, plain-English descriptions
@@ -94,11 +100,17 @@ var errorFriendly = map[int16]string{
 	-30996: "Incompatible client version",
 	-30992: "Server is shutting down",
 	-30991: "Game is not open",
+	-30989: "Account is locked; contact customer service",
 	-30988: "Unknown account name",
 	-30987: "Incorrect account password",
 	-30985: "Server is full (no free slot)",
 	-30984: "Character does not belong to this account",
+	-30982: "Character has been deleted",
 	-30981: "Character is already logged in",
+	-30978: "Subscription has expired",
+	-30975: "Server did not receive client identifiers",
+	-30971: "This computer has been blocked from the game",
+	-30970: "CL_Images is corrupt or altered",
 	-30973: "A newer client/data version is required (test)",
 	-30972: "A newer client/data version is required",
 }
@@ -119,68 +131,125 @@ func describeKError(code int16) (desc, name string, ok bool) {
 
 var doDebug bool
 var silent bool
-var ackFrame int32
-var resendFrame int32
-var lastAckFrame int32
-var numFrames int
-var lostFrames int
-var frameBuckets [5]int
-var lostBuckets [5]int
-var bucketTimes [5]int64
-var commandNum uint32 = 1
-var pendingCommand string
-var commandQueue []string
-var playerName string
-var playerIndex uint8 = 0xff
 
+// enqueueCommand queues cmd for the session in the game window unless it is
+// a session command such as /as.
 func enqueueCommand(cmd string) {
-	if cmd != "" {
-		commandQueue = append(commandQueue, cmd)
+	if runSessionCommand(cmd) {
+		return
 	}
+	queueCommand(cmd)
+}
+
+// queueCommand appends cmd to the outgoing queue of the session in the game
+// window without checking for session commands.
+func queueCommand(cmd string) {
+	focusedSession().queueCommand(cmd)
 }
 
+// nextCommand moves the next command queued for the session in the game
+// window into place.
 func nextCommand() {
-	if pendingCommand == "" && len(commandQueue) > 0 {
-		pendingCommand = commandQueue[0]
-		commandQueue = commandQueue[1:]
+	focusedSession().nextCommand()
+}
+
+// queueCommand appends cmd to s's outgoing queue.
+func (s *session) queueCommand(cmd string) {
+	if cmd == "" {
+		return
+	}
+	s.commandMu.Lock()
+	s.commandQueue = append(s.commandQueue, cmd)
+	s.commandMu.Unlock()
+}
+
+func (s *session) nextCommand() {
+	s.commandMu.Lock()
+	s.nextCommandLocked()
+	s.commandMu.Unlock()
+}
+
+func (s *session) nextCommandLocked() {
+	if s.pendingCommand == "" && len(s.commandQueue) > 0 {
+		s.pendingCommand = s.commandQueue[0]
+		s.commandQueue = s.commandQueue[1:]
 	}
 }
 
+// takeCommand returns the command to send with the next input packet and
+// moves the following one into its place.
+func (s *session) takeCommand() string {
+	s.commandMu.Lock()
+	defer s.commandMu.Unlock()
+	s.nextCommandLocked()
+	cmd := s.pendingCommand
+	s.pendingCommand = ""
+	s.nextCommandLocked()
+	return cmd
+}
+
+// commandPending reports whether a command is waiting to be sent.
+func (s *session) commandPending() bool {
+	s.commandMu.Lock()
+	defer s.commandMu.Unlock()
+	return s.pendingCommand != ""
+}
+
+// trySetPendingCommand sends cmd next unless another command is already
+// pending. It reports whether cmd was set.
+func (s *session) trySetPendingCommand(cmd string) bool {
+	s.commandMu.Lock()
+	defer s.commandMu.Unlock()
+	if s.pendingCommand != "" {
+		return false
+	}
+	s.pendingCommand = cmd
+	return true
+}
+
+// clearCommands drops the pending command and everything queued behind it.
+func (s *session) clearCommands() {
+	s.commandMu.Lock()
+	s.pendingCommand = ""
+	s.commandQueue = nil
+	s.commandMu.Unlock()
+}
+
 // updateFrameCounters tracks frame statistics and detects dropped frames.
 // It returns the number of frames missing between the previous and
 // current acknowledgement numbers.
-func updateFrameCounters(newFrame int32) int {
+func (s *session) updateFrameCounters(newFrame int32) int {
 	now := time.Now().Unix()
 	idx := int(now % 5)
-	if bucketTimes[idx] != now {
-		frameBuckets[idx] = 0
-		lostBuckets[idx] = 0
-		bucketTimes[idx] = now
+	if s.bucketTimes[idx] != now {
+		s.frameBuckets[idx] = 0
+		s.lostBuckets[idx] = 0
+		s.bucketTimes[idx] = now
 	}
-	frameBuckets[idx]++
-	numFrames++
+	s.frameBuckets[idx]++
+	s.numFrames++
 	dropped := 0
-	if lastAckFrame != 0 {
-		lost := int(newFrame - lastAckFrame - 1)
+	if s.lastAckFrame != 0 {
+		lost := int(newFrame - s.lastAckFrame - 1)
 		if lost > 0 {
-			lostFrames += lost
+			s.lostFrames += lost
 			dropped = lost
-			frameBuckets[idx] += lost
-			lostBuckets[idx] += lost
+			s.frameBuckets[idx] += lost
+			s.lostBuckets[idx] += lost
 		}
 	}
-	lastAckFrame = newFrame
+	s.lastAckFrame = newFrame
 	return dropped
 }
 
-func droppedPercent() float64 {
+func (s *session) droppedPercent() float64 {
 	now := time.Now().Unix()
 	total := 0
 	lost := 0
 	for i := 0; i < 5; i++ {
-		if now-bucketTimes[i] < 5 {
-			total += frameBuckets[i]
-			lost += lostBuckets[i]
+		if now-s.bucketTimes[i] < 5 {
+			total += s.frameBuckets[i]
+			lost += s.lostBuckets[i]
 		}
 	}
 	if total == 0 {
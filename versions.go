@@ -143,7 +143,7 @@ func checkForNewVersion() {
 	}
 	if latest.Version > appVersion {
 		consoleMessage(fmt.Sprintf("New goThoom version %d available", latest.Version))
-		if tcpConn != nil {
+		if mainSession.connected() {
 			if gs.NotifiedVersion >= latest.Version {
 				return
 			}
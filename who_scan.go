@@ -4,47 +4,42 @@ import (
 	"time"
 )
 
-// Simple manager to coordinate multi-batch /be-who scans and throttle requests.
-var (
-	whoActive           bool
-	whoLastRequest      time.Time
-	whoCooldown               = 1 * time.Second
-	whoLastCommandFrame int32 = -1
-)
+// Simple manager to coordinate multi-batch /be-who scans and throttle
+// requests. The scan state lives in each session.
+const whoCooldown = 1 * time.Second
 
 // considerNextWhoBatch decides if we should ask for another page.
 // The classic client expects batches of up to 20; continue when we saw a full
 // batch and it added at least one new name.
-func considerNextWhoBatch(batchCount, newCount int) {
+func (s *session) considerNextWhoBatch(batchCount, newCount int) {
 	if batchCount >= 20 && newCount > 0 {
-		whoActive = true
+		s.whoActive = true
 		// Schedule another request soon; the actual command emission happens
 		// in pickQueuedCommand() to coalesce with other command traffic.
 		return
 	}
 	// Fewer than 20 or no new names: end the scan.
-	whoActive = false
+	s.whoActive = false
 }
 
 // maybeEnqueueWho sets a pending /be-who when throttled and no other command
 // is pending. Returns true if it queued a command.
-func maybeEnqueueWho() bool {
-	if !whoActive {
+func (s *session) maybeEnqueueWho() bool {
+	if !s.whoActive {
 		return false
 	}
 	// Only if there have been no commands in the last 30 frames.
-	if whoLastCommandFrame >= 0 {
-		if (ackFrame - whoLastCommandFrame) < 30 {
+	if s.whoLastCommandFrame >= 0 {
+		if (s.ackFrame - s.whoLastCommandFrame) < 30 {
 			return false
 		}
 	}
-	if time.Since(whoLastRequest) < whoCooldown {
+	if time.Since(s.whoLastRequest) < whoCooldown {
 		return false
 	}
-	if pendingCommand != "" {
+	if !s.trySetPendingCommand("/be-who") {
 		return false
 	}
-	pendingCommand = "/be-who"
-	whoLastRequest = time.Now()
+	s.whoLastRequest = time.Now()
 	return true
 }